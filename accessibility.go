@@ -0,0 +1,55 @@
+// accessibility.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+)
+
+// imgui doesn't provide an accessibility tree that screen readers can
+// use, so important changes in the UI's state--dialog boxes opening, the
+// sim pausing, and so forth--are instead announced using the platform's
+// speech services, if the user has enabled announcements. On Linux this
+// goes through speech-dispatcher, which is shared with screen readers
+// like Orca.
+
+// announce speaks the given message if the user has enabled
+// announcements. It returns immediately, without waiting for the message
+// to be spoken.
+func announce(msg string) {
+	if globalConfig == nil || !globalConfig.Announcements || msg == "" {
+		return
+	}
+
+	cmd := speechCommand(msg, nil, "")
+	if cmd == nil {
+		lg.Errorf("Announcing \"%s\": %v", msg, ErrNoSpeechSynthesizer)
+		return
+	}
+
+	lg.Printf("Announcing \"%s\"", msg)
+	go func() {
+		defer reportGoroutinePanic()
+		if err := cmd.Run(); err != nil {
+			lg.Errorf("%s: %v", cmd.Path, err)
+		}
+	}()
+}
+
+// announceDialog announces that a dialog box has opened, along with the
+// buttons that are available in it.
+func announceDialog(title string, buttons []ModalDialogButton) {
+	var b []string
+	for _, button := range buttons {
+		if !button.disabled {
+			b = append(b, strings.TrimSuffix(button.text, "..."))
+		}
+	}
+	msg := title + " dialog."
+	if len(b) > 0 {
+		msg += " Buttons: " + strings.Join(b, ", ") + "."
+	}
+	announce(msg)
+}
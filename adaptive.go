@@ -0,0 +1,128 @@
+// adaptive.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// With adaptive traffic, the Sim periodically reviews how the user is
+// coping and scales the spawn rates up or down to keep them busy but not
+// overwhelmed. The workload indicators are the ones that are tracked for
+// scoring (see scoring.go): how long pilots wait to hear back after
+// checking in, losses of separation, and missed handoffs and check-ins.
+// Each adjustment is recorded in the session's score so that the debrief
+// can show how the traffic level changed over the session.
+
+const (
+	// How often the traffic level is reviewed.
+	adaptiveInterval = 2 * time.Minute
+	// Limits on the factor that spawn rates are scaled by.
+	adaptiveMinScale = 0.25
+	adaptiveMaxScale = 2.5
+	// Average check-in response times below which the user is
+	// considered to have capacity to spare and above which they are
+	// falling behind.
+	adaptiveFastResponse = 15 * time.Second
+	adaptiveSlowResponse = 35 * time.Second
+)
+
+// TrafficAdaptation records a single review of the user's workload and
+// the resulting traffic level.
+type TrafficAdaptation struct {
+	Time time.Time
+	// Factor that the scenario's spawn rates are scaled by after the
+	// review.
+	Scale float32
+	// Average time for the user to respond to check-ins during the
+	// preceding interval; zero if no pilots checked in.
+	ResponseTime time.Duration
+	Conflicts    int
+	// Late handoffs and unanswered check-ins.
+	Missed int
+}
+
+// adaptiveState holds the workload indicators gathered since the last
+// review.
+type adaptiveState struct {
+	lastReview    time.Time
+	responseTimes []time.Duration
+	// Number of scored errors at the last review.
+	errorCount int
+}
+
+// trafficScale returns the factor that spawn rates are currently scaled
+// by.
+func (sim *Sim) trafficScale() float32 {
+	if !sim.AdaptiveTraffic || sim.TrafficScale == 0 {
+		return 1
+	}
+	return sim.TrafficScale
+}
+
+// adaptiveResponse records the time the user took to respond to a pilot
+// checking in.
+func (sim *Sim) adaptiveResponse(d time.Duration) {
+	if sim.adaptive != nil {
+		sim.adaptive.responseTimes = append(sim.adaptive.responseTimes, d)
+	}
+}
+
+// updateAdaptiveTraffic reviews the user's workload and adjusts the
+// traffic level; it should be called once a second.
+func (sim *Sim) updateAdaptiveTraffic(now time.Time) {
+	if !sim.AdaptiveTraffic || sim.scorer == nil {
+		return
+	}
+	if sim.adaptive == nil {
+		sim.adaptive = &adaptiveState{lastReview: now}
+		return
+	}
+	as := sim.adaptive
+	if now.Sub(as.lastReview) < adaptiveInterval {
+		return
+	}
+
+	a := TrafficAdaptation{Time: now}
+	if n := len(as.responseTimes); n > 0 {
+		var sum time.Duration
+		for _, d := range as.responseTimes {
+			sum += d
+		}
+		a.ResponseTime = sum / time.Duration(n)
+	}
+	errs := sim.scorer.score.Errors
+	for _, e := range errs[as.errorCount:] {
+		switch e.Category {
+		case ScoreSeparationLoss:
+			a.Conflicts++
+		case ScoreLateHandoff, ScoreUnansweredCheckIn:
+			a.Missed++
+		}
+	}
+
+	// Back off quickly when things go wrong and ramp up gradually when
+	// the user is keeping up easily.
+	scale := sim.trafficScale()
+	if a.Conflicts > 0 {
+		scale *= 0.75
+	} else if a.Missed > 0 || a.ResponseTime > adaptiveSlowResponse {
+		scale *= 0.85
+	} else if a.ResponseTime < adaptiveFastResponse {
+		scale *= 1.1
+	}
+	a.Scale = clamp(scale, adaptiveMinScale, adaptiveMaxScale)
+
+	if a.Scale != sim.TrafficScale {
+		lg.Printf("adaptive traffic: scale %.2f -> %.2f (response %s, %d conflicts, %d missed)",
+			sim.trafficScale(), a.Scale, a.ResponseTime.Round(time.Second), a.Conflicts, a.Missed)
+	}
+	sim.TrafficScale = a.Scale
+	sim.scorer.score.Adaptation = append(sim.scorer.score.Adaptation, a)
+
+	as.lastReview = now
+	as.responseTimes = nil
+	as.errorCount = len(errs)
+}
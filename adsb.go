@@ -0,0 +1,207 @@
+// adsb.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// In devmode, live ADS-B traffic can be injected into the Sim from a
+// local dump1090 or readsb receiver by giving the URL of its
+// aircraft.json with the -adsb command-line option. This is useful for
+// testing display performance with realistic traffic density and for
+// getting familiar with the local airspace. Injected aircraft are
+// background targets: they don't respond to instructions and can't be
+// tracked, and their positions come from the feed rather than from the
+// flight model.
+
+const (
+	// How often the feed is polled.
+	adsbPollInterval = time.Second
+	// Aircraft are removed when they haven't been reported for this long.
+	adsbTimeout = time.Minute
+	// Aircraft farther than this many nm from the scenario group's center
+	// are ignored.
+	adsbMaxRange = 150
+)
+
+var ErrUncontrollableAircraft = errors.New("Aircraft is not under simulation control")
+
+// ADSBAircraft is an aircraft as reported in aircraft.json; readsb and
+// newer versions of dump1090 use alt_baro and gs while older versions of
+// dump1090 use altitude and speed.
+type ADSBAircraft struct {
+	Hex      string      `json:"hex"`
+	Flight   string      `json:"flight"`
+	Type     string      `json:"t"`
+	Squawk   string      `json:"squawk"`
+	Lat      *float32    `json:"lat"`
+	Lon      *float32    `json:"lon"`
+	AltBaro  interface{} `json:"alt_baro"` // may be "ground"
+	Altitude interface{} `json:"altitude"`
+	GS       float32     `json:"gs"`
+	Speed    float32     `json:"speed"`
+	Track    float32     `json:"track"`
+	SeenPos  float32     `json:"seen_pos"`
+}
+
+// Callsign returns the aircraft's callsign, or its ICAO address if it
+// isn't broadcasting one.
+func (a ADSBAircraft) Callsign() string {
+	if cs := strings.TrimSpace(a.Flight); cs != "" {
+		return strings.ToUpper(cs)
+	}
+	return strings.ToUpper(a.Hex)
+}
+
+// AltitudeFeet returns the aircraft's barometric altitude; it returns
+// false if the aircraft is on the ground or the altitude isn't known.
+func (a ADSBAircraft) AltitudeFeet() (float32, bool) {
+	alt := a.AltBaro
+	if alt == nil {
+		alt = a.Altitude
+	}
+	if f, ok := alt.(float64); ok {
+		return float32(f), true
+	}
+	return 0, false
+}
+
+type ADSBFeed struct {
+	URL      string
+	reports  chan []ADSBAircraft
+	lastSeen map[string]time.Time
+	done     chan interface{}
+}
+
+// NewADSBFeed starts polling the given aircraft.json URL.
+func NewADSBFeed(url string) *ADSBFeed {
+	f := &ADSBFeed{
+		URL:      url,
+		reports:  make(chan []ADSBAircraft, 1),
+		lastSeen: make(map[string]time.Time),
+		done:     make(chan interface{}),
+	}
+	lg.Printf("%s: injecting live ADS-B traffic", url)
+
+	go func() {
+		defer reportGoroutinePanic()
+		client := http.Client{Timeout: 5 * time.Second}
+		ticker := time.NewTicker(adsbPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.done:
+				return
+			case <-ticker.C:
+				if ac, err := f.fetch(&client); err != nil {
+					lg.Errorf("%s: %v", f.URL, err)
+				} else {
+					select {
+					case f.reports <- ac:
+					default:
+						// The Sim hasn't picked up the last report (e.g.,
+						// it's paused); drop this one.
+					}
+				}
+			}
+		}
+	}()
+
+	return f
+}
+
+func (f *ADSBFeed) fetch(client *http.Client) ([]ADSBAircraft, error) {
+	resp, err := client.Get(f.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	var r struct {
+		Aircraft []ADSBAircraft `json:"aircraft"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return r.Aircraft, nil
+}
+
+func (f *ADSBFeed) Close() {
+	close(f.done)
+}
+
+// updateADSBFeed adds and updates aircraft from the most recent report
+// from the feed and removes ones that are no longer being reported.
+func (sim *Sim) updateADSBFeed() {
+	f := sim.adsbFeed
+	if f == nil {
+		return
+	}
+
+	now := time.Now()
+	select {
+	case reports := <-f.reports:
+		for _, r := range reports {
+			if r.Lat == nil || r.Lon == nil || r.SeenPos > 30 {
+				continue
+			}
+			alt, ok := r.AltitudeFeet()
+			if !ok {
+				continue
+			}
+			pos := Point2LL{*r.Lon, *r.Lat}
+			if nmdistance2ll(pos, scenarioGroup.Center) > adsbMaxRange {
+				continue
+			}
+
+			callsign := r.Callsign()
+			ac, ok := sim.Aircraft[callsign]
+			if ok && !ac.LiveADSB {
+				// Don't clobber one of the Sim's aircraft.
+				continue
+			} else if !ok {
+				ac = &Aircraft{
+					Callsign:     callsign,
+					Mode:         Charlie,
+					ADSBEquipped: true,
+					LiveADSB:     true,
+					FlightPlan:   &FlightPlan{Rules: UNKNOWN, AircraftType: r.Type},
+				}
+				sim.Aircraft[callsign] = ac
+				eventStream.Post(&AddedAircraftEvent{ac: ac})
+			}
+
+			if sq, err := ParseSquawk(r.Squawk); err == nil {
+				ac.Squawk, ac.AssignedSquawk = sq, sq
+			}
+			ac.Position = pos
+			ac.Altitude = alt
+			ac.GS = max(r.GS, r.Speed)
+			ac.IAS = ac.GS
+			ac.Heading = r.Track + scenarioGroup.MagneticVariation
+			f.lastSeen[callsign] = now
+		}
+
+	default:
+	}
+
+	for callsign, t := range f.lastSeen {
+		if now.Sub(t) > adsbTimeout {
+			if ac, ok := sim.Aircraft[callsign]; ok {
+				eventStream.Post(&RemovedAircraftEvent{ac: ac})
+			}
+			delete(f.lastSeen, callsign)
+		}
+	}
+}
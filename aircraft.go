@@ -17,6 +17,7 @@ type Aircraft struct {
 	AssignedSquawk Squawk // from ATC
 	Squawk         Squawk // actually squawking
 	Mode           TransponderMode
+	ADSBEquipped   bool
 	TempAltitude   int
 	FlightPlan     *FlightPlan
 
@@ -61,6 +62,61 @@ type Aircraft struct {
 	ClearedApproach     bool
 	OnFinal             bool
 	HaveEnteredAirspace bool
+
+	// For arrivals, the runway they have been assigned.
+	ArrivalRunway string
+	// Set once an arrival has touched down.
+	Rollout *Rollout
+
+	// For departures, the runway they depart from and the time at which
+	// they reach it and are ready to go.
+	DepartureRunway       string
+	ProposedDepartureTime time.Time
+
+	// Set if the aircraft has been told to hold; see holding.go.
+	Hold *Hold
+
+	// Live traffic injected from an ADS-B feed; see adsb.go.
+	LiveADSB bool
+
+	// Set if the aircraft has declared an emergency; see emergencies.go.
+	Emergency *Emergency
+
+	// Set for MEDEVAC flights, which ask for priority handling, and once
+	// it has been given; see specialops.go.
+	Medevac, MedevacPriority bool
+
+	// Set while a VFR aircraft is receiving flight following; see vfr.go.
+	FlightFollowing bool
+
+	// Clearances that the pilot read back incorrectly and that haven't
+	// been corrected; see readbackerrors.go.
+	ReadbackErrors []ReadbackError
+
+	// Set if the aircraft has been cleared to descend via its STAR or
+	// climb via its SID, in which case ViaAltitude is the procedure's
+	// bottom or top altitude; see via.go.
+	DescendVia, ClimbVia bool
+	ViaAltitude          int
+
+	// Set if the aircraft is deviating for weather and, if it's been
+	// cleared direct to a fix once it's clear of the weather, that fix;
+	// see wxdeviation.go.
+	DeviatingForWeather bool
+	WhenAbleDirect      string
+
+	// For intersection departures, the taxiway that the takeoff roll
+	// started from and the fraction of the usual climb rate below
+	// InitialClimbAltitude; see intersections.go.
+	IntersectionDeparture string
+	InitialClimbFactor    float32
+	InitialClimbAltitude  int
+
+	// The altitude that the pilot has set in the altitude selector. It
+	// is set a few seconds after the aircraft is cleared to a new
+	// altitude; AltitudeSelectorDelay counts down the seconds until then.
+	AltitudeSelector      int
+	AltitudeSelectorDelay int
 }
 
 func (a *Aircraft) TrackAltitude() int {
@@ -93,6 +149,24 @@ func (ac *Aircraft) NextFixETA() (time.Duration, bool) {
 	return ac.Waypoints[0].ETA(ac.Position, ac.GS), true
 }
 
+// SelectedAltitude returns the altitude that the pilot has set in the
+// aircraft's altitude selector, or zero if none has been set.
+func (ac *Aircraft) SelectedAltitude() int {
+	return ac.AltitudeSelector
+}
+
+// clearedAltitude returns the altitude that the aircraft has been cleared
+// to and that the pilot should set in the altitude selector, or zero if
+// there isn't one.
+func (ac *Aircraft) clearedAltitude() int {
+	if ac.AssignedAltitude != 0 {
+		return ac.AssignedAltitude
+	} else if ac.ViaAltitude != 0 {
+		return ac.ViaAltitude
+	}
+	return ac.CrossingAltitude
+}
+
 func (a *Aircraft) HaveTrack() bool {
 	return a.TrackPosition()[0] != 0 || a.TrackPosition()[1] != 0
 }
@@ -133,14 +207,152 @@ func (a *Aircraft) HaveHeading() bool {
 	return !a.Tracks[0].Position.IsZero() && !a.Tracks[1].Position.IsZero()
 }
 
+// PredictedPath returns the aircraft's predicted positions and altitudes
+// at intervals of the given number of seconds, starting from its current
+// track and continuing for the given number of seconds. Unlike
+// extrapolating the HeadingVector, the prediction accounts for
+// instructions that the aircraft hasn't finished following: turns to an
+// assigned heading or to the next fix on its route, and climbs and
+// descents to its selected altitude. The wind is assumed to stay as it
+// is currently affecting the track.
+func (a *Aircraft) PredictedPath(seconds, step float32) ([]Point2LL, []float32) {
+	if !a.HaveHeading() || step <= 0 {
+		return nil, nil
+	}
+
+	airVector := func(hdg float32, tas float32) [2]float32 {
+		hdg -= scenarioGroup.MagneticVariation
+		return scale2f([2]float32{sin(radians(hdg)), cos(radians(hdg))}, tas/3600)
+	}
+	// Velocities in nm/second; the drift is the difference between where
+	// the aircraft is going over the ground and where its heading and
+	// airspeed would take it, due to the wind.
+	gs, tas := float32(a.TrackGroundspeed()), a.TAS()
+	trackVelocity := scale2f(ll2nm(a.HeadingVector()), 1./60)
+	drift := sub2f(trackVelocity, airVector(a.TrackHeading(), tas))
+
+	pos, hdg, alt := ll2nm(a.TrackPosition()), a.TrackHeading(), float32(a.TrackAltitude())
+	waypoints := a.Waypoints
+
+	var path []Point2LL
+	var alts []float32
+	for t := step; t <= seconds; t += step {
+		// Heading: turn at 3 degrees/second toward the assigned heading or
+		// the next waypoint.
+		target, dir := hdg, 0
+		if a.AssignedHeading != 0 {
+			target, dir = float32(a.AssignedHeading), a.TurnDirection
+		} else if len(waypoints) > 0 {
+			if distance2f(pos, ll2nm(waypoints[0].Location)) < gs/3600*step {
+				waypoints = waypoints[1:]
+			}
+			if len(waypoints) > 0 {
+				target = headingp2ll(nm2ll(pos), waypoints[0].Location, scenarioGroup.MagneticVariation)
+			}
+		}
+		if diff := headingDifference(hdg, target); diff > 0 {
+			maxTurn := 3 * step
+			if dir == 0 {
+				// Turn the short way.
+				if mod(target-hdg+360, 360) > 180 {
+					dir = -1
+				} else {
+					dir = 1
+				}
+			}
+			if dir < 0 {
+				hdg -= min(maxTurn, mod(hdg-target+360, 360))
+			} else {
+				hdg += min(maxTurn, mod(target-hdg+360, 360))
+			}
+			hdg = mod(hdg+360, 360)
+		}
+		pos = add2f(pos, scale2f(add2f(airVector(hdg, tas), drift), step))
+
+		// Altitude: climb or descend toward the selected altitude at the
+		// same rates as updateAltitude() uses for assigned altitudes.
+		if sel := float32(a.SelectedAltitude()); sel == 0 {
+			alt += float32(a.AltitudeChange()) * step / 60
+		} else if alt < sel {
+			alt = min(sel, alt+a.climbRate(alt)*step/60)
+		} else if alt > sel {
+			alt = max(sel, alt-levelOffRate(a.idleDescentRate(alt), alt-sel)*step/60)
+		}
+
+		path = append(path, nm2ll(pos))
+		alts = append(alts, alt)
+	}
+	return path, alts
+}
+
 func (a *Aircraft) HeadingTo(p Point2LL) float32 {
 	return headingp2ll(a.TrackPosition(), p, scenarioGroup.MagneticVariation)
 }
 
+// ProjectedApproachPath returns the path the aircraft would fly if it were
+// cleared for the given approach now, starting at its current position
+// and ending at the runway threshold. The second entry in the path is the
+// point where it joins the approach. false is returned if the aircraft
+// would not be able to join the approach as things stand, e.g., if it's
+// not direct to an approach fix or on a heading that intercepts the
+// localizer.
+func (ac *Aircraft) ProjectedApproachPath(ap *Approach) ([]Point2LL, bool) {
+	path := []Point2LL{ac.Position}
+
+	// Direct to a fix on the approach?
+	if ac.AssignedHeading == 0 && len(ac.Waypoints) > 0 {
+		for _, route := range ap.Waypoints {
+			for i, wp := range route {
+				if wp.Fix == ac.Waypoints[0].Fix {
+					for _, wp := range route[i:] {
+						path = append(path, wp.Location)
+					}
+					return path, true
+				}
+			}
+		}
+	}
+
+	if ap.Type != ILSApproach {
+		return nil, false
+	}
+
+	// Otherwise see where the aircraft's heading intercepts the localizer,
+	// allowing the same slop as the flight model does.
+	hdg := ac.Heading
+	if ac.AssignedHeading != 0 {
+		hdg = float32(ac.AssignedHeading)
+	}
+	if headingDifference(float32(ap.Heading()), hdg) >= 45 {
+		return nil, false
+	}
+
+	loc := ap.Line()
+	loc[0], loc[1] = ll2nm(loc[0]), ll2nm(loc[1])
+	pos := ll2nm(ac.Position)
+	hdg -= scenarioGroup.MagneticVariation
+	v := [2]float32{sin(radians(hdg)), cos(radians(hdg))}
+
+	isect, ok := LineLineIntersect(loc[0], loc[1], pos, add2f(pos, v))
+	if !ok {
+		return nil, false
+	}
+	if d := sub2f(isect, pos); d[0]*v[0]+d[1]*v[1] < 0 {
+		// It's behind us.
+		return nil, false
+	}
+	// And the intercept has to be outside the threshold.
+	if d := sub2f(isect, loc[1]); d[0]*(loc[0][0]-loc[1][0])+d[1]*(loc[0][1]-loc[1][1]) < 0 {
+		return nil, false
+	}
+
+	return append(path, nm2ll(isect), nm2ll(loc[1])), true
+}
+
 func (a *Aircraft) LostTrack(now time.Time) bool {
 	// Only return true if we have at least one valid track from the past
 	// but haven't heard from the aircraft recently.
-	return !a.Tracks[0].Position.IsZero() && now.Sub(a.Tracks[0].Time) > 30*time.Second
+	return !a.Tracks[0].Position.IsZero() && now.Sub(a.Tracks[0].Time) > lostTrackTime()
 }
 
 func (a *Aircraft) AddTrack(t RadarTrack) {
@@ -172,8 +384,14 @@ func (ac *Aircraft) WaypointUpdate(wp Waypoint) {
 
 	// Don't assign the crossing speed if the aircraft has an assigned
 	// speed now or in the future.
-	if wp.Speed != 0 && ac.AssignedSpeed == 0 && ac.AssignedSpeedAfterAltitude == 0 {
-		ac.CrossingSpeed = wp.Speed
+	if ac.AssignedSpeed == 0 && ac.AssignedSpeedAfterAltitude == 0 {
+		if wp.Speed != 0 {
+			ac.CrossingSpeed = wp.Speed
+		} else if wp.MaxSpeed != 0 && ac.IAS > float32(wp.MaxSpeed) {
+			ac.CrossingSpeed = wp.MaxSpeed
+		} else if wp.MinSpeed != 0 && ac.IAS < float32(wp.MinSpeed) {
+			ac.CrossingSpeed = wp.MinSpeed
+		}
 	}
 
 	ac.AssignedHeading = 0
@@ -193,16 +411,42 @@ func (ac *Aircraft) WaypointUpdate(wp Waypoint) {
 }
 
 func (ac *Aircraft) Update() {
+	if ac.Rollout != nil {
+		ac.updateRollout()
+		return
+	}
+
+	ac.updateAltitudeSelector()
 	ac.updateAirspeed()
 	ac.updateAltitude()
+	if ac.Hold != nil {
+		ac.updateHold()
+	}
 	ac.updateHeading()
 	ac.updatePositionAndGS()
 	ac.updateWaypoints()
 }
 
+// updateAltitudeSelector has the pilot set the altitude selector to the
+// cleared altitude a few seconds after it changes; it is set right away
+// for new aircraft. It should be called once a second.
+func (ac *Aircraft) updateAltitudeSelector() {
+	cleared := ac.clearedAltitude()
+	if cleared == ac.AltitudeSelector {
+		ac.AltitudeSelectorDelay = 0
+	} else if ac.AltitudeSelector == 0 {
+		ac.AltitudeSelector = cleared
+	} else if ac.AltitudeSelectorDelay == 0 {
+		ac.AltitudeSelectorDelay = 2 + rand.Intn(6)
+	} else if ac.AltitudeSelectorDelay--; ac.AltitudeSelectorDelay == 0 {
+		ac.AltitudeSelector = cleared
+	}
+}
+
 func (ac *Aircraft) GoAround(sim *Sim) {
 	ac.AssignedHeading = int(ac.Heading)
 	ac.AssignedSpeed = 0
+	ac.CancelVia()
 
 	if ap, ok := database.Airports[ac.FlightPlan.ArrivalAirport]; ok {
 		ac.AssignedAltitude = 1000 * ((ap.Elevation + 2500) / 1000)
@@ -210,17 +454,57 @@ func (ac *Aircraft) GoAround(sim *Sim) {
 		ac.AssignedAltitude = 1000 * ((int(ac.Altitude) + 2500) / 1000)
 	}
 
+	missed := ac.Approach != nil && len(ac.Approach.MissedApproach) > 0
+	if missed {
+		if ac.Approach.MissedApproachAltitude != 0 {
+			ac.AssignedAltitude = ac.Approach.MissedApproachAltitude
+		}
+		ac.startMissedApproach()
+	}
+
 	ac.Approach = nil
 	ac.ClearedApproach = false
 	ac.OnFinal = false
 
-	ac.Waypoints = nil // so it isn't deleted from the sim
+	if !missed {
+		ac.Waypoints = nil // so it isn't deleted from the sim
+	}
 
-	// If it was handed off to tower, hand it back to us
+	// If it was handed off to tower, hand it back to us; tower calls on
+	// the landline to coordinate.
 	if ac.TrackingController != "" && ac.TrackingController != sim.Callsign() {
 		ac.InboundHandoffController = sim.Callsign()
 		globalConfig.Audio.PlaySound(AudioEventInboundHandoff)
+		globalConfig.Audio.PlaySound(AudioEventLandlineRing)
+	}
+}
+
+// startMissedApproach has the aircraft fly its approach's missed approach
+// procedure and then hold at the missed approach fix.
+func (ac *Aircraft) startMissedApproach() {
+	ap := ac.Approach
+	ac.Waypoints = DuplicateSlice(ap.MissedApproach)
+	ac.AssignedHeading, ac.TurnDirection = 0, 0
+	ac.CrossingAltitude, ac.CrossingSpeed = 0, 0
+	ac.ClearedApproach, ac.OnFinal = false, false
+	ac.WaypointUpdate(ac.Waypoints[0])
+
+	n := len(ac.Waypoints)
+	hold, err := NewHold(ac, ac.Waypoints[n-1].Fix, 0, 0)
+	if err != nil {
+		lg.Errorf("%s: %v", ac.Waypoints[n-1].Fix, err)
+		return
 	}
+	if _, ok := scenarioGroup.Holds[hold.Fix]; !ok {
+		// Hold on the course the missed approach arrives at the fix on,
+		// rather than the course from where the aircraft is now.
+		prev := ap.Line()[1]
+		if n > 1 {
+			prev = ac.Waypoints[n-2].Location
+		}
+		hold.InboundCourse = headingp2ll(prev, hold.Location, scenarioGroup.MagneticVariation)
+	}
+	ac.Hold = hold
 }
 
 func (ac *Aircraft) updateAirspeed() {
@@ -261,6 +545,17 @@ func (ac *Aircraft) updateAirspeed() {
 		targetSpeed = ac.AssignedSpeed
 	}
 
+	// Slow to holding speed when approaching the holding fix.
+	if h := ac.Hold; h != nil && (h.Phase != HoldPhaseProceeding ||
+		nmdistance2ll(ac.Position, h.Location) < 3*ac.GS/60) {
+		hs := h.MaxSpeed(ac.Altitude)
+		if targetSpeed == 0 {
+			targetSpeed = min(hs, max(int(ac.IAS), perf.Speed.Min))
+		} else {
+			targetSpeed = min(targetSpeed, hs)
+		}
+	}
+
 	if targetSpeed == 0 && ac.CrossingSpeed != 0 {
 		if eta, ok := ac.NextFixETA(); ok {
 			cs := float32(ac.CrossingSpeed)
@@ -326,24 +621,18 @@ func (ac *Aircraft) updateAltitude() {
 		return
 	}
 
-	if ac.AssignedAltitude == 0 && ac.CrossingAltitude == 0 {
-		// No altitude assignment, so... just stay where we are
-		return
+	if ac.AssignedAltitude == 0 && ac.CrossingAltitude == 0 && !ac.ClimbVia {
+		// No altitude assignment, so... just stay where we are, unless
+		// there are restrictions further along the route that require a
+		// descent (including when descending via a STAR or after a
+		// crossing restriction at a fix after the next one).
+		if _, _, ok := ac.vnavDescent(); !ok {
+			return
+		}
 	}
 
-	// Baseline climb and descent capabilities in ft/minute
-	climb, descent := float32(ac.Performance.Rate.Climb), float32(ac.Performance.Rate.Descent)
-
-	// For high performing aircraft, reduce climb rate after 5,000'
-	if climb >= 2500 && ac.Altitude > 5000 {
-		climb -= 500
-	}
-	if ac.Altitude < 10000 {
-		// Have a slower baseline rate of descent on approach
-		descent = min(descent, 2000)
-		// And reduce it based on airspeed as well
-		descent *= min(ac.IAS/250, 1)
-	}
+	// Climb and descent capabilities in ft/minute
+	climb, descent := ac.climbRate(ac.Altitude), ac.idleDescentRate(ac.Altitude)
 
 	if ac.AssignedAltitude != 0 {
 		// Controller-assigned altitude takes precedence over a crossing
@@ -354,9 +643,10 @@ func (ac *Aircraft) updateAltitude() {
 			// rate; does not account for simultaneous acceleration, etc...
 			ac.Altitude = min(float32(ac.AssignedAltitude), ac.Altitude+climb/60)
 		} else if ac.Altitude > float32(ac.AssignedAltitude) {
-			// Similarly, descent modeling doesn't account for airspeed or
-			// acceleration/deceleration...
-			ac.Altitude = max(float32(ac.AssignedAltitude), ac.Altitude-descent/60)
+			// Pilots descend to assigned altitudes at idle thrust,
+			// shallowing the descent as they level off.
+			rate := levelOffRate(descent, ac.Altitude-float32(ac.AssignedAltitude))
+			ac.Altitude = max(float32(ac.AssignedAltitude), ac.Altitude-rate/60)
 		}
 
 		// If we've reached the assigned altitude and have a speed ready
@@ -369,6 +659,26 @@ func (ac *Aircraft) updateAltitude() {
 				ac.AssignedSpeedAfterAltitude = 0
 			}
 		}
+	} else if ac.ClimbVia {
+		// Climb to the SID's top altitude, but not above any
+		// restrictions at the fixes ahead.
+		ceiling := float32(ac.ViaAltitude)
+		for _, wp := range ac.Waypoints {
+			if _, hi := wp.AltitudeLimits(); hi != 0 {
+				ceiling = min(ceiling, float32(hi))
+			}
+		}
+		if ac.Altitude < ceiling {
+			ac.Altitude = min(ceiling, ac.Altitude+climb/60)
+		}
+	} else if rate, floor, ok := ac.vnavDescent(); ok && (!ac.ClearedApproach || ac.OnFinal) {
+		// Geometric descent: stay level until the top of descent, where
+		// meeting the restrictions ahead requires a fixed-angle path;
+		// then descend just fast enough to meet all of them, but not
+		// below any of them before reaching it.
+		if rate >= ac.geometricDescentRate() {
+			ac.Altitude = max(floor, ac.Altitude-min(rate, descent)/60)
+		}
 	} else if ac.CrossingAltitude != 0 && (!ac.ClearedApproach || ac.OnFinal) {
 		// We have a crossing altitude, but we ignore it if the aircraft is
 		// below the next crossing altitude, has been cleared for the
@@ -401,6 +711,90 @@ func (ac *Aircraft) updateAltitude() {
 	}
 }
 
+// The flight model uses two descent strategies. Descents to altitudes
+// assigned by the controller are flown at idle thrust, with a rate that
+// is roughly proportional to true airspeed: fast up high and slower down
+// low and as the aircraft slows. Descents to meet the altitude
+// restrictions on the aircraft's route, including when descending via a
+// STAR, follow a fixed-angle geometric path from a top of descent
+// computed by the aircraft, which is what controllers see with VNAV
+// descents. Idle descents shallow as the aircraft levels off.
+const (
+	// Idle descent rate in feet per minute per knot of true airspeed
+	// (about a 3.4 degree path in still air).
+	idleDescentFPMPerKnot = 6
+	// Geometric descent rate in feet per minute per knot of
+	// groundspeed, for a 3 degree path.
+	geometricDescentFPMPerKnot = 5.3
+	// When leveling off, the descent rate is limited to this many times
+	// the remaining altitude to descend, per minute, but not less than
+	// levelOffMinimumRate feet per minute.
+	levelOffGain        = 2
+	levelOffMinimumRate = 500
+)
+
+// climbRate returns the aircraft's climb rate in feet per minute at the
+// given altitude.
+func (ac *Aircraft) climbRate(alt float32) float32 {
+	climb := float32(ac.Performance.Rate.Climb)
+	// For high performing aircraft, reduce climb rate after 5,000'
+	if climb >= 2500 && alt > 5000 {
+		climb -= 500
+	}
+	if ac.InitialClimbFactor != 0 && alt < float32(ac.InitialClimbAltitude) {
+		climb *= ac.InitialClimbFactor
+	}
+	return climb
+}
+
+// idleDescentRate returns the aircraft's rate of descent in feet per
+// minute at idle thrust at the given altitude and its current indicated
+// airspeed, limited by its performance.
+func (ac *Aircraft) idleDescentRate(alt float32) float32 {
+	tas := ac.IAS * (1 + .02*alt/1000) // as in TAS()
+	return min(float32(ac.Performance.Rate.Descent), idleDescentFPMPerKnot*tas)
+}
+
+// geometricDescentRate returns the rate of descent in feet per minute
+// needed to follow a fixed-angle path at the aircraft's groundspeed.
+func (ac *Aircraft) geometricDescentRate() float32 {
+	return geometricDescentFPMPerKnot * ac.GS
+}
+
+// levelOffRate returns the descent rate to use given the aircraft's
+// rate and the remaining altitude to descend.
+func levelOffRate(rate, remaining float32) float32 {
+	return min(rate, max(levelOffMinimumRate, levelOffGain*remaining))
+}
+
+// vnavDescent looks at the altitude restrictions at the waypoints ahead
+// of an aircraft that is following its route; if any of them require it
+// to descend, it returns the descent rate in feet per minute that meets
+// the most demanding of them when the aircraft reaches it along with the
+// lowest altitude that the aircraft may descend to now without
+// violating a restriction at a waypoint it hasn't yet reached.
+func (ac *Aircraft) vnavDescent() (rate float32, floor float32, ok bool) {
+	if ac.GS < 1 {
+		return
+	}
+	pos, dist := ac.Position, float32(0)
+	for _, wp := range ac.Waypoints {
+		dist += nmdistance2ll(pos, wp.Location)
+		pos = wp.Location
+
+		lo, hi := wp.AltitudeLimits()
+		floor = max(floor, float32(lo))
+		if hi == 0 || float32(hi) >= ac.Altitude {
+			continue
+		}
+		minutes := max(dist/ac.GS*60, 1./60)
+		rate = max(rate, (ac.Altitude-float32(hi))/minutes)
+		ok = true
+	}
+	floor = min(floor, ac.Altitude)
+	return
+}
+
 var lastPrint time.Time
 
 func (ac *Aircraft) updateHeading() {
@@ -683,7 +1077,13 @@ func (ac *Aircraft) RunWaypointCommands(cmds []WaypointCommand) {
 			globalConfig.Audio.PlaySound(AudioEventInboundHandoff)
 
 		case WaypointCommandDelete:
-			eventStream.Post(&RemovedAircraftEvent{ac: ac})
+			if ac.OnFinal && ac.Approach != nil && ac.FlightPlan != nil {
+				// Arrivals land and are removed once they have exited
+				// the runway.
+				ac.beginRollout()
+			} else {
+				eventStream.Post(&RemovedAircraftEvent{ac: ac})
+			}
 		}
 	}
 }
@@ -0,0 +1,26 @@
+// aircraft_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+)
+
+func TestLevelOffRate(t *testing.T) {
+	for _, test := range []struct {
+		rate, remaining, expected float32
+	}{
+		{2000, 5000, 2000},
+		{2000, 1000, 2000},
+		{2000, 600, 1200},
+		{2000, 250, 500},
+		{2000, 0, 500},
+		{300, 100, 300},
+	} {
+		if r := levelOffRate(test.rate, test.remaining); r != test.expected {
+			t.Errorf("levelOffRate(%f, %f) = %f, expected %f", test.rate, test.remaining, r, test.expected)
+		}
+	}
+}
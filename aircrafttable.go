@@ -0,0 +1,262 @@
+// aircrafttable.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AircraftTablePane lists all of the aircraft in the simulation, one per
+// row. Clicking on a column heading sorts by that column (clicking again
+// reverses the order) and clicking on a row centers the STARS scope on
+// the aircraft. When the pane has the keyboard focus, typed text filters
+// the rows to the ones that include it in any column.
+type AircraftTablePane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	SortColumn     int
+	SortDescending bool
+	Filter         string
+
+	scrollbar *ScrollBar
+}
+
+// aircraftTableColumn describes a column of the table: its heading, its
+// width in characters, and how to get the text for an aircraft. Rows are
+// sorted by the text unless less is provided.
+type aircraftTableColumn struct {
+	heading string
+	width   int
+	text    func(ac *Aircraft) string
+	less    func(a, b *Aircraft) bool
+}
+
+var aircraftTableColumns = []aircraftTableColumn{
+	aircraftTableColumn{
+		heading: "CALLSIGN",
+		width:   9,
+		text:    func(ac *Aircraft) string { return ac.Callsign },
+	},
+	aircraftTableColumn{
+		heading: "TYPE",
+		width:   7,
+		text: func(ac *Aircraft) string {
+			if ac.FlightPlan == nil {
+				return ""
+			}
+			return ac.FlightPlan.TypeWithoutSuffix()
+		},
+	},
+	aircraftTableColumn{
+		heading: "ORIG",
+		width:   5,
+		text: func(ac *Aircraft) string {
+			if ac.FlightPlan == nil {
+				return ""
+			}
+			return ac.FlightPlan.DepartureAirport
+		},
+	},
+	aircraftTableColumn{
+		heading: "DEST",
+		width:   5,
+		text: func(ac *Aircraft) string {
+			if ac.FlightPlan == nil {
+				return ""
+			}
+			return ac.FlightPlan.ArrivalAirport
+		},
+	},
+	aircraftTableColumn{
+		// Current altitude and, if different, the assigned altitude, both
+		// in hundreds of feet.
+		heading: "ALT/ASG",
+		width:   8,
+		text: func(ac *Aircraft) string {
+			alt := fmt.Sprintf("%03d", (ac.TrackAltitude()+50)/100)
+			if ac.AssignedAltitude != 0 && abs(ac.TrackAltitude()-ac.AssignedAltitude) >= 100 {
+				alt += fmt.Sprintf("/%03d", ac.AssignedAltitude/100)
+			}
+			return alt
+		},
+		less: func(a, b *Aircraft) bool { return a.TrackAltitude() < b.TrackAltitude() },
+	},
+	aircraftTableColumn{
+		heading: "GS",
+		width:   4,
+		text:    func(ac *Aircraft) string { return fmt.Sprintf("%3d", ac.TrackGroundspeed()) },
+		less:    func(a, b *Aircraft) bool { return a.TrackGroundspeed() < b.TrackGroundspeed() },
+	},
+	aircraftTableColumn{
+		heading: "CTRL",
+		width:   8,
+		text:    func(ac *Aircraft) string { return ac.TrackingController },
+	},
+}
+
+func NewAircraftTablePane() *AircraftTablePane {
+	return &AircraftTablePane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (at *AircraftTablePane) Activate() {
+	if at.font = GetFont(at.FontIdentifier); at.font == nil {
+		at.font = GetDefaultFont()
+		at.FontIdentifier = at.font.id
+	}
+	if at.scrollbar == nil {
+		at.scrollbar = NewScrollBar(4, false)
+	}
+	if at.SortColumn < 0 || at.SortColumn >= len(aircraftTableColumns) {
+		at.SortColumn = 0
+	}
+}
+
+func (at *AircraftTablePane) Deactivate()                {}
+func (at *AircraftTablePane) CanTakeKeyboardFocus() bool { return true }
+
+func (at *AircraftTablePane) Name() string { return "Aircraft Table" }
+
+func (at *AircraftTablePane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&at.FontIdentifier, "Font"); changed {
+		at.font = newFont
+	}
+}
+
+func (at *AircraftTablePane) KeyBindings() []KeyBinding {
+	return []KeyBinding{
+		KeyBinding{Keys: "Click heading", Description: "Sort by the column; click again to reverse the order"},
+		KeyBinding{Keys: "Click row", Description: "Center the STARS scope on the aircraft and take the keyboard focus"},
+		KeyBinding{Keys: "Text", Description: "Only show aircraft that include the text"},
+		KeyBinding{Key: KeyBackspace, Description: "Delete the last character of the filter"},
+		KeyBinding{Key: KeyEscape, Description: "Clear the filter and return the keyboard focus"},
+	}
+}
+
+func (at *AircraftTablePane) processKeyboard(ctx *PaneContext) {
+	if !ctx.haveFocus || ctx.keyboard == nil {
+		return
+	}
+
+	if ctx.keyboard.IsPressed(KeyEscape) {
+		at.Filter = ""
+		wmReleaseKeyboardFocus()
+		return
+	}
+	if ctx.keyboard.IsPressed(KeyBackspace) && len(at.Filter) > 0 {
+		at.Filter = at.Filter[:len(at.Filter)-1]
+	}
+	at.Filter += strings.ToUpper(ctx.keyboard.Input)
+}
+
+// rows returns the aircraft that match the filter, sorted according to
+// the current sort column.
+func (at *AircraftTablePane) rows() []*Aircraft {
+	var aircraft []*Aircraft
+	for _, ac := range sim.GetAllAircraft() {
+		if at.Filter == "" || FindIf(aircraftTableColumns, func(c aircraftTableColumn) bool {
+			return strings.Contains(strings.ToUpper(c.text(ac)), at.Filter)
+		}) != -1 {
+			aircraft = append(aircraft, ac)
+		}
+	}
+
+	col := aircraftTableColumns[at.SortColumn]
+	less := col.less
+	if less == nil {
+		less = func(a, b *Aircraft) bool { return col.text(a) < col.text(b) }
+	}
+	sort.SliceStable(aircraft, func(i, j int) bool {
+		if at.SortDescending {
+			return less(aircraft[j], aircraft[i])
+		}
+		return less(aircraft[i], aircraft[j])
+	})
+	return aircraft
+}
+
+func (at *AircraftTablePane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	at.processKeyboard(ctx)
+
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := at.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(at.font.size)
+	indent := float32(int32(fw / 2))
+	height := ctx.paneExtent.Height()
+
+	aircraft := at.rows()
+	// One line for the headings, one for the filter.
+	visibleLines := int((height-indent)/fh) - 2
+	at.scrollbar.Update(len(aircraft), visibleLines, ctx)
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	clicked := ctx.mouse != nil && ctx.mouse.Clicked[MouseButtonPrimary]
+	if clicked {
+		wmTakeKeyboardFocus(at, true)
+	}
+
+	// Headings; the sort column is marked with an arrow.
+	y := height - indent
+	x := indent
+	for i, col := range aircraftTableColumns {
+		heading := col.heading
+		if i == at.SortColumn {
+			if at.SortDescending {
+				heading += "v"
+			} else {
+				heading += "^"
+			}
+		}
+		w := float32(col.width) * fw
+		if clicked && ctx.mouse.Pos[1] <= y && ctx.mouse.Pos[1] > y-fh &&
+			ctx.mouse.Pos[0] >= x && ctx.mouse.Pos[0] < x+w {
+			if i == at.SortColumn {
+				at.SortDescending = !at.SortDescending
+			} else {
+				at.SortColumn, at.SortDescending = i, false
+			}
+		}
+		td.AddText(heading, [2]float32{x, y}, TextStyle{Font: at.font, Color: UITextHighlightColor})
+		x += w
+	}
+	y -= fh
+
+	for i := at.scrollbar.Offset(); i < min(len(aircraft), at.scrollbar.Offset()+visibleLines); i++ {
+		ac := aircraft[i]
+
+		if clicked && ctx.mouse.Pos[1] <= y && ctx.mouse.Pos[1] > y-fh {
+			globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+				if sp, ok := p.(*STARSPane); ok {
+					sp.CenterOnAircraft(ac)
+				}
+			})
+		}
+
+		style := TextStyle{Font: at.font, Color: UITextColor}
+		if ac.TrackingController != "" && ac.TrackingController == sim.Callsign() {
+			style.Color = UITextHighlightColor
+		}
+		x := indent
+		for _, col := range aircraftTableColumns {
+			td.AddText(col.text(ac), [2]float32{x, y}, style)
+			x += float32(col.width) * fw
+		}
+		y -= fh
+	}
+
+	if at.Filter != "" || ctx.haveFocus {
+		td.AddText("FILTER: "+at.Filter, [2]float32{indent, indent + fh}, TextStyle{Font: at.font, Color: UITextColor})
+	}
+
+	at.scrollbar.Draw(ctx, cb)
+	td.GenerateCommands(cb)
+}
@@ -23,6 +23,11 @@ type Airport struct {
 
 	// runway -> (exit -> route)
 	DepartureRoutes map[string]map[string]ExitRoute `json:"departure_routes"`
+	// Optional; used instead of DepartureRoutes for turboprops and pistons.
+	PropDepartureRoutes map[string]map[string]ExitRoute `json:"prop_departure_routes,omitempty"`
+
+	// Optional; used when traffic follows the time of day.
+	Schedule *TrafficSchedule `json:"schedule,omitempty"`
 }
 
 func (ap *Airport) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
@@ -33,6 +38,19 @@ func (ap *Airport) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
 			ap.Waypoints[i][n-1].Commands = append(ap.Waypoints[i][n-1].Commands, WaypointCommandDelete)
 			sg.InitializeWaypointLocations(ap.Waypoints[i], e)
 		}
+		if len(ap.MissedApproach) > 0 {
+			e.Push("Missed approach")
+			sg.InitializeWaypointLocations(ap.MissedApproach, e)
+			e.Pop()
+		} else if ap.MissedApproachAltitude != 0 {
+			e.ErrorString("\"missed_approach_altitude\" given without \"missed_approach\"")
+		}
+		e.Pop()
+	}
+
+	if ap.Schedule != nil {
+		e.Push("Schedule")
+		ap.Schedule.PostDeserialize(e)
 		e.Pop()
 	}
 
@@ -43,29 +61,10 @@ func (ap *Airport) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
 	// Departure routes are specified in the JSON as comma-separated lists
 	// of exits. We'll split those out into individual entries in the
 	// Airport's DepartureRoutes, one per exit, for convenience of future code.
-	splitDepartureRoutes := make(map[string]map[string]ExitRoute)
-	for rwy, rwyRoutes := range ap.DepartureRoutes {
-		e.Push("Departure runway " + rwy)
-		seenExits := make(map[string]interface{})
-		splitDepartureRoutes[rwy] = make(map[string]ExitRoute)
-
-		for exitList, route := range rwyRoutes {
-			e.Push("Exit " + exitList)
-			sg.InitializeWaypointLocations(route.Waypoints, e)
-
-			for _, exit := range strings.Split(exitList, ",") {
-				if _, ok := seenExits[exit]; ok {
-					e.ErrorString("exit repeatedly specified in routes")
-				}
-				seenExits[exit] = nil
-
-				splitDepartureRoutes[rwy][exit] = route
-			}
-			e.Pop()
-		}
-		e.Pop()
-	}
-	ap.DepartureRoutes = splitDepartureRoutes
+	ap.DepartureRoutes = splitDepartureRoutes(sg, ap.DepartureRoutes, e)
+	e.Push("Prop departure routes")
+	ap.PropDepartureRoutes = splitDepartureRoutes(sg, ap.PropDepartureRoutes, e)
+	e.Pop()
 
 	for i, dep := range ap.Departures {
 		e.Push("Departure exit " + dep.Exit)
@@ -107,11 +106,57 @@ func (ap *Airport) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
 			database.CheckAirline(al.ICAO, al.Fleet, e)
 		}
 
+		if dep.IsTEC() {
+			sg.InitializeWaypointLocations(dep.TECWaypoints, e)
+			if dest, ok := sg.Airports[dep.Destination]; !ok {
+				e.ErrorString("TEC destination must be an airport in the scenario group")
+			} else if _, ok := dest.Approaches[dep.ExpectApproach]; !ok {
+				e.ErrorString("\"expect_approach\" \"%s\" not found at destination", dep.ExpectApproach)
+			}
+			if dep.Altitude == 0 {
+				e.ErrorString("\"altitude\" must be specified for TEC flights")
+			} else if sg.TECCeiling != 0 && dep.Altitude > sg.TECCeiling {
+				e.ErrorString("altitude %d is above the TEC ceiling %d", dep.Altitude, sg.TECCeiling)
+			}
+		} else if dep.ExpectApproach != "" {
+			e.ErrorString("\"expect_approach\" is only allowed with \"tec_waypoints\"")
+		}
+
 		e.Pop()
 		e.Pop()
 	}
 }
 
+// splitDepartureRoutes splits the comma-separated lists of exits used as
+// keys in departure routes in the JSON so that there is an entry for each
+// exit.
+func splitDepartureRoutes(sg *ScenarioGroup, routes map[string]map[string]ExitRoute,
+	e *ErrorLogger) map[string]map[string]ExitRoute {
+	split := make(map[string]map[string]ExitRoute)
+	for rwy, rwyRoutes := range routes {
+		e.Push("Departure runway " + rwy)
+		seenExits := make(map[string]interface{})
+		split[rwy] = make(map[string]ExitRoute)
+
+		for exitList, route := range rwyRoutes {
+			e.Push("Exit " + exitList)
+			sg.InitializeWaypointLocations(route.Waypoints, e)
+
+			for _, exit := range strings.Split(exitList, ",") {
+				if _, ok := seenExits[exit]; ok {
+					e.ErrorString("exit repeatedly specified in routes")
+				}
+				seenExits[exit] = nil
+
+				split[rwy][exit] = route
+			}
+			e.Pop()
+		}
+		e.Pop()
+	}
+	return split
+}
+
 type ExitRoute struct {
 	InitialRoute    string        `json:"route"`
 	ClearedAltitude int           `json:"cleared_altitude"`
@@ -126,6 +171,19 @@ type Departure struct {
 	Route          string `json:"route"`
 	routeWaypoints []Waypoint
 	Airlines       []DepartureAirline `json:"airlines"`
+
+	// Tower en route control (TEC) flights to other airports in the
+	// scenario group fly these waypoints after the exit route, at or
+	// below the scenario group's TEC ceiling, and are then cleared for
+	// the ExpectApproach approach at the destination.
+	TECWaypoints   WaypointArray `json:"tec_waypoints,omitempty"`
+	ExpectApproach string        `json:"expect_approach,omitempty"`
+}
+
+// IsTEC returns true if the departure is a tower en route control flight
+// to another airport in the scenario group.
+func (d *Departure) IsTEC() bool {
+	return len(d.TECWaypoints) > 0
 }
 
 type DepartureAirline struct {
@@ -170,6 +228,13 @@ type Approach struct {
 	FullName  string          `json:"full_name"`
 	Type      ApproachType    `json:"type"`
 	Waypoints []WaypointArray `json:"waypoints"`
+
+	// Optional; the missed approach procedure that is flown after a
+	// go-around. Aircraft climb to the missed approach altitude, fly the
+	// waypoints, and then hold at the last one. If the altitude isn't
+	// given, they climb to the same altitude as for an ordinary go-around.
+	MissedApproach         WaypointArray `json:"missed_approach,omitempty"`
+	MissedApproachAltitude int           `json:"missed_approach_altitude,omitempty"`
 }
 
 func (ap *Approach) Line() [2]Point2LL {
@@ -0,0 +1,236 @@
+// alerts.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Users can define their own alerts, like "warn me when an arrival
+// descends below 4,000' outside 10 DME" or "alert when a departure
+// hasn't been handed off by 12,000'". Each one is a set of conditions
+// that must all hold for an aircraft; they are checked once a second and
+// the datablocks of aircraft that match an alert flash and show its
+// name. A sound is played when an alert is first raised for an aircraft.
+// Alerts are part of the global configuration so that they apply to all
+// scenarios.
+
+type UserAlertAircraft int32
+
+const (
+	UserAlertAllAircraft UserAlertAircraft = iota
+	UserAlertArrivals
+	UserAlertDepartures
+)
+
+func (a UserAlertAircraft) String() string {
+	return [...]string{"All aircraft", "Arrivals", "Departures"}[a]
+}
+
+type UserAlert struct {
+	// Name is shown in the datablocks of aircraft that match the alert.
+	Name     string
+	Enabled  bool
+	Aircraft UserAlertAircraft
+	// Only consider aircraft tracked by the user.
+	Tracked bool
+	// Only consider aircraft tracked by the user that haven't been
+	// handed off.
+	NotHandedOff bool
+
+	// Zero values are ignored for the following.
+	AltitudeBelow int32
+	AltitudeAbove int32
+	// Distances in nm from Fix (which may also be an airport or navaid);
+	// if it isn't specified, the scenario group's primary airport is
+	// used.
+	Fix       string
+	WithinNM  int32
+	OutsideNM int32
+
+	Flash bool
+	Sound bool
+}
+
+// Description returns a summary of the alert's conditions.
+func (a *UserAlert) Description() string {
+	var c []string
+	c = append(c, strings.ToLower(a.Aircraft.String()))
+	if a.NotHandedOff {
+		c = append(c, "tracked and not handed off")
+	} else if a.Tracked {
+		c = append(c, "tracked")
+	}
+	if a.AltitudeBelow != 0 {
+		c = append(c, fmt.Sprintf("below %d'", a.AltitudeBelow))
+	}
+	if a.AltitudeAbove != 0 {
+		c = append(c, fmt.Sprintf("above %d'", a.AltitudeAbove))
+	}
+	fix := a.Fix
+	if fix == "" {
+		fix = "primary airport"
+	}
+	if a.WithinNM != 0 {
+		c = append(c, fmt.Sprintf("within %dnm of %s", a.WithinNM, fix))
+	}
+	if a.OutsideNM != 0 {
+		c = append(c, fmt.Sprintf("outside %dnm of %s", a.OutsideNM, fix))
+	}
+	return strings.Join(c, ", ")
+}
+
+// Matches returns true if the given aircraft meets all of the alert's
+// conditions.
+func (a *UserAlert) Matches(ac *Aircraft, callsign string) bool {
+	if ac.OnRunway() || ac.FlightPlan == nil {
+		return false
+	}
+
+	switch a.Aircraft {
+	case UserAlertArrivals:
+		if _, ok := scenarioGroup.Airports[ac.FlightPlan.ArrivalAirport]; !ok {
+			return false
+		}
+	case UserAlertDepartures:
+		if _, ok := scenarioGroup.Airports[ac.FlightPlan.DepartureAirport]; !ok {
+			return false
+		}
+	}
+
+	if (a.Tracked || a.NotHandedOff) && ac.TrackingController != callsign {
+		return false
+	}
+	if a.NotHandedOff && ac.OutboundHandoffController != "" {
+		return false
+	}
+
+	if a.AltitudeBelow != 0 && ac.Altitude >= float32(a.AltitudeBelow) {
+		return false
+	}
+	if a.AltitudeAbove != 0 && ac.Altitude <= float32(a.AltitudeAbove) {
+		return false
+	}
+
+	if a.WithinNM != 0 || a.OutsideNM != 0 {
+		fix := a.Fix
+		if fix == "" {
+			fix = scenarioGroup.PrimaryAirport
+		}
+		p, ok := scenarioGroup.Locate(fix)
+		if !ok {
+			return false
+		}
+		d := nmdistance2ll(ac.Position, p)
+		if a.WithinNM != 0 && d > float32(a.WithinNM) {
+			return false
+		}
+		if a.OutsideNM != 0 && d < float32(a.OutsideNM) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ActiveUserAlerts returns the alerts that the given aircraft currently
+// matches.
+func (sim *Sim) ActiveUserAlerts(callsign string) []*UserAlert {
+	return sim.userAlerts[callsign]
+}
+
+// checkUserAlerts evaluates the user's alerts for all of the aircraft
+// once a second.
+func (sim *Sim) checkUserAlerts() {
+	now := sim.CurrentTime()
+	if now.Sub(sim.lastUserAlertCheck) < time.Second {
+		return
+	}
+	sim.lastUserAlertCheck = now
+
+	active := make(map[string][]*UserAlert)
+	callsign := sim.Callsign()
+	for _, ac := range sim.Aircraft {
+		for _, alert := range globalConfig.UserAlerts {
+			if !alert.Enabled || !alert.Matches(ac, callsign) {
+				continue
+			}
+			active[ac.Callsign] = append(active[ac.Callsign], alert)
+
+			if Find(sim.userAlerts[ac.Callsign], alert) == -1 {
+				lg.Printf("%s: user alert \"%s\" raised: %s", ac.Callsign, alert.Name, alert.Description())
+				if alert.Sound {
+					globalConfig.Audio.PlaySound(AudioEventUserAlert)
+				}
+			}
+		}
+	}
+	sim.userAlerts = active
+}
+
+///////////////////////////////////////////////////////////////////////////
+// UI
+
+func drawUserAlertsUI() {
+	alerts := globalConfig.UserAlerts
+	for i := 0; i < len(alerts); i++ {
+		a := alerts[i]
+		imgui.PushID(fmt.Sprintf("alert%d", i))
+
+		imgui.Checkbox("##enabled", &a.Enabled)
+		imgui.SameLine()
+		if imgui.CollapsingHeader(fmt.Sprintf("%s: %s###header", a.Name, a.Description())) {
+			imgui.InputTextV("Name", &a.Name, imgui.InputTextFlagsCharsUppercase, nil)
+
+			if imgui.BeginComboV("Aircraft", a.Aircraft.String(), 0) {
+				for _, t := range []UserAlertAircraft{UserAlertAllAircraft, UserAlertArrivals, UserAlertDepartures} {
+					if imgui.SelectableV(t.String(), t == a.Aircraft, 0, imgui.Vec2{}) {
+						a.Aircraft = t
+					}
+				}
+				imgui.EndCombo()
+			}
+			imgui.Checkbox("Only aircraft I am tracking", &a.Tracked)
+			imgui.Checkbox("Only aircraft I haven't handed off", &a.NotHandedOff)
+
+			imgui.InputIntV("Below altitude", &a.AltitudeBelow, 0, 0, 0)
+			imgui.InputIntV("Above altitude", &a.AltitudeAbove, 0, 0, 0)
+			imgui.InputTextV("Fix", &a.Fix, imgui.InputTextFlagsCharsUppercase, nil)
+			if imgui.IsItemHovered() {
+				imgui.SetTooltip("Fix, navaid, or airport that distances are measured from; the primary airport if empty")
+			}
+			if a.Fix != "" {
+				if _, ok := scenarioGroup.Locate(a.Fix); !ok {
+					imgui.SameLine()
+					imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+					imgui.Text("unknown")
+					imgui.PopStyleColor()
+				}
+			}
+			imgui.InputIntV("Within (nm)", &a.WithinNM, 0, 0, 0)
+			imgui.InputIntV("Outside (nm)", &a.OutsideNM, 0, 0, 0)
+
+			imgui.Checkbox("Flash datablock", &a.Flash)
+			imgui.SameLine()
+			imgui.Checkbox("Play sound", &a.Sound)
+
+			if imgui.Button("Delete") {
+				globalConfig.UserAlerts = DeleteSliceElement(globalConfig.UserAlerts, i)
+				imgui.PopID()
+				break
+			}
+		}
+		imgui.PopID()
+	}
+
+	if imgui.Button("Add alert") {
+		globalConfig.UserAlerts = append(globalConfig.UserAlerts,
+			&UserAlert{Name: "ALERT", Enabled: true, Flash: true, Sound: true})
+	}
+}
@@ -0,0 +1,624 @@
+// api.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// The APIServer provides an optional HTTP API on localhost that external
+// tools (stream overlays, hardware panels, scripted demos, ...) can use
+// to query the state of the simulation and to issue control commands.
+//
+//	GET  /api/state                        scenario, controller, time, paused
+//	GET  /api/aircraft                     all aircraft
+//	GET  /api/aircraft/{callsign}          a single aircraft
+//	POST /api/aircraft/{callsign}/commands body: commands, e.g. "D50 H270"
+//	POST /api/pause, /api/resume
+//	GET  /api/events                       server-sent event stream
+//
+// The admin commands manage a multiplayer session; they are mostly
+// useful when vice is running headless (see headless.go). Their bodies
+// must be JSON objects, sent with an application/json Content-Type.
+//
+//	GET  /api/admin/participants           remote participants and join requests
+//	POST /api/admin/approve                {"address", ["position"]}
+//	POST /api/admin/deny                   {"address"}
+//	POST /api/admin/kick                   {"address"}
+//	POST /api/admin/joincode               {["code"]}; a new one is generated if not given
+//	POST /api/admin/restart                {["group"], ["scenario"]}
+//
+// Each time the server starts, it generates a token that clients must
+// give, either in an "Authorization: Bearer <token>" header or, for
+// clients like EventSource that can't set headers, as a "token" query
+// parameter. So that web pages that the user visits can't use the API,
+// requests must also have a localhost Host header and, if they have an
+// Origin header, it must be the API server's own origin.
+//
+// All access to the Sim happens on the main thread: HTTP handlers queue
+// up closures that are run from Process(), which is called once per
+// frame.
+
+var (
+	ErrAPIRequestTimeout    = errors.New("Timed out waiting for the simulation")
+	ErrAPINoMultiplayer     = errors.New("Not hosting a multiplayer session")
+	ErrAPINoSuchParticipant = errors.New("No participant at that address")
+	ErrAPIRemoteSimulation  = errors.New("The simulation is running on another host")
+	ErrAPIUnauthorized      = errors.New("Missing or invalid API token")
+	ErrAPIForbiddenOrigin   = errors.New("Requests are only accepted from localhost")
+)
+
+type APIServer struct {
+	server   *http.Server
+	port     int
+	Token    string
+	requests chan func()
+	eventsId EventSubscriberId
+
+	mu      sync.Mutex
+	clients map[chan []byte]interface{}
+}
+
+type APIAircraft struct {
+	Callsign                  string  `json:"callsign"`
+	Latitude                  float32 `json:"latitude"`
+	Longitude                 float32 `json:"longitude"`
+	Altitude                  int     `json:"altitude"`
+	Heading                   int     `json:"heading"`
+	Groundspeed               int     `json:"groundspeed"`
+	Squawk                    string  `json:"squawk"`
+	Scratchpad                string  `json:"scratchpad,omitempty"`
+	AircraftType              string  `json:"aircraft_type,omitempty"`
+	DepartureAirport          string  `json:"departure_airport,omitempty"`
+	ArrivalAirport            string  `json:"arrival_airport,omitempty"`
+	TrackingController        string  `json:"tracking_controller,omitempty"`
+	InboundHandoffController  string  `json:"inbound_handoff_controller,omitempty"`
+	OutboundHandoffController string  `json:"outbound_handoff_controller,omitempty"`
+	AssignedAltitude          int     `json:"assigned_altitude,omitempty"`
+	AssignedHeading           int     `json:"assigned_heading,omitempty"`
+	AssignedSpeed             int     `json:"assigned_speed,omitempty"`
+	Approach                  string  `json:"approach,omitempty"`
+	ClearedApproach           bool    `json:"cleared_approach,omitempty"`
+}
+
+type APIAdminRequest struct {
+	Address  string `json:"address"`
+	Position string `json:"position"`
+	Group    string `json:"group"`
+	Scenario string `json:"scenario"`
+	Code     string `json:"code"`
+}
+
+type APIEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Callsign string    `json:"callsign,omitempty"`
+	Message  string    `json:"message"`
+}
+
+func NewAPIAircraft(ac *Aircraft) APIAircraft {
+	a := APIAircraft{
+		Callsign:                  ac.Callsign,
+		Latitude:                  ac.Position.Latitude(),
+		Longitude:                 ac.Position.Longitude(),
+		Altitude:                  int(ac.Altitude),
+		Heading:                   int(ac.Heading),
+		Groundspeed:               int(ac.GS),
+		Squawk:                    ac.Squawk.String(),
+		Scratchpad:                ac.Scratchpad,
+		TrackingController:        ac.TrackingController,
+		InboundHandoffController:  ac.InboundHandoffController,
+		OutboundHandoffController: ac.OutboundHandoffController,
+		AssignedAltitude:          ac.AssignedAltitude,
+		AssignedHeading:           ac.AssignedHeading,
+		AssignedSpeed:             ac.AssignedSpeed,
+		ClearedApproach:           ac.ClearedApproach,
+	}
+	if fp := ac.FlightPlan; fp != nil {
+		a.AircraftType = fp.AircraftType
+		a.DepartureAirport = fp.DepartureAirport
+		a.ArrivalAirport = fp.ArrivalAirport
+	}
+	if ac.Approach != nil {
+		a.Approach = ac.Approach.FullName
+	}
+	return a
+}
+
+// StartAPIServer starts listening on the given localhost port. Only
+// connections from the local machine are accepted.
+func StartAPIServer(port int) (*APIServer, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 16)
+	if _, err := crand.Read(token); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s := &APIServer{
+		port:     port,
+		Token:    hex.EncodeToString(token),
+		requests: make(chan func(), 64),
+		eventsId: eventStream.Subscribe(),
+		clients:  make(map[chan []byte]interface{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/state", s.handleState)
+	mux.HandleFunc("/api/aircraft", s.handleAircraft)
+	mux.HandleFunc("/api/aircraft/", s.handleAircraft)
+	mux.HandleFunc("/api/pause", s.handlePause)
+	mux.HandleFunc("/api/resume", s.handlePause)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	mux.HandleFunc("/api/admin/", s.handleAdmin)
+	s.server = &http.Server{Handler: s.authorize(mux)}
+
+	go func() {
+		defer reportGoroutinePanic()
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			lg.Errorf("API server: %v", err)
+		}
+	}()
+
+	lg.Printf("API server listening on %s", listener.Addr())
+	return s, nil
+}
+
+func (s *APIServer) Stop() {
+	eventStream.Unsubscribe(s.eventsId)
+	s.server.Close()
+
+	s.mu.Lock()
+	for c := range s.clients {
+		close(c)
+	}
+	s.clients = nil
+	s.mu.Unlock()
+}
+
+// authorize wraps the handler so that requests are only passed along if
+// they have the token and come from localhost.
+func (s *APIServer) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.Host)
+		if err != nil || (host != "127.0.0.1" && host != "localhost") || port != fmt.Sprint(s.port) {
+			http.Error(w, ErrAPIForbiddenOrigin.Error(), http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" &&
+			origin != fmt.Sprintf("http://127.0.0.1:%d", s.port) &&
+			origin != fmt.Sprintf("http://localhost:%d", s.port) {
+			http.Error(w, ErrAPIForbiddenOrigin.Error(), http.StatusForbidden)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			http.Error(w, ErrAPIUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Process runs any pending requests and forwards events to connected
+// event stream clients. It must be called from the main thread.
+func (s *APIServer) Process() {
+	for {
+		select {
+		case f := <-s.requests:
+			f()
+		default:
+			s.broadcastEvents()
+			return
+		}
+	}
+}
+
+func (s *APIServer) broadcastEvents() {
+	for _, event := range eventStream.Get(s.eventsId) {
+		e := APIEvent{
+			Type:    strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", event), "*main."), "Event"),
+			Time:    sim.CurrentTime(),
+			Message: fmt.Sprintf("%s", event),
+		}
+		switch v := event.(type) {
+		case *ModifiedAircraftEvent:
+			// These are posted for every aircraft with each radar
+			// update; clients can poll /api/aircraft instead.
+			continue
+		case *AddedAircraftEvent:
+			e.Callsign = v.ac.Callsign
+		case *RemovedAircraftEvent:
+			e.Callsign = v.ac.Callsign
+		case *InitiatedTrackEvent:
+			e.Callsign = v.ac.Callsign
+		case *DroppedTrackEvent:
+			e.Callsign = v.ac.Callsign
+		case *PointOutEvent:
+			e.Callsign = v.ac.Callsign
+		case *AcceptedHandoffEvent:
+			e.Callsign = v.ac.Callsign
+		case *CanceledHandoffEvent:
+			e.Callsign = v.ac.Callsign
+		case *RejectedHandoffEvent:
+			e.Callsign = v.ac.Callsign
+		case *RadioTransmissionEvent:
+			e.Callsign = v.callsign
+			e.Message = v.message
+		case *LandlineMessageEvent:
+			e.Callsign = v.from
+			e.Message = v.message
+		}
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			lg.Errorf("%v", err)
+			continue
+		}
+
+		s.mu.Lock()
+		for c := range s.clients {
+			select {
+			case c <- b:
+			default:
+				// The client isn't keeping up; drop the event for it.
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// run executes f on the main thread and waits for it to finish.
+func (s *APIServer) run(f func()) error {
+	done := make(chan interface{})
+	timeout := time.After(5 * time.Second)
+
+	select {
+	case s.requests <- func() { f(); close(done) }:
+	case <-timeout:
+		return ErrAPIRequestTimeout
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-timeout:
+		return ErrAPIRequestTimeout
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		lg.Errorf("API: %v", err)
+	}
+}
+
+func (s *APIServer) handleState(w http.ResponseWriter, r *http.Request) {
+	var state struct {
+		Scenario   string    `json:"scenario"`
+		Controller string    `json:"controller"`
+		Time       time.Time `json:"time"`
+		Paused     bool      `json:"paused"`
+		SimRate    float32   `json:"sim_rate"`
+	}
+	if err := s.run(func() {
+		if sim.Scenario != nil {
+			state.Scenario = sim.Scenario.Name()
+		}
+		state.Controller = sim.Callsign()
+		state.Time = sim.CurrentTime()
+		state.Paused = sim.IsPaused()
+		state.SimRate = sim.SimRate
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, state)
+}
+
+func (s *APIServer) handleAircraft(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/aircraft"), "/")
+	callsign, action, _ := strings.Cut(path, "/")
+	callsign = strings.ToUpper(callsign)
+
+	switch {
+	case callsign == "" && r.Method == http.MethodGet:
+		var aircraft []APIAircraft
+		if err := s.run(func() {
+			for _, cs := range SortedMapKeys(sim.Aircraft) {
+				aircraft = append(aircraft, NewAPIAircraft(sim.Aircraft[cs]))
+			}
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, aircraft)
+
+	case callsign != "" && action == "" && r.Method == http.MethodGet:
+		var ac *APIAircraft
+		if err := s.run(func() {
+			if a := sim.GetAircraft(callsign); a != nil {
+				aa := NewAPIAircraft(a)
+				ac = &aa
+			}
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if ac == nil {
+			http.Error(w, ErrNoAircraftForCallsign.Error(), http.StatusNotFound)
+		} else {
+			writeJSON(w, ac)
+		}
+
+	case callsign != "" && action == "commands" && r.Method == http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var result struct {
+			Error     string   `json:"error,omitempty"`
+			Remaining []string `json:"remaining,omitempty"`
+		}
+		if err := s.run(func() {
+			remaining, err := sim.RunAircraftCommands(callsign, strings.ToUpper(string(body)))
+			if err != nil {
+				result.Error = err.Error()
+				result.Remaining = remaining
+			}
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if result.Error != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		writeJSON(w, result)
+
+	default:
+		http.Error(w, "Unsupported request", http.StatusBadRequest)
+	}
+}
+
+func (s *APIServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	pause := r.URL.Path == "/api/pause"
+	if err := s.run(func() {
+		if sim.IsPaused() != pause {
+			sim.TogglePause()
+		}
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+// handleEvents sends events to the client as server-sent events
+// (https://html.spec.whatwg.org/multipage/server-sent-events.html) until
+// the client disconnects.
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := make(chan []byte, 256)
+	s.mu.Lock()
+	if s.clients == nil {
+		s.mu.Unlock()
+		http.Error(w, "Server stopped", http.StatusServiceUnavailable)
+		return
+	}
+	s.clients[c] = nil
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case b, ok := <-c:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			s.mu.Lock()
+			if s.clients != nil {
+				delete(s.clients, c)
+			}
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (s *APIServer) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	command := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin"), "/")
+	if command == "participants" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET required", http.StatusMethodNotAllowed)
+			return
+		}
+		var p []MultiplayerParticipant
+		var err error
+		if rerr := s.run(func() {
+			if multiplayerServer == nil {
+				err = ErrAPINoMultiplayer
+			} else {
+				p = multiplayerServer.Participants()
+			}
+		}); rerr != nil {
+			http.Error(w, rerr.Error(), http.StatusServiceUnavailable)
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			writeJSON(w, p)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";"); strings.TrimSpace(ct) != "application/json" {
+		http.Error(w, "application/json Content-Type required", http.StatusUnsupportedMediaType)
+		return
+	}
+	var req APIAdminRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	address, position := req.Address, strings.ToUpper(req.Position)
+	group, scenario, code := req.Group, req.Scenario, req.Code
+
+	var result struct {
+		JoinCode string `json:"join_code,omitempty"`
+		Scenario string `json:"scenario,omitempty"`
+	}
+	var err error
+	if rerr := s.run(func() {
+		if command == "restart" {
+			if sim.remote != nil {
+				err = ErrAPIRemoteSimulation
+				return
+			}
+			if group == "" && scenarioGroup != nil {
+				group = scenarioGroup.Name
+				if scenario == "" && sim.Scenario != nil {
+					scenario = sim.Scenario.Name()
+				}
+			}
+			if err = startSimulation(group, scenario); err == nil {
+				result.Scenario = scenarioGroup.Name + "/" + sim.Scenario.Name()
+			}
+			return
+		}
+
+		ms := multiplayerServer
+		if ms == nil {
+			err = ErrAPINoMultiplayer
+			return
+		}
+		switch command {
+		case "approve":
+			if jr := ms.JoinRequest(address); jr == nil {
+				err = ErrAPINoSuchParticipant
+			} else {
+				if position == "" {
+					position = jr.position
+				}
+				err = ms.Approve(jr, position)
+			}
+		case "deny":
+			if jr := ms.JoinRequest(address); jr == nil {
+				err = ErrAPINoSuchParticipant
+			} else {
+				ms.Deny(jr)
+			}
+		case "kick":
+			if !ms.Kick(address) {
+				err = ErrAPINoSuchParticipant
+			}
+		case "joincode":
+			if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+				globalConfig.MultiplayerJoinCode = code
+			} else {
+				globalConfig.MultiplayerJoinCode = newMultiplayerJoinCode()
+			}
+			result.JoinCode = globalConfig.MultiplayerJoinCode
+		default:
+			err = errors.New("Unsupported request")
+		}
+	}); rerr != nil {
+		http.Error(w, rerr.Error(), http.StatusServiceUnavailable)
+	} else if err == ErrAPINoSuchParticipant {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else {
+		writeJSON(w, result)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// UI
+
+var apiServer *APIServer
+
+// apiServerUpdate starts or stops the API server to match the user's
+// settings.
+func apiServerUpdate() {
+	if globalConfig.APIEnabled && apiServer == nil {
+		var err error
+		if apiServer, err = StartAPIServer(globalConfig.APIPort); err != nil {
+			lg.Errorf("Unable to start API server: %v", err)
+			globalConfig.APIEnabled = false
+			ShowErrorDialog("Unable to start API server: %v", err)
+		}
+	} else if !globalConfig.APIEnabled && apiServer != nil {
+		apiServer.Stop()
+		apiServer = nil
+	}
+}
+
+func apiServerDrawUI() {
+	if globalConfig.APIPort == 0 {
+		globalConfig.APIPort = 6502
+	}
+
+	uiStartDisable(globalConfig.APIEnabled)
+	port := int32(globalConfig.APIPort)
+	if imgui.InputIntV("Port", &port, 1, 100, 0) {
+		globalConfig.APIPort = clamp(int(port), 1024, 65535)
+	}
+	uiEndDisable(globalConfig.APIEnabled)
+
+	if imgui.Checkbox("Enable localhost API", &globalConfig.APIEnabled) {
+		apiServerUpdate()
+	}
+	if apiServer != nil {
+		imgui.Text(fmt.Sprintf("Listening at http://127.0.0.1:%d/api/", globalConfig.APIPort))
+		imgui.Text("Token: " + apiServer.Token)
+		imgui.SameLine()
+		if imgui.Button("Copy") {
+			platform.GetClipboard().SetText(apiServer.Token)
+		}
+	}
+}
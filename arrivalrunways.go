@@ -0,0 +1,154 @@
+// arrivalrunways.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+)
+
+// Arrivals are assigned a runway when they are spawned, based on the
+// scenario's active arrival runways. Scenarios may restrict each runway
+// to arrivals over particular fixes or to a category of aircraft (e.g.,
+// props to the short runway); among the runways that an arrival may use,
+// it is assigned to the one with the fewest arrivals. The controller may
+// change the runway with the RWY command, which also changes the
+// approach that the aircraft expects.
+
+// Matches returns true if the given arrival may be assigned to the
+// runway.
+func (r ScenarioGroupArrivalRunway) Matches(ac *Aircraft) bool {
+	if ac.FlightPlan == nil || ac.FlightPlan.ArrivalAirport != r.Airport {
+		return false
+	}
+
+	if len(r.Fixes) > 0 {
+		found := false
+		for _, wp := range ac.Waypoints {
+			if Find(r.Fixes, wp.Fix) != -1 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch r.Category {
+	case "jet":
+		return ac.Performance.IsJet()
+	case "prop":
+		return !ac.Performance.IsJet()
+	case "heavy":
+		t := ac.FlightPlan.AircraftType
+		return strings.HasPrefix(t, "H/") || strings.HasPrefix(t, "J/") || strings.HasPrefix(t, "S/")
+	default:
+		return true
+	}
+}
+
+// arrivalRunwayCategories are the valid values for the "category" of an
+// arrival runway.
+var arrivalRunwayCategories = []string{"jet", "prop", "heavy"}
+
+// assignArrivalRunway picks a runway for a newly-spawned arrival; it
+// returns the empty string if the scenario doesn't have any arrival
+// runways at its airport.
+func (sim *Sim) assignArrivalRunway(ac *Aircraft) string {
+	var candidates []string
+	for _, rwy := range sim.Scenario.ArrivalRunways {
+		if rwy.Matches(ac) && Find(candidates, rwy.Runway) == -1 {
+			candidates = append(candidates, rwy.Runway)
+		}
+	}
+	if len(candidates) == 0 {
+		// Fall back to any of the active runways at the airport.
+		for _, rwy := range sim.Scenario.ArrivalRunways {
+			if rwy.Airport == ac.FlightPlan.ArrivalAirport && Find(candidates, rwy.Runway) == -1 {
+				candidates = append(candidates, rwy.Runway)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	// Balance the arrivals across the runways.
+	counts := make(map[string]int)
+	for _, other := range sim.Aircraft {
+		if other.FlightPlan != nil && other.FlightPlan.ArrivalAirport == ac.FlightPlan.ArrivalAirport {
+			counts[other.ArrivalRunway]++
+		}
+	}
+	best := candidates[0]
+	for _, rwy := range candidates[1:] {
+		if counts[rwy] < counts[best] {
+			best = rwy
+		}
+	}
+	return best
+}
+
+// approachForRunway returns an approach to the given runway at the
+// airport, preferring one of the given type; it returns nil if there are
+// none.
+func approachForRunway(ap *Airport, runway string, prefer ApproachType) *Approach {
+	var found *Approach
+	for _, name := range SortedMapKeys(ap.Approaches) {
+		appr := ap.Approaches[name]
+		if approachRunway(&appr) != runway {
+			continue
+		}
+		if appr.Type == prefer {
+			return &appr
+		}
+		if found == nil {
+			found = &appr
+		}
+	}
+	return found
+}
+
+// AssignArrivalRunway changes the runway that the aircraft is landing on
+// and has it expect an approach to it.
+func (sim *Sim) AssignArrivalRunway(callsign string, runway string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if ac.FlightPlan == nil {
+		return ErrNoFlightPlan
+	}
+	if ac.ClearedApproach {
+		return ErrUnableCommand
+	}
+	ap, ok := scenarioGroup.Airports[ac.FlightPlan.ArrivalAirport]
+	if !ok {
+		return ErrArrivalAirportUnknown
+	}
+
+	prefer := ApproachType(ILSApproach)
+	if ac.Approach != nil {
+		prefer = ac.Approach.Type
+	}
+	appr := approachForRunway(ap, runway, prefer)
+	if appr == nil {
+		var runways []string
+		for _, a := range ap.Approaches {
+			if rwy := approachRunway(&a); Find(runways, rwy) == -1 {
+				runways = append(runways, rwy)
+			}
+		}
+		if s, ok := closestMatch(runway, runways, maxSuggestionDistance(runway)); ok {
+			return &SuggestionError{Name: runway, Suggestion: s, Err: ErrUnknownRunway}
+		}
+		return ErrUnknownRunway
+	}
+
+	ac.ArrivalRunway = runway
+	ac.Approach = appr
+	pilotReadback(callsign, "expect_runway", ReadbackData{Runway: runway, Approach: appr.FullName})
+	return nil
+}
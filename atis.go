@@ -0,0 +1,512 @@
+// atis.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// ATIS broadcasts are generated for each airport from its METAR and the
+// runways in use. They can be monitored as a looping voice broadcast,
+// which is synthesized using the system's text-to-speech support (see
+// tts.go).
+
+var phoneticAlphabet = [...]string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf",
+	"hotel", "india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa", "quebec",
+	"romeo", "sierra", "tango", "uniform", "victor", "whiskey", "x-ray", "yankee", "zulu"}
+
+var spokenDigits = [...]string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "niner"}
+
+// speakDigits returns the given string with each digit spoken
+// individually, as is done for altimeter settings, headings, and the like.
+func speakDigits(s string) string {
+	var words []string
+	for _, ch := range s {
+		if ch >= '0' && ch <= '9' {
+			words = append(words, spokenDigits[ch-'0'])
+		} else if unicode.IsLetter(ch) {
+			words = append(words, string(ch))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func speakRunway(rwy string) string {
+	num := strings.TrimRight(rwy, "LRC")
+	s := speakDigits(num)
+	switch strings.TrimPrefix(rwy, num) {
+	case "L":
+		s += " left"
+	case "R":
+		s += " right"
+	case "C":
+		s += " center"
+	}
+	return s
+}
+
+// speakWind converts a METAR wind group (e.g., "27015G25KT") to its spoken
+// form.
+func speakWind(wind string) string {
+	wind = strings.TrimSuffix(wind, "KT")
+	if wind == "" {
+		return ""
+	} else if wind == "00000" {
+		return "wind calm"
+	} else if len(wind) < 5 {
+		return "wind " + speakDigits(wind)
+	}
+
+	var s string
+	if strings.HasPrefix(wind, "VRB") {
+		s = "wind variable at "
+	} else {
+		s = "wind " + speakDigits(wind[:3]) + " at "
+	}
+	speed, gust, _ := strings.Cut(wind[3:], "G")
+	s += speakDigits(strings.TrimLeft(speed, "0"))
+	if gust != "" {
+		s += " gusts " + speakDigits(gust)
+	}
+	return s
+}
+
+// speakVisibility converts a METAR visibility group in statute miles
+// (e.g., "10SM", "1 1/2SM", or "P6SM") to its spoken form.
+func speakVisibility(vis string) string {
+	vis = strings.TrimSuffix(vis, "SM")
+	s := "visibility "
+	if strings.HasPrefix(vis, "P") {
+		s += "more than "
+		vis = vis[1:]
+	} else if strings.HasPrefix(vis, "M") {
+		s += "less than "
+		vis = vis[1:]
+	}
+
+	whole, frac, _ := strings.Cut(vis, " ")
+	if frac == "" && strings.Contains(whole, "/") {
+		whole, frac = "", whole
+	}
+	var words []string
+	if whole != "" {
+		words = append(words, speakDigits(whole))
+	}
+	if frac != "" {
+		if whole != "" {
+			words = append(words, "and")
+		}
+		if f, ok := spokenFractions[frac]; ok {
+			words = append(words, f)
+		} else {
+			words = append(words, speakDigits(frac))
+		}
+	}
+	return s + strings.Join(words, " ")
+}
+
+var spokenFractions = map[string]string{
+	"1/8": "one eighth", "1/4": "one quarter", "3/8": "three eighths", "1/2": "one half",
+	"5/8": "five eighths", "3/4": "three quarters", "7/8": "seven eighths",
+}
+
+var (
+	metarWeatherDescriptors = map[string]string{
+		"MI": "shallow", "PR": "partial", "BC": "patches of", "DR": "low drifting",
+		"BL": "blowing", "TS": "thunderstorm", "FZ": "freezing",
+	}
+	metarWeatherPhenomena = map[string]string{
+		"DZ": "drizzle", "RA": "rain", "SN": "snow", "SG": "snow grains", "IC": "ice crystals",
+		"PL": "ice pellets", "GR": "hail", "GS": "small hail", "UP": "unknown precipitation",
+		"BR": "mist", "FG": "fog", "FU": "smoke", "VA": "volcanic ash", "DU": "dust", "SA": "sand",
+		"HZ": "haze", "PY": "spray", "PO": "dust whirls", "SQ": "squalls", "FC": "funnel cloud",
+		"SS": "sandstorm", "DS": "duststorm",
+	}
+)
+
+// speakPresentWeather converts a METAR present weather group (e.g., "-RA"
+// or "VCSH") to its spoken form; it returns false if the group isn't one.
+func speakPresentWeather(wx string) (string, bool) {
+	var words []string
+	if strings.HasPrefix(wx, "-") {
+		words = append(words, "light")
+		wx = wx[1:]
+	} else if strings.HasPrefix(wx, "+") {
+		words = append(words, "heavy")
+		wx = wx[1:]
+	}
+	vicinity := strings.HasPrefix(wx, "VC")
+	wx = strings.TrimPrefix(wx, "VC")
+	if wx == "" || len(wx)%2 != 0 {
+		return "", false
+	}
+
+	showers := false
+	for ; wx != ""; wx = wx[2:] {
+		if code := wx[:2]; code == "SH" {
+			showers = true
+		} else if d, ok := metarWeatherDescriptors[code]; ok {
+			words = append(words, d)
+		} else if p, ok := metarWeatherPhenomena[code]; ok {
+			words = append(words, p)
+		} else {
+			return "", false
+		}
+	}
+	if showers {
+		words = append(words, "showers")
+	}
+	if vicinity {
+		words = append(words, "in the vicinity")
+	}
+	return strings.Join(words, " "), true
+}
+
+// speakHeight returns the spoken form of a height given in hundreds of
+// feet (e.g., "two thousand five hundred" for 25).
+func speakHeight(hundreds int) string {
+	if hundreds == 0 {
+		return "zero"
+	}
+	var words []string
+	if th := hundreds / 10; th > 0 {
+		words = append(words, speakDigits(strconv.Itoa(th)), "thousand")
+	}
+	if h := hundreds % 10; h > 0 {
+		words = append(words, spokenDigits[h], "hundred")
+	}
+	return strings.Join(words, " ")
+}
+
+var (
+	metarSkyRE         = regexp.MustCompile(`^(FEW|SCT|BKN|OVC|VV)(\d{3})(CB|TCU)?$`)
+	metarTemperatureRE = regexp.MustCompile(`^(M?\d{2})/(M?\d{2})?$`)
+)
+
+// speakTemperature converts a METAR temperature (e.g., "M05") to its
+// spoken form.
+func speakTemperature(t string) string {
+	s := ""
+	if strings.HasPrefix(t, "M") {
+		s = "minus "
+		t = t[1:]
+	}
+	n, _ := strconv.Atoi(t)
+	return s + speakDigits(strconv.Itoa(n))
+}
+
+// metarWeatherItems returns the written and spoken forms of the ATIS
+// items for the given METAR weather groups, in the standard order:
+// visibility, present weather, sky condition, and temperature and dew
+// point. Groups that aren't recognized are written but not spoken.
+func metarWeatherItems(weather string) [][2]string {
+	var vis, wx, sky, temp [2][]string
+	ceiling := false
+	fields := strings.Fields(weather)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if _, err := strconv.Atoi(f); err == nil && i+1 < len(fields) &&
+			strings.HasSuffix(fields[i+1], "SM") && strings.Contains(fields[i+1], "/") {
+			// The whole number part of a visibility like "1 1/2SM".
+			f += " " + fields[i+1]
+			i++
+		}
+
+		if f == "CAVOK" {
+			vis[0], vis[1] = append(vis[0], f), append(vis[1], "ceiling and visibility OK")
+		} else if strings.HasSuffix(f, "SM") {
+			vis[0], vis[1] = append(vis[0], f), append(vis[1], speakVisibility(f))
+		} else if f == "SKC" || f == "CLR" || f == "NSC" {
+			sky[0], sky[1] = append(sky[0], f), append(sky[1], "sky clear")
+		} else if m := metarSkyRE.FindStringSubmatch(f); m != nil {
+			h, _ := strconv.Atoi(m[2])
+			var s string
+			switch m[1] {
+			case "FEW":
+				s = "few clouds at " + speakHeight(h)
+			case "SCT":
+				s = speakHeight(h) + " scattered"
+			case "BKN":
+				s = speakHeight(h) + " broken"
+			case "OVC":
+				s = speakHeight(h) + " overcast"
+			case "VV":
+				s = "indefinite ceiling " + speakHeight(h)
+				ceiling = true
+			}
+			if (m[1] == "BKN" || m[1] == "OVC") && !ceiling {
+				// The lowest broken or overcast layer is the ceiling.
+				s = "ceiling " + s
+				ceiling = true
+			}
+			if m[3] == "CB" {
+				s += " cumulonimbus"
+			} else if m[3] == "TCU" {
+				s += " towering cumulus"
+			}
+			sky[0], sky[1] = append(sky[0], f), append(sky[1], s)
+		} else if m := metarTemperatureRE.FindStringSubmatch(f); m != nil {
+			s := "temperature " + speakTemperature(m[1])
+			if m[2] != "" {
+				s += ", dew point " + speakTemperature(m[2])
+			}
+			temp[0], temp[1] = append(temp[0], f), append(temp[1], s)
+		} else if s, ok := speakPresentWeather(f); ok {
+			wx[0], wx[1] = append(wx[0], f), append(wx[1], s)
+		} else {
+			wx[0] = append(wx[0], f)
+		}
+	}
+
+	var items [][2]string
+	for _, item := range [][2][]string{vis, wx, sky, temp} {
+		if len(item[0]) > 0 {
+			items = append(items, [2]string{strings.Join(item[0], " "), strings.Join(item[1], ", ")})
+		}
+	}
+	return items
+}
+
+// GenerateATIS returns the current ATIS for the given airport, or nil if
+// there's no weather for it. The items are in the standard order: the
+// airport and information code, the time of the observation, the weather
+// (wind, visibility, present weather, sky condition, temperature and dew
+// point, and altimeter), the approaches and runways in use, runway
+// conditions, and the request to advise on initial contact.
+func (sim *Sim) GenerateATIS(airport string, code int) *ATIS {
+	metar := sim.GetMETAR(airport)
+	if metar == nil {
+		return nil
+	}
+
+	name := airport
+	if ap, ok := database.Airports[airport]; ok && ap.Name != "" {
+		name = ap.Name
+	}
+	letter := string(rune('A' + code%26))
+	phonetic := phoneticAlphabet[code%26]
+
+	var written, spoken []string
+	add := func(w, s string) {
+		written = append(written, w)
+		if s != "" {
+			spoken = append(spoken, s)
+		}
+	}
+
+	obs := metar.Time
+	if obs == "" {
+		obs = sim.CurrentTime().UTC().Truncate(time.Hour).Format("1504") + "Z"
+	}
+	add(fmt.Sprintf("%s INFO %s %s", airport, letter, obs),
+		fmt.Sprintf("%s information %s. %s zulu", name, phonetic, speakDigits(strings.TrimSuffix(obs, "Z"))))
+
+	if metar.Wind != "" {
+		add(metar.Wind, speakWind(metar.Wind))
+	}
+	for _, item := range metarWeatherItems(metar.Weather) {
+		add(item[0], item[1])
+	}
+	if metar.Altimeter != "" {
+		add(metar.Altimeter, "altimeter "+speakDigits(metar.Altimeter))
+	}
+
+	var arrivalRunways, departureRunways []string
+	for _, rwy := range sim.Scenario.ArrivalRunways {
+		if rwy.Airport == airport && Find(arrivalRunways, rwy.Runway) == -1 {
+			arrivalRunways = append(arrivalRunways, rwy.Runway)
+		}
+	}
+	for _, rwy := range sim.Scenario.DepartureRunways {
+		if rwy.Airport == airport && Find(departureRunways, rwy.Runway) == -1 {
+			departureRunways = append(departureRunways, rwy.Runway)
+		}
+	}
+
+	if ap, ok := scenarioGroup.Airports[airport]; ok {
+		for _, apname := range SortedMapKeys(ap.Approaches) {
+			appr := ap.Approaches[apname]
+			for _, rwy := range arrivalRunways {
+				if strings.HasSuffix(appr.FullName, " "+rwy) {
+					add(strings.ToUpper(appr.FullName)+" APCH IN USE",
+						strings.TrimSuffix(appr.FullName, rwy)+speakRunway(rwy)+" approach in use")
+				}
+			}
+		}
+	}
+	speakRunways := func(rwys []string) string {
+		var s []string
+		for _, r := range rwys {
+			s = append(s, speakRunway(r))
+		}
+		return strings.Join(s, " and ")
+	}
+	if len(arrivalRunways) > 0 {
+		add("LDG "+strings.Join(arrivalRunways, ", "), "landing runway "+speakRunways(arrivalRunways))
+	}
+	if len(departureRunways) > 0 {
+		add("DEPG "+strings.Join(departureRunways, ", "), "departing runway "+speakRunways(departureRunways))
+	}
+
+	for _, key := range SortedMapKeys(sim.RunwayStates) {
+		if rs := sim.RunwayStates[key]; rs.Airport == airport {
+			c := rs.Codes()
+			if rs.Closed {
+				add(rs.String(), "runway "+speakRunway(rs.Runway)+" closed")
+			} else {
+				add(rs.String(), fmt.Sprintf("runway %s condition codes %s, %s, %s", speakRunway(rs.Runway),
+					spokenDigits[c[0]], spokenDigits[c[1]], spokenDigits[c[2]]))
+			}
+		}
+	}
+
+	add("ADVS YOU HAVE INFO "+letter, "advise on initial contact you have information "+phonetic)
+
+	return &ATIS{
+		Airport:  airport,
+		Code:     letter,
+		Contents: strings.Join(written, ". ") + ".",
+		Spoken:   strings.Join(spoken, ". ") + ".",
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// ATIS monitor
+
+type atisSynthesisResult struct {
+	text   string
+	effect *SoundEffect
+	err    error
+}
+
+var atisMonitor struct {
+	show       bool
+	airport    string
+	monitoring bool
+	// Volume relative to the sound effects for the primary frequency.
+	volume float32
+
+	// The ATIS text that is currently playing, its synthesized audio, and
+	// the audio scaled by volume.
+	text      string
+	raw       *SoundEffect
+	effect    *SoundEffect
+	lastStart time.Time
+	err       string
+
+	synthesizing bool
+	results      chan atisSynthesisResult
+}
+
+func init() {
+	atisMonitor.volume = 0.4
+	atisMonitor.results = make(chan atisSynthesisResult, 1)
+}
+
+// atisMonitorUpdate starts synthesis of the monitored ATIS when it
+// changes and replays it when it has finished playing, leaving a short
+// pause in between.
+func atisMonitorUpdate() {
+	am := &atisMonitor
+	select {
+	case r := <-am.results:
+		am.synthesizing = false
+		if r.err != nil {
+			am.err = r.err.Error()
+			lg.Errorf("ATIS: %v", r.err)
+		} else {
+			am.err = ""
+			am.raw = r.effect
+			am.effect = r.effect.WithVolume(am.volume)
+			am.lastStart = time.Time{}
+		}
+	default:
+	}
+
+	if !am.monitoring || am.airport == "" || sim.Scenario == nil {
+		return
+	}
+
+	if atis := sim.GetAirportATIS(am.airport); len(atis) > 0 && atis[0].Spoken != am.text && !am.synthesizing {
+		am.text = atis[0].Spoken
+		am.raw, am.effect = nil, nil
+		am.synthesizing = true
+		go func(text string) {
+			defer reportGoroutinePanic()
+			se, err := synthesizeSpeech("ATIS", text, nil)
+			am.results <- atisSynthesisResult{text: text, effect: se, err: err}
+		}(am.text)
+	}
+
+	if am.effect != nil && globalConfig.Audio.AudioEnabled &&
+		time.Since(am.lastStart) > am.effect.duration+2*time.Second {
+		am.lastStart = time.Now()
+		am.effect.Play()
+	}
+}
+
+func atisMonitorDrawUI() {
+	atisMonitorUpdate()
+
+	am := &atisMonitor
+	if !am.show {
+		return
+	}
+
+	imgui.BeginV("ATIS", &am.show, imgui.WindowFlagsAlwaysAutoResize)
+
+	if am.airport == "" && sim.Scenario != nil {
+		if aps := sim.Scenario.AllAirports(); len(aps) > 0 {
+			am.airport = aps[0]
+		}
+	}
+	if imgui.BeginComboV("Airport", am.airport, 0) {
+		if sim.Scenario != nil {
+			for _, ap := range sim.Scenario.AllAirports() {
+				if imgui.SelectableV(ap, ap == am.airport, 0, imgui.Vec2{}) {
+					am.airport = ap
+				}
+			}
+		}
+		imgui.EndCombo()
+	}
+
+	if sim.Scenario != nil {
+		for _, atis := range sim.GetAirportATIS(am.airport) {
+			imgui.PushTextWrapPos()
+			imgui.Text(atis.Contents)
+			imgui.PopTextWrapPos()
+		}
+	}
+
+	imgui.Separator()
+	imgui.Checkbox("Monitor", &am.monitoring)
+	imgui.SameLine()
+	if imgui.SliderFloatV("Volume", &am.volume, 0, 1, "%.2f", 0) && am.raw != nil {
+		am.effect = am.raw.WithVolume(am.volume)
+	}
+	if am.synthesizing {
+		imgui.Text("Synthesizing...")
+	}
+	if am.err != "" {
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text(am.err)
+		imgui.PopStyleColor()
+	}
+	if !globalConfig.Audio.AudioEnabled {
+		imgui.PushStyleColor(imgui.StyleColorText, UICautionColor.imgui())
+		imgui.Text("Sound effects are disabled in the Preferences window.")
+		imgui.PopStyleColor()
+	}
+
+	imgui.End()
+}
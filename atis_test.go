@@ -0,0 +1,47 @@
+// atis_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMETARWeatherItems(t *testing.T) {
+	for _, test := range []struct {
+		weather string
+		items   [][2]string
+	}{
+		{"10SM FEW020 BKN050 OVC250 18/12", [][2]string{
+			{"10SM", "visibility one zero"},
+			{"FEW020 BKN050 OVC250", "few clouds at two thousand, ceiling five thousand broken, two five thousand overcast"},
+			{"18/12", "temperature one eight, dew point one two"}}},
+		{"1 1/2SM -RA BR OVC008 M02/M05", [][2]string{
+			{"1 1/2SM", "visibility one and one half"},
+			{"-RA BR", "light rain, mist"},
+			{"OVC008", "ceiling eight hundred overcast"},
+			{"M02/M05", "temperature minus two, dew point minus five"}}},
+		{"P6SM VCSH +TSRA SCT035CB 25/", [][2]string{
+			{"P6SM", "visibility more than six"},
+			{"VCSH +TSRA", "showers in the vicinity, heavy thunderstorm rain"},
+			{"SCT035CB", "three thousand five hundred scattered cumulonimbus"},
+			{"25/", "temperature two five"}}},
+		{"3/4SM R04R/2200FT FG VV002", [][2]string{
+			{"3/4SM", "visibility three quarters"},
+			{"R04R/2200FT FG", "fog"},
+			{"VV002", "indefinite ceiling two hundred"}}},
+		{"", nil},
+	} {
+		items := metarWeatherItems(test.weather)
+		if len(items) != len(test.items) {
+			t.Errorf("%q: got %d items %v, expected %d", test.weather, len(items), items, len(test.items))
+			continue
+		}
+		for i := range items {
+			if items[i] != test.items[i] {
+				t.Errorf("%q: got item %v, expected %v", test.weather, items[i], test.items[i])
+			}
+		}
+	}
+}
@@ -7,6 +7,11 @@ package main
 import (
 	_ "embed"
 	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +20,9 @@ import (
 )
 
 // All of the available audio effects are directly embedded in the binary
-// as WAV files.
+// as WAV files. Users may also provide a directory of their own WAV and
+// OGG files; these are added to the available effects with the prefix
+// "Custom: " so that they can be assigned to AudioEvents.
 
 var (
 	//go:embed resources/audio/389511__bbrocer__digital-alarm-loop.wav
@@ -66,6 +73,11 @@ const (
 	AudioEventInboundHandoff
 	AudioEventHandoffAccepted
 	AudioEventCommandError
+	AudioEventPointOut
+	AudioEventMSAW
+	AudioEventLandlineRing
+	AudioEventPilotTransmission
+	AudioEventUserAlert
 	AudioEventCount
 )
 
@@ -75,15 +87,45 @@ func (ae AudioEvent) String() string {
 		"Inbound Handoff",
 		"Handoff Accepted",
 		"Command Error",
+		"Point Out",
+		"MSAW",
+		"Landline Ring",
+		"Pilot Transmission",
+		"User Alert",
 	}[ae]
 }
 
+// alertRepeatInterval is the time between repeats of sounds for events
+// that repeat until they are acknowledged.
+const alertRepeatInterval = 3 * time.Second
+
+// alertRepeatTimeout is how long sounds for events that repeat until they
+// are acknowledged keep repeating if they aren't acknowledged.
+const alertRepeatTimeout = time.Minute
+
 type AudioSettings struct {
-	SoundEffects [AudioEventCount]string
-	AudioEnabled bool
+	SoundEffects    [AudioEventCount]string
+	AudioEnabled    bool
+	SoundsDirectory string
+	// RepeatUntilAcknowledged indicates events whose sound is repeated
+	// until Acknowledge is called for them, rather than played once.
+	RepeatUntilAcknowledged [AudioEventCount]bool
+	// SpatialTransmissions pans the pilot transmission sound according to
+	// where the aircraft is on the radar scope.
+	SpatialTransmissions bool
+	// SpeakTransmissions also speaks pilot transmissions using the
+	// system's text-to-speech program; see tts.go.
+	SpeakTransmissions bool
+	SpeechVolume       float32
+	SpeechRates        [numPilotVoices]int32 // words per minute
+
+	customSoundsErr string
+	dirDialog       *FileSelectDialogBox
 
 	muteUntil     time.Time
 	lastPlay      [AudioEventCount]time.Time
+	pending       [AudioEventCount]bool
+	pendingSince  [AudioEventCount]time.Time
 	lastPlayMutex sync.Mutex
 }
 
@@ -111,6 +153,10 @@ func (a *AudioSettings) PlaySound(e AudioEvent) {
 	} else {
 		a.lastPlayMutex.Lock()
 		defer a.lastPlayMutex.Unlock()
+		if a.RepeatUntilAcknowledged[e] && !a.pending[e] {
+			a.pending[e] = true
+			a.pendingSince[e] = time.Now()
+		}
 		if time.Since(a.lastPlay[e]) > 2*time.Second {
 			a.lastPlay[e] = time.Now()
 			se.Play()
@@ -118,95 +164,202 @@ func (a *AudioSettings) PlaySound(e AudioEvent) {
 	}
 }
 
+// PlayTransmission plays the sound for a pilot transmission, panned
+// between the left (-1) and right (1) channels and with its volume scaled
+// by the given factor. Unlike other events, transmissions aren't limited
+// to one every few seconds, since a busy frequency may have several.
+func (a *AudioSettings) PlayTransmission(pan float32, volume float32) {
+	if !a.AudioEnabled || !time.Now().After(a.muteUntil) || soundEffects == nil {
+		return
+	}
+	if se, ok := soundEffects[a.SoundEffects[AudioEventPilotTransmission]]; ok {
+		se.WithPan(pan).WithVolume(volume).Play()
+	}
+}
+
+// playPilotTransmission plays the pilot transmission sound for the given
+// aircraft; if spatial transmissions are enabled, it's positioned
+// according to the aircraft's location on the first STARS scope.
+func playPilotTransmission(callsign string) {
+	globalConfig.Audio.PlayTransmission(transmissionPosition(callsign))
+}
+
+// transmissionPosition returns the pan and volume for transmissions from
+// the given aircraft.
+func transmissionPosition(callsign string) (pan float32, volume float32) {
+	pan, volume = 0, 1
+	if ac := sim.GetAircraft(callsign); ac != nil && globalConfig.Audio.SpatialTransmissions {
+		var stars *STARSPane
+		globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+			if sp, ok := p.(*STARSPane); ok && stars == nil {
+				stars = sp
+			}
+		})
+		if stars != nil {
+			pan, volume = stars.TransmissionPosition(ac)
+		}
+	}
+	return
+}
+
+// Acknowledge stops repeating the sound for the given event.
+func (a *AudioSettings) Acknowledge(e AudioEvent) {
+	a.lastPlayMutex.Lock()
+	defer a.lastPlayMutex.Unlock()
+	a.pending[e] = false
+}
+
+// AcknowledgeAll stops repeating the sounds for all events.
+func (a *AudioSettings) AcknowledgeAll() {
+	a.lastPlayMutex.Lock()
+	defer a.lastPlayMutex.Unlock()
+	for i := range a.pending {
+		a.pending[i] = false
+	}
+}
+
+// HaveUnacknowledged returns true if the sound for any event is currently
+// being repeated.
+func (a *AudioSettings) HaveUnacknowledged() bool {
+	a.lastPlayMutex.Lock()
+	defer a.lastPlayMutex.Unlock()
+	for _, p := range a.pending {
+		if p {
+			return true
+		}
+	}
+	return false
+}
+
+// Update should be called regularly; it replays the sounds for events
+// that have not yet been acknowledged, acknowledging those that have been
+// repeating for longer than alertRepeatTimeout.
+func (a *AudioSettings) Update() {
+	a.lastPlayMutex.Lock()
+	var replay []AudioEvent
+	for i, p := range a.pending {
+		if p && (!a.RepeatUntilAcknowledged[i] || a.SoundEffects[i] == "") {
+			// The setting was changed after the event was played.
+			a.pending[i] = false
+		} else if p && time.Since(a.pendingSince[i]) > alertRepeatTimeout {
+			a.pending[i] = false
+		} else if p && time.Since(a.lastPlay[i]) > alertRepeatInterval {
+			replay = append(replay, AudioEvent(i))
+		}
+	}
+	a.lastPlayMutex.Unlock()
+
+	for _, e := range replay {
+		a.PlaySound(e)
+	}
+}
+
 type SoundEffect struct {
 	name     string
 	wav      []byte
 	duration time.Duration
 	repeat   int
 	spec     *sdl.AudioSpec
+	custom   bool
 }
 
 func (s *SoundEffect) Play() {
 	// Play the sound effect in a separate thread so that Play()
 	// immediately returns to the caller.
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				lg.Errorf("SDL panic playing audio: %v", err)
-			}
-		}()
-
-		// SDL seems to be crashy if multiple threads call its functions
-		// concurrently even if they're operating independently...
-		sdlMutex.Lock()
-
-		// TODO: it's a little unclear what best practices are here. Should
-		// we open an audio device for each SoundEffect and then leave it
-		// open the whole time? Should we try to open a minimal number of
-		// them, sharing them when the sdl.AudioSpec is compatiable?
-		// The following at least works correctly...
-		var obtained sdl.AudioSpec
-		audioDevice, err := sdl.OpenAudioDevice("", false /* no record */, s.spec, &obtained, 0)
-		if err != nil {
-			lg.Printf("Unable to open SDL audio device: %v", err)
-			sdlMutex.Unlock()
-			return
-		}
+	go s.PlayAndWait()
+}
 
-		for i := 0; i < s.repeat; i++ {
-			if err = sdl.QueueAudio(audioDevice, s.wav); err != nil {
-				lg.Printf("Unable to queue SDL audio: %v", err)
-			}
+// PlayAndWait plays the sound effect, returning once it has finished.
+func (s *SoundEffect) PlayAndWait() {
+	defer func() {
+		if err := recover(); err != nil {
+			lg.Errorf("SDL panic playing audio: %v", err)
 		}
+	}()
 
-		// Release the device so it starts playing the sound.
-		sdl.PauseAudioDevice(audioDevice, false)
+	// SDL seems to be crashy if multiple threads call its functions
+	// concurrently even if they're operating independently...
+	sdlMutex.Lock()
+
+	// TODO: it's a little unclear what best practices are here. Should
+	// we open an audio device for each SoundEffect and then leave it
+	// open the whole time? Should we try to open a minimal number of
+	// them, sharing them when the sdl.AudioSpec is compatiable?
+	// The following at least works correctly...
+	var obtained sdl.AudioSpec
+	audioDevice, err := sdl.OpenAudioDevice("", false /* no record */, s.spec, &obtained, 0)
+	if err != nil {
+		lg.Printf("Unable to open SDL audio device: %v", err)
 		sdlMutex.Unlock()
+		return
+	}
 
-		// Wait for the sound to finish playing before closing the audio
-		// device. We would really like to just do time.Sleep(s.repeat *
-		// s.duration), but sadly the computation of s.duration in
-		// addEffect() is somehow borked.
-		for {
-			time.Sleep(100 * time.Millisecond)
-			sdlMutex.Lock()
-			sz := sdl.GetQueuedAudioSize(audioDevice)
-			sdlMutex.Unlock()
-			if sz == 0 {
-				// and make sure it drains...
-				time.Sleep(100 * time.Millisecond)
-				break
-			}
+	for i := 0; i < s.repeat; i++ {
+		if err = sdl.QueueAudio(audioDevice, s.wav); err != nil {
+			lg.Printf("Unable to queue SDL audio: %v", err)
 		}
+	}
+
+	// Release the device so it starts playing the sound.
+	sdl.PauseAudioDevice(audioDevice, false)
+	sdlMutex.Unlock()
 
+	// Wait for the sound to finish playing before closing the audio
+	// device. We would really like to just do time.Sleep(s.repeat *
+	// s.duration), but sadly the computation of s.duration in
+	// addEffect() is somehow borked.
+	for {
+		time.Sleep(100 * time.Millisecond)
 		sdlMutex.Lock()
-		sdl.CloseAudioDevice(audioDevice)
+		sz := sdl.GetQueuedAudioSize(audioDevice)
 		sdlMutex.Unlock()
-	}()
+		if sz == 0 {
+			// and make sure it drains...
+			time.Sleep(100 * time.Millisecond)
+			break
+		}
+	}
+
+	sdlMutex.Lock()
+	sdl.CloseAudioDevice(audioDevice)
+	sdlMutex.Unlock()
 }
 
 func addEffect(wav string, name string, repeat int) {
-	rw, err := sdl.RWFromMem([]byte(wav))
+	if _, ok := soundEffects[name]; ok {
+		lg.Errorf(name + " used repeatedly")
+		return
+	}
+
+	se, err := LoadSoundEffect(name, []byte(wav))
 	if err != nil {
 		lg.Errorf("%s: unable to add audio effect: %v", name, err)
 		return
 	}
+	se.repeat = repeat
+	soundEffects[name] = se
+}
 
-	loaded, spec := sdl.LoadWAVRW(rw, false /* do not free */)
+// LoadSoundEffect returns a SoundEffect for the given WAV file contents.
+func LoadSoundEffect(name string, wav []byte) (*SoundEffect, error) {
+	rw, err := sdl.RWFromMem(wav)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, ok := soundEffects[name]; ok {
-		lg.Errorf(name + " used repeatedly")
-		return
+	loaded, spec := sdl.LoadWAVRW(rw, false /* do not free */)
+	if loaded == nil || spec == nil {
+		return nil, sdl.GetError()
 	}
 
 	// The computed duration here is apparently incorrect. FIXME.
-	duration := float32(len([]byte(wav))) /
+	duration := float32(len(wav)) /
 		float32(int(spec.Freq)*int(spec.Channels)*int(spec.Format.BitSize())/8)
-	soundEffects[name] = &SoundEffect{
+	se := &SoundEffect{
 		name:     name,
 		wav:      loaded,
 		duration: time.Duration(duration * 1e9),
-		repeat:   repeat,
+		repeat:   1,
 		spec:     spec}
 
 	if err = rw.Close(); err != nil {
@@ -215,6 +368,57 @@ func addEffect(wav string, name string, repeat int) {
 	// TODO: in principle it seems that we should be calling rw.Free()
 	// here, though doing so leads to a panic about trying to free
 	// something that was not allocated.
+
+	return se, nil
+}
+
+// WithVolume returns a copy of the sound effect with its volume scaled by
+// the given factor, which should be between 0 and 1.
+func (s *SoundEffect) WithVolume(v float32) *SoundEffect {
+	scaled := *s
+	scaled.wav = make([]byte, len(s.wav))
+	if len(s.wav) > 0 {
+		sdlMutex.Lock()
+		sdl.MixAudioFormat(&scaled.wav[0], &s.wav[0], s.spec.Format, uint32(len(s.wav)),
+			int(clamp(v, 0, 1)*sdl.MIX_MAXVOLUME))
+		sdlMutex.Unlock()
+	}
+	return &scaled
+}
+
+// WithPan returns a stereo copy of the sound effect panned between the
+// left (-1) and right (1) channels. Only 16-bit sounds are panned; others
+// are returned unchanged.
+func (s *SoundEffect) WithPan(pan float32) *SoundEffect {
+	if s.spec.Format != sdl.AUDIO_S16LSB || (s.spec.Channels != 1 && s.spec.Channels != 2) {
+		return s
+	}
+
+	// Constant-power panning, so the sound is equally loud anywhere.
+	theta := float64(clamp(pan, -1, 1)+1) * math.Pi / 4
+	gain := [2]float32{float32(math.Cos(theta)) * math.Sqrt2, float32(math.Sin(theta)) * math.Sqrt2}
+
+	sample := func(i int) float32 {
+		return float32(int16(uint16(s.wav[2*i]) | uint16(s.wav[2*i+1])<<8))
+	}
+	nframes := len(s.wav) / 2 / int(s.spec.Channels)
+	panned := *s
+	spec := *s.spec
+	spec.Channels = 2
+	panned.spec = &spec
+	panned.wav = make([]byte, 4*nframes)
+	for i := 0; i < nframes; i++ {
+		for ch := 0; ch < 2; ch++ {
+			v := sample(i)
+			if s.spec.Channels == 2 {
+				v = sample(2*i + ch)
+			}
+			v = clamp(gain[ch]*v, math.MinInt16, math.MaxInt16)
+			panned.wav[4*i+2*ch] = byte(int16(v))
+			panned.wav[4*i+2*ch+1] = byte(uint16(int16(v)) >> 8)
+		}
+	}
+	return &panned
 }
 
 func audioInit() error {
@@ -241,15 +445,276 @@ func audioInit() error {
 	addEffect(ranner__ui_clickWAV, "Click", 1)
 	addEffect(soundwarf__alert_shortWAV, "Alert Short", 1)
 	addEffect(thisusernameis__beep4WAV, "Beep Double", 1)
+	soundEffects["Ring"] = NewSynthesizedSoundEffect("Ring", SynthesizeRing())
+	soundEffects["Squelch"] = NewSynthesizedSoundEffect("Squelch", SynthesizeSquelch())
 
 	lg.Printf("Finished initializing audio")
 	return nil
 }
 
+///////////////////////////////////////////////////////////////////////////
+// Synthesized audio
+
+const synthSampleRate = 22050
+
+// NewSynthesizedSoundEffect returns a SoundEffect that plays the given
+// mono 16-bit samples, recorded at synthSampleRate.
+func NewSynthesizedSoundEffect(name string, samples []int16) *SoundEffect {
+	pcm := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		pcm[2*i] = byte(s)
+		pcm[2*i+1] = byte(uint16(s) >> 8)
+	}
+	return &SoundEffect{
+		name:     name,
+		wav:      pcm,
+		duration: time.Duration(len(samples)) * time.Second / synthSampleRate,
+		repeat:   1,
+		spec: &sdl.AudioSpec{
+			Freq:     synthSampleRate,
+			Format:   sdl.AUDIO_S16LSB,
+			Channels: 1,
+			Samples:  4096,
+		},
+	}
+}
+
+// SynthesizeTone returns samples for a sine wave of the given frequency
+// and duration; the start and end are ramped to avoid clicks.
+func SynthesizeTone(hz float32, d time.Duration) []int16 {
+	n := int(d.Seconds() * synthSampleRate)
+	ramp := synthSampleRate / 200 // 5ms
+	samples := make([]int16, n)
+	for i := range samples {
+		gain := float32(1)
+		if i < ramp {
+			gain = float32(i) / float32(ramp)
+		} else if n-i < ramp {
+			gain = float32(n-i) / float32(ramp)
+		}
+		v := math.Sin(2 * math.Pi * float64(hz) * float64(i) / synthSampleRate)
+		samples[i] = int16(0.5 * gain * float32(v) * math.MaxInt16)
+	}
+	return samples
+}
+
+// SynthesizeRing returns samples for a landline ring: two short bursts of
+// the 440Hz+480Hz ringback tone pair.
+func SynthesizeRing() []int16 {
+	burst := 400 * time.Millisecond
+	lo, hi := SynthesizeTone(440, burst), SynthesizeTone(480, burst)
+	ring := make([]int16, len(lo))
+	for i := range ring {
+		ring[i] = lo[i]/2 + hi[i]/2
+	}
+
+	gap := make([]int16, synthSampleRate/5) // 200ms
+	var samples []int16
+	samples = append(samples, ring...)
+	samples = append(samples, gap...)
+	samples = append(samples, ring...)
+	return samples
+}
+
+// SynthesizeSquelch returns samples for the burst of noise heard at the
+// end of a radio transmission.
+func SynthesizeSquelch() []int16 {
+	n := synthSampleRate / 8 // 125ms
+	samples := make([]int16, n)
+	for i := range samples {
+		// Fade out the white noise over the second half.
+		gain := min(float32(1), 2*float32(n-i)/float32(n))
+		samples[i] = int16(0.2 * gain * (2*rand.Float32() - 1) * math.MaxInt16)
+	}
+	return samples
+}
+
+var morseCode = map[rune]string{
+	'A': ".-", 'B': "-...", 'C': "-.-.", 'D': "-..", 'E': ".", 'F': "..-.",
+	'G': "--.", 'H': "....", 'I': "..", 'J': ".---", 'K': "-.-", 'L': ".-..",
+	'M': "--", 'N': "-.", 'O': "---", 'P': ".--.", 'Q': "--.-", 'R': ".-.",
+	'S': "...", 'T': "-", 'U': "..-", 'V': "...-", 'W': ".--", 'X': "-..-",
+	'Y': "-.--", 'Z': "--..", '0': "-----", '1': ".----", '2': "..---",
+	'3': "...--", '4': "....-", '5': ".....", '6': "-....", '7': "--...",
+	'8': "---..", '9': "----.",
+}
+
+// SynthesizeMorse returns samples for the given text sent in Morse code
+// with a tone of the given frequency at the given words per minute.
+// Characters without a Morse encoding are ignored.
+func SynthesizeMorse(text string, hz float32, wpm int) []int16 {
+	unit := 1200 * time.Millisecond / time.Duration(wpm)
+	dit, dah := SynthesizeTone(hz, unit), SynthesizeTone(hz, 3*unit)
+	silence := func(units int) []int16 {
+		return make([]int16, int(float64(units)*unit.Seconds()*synthSampleRate))
+	}
+
+	var samples []int16
+	for _, ch := range strings.ToUpper(text) {
+		if ch == ' ' {
+			samples = append(samples, silence(4)...) // 7 in total w/ the letter gap
+			continue
+		}
+		code, ok := morseCode[ch]
+		if !ok {
+			continue
+		}
+		for i, c := range code {
+			if i > 0 {
+				samples = append(samples, silence(1)...)
+			}
+			if c == '.' {
+				samples = append(samples, dit...)
+			} else {
+				samples = append(samples, dah...)
+			}
+		}
+		samples = append(samples, silence(3)...)
+	}
+	return samples
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Custom sound effects
+
+const customSoundEffectPrefix = "Custom: "
+
+// LoadCustomSoundEffects replaces any previously-loaded custom sound
+// effects with the WAV and OGG files in the SoundsDirectory. OGG files are
+// converted to WAV using ffmpeg, if it is available. Events assigned to
+// custom effects that are no longer present revert to having no sound.
+func (a *AudioSettings) LoadCustomSoundEffects() error {
+	if soundEffects == nil {
+		// Audio initialization failed
+		return nil
+	}
+
+	for name, se := range soundEffects {
+		if se.custom {
+			delete(soundEffects, name)
+		}
+	}
+
+	var errs []string
+	if a.SoundsDirectory != "" {
+		entries, err := os.ReadDir(a.SoundsDirectory)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, entry := range entries {
+			filename := filepath.Join(a.SoundsDirectory, entry.Name())
+			ext := strings.ToLower(filepath.Ext(filename))
+			if entry.IsDir() || (ext != ".wav" && ext != ".ogg") {
+				continue
+			}
+
+			var wav []byte
+			if ext == ".ogg" {
+				wav, err = convertToWAV(filename)
+			} else {
+				wav, err = os.ReadFile(filename)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", entry.Name(), err))
+				continue
+			}
+
+			name := customSoundEffectPrefix + strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			addEffect(string(wav), name, 1)
+			if se, ok := soundEffects[name]; ok {
+				se.custom = true
+			} else {
+				errs = append(errs, entry.Name()+": unable to load audio")
+			}
+		}
+	}
+
+	for i, effect := range a.SoundEffects {
+		if _, ok := soundEffects[effect]; !ok && strings.HasPrefix(effect, customSoundEffectPrefix) {
+			a.SoundEffects[i] = ""
+		}
+	}
+
+	if len(errs) > 0 {
+		a.customSoundsErr = strings.Join(errs, "\n")
+		return fmt.Errorf("%s", a.customSoundsErr)
+	}
+	a.customSoundsErr = ""
+	return nil
+}
+
+// convertToWAV uses ffmpeg to convert the given audio file to WAV, since
+// SDL can only load WAV files itself.
+func convertToWAV(filename string) ([]byte, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, ErrFFmpegNotFound
+	}
+
+	tmp, err := os.CreateTemp("", "vice-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	cmd := exec.Command(ffmpeg, "-loglevel", "error", "-y", "-i", filename, tmp.Name())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(tmp.Name())
+}
+
 func (a *AudioSettings) DrawUI() {
 	imgui.Checkbox("Enable Sound Effects", &a.AudioEnabled)
 
 	if a.AudioEnabled {
+		imgui.Checkbox("Pan pilot transmissions by position on the scope", &a.SpatialTransmissions)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Aircraft far outside the displayed range are also quieter")
+		}
+		imgui.Checkbox("Speak pilot transmissions", &a.SpeakTransmissions)
+		if a.SpeakTransmissions {
+			imgui.SliderFloatV("Speech volume", &a.SpeechVolume, 0, 1, "%.2f", 0)
+			for i := range a.SpeechRates {
+				imgui.SliderIntV(pilotVoiceNames[i]+" voice rate (words/minute)", &a.SpeechRates[i], 100, 300, "%d", 0)
+			}
+		}
+		imgui.Text("Custom sounds directory: " + privacyFilter(a.SoundsDirectory))
+		imgui.SameLine()
+		if imgui.Button("Choose...##sounds") {
+			a.dirDialog = NewDirectorySelectDialogBox("Select Sounds Directory", a.SoundsDirectory,
+				func(dir string) {
+					a.SoundsDirectory = dir
+					a.dirDialog = nil
+					if err := a.LoadCustomSoundEffects(); err != nil {
+						lg.Errorf("%v", err)
+					}
+				})
+			a.dirDialog.Activate()
+		}
+		if a.SoundsDirectory != "" {
+			imgui.SameLine()
+			if imgui.Button("Reload##sounds") {
+				if err := a.LoadCustomSoundEffects(); err != nil {
+					lg.Errorf("%v", err)
+				}
+			}
+			imgui.SameLine()
+			if imgui.Button("Clear##sounds") {
+				a.SoundsDirectory = ""
+				a.LoadCustomSoundEffects()
+			}
+		}
+		if a.dirDialog != nil {
+			a.dirDialog.Draw()
+		}
+		if a.customSoundsErr != "" {
+			imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+			imgui.Text(a.customSoundsErr)
+			imgui.PopStyleColor()
+		}
+
 		sortedSounds := SortedMapKeys(soundEffects)
 
 		for i := 0; i < AudioEventCount; i++ {
@@ -258,6 +723,11 @@ func (a *AudioSettings) DrawUI() {
 			if current == "" {
 				current = "(None)"
 			}
+			imgui.Checkbox("Repeat##"+event, &a.RepeatUntilAcknowledged[i])
+			if imgui.IsItemHovered() {
+				imgui.SetTooltip("Repeat the sound until the event is acknowledged")
+			}
+			imgui.SameLine()
 			if imgui.BeginComboV(event, current, imgui.ComboFlagsHeightLarge) {
 				flags := imgui.SelectableFlagsNone
 				if imgui.SelectableV("(None)", a.SoundEffects[i] == "", flags, imgui.Vec2{}) {
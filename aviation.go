@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -97,6 +98,9 @@ type ATIS struct {
 	AppDep   string
 	Code     string
 	Contents string
+	// Spoken holds the text of the ATIS as it would be read in a voice
+	// broadcast.
+	Spoken string
 }
 
 // Frequencies are scaled by 1000 and then stored in integers.
@@ -181,6 +185,11 @@ type RadarTrack struct {
 	Groundspeed int
 	Heading     float32
 	Time        time.Time
+
+	// Downlinked via Mode-S for equipped aircraft; zero if not
+	// available.
+	SelectedAltitude int
+	IAS              int
 }
 
 type TransponderMode int
@@ -202,10 +211,14 @@ type Runway struct {
 }
 
 type Navaid struct {
-	Id       string
-	Type     string
-	Name     string
-	Location Point2LL
+	Id        string
+	Type      string
+	Name      string
+	City      string
+	Location  Point2LL
+	Elevation float32
+	Frequency string // MHz for VORs, kHz for NDBs
+	Channel   string // TACAN/DME channel, if any
 }
 
 type Fix struct {
@@ -220,6 +233,56 @@ type Callsign struct {
 	ThreeLetter string
 }
 
+// splitCallsign splits a callsign into its leading letters and the
+// remainder, e.g. "AAL123" -> "AAL", "123".
+func splitCallsign(cs string) (string, string) {
+	i := strings.IndexAny(cs, "0123456789")
+	if i == -1 {
+		return cs, ""
+	}
+	return cs[:i], cs[i:]
+}
+
+// SimilarCallsigns returns true if the two callsigns are likely to be
+// confused on the frequency: the same company with flight numbers that
+// have the same digits in a different order or that differ in a single
+// digit (AAL123/AAL132, AAL123/AAL128), or different companies with the
+// same flight number (AAL123/UAL123).
+func SimilarCallsigns(a, b string) bool {
+	if a == b {
+		return false
+	}
+	pa, na := splitCallsign(a)
+	pb, nb := splitCallsign(b)
+	if na == "" || nb == "" {
+		return false
+	}
+	if pa != pb {
+		return na == nb
+	}
+	if len(na) != len(nb) {
+		return false
+	}
+
+	diffs := 0
+	for i := range na {
+		if na[i] != nb[i] {
+			diffs++
+		}
+	}
+	if diffs == 1 {
+		return true
+	}
+
+	// Same digits, different order?
+	sorted := func(s string) string {
+		b := []byte(s)
+		sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+		return string(b)
+	}
+	return sorted(na) == sorted(nb)
+}
+
 func ParseAltitude(s string) (int, error) {
 	s = strings.ToUpper(s)
 	if strings.HasPrefix(s, "FL") {
@@ -302,12 +365,48 @@ func (wc *WaypointCommand) UnmarshalJSON(b []byte) error {
 }
 
 type Waypoint struct {
-	Fix      string            `json:"fix"`
-	Location Point2LL          `json:"-"` // never serialized, derived from fix
-	Altitude int               `json:"altitude,omitempty"`
-	Speed    int               `json:"speed,omitempty"`
-	Heading  int               `json:"heading,omitempty"` // outbound heading after waypoint
-	Commands []WaypointCommand `json:"commands,omitempty"`
+	Fix      string   `json:"fix"`
+	Location Point2LL `json:"-"` // never serialized, derived from fix
+	// Altitude and Speed are "at" restrictions; the Min and Max values
+	// are "at or above" and "at or below" restrictions, respectively.
+	// Zero means that there is no restriction.
+	Altitude    int               `json:"altitude,omitempty"`
+	MinAltitude int               `json:"min_altitude,omitempty"`
+	MaxAltitude int               `json:"max_altitude,omitempty"`
+	Speed       int               `json:"speed,omitempty"`
+	MinSpeed    int               `json:"min_speed,omitempty"`
+	MaxSpeed    int               `json:"max_speed,omitempty"`
+	Heading     int               `json:"heading,omitempty"` // outbound heading after waypoint
+	Commands    []WaypointCommand `json:"commands,omitempty"`
+}
+
+// AltitudeLimits returns the lowest and highest altitudes at which the
+// waypoint may be crossed; zero indicates no limit.
+func (wp *Waypoint) AltitudeLimits() (floor, ceiling int) {
+	if wp.Altitude != 0 {
+		return wp.Altitude, wp.Altitude
+	}
+	return wp.MinAltitude, wp.MaxAltitude
+}
+
+func (wp *Waypoint) HasAltitudeRestriction() bool {
+	return wp.Altitude != 0 || wp.MinAltitude != 0 || wp.MaxAltitude != 0
+}
+
+// AltitudeRestriction returns a description of the waypoint's altitude
+// restriction, e.g. "at or above 8000'".
+func (wp *Waypoint) AltitudeRestriction() string {
+	lo, hi := wp.AltitudeLimits()
+	switch {
+	case lo == hi:
+		return fmt.Sprintf("%d'", lo)
+	case hi == 0:
+		return fmt.Sprintf("at or above %d'", lo)
+	case lo == 0:
+		return fmt.Sprintf("at or below %d'", hi)
+	default:
+		return fmt.Sprintf("between %d' and %d'", lo, hi)
+	}
 }
 
 func (wp *Waypoint) ETA(p Point2LL, gs float32) time.Duration {
@@ -325,9 +424,21 @@ func (wslice WaypointArray) MarshalJSON() ([]byte, error) {
 		if w.Altitude != 0 {
 			s += fmt.Sprintf("@a%d", w.Altitude)
 		}
+		if w.MinAltitude != 0 {
+			s += fmt.Sprintf("@a%d+", w.MinAltitude)
+		}
+		if w.MaxAltitude != 0 {
+			s += fmt.Sprintf("@a%d-", w.MaxAltitude)
+		}
 		if w.Speed != 0 {
 			s += fmt.Sprintf("@s%d", w.Speed)
 		}
+		if w.MinSpeed != 0 {
+			s += fmt.Sprintf("@s%d+", w.MinSpeed)
+		}
+		if w.MaxSpeed != 0 {
+			s += fmt.Sprintf("@s%d-", w.MaxSpeed)
+		}
 		entries = append(entries, s)
 
 		if w.Heading != 0 {
@@ -388,6 +499,13 @@ func parseWaypoints(str string) ([]Waypoint, error) {
 			}
 			waypoints[len(waypoints)-1].Commands =
 				append(waypoints[len(waypoints)-1].Commands, WaypointCommandDelete)
+		} else if strings.Contains(field, "/") {
+			// A procedure from the CIFP
+			wps, err := database.ProcedureWaypoints(field)
+			if err != nil {
+				return nil, err
+			}
+			waypoints = append(waypoints, wps...)
 		} else {
 			wp := Waypoint{}
 			for i, f := range strings.Split(field, "@") {
@@ -396,20 +514,41 @@ func parseWaypoints(str string) ([]Waypoint, error) {
 				} else if len(f) == 0 {
 					return nil, fmt.Errorf("no command found after @ in \"%s\"", field)
 				} else {
+					// A trailing "+" or "-" gives an "at or above" or "at
+					// or below" restriction.
+					v, limit := f[1:], byte(0)
+					if n := len(v); n > 0 && (v[n-1] == '+' || v[n-1] == '-') {
+						v, limit = v[:n-1], v[n-1]
+					}
+
 					switch f[0] {
 					case 'a':
-						alt, err := strconv.Atoi(f[1:])
+						alt, err := strconv.Atoi(v)
 						if err != nil {
 							return nil, err
 						}
-						wp.Altitude = alt
+						switch limit {
+						case '+':
+							wp.MinAltitude = alt
+						case '-':
+							wp.MaxAltitude = alt
+						default:
+							wp.Altitude = alt
+						}
 
 					case 's':
-						kts, err := strconv.Atoi(f[1:])
+						kts, err := strconv.Atoi(v)
 						if err != nil {
 							return nil, err
 						}
-						wp.Speed = kts
+						switch limit {
+						case '+':
+							wp.MinSpeed = kts
+						case '-':
+							wp.MaxSpeed = kts
+						default:
+							wp.Speed = kts
+						}
 
 					default:
 						return nil, fmt.Errorf("%s: unknown @ command '%c", field, f[0])
@@ -493,12 +632,17 @@ type StaticDatabase struct {
 	AircraftTypeAliases map[string]string
 	AircraftPerformance map[string]AircraftPerformance
 	Airlines            map[string]Airline
+	// Optional; see cifp.go.
+	CIFP *CIFP
 }
 
 type AircraftPerformance struct {
-	Name string `json:"name"`
-	ICAO string `json:"icao"`
-	// engines, weight class, category
+	Name    string `json:"name"`
+	ICAO    string `json:"icao"`
+	Engines struct {
+		Number int    `json:"number"`
+		Type   string `json:"type"` // "J" (jet), "T" (turboprop), or "P" (piston)
+	} `json:"engines"`
 	WeightClass string `json:"weightClass"`
 	Ceiling     int    `json:"ceiling"`
 	Rate        struct {
@@ -508,8 +652,8 @@ type AircraftPerformance struct {
 		Decelerate float32 `json:"decelerate"`
 	} `json:"rate"`
 	Runway struct {
-		Takeoff float32 `json:"takeoff"` // nm
-		Landing float32 `json:"landing"` // nm
+		Takeoff float32 `json:"takeoff"` // km
+		Landing float32 `json:"landing"` // km
 	} `json:"runway"`
 	Speed struct {
 		Min     int `json:"min"`
@@ -519,6 +663,45 @@ type AircraftPerformance struct {
 	} `json:"speed"`
 }
 
+func (p *AircraftPerformance) IsJet() bool {
+	return p.Engines.Type == "J"
+}
+
+// NonJetCruiseAltitude returns a cruise altitude for a turboprop or piston
+// aircraft on a flight of the given distance in nm. Pistons stay low and
+// turboprops stay below RVSM airspace and generally below the jets. The
+// altitude is odd thousands of feet if eastbound and even if westbound,
+// and is within the aircraft's ceiling.
+func (p *AircraftPerformance) NonJetCruiseAltitude(dist float32, eastbound bool) int {
+	var alt int
+	if p.Engines.Type == "P" {
+		if dist < 50 {
+			alt = 5000
+		} else if dist < 150 {
+			alt = 7000
+		} else {
+			alt = 9000
+		}
+	} else {
+		if dist < 75 {
+			alt = 9000
+		} else if dist < 150 {
+			alt = 13000
+		} else if dist < 250 {
+			alt = 17000
+		} else {
+			alt = 23000
+		}
+	}
+	if !eastbound {
+		alt += 1000
+	}
+	for alt > p.Ceiling-1000 && alt > 4000 {
+		alt -= 2000
+	}
+	return alt
+}
+
 type Airline struct {
 	ICAO     string `json:"icao"`
 	Name     string `json:"name"`
@@ -540,17 +723,19 @@ func InitializeStaticDatabase() *StaticDatabase {
 	db := &StaticDatabase{}
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go func() { db.Navaids = parseNavaids(); wg.Done() }()
+	go func() { defer reportGoroutinePanic(); db.Navaids = parseNavaids(); wg.Done() }()
+	wg.Add(1)
+	go func() { defer reportGoroutinePanic(); db.Airports = parseAirports(); wg.Done() }()
 	wg.Add(1)
-	go func() { db.Airports = parseAirports(); wg.Done() }()
+	go func() { defer reportGoroutinePanic(); db.Fixes = parseFixes(); wg.Done() }()
 	wg.Add(1)
-	go func() { db.Fixes = parseFixes(); wg.Done() }()
+	go func() { defer reportGoroutinePanic(); db.Callsigns = parseCallsigns(); wg.Done() }()
 	wg.Add(1)
-	go func() { db.Callsigns = parseCallsigns(); wg.Done() }()
+	go func() { defer reportGoroutinePanic(); db.AircraftPerformance = parseAircraftPerformance(); wg.Done() }()
 	wg.Add(1)
-	go func() { db.AircraftPerformance = parseAircraftPerformance(); wg.Done() }()
+	go func() { defer reportGoroutinePanic(); db.Airlines = parseAirlines(); wg.Done() }()
 	wg.Add(1)
-	go func() { db.Airlines = parseAirlines(); wg.Done() }()
+	go func() { defer reportGoroutinePanic(); db.CIFP = parseCIFP(); wg.Done() }()
 	wg.Wait()
 
 	lg.Printf("Parsed built-in databases in %v", time.Since(start))
@@ -621,13 +806,19 @@ func parseNavaids() map[string]Navaid {
 	navaids := make(map[string]Navaid)
 
 	mungeCSV("navaids", decompressZstd(navBaseRaw),
-		[]string{"NAV_ID", "NAV_TYPE", "NAME", "LONG_DECIMAL", "LAT_DECIMAL"},
+		[]string{"NAV_ID", "NAV_TYPE", "NAME", "LONG_DECIMAL", "LAT_DECIMAL", "CITY", "ELEV", "FREQ", "CHAN"},
 		func(s []string) {
 			n := Navaid{
-				Id:       s[0],
-				Type:     s[1],
-				Name:     s[2],
-				Location: Point2LL{float32(atof(s[3])), float32(atof(s[4]))},
+				Id:        s[0],
+				Type:      s[1],
+				Name:      s[2],
+				Location:  Point2LL{float32(atof(s[3])), float32(atof(s[4]))},
+				City:      s[5],
+				Frequency: s[7],
+				Channel:   s[8],
+			}
+			if s[6] != "" {
+				n.Elevation = float32(atof(s[6]))
 			}
 			if n.Id != "" {
 				navaids[n.Id] = n
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -39,3 +40,47 @@ func TestParseSquawk(t *testing.T) {
 		}
 	}
 }
+
+func TestSimilarCallsigns(t *testing.T) {
+	for _, cs := range [][2]string{{"AAL123", "AAL132"}, {"AAL123", "AAL128"}, {"AAL123", "UAL123"},
+		{"N123AB", "N132AB"}} {
+		if !SimilarCallsigns(cs[0], cs[1]) {
+			t.Errorf("%s and %s should be similar", cs[0], cs[1])
+		}
+	}
+	for _, cs := range [][2]string{{"AAL123", "AAL123"}, {"AAL123", "AAL456"}, {"AAL123", "AAL1234"},
+		{"AAL123", "UAL321"}} {
+		if SimilarCallsigns(cs[0], cs[1]) {
+			t.Errorf("%s and %s should not be similar", cs[0], cs[1])
+		}
+	}
+}
+
+func TestParseWaypoints(t *testing.T) {
+	for _, test := range []struct {
+		str       string
+		waypoints []Waypoint
+	}{
+		{"CAMRN KORRY", []Waypoint{{Fix: "CAMRN"}, {Fix: "KORRY"}}},
+		{"CAMRN@a11000 KORRY@s250", []Waypoint{{Fix: "CAMRN", Altitude: 11000}, {Fix: "KORRY", Speed: 250}}},
+		{"CAMRN@a11000+ KORRY@a8000-@s250-", []Waypoint{{Fix: "CAMRN", MinAltitude: 11000},
+			{Fix: "KORRY", MaxAltitude: 8000, MaxSpeed: 250}}},
+		{"LENDY@s210+@a6000", []Waypoint{{Fix: "LENDY", MinSpeed: 210, Altitude: 6000}}},
+		{"ROBER #310 @ *", []Waypoint{{Fix: "ROBER", Heading: 310,
+			Commands: []WaypointCommand{WaypointCommandHandoff, WaypointCommandDelete}}}},
+	} {
+		wps, err := parseWaypoints(test.str)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.str, err)
+		} else if !reflect.DeepEqual(wps, test.waypoints) {
+			t.Errorf("%q: got %+v, expected %+v", test.str, wps, test.waypoints)
+		}
+	}
+
+	for _, str := range []string{"@ CAMRN", "#310 CAMRN", "* CAMRN", "CAMRN #abc", "CAMRN@", "CAMRN@x100",
+		"CAMRN@a11000+-", "CAMRN@s+", "CAMRN@aFL110"} {
+		if _, err := parseWaypoints(str); err == nil {
+			t.Errorf("%q: expected an error", str)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// cannedinstructions.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Scenarios may define buttons for the facility's standard instructions
+// (e.g., "cleared ILS 22L" or "descend via the CAMRN4"); they are shown
+// in the InstructionsPane. Clicking a button, pressing its key when the
+// pane has the keyboard focus, or pressing Ctrl-Shift and its key from
+// anywhere loads its commands into the STARS preview area so that
+// clicking on an aircraft sends them, as with macros.
+
+type CannedInstruction struct {
+	Label    string `json:"label"`
+	Commands string `json:"commands"`
+	// Optional single character that selects the instruction.
+	Key string `json:"key,omitempty"`
+}
+
+func (c *CannedInstruction) PostDeserialize(keys map[string]interface{}, e *ErrorLogger) {
+	if c.Label == "" {
+		e.ErrorString("\"label\" must be specified")
+	}
+	c.Commands = strings.ToUpper(strings.TrimSpace(c.Commands))
+	if c.Commands == "" {
+		e.ErrorString("\"commands\" must be specified")
+	}
+	if c.Key != "" {
+		c.Key = strings.ToUpper(c.Key)
+		if len(c.Key) != 1 {
+			e.ErrorString("\"key\" must be a single character")
+		} else if _, ok := keys[c.Key]; ok {
+			e.ErrorString("\"key\" %s is used for more than one instruction", c.Key)
+		}
+		keys[c.Key] = nil
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// InstructionsPane
+
+type InstructionsPane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+}
+
+func NewInstructionsPane() *InstructionsPane {
+	return &InstructionsPane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (ip *InstructionsPane) Activate() {
+	if ip.font = GetFont(ip.FontIdentifier); ip.font == nil {
+		ip.font = GetDefaultFont()
+		ip.FontIdentifier = ip.font.id
+	}
+}
+
+func (ip *InstructionsPane) Deactivate()                {}
+func (ip *InstructionsPane) CanTakeKeyboardFocus() bool { return true }
+
+func (ip *InstructionsPane) Name() string { return "Instructions" }
+
+func (ip *InstructionsPane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&ip.FontIdentifier, "Font"); changed {
+		ip.font = newFont
+	}
+}
+
+func (ip *InstructionsPane) KeyBindings() []KeyBinding {
+	return []KeyBinding{
+		KeyBinding{Keys: "Click", Description: "Load the instruction's commands; then click an aircraft in STARS to send them"},
+		KeyBinding{Keys: "<key>", Description: "Load the commands for the instruction with the key shown in brackets"},
+		KeyBinding{Keys: "Ctrl-Shift-<key>", Description: "Load the instruction's commands from any pane"},
+		KeyBinding{Key: KeyEscape, Description: "Return the keyboard focus"},
+	}
+}
+
+func cannedInstructions() []CannedInstruction {
+	if sim == nil || sim.Scenario == nil {
+		return nil
+	}
+	return sim.Scenario.Instructions
+}
+
+// loadCannedInstruction sends the instruction's commands to the STARS
+// preview area and gives STARS the keyboard focus.
+func loadCannedInstruction(c CannedInstruction) {
+	loaded := false
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		if sp, ok := p.(*STARSPane); ok && !loaded {
+			sp.LoadCommands(c.Commands)
+			wmTakeKeyboardFocus(sp, false)
+			loaded = true
+		}
+	})
+}
+
+// cannedInstructionsProcessKeys loads the instruction whose key is
+// pressed along with Ctrl-Shift, regardless of which pane has the
+// keyboard focus. Keys are matched by their key codes, which are the same
+// as the uppercase characters for letters and digits, since the
+// modifiers keep them from being delivered as character input.
+func cannedInstructionsProcessKeys() {
+	io := imgui.CurrentIO()
+	if !io.KeyCtrlPressed() || !io.KeyShiftPressed() || io.WantTextInput() {
+		return
+	}
+	for _, c := range cannedInstructions() {
+		if c.Key != "" && imgui.IsKeyPressed(int(c.Key[0])) {
+			loadCannedInstruction(c)
+			return
+		}
+	}
+}
+
+func (ip *InstructionsPane) processKeyboard(ctx *PaneContext) {
+	if !ctx.haveFocus || ctx.keyboard == nil {
+		return
+	}
+	if ctx.keyboard.IsPressed(KeyEscape) {
+		wmReleaseKeyboardFocus()
+		return
+	}
+	for _, ch := range strings.ToUpper(ctx.keyboard.Input) {
+		for _, c := range cannedInstructions() {
+			if c.Key == string(ch) {
+				loadCannedInstruction(c)
+				return
+			}
+		}
+	}
+}
+
+func (ip *InstructionsPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	ip.processKeyboard(ctx)
+
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := ip.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(ip.font.size)
+	pad := float32(int32(fw / 2))
+	width, height := ctx.paneExtent.Width(), ctx.paneExtent.Height()
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	ld := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(ld)
+
+	instructions := cannedInstructions()
+	if len(instructions) == 0 {
+		td.AddText("No instructions defined for this scenario", [2]float32{pad, height - pad},
+			TextStyle{Font: ip.font, Color: UITextColor})
+	}
+
+	clicked := ctx.mouse != nil && ctx.mouse.Clicked[MouseButtonPrimary]
+	if clicked {
+		wmTakeKeyboardFocus(ip, true)
+	}
+
+	// Lay out the buttons left to right, wrapping to a new row when one
+	// doesn't fit.
+	x, y := pad, height-pad
+	buttonHeight := fh + 2*pad
+	for _, c := range instructions {
+		label := c.Label
+		if c.Key != "" {
+			label = "[" + c.Key + "] " + label
+		}
+		bw, _ := ip.font.BoundText(label, 0)
+		buttonWidth := float32(bw) + 2*pad
+		if x > pad && x+buttonWidth > width-pad {
+			x, y = pad, y-buttonHeight-pad
+		}
+
+		p0, p1 := [2]float32{x, y}, [2]float32{x + buttonWidth, y - buttonHeight}
+		ld.AddPolyline([2]float32{}, [][2]float32{p0, {p1[0], p0[1]}, p1, {p0[0], p1[1]}})
+		if clicked && ctx.mouse.Pos[0] >= p0[0] && ctx.mouse.Pos[0] < p1[0] &&
+			ctx.mouse.Pos[1] <= p0[1] && ctx.mouse.Pos[1] > p1[1] {
+			loadCannedInstruction(c)
+		}
+		td.AddText(label, [2]float32{x + pad, y - pad}, TextStyle{Font: ip.font, Color: UITextColor})
+
+		x += buttonWidth + pad
+	}
+
+	cb.SetRGB(UITextColor)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
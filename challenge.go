@@ -0,0 +1,324 @@
+// challenge.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Scenarios may define a challenge: a set of objectives for the session
+// (e.g., deliver 20 arrivals with no losses of separation and an average
+// spacing on final of less than 4nm) for use in training curricula. When
+// a scenario is run as a challenge, the Sim tracks progress toward the
+// objectives; the session ends, pausing the Sim and showing a pass/fail
+// dialog box, once all of the goals have been met, a limit has been
+// exceeded, or time has run out. The result is saved with the session's
+// score (see scoring.go).
+
+type Challenge struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	TimeLimit   int                  `json:"time_limit,omitempty"` // minutes
+	Objectives  []ChallengeObjective `json:"objectives"`
+}
+
+// ChallengeObjective is a single objective; Type is one of:
+//   - "arrivals": at least Value arrivals worked by the user land.
+//   - "departures": at least Value departures are handed off by the user.
+//   - "max_separation_losses": no more than Value losses of separation.
+//   - "max_final_spacing": the average distance between successive
+//     arrivals on final is no more than Value nm.
+//   - "min_score": the session's score is at least Value.
+type ChallengeObjective struct {
+	Type  string  `json:"type"`
+	Value float32 `json:"value"`
+}
+
+// Arrivals farther back than this many nm when the preceding one lands
+// aren't counted when computing the average spacing on final.
+const challengeMaxFinalSpacing = 15
+
+func (c *Challenge) PostDeserialize(e *ErrorLogger) {
+	if c.Name == "" {
+		e.ErrorString("\"name\" must be specified")
+	}
+	if c.TimeLimit < 0 {
+		e.ErrorString("\"time_limit\" must be positive")
+	}
+	if len(c.Objectives) == 0 {
+		e.ErrorString("no \"objectives\" specified")
+	}
+	for _, o := range c.Objectives {
+		switch o.Type {
+		case "arrivals", "departures", "max_separation_losses", "max_final_spacing", "min_score":
+			if o.Value < 0 {
+				e.ErrorString("%s: \"value\" must be positive", o.Type)
+			}
+		default:
+			e.ErrorString("%s: unknown objective type", o.Type)
+		}
+	}
+}
+
+// Goal returns true if the objective is something to achieve before the
+// session ends, rather than a limit to stay within.
+func (o ChallengeObjective) Goal() bool {
+	return o.Type == "arrivals" || o.Type == "departures"
+}
+
+func (o ChallengeObjective) String() string {
+	switch o.Type {
+	case "arrivals":
+		return fmt.Sprintf("Land %d arrivals", int(o.Value))
+	case "departures":
+		return fmt.Sprintf("Hand off %d departures", int(o.Value))
+	case "max_separation_losses":
+		return fmt.Sprintf("No more than %d losses of separation", int(o.Value))
+	case "max_final_spacing":
+		return fmt.Sprintf("Average spacing on final of %.1fnm or less", o.Value)
+	case "min_score":
+		return fmt.Sprintf("Score of at least %d", int(o.Value))
+	default:
+		return o.Type
+	}
+}
+
+// ChallengeProgress records how the user is doing with a challenge.
+type ChallengeProgress struct {
+	Challenge  *Challenge
+	Start      time.Time
+	Arrivals   int
+	Departures int
+	// Distances from the following arrival to the threshold each time an
+	// arrival lands.
+	FinalSpacing []float32
+	// Set once the session has ended.
+	Finished bool
+	Passed   bool
+	// Why the challenge ended before all of the goals were met, if it did.
+	Reason string
+
+	landed     map[string]interface{}
+	handedOff  map[string]interface{}
+	violations int
+	score      int
+}
+
+func NewChallengeProgress(c *Challenge, start time.Time) *ChallengeProgress {
+	return &ChallengeProgress{
+		Challenge: c,
+		Start:     start,
+		landed:    make(map[string]interface{}),
+		handedOff: make(map[string]interface{}),
+	}
+}
+
+func (p *ChallengeProgress) AverageFinalSpacing() float32 {
+	if len(p.FinalSpacing) == 0 {
+		return 0
+	}
+	var sum float32
+	for _, s := range p.FinalSpacing {
+		sum += s
+	}
+	return sum / float32(len(p.FinalSpacing))
+}
+
+// Status returns the current value for the objective and whether it is
+// currently met.
+func (p *ChallengeProgress) Status(o ChallengeObjective) (string, bool) {
+	switch o.Type {
+	case "arrivals":
+		return fmt.Sprintf("%d", p.Arrivals), p.Arrivals >= int(o.Value)
+	case "departures":
+		return fmt.Sprintf("%d", p.Departures), p.Departures >= int(o.Value)
+	case "max_separation_losses":
+		return fmt.Sprintf("%d", p.violations), p.violations <= int(o.Value)
+	case "max_final_spacing":
+		if len(p.FinalSpacing) == 0 {
+			return "-", true
+		}
+		s := p.AverageFinalSpacing()
+		return fmt.Sprintf("%.1fnm", s), s <= o.Value
+	case "min_score":
+		return fmt.Sprintf("%d", p.score), p.score >= int(o.Value)
+	default:
+		return "", false
+	}
+}
+
+// updateChallenge tracks progress toward the challenge's objectives and
+// ends the session when appropriate; it should be called once a second.
+func (sim *Sim) updateChallenge(now time.Time) {
+	p := sim.Challenge
+	if p == nil || p.Finished || sim.scorer == nil {
+		return
+	}
+	user := sim.Scenario.Callsign
+	sc := sim.scorer
+
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if _, tracked := sc.tracked[callsign]; !tracked || ac.FlightPlan == nil {
+			continue
+		}
+
+		if _, ok := p.landed[callsign]; !ok && ac.Rollout != nil {
+			p.landed[callsign] = nil
+			p.Arrivals++
+			if s, ok := sim.followingArrivalSpacing(ac); ok {
+				p.FinalSpacing = append(p.FinalSpacing, s)
+			}
+		}
+
+		if _, ok := p.handedOff[callsign]; !ok && ac.TrackingController != "" &&
+			ac.TrackingController != user && ac.FlightPlan.DepartureAirport != "" &&
+			Find(sim.Scenario.DepartureAirports(), ac.FlightPlan.DepartureAirport) != -1 {
+			p.handedOff[callsign] = nil
+			p.Departures++
+		}
+	}
+	p.violations = sc.score.Count(ScoreSeparationLoss)
+	p.score = sc.score.Score()
+
+	goalsMet, limitsMet := true, true
+	for _, o := range p.Challenge.Objectives {
+		_, ok := p.Status(o)
+		if o.Goal() {
+			goalsMet = goalsMet && ok
+		} else if o.Type != "max_final_spacing" {
+			// Spacing is judged on the average at the end, so it can't
+			// fail the challenge early.
+			limitsMet = limitsMet && ok
+		}
+	}
+
+	timeUp := p.Challenge.TimeLimit > 0 && now.Sub(p.Start) > time.Duration(p.Challenge.TimeLimit)*time.Minute
+	if !goalsMet && limitsMet && !timeUp {
+		return
+	}
+	if !limitsMet {
+		p.Reason = "A limit was exceeded"
+	} else if !goalsMet {
+		p.Reason = "Time ran out"
+	}
+
+	p.Finished = true
+	p.Passed = true
+	for _, o := range p.Challenge.Objectives {
+		_, ok := p.Status(o)
+		p.Passed = p.Passed && ok
+	}
+	sc.score.Challenge = p.Challenge.Name
+	sc.score.ChallengePassed = p.Passed
+
+	lg.Printf("challenge %s finished: passed %v", p.Challenge.Name, p.Passed)
+	sim.Paused = true
+	uiShowModalDialog(NewModalDialogBox(&ChallengeResultModalClient{progress: p}), true)
+}
+
+// followingArrivalSpacing returns the distance from the given aircraft,
+// which has just landed, to the next aircraft on the same approach.
+func (sim *Sim) followingArrivalSpacing(ac *Aircraft) (float32, bool) {
+	dist, found := float32(challengeMaxFinalSpacing), false
+	for _, other := range sim.Aircraft {
+		if other == ac || other.Rollout != nil || other.FlightPlan == nil || other.Approach == nil ||
+			other.FlightPlan.ArrivalAirport != ac.FlightPlan.ArrivalAirport ||
+			approachRunway(other.Approach) != approachRunway(ac.Approach) {
+			continue
+		}
+		if d := nmdistance2ll(ac.Position, other.Position); d < dist {
+			dist, found = d, true
+		}
+	}
+	return dist, found
+}
+
+///////////////////////////////////////////////////////////////////////////
+// ChallengeResultModalClient
+
+type ChallengeResultModalClient struct {
+	progress *ChallengeProgress
+}
+
+func (c *ChallengeResultModalClient) Title() string { return "Challenge: " + c.progress.Challenge.Name }
+
+func (c *ChallengeResultModalClient) Opening() {}
+
+func (c *ChallengeResultModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{{text: "Ok"}}
+}
+
+func (c *ChallengeResultModalClient) Draw() int {
+	p := c.progress
+	if p.Passed {
+		imgui.Text("PASSED")
+	} else {
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text("FAILED")
+		imgui.PopStyleColor()
+	}
+	if p.Reason != "" {
+		imgui.Text(p.Reason)
+	}
+	imgui.Separator()
+	drawChallengeObjectives(p)
+	return -1
+}
+
+// drawChallengeObjectives draws a table with the challenge's objectives
+// and the user's progress toward them.
+func drawChallengeObjectives(p *ChallengeProgress) {
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg
+	if imgui.BeginTableV("objectives", 3, tableFlags, imgui.Vec2{500, 0}, 0) {
+		imgui.TableSetupColumn("Objective")
+		imgui.TableSetupColumn("Current")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+		for _, o := range p.Challenge.Objectives {
+			value, ok := p.Status(o)
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(o.String())
+			imgui.TableNextColumn()
+			imgui.Text(value)
+			imgui.TableNextColumn()
+			if ok {
+				imgui.Text(FontAwesomeIconCheckSquare)
+			} else {
+				imgui.Text(FontAwesomeIconSquare)
+			}
+		}
+		imgui.EndTable()
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Challenge progress window
+
+var challengeWindow struct {
+	show bool
+}
+
+func challengeDrawUI() {
+	p := sim.Challenge
+	if p == nil || p.Finished || !challengeWindow.show {
+		return
+	}
+
+	imgui.BeginV("Challenge: "+p.Challenge.Name, &challengeWindow.show, imgui.WindowFlagsAlwaysAutoResize)
+	if p.Challenge.Description != "" {
+		imgui.Text(p.Challenge.Description)
+	}
+	if p.Challenge.TimeLimit > 0 {
+		left := time.Duration(p.Challenge.TimeLimit)*time.Minute - sim.CurrentTime().Sub(p.Start)
+		imgui.Text("Time remaining: " + left.Round(time.Second).String())
+	}
+	drawChallengeObjectives(p)
+	imgui.End()
+}
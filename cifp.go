@@ -0,0 +1,410 @@
+// cifp.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The FAA's Coded Instrument Flight Procedures (CIFP) file encodes all of
+// the SIDs, STARs, and instrument approaches in the US in the ARINC 424
+// format. If vice is started with -cifp pointing to a copy of it (e.g.,
+// FAACIFP18 from
+// https://www.faa.gov/air_traffic/flight_info/aeronav/digital_products/cifp/),
+// scenarios can include procedures by name in waypoint lists rather than
+// listing each of their fixes, using the syntax
+// AIRPORT/PROCEDURE[/TRANSITION...], e.g., "KJFK/CAMRN4/ENE" for the ENE
+// transition of the CAMRN4 arrival into JFK or "KJFK/I13L/CRI" for the
+// CRI transition of the ILS 13L approach. The procedure's fixes are
+// expanded in order along with its altitude and speed restrictions.
+
+type ProcedureType int
+
+const (
+	ProcedureSID ProcedureType = iota
+	ProcedureSTAR
+	ProcedureApproach
+)
+
+func (t ProcedureType) String() string {
+	return [...]string{"SID", "STAR", "approach"}[t]
+}
+
+// Procedure is a SID, STAR, or approach from the CIFP.
+type Procedure struct {
+	Airport string
+	Ident   string
+	Type    ProcedureType
+	// In the order they appear in the file, which is the order in which
+	// the legs are flown for each route.
+	Routes []*ProcedureRoute
+}
+
+// ProcedureRoute is one of a procedure's routes: e.g., an enroute or
+// runway transition or the common route shared by all of them.
+type ProcedureRoute struct {
+	RouteType  byte
+	Transition string // empty for common routes
+	Legs       []ProcedureLeg
+}
+
+// ProcedureLeg is a single leg of a procedure route; only the fields
+// that vice uses are parsed.
+type ProcedureLeg struct {
+	Fix            string
+	PathTerminator string
+	Course         int // magnetic; 0 if not specified
+	// Set for the first leg of an approach's missed approach procedure.
+	MissedApproach bool
+	// AltitudeDescription is the ARINC 424 altitude description code,
+	// e.g., '+' for at or above Altitude[0], '-' for at or below it, and
+	// 'B' for between Altitude[0] (the upper limit) and Altitude[1].
+	AltitudeDescription byte
+	Altitude            [2]int
+	// SpeedDescription is ' ' or '@' for at the speed, '+' for at or
+	// above it, and '-' for at or below it.
+	SpeedDescription byte
+	Speed            int
+}
+
+// CIFP holds the procedures and the fixes that they use that were parsed
+// from a CIFP file.
+type CIFP struct {
+	// airport -> ident -> procedure
+	Procedures map[string]map[string]*Procedure
+	// airport -> terminal waypoint or runway -> location
+	TerminalFixes map[string]map[string]Point2LL
+	// Enroute waypoints
+	Fixes map[string]Point2LL
+}
+
+// parseCIFP parses the CIFP file specified on the command line, if there
+// is one.
+func parseCIFP() *CIFP {
+	if *cifpFilename == "" {
+		return nil
+	}
+
+	start := time.Now()
+	f, err := os.Open(*cifpFilename)
+	if err != nil {
+		lg.Errorf("%s: %v", *cifpFilename, err)
+		return nil
+	}
+	defer f.Close()
+
+	c := &CIFP{
+		Procedures:    make(map[string]map[string]*Procedure),
+		TerminalFixes: make(map[string]map[string]Point2LL),
+		Fixes:         make(map[string]Point2LL),
+	}
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err := c.parseRecord(scanner.Text()); err != nil {
+			lg.Errorf("%s:%d: %v", *cifpFilename, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		lg.Errorf("%s: %v", *cifpFilename, err)
+	}
+
+	lg.Printf("%s: parsed %d airports' procedures in %v", *cifpFilename, len(c.Procedures), time.Since(start))
+	return c
+}
+
+// parseRecord parses a single 132-column ARINC 424 record; records that
+// vice doesn't use are ignored.
+func (c *CIFP) parseRecord(r string) error {
+	if len(r) < 132 || r[0] != 'S' {
+		// Header records, etc.
+		return nil
+	}
+	field := func(first, last int) string { // 1-based, inclusive, as in the spec
+		return strings.TrimSpace(r[first-1 : last])
+	}
+
+	switch {
+	case r[4] == 'E' && r[5] == 'A':
+		// Enroute waypoint
+		if p, err := parseARINCLatLong(r[32:41], r[41:51]); err != nil {
+			return err
+		} else {
+			c.Fixes[field(14, 18)] = p
+		}
+
+	case r[4] == 'P' && (r[12] == 'C' || r[12] == 'G'):
+		// Terminal waypoint or runway
+		airport := field(7, 10)
+		if p, err := parseARINCLatLong(r[32:41], r[41:51]); err != nil {
+			return err
+		} else {
+			if c.TerminalFixes[airport] == nil {
+				c.TerminalFixes[airport] = make(map[string]Point2LL)
+			}
+			c.TerminalFixes[airport][field(14, 18)] = p
+		}
+
+	case r[4] == 'P' && (r[12] == 'D' || r[12] == 'E' || r[12] == 'F'):
+		if r[38] != '0' && r[38] != '1' {
+			// Continuation record
+			return nil
+		}
+		return c.parseProcedureLeg(r, field)
+	}
+	return nil
+}
+
+func (c *CIFP) parseProcedureLeg(r string, field func(int, int) string) error {
+	airport, ident := field(7, 10), field(14, 19)
+	if c.Procedures[airport] == nil {
+		c.Procedures[airport] = make(map[string]*Procedure)
+	}
+	proc, ok := c.Procedures[airport][ident]
+	if !ok {
+		proc = &Procedure{
+			Airport: airport,
+			Ident:   ident,
+			Type:    ProcedureType(strings.IndexByte("DEF", r[12])),
+		}
+		c.Procedures[airport][ident] = proc
+	}
+
+	routeType, transition := r[19], field(21, 25)
+	var route *ProcedureRoute
+	if n := len(proc.Routes); n > 0 && proc.Routes[n-1].RouteType == routeType &&
+		proc.Routes[n-1].Transition == transition {
+		route = proc.Routes[n-1]
+	} else {
+		route = &ProcedureRoute{RouteType: routeType, Transition: transition}
+		proc.Routes = append(proc.Routes, route)
+	}
+
+	leg := ProcedureLeg{
+		Fix:                 field(30, 34),
+		PathTerminator:      field(48, 49),
+		MissedApproach:      r[42] == 'M',
+		AltitudeDescription: r[82],
+		SpeedDescription:    r[117],
+	}
+	if crs := field(71, 74); crs != "" && !strings.HasSuffix(crs, "T") {
+		if v, err := strconv.Atoi(crs); err == nil {
+			leg.Course = (v + 5) / 10
+		}
+	}
+	var err error
+	if leg.Altitude[0], err = parseARINCAltitude(field(85, 89)); err != nil {
+		return err
+	}
+	if leg.Altitude[1], err = parseARINCAltitude(field(90, 94)); err != nil {
+		return err
+	}
+	if spd := field(100, 102); spd != "" {
+		if leg.Speed, err = strconv.Atoi(spd); err != nil {
+			return fmt.Errorf("%s: invalid speed limit: %v", spd, err)
+		}
+	}
+
+	route.Legs = append(route.Legs, leg)
+	return nil
+}
+
+// parseARINCAltitude parses altitudes like "05000" and "FL180".
+func parseARINCAltitude(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "FL") {
+		fl, err := strconv.Atoi(s[2:])
+		return 100 * fl, err
+	}
+	return strconv.Atoi(s)
+}
+
+// parseARINCLatLong parses latitudes like "N40384400" and longitudes like
+// "W073464500": degrees, minutes, and hundredths of seconds.
+func parseARINCLatLong(lat, long string) (Point2LL, error) {
+	parse := func(s string, degDigits int, neg byte) (float32, error) {
+		if len(s) != 1+degDigits+6 {
+			return 0, fmt.Errorf("%s: invalid latitude/longitude", s)
+		}
+		deg, err := strconv.Atoi(s[1 : 1+degDigits])
+		if err != nil {
+			return 0, err
+		}
+		mins, err := strconv.Atoi(s[1+degDigits : 3+degDigits])
+		if err != nil {
+			return 0, err
+		}
+		sec, err := strconv.Atoi(s[3+degDigits:])
+		if err != nil {
+			return 0, err
+		}
+		v := float32(deg) + float32(mins)/60 + float32(sec)/(100*3600)
+		if s[0] == neg {
+			v = -v
+		}
+		return v, nil
+	}
+
+	latitude, err := parse(lat, 2, 'S')
+	if err != nil {
+		return Point2LL{}, err
+	}
+	longitude, err := parse(long, 3, 'W')
+	if err != nil {
+		return Point2LL{}, err
+	}
+	return Point2LL{longitude, latitude}, nil
+}
+
+// phase returns the order in which the route is flown relative to the
+// procedure's other routes: 0 for routes before the common route, 1 for
+// the common route (or the final approach), and 2 for routes after it.
+func (r *ProcedureRoute) phase(t ProcedureType) int {
+	var first, common string
+	switch t {
+	case ProcedureSID:
+		// Runway transitions, common route, enroute transitions.
+		first, common = "14FT", "25M"
+	case ProcedureSTAR:
+		// Enroute transitions, common route, runway transitions.
+		first, common = "147F", "258M"
+	default:
+		// Approach transitions, then the approach itself.
+		first = "A"
+	}
+
+	if strings.IndexByte(first, r.RouteType) != -1 {
+		return 0
+	} else if t == ProcedureApproach || strings.IndexByte(common, r.RouteType) != -1 {
+		return 1
+	}
+	return 2
+}
+
+// Waypoints returns the waypoints for the procedure's common route and
+// the given transitions, in the order they are flown.
+func (p *Procedure) Waypoints(c *CIFP, transitions []string) ([]Waypoint, error) {
+	var routes [3][]*ProcedureRoute
+	found := make(map[string]interface{})
+	for _, r := range p.Routes {
+		ph := r.phase(p.Type)
+		if ph == 1 && (r.Transition == "" || r.Transition == "ALL" || p.Type == ProcedureApproach) {
+			routes[1] = append(routes[1], r)
+		} else if Find(transitions, r.Transition) != -1 {
+			routes[ph] = append(routes[ph], r)
+			found[r.Transition] = nil
+		}
+	}
+	for _, t := range transitions {
+		if _, ok := found[t]; !ok {
+			return nil, fmt.Errorf("%s: transition not found for %s/%s", t, p.Airport, p.Ident)
+		}
+	}
+
+	var wps []Waypoint
+	for _, rs := range routes {
+		for _, r := range rs {
+			for _, leg := range r.Legs {
+				if leg.MissedApproach {
+					break
+				}
+				if leg.Fix == "" {
+					// Heading and course legs that end at an altitude or
+					// intercept; the best we can do is to fly the heading
+					// after the previous fix.
+					if leg.Course != 0 && len(wps) > 0 {
+						wps[len(wps)-1].Heading = leg.Course
+					}
+					continue
+				}
+				if len(wps) > 0 && wps[len(wps)-1].Fix == leg.Fix {
+					// The end of one route is the start of the next, or a
+					// holding pattern at the fix.
+					continue
+				}
+
+				wp := Waypoint{Fix: leg.Fix}
+				var ok bool
+				if wp.Location, ok = c.locate(p.Airport, leg.Fix); !ok {
+					return nil, fmt.Errorf("%s: unable to locate fix in %s/%s", leg.Fix, p.Airport, p.Ident)
+				}
+				leg.addRestrictions(&wp)
+				if leg.PathTerminator == "FM" || leg.PathTerminator == "VM" {
+					// Fly the course after the fix until vectored.
+					wp.Heading = leg.Course
+				}
+				wps = append(wps, wp)
+			}
+		}
+	}
+	if len(wps) == 0 {
+		return nil, fmt.Errorf("%s/%s: no waypoints; a transition may need to be specified", p.Airport, p.Ident)
+	}
+	return wps, nil
+}
+
+// addRestrictions adds the leg's altitude and speed restrictions to the
+// waypoint.
+func (leg ProcedureLeg) addRestrictions(wp *Waypoint) {
+	switch leg.AltitudeDescription {
+	case ' ', '@':
+		wp.Altitude = leg.Altitude[0]
+	case '+':
+		wp.MinAltitude = leg.Altitude[0]
+	case '-':
+		wp.MaxAltitude = leg.Altitude[0]
+	case 'B':
+		wp.MaxAltitude, wp.MinAltitude = leg.Altitude[0], leg.Altitude[1]
+	}
+
+	switch leg.SpeedDescription {
+	case '+':
+		wp.MinSpeed = leg.Speed
+	case '-':
+		wp.MaxSpeed = leg.Speed
+	default:
+		wp.Speed = leg.Speed
+	}
+}
+
+// locate returns the location of a fix used in one of the given airport's
+// procedures.
+func (c *CIFP) locate(airport, fix string) (Point2LL, bool) {
+	if p, ok := c.TerminalFixes[airport][fix]; ok {
+		return p, true
+	} else if p, ok := c.Fixes[fix]; ok {
+		return p, true
+	} else if n, ok := database.Navaids[fix]; ok {
+		return n.Location, true
+	} else if f, ok := database.Fixes[fix]; ok {
+		return f.Location, true
+	}
+	return Point2LL{}, false
+}
+
+// ProcedureWaypoints returns the waypoints for a procedure reference of
+// the form AIRPORT/PROCEDURE[/TRANSITION...].
+func (db *StaticDatabase) ProcedureWaypoints(ref string) ([]Waypoint, error) {
+	f := strings.Split(strings.ToUpper(ref), "/")
+	if len(f) < 2 {
+		return nil, fmt.Errorf("%s: expected AIRPORT/PROCEDURE[/TRANSITION]", ref)
+	}
+	if db == nil || db.CIFP == nil {
+		return nil, fmt.Errorf("%s: procedures can only be used when a CIFP file is given with -cifp", ref)
+	}
+	proc, ok := db.CIFP.Procedures[f[0]][f[1]]
+	if !ok {
+		return nil, fmt.Errorf("%s: procedure not found in CIFP", ref)
+	}
+	return proc.Waypoints(db.CIFP, f[2:])
+}
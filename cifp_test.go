@@ -0,0 +1,134 @@
+// cifp_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseARINCLatLong(t *testing.T) {
+	for _, test := range []struct {
+		lat, long string
+		p         Point2LL
+		err       bool
+	}{
+		{"N40384400", "W073464500", Point2LL{-73.779166, 40.645555}, false},
+		{"S33563000", "E151104500", Point2LL{151.179166, -33.941666}, false},
+		{"N00000000", "E000000000", Point2LL{0, 0}, false},
+		{"N4038440", "W073464500", Point2LL{}, true},
+		{"N40384400", "W73464500", Point2LL{}, true},
+		{"N40X84400", "W073464500", Point2LL{}, true},
+	} {
+		p, err := parseARINCLatLong(test.lat, test.long)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s %s: expected an error", test.lat, test.long)
+			}
+		} else if err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.lat, test.long, err)
+		} else if abs(p[0]-test.p[0]) > 1e-4 || abs(p[1]-test.p[1]) > 1e-4 {
+			t.Errorf("%s %s: got %v, expected %v", test.lat, test.long, p, test.p)
+		}
+	}
+}
+
+// arincRecord returns a 132-column ARINC 424 record with the given strings
+// starting at the given 1-based columns.
+func arincRecord(fields map[int]string) string {
+	r := []byte(strings.Repeat(" ", 132))
+	r[0] = 'S'
+	for col, s := range fields {
+		copy(r[col-1:], s)
+	}
+	return string(r)
+}
+
+func TestParseRecord(t *testing.T) {
+	c := &CIFP{
+		Procedures:    make(map[string]map[string]*Procedure),
+		TerminalFixes: make(map[string]map[string]Point2LL),
+		Fixes:         make(map[string]Point2LL),
+	}
+	latlong := map[int]string{33: "N40384400", 42: "W073464500"}
+	withLatLong := func(fields map[int]string) map[int]string {
+		for col, s := range latlong {
+			fields[col] = s
+		}
+		return fields
+	}
+
+	for _, test := range []struct {
+		name   string
+		record string
+		err    bool
+	}{
+		{"header", "HDR01 FAACIFP18", false},
+		{"enroute waypoint", arincRecord(withLatLong(map[int]string{5: "EA", 14: "CAMRN"})), false},
+		{"terminal waypoint", arincRecord(withLatLong(map[int]string{5: "P", 7: "KJFK", 13: "C", 14: "ASALT"})), false},
+		{"runway", arincRecord(withLatLong(map[int]string{5: "P", 7: "KJFK", 13: "G", 14: "RW13L"})), false},
+		{"approach leg", arincRecord(map[int]string{5: "P", 7: "KJFK", 13: "F", 14: "I13L", 20: "A", 21: "CRI",
+			30: "CRI", 39: "1", 48: "IF", 71: "1340", 83: "+", 85: "03000", 100: "210", 118: "-"}), false},
+		{"missed approach leg", arincRecord(map[int]string{5: "P", 7: "KJFK", 13: "F", 14: "I13L", 20: "I",
+			30: "DPK", 39: "1", 43: "M", 48: "TF", 83: "B", 85: "FL180", 90: "04000"}), false},
+		{"continuation", arincRecord(map[int]string{5: "P", 7: "KJFK", 13: "F", 14: "I13L", 20: "I",
+			30: "ZZZZZ", 39: "2"}), false},
+		{"invalid latitude", arincRecord(map[int]string{5: "EA", 14: "BADLL", 33: "N40X84400", 42: "W073464500"}), true},
+		{"invalid speed", arincRecord(map[int]string{5: "P", 7: "KJFK", 13: "E", 14: "CAMRN4", 20: "5",
+			30: "CAMRN", 39: "1", 100: "2X0"}), true},
+	} {
+		if err := c.parseRecord(test.record); (err != nil) != test.err {
+			t.Errorf("%s: got error %v, expected error: %v", test.name, err, test.err)
+		}
+	}
+
+	expected := Point2LL{-73.779166, 40.645555}
+	checkFix := func(name string, p Point2LL, ok bool) {
+		if !ok {
+			t.Errorf("%s: not found", name)
+		} else if abs(p[0]-expected[0]) > 1e-4 || abs(p[1]-expected[1]) > 1e-4 {
+			t.Errorf("%s: got %v, expected %v", name, p, expected)
+		}
+	}
+	p, ok := c.Fixes["CAMRN"]
+	checkFix("CAMRN", p, ok)
+	p, ok = c.TerminalFixes["KJFK"]["ASALT"]
+	checkFix("ASALT", p, ok)
+	p, ok = c.TerminalFixes["KJFK"]["RW13L"]
+	checkFix("RW13L", p, ok)
+	if _, ok := c.Fixes["BADLL"]; ok {
+		t.Errorf("BADLL: shouldn't have been added")
+	}
+
+	proc, ok := c.Procedures["KJFK"]["I13L"]
+	if !ok {
+		t.Fatalf("I13L: not found")
+	}
+	if proc.Type != ProcedureApproach {
+		t.Errorf("I13L: got type %s, expected approach", proc.Type)
+	}
+	if len(proc.Routes) != 2 {
+		t.Fatalf("I13L: got %d routes, expected 2", len(proc.Routes))
+	}
+	if r := proc.Routes[0]; r.RouteType != 'A' || r.Transition != "CRI" || len(r.Legs) != 1 {
+		t.Errorf("I13L: got transition route %+v", r)
+	} else if leg := r.Legs[0]; leg.Fix != "CRI" || leg.PathTerminator != "IF" || leg.Course != 134 ||
+		leg.MissedApproach || leg.AltitudeDescription != '+' || leg.Altitude != [2]int{3000, 0} ||
+		leg.SpeedDescription != '-' || leg.Speed != 210 {
+		t.Errorf("I13L: got transition leg %+v", leg)
+	}
+	if r := proc.Routes[1]; r.RouteType != 'I' || r.Transition != "" || len(r.Legs) != 1 {
+		t.Errorf("I13L: got final route %+v", r)
+	} else if leg := r.Legs[0]; leg.Fix != "DPK" || !leg.MissedApproach || leg.AltitudeDescription != 'B' ||
+		leg.Altitude != [2]int{18000, 4000} {
+		t.Errorf("I13L: got missed approach leg %+v", leg)
+	}
+
+	if proc, ok := c.Procedures["KJFK"]["CAMRN4"]; !ok {
+		t.Errorf("CAMRN4: not found")
+	} else if proc.Type != ProcedureSTAR {
+		t.Errorf("CAMRN4: got type %s, expected STAR", proc.Type)
+	}
+}
@@ -0,0 +1,107 @@
+// clock.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// ScheduledEvent is something that the scenario or the Sim has scheduled
+// to happen at a known time.
+type ScheduledEvent struct {
+	Description string
+	Time        time.Time
+}
+
+// NextScheduledEvent returns the next event that will happen at a known
+// time: SIGMETs being issued or expiring, special operations ending,
+// runways reopening after treatment, and the challenge's time running
+// out.
+func (sim *Sim) NextScheduledEvent() (ScheduledEvent, bool) {
+	now := sim.CurrentTime()
+	var events []ScheduledEvent
+
+	for _, sig := range sim.Scenario.SIGMETs {
+		start := sim.scheduleStart.Add(time.Duration(sig.Start) * time.Minute)
+		events = append(events, ScheduledEvent{Description: sig.Label() + " issued", Time: start})
+		if sig.End != 0 {
+			end := sim.scheduleStart.Add(time.Duration(sig.End) * time.Minute)
+			events = append(events, ScheduledEvent{Description: sig.Label() + " expires", Time: end})
+		}
+	}
+	for _, op := range sim.SpecialOperations {
+		events = append(events, ScheduledEvent{Description: op.Type.String() + " ends", Time: op.End})
+	}
+	for _, rs := range sim.RunwayStates {
+		if !rs.TreatmentEnd.IsZero() {
+			events = append(events, ScheduledEvent{
+				Description: rs.Airport + " " + rs.Runway + " reopens",
+				Time:        rs.TreatmentEnd,
+			})
+		}
+	}
+
+	if p := sim.Challenge; p != nil && !p.Finished && p.Challenge.TimeLimit > 0 {
+		events = append(events, ScheduledEvent{
+			Description: "challenge ends",
+			Time:        p.Start.Add(time.Duration(p.Challenge.TimeLimit) * time.Minute),
+		})
+	}
+
+	var next ScheduledEvent
+	found := false
+	for _, e := range events {
+		if e.Time.After(now) && (!found || e.Time.Before(next.Time)) {
+			next, found = e, true
+		}
+	}
+	return next, found
+}
+
+// formatDuration formats the given duration as H:MM:SS.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// facilityLocation returns the scenario group's time zone or, if it
+// doesn't specify one, a fixed offset from UTC based on the longitude of
+// its center.
+func facilityLocation() *time.Location {
+	if scenarioGroup.timeZone != nil {
+		return scenarioGroup.timeZone
+	}
+	hours := int(floor(scenarioGroup.Center.Longitude()/15 + 0.5))
+	return time.FixedZone(fmt.Sprintf("UTC%+d", hours), hours*3600)
+}
+
+// drawClock draws the simulated UTC time, the facility's local time (or,
+// when traffic follows the schedule, the time of day on its clock), the
+// elapsed session time, and the time until the next scheduled event in
+// the menu bar, ending at the given x coordinate.
+func drawClock(right float32) {
+	if sim.Scenario == nil {
+		return
+	}
+
+	now := sim.CurrentTime()
+	text := now.UTC().Format("15:04:05Z")
+	if sim.ScheduledTraffic {
+		text += "  " + sim.LocalTime().Format("15:04") + "L"
+	} else {
+		text += "  " + now.In(facilityLocation()).Format("15:04") + "L"
+	}
+	text += "  Session " + formatDuration(now.Sub(sim.scheduleStart))
+	if e, ok := sim.NextScheduledEvent(); ok {
+		text += "  Next: " + e.Description + " in " + formatDuration(e.Time.Sub(now))
+	}
+
+	width, _ := ui.font.BoundText(text, 0)
+	imgui.SetCursorPos(imgui.Vec2{right - float32(width+20), 0})
+	imgui.Text(text)
+}
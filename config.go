@@ -8,27 +8,138 @@ import (
 	"bytes"
 	_ "embed"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"path"
 	"strings"
 	"time"
-
-	"github.com/mmp/imgui-go/v4"
 )
 
+// ConfigVersion is the current version of the config file format. It
+// should be incremented whenever a change is made that requires existing
+// config files to be updated, with a corresponding function added to
+// configMigrations.
+const ConfigVersion = 3
+
+// configMigrations[i] updates the decoded JSON of a version i config file
+// to version i+1. If it has to discard any of the user's settings, it
+// returns a description of what was lost so that the user can be told.
+var configMigrations = []func(config map[string]interface{}) string{
+	// 0 -> 1: the pane layout format changed incompatibly; the default
+	// layout is created in Activate().
+	func(config map[string]interface{}) string {
+		if _, ok := config["DisplayRoot"]; ok {
+			delete(config, "DisplayRoot")
+			return "The window layout and STARS settings have been reset to the defaults."
+		}
+		return ""
+	},
+	// 1 -> 2: no changes other than the version number.
+	func(config map[string]interface{}) string { return "" },
+	// 2 -> 3: the conflict alert parameters moved from the STARS pane's
+	// facility to ConflictAlert.
+	func(config map[string]interface{}) string {
+		var visit func(node interface{})
+		visit = func(node interface{}) {
+			n, ok := node.(map[string]interface{})
+			if !ok {
+				return
+			}
+			if pane, ok := n["Pane"].(map[string]interface{}); ok && n["Type"] == "*main.STARSPane" {
+				if facility, ok := pane["Facility"].(map[string]interface{}); ok {
+					if ca, ok := facility["CA"]; ok {
+						if _, ok := config["ConflictAlert"]; !ok {
+							config["ConflictAlert"] = ca
+						}
+						delete(facility, "CA")
+					}
+				}
+			}
+			if children, ok := n["Children"].([]interface{}); ok {
+				for _, c := range children {
+					visit(c)
+				}
+			}
+		}
+		visit(config["DisplayRoot"])
+		return ""
+	},
+}
+
 type GlobalConfig struct {
 	Version               int
 	InitialWindowSize     [2]int
 	InitialWindowPosition [2]int
 	ImGuiSettings         string
 	WhatsNewIndex         int
+	WhatsNewVersion       string
 	LastScenarioGroup     string
 	UIFontSize            int
 	DCBFontSize           int
 
 	Audio AudioSettings
 
+	ExportDirectory string
+
+	// Which releases the user is told about: "stable" (the default) or
+	// "beta", which also includes releases tagged as betas.
+	UpdateChannel string
+
+	// Privacy mode hides personal details such as local file paths and
+	// the user's name from the UI, for streaming and recording tutorials.
+	PrivacyMode               bool
+	PrivacyRandomizeCallsigns bool
+
+	// Whether the user has agreed to send anonymous crash reports and
+	// performance statistics; TelemetryAsked records that they have been
+	// asked.
+	TelemetryEnabled bool
+	TelemetryAsked   bool
+
+	// Speak announcements of dialog boxes opening and other changes in
+	// the UI's state, for users of screen readers.
+	Announcements bool
+
+	// Draw the radar scope with larger datablocks and thicker lines.
+	HighContrastRadar bool
+
+	// Pan and zoom the radar scope using a gamepad.
+	GamepadControl bool
+
+	APIEnabled bool
+	APIPort    int
+
+	MultiplayerEnabled bool
+	MultiplayerPort    int
+	// The multiplayer server only listens on localhost unless
+	// MultiplayerAllowRemote is set.
+	MultiplayerAllowRemote bool
+	// Remote participants must give the join code to connect; if
+	// MultiplayerRequireApproval is set, the host must also approve each
+	// of them.
+	MultiplayerJoinCode        string
+	MultiplayerRequireApproval bool
+	// Most recently used server, position, and role when connecting to a
+	// multiplayer server.
+	MultiplayerAddress  string
+	MultiplayerPosition string
+	MultiplayerRole     string
+
+	// The sim is paused automatically when the window loses focus, if
+	// PauseOnFocusLoss is set, or when there has been no user input for
+	// AutoPauseMinutes, if it is non-zero.
+	PauseOnFocusLoss bool
+	AutoPauseMinutes int32
+
+	// Use the current real-world weather in new simulations.
+	LiveWeather bool
+
+	// Alerts defined by the user; see alerts.go.
+	UserAlerts []*UserAlert
+
+	ConflictAlert ConflictAlertParameters
+
 	DisplayRoot *DisplayNode
 
 	DevScenarioFile string
@@ -36,6 +147,10 @@ type GlobalConfig struct {
 
 	highlightedLocation        Point2LL
 	highlightedLocationEndTime time.Time
+
+	// Set if the config file was written by a newer version of vice, in
+	// which case it isn't saved so that its settings aren't lost.
+	fromNewerVersion bool
 }
 
 func configFilePath() string {
@@ -61,6 +176,11 @@ func (gc *GlobalConfig) Encode(w io.Writer) error {
 }
 
 func (c *GlobalConfig) Save() error {
+	if c.fromNewerVersion {
+		lg.Printf("Not saving config from a newer version of vice")
+		return nil
+	}
+
 	lg.Printf("Saving config to: %s", configFilePath())
 	f, err := os.Create(configFilePath())
 	if err != nil {
@@ -84,7 +204,7 @@ func (gc *GlobalConfig) SaveIfChanged(renderer Renderer, platform Platform) bool
 		return false
 	}
 
-	if b.String() == string(onDisk) {
+	if b.String() == string(onDisk) || gc.fromNewerVersion {
 		return false
 	}
 
@@ -111,32 +231,124 @@ func LoadOrMakeDefaultConfig() {
 		globalConfig.Audio.SoundEffects[AudioEventInboundHandoff] = "Beep Up"
 		globalConfig.Audio.SoundEffects[AudioEventHandoffAccepted] = "Blip"
 		globalConfig.Audio.SoundEffects[AudioEventCommandError] = "Beep Negative"
+		globalConfig.Audio.SoundEffects[AudioEventPointOut] = "Beep Double"
+		globalConfig.Audio.SoundEffects[AudioEventMSAW] = "Alarm - Digital"
+		globalConfig.Audio.SoundEffects[AudioEventLandlineRing] = "Ring"
+		globalConfig.Audio.SoundEffects[AudioEventPilotTransmission] = "Squelch"
+		globalConfig.Audio.SoundEffects[AudioEventUserAlert] = "Alert Short"
+		globalConfig.Audio.SpatialTransmissions = true
+		globalConfig.Audio.RepeatUntilAcknowledged[AudioEventInboundHandoff] = true
+		globalConfig.Audio.RepeatUntilAcknowledged[AudioEventLandlineRing] = true
 
-		globalConfig.Version = 2
+		globalConfig.Version = ConfigVersion
 		globalConfig.WhatsNewIndex = len(whatsNew)
+		globalConfig.WhatsNewVersion = buildVersion
 	} else {
+		config = migrateConfig(fn, config)
+
 		r := bytes.NewReader(config)
 		d := json.NewDecoder(r)
 
 		if err := d.Decode(globalConfig); err != nil {
-			ShowErrorDialog("Configuration file is corrupt: %v", err)
+			backup, berr := backupConfig(fn, config, "corrupt")
+			if berr != nil {
+				ShowErrorDialog("Configuration file is corrupt: %v", err)
+			} else {
+				ShowErrorDialog("Configuration file is corrupt: %v\nA copy of it has been saved to %s.", err, backup)
+			}
 		}
-
-		if globalConfig.Version < 1 {
-			// Force upgrade via upcoming Activate() call...
-			globalConfig.DisplayRoot = nil
-			globalConfig.Version = 1
+		if globalConfig.Version > ConfigVersion {
+			globalConfig.fromNewerVersion = true
+		} else {
+			globalConfig.Version = ConfigVersion
 		}
 	}
 
+	if globalConfig.UpdateChannel != "beta" {
+		globalConfig.UpdateChannel = "stable"
+	}
 	if globalConfig.UIFontSize == 0 {
 		globalConfig.UIFontSize = 16
 	}
 	if globalConfig.DCBFontSize == 0 {
 		globalConfig.DCBFontSize = 12
 	}
+	if globalConfig.ConflictAlert.LateralMinimum == 0 {
+		globalConfig.ConflictAlert.SetDefaults()
+	}
+	if globalConfig.Audio.SpeechVolume == 0 {
+		globalConfig.Audio.SpeechVolume = 1
+	}
+	for i, r := range globalConfig.Audio.SpeechRates {
+		if r == 0 {
+			globalConfig.Audio.SpeechRates[i] = defaultSpeechRate
+		}
+	}
+}
+
+// migrateConfig brings the given config file contents up to the current
+// ConfigVersion, returning the updated JSON. A copy of the original file
+// is saved before it is changed so that nothing is lost if the update
+// goes wrong or if the user goes back to an earlier release of vice. If
+// the config is from a newer release than this one, the user is warned
+// that changes to the settings won't be saved.
+func migrateConfig(fn string, config []byte) []byte {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(config, &raw); err != nil {
+		// Let the caller report it when it tries to decode it.
+		return config
+	}
+
+	version := 0
+	if v, ok := raw["Version"].(float64); ok {
+		version = max(0, int(v))
+	}
+	if version == ConfigVersion {
+		return config
+	}
+
+	backup, err := backupConfig(fn, config, fmt.Sprintf("v%d", version))
+	if err != nil {
+		lg.Errorf("%s: unable to save backup of config file: %v", fn, err)
+	} else {
+		lg.Printf("%s: saved version %d config to %s", fn, version, backup)
+	}
+
+	if version > ConfigVersion {
+		ShowErrorDialog("The configuration file was written by a newer version of vice (version %d,\n"+
+			"while this one supports version %d). So that settings that this version doesn't know\n"+
+			"about aren't lost, changes to the settings won't be saved.", version, ConfigVersion)
+		return config
+	}
+
+	var lost []string
+	for v := version; v < ConfigVersion; v++ {
+		lg.Printf("%s: migrating config from version %d to %d", fn, v, v+1)
+		if msg := configMigrations[v](raw); msg != "" {
+			lost = append(lost, msg)
+		}
+	}
+	raw["Version"] = ConfigVersion
+
+	updated, err := json.Marshal(raw)
+	if err != nil {
+		lg.Errorf("%s: unable to encode migrated config: %v", fn, err)
+		return config
+	}
+
+	if len(lost) > 0 {
+		ShowErrorDialog("The configuration file has been updated for this version of vice.\n%s\n"+
+			"A copy of the original has been saved to %s.", strings.Join(lost, "\n"), backup)
+	}
+	return updated
+}
 
-	imgui.LoadIniSettingsFromMemory(globalConfig.ImGuiSettings)
+// backupConfig saves a copy of the given config file contents in the
+// config directory, with the given suffix added to its name, and returns
+// the path to the copy.
+func backupConfig(fn string, config []byte, suffix string) (string, error) {
+	backup := strings.TrimSuffix(fn, ".json") + "-" + suffix + ".json"
+	return backup, os.WriteFile(backup, config, 0o600)
 }
 
 func (gc *GlobalConfig) Activate() {
@@ -0,0 +1,117 @@
+// conflictalert.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// The Sim monitors separation between all pairs of aircraft with each
+// radar track update, using the aircraft's reported track positions and
+// altitudes as STARS would. When a pair loses the conflict alert minima,
+// a ConflictAlertEvent is posted; the STARS pane then shows "CA" in the
+// datablocks of both aircraft, flashes them, and sounds the aural alarm
+// until separation is regained.
+
+type ConflictAlertParameters struct {
+	LateralMinimum  float32 // nm
+	VerticalMinimum int32   // feet
+	// Aircraft below this altitude don't trigger alerts.
+	Floor int32
+}
+
+func (c *ConflictAlertParameters) SetDefaults() {
+	c.LateralMinimum = 3
+	c.VerticalMinimum = 1000
+	c.Floor = 500
+}
+
+// conflictAlert returns true if the two aircraft have lost the conflict
+// alert minima and aren't exempt from alerts.
+func conflictAlert(ac0, ac1 *Aircraft, p ConflictAlertParameters) bool {
+	if ac0.TrackAltitude() < int(p.Floor) || ac1.TrackAltitude() < int(p.Floor) {
+		return false
+	}
+
+	// No conflict alerts with aircraft established on different approaches
+	// unless they share a final.
+	if ac0.Approach != nil && ac1.Approach != nil && ac0.Approach != ac1.Approach && !sim.onSharedFinal(ac0, ac1) {
+		return false
+	}
+
+	// No conflict alerts between a departure and an aircraft on an
+	// approach (assume <1000' and no assigned approach implies a
+	// departure).
+	if ac0.Approach == nil && ac0.Altitude < 1000 && ac1.Approach != nil {
+		return false
+	}
+	if ac1.Approach == nil && ac1.Altitude < 1000 && ac0.Approach != nil {
+		return false
+	}
+
+	return nmdistance2ll(ac0.TrackPosition(), ac1.TrackPosition()) <= p.LateralMinimum &&
+		abs(ac0.TrackAltitude()-ac1.TrackAltitude()) <= int(p.VerticalMinimum-50 /*small slop for fp error*/)
+}
+
+// checkConflictAlerts checks all pairs of aircraft for loss of
+// separation; it should be called after each track update.
+func (sim *Sim) checkConflictAlerts() {
+	if sim.conflictAlerts == nil {
+		sim.conflictAlerts = make(map[[2]string]interface{})
+	}
+
+	var aircraft []*Aircraft
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		if ac := sim.Aircraft[callsign]; ac.HaveTrack() && ac.Mode == Charlie {
+			aircraft = append(aircraft, ac)
+		}
+	}
+
+	p := globalConfig.ConflictAlert
+	active := make(map[[2]string]interface{})
+	for i, ac0 := range aircraft {
+		for _, ac1 := range aircraft[i+1:] {
+			if !conflictAlert(ac0, ac1, p) {
+				continue
+			}
+
+			key := [2]string{ac0.Callsign, ac1.Callsign}
+			active[key] = nil
+			if _, ok := sim.conflictAlerts[key]; !ok {
+				lg.Printf("%s/%s: conflict alert", ac0.Callsign, ac1.Callsign)
+				eventStream.Post(&ConflictAlertEvent{aircraft: [2]*Aircraft{ac0, ac1}})
+				sim.scoreConflict(ac0, ac1)
+			}
+		}
+	}
+	sim.conflictAlerts = active
+}
+
+// ConflictAlerts returns the callsigns of the aircraft that the given
+// aircraft is currently in conflict alert with.
+func (sim *Sim) ConflictAlerts(callsign string) []string {
+	var cs []string
+	for key := range sim.conflictAlerts {
+		if key[0] == callsign {
+			cs = append(cs, key[1])
+		} else if key[1] == callsign {
+			cs = append(cs, key[0])
+		}
+	}
+	return cs
+}
+
+// checkRemoteAlerts runs the conflict alert and MSAW checks for a Sim
+// that is a multiplayer client once a second, as updates arrive from the
+// server.
+func (sim *Sim) checkRemoteAlerts() {
+	now := sim.CurrentTime()
+	if now.Sub(sim.lastTrackUpdate) < time.Second {
+		return
+	}
+	sim.lastTrackUpdate = now
+	sim.checkConflictAlerts()
+	sim.checkMSAW()
+}
@@ -0,0 +1,127 @@
+// dependentapproaches.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// With dependent approaches to parallel runways, aircraft on adjacent
+// finals must be staggered so that each one has at least a minimum
+// diagonal distance to the aircraft ahead of it on the other final.
+// Scenarios define the approaches that are run dependently; STARS then
+// shows the diagonal distance between each such pair of aircraft and
+// alerts if it is predicted to drop below the minimum.
+
+type DependentApproaches struct {
+	Airport string `json:"airport"`
+	// Approaches gives the names of the approaches (as in the airport's
+	// "approaches") that are run dependently.
+	Approaches []string `json:"approaches"`
+	// DiagonalSeparation is the minimum diagonal distance in nm between
+	// aircraft on different approaches (default 1.5).
+	DiagonalSeparation float32 `json:"diagonal_separation,omitempty"`
+	// Pairs are only considered once the trailing aircraft is within
+	// this many nm of its threshold (default 20).
+	Range float32 `json:"range,omitempty"`
+
+	approaches []*Approach
+}
+
+// DependentPair is an aircraft and the aircraft ahead of it on an
+// adjacent dependent approach.
+type DependentPair struct {
+	Lead, Trail *Aircraft
+	Required    float32
+	Distance    float32
+	// The minimum distance between them over the prediction interval.
+	Predicted float32
+}
+
+func (d DependentPair) PredictedViolation() bool {
+	return d.Predicted < d.Required
+}
+
+// Diagonal separation is predicted over this many seconds.
+const dependentPredictionSeconds = 60
+
+func (d *DependentApproaches) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if d.DiagonalSeparation == 0 {
+		d.DiagonalSeparation = 1.5
+	} else if d.DiagonalSeparation < 0 {
+		e.ErrorString("\"diagonal_separation\" must be positive")
+	}
+	if d.Range == 0 {
+		d.Range = 20
+	}
+
+	ap, ok := sg.Airports[d.Airport]
+	if !ok {
+		e.ErrorString("airport \"%s\" not found", d.Airport)
+		return
+	}
+	if len(d.Approaches) < 2 {
+		e.ErrorString("at least two \"approaches\" must be given")
+	}
+	for _, name := range d.Approaches {
+		if appr, ok := ap.Approaches[name]; !ok {
+			e.ErrorString("approach \"%s\" not found", name)
+		} else {
+			d.approaches = append(d.approaches, &appr)
+		}
+	}
+}
+
+// Pairs returns the pairs of aircraft established on different approaches
+// that are subject to diagonal separation.
+func (d *DependentApproaches) Pairs(aircraft []*Aircraft) []DependentPair {
+	type arrival struct {
+		ac       *Aircraft
+		approach string
+		distance float32
+	}
+	var arrivals []arrival
+	for _, ac := range aircraft {
+		if ac.Approach == nil || !ac.OnFinal || ac.Rollout != nil || ac.FlightPlan == nil ||
+			ac.FlightPlan.ArrivalAirport != d.Airport {
+			continue
+		}
+		if FindIf(d.approaches, func(a *Approach) bool { return a.FullName == ac.Approach.FullName }) == -1 {
+			continue
+		}
+		if path, ok := ac.ProjectedApproachPath(ac.Approach); ok {
+			if dist := nmpathlength2ll(path); dist < d.Range {
+				arrivals = append(arrivals, arrival{ac: ac, approach: ac.Approach.FullName, distance: dist})
+			}
+		}
+	}
+
+	// Each aircraft is paired with the closest aircraft ahead of it on
+	// another approach.
+	var pairs []DependentPair
+	for _, trail := range arrivals {
+		var lead *arrival
+		for i, a := range arrivals {
+			if a.approach != trail.approach && a.distance < trail.distance &&
+				(lead == nil || a.distance > lead.distance) {
+				lead = &arrivals[i]
+			}
+		}
+		if lead == nil {
+			continue
+		}
+
+		p := DependentPair{
+			Lead:     lead.ac,
+			Trail:    trail.ac,
+			Required: d.DiagonalSeparation,
+			Distance: nmdistance2ll(lead.ac.TrackPosition(), trail.ac.TrackPosition()),
+		}
+		p.Predicted = p.Distance
+		for t := float32(10); t <= dependentPredictionSeconds; t += 10 {
+			p0 := add2ll(lead.ac.TrackPosition(), scale2ll(lead.ac.HeadingVector(), t/60))
+			p1 := add2ll(trail.ac.TrackPosition(), scale2ll(trail.ac.HeadingVector(), t/60))
+			p.Predicted = min(p.Predicted, nmdistance2ll(p0, p1))
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs
+}
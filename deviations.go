@@ -0,0 +1,178 @@
+// deviations.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Each aircraft's flight path is compared to its most recent clearance
+// so that pilot deviations are flagged on the scope and recorded in the
+// session; this catches both intentional pilot errors and bugs in the
+// flight model, which otherwise would be easy to miss. An altitude or
+// heading is only monitored once the aircraft has reached it, so that
+// climbs, descents, and turns in progress aren't flagged.
+
+const (
+	// Deviations from an assigned altitude or crossing restriction of
+	// more than this many feet are flagged.
+	deviationAltitudeTolerance = 300
+	// An assigned altitude is considered to have been reached when the
+	// aircraft is within this many feet of it.
+	deviationAltitudeCapture = 100
+	// Deviations from an assigned heading of more than this many degrees
+	// are flagged, once the aircraft is within deviationHeadingCapture
+	// degrees of it.
+	deviationHeadingTolerance = 15
+	deviationHeadingCapture   = 5
+	// A waypoint is considered to have been crossed if the aircraft is
+	// within this many nm of it when it moves on to the next one.
+	deviationCrossingDistance = 2
+)
+
+type DeviationType int
+
+const (
+	DeviationAltitude DeviationType = iota
+	DeviationHeading
+	DeviationCrossingRestriction
+)
+
+// Abbreviation returns the short form of the deviation that is shown in
+// datablocks.
+func (d DeviationType) Abbreviation() string {
+	return [...]string{"ALT", "HDG", "XR"}[d]
+}
+
+type PilotDeviation struct {
+	Type        DeviationType
+	Time        time.Time
+	Description string
+}
+
+// deviationMonitor records what an aircraft was last cleared for and
+// whether it has reached it.
+type deviationMonitor struct {
+	altitude         int
+	altitudeCaptured bool
+	heading          int
+	headingCaptured  bool
+	// The waypoint that the aircraft was flying to at the last update.
+	waypoint Waypoint
+}
+
+// ActiveDeviation returns the aircraft's current deviation from its
+// clearance, if any.
+func (sim *Sim) ActiveDeviation(callsign string) (*PilotDeviation, bool) {
+	d, ok := sim.deviations[callsign]
+	return d, ok
+}
+
+// checkDeviations is called after each aircraft update to compare its
+// flight path to its clearance.
+func (sim *Sim) checkDeviations(ac *Aircraft, now time.Time) {
+	if sim.deviationMonitors == nil {
+		sim.deviationMonitors = make(map[string]*deviationMonitor)
+		sim.deviations = make(map[string]*PilotDeviation)
+	}
+
+	m, ok := sim.deviationMonitors[ac.Callsign]
+	if !ok {
+		m = &deviationMonitor{altitude: ac.AssignedAltitude, heading: ac.AssignedHeading}
+		if len(ac.Waypoints) > 0 {
+			m.waypoint = ac.Waypoints[0]
+		}
+		sim.deviationMonitors[ac.Callsign] = m
+		return
+	}
+
+	// A new clearance starts the monitoring over and clears any
+	// deviation from the previous one.
+	if ac.AssignedAltitude != m.altitude {
+		m.altitude, m.altitudeCaptured = ac.AssignedAltitude, false
+		sim.clearDeviation(ac, DeviationAltitude)
+	}
+	if ac.AssignedHeading != m.heading {
+		m.heading, m.headingCaptured = ac.AssignedHeading, false
+		sim.clearDeviation(ac, DeviationHeading)
+	}
+
+	if m.altitude != 0 {
+		d := abs(int(ac.Altitude) - m.altitude)
+		if d <= deviationAltitudeCapture {
+			m.altitudeCaptured = true
+			sim.clearDeviation(ac, DeviationAltitude)
+		} else if m.altitudeCaptured && d > deviationAltitudeTolerance {
+			sim.flagDeviation(ac, DeviationAltitude, now, "%s altitude deviation: %d' assigned %d'",
+				ac.Callsign, int(ac.Altitude), m.altitude)
+		}
+	}
+
+	if m.heading != 0 {
+		d := headingDifference(ac.Heading, float32(m.heading))
+		if d <= deviationHeadingCapture {
+			m.headingCaptured = true
+			sim.clearDeviation(ac, DeviationHeading)
+		} else if m.headingCaptured && d > deviationHeadingTolerance {
+			sim.flagDeviation(ac, DeviationHeading, now, "%s heading deviation: %03d assigned %03d",
+				ac.Callsign, int(ac.Heading), m.heading)
+		}
+	}
+
+	// Check crossing restrictions when the aircraft sequences to its next
+	// waypoint, provided that it actually flew over the previous one
+	// rather than being sent direct somewhere else.
+	var wp Waypoint
+	if len(ac.Waypoints) > 0 {
+		wp = ac.Waypoints[0]
+	}
+	if prev := m.waypoint; prev.Fix != "" && prev.Fix != wp.Fix && prev.HasAltitudeRestriction() &&
+		nmdistance2ll(ac.Position, prev.Location) < deviationCrossingDistance {
+		lo, hi := prev.AltitudeLimits()
+		alt := int(ac.Altitude)
+		low := lo != 0 && alt < lo-deviationAltitudeTolerance
+		// "At" altitudes on approaches are at-or-above restrictions.
+		high := hi != 0 && alt > hi+deviationAltitudeTolerance && !(ac.ClearedApproach && prev.Altitude != 0)
+		if low || high {
+			sim.flagDeviation(ac, DeviationCrossingRestriction, now, "%s crossed %s at %d', restriction %s",
+				ac.Callsign, prev.Fix, alt, prev.AltitudeRestriction())
+		} else {
+			sim.clearDeviation(ac, DeviationCrossingRestriction)
+		}
+	}
+	m.waypoint = wp
+}
+
+// flagDeviation records a deviation the first time it happens; it stays
+// flagged until the aircraft corrects it or is issued a new clearance.
+func (sim *Sim) flagDeviation(ac *Aircraft, t DeviationType, now time.Time, format string, args ...interface{}) {
+	if d, ok := sim.deviations[ac.Callsign]; ok && d.Type == t {
+		return
+	}
+
+	d := &PilotDeviation{Type: t, Time: now, Description: fmt.Sprintf(format, args...)}
+	sim.deviations[ac.Callsign] = d
+	lg.Printf("%s: IAS %.0f GS %.0f heading %.0f altitude %.0f", d.Description, ac.IAS, ac.GS,
+		ac.Heading, ac.Altitude)
+	sim.recording.AddEvent(SessionEventDeviation, ac, now, "%s", d.Description)
+}
+
+func (sim *Sim) clearDeviation(ac *Aircraft, t DeviationType) {
+	if d, ok := sim.deviations[ac.Callsign]; ok && d.Type == t {
+		delete(sim.deviations, ac.Callsign)
+	}
+}
+
+// pruneDeviations discards the state for aircraft that have left the
+// simulation.
+func (sim *Sim) pruneDeviations() {
+	for callsign := range sim.deviationMonitors {
+		if _, ok := sim.Aircraft[callsign]; !ok {
+			delete(sim.deviationMonitors, callsign)
+			delete(sim.deviations, callsign)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// emergencies.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The sim may declare emergencies at a configurable rate for aircraft
+// tracked by the user. Aircraft with an engine failure, a medical
+// emergency, or a pressurization problem squawk 7700, declare on the
+// frequency, and keep asking until the user issues priority handling with
+// the "PRI" command; engine failures and pressurization problems also
+// limit how high the aircraft can fly. Aircraft that have lost their
+// radios squawk 7600 and don't respond to instructions. In devmode, the
+// "EMERG" command triggers an emergency on the selected aircraft.
+
+var ErrNoRadioContact = errors.New("No response from aircraft")
+
+// How often an aircraft in an emergency repeats its request if priority
+// handling hasn't been issued.
+const emergencyRepeatInterval = time.Minute
+
+type EmergencyType int
+
+const (
+	EmergencyEngineFailure EmergencyType = iota
+	EmergencyMedical
+	EmergencyPressurization
+	EmergencyRadioFailure
+	EmergencyCount
+)
+
+func (t EmergencyType) String() string {
+	return [...]string{
+		"Engine failure",
+		"Medical",
+		"Pressurization",
+		"Radio failure",
+	}[t]
+}
+
+type Emergency struct {
+	Type     EmergencyType
+	Declared time.Time
+	// Set once the controller has issued priority handling.
+	PriorityHandling bool
+	// The aircraft can't be assigned altitudes above this one; zero if
+	// there is no limit.
+	MaxAltitude int
+
+	lastCall time.Time
+}
+
+// emergencyCandidate returns true if an emergency may be declared by the
+// given aircraft.
+func (sim *Sim) emergencyCandidate(ac *Aircraft) bool {
+	return ac.Emergency == nil && !ac.LiveADSB && ac.FlightPlan != nil &&
+		ac.Rollout == nil && !ac.OnRunway() && ac.Altitude > 3000
+}
+
+// startEmergency declares an emergency of a random type for a random
+// aircraft tracked by the user; it returns false if there are no
+// aircraft that may have one.
+func (sim *Sim) startEmergency(now time.Time) bool {
+	var candidates []*Aircraft
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		if ac := sim.Aircraft[callsign]; ac.TrackingController == sim.Callsign() && sim.emergencyCandidate(ac) {
+			candidates = append(candidates, ac)
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	sim.declareEmergency(Sample(candidates), EmergencyType(rand.Intn(int(EmergencyCount))), now)
+	return true
+}
+
+// declareEmergency starts the given emergency for the aircraft.
+func (sim *Sim) declareEmergency(ac *Aircraft, t EmergencyType, now time.Time) {
+	em := &Emergency{Type: t, Declared: now, lastCall: now}
+	ac.Emergency = em
+	lg.Printf("%s: %s emergency", ac.Callsign, t)
+	sim.recording.AddEvent(SessionEventEmergency, ac, now, "%s declared an emergency: %s", ac.Callsign, t)
+
+	if t == EmergencyRadioFailure {
+		ac.Squawk = Squawk(0o7600)
+		return
+	}
+
+	ac.Squawk = Squawk(0o7700)
+	souls := 2 + rand.Intn(150)
+	fuel := fmt.Sprintf("%d hours %d minutes of fuel", 1+rand.Intn(3), 5*rand.Intn(12))
+	alt := 100 * int((ac.Altitude+50)/100)
+
+	switch t {
+	case EmergencyEngineFailure:
+		// Drift down to an altitude that can be maintained on the
+		// remaining engine.
+		em.MaxAltitude = max(3000, 1000*int(ac.Altitude/2000))
+		pilotResponse(ac.Callsign, "mayday mayday mayday, %s, engine failure, unable to maintain %d, "+
+			"descending to %d, request priority handling, %d souls on board, %s",
+			ac.Callsign, alt, em.MaxAltitude, souls, fuel)
+
+	case EmergencyMedical:
+		pilotResponse(ac.Callsign, "pan-pan pan-pan pan-pan, %s, we have a medical emergency on board, "+
+			"request priority handling to %s, %d souls on board, %s",
+			ac.Callsign, ac.FlightPlan.ArrivalAirport, souls, fuel)
+
+	case EmergencyPressurization:
+		em.MaxAltitude = min(10000, alt)
+		pilotResponse(ac.Callsign, "mayday mayday mayday, %s, lost cabin pressure, emergency descent to %d, "+
+			"request priority handling, %d souls on board, %s", ac.Callsign, em.MaxAltitude, souls, fuel)
+	}
+	if em.MaxAltitude != 0 && (ac.AssignedAltitude == 0 || ac.AssignedAltitude > em.MaxAltitude) {
+		ac.AssignedAltitude = em.MaxAltitude
+		ac.AssignedAltitudeAfterSpeed = 0
+		ac.CrossingAltitude = 0
+	}
+}
+
+// updateEmergencies starts new emergencies and has aircraft that haven't
+// been given priority handling repeat their requests.
+func (sim *Sim) updateEmergencies(now time.Time) {
+	if sim.EmergencyRate > 0 && now.After(sim.NextEmergency) {
+		sim.startEmergency(now)
+		hours := lerp(rand.Float32(), .5, 1.5) / sim.EmergencyRate
+		sim.NextEmergency = now.Add(time.Duration(hours * float32(time.Hour)))
+	}
+
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		em := ac.Emergency
+		if em == nil {
+			continue
+		}
+
+		if em.MaxAltitude != 0 && ac.AssignedAltitude > em.MaxAltitude {
+			ac.AssignedAltitude = em.MaxAltitude
+		}
+		if em.Type != EmergencyRadioFailure && !em.PriorityHandling &&
+			ac.TrackingController == sim.Callsign() && now.Sub(em.lastCall) >= emergencyRepeatInterval {
+			em.lastCall = now
+			pilotResponse(callsign, "%s, still requesting priority handling", callsign)
+		}
+	}
+}
+
+// PriorityHandling acknowledges an aircraft's emergency or MEDEVAC flight
+// and gives it priority handling.
+func (sim *Sim) PriorityHandling(callsign string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if ac.Medevac && ac.Emergency == nil {
+		ac.MedevacPriority = true
+	} else if ac.Emergency == nil {
+		return ErrInvalidCommandSyntax
+	} else {
+		ac.Emergency.PriorityHandling = true
+	}
+	sim.recording.AddEvent(SessionEventEmergency, ac, sim.CurrentTime(), "%s given priority handling", callsign)
+	pilotReadback(callsign, "priority_handling", ReadbackData{})
+	return nil
+}
+
+// TriggerEmergency declares an emergency for the given aircraft; it is
+// only available in devmode. The type may be given as "E", "M", "P", or
+// "R" for an engine failure, medical emergency, pressurization problem,
+// or radio failure; a random one is chosen if it is empty.
+func (sim *Sim) TriggerEmergency(callsign string, t string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if ac.Emergency != nil || ac.LiveADSB || ac.FlightPlan == nil {
+		return ErrUnableCommand
+	}
+
+	et := EmergencyType(rand.Intn(int(EmergencyCount)))
+	if t != "" {
+		idx := strings.Index("EMPR", t)
+		if len(t) != 1 || idx == -1 {
+			return ErrInvalidCommandParameter
+		}
+		et = EmergencyType(idx)
+	}
+	sim.declareEmergency(ac, et, sim.CurrentTime())
+	return nil
+}
@@ -243,6 +243,22 @@ func (e *RejectedHandoffEvent) String() string {
 	return "RejectedHandoffEvent: " + e.controller + " " + e.ac.Callsign
 }
 
+type ConflictAlertEvent struct {
+	aircraft [2]*Aircraft
+}
+
+func (e *ConflictAlertEvent) String() string {
+	return "ConflictAlertEvent: " + e.aircraft[0].Callsign + " " + e.aircraft[1].Callsign
+}
+
+type MSAWEvent struct {
+	ac *Aircraft
+}
+
+func (e *MSAWEvent) String() string {
+	return "MSAWEvent: " + e.ac.Callsign
+}
+
 type RadioTransmissionEvent struct {
 	callsign, message string
 }
@@ -250,3 +266,27 @@ type RadioTransmissionEvent struct {
 func (e *RadioTransmissionEvent) String() string {
 	return "RadioTransmissionEvent: callsign: " + e.callsign + ", message: " + e.message
 }
+
+// LandlineMessageEvent is posted for messages to the user from other
+// controllers, which come over the landline rather than the radio.
+type LandlineMessageEvent struct {
+	from, message string
+}
+
+func (e *LandlineMessageEvent) String() string {
+	return "LandlineMessageEvent: from: " + e.from + ", message: " + e.message
+}
+
+// MultiplayerErrorEvent is posted when the multiplayer server reports an
+// error for a request from the client. If the request was to run
+// commands, the commands and the ones that were not run are included.
+type MultiplayerErrorEvent struct {
+	callsign  string
+	commands  string
+	remaining []string
+	err       error
+}
+
+func (e *MultiplayerErrorEvent) String() string {
+	return "MultiplayerErrorEvent: " + e.callsign + " " + e.err.Error()
+}
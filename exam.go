@@ -0,0 +1,249 @@
+// exam.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// In over-the-shoulder (OTS) exam mode, sessions are run the way a
+// practical exam is: the assists that a real scope doesn't provide are
+// disabled (the final approach spacing assistant, handoff reminders,
+// dependent approach spacing, dead reckoning, assigned values in
+// datablocks, automatic tracking of departures, and suggestions for
+// mistyped commands), and every action the user takes is logged. When
+// the session ends, the scored errors (see scoring.go) are graded
+// against criteria along the lines of those used for VATSIM OTS
+// evaluations; the grading sheet is shown in place of the usual debrief
+// and saved as JSON in the user's config directory.
+
+// ExamAction is a single action taken by the user during an exam.
+type ExamAction struct {
+	Time     time.Time
+	Callsign string
+	Action   string
+	Error    string `json:",omitempty"`
+}
+
+// ExamSession holds the Sim's state for an exam.
+type ExamSession struct {
+	Actions []ExamAction
+}
+
+// AssistsEnabled returns true if the controller assists are available;
+// they are disabled in exam mode.
+func (sim *Sim) AssistsEnabled() bool {
+	return sim.Exam == nil
+}
+
+// examAction logs an action the user has taken if an exam is being run.
+func (sim *Sim) examAction(callsign string, err error, format string, args ...interface{}) {
+	if sim.Exam == nil {
+		return
+	}
+	a := ExamAction{
+		Time:     sim.CurrentTime(),
+		Callsign: callsign,
+		Action:   fmt.Sprintf(format, args...),
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	sim.Exam.Actions = append(sim.Exam.Actions, a)
+}
+
+type ExamGrade int
+
+const (
+	ExamGradeSatisfactory ExamGrade = iota
+	ExamGradeNeedsImprovement
+	ExamGradeUnsatisfactory
+)
+
+func (g ExamGrade) String() string {
+	return [...]string{"Satisfactory", "Needs improvement", "Unsatisfactory"}[g]
+}
+
+func (g ExamGrade) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.String())
+}
+
+// examCriteria are the areas that exams are graded in, along with the
+// scored errors that count against each one. A single error in a
+// critical area is unsatisfactory; elsewhere, one error needs
+// improvement and more are unsatisfactory.
+var examCriteria = []struct {
+	Name       string
+	Categories []ScoreCategory
+	Critical   bool
+}{
+	{"Separation", []ScoreCategory{ScoreSeparationLoss, ScoreWakeViolation}, true},
+	{"Terrain and obstruction clearance", []ScoreCategory{ScoreMinimumAltitude}, true},
+	{"Coordination", []ScoreCategory{ScoreLateHandoff, ScoreUntrackedExit, ScoreLOAViolation}, false},
+	{"Communication", []ScoreCategory{ScoreUnansweredCheckIn, ScoreUncorrectedReadback}, false},
+	{"Sequencing and efficiency", []ScoreCategory{ScoreSpacingGoAround}, false},
+}
+
+// Fraction of commands that may fail (e.g., due to typos) before the
+// "Communication" area needs improvement.
+const examMaxCommandErrorRate = 0.1
+
+type ExamCriterionGrade struct {
+	Name   string
+	Grade  ExamGrade
+	Errors []ScoredError `json:",omitempty"`
+	Notes  string        `json:",omitempty"`
+}
+
+// ExamGradingSheet is the result of an exam.
+type ExamGradingSheet struct {
+	ScenarioGroup string
+	Scenario      string
+	Start, End    time.Time
+	Aircraft      int
+	Criteria      []ExamCriterionGrade
+	Passed        bool
+	Actions       []ExamAction
+}
+
+// GradeExam grades the session given its score and the actions the user
+// took; the exam is passed if no area is unsatisfactory.
+func GradeExam(score SessionScore, actions []ExamAction) ExamGradingSheet {
+	g := ExamGradingSheet{
+		ScenarioGroup: score.ScenarioGroup,
+		Scenario:      score.Scenario,
+		Start:         score.Start,
+		End:           score.End,
+		Aircraft:      score.Aircraft,
+		Passed:        true,
+		Actions:       actions,
+	}
+
+	for _, c := range examCriteria {
+		cg := ExamCriterionGrade{Name: c.Name}
+		cg.Errors = FilterSlice(score.Errors, func(e ScoredError) bool {
+			return Find(c.Categories, e.Category) != -1
+		})
+		if n := len(cg.Errors); n > 0 && (c.Critical || n > 1) {
+			cg.Grade = ExamGradeUnsatisfactory
+		} else if n == 1 {
+			cg.Grade = ExamGradeNeedsImprovement
+		}
+
+		if c.Name == "Communication" && score.Commands > 0 {
+			rate := float32(score.CommandErrors) / float32(score.Commands)
+			cg.Notes = fmt.Sprintf("%d of %d commands failed", score.CommandErrors, score.Commands)
+			if rate > examMaxCommandErrorRate {
+				cg.Grade = max(cg.Grade, ExamGradeNeedsImprovement)
+			}
+		}
+
+		if cg.Grade == ExamGradeUnsatisfactory {
+			g.Passed = false
+		}
+		g.Criteria = append(g.Criteria, cg)
+	}
+	return g
+}
+
+// saveExam saves the grading sheet in the Exams directory in the user's
+// config directory.
+func saveExam(g ExamGradingSheet) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		lg.Errorf("Unable to find user config dir: %v", err)
+		dir = "."
+	}
+	dir = path.Join(dir, "Vice", "Exams")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		lg.Errorf("%s: %v", dir, err)
+		return
+	}
+
+	fn := path.Join(dir, time.Now().Format("2006-01-02-150405")+".json")
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err == nil {
+		err = os.WriteFile(fn, b, 0o600)
+	}
+	if err != nil {
+		lg.Errorf("%s: %v", fn, err)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// ExamModalClient
+
+// ExamModalClient shows an exam's grading sheet.
+type ExamModalClient struct {
+	sheet ExamGradingSheet
+}
+
+func (e *ExamModalClient) Title() string { return "Exam Grading Sheet" }
+
+func (e *ExamModalClient) Opening() {}
+
+func (e *ExamModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{{text: "Ok"}}
+}
+
+func (e *ExamModalClient) Draw() int {
+	g := &e.sheet
+	imgui.Text(fmt.Sprintf("%s: %s", g.ScenarioGroup, g.Scenario))
+	imgui.Text(fmt.Sprintf("%s, %d aircraft worked", g.End.Sub(g.Start).Round(time.Minute), g.Aircraft))
+	if g.Passed {
+		imgui.Text("Result: PASS")
+	} else {
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text("Result: FAIL")
+		imgui.PopStyleColor()
+	}
+	imgui.Separator()
+
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg
+	if imgui.BeginTableV("criteria", 3, tableFlags, imgui.Vec2{600, 0}, 0) {
+		imgui.TableSetupColumn("Area")
+		imgui.TableSetupColumn("Grade")
+		imgui.TableSetupColumn("Notes")
+		imgui.TableHeadersRow()
+		for _, c := range g.Criteria {
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(c.Name)
+			imgui.TableNextColumn()
+			imgui.Text(c.Grade.String())
+			imgui.TableNextColumn()
+			var notes []string
+			if c.Notes != "" {
+				notes = append(notes, c.Notes)
+			}
+			for _, err := range c.Errors {
+				notes = append(notes, err.Time.Format("15:04:05")+" "+err.Description)
+			}
+			imgui.Text(strings.Join(notes, "\n"))
+		}
+		imgui.EndTable()
+	}
+
+	imgui.Separator()
+	imgui.Text(fmt.Sprintf("Actions (%d)", len(g.Actions)))
+	imgui.BeginChildV("actions", imgui.Vec2{600, 200}, true, 0)
+	for _, a := range g.Actions {
+		s := a.Time.Format("15:04:05") + " " + a.Callsign + " " + a.Action
+		if a.Error != "" {
+			s += ": " + a.Error
+		}
+		imgui.Text(s)
+	}
+	imgui.EndChild()
+
+	return -1
+}
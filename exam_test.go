@@ -0,0 +1,56 @@
+// exam_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+)
+
+func TestGradeExam(t *testing.T) {
+	const (
+		S = ExamGradeSatisfactory
+		N = ExamGradeNeedsImprovement
+		U = ExamGradeUnsatisfactory
+	)
+	for _, test := range []struct {
+		name                    string
+		errors                  []ScoreCategory
+		commands, commandErrors int
+		// Separation, terrain, coordination, communication, sequencing
+		grades [5]ExamGrade
+		passed bool
+	}{
+		{"clean", nil, 50, 0, [5]ExamGrade{S, S, S, S, S}, true},
+		{"separation loss", []ScoreCategory{ScoreSeparationLoss}, 50, 0, [5]ExamGrade{U, S, S, S, S}, false},
+		{"wake violation", []ScoreCategory{ScoreWakeViolation}, 50, 0, [5]ExamGrade{U, S, S, S, S}, false},
+		{"MVA", []ScoreCategory{ScoreMinimumAltitude}, 50, 0, [5]ExamGrade{S, U, S, S, S}, false},
+		{"late handoff", []ScoreCategory{ScoreLateHandoff}, 50, 0, [5]ExamGrade{S, S, N, S, S}, true},
+		{"coordination errors", []ScoreCategory{ScoreLateHandoff, ScoreLOAViolation}, 50, 0,
+			[5]ExamGrade{S, S, U, S, S}, false},
+		{"go around", []ScoreCategory{ScoreSpacingGoAround}, 50, 0, [5]ExamGrade{S, S, S, S, N}, true},
+		{"command errors", nil, 50, 6, [5]ExamGrade{S, S, S, N, S}, true},
+		{"few command errors", nil, 50, 5, [5]ExamGrade{S, S, S, S, S}, true},
+		{"communication errors", []ScoreCategory{ScoreUnansweredCheckIn, ScoreUncorrectedReadback}, 50, 10,
+			[5]ExamGrade{S, S, S, U, S}, false},
+	} {
+		score := SessionScore{Commands: test.commands, CommandErrors: test.commandErrors}
+		for _, c := range test.errors {
+			score.Errors = append(score.Errors, ScoredError{Category: c})
+		}
+
+		g := GradeExam(score, nil)
+		if g.Passed != test.passed {
+			t.Errorf("%s: got passed %v, expected %v", test.name, g.Passed, test.passed)
+		}
+		if len(g.Criteria) != len(test.grades) {
+			t.Fatalf("%s: got %d criteria, expected %d", test.name, len(g.Criteria), len(test.grades))
+		}
+		for i, c := range g.Criteria {
+			if c.Grade != test.grades[i] {
+				t.Errorf("%s: %s: got %s, expected %s", test.name, c.Name, c.Grade, test.grades[i])
+			}
+		}
+	}
+}
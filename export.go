@@ -0,0 +1,164 @@
+// export.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exporters for SessionRecordings, so that sessions can be analyzed with
+// external tools: KML for Google Earth, GeoJSON for GIS tools, and CSV
+// for everything else.
+
+const feetToMeters = 0.3048
+
+func (e SessionEventType) String() string {
+	return [...]string{"handoff", "conflict", "go-around", "similar callsign", "pilot deviation",
+		"emergency"}[e]
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteKML writes the recording as a KML document with a path for each
+// aircraft's ground track and a timestamped placemark for each event.
+func (r *SessionRecording) WriteKML(w io.Writer) error {
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<kml xmlns="http://www.opengis.net/kml/2.2">`)
+	fmt.Fprintln(w, `<Document>`)
+	fmt.Fprintf(w, "<name>vice session %s</name>\n", r.Start.UTC().Format(time.RFC3339))
+
+	fmt.Fprintln(w, `<Folder><name>Tracks</name>`)
+	for _, callsign := range SortedMapKeys(r.Tracks) {
+		tracks := r.Tracks[callsign]
+		fmt.Fprintf(w, "<Placemark><name>%s</name>\n", xmlEscape(callsign))
+		fmt.Fprintf(w, "<TimeSpan><begin>%s</begin><end>%s</end></TimeSpan>\n",
+			tracks[0].Time.UTC().Format(time.RFC3339), tracks[len(tracks)-1].Time.UTC().Format(time.RFC3339))
+		fmt.Fprintln(w, "<LineString><altitudeMode>absolute</altitudeMode><coordinates>")
+		for _, t := range tracks {
+			fmt.Fprintf(w, "%f,%f,%.0f\n", t.Position.Longitude(), t.Position.Latitude(),
+				float32(t.Altitude)*feetToMeters)
+		}
+		fmt.Fprintln(w, "</coordinates></LineString></Placemark>")
+	}
+	fmt.Fprintln(w, `</Folder>`)
+
+	fmt.Fprintln(w, `<Folder><name>Events</name>`)
+	for _, e := range r.Events {
+		fmt.Fprintf(w, "<Placemark><name>%s</name><description>%s</description>\n",
+			xmlEscape(e.Type.String()), xmlEscape(e.Description))
+		fmt.Fprintf(w, "<TimeStamp><when>%s</when></TimeStamp>\n", e.Time.UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "<Point><coordinates>%f,%f</coordinates></Point></Placemark>\n",
+			e.Position.Longitude(), e.Position.Latitude())
+	}
+	fmt.Fprintln(w, `</Folder>`)
+
+	fmt.Fprintln(w, `</Document>`)
+	_, err := fmt.Fprintln(w, `</kml>`)
+	return err
+}
+
+// WriteGeoJSON writes the recording as a GeoJSON FeatureCollection; each
+// aircraft's track is a LineString feature with per-point times, speeds,
+// and headings in its properties and each event is a Point feature.
+func (r *SessionRecording) WriteGeoJSON(w io.Writer) error {
+	type Geometry struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+	}
+	type Feature struct {
+		Type       string                 `json:"type"`
+		Geometry   Geometry               `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	fc := struct {
+		Type     string    `json:"type"`
+		Features []Feature `json:"features"`
+	}{Type: "FeatureCollection"}
+
+	for _, callsign := range SortedMapKeys(r.Tracks) {
+		var coords [][3]float32
+		var times []string
+		var gs []int
+		var hdg []int
+		for _, t := range r.Tracks[callsign] {
+			coords = append(coords, [3]float32{t.Position.Longitude(), t.Position.Latitude(),
+				float32(t.Altitude) * feetToMeters})
+			times = append(times, t.Time.UTC().Format(time.RFC3339))
+			gs = append(gs, t.Groundspeed)
+			hdg = append(hdg, int(t.Heading+.5))
+		}
+		fc.Features = append(fc.Features, Feature{
+			Type:     "Feature",
+			Geometry: Geometry{Type: "LineString", Coordinates: coords},
+			Properties: map[string]interface{}{
+				"callsign":     callsign,
+				"times":        times,
+				"groundspeeds": gs,
+				"headings":     hdg,
+			},
+		})
+	}
+
+	for _, e := range r.Events {
+		fc.Features = append(fc.Features, Feature{
+			Type: "Feature",
+			Geometry: Geometry{Type: "Point",
+				Coordinates: [2]float32{e.Position.Longitude(), e.Position.Latitude()}},
+			Properties: map[string]interface{}{
+				"event":       e.Type.String(),
+				"time":        e.Time.UTC().Format(time.RFC3339),
+				"callsign":    e.Callsign,
+				"description": e.Description,
+			},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fc)
+}
+
+// WriteTracksCSV writes one row for each recorded position of each
+// aircraft.
+func (r *SessionRecording) WriteTracksCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"callsign", "time", "latitude", "longitude", "altitude", "groundspeed", "heading"})
+	for _, callsign := range SortedMapKeys(r.Tracks) {
+		for _, t := range r.Tracks[callsign] {
+			cw.Write([]string{callsign, t.Time.UTC().Format(time.RFC3339),
+				strconv.FormatFloat(float64(t.Position.Latitude()), 'f', 6, 32),
+				strconv.FormatFloat(float64(t.Position.Longitude()), 'f', 6, 32),
+				strconv.Itoa(t.Altitude), strconv.Itoa(t.Groundspeed),
+				strconv.Itoa(int(t.Heading + .5))})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteEventsCSV writes one row for each recorded event.
+func (r *SessionRecording) WriteEventsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "event", "callsign", "latitude", "longitude", "description"})
+	for _, e := range r.Events {
+		cw.Write([]string{e.Time.UTC().Format(time.RFC3339), e.Type.String(), e.Callsign,
+			strconv.FormatFloat(float64(e.Position.Latitude()), 'f', 6, 32),
+			strconv.FormatFloat(float64(e.Position.Longitude()), 'f', 6, 32),
+			e.Description})
+	}
+	cw.Flush()
+	return cw.Error()
+}
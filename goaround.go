@@ -0,0 +1,159 @@
+// goaround.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// Arrivals go around for a number of modeled reasons in addition to
+// random chance: when they cross the final approach fix too fast or too
+// high to be stabilized, when the preceding arrival hasn't yet cleared
+// the runway, and when they encounter wind shear in gusty conditions. The
+// go around probability in the scenario settings is the chance of a
+// go-around for no particular reason; it also gives the probability that
+// a marginally unstable approach or a gusty wind leads to one. Pilots
+// state the reason when they go around.
+
+type GoAroundCause int
+
+const (
+	GoAroundUnstated GoAroundCause = iota
+	GoAroundTooFast
+	GoAroundTooHigh
+	GoAroundRunwayOccupied
+	GoAroundWindShear
+	GoAroundRunwayClosed
+)
+
+// Reason returns the reason that pilots give for the go-around.
+func (c GoAroundCause) Reason() string {
+	return [...]string{"", "unstable approach, too fast", "unstable approach, too high",
+		"traffic on the runway", "wind shear", "runway closed"}[c]
+}
+
+const (
+	// Aircraft more than this many knots above the speed they'd be
+	// flying at the final approach fix without any speed assignments
+	// are unstable; half of it is marginal.
+	unstableSpeedExcess = 30
+	// The same, for feet above a three degree glidepath.
+	unstableAltitudeExcess = 600
+	// Feet per nm of a three degree glidepath.
+	glidepathFeetPerNM = 318
+	// Aircraft go around if the runway is occupied this many nm from
+	// the threshold.
+	runwayOccupiedDistance = 0.5
+	// Gusts must be at least this many knots above the wind speed to
+	// cause wind shear; the probability of wind shear grows with the
+	// difference.
+	windShearGustSpread = 10
+	// Scheduled go-arounds happen this many nm from the threshold.
+	goAroundDistance = 0.25
+)
+
+// checkGoAround decides whether an aircraft on final goes around; it
+// should be called once a second for each aircraft.
+func (sim *Sim) checkGoAround(ac *Aircraft, now time.Time) {
+	if !ac.OnFinal || len(ac.Waypoints) != 1 {
+		return
+	}
+	dist := nmdistance2ll(ac.Position, ac.Waypoints[0].Location)
+
+	if ac.Approach != nil && ac.FlightPlan != nil {
+		// Check stability once, when the aircraft has just crossed the
+		// final approach fix.
+		if sim.stabilityChecked == nil {
+			sim.stabilityChecked = make(map[string]interface{})
+		}
+		if _, ok := sim.stabilityChecked[ac.Callsign]; !ok {
+			sim.stabilityChecked[ac.Callsign] = nil
+			if cause, ok := sim.approachStability(ac, dist); ok {
+				sim.goAround(ac, cause, now)
+				return
+			}
+		}
+
+		if dist < runwayOccupiedDistance && sim.runwayOccupied(ac) {
+			sim.goAround(ac, GoAroundRunwayOccupied, now)
+			return
+		}
+	}
+
+	if cause, ok := sim.WillGoAround[ac.Callsign]; ok && dist < goAroundDistance {
+		sim.goAround(ac, cause, now)
+	}
+}
+
+// approachStability checks an aircraft that has just crossed the final
+// approach fix at the given distance from the threshold. It returns the
+// cause if it should go around immediately; it may also schedule a
+// go-around for wind shear on short final.
+func (sim *Sim) approachStability(ac *Aircraft, dist float32) (GoAroundCause, bool) {
+	perf := ac.Performance
+	// The speed the aircraft would be flying here if left alone; see
+	// Aircraft.updateAirspeed.
+	expectedSpeed := float32(min(210, perf.Speed.Cruise))
+	if airportPos, ok := scenarioGroup.Locate(ac.FlightPlan.ArrivalAirport); ok {
+		if d := nmdistance2ll(ac.Position, airportPos); d < 10 {
+			expectedSpeed = lerp(max(0, d-1)/9, float32(perf.Speed.Landing), expectedSpeed)
+		}
+	}
+	speedExcess := ac.IAS - expectedSpeed
+
+	altitudeExcess := float32(0)
+	if ap, ok := database.Airports[ac.FlightPlan.ArrivalAirport]; ok {
+		altitudeExcess = ac.Altitude - float32(ap.Elevation) - glidepathFeetPerNM*dist
+	}
+
+	lg.Printf("%s: at the FAF %.0f kts fast, %.0f ft high", ac.Callsign, speedExcess, altitudeExcess)
+	marginal := rand.Float32() < sim.GoAroundRate
+	if speedExcess > unstableSpeedExcess || (marginal && speedExcess > unstableSpeedExcess/2) {
+		return GoAroundTooFast, true
+	}
+	if altitudeExcess > unstableAltitudeExcess || (marginal && altitudeExcess > unstableAltitudeExcess/2) {
+		return GoAroundTooHigh, true
+	}
+
+	if spread := sim.Wind.Gust - sim.Wind.Speed; spread >= windShearGustSpread {
+		if rand.Float32() < sim.GoAroundRate*float32(spread)/(2*windShearGustSpread) {
+			sim.WillGoAround[ac.Callsign] = GoAroundWindShear
+		}
+	}
+	return GoAroundUnstated, false
+}
+
+// runwayOccupied returns true if an aircraft that landed on the same
+// runway is still on it.
+func (sim *Sim) runwayOccupied(ac *Aircraft) bool {
+	rwy := approachRunway(ac.Approach)
+	for _, other := range sim.Aircraft {
+		if other != ac && other.OnRunway() && other.Rollout.Runway == rwy && other.FlightPlan != nil &&
+			other.FlightPlan.ArrivalAirport == ac.FlightPlan.ArrivalAirport {
+			return true
+		}
+	}
+	return false
+}
+
+// goAround has the aircraft go around and tell the user why.
+func (sim *Sim) goAround(ac *Aircraft, cause GoAroundCause, now time.Time) {
+	delete(sim.WillGoAround, ac.Callsign)
+	// Check again on its next approach.
+	delete(sim.stabilityChecked, ac.Callsign)
+
+	sim.scoreGoAround(ac)
+	ac.GoAround(sim)
+	if ac.Hold != nil {
+		pilotReadback(ac.Callsign, "missed_approach", ReadbackData{Fix: ac.Hold.Fix, Reason: cause.Reason()})
+	} else {
+		pilotReadback(ac.Callsign, "go_around", ReadbackData{Reason: cause.Reason()})
+	}
+	if reason := cause.Reason(); reason != "" {
+		sim.recording.AddEvent(SessionEventGoAround, ac, now, "%s went around: %s", ac.Callsign, reason)
+	} else {
+		sim.recording.AddEvent(SessionEventGoAround, ac, now, "%s went around", ac.Callsign)
+	}
+}
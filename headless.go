@@ -0,0 +1,150 @@
+// headless.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// With the -serve command-line option, vice runs a simulation without
+// opening a window and hosts it for multiplayer clients, so that a
+// training group can keep a session running on a server that its members
+// join from their own copies of vice. No one works the scenario's
+// position locally; it may be staffed by a remote controller like any
+// other position.
+//
+// The scenario group and scenario are given with -servegroup and
+// -servescenario; otherwise the last ones used are run. The multiplayer
+// port and join code come from the config file; if there is no join
+// code, a new one is generated and printed. Connections from other
+// computers are only accepted with -serveremote or if the config file
+// allows them. The localhost API is always
+// enabled and provides admin commands for managing participants and
+// restarting the scenario (see api.go); errors that would be shown in
+// dialog boxes are logged to stderr instead. Neither a window nor audio
+// nor imgui is initialized, so vice can run on a server without a
+// display.
+
+// How often the Sim is updated and requests are handled.
+const headlessUpdateInterval = 50 * time.Millisecond
+
+func runHeadless() {
+	eventStream = NewEventStream()
+	lg = NewLogger(true, true, 50000)
+	defer lg.SaveLogs()
+
+	LoadOrMakeDefaultConfig()
+	// Leave the user's window layout alone and don't speak.
+	globalConfig.DisplayRoot = nil
+	globalConfig.Announcements = false
+	if globalConfig.MultiplayerPort == 0 {
+		globalConfig.MultiplayerPort = 6503
+	}
+	if globalConfig.APIPort == 0 {
+		globalConfig.APIPort = 6502
+	}
+
+	database = InitializeStaticDatabase()
+
+	var e ErrorLogger
+	scenarioGroups = LoadScenarioGroups(&e)
+	if e.HaveErrors() {
+		e.PrintErrors()
+	}
+
+	group, scenario := *serveGroup, *serveScenario
+	if _, ok := scenarioGroups[globalConfig.LastScenarioGroup]; ok && group == "" {
+		group = globalConfig.LastScenarioGroup
+	}
+	sim = &Sim{}
+	if err := startSimulation(group, scenario); err != nil {
+		fmt.Fprintf(os.Stderr, "vice: %v\n", err)
+		return
+	}
+
+	globalConfig.MultiplayerEnabled = true
+	globalConfig.MultiplayerAllowRemote = globalConfig.MultiplayerAllowRemote || *serveRemote
+	multiplayerServerUpdate()
+	if multiplayerServer == nil {
+		return
+	}
+	globalConfig.APIEnabled = true
+	apiServerUpdate()
+	headlessDiscardDialogs()
+
+	fmt.Printf("vice: running %s/%s on port %d with join code %s\n", scenarioGroup.Name,
+		sim.Scenario.Name(), globalConfig.MultiplayerPort, globalConfig.MultiplayerJoinCode)
+	if apiServer != nil {
+		fmt.Printf("vice: admin API at http://127.0.0.1:%d/api/admin/ with token %s\n", globalConfig.APIPort,
+			apiServer.Token)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(headlessUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case s := <-sig:
+			lg.Printf("%s: shutting down", s)
+			if apiServer != nil {
+				apiServer.Stop()
+			}
+			multiplayerServer.Stop()
+			sim.Disconnect()
+			return
+
+		case <-ticker.C:
+			sim.GetUpdates()
+			if apiServer != nil {
+				apiServer.Process()
+			}
+			multiplayerServer.Process()
+			headlessDiscardDialogs()
+		}
+	}
+}
+
+// startSimulation starts running the given scenario from the given
+// scenario group with the default settings; if scenario is empty, the
+// group's default scenario is used. It is also used by the API's
+// restart command.
+func startSimulation(group string, scenario string) error {
+	sg, ok := scenarioGroups[group]
+	if !ok {
+		if group != "" {
+			return fmt.Errorf("%s: scenario group not found", group)
+		} else if len(scenarioGroups) == 0 {
+			return fmt.Errorf("no scenario groups are available")
+		}
+		sg = scenarioGroups[SortedMapKeys(scenarioGroups)[0]]
+	}
+	if _, ok := sg.Scenarios[scenario]; !ok && scenario != "" {
+		return fmt.Errorf("%s: scenario not found in %s", scenario, sg.Name)
+	}
+
+	scenarioGroup = sg
+	var ssc SimConnectionConfiguration
+	ssc.Initialize()
+	if scenario != "" {
+		ssc.SetScenario(scenario)
+	}
+	if err := ssc.Connect(); err != nil {
+		return err
+	}
+	lg.Printf("Running %s/%s", sg.Name, sim.Scenario.Name())
+	return nil
+}
+
+// headlessDiscardDialogs discards dialog boxes that would have been
+// shown; the errors they report have already been logged.
+func headlessDiscardDialogs() {
+	ui.activeModalDialogs = nil
+}
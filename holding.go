@@ -0,0 +1,396 @@
+// holding.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Arrivals can be told to hold at a fix, either one with a published
+// holding pattern (given in the scenario group's "holds") or with an
+// ad-hoc hold whose inbound course is the aircraft's course to the fix.
+// Aircraft continue along their route to the fix (or go direct if it
+// isn't on their route), slow to holding speed, make the standard
+// direct, parallel, or teardrop entry, and then fly the pattern until
+// they're cleared direct to a fix, given a heading, or cleared for an
+// approach. If an expect further clearance (EFC) time has been issued and
+// it passes while the aircraft is still holding, the pilot asks for
+// further clearance.
+
+type HoldEntry int
+
+const (
+	HoldEntryDirect HoldEntry = iota
+	HoldEntryParallel
+	HoldEntryTeardrop
+)
+
+func (e HoldEntry) String() string {
+	return [...]string{"direct", "parallel", "teardrop"}[e]
+}
+
+type HoldPhase int
+
+const (
+	// Flying to the holding fix.
+	HoldPhaseProceeding HoldPhase = iota
+	// Flying the outbound leg of a parallel or teardrop entry.
+	HoldPhaseEntryOutbound
+	// Returning to the fix after a parallel or teardrop entry.
+	HoldPhaseEntryReturn
+	// Turning to and flying the outbound leg.
+	HoldPhaseOutbound
+	// Turning to and flying the inbound leg.
+	HoldPhaseInbound
+)
+
+// PublishedHold is a holding pattern specified in a scenario group's
+// "holds", keyed by fix.
+type PublishedHold struct {
+	InboundCourse int     `json:"inbound_course"`
+	Turn          string  `json:"turn,omitempty"` // "L" or "R"; right turns if unspecified
+	LegMinutes    float32 `json:"leg_minutes,omitempty"`
+	LegNM         float32 `json:"leg_nm,omitempty"`
+}
+
+func (ph PublishedHold) PostDeserialize(fix string, sg *ScenarioGroup, e *ErrorLogger) {
+	if _, ok := sg.Locate(fix); !ok {
+		e.ErrorString("holding fix \"%s\" unknown", fix)
+	}
+	if ph.InboundCourse <= 0 || ph.InboundCourse > 360 {
+		e.ErrorString("invalid \"inbound_course\" %d", ph.InboundCourse)
+	}
+	if ph.Turn != "" && ph.Turn != "L" && ph.Turn != "R" {
+		e.ErrorString("\"turn\" must be \"L\" or \"R\"")
+	}
+	if ph.LegMinutes < 0 || ph.LegNM < 0 {
+		e.ErrorString("leg lengths must be positive")
+	}
+}
+
+type Hold struct {
+	Fix           string
+	Location      Point2LL
+	InboundCourse float32 // magnetic
+	TurnDirection int     // 1: right, -1: left
+	// Exactly one of the following is non-zero.
+	LegMinutes float32
+	LegNM      float32
+	// Expect further clearance time; zero if none has been issued.
+	EFC time.Time
+
+	Entry   HoldEntry
+	Phase   HoldPhase
+	Seconds int // time on the current leg
+
+	efcRequested bool
+}
+
+// NewHold returns a hold at the given fix for the given aircraft. The
+// published hold is used if there is one, though the turn direction and
+// leg length may be overridden: turns is 1 for right turns, -1 for left,
+// and 0 for the published direction (or right turns for an ad-hoc hold);
+// legNM is the length of the legs in nm, or zero for the published legs
+// (or standard timed legs for an ad-hoc hold).
+func NewHold(ac *Aircraft, fix string, turns int, legNM float32) (*Hold, error) {
+	fix = strings.ToUpper(fix)
+	loc, ok := scenarioGroup.Locate(fix)
+	if !ok {
+		return nil, ErrInvalidCommandParameter
+	}
+
+	h := &Hold{Fix: fix, Location: loc, TurnDirection: 1}
+	if ph, ok := scenarioGroup.Holds[fix]; ok {
+		h.InboundCourse = float32(ph.InboundCourse)
+		if ph.Turn == "L" {
+			h.TurnDirection = -1
+		}
+		h.LegMinutes, h.LegNM = ph.LegMinutes, ph.LegNM
+	} else if nmdistance2ll(ac.Position, loc) < 1 {
+		h.InboundCourse = ac.Heading
+	} else {
+		h.InboundCourse = headingp2ll(ac.Position, loc, scenarioGroup.MagneticVariation)
+	}
+
+	if turns != 0 {
+		h.TurnDirection = turns
+	}
+	if legNM != 0 {
+		h.LegMinutes, h.LegNM = 0, legNM
+	}
+	if h.LegMinutes == 0 && h.LegNM == 0 {
+		// Standard legs: 1 minute at or below 14,000', 1.5 minutes above.
+		if ac.Altitude <= 14000 {
+			h.LegMinutes = 1
+		} else {
+			h.LegMinutes = 1.5
+		}
+	}
+
+	return h, nil
+}
+
+// Description returns a description of the hold suitable for a pilot
+// readback.
+func (h *Hold) Description() string {
+	s := h.Fix
+	if _, ok := scenarioGroup.Holds[h.Fix]; ok {
+		return s + " as published"
+	}
+	s += fmt.Sprintf(", inbound course %03d", int(h.InboundCourse+.5))
+	if h.TurnDirection < 0 {
+		s += ", left turns"
+	} else {
+		s += ", right turns"
+	}
+	if h.LegNM != 0 {
+		s += fmt.Sprintf(", %s mile legs", strconv.FormatFloat(float64(h.LegNM), 'f', -1, 32))
+	} else {
+		s += fmt.Sprintf(", %s minute legs", strconv.FormatFloat(float64(h.LegMinutes), 'f', -1, 32))
+	}
+	return s
+}
+
+// MaxSpeed returns the maximum holding speed at the given altitude.
+func (h *Hold) MaxSpeed(altitude float32) int {
+	if altitude <= 6000 {
+		return 200
+	} else if altitude <= 14000 {
+		return 230
+	}
+	return 265
+}
+
+// EntryFor returns the entry to make when crossing the holding fix on the
+// given heading.
+func (h *Hold) EntryFor(heading float32) HoldEntry {
+	// Angle of the aircraft's heading relative to the inbound course,
+	// mirrored for left turns so that the same sectors apply.
+	rel := mod(heading-h.InboundCourse, 360)
+	if h.TurnDirection < 0 {
+		rel = mod(360-rel, 360)
+	}
+	if rel >= 110 && rel < 180 {
+		return HoldEntryParallel
+	} else if rel >= 180 && rel < 250 {
+		return HoldEntryTeardrop
+	}
+	return HoldEntryDirect
+}
+
+func (h *Hold) outboundCourse() float32 {
+	return mod(h.InboundCourse+180, 360)
+}
+
+// legComplete returns true if the aircraft has flown the full length of
+// the current outbound leg.
+func (h *Hold) legComplete(ac *Aircraft) bool {
+	if h.LegNM != 0 {
+		return nmdistance2ll(ac.Position, h.Location) >= h.LegNM
+	}
+	return float32(h.Seconds) >= 60*h.LegMinutes
+}
+
+// flyHoldHeading has the aircraft turn in the given direction to the given
+// heading; the turn direction is dropped once the aircraft is close to
+// the heading so that small corrections are made the short way.
+func (ac *Aircraft) flyHoldHeading(hdg float32, turn int) {
+	ac.AssignedHeading = int(hdg + .5)
+	if ac.AssignedHeading <= 0 {
+		ac.AssignedHeading += 360
+	} else if ac.AssignedHeading > 360 {
+		ac.AssignedHeading -= 360
+	}
+
+	if headingDifference(hdg, ac.Heading) < 30 {
+		ac.TurnDirection = 0
+	} else {
+		ac.TurnDirection = turn
+	}
+}
+
+// updateHold is called once a second for aircraft that have been told to
+// hold; it sets the heading to fly for the current phase of the hold.
+func (ac *Aircraft) updateHold() {
+	h := ac.Hold
+
+	if !h.EFC.IsZero() && !h.efcRequested && h.Phase != HoldPhaseProceeding &&
+		sim.CurrentTime().After(h.EFC) {
+		h.efcRequested = true
+		pilotReadback(ac.Callsign, "efc_reached", ReadbackData{Fix: h.Fix})
+	}
+
+	dist := nmdistance2ll(ac.Position, h.Location)
+	atFix := dist < max(.25, 2*ac.GS/3600)
+	toFix := headingp2ll(ac.Position, h.Location, scenarioGroup.MagneticVariation)
+
+	switch h.Phase {
+	case HoldPhaseProceeding:
+		if len(ac.Waypoints) > 0 && ac.Waypoints[0].Fix != h.Fix &&
+			FindIf(ac.Waypoints, func(wp Waypoint) bool { return wp.Fix == h.Fix }) != -1 {
+			// Keep flying the route until the holding fix is next.
+			return
+		}
+
+		if !atFix {
+			ac.flyHoldHeading(toFix, 0)
+			return
+		}
+
+		h.Entry = h.EntryFor(ac.Heading)
+		h.Seconds = 0
+		lg.Printf("%s: %s entry into hold at %s", ac.Callsign, h.Entry, h.Fix)
+		switch h.Entry {
+		case HoldEntryDirect:
+			h.Phase = HoldPhaseOutbound
+		case HoldEntryParallel:
+			h.Phase = HoldPhaseEntryOutbound
+			ac.flyHoldHeading(h.outboundCourse(), -h.TurnDirection)
+		case HoldEntryTeardrop:
+			h.Phase = HoldPhaseEntryOutbound
+			ac.flyHoldHeading(h.outboundCourse()-30*float32(h.TurnDirection), 0)
+		}
+		if h.Phase == HoldPhaseOutbound {
+			ac.flyHoldHeading(h.outboundCourse(), h.TurnDirection)
+		}
+
+	case HoldPhaseEntryOutbound:
+		hdg := h.outboundCourse()
+		if h.Entry == HoldEntryTeardrop {
+			hdg -= 30 * float32(h.TurnDirection)
+		}
+		ac.flyHoldHeading(hdg, ac.TurnDirection)
+		h.Seconds++
+		if h.legComplete(ac) {
+			// After a parallel entry, turn back toward the holding side;
+			// after a teardrop entry, turn in the direction of the hold.
+			h.Phase = HoldPhaseEntryReturn
+			if h.Entry == HoldEntryParallel {
+				ac.flyHoldHeading(toFix, -h.TurnDirection)
+			} else {
+				ac.flyHoldHeading(toFix, h.TurnDirection)
+			}
+		}
+
+	case HoldPhaseEntryReturn, HoldPhaseInbound:
+		if atFix {
+			h.Phase = HoldPhaseOutbound
+			h.Seconds = 0
+			ac.flyHoldHeading(h.outboundCourse(), h.TurnDirection)
+		} else {
+			ac.flyHoldHeading(toFix, ac.TurnDirection)
+		}
+
+	case HoldPhaseOutbound:
+		ac.flyHoldHeading(h.outboundCourse(), ac.TurnDirection)
+		// Start timing the leg once established outbound.
+		if headingDifference(h.outboundCourse(), ac.Heading) < 5 {
+			h.Seconds++
+		}
+		if h.legComplete(ac) && h.Seconds > 0 {
+			h.Phase = HoldPhaseInbound
+			ac.flyHoldHeading(toFix, h.TurnDirection)
+		}
+	}
+}
+
+// CancelHold takes the aircraft out of the hold, if it's holding.
+func (ac *Aircraft) CancelHold() {
+	if ac.Hold != nil {
+		lg.Printf("%s: leaving hold at %s", ac.Callsign, ac.Hold.Fix)
+		ac.Hold = nil
+		ac.AssignedHeading = 0
+		ac.TurnDirection = 0
+	}
+}
+
+// AssignHold tells the aircraft to hold at the given fix; see NewHold for
+// the meaning of turns and legLength.
+func (sim *Sim) AssignHold(callsign string, fix string, turns int, legLength float32) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if ac.OnFinal || ac.ClearedApproach {
+		return ErrUnableCommand
+	}
+
+	h, err := NewHold(ac, fix, turns, legLength)
+	if err != nil {
+		if serr := sim.suggestFix(callsign, fix, false); serr != nil {
+			return serr
+		}
+		return err
+	}
+
+	// The hold clearance includes the clearance to the fix, so any
+	// assigned heading is cancelled.
+	ac.CancelHold()
+	ac.AssignedHeading, ac.TurnDirection = 0, 0
+	ac.clearReadbackError(ReadbackErrorHeading)
+	ac.Hold = h
+	pilotReadback(callsign, "hold", ReadbackData{Fix: h.Fix, Hold: h.Description()})
+	return nil
+}
+
+// ExpectFurtherClearance issues an EFC time to an aircraft that has been
+// told to hold.
+func (sim *Sim) ExpectFurtherClearance(callsign string, efc time.Time) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if ac.Hold == nil {
+		return ErrUnableCommand
+	}
+
+	ac.Hold.EFC = efc
+	ac.Hold.efcRequested = false
+	pilotReadback(callsign, "expect_further_clearance", ReadbackData{Time: efc.UTC().Format("1504")})
+	return nil
+}
+
+// runHoldCommand handles HOLD commands, which are of the form
+// HOLD<fix>[/L|/R][/<legs nm>], and EFC commands, which give the time in
+// hhmm, e.g. EFC1545.
+func (sim *Sim) runHoldCommand(callsign string, command string) error {
+	if strings.HasPrefix(command, "EFC") {
+		t, err := time.Parse("1504", command[3:])
+		if err != nil {
+			return ErrInvalidCommandParameter
+		}
+		// Pick the next time with the given hours and minutes.
+		now := sim.CurrentTime().UTC()
+		efcTime := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+		if efcTime.Before(now.Add(-time.Hour)) {
+			efcTime = efcTime.Add(24 * time.Hour)
+		}
+		return sim.ExpectFurtherClearance(callsign, efcTime)
+	}
+
+	fields := strings.Split(strings.TrimPrefix(command, "HOLD"), "/")
+	if fields[0] == "" {
+		return ErrInvalidCommandParameter
+	}
+	turns, legLength := 0, float32(0)
+	for _, f := range fields[1:] {
+		switch f {
+		case "L":
+			turns = -1
+		case "R":
+			turns = 1
+		default:
+			if nm, err := strconv.ParseFloat(strings.TrimSuffix(f, "NM"), 32); err != nil || nm <= 0 {
+				return ErrInvalidCommandParameter
+			} else {
+				legLength = float32(nm)
+			}
+		}
+	}
+	return sim.AssignHold(callsign, fields[0], turns, legLength)
+}
@@ -0,0 +1,85 @@
+// intersections.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// Scenarios may allow departures to start their takeoff roll at an
+// intersection partway down the runway, leaving less of the runway
+// available. Each intersection is offered to the given fraction of a
+// runway's departures; those whose takeoff distance, with a margin that
+// is larger for heavies, exceeds the remaining length refuse it and use
+// the full length. Intersection departures first appear at the
+// intersection and, with less runway to work with, climb more slowly
+// until they are clear of the airport.
+
+type IntersectionDeparture struct {
+	Taxiway  string  `json:"taxiway"`
+	Fix      string  `json:"fix"`      // where the takeoff roll starts
+	Length   int     `json:"length"`   // remaining runway, in feet
+	Fraction float32 `json:"fraction"` // of departures that are offered it
+
+	location Point2LL
+}
+
+func (id *IntersectionDeparture) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if id.Taxiway == "" {
+		e.ErrorString("\"taxiway\" must be specified")
+	}
+	if loc, ok := sg.Locate(id.Fix); !ok {
+		e.ErrorString("unknown location \"%s\" in \"fix\"", id.Fix)
+	} else {
+		id.location = loc
+	}
+	if id.Length <= 0 {
+		e.ErrorString("\"length\" must be positive")
+	}
+	if id.Fraction <= 0 || id.Fraction > 1 {
+		e.ErrorString("\"fraction\" must be between 0 and 1")
+	}
+}
+
+const (
+	// Aircraft require their takeoff distance times this margin to
+	// accept an intersection departure.
+	intersectionTakeoffMargin      = 1.15
+	intersectionHeavyTakeoffMargin = 1.5
+	// Aircraft with just the required margin climb at this fraction of
+	// their usual rate; with twice the required length or more, they
+	// climb normally.
+	intersectionMinimumClimbFactor = 0.75
+	// Feet above the airport where intersection departures resume their
+	// usual climb rate.
+	intersectionInitialClimbHeight = 1500
+)
+
+// assignIntersectionDeparture randomly chooses one of the runway's
+// intersections for the departure; the aircraft takes it if the remaining
+// runway is long enough.
+func (sim *Sim) assignIntersectionDeparture(ac *Aircraft, ap *Airport, rwy *ScenarioGroupDepartureRunway) {
+	r := rand.Float32()
+	for _, id := range rwy.Intersections {
+		if r >= id.Fraction {
+			r -= id.Fraction
+			continue
+		}
+
+		margin := float32(intersectionTakeoffMargin)
+		if ac.Performance.WakeCategory() >= WakeHeavy {
+			margin = intersectionHeavyTakeoffMargin
+		}
+		required := margin * ac.Performance.Runway.Takeoff * KilometersToFeet
+		if float32(id.Length) < required {
+			lg.Printf("%s: unable intersection %s departure runway %s, %d' available, %.0f' required",
+				ac.Callsign, id.Taxiway, rwy.Runway, id.Length, required)
+			return
+		}
+
+		lg.Printf("%s: intersection %s departure runway %s", ac.Callsign, id.Taxiway, rwy.Runway)
+		ac.IntersectionDeparture = id.Taxiway
+		ac.Waypoints[0].Location = id.location
+		ac.InitialClimbFactor = lerp(clamp(float32(id.Length)/required-1, 0, 1), intersectionMinimumClimbFactor, 1)
+		ac.InitialClimbAltitude = ap.Elevation + intersectionInitialClimbHeight
+		return
+	}
+}
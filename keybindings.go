@@ -0,0 +1,182 @@
+// keybindings.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+)
+
+// Panes that respond to keyboard shortcuts describe them with KeyBindings,
+// which are used both to dispatch key presses and to generate the help
+// overlay that is shown when F1 is pressed; keeping the two together
+// ensures that the help stays accurate.
+
+type KeyBinding struct {
+	Key     Key
+	Control bool
+	// Keys describes how to trigger bindings that don't correspond to a
+	// single key press (e.g., mouse actions); when it's set, the binding
+	// is only listed in the help and Action is not used.
+	Keys        string
+	Description string
+	// Enabled, if non-nil, determines whether the binding currently
+	// applies; if not, a later binding for the same key may handle it.
+	Enabled func() bool
+	Action  func()
+}
+
+// PaneKeyBinder is implemented by Panes that have keyboard shortcuts.
+type PaneKeyBinder interface {
+	KeyBindings() []KeyBinding
+}
+
+var keyNames = [...]string{
+	KeyEnter:      "Enter",
+	KeyUpArrow:    "Up",
+	KeyDownArrow:  "Down",
+	KeyLeftArrow:  "Left",
+	KeyRightArrow: "Right",
+	KeyHome:       "Home",
+	KeyEnd:        "End",
+	KeyBackspace:  "Backspace",
+	KeyDelete:     "Delete",
+	KeyEscape:     "Escape",
+	KeyTab:        "Tab",
+	KeyPageUp:     "Page Up",
+	KeyPageDown:   "Page Down",
+	KeyShift:      "Shift",
+	KeyControl:    "Ctrl",
+	KeyAlt:        "Alt",
+	KeyF1:         "F1",
+	KeyF2:         "F2",
+	KeyF3:         "F3",
+	KeyF4:         "F4",
+	KeyF5:         "F5",
+	KeyF6:         "F6",
+	KeyF7:         "F7",
+	KeyF8:         "F8",
+	KeyF9:         "F9",
+	KeyF10:        "F10",
+	KeyF11:        "F11",
+	KeyF12:        "F12",
+}
+
+func (k Key) String() string {
+	if k < 0 || int(k) >= len(keyNames) {
+		return "(unknown key)"
+	}
+	return keyNames[k]
+}
+
+// KeyString returns a description of the keys that trigger the binding,
+// e.g. "Ctrl-F2".
+func (b KeyBinding) KeyString() string {
+	if b.Keys != "" {
+		return b.Keys
+	}
+	if b.Control {
+		return "Ctrl-" + b.Key.String()
+	}
+	return b.Key.String()
+}
+
+// DispatchKeyBindings runs the action of the first applicable binding for
+// each of the pressed keys. Shift-modified function keys are vice's
+// global shortcuts (see drawUI), so they're never passed along to panes.
+func DispatchKeyBindings(bindings []KeyBinding, keyboard *KeyboardState) {
+	control := keyboard.IsPressed(KeyControl)
+	shift := keyboard.IsPressed(KeyShift)
+	for key := range keyboard.Pressed {
+		if shift && key >= KeyF1 && key <= KeyF12 {
+			continue
+		}
+		for _, b := range bindings {
+			if b.Keys != "" || b.Action == nil || b.Key != key || (b.Control && !control) {
+				continue
+			}
+			if b.Enabled != nil && !b.Enabled() {
+				continue
+			}
+			b.Action()
+			break
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Help overlay
+
+var helpOverlay struct {
+	show bool
+}
+
+func helpOverlayToggle() {
+	helpOverlay.show = !helpOverlay.show
+	if helpOverlay.show {
+		announce("Showing keyboard shortcuts")
+	}
+}
+
+// helpOverlayDraw lists the pane's commands and keyboard shortcuts over
+// its upper-left corner.
+func helpOverlayDraw(pane Pane, ctx *PaneContext, cb *CommandBuffer) {
+	if !helpOverlay.show {
+		return
+	}
+
+	var bindings []KeyBinding
+	if kb, ok := pane.(PaneKeyBinder); ok {
+		bindings = kb.KeyBindings()
+	}
+
+	font := ui.font
+	keyWidth := 0
+	for _, b := range bindings {
+		w, _ := font.BoundText(b.KeyString(), 0)
+		keyWidth = max(keyWidth, w)
+	}
+
+	var keys, descriptions []string
+	keys = append(keys, pane.Name()+" commands (F1 to close)", "")
+	descriptions = append(descriptions, "", "")
+	if len(bindings) == 0 {
+		keys = append(keys, "No keyboard shortcuts")
+		descriptions = append(descriptions, "")
+	}
+	for _, b := range bindings {
+		keys = append(keys, b.KeyString())
+		descriptions = append(descriptions, b.Description)
+	}
+
+	const margin = 10
+	lineHeight := float32(font.size + 2)
+	height := lineHeight * float32(len(keys))
+	width := float32(keyWidth + 3*margin)
+	for _, d := range descriptions {
+		w, _ := font.BoundText(d, 0)
+		width = max(width, float32(keyWidth+3*margin+w))
+	}
+	titleWidth, _ := font.BoundText(keys[0], 0)
+	width = max(width, float32(2*margin+titleWidth))
+
+	ctx.SetWindowCoordinateMatrices(cb)
+	top := ctx.paneExtent.Height() - margin
+	x0, x1 := float32(margin), float32(margin)+width
+	y0, y1 := top-height-2*margin, top
+
+	trid := GetTrianglesDrawBuilder()
+	defer ReturnTrianglesDrawBuilder(trid)
+	trid.AddQuad([2]float32{x0, y0}, [2]float32{x1, y0}, [2]float32{x1, y1}, [2]float32{x0, y1})
+	cb.SetRGB(UIControlColor)
+	trid.GenerateCommands(cb)
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	style := TextStyle{Font: font, Color: UITextColor, LineSpacing: 2}
+	td.AddText(strings.Join(keys, "\n"), [2]float32{x0 + margin, y1 - margin}, style)
+	td.AddText(strings.Join(descriptions, "\n"),
+		[2]float32{x0 + float32(keyWidth+2*margin), y1 - margin}, style)
+	td.GenerateCommands(cb)
+}
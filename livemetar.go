@@ -0,0 +1,158 @@
+// livemetar.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rather than using the METARs that are made up from the scenario's wind
+// when the Sim starts, the Sim can use the current real-world weather:
+// METARs for the scenario's airports are fetched from the Aviation
+// Weather Center's data API every 10 minutes and the Sim's wind,
+// including gusts, is taken from the observation at the primary airport.
+// Requests are made in a separate goroutine; the results are picked up
+// in the Sim's regular updates. If a request fails, the previous METARs
+// (made up or real) are kept.
+
+const (
+	liveMETARURL      = "https://aviationweather.gov/api/data/metar?format=raw&ids="
+	liveMETARInterval = 10 * time.Minute
+)
+
+type liveMETARResult struct {
+	metars map[string]*METAR
+	err    error
+}
+
+// fetchLiveMETARs starts a request for the current METARs at the
+// scenario's airports.
+func (sim *Sim) fetchLiveMETARs() {
+	sim.lastMETARFetch = time.Now()
+	if sim.liveMETARs == nil {
+		sim.liveMETARs = make(chan liveMETARResult, 1)
+	}
+
+	airports := sim.Scenario.AllAirports()
+	go func() {
+		defer reportGoroutinePanic()
+		metars, err := FetchMETARs(airports)
+		sim.liveMETARs <- liveMETARResult{metars: metars, err: err}
+	}()
+}
+
+// updateLiveWeather is called periodically to start new requests for
+// METARs and to apply the ones that have arrived.
+func (sim *Sim) updateLiveWeather() {
+	if !sim.LiveWeather {
+		return
+	}
+
+	select {
+	case r := <-sim.liveMETARs:
+		if r.err != nil {
+			lg.Errorf("Unable to fetch METARs: %v", r.err)
+			return
+		}
+		for ap, m := range r.metars {
+			sim.METAR[ap] = m
+		}
+
+		ap := scenarioGroup.PrimaryAirport
+		if _, ok := r.metars[ap]; !ok {
+			if airports := SortedMapKeys(r.metars); len(airports) > 0 {
+				ap = airports[0]
+			}
+		}
+		if m, ok := r.metars[ap]; ok {
+			if w, ok := m.WindData(sim.Wind.Direction, scenarioGroup.MagneticVariation); ok {
+				sim.Wind = w
+				lg.Printf("%s: wind now %03d at %d gust %d", ap, w.Direction, w.Speed, w.Gust)
+			}
+		}
+
+	default:
+		if time.Since(sim.lastMETARFetch) >= liveMETARInterval {
+			sim.fetchLiveMETARs()
+		}
+	}
+}
+
+// FetchMETARs returns the most recent METARs for the given airports.
+func FetchMETARs(airports []string) (map[string]*METAR, error) {
+	if len(airports) == 0 {
+		return nil, nil
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(liveMETARURL + strings.Join(airports, ","))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", liveMETARURL, resp.Status)
+	}
+
+	metars := make(map[string]*METAR)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(strings.TrimPrefix(line, "METAR "), "SPECI ")
+		if line == "" {
+			continue
+		}
+		m, err := ParseMETAR(line)
+		if err != nil {
+			lg.Errorf("%s: %v", line, err)
+			continue
+		}
+		metars[m.AirportICAO] = m
+	}
+	return metars, scanner.Err()
+}
+
+// WindData returns the wind reported in the METAR. METARs give the wind
+// direction relative to true north; it is converted to magnetic using the
+// given magnetic variation, like headingp2ll. The given (magnetic)
+// direction is used for variable winds.
+func (m METAR) WindData(variableDirection int32, magneticVariation float32) (Wind, bool) {
+	w := strings.TrimSuffix(m.Wind, "KT")
+	if len(w) < 5 {
+		return Wind{}, false
+	}
+
+	var wind Wind
+	if strings.HasPrefix(w, "VRB") {
+		wind.Direction = variableDirection
+	} else if dir, err := strconv.Atoi(w[:3]); err == nil {
+		if dir != 0 { // calm winds are reported as 00000KT
+			wind.Direction = int32(mod(float32(dir)+magneticVariation+.5, 360))
+			if wind.Direction == 0 {
+				wind.Direction = 360
+			}
+		}
+	} else {
+		return Wind{}, false
+	}
+
+	spd, gst, _ := strings.Cut(w[3:], "G")
+	if s, err := strconv.Atoi(spd); err == nil {
+		wind.Speed = int32(s)
+	} else {
+		return Wind{}, false
+	}
+	if gst != "" {
+		if g, err := strconv.Atoi(gst); err == nil {
+			wind.Gust = int32(g)
+		}
+	}
+	return wind, true
+}
@@ -0,0 +1,115 @@
+// macros.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// The STARS pane can record sequences of aircraft commands as macros so
+// that instructions that are issued over and over (e.g., "D60 S210 EI22L"
+// to each arrival as it checks in) can be replayed with a single
+// keystroke. Recording is started with F12; each set of commands that is
+// then successfully sent to an aircraft is added to the macro, without
+// the aircraft's callsign. Pressing Alt and a digit saves the recording
+// to that slot, and later pressing Alt and the digit loads the macro
+// into the preview area so that clicking on an aircraft sends it.
+// Macros are saved separately for each scenario and can also be edited
+// in the settings window.
+
+// STARSMacros maps from macro slot (0-9) to the commands for one
+// scenario.
+type STARSMacros map[int]string
+
+// scenarioMacros returns the macros for the current scenario, creating
+// the map if necessary.
+func (sp *STARSPane) scenarioMacros() STARSMacros {
+	if sp.Macros == nil {
+		sp.Macros = make(map[string]STARSMacros)
+	}
+	name := ""
+	if sim != nil && sim.Scenario != nil {
+		name = sim.Scenario.Name()
+	}
+	m, ok := sp.Macros[name]
+	if !ok {
+		m = make(STARSMacros)
+		sp.Macros[name] = m
+	}
+	return m
+}
+
+// toggleMacroRecording starts recording a macro or discards the one
+// being recorded.
+func (sp *STARSPane) toggleMacroRecording() {
+	if sp.macroRecording != nil {
+		sp.macroRecording = nil
+		sp.previewAreaOutput = "MACRO CANCELED"
+	} else {
+		sp.macroRecording = []string{}
+		sp.previewAreaOutput = "MACRO RECORDING"
+	}
+}
+
+// recordMacroCommands adds the commands that were just sent to an
+// aircraft to the macro being recorded, if any.
+func (sp *STARSPane) recordMacroCommands(cmd string) {
+	if sp.macroRecording != nil {
+		sp.macroRecording = append(sp.macroRecording, strings.Fields(cmd)...)
+	}
+}
+
+// macroKey handles Alt and the given digit: it saves the macro being
+// recorded to the slot, or, if there isn't one, loads the macro in the
+// slot so that it is sent to the next aircraft that is clicked.
+func (sp *STARSPane) macroKey(slot int) {
+	macros := sp.scenarioMacros()
+
+	if sp.macroRecording != nil {
+		if len(sp.macroRecording) == 0 {
+			sp.previewAreaOutput = "MACRO EMPTY"
+		} else {
+			macros[slot] = strings.Join(sp.macroRecording, " ")
+			sp.previewAreaOutput = fmt.Sprintf("MACRO %d SAVED", slot)
+		}
+		sp.macroRecording = nil
+		return
+	}
+
+	if cmd, ok := macros[slot]; ok && cmd != "" {
+		sp.LoadCommands(cmd)
+	} else {
+		sp.previewAreaOutput = fmt.Sprintf("NO MACRO %d", slot)
+		globalConfig.Audio.PlaySound(AudioEventCommandError)
+	}
+}
+
+// LoadCommands puts the given aircraft commands in the preview area so
+// that they are sent to the next aircraft that is clicked.
+func (sp *STARSPane) LoadCommands(cmd string) {
+	sp.resetInputState()
+	sp.previewAreaInput = cmd
+}
+
+// drawMacrosUI draws the editor for the current scenario's macros in the
+// settings window.
+func (sp *STARSPane) drawMacrosUI() {
+	macros := sp.scenarioMacros()
+
+	imgui.Text("Alt-<digit> loads a macro; F12 starts recording one.")
+	for slot := 0; slot < 10; slot++ {
+		cmd := macros[slot]
+		if imgui.InputTextV(fmt.Sprintf("Alt-%d", slot), &cmd, imgui.InputTextFlagsCharsUppercase, nil) {
+			if cmd == "" {
+				delete(macros, slot)
+			} else {
+				macros[slot] = cmd
+			}
+		}
+	}
+}
@@ -44,12 +44,18 @@ var (
 	//go:embed resources/version.txt
 	buildVersion string
 
-	// Command-line options are only used for developer features.
+	// Command-line options are mostly used for developer features.
 	cpuprofile       = flag.String("cpuprofile", "", "write CPU profile to file")
 	memprofile       = flag.String("memprofile", "", "write memory profile to this file")
 	devmode          = flag.Bool("devmode", false, "developer mode")
 	scenarioFilename = flag.String("scenario", "", "filename of JSON file with a scenario definition")
 	videoMapFilename = flag.String("videomap", "", "filename of JSON file with video map definitions")
+	adsbURL          = flag.String("adsb", "", "URL of a dump1090/readsb aircraft.json to inject live traffic from (devmode only)")
+	serve            = flag.Bool("serve", false, "run the simulation without a GUI and host it for multiplayer clients")
+	serveGroup       = flag.String("servegroup", "", "scenario group to run with -serve")
+	serveScenario    = flag.String("servescenario", "", "scenario to run with -serve")
+	serveRemote      = flag.Bool("serveremote", false, "accept multiplayer connections from other computers with -serve")
+	cifpFilename     = flag.String("cifp", "", "filename of FAA CIFP (ARINC 424) file with SIDs, STARs, and approaches")
 )
 
 func init() {
@@ -61,12 +67,20 @@ func init() {
 }
 
 func main() {
+	flag.Parse()
+	if *serve {
+		runHeadless()
+		return
+	}
+
 	// Catch any panics so that we can put up a dialog box and hopefully
 	// get a bug report.
 	var context *imgui.Context
 	defer func() {
 		if err := recover(); err != nil {
-			lg.Errorf("Panic stack: %s", string(debug.Stack()))
+			stack := debug.Stack()
+			lg.Errorf("Panic stack: %s", string(stack))
+			reportPanic(err, stack)
 			ShowFatalErrorDialog("Unfortunately an unexpected error has occurred and vice is unable to recover.\n"+
 				"Apologies! Please do file a bug and include the vice.log file for this session\nso that "+
 				"this bug can be fixed.\n\nError: %v", err)
@@ -88,7 +102,6 @@ func main() {
 	///////////////////////////////////////////////////////////////////////////
 	// Global initialization and set up. Note that there are some subtle
 	// inter-dependencies in the following; the order is carefully crafted.
-	flag.Parse()
 
 	// Make this early so things can subscribe during their initalization
 	eventStream = NewEventStream()
@@ -96,6 +109,12 @@ func main() {
 	// Initialize the logging system first and foremost.
 	lg = NewLogger(true, *devmode, 50000)
 
+	// If an update was downloaded last time, start installing it.
+	if installStagedUpdate() {
+		lg.SaveLogs()
+		os.Exit(0)
+	}
+
 	if *cpuprofile != "" {
 		if f, err := os.Create(*cpuprofile); err != nil {
 			lg.Errorf("%s: unable to create CPU profile file: %v", *cpuprofile, err)
@@ -116,6 +135,11 @@ func main() {
 	}
 
 	LoadOrMakeDefaultConfig()
+	imgui.LoadIniSettingsFromMemory(globalConfig.ImGuiSettings)
+
+	if err = globalConfig.Audio.LoadCustomSoundEffects(); err != nil {
+		lg.Errorf("Unable to load custom sound effects: %v", err)
+	}
 
 	database = InitializeStaticDatabase()
 
@@ -123,17 +147,13 @@ func main() {
 	var e ErrorLogger
 	scenarioGroups = LoadScenarioGroups(&e)
 	if e.HaveErrors() {
+		// Keep going so that the errors can be reported in the UI once
+		// it's up; the scenario groups with errors have been skipped.
 		e.PrintErrors()
-		os.Exit(1)
+		lg.Errorf("Errors loading scenarios and video maps:\n%s", e.String())
 	}
 
-	// Use the last scenario, if available.
-	if s, ok := scenarioGroups[globalConfig.LastScenarioGroup]; ok {
-		scenarioGroup = s
-	} else if len(scenarioGroups) > 0 {
-		// Otherwise take the first one alphabetically.
-		scenarioGroup = scenarioGroups[SortedMapKeys(scenarioGroups)[0]]
-	}
+	selectInitialScenarioGroup()
 
 	multisample := runtime.GOOS != "darwin"
 	platform, err = NewGLFWPlatform(imgui.CurrentIO(), globalConfig.InitialWindowSize,
@@ -154,10 +174,17 @@ func main() {
 
 	uiInit(renderer)
 
+	if e.HaveErrors() {
+		uiShowModalDialog(NewModalDialogBox(&ResourceErrorModalClient{errors: e.String()}), true)
+	}
+
 	sim = &Sim{}
 
 	globalConfig.Activate()
 
+	apiServerUpdate()
+	multiplayerServerUpdate()
+
 	///////////////////////////////////////////////////////////////////////////
 	// Main event / rendering loop
 	lg.Printf("Starting main loop")
@@ -169,6 +196,7 @@ func main() {
 
 		// Inform imgui about input events from the user.
 		platform.ProcessEvents()
+		sim.CheckAutoPause(platform)
 
 		stats.redraws++
 
@@ -183,6 +211,12 @@ func main() {
 		// network; a synopsis of changes to aircraft is then passed along
 		// to the window panes.
 		sim.GetUpdates()
+		if apiServer != nil {
+			apiServer.Process()
+		}
+		if multiplayerServer != nil {
+			multiplayerServer.Process()
+		}
 
 		platform.NewFrame()
 		imgui.NewFrame()
@@ -236,6 +270,20 @@ func main() {
 		}
 	}
 
+	if apiServer != nil {
+		apiServer.Stop()
+	}
+	if multiplayerServer != nil {
+		multiplayerServer.Stop()
+	}
+
+	reportSession()
+
+	// Make sure that any video being recorded is finalized.
+	if videoCapture.recorder != nil {
+		videoCapture.recorder.Close()
+	}
+
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
 		if err != nil {
@@ -0,0 +1,192 @@
+// msaw.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// Minimum safe altitude warnings (MSAW): scenario groups may specify
+// minimum vectoring altitude (MVA) areas and the Sim checks tracked IFR
+// aircraft against them with each track update. An alert is raised when
+// an aircraft is below the MVA for its position, unless it is
+// established on an approach or is departing from or landing at a
+// nearby airport; the STARS pane then shows "LA" in its datablock and
+// sounds the MSAW alarm.
+//
+// Scenario groups may also give minimum enroute altitudes (MEAs) for
+// airway segments outside of the MVA areas. When altitude validation is
+// enabled, altitude assignments below the MVA or MEA at the aircraft's
+// position are rejected unless the user overrides the warning; either
+// way, assigning such an altitude is scored (see scoring.go).
+
+// Aircraft within this many nm of their departure or arrival airport
+// don't trigger alerts.
+const msawAirportRadius = 5
+
+// MEAs apply within this many nm of the airway's centerline.
+const meaHalfWidth = 4
+
+// MVA is an area with a minimum vectoring altitude.
+type MVA struct {
+	Altitude int        `json:"altitude"`
+	Boundary []Point2LL `json:"boundary"`
+}
+
+func (m *MVA) PostDeserialize(e *ErrorLogger) {
+	if m.Altitude <= 0 {
+		e.ErrorString("\"altitude\" must be specified")
+	}
+	if len(m.Boundary) < 3 {
+		e.ErrorString("\"boundary\" must have at least three points")
+	} else if m.Boundary[0] != m.Boundary[len(m.Boundary)-1] {
+		// Close the polygon for PointInPolygon.
+		m.Boundary = append(m.Boundary, m.Boundary[0])
+	}
+}
+
+// MVAAt returns the minimum vectoring altitude at the given position; if
+// MVA areas overlap, the highest altitude is returned. It returns false
+// if the position isn't inside any MVA area.
+func (sg *ScenarioGroup) MVAAt(p Point2LL) (int, bool) {
+	alt, found := 0, false
+	for _, m := range sg.MVAs {
+		if m.Altitude > alt && PointInPolygon(p, m.Boundary) {
+			alt, found = m.Altitude, true
+		}
+	}
+	return alt, found
+}
+
+// MEA is a minimum enroute altitude for the airway segment between two
+// fixes.
+type MEA struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Altitude int    `json:"altitude"`
+
+	segment [2]Point2LL
+}
+
+func (m *MEA) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if m.Altitude <= 0 {
+		e.ErrorString("\"altitude\" must be specified")
+	}
+	for i, fix := range []string{m.From, m.To} {
+		if p, ok := sg.Locate(fix); !ok {
+			e.ErrorString("unable to locate fix \"%s\"", fix)
+		} else {
+			m.segment[i] = p
+		}
+	}
+}
+
+// MEAAt returns the minimum enroute altitude at the given position; if
+// it is along multiple airway segments, the highest altitude is
+// returned. It returns false if the position isn't along any of them.
+func (sg *ScenarioGroup) MEAAt(p Point2LL) (int, bool) {
+	alt, found := 0, false
+	pnm := ll2nm(p)
+	for _, m := range sg.MEAs {
+		if m.Altitude <= alt {
+			continue
+		}
+		if PointSegmentDistance(pnm, ll2nm(m.segment[0]), ll2nm(m.segment[1])) < meaHalfWidth {
+			alt, found = m.Altitude, true
+		}
+	}
+	return alt, found
+}
+
+// MinimumAltitude returns the minimum altitude at the given position
+// and whether it is an "MVA" or an "MEA"; the MVA takes precedence. It
+// returns false if neither applies.
+func (sg *ScenarioGroup) MinimumAltitude(p Point2LL) (int, string, bool) {
+	if alt, ok := sg.MVAAt(p); ok {
+		return alt, "MVA", true
+	} else if alt, ok := sg.MEAAt(p); ok {
+		return alt, "MEA", true
+	}
+	return 0, "", false
+}
+
+// minimumAltitudeExempt returns true if the aircraft at the given
+// position isn't subject to the minimum altitudes: it isn't IFR, is on
+// final or the runway, or is near its departure or arrival airport.
+func minimumAltitudeExempt(ac *Aircraft, pos Point2LL) bool {
+	if ac.FlightPlan == nil || ac.FlightPlan.Rules != IFR || ac.OnFinal || ac.OnRunway() {
+		return true
+	}
+	for _, ap := range []string{ac.FlightPlan.DepartureAirport, ac.FlightPlan.ArrivalAirport} {
+		if p, ok := scenarioGroup.Locate(ap); ok && nmdistance2ll(pos, p) < msawAirportRadius {
+			return true
+		}
+	}
+	return false
+}
+
+// msawAlert returns true if the aircraft is below the MVA and not exempt
+// from alerts.
+func msawAlert(ac *Aircraft) bool {
+	pos := ac.TrackPosition()
+	if ac.TrackingController == "" || minimumAltitudeExempt(ac, pos) {
+		return false
+	}
+
+	mva, ok := scenarioGroup.MVAAt(pos)
+	return ok && ac.TrackAltitude() < mva
+}
+
+// checkAssignedAltitude checks an altitude that the user is about to
+// assign against the minimum altitude at the aircraft's position. If it
+// is below it, the assignment is scored and, if altitude validation is
+// enabled and the user hasn't overridden the warning, a
+// MinimumAltitudeError is returned.
+func (sim *Sim) checkAssignedAltitude(callsign string, altitude int, override bool) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok || minimumAltitudeExempt(ac, ac.Position) {
+		return nil
+	}
+	min, kind, ok := scenarioGroup.MinimumAltitude(ac.Position)
+	if !ok || altitude >= min || altitude >= int(ac.Altitude) {
+		// Above the minimum, or not a descent below it.
+		return nil
+	}
+
+	if sim.ValidateAltitudes && !override {
+		return &MinimumAltitudeError{Kind: kind, Altitude: altitude, Minimum: min}
+	}
+	if sim.scorer != nil && ac.TrackingController == sim.Scenario.Callsign {
+		sim.addScoredError(ScoreMinimumAltitude, ac, "%s assigned %d', %s %d'", callsign, altitude, kind, min)
+	}
+	return nil
+}
+
+// checkMSAW checks the aircraft against the MVAs; it should be called
+// after each track update.
+func (sim *Sim) checkMSAW() {
+	if len(scenarioGroup.MVAs) == 0 {
+		return
+	}
+
+	active := make(map[string]interface{})
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if !ac.HaveTrack() || ac.Mode != Charlie || !msawAlert(ac) {
+			continue
+		}
+
+		active[callsign] = nil
+		if _, ok := sim.msawAlerts[callsign]; !ok {
+			mva, _ := scenarioGroup.MVAAt(ac.TrackPosition())
+			lg.Printf("%s: MSAW alert: at %d', MVA %d'", callsign, ac.TrackAltitude(), mva)
+			eventStream.Post(&MSAWEvent{ac: ac})
+		}
+	}
+	sim.msawAlerts = active
+}
+
+// MSAWAlert returns true if there is currently an MSAW alert for the
+// aircraft.
+func (sim *Sim) MSAWAlert(callsign string) bool {
+	_, ok := sim.msawAlerts[callsign]
+	return ok
+}
@@ -0,0 +1,1743 @@
+// multiplayer.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Multiplayer sessions let additional controllers connect over TCP to a
+// simulation that is running in another instance of vice, either to
+// work an adjacent position in the same scenario group (e.g., JFK_APP
+// while the host works LGA_APP) or so that an instructor can watch and
+// work alongside a trainee. The instance that is running the simulation
+// acts as the server; it runs the Sim as usual and sends each remote
+// controller updates to the aircraft once a second. Clients are thin:
+// their Sim has no aircraft of its own but mirrors what the server sends
+// and forwards commands, track operations, and handoffs to it.
+//
+// So that sessions with many aircraft work over typical home upload
+// bandwidth, updates are deltas: an aircraft is sent in full the first
+// time a client sees it and after that only the fields that have changed
+// since the previous update are sent. Further, clients tell the server
+// the areas that their scopes are showing and aircraft well outside of
+// them aren't sent unless the controller is involved with them.
+//
+// Handoffs to a position that is staffed by a person, whether the host
+// or a remote controller, aren't accepted automatically after a delay
+// as they are for virtual controllers; they wait for that controller to
+// accept them. Pilot transmissions are sent to the remote controller who
+// most recently issued commands to the aircraft.
+//
+// Both sides must have the same scenario group definitions. Each
+// position may only be staffed by one person.
+//
+// The server only accepts connections from the local machine unless the
+// host allows connections from other computers.
+//
+// Remote participants must give the host's join code to connect and, if
+// the host has asked to approve each of them, wait in the lobby until
+// the host does so; the host may assign them to a different position
+// than the one they asked for. Each participant has a role:
+// controllers staff a position and can't issue instructions to aircraft
+// that another controller is tracking; instructors may staff a position
+// or not, may issue instructions to any aircraft, and may pause the
+// simulation and change its rate; observers can only watch.
+//
+// Messages are JSON objects, one per line: clients send
+// MultiplayerRequests and the server sends MultiplayerMessages, which
+// are either replies to requests, aircraft updates, or pilot
+// transmissions. Aircraft are sent as AircraftFields, with one entry for
+// each of the Aircraft's JSON-encoded fields. Clients don't wait for the
+// replies to their requests; errors in them are posted as
+// MultiplayerErrorEvents once they arrive.
+
+var (
+	ErrMultiplayerTimeout         = errors.New("Timed out waiting for the multiplayer server")
+	ErrMultiplayerNoSimulation    = errors.New("No simulation is running on the server")
+	ErrMultiplayerNotSignedOn     = errors.New("Not signed on to the multiplayer server")
+	ErrMultiplayerPositionStaffed = errors.New("That position is already staffed")
+	ErrMultiplayerInvalidRequest  = errors.New("Invalid multiplayer request")
+	ErrMultiplayerDisconnected    = errors.New("Disconnected from the multiplayer server")
+	ErrMultiplayerJoinCode        = errors.New("Incorrect join code")
+	ErrMultiplayerTooManyAttempts = errors.New("Too many incorrect join codes; try again later")
+	ErrMultiplayerInvalidRole     = errors.New("Invalid multiplayer role")
+	ErrMultiplayerNotPermitted    = errors.New("Not permitted in your multiplayer role")
+	ErrMultiplayerDenied          = errors.New("The host declined the request to join")
+	ErrMultiplayerConnecting      = errors.New("Connecting; the host may need to approve the request...")
+)
+
+const (
+	MultiplayerRoleController = "controller"
+	MultiplayerRoleInstructor = "instructor"
+	MultiplayerRoleObserver   = "observer"
+)
+
+var MultiplayerRoles = []string{MultiplayerRoleController, MultiplayerRoleInstructor, MultiplayerRoleObserver}
+
+const (
+	multiplayerTimeout = 5 * time.Second
+	// How long clients wait for the host to approve them.
+	multiplayerApprovalTimeout = 5 * time.Minute
+	multiplayerUpdateInterval  = time.Second
+	// Aircraft are sent to clients if they are within this multiple of
+	// the range of one of the client's scopes (plus a few miles), so that
+	// they're already there if the scope is panned a little.
+	multiplayerInterestMargin = 1.5
+	// Maximum sizes in bytes of the requests that the server accepts and
+	// of the messages that clients accept.
+	multiplayerMaxRequestSize = 64 * 1024
+	multiplayerMaxMessageSize = 64 * 1024 * 1024
+	// Clients are disconnected after giving an incorrect join code; after
+	// this many incorrect codes from the same address within the window,
+	// further attempts from it are refused without checking the code.
+	multiplayerMaxJoinAttempts   = 5
+	multiplayerJoinAttemptWindow = time.Minute
+)
+
+type MultiplayerRequest struct {
+	Id int `json:"id"`
+	// signon, commands, track, drop, handoff, accept, cancel_handoff,
+	// reject_handoff, point_out, push_strip, scratchpad, temporary_altitude,
+	// squawk, squawk_automatic, amend, vectors, delete, pilot_reply,
+	// interest, ping, pause, sim_rate
+	Type       string                `json:"type"`
+	Callsign   string                `json:"callsign,omitempty"`
+	Controller string                `json:"controller,omitempty"`
+	Commands   string                `json:"commands,omitempty"`
+	Interest   []MultiplayerInterest `json:"interest,omitempty"`
+
+	// Arguments for the other track operations
+	Scratchpad string      `json:"scratchpad,omitempty"`
+	Altitude   int         `json:"altitude,omitempty"`
+	Squawk     Squawk      `json:"squawk,omitempty"`
+	FlightPlan *FlightPlan `json:"flight_plan,omitempty"`
+	Route      []Point2LL  `json:"route,omitempty"`
+	RequestId  int         `json:"request_id,omitempty"`
+	Reply      PilotReply  `json:"reply,omitempty"`
+
+	// Sign on
+	JoinCode string `json:"join_code,omitempty"`
+	Role     string `json:"role,omitempty"`
+
+	// Instructors' simulation controls
+	Paused  bool    `json:"paused,omitempty"`
+	SimRate float32 `json:"sim_rate,omitempty"`
+}
+
+// MultiplayerInterest is an area that one of a client's scopes is
+// showing.
+type MultiplayerInterest struct {
+	Center Point2LL `json:"center"`
+	Range  float32  `json:"range"`
+}
+
+type MultiplayerMessage struct {
+	Type string `json:"type"` // reply, update, transmission
+
+	// Replies
+	Id            int               `json:"id,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Remaining     []string          `json:"remaining,omitempty"`
+	ScenarioGroup string            `json:"scenario_group,omitempty"`
+	Scenario      string            `json:"scenario,omitempty"`
+	METAR         map[string]*METAR `json:"metar,omitempty"`
+	// The Sim's current wind and precipitation, in both sign-on replies
+	// and updates.
+	Wind          Wind                `json:"wind"`
+	Precipitation []PrecipitationCell `json:"precipitation,omitempty"`
+	// The position the client was signed on to, which the host may
+	// have changed from the one requested.
+	Position string `json:"position,omitempty"`
+
+	// Updates
+	Time    time.Time `json:"time"`
+	Paused  bool      `json:"paused,omitempty"`
+	SimRate float32   `json:"sim_rate,omitempty"`
+	// Aircraft that are new to the client, with all of their fields, and
+	// ones that have changed, with just the changed fields.
+	Aircraft map[string]AircraftFields `json:"aircraft,omitempty"`
+	Removed  []string                  `json:"removed,omitempty"`
+	// Pending requests from the client's aircraft.
+	PilotRequests []*PilotRequest `json:"pilot_requests,omitempty"`
+
+	// Transmissions
+	Callsign string `json:"callsign,omitempty"`
+	Message  string `json:"message,omitempty"`
+
+	// When the message was received, on the client.
+	received time.Time
+}
+
+// multiplayerErrors are errors that clients may want to compare
+// against; errors from the server that match one of them are returned as
+// that error so that the client handles them as it would locally.
+var multiplayerErrors = []error{
+	ErrNoAircraftForCallsign, ErrOtherControllerHasTrack, ErrNotBeingHandedOffToMe, ErrNoController,
+	ErrUnableCommand, ErrInvalidCommandSyntax, ErrInvalidCommandParameter, ErrUnknownFix,
+	ErrUnknownApproach, ErrClearedForUnexpectedApproach, ErrUnknownRunway, ErrMultiplayerNoSimulation,
+	ErrMultiplayerNotSignedOn, ErrMultiplayerPositionStaffed, ErrMultiplayerInvalidRequest,
+	ErrMultiplayerJoinCode, ErrMultiplayerTooManyAttempts, ErrMultiplayerInvalidRole, ErrMultiplayerNotPermitted, ErrMultiplayerDenied,
+}
+
+func multiplayerError(s string) error {
+	for _, err := range multiplayerErrors {
+		if err.Error() == s {
+			return err
+		}
+	}
+	// So that the user can override it on the client as well.
+	var mae MinimumAltitudeError
+	if _, err := fmt.Sscanf(s, "%d is below the %s of %d", &mae.Altitude, &mae.Kind, &mae.Minimum); err == nil &&
+		mae.Error() == s {
+		return &mae
+	}
+	return errors.New(s)
+}
+
+// AircraftFields holds an Aircraft's fields, encoded as JSON, keyed by
+// field name.
+type AircraftFields map[string]json.RawMessage
+
+func MarshalAircraftFields(ac *Aircraft) (AircraftFields, error) {
+	b, err := json.Marshal(ac)
+	if err != nil {
+		return nil, err
+	}
+	var f AircraftFields
+	err = json.Unmarshal(b, &f)
+	return f, err
+}
+
+// Changed returns the names of the fields that are different in prev.
+func (f AircraftFields) Changed(prev AircraftFields) []string {
+	var changed []string
+	for name, v := range f {
+		if pv, ok := prev[name]; !ok || !bytes.Equal(v, pv) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// Subset returns just the given fields.
+func (f AircraftFields) Subset(names []string) AircraftFields {
+	sub := make(AircraftFields)
+	for _, name := range names {
+		sub[name] = f[name]
+	}
+	return sub
+}
+
+// Merge updates f with the fields in delta.
+func (f AircraftFields) Merge(delta AircraftFields) {
+	for name, v := range delta {
+		f[name] = v
+	}
+}
+
+// Aircraft returns a new Aircraft with the fields' values.
+func (f AircraftFields) Aircraft() (*Aircraft, error) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	ac := &Aircraft{}
+	err = json.Unmarshal(b, ac)
+	return ac, err
+}
+
+///////////////////////////////////////////////////////////////////////////
+// MultiplayerServer
+
+type MultiplayerServer struct {
+	listener   net.Listener
+	requests   chan func()
+	done       chan interface{}
+	eventsId   EventSubscriberId
+	scenario   *Scenario
+	lastUpdate time.Time
+
+	// The following are only accessed from the main thread.
+	clients map[*multiplayerConnection]interface{}
+	// The remote controller that most recently sent commands to each
+	// aircraft; the pilot's transmissions go to them.
+	commanded map[string]*multiplayerConnection
+	// Each aircraft's fields as of the last update, for finding the
+	// ones that have changed.
+	fields map[string]AircraftFields
+	// Sign-on requests that are waiting for the host's approval.
+	joinRequests []*multiplayerJoinRequest
+	lobbyShown   bool
+	// When incorrect join codes were given, by host address.
+	failedJoins map[string][]time.Time
+}
+
+type multiplayerConnection struct {
+	conn     net.Conn
+	signedOn bool
+	role     string
+	position string // empty for observers and instructors without one
+	send     chan []byte
+
+	// The following are only accessed from the main thread.
+	// The areas shown on the client's scopes; if empty, all aircraft
+	// are sent.
+	interest []MultiplayerInterest
+	// Aircraft that the client has been sent and is up to date with as
+	// of the last update.
+	known map[string]interface{}
+}
+
+// interested returns true if the aircraft should be sent to the client.
+func (c *multiplayerConnection) interested(ac *Aircraft, commanded bool) bool {
+	if len(c.interest) == 0 || commanded {
+		return true
+	}
+	if c.position != "" && (ac.TrackingController == c.position ||
+		ac.InboundHandoffController == c.position || ac.OutboundHandoffController == c.position) {
+		return true
+	}
+	for _, in := range c.interest {
+		if nmdistance2ll(ac.Position, in.Center) < multiplayerInterestMargin*in.Range+5 {
+			return true
+		}
+	}
+	return false
+}
+
+// multiplayerJoinRequest is a sign-on request that is waiting for the
+// host's approval; the reply to it is sent once the host decides.
+type multiplayerJoinRequest struct {
+	c        *multiplayerConnection
+	id       int
+	role     string
+	position string // requested position
+}
+
+// permitted returns an error if the client's role doesn't allow it to
+// make the given request.
+func (c *multiplayerConnection) permitted(req MultiplayerRequest) error {
+	switch req.Type {
+	case "interest", "ping":
+		return nil
+	case "pause", "sim_rate":
+		if c.role != MultiplayerRoleInstructor {
+			return ErrMultiplayerNotPermitted
+		}
+	case "commands", "vectors", "delete", "pilot_reply":
+		if c.role == MultiplayerRoleObserver {
+			return ErrMultiplayerNotPermitted
+		}
+		if ac, ok := sim.Aircraft[req.Callsign]; ok {
+			return c.mayCommand(ac)
+		}
+	default:
+		// Track operations and handoffs require a position.
+		if c.position == "" {
+			return ErrMultiplayerNotPermitted
+		}
+	}
+	return nil
+}
+
+// mayCommand returns an error if the client may not issue instructions
+// to the aircraft.
+func (c *multiplayerConnection) mayCommand(ac *Aircraft) error {
+	if c.role == MultiplayerRoleController && ac.TrackingController != "" &&
+		ac.TrackingController != c.position && ac.InboundHandoffController != c.position {
+		return ErrOtherControllerHasTrack
+	}
+	return nil
+}
+
+// newMultiplayerJoinCode returns a random join code.
+func newMultiplayerJoinCode() string {
+	// No 0/O or 1/I, which are easily confused.
+	const chars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 6)
+	if _, err := crand.Read(b); err != nil {
+		lg.Errorf("Unable to generate join code: %v", err)
+	}
+	for i := range b {
+		b[i] = chars[int(b[i])%len(chars)]
+	}
+	return string(b)
+}
+
+// StartMultiplayerServer starts listening for remote controllers on the
+// given port, on all network interfaces if allowRemote is set and
+// otherwise only on localhost.
+func StartMultiplayerServer(port int, allowRemote bool) (*MultiplayerServer, error) {
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	if allowRemote {
+		address = fmt.Sprintf(":%d", port)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if globalConfig.MultiplayerJoinCode == "" {
+		globalConfig.MultiplayerJoinCode = newMultiplayerJoinCode()
+	}
+
+	s := &MultiplayerServer{
+		listener:  listener,
+		requests:  make(chan func(), 64),
+		done:      make(chan interface{}),
+		eventsId:  eventStream.Subscribe(),
+		scenario:  sim.Scenario,
+		clients:   make(map[*multiplayerConnection]interface{}),
+		commanded: make(map[string]*multiplayerConnection),
+		fields:    make(map[string]AircraftFields),
+
+		failedJoins: make(map[string][]time.Time),
+	}
+
+	go func() {
+		defer reportGoroutinePanic()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-s.done:
+				default:
+					lg.Errorf("Multiplayer server: %v", err)
+				}
+				return
+			}
+			lg.Printf("Multiplayer server: connection from %s", conn.RemoteAddr())
+
+			c := &multiplayerConnection{
+				conn:  conn,
+				send:  make(chan []byte, 64),
+				known: make(map[string]interface{}),
+			}
+			if !s.queue(func() { s.clients[c] = nil }) {
+				conn.Close()
+				return
+			}
+			go c.write()
+			go s.read(c)
+		}
+	}()
+
+	lg.Printf("Multiplayer server listening on %s", listener.Addr())
+	return s, nil
+}
+
+func (s *MultiplayerServer) Stop() {
+	close(s.done)
+	s.listener.Close()
+	eventStream.Unsubscribe(s.eventsId)
+	for c := range s.clients {
+		s.disconnect(c)
+	}
+}
+
+// queue adds f to the requests to be run on the main thread. It returns
+// false if the server has been stopped.
+func (s *MultiplayerServer) queue(f func()) bool {
+	select {
+	case s.requests <- f:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *MultiplayerServer) read(c *multiplayerConnection) {
+	defer reportGoroutinePanic()
+	sc := bufio.NewScanner(c.conn)
+	sc.Buffer(make([]byte, 4096), multiplayerMaxRequestSize)
+	for sc.Scan() {
+		var req MultiplayerRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			lg.Printf("Multiplayer server: %s: %v", c.conn.RemoteAddr(), err)
+			break
+		}
+		if !s.queue(func() { s.handle(c, req) }) {
+			return
+		}
+	}
+	if err := sc.Err(); err != nil {
+		lg.Printf("Multiplayer server: %s: %v", c.conn.RemoteAddr(), err)
+	}
+	s.queue(func() { s.disconnect(c) })
+}
+
+func (c *multiplayerConnection) write() {
+	defer reportGoroutinePanic()
+	for b := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(multiplayerTimeout))
+		if _, err := c.conn.Write(b); err != nil {
+			lg.Printf("Multiplayer server: %s: %v", c.conn.RemoteAddr(), err)
+			c.conn.Close()
+			// Keep draining the channel until it is closed.
+		}
+	}
+	c.conn.Close()
+}
+
+// send queues the message to be sent to the client. It must be called
+// from the main thread.
+func (s *MultiplayerServer) send(c *multiplayerConnection, msg MultiplayerMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		lg.Errorf("Multiplayer server: %v", err)
+		return
+	}
+	s.sendBytes(c, b)
+}
+
+func (s *MultiplayerServer) sendBytes(c *multiplayerConnection, b []byte) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- append(b, '\n'):
+	default:
+		lg.Printf("Multiplayer server: %s isn't keeping up; disconnecting", c.conn.RemoteAddr())
+		s.disconnect(c)
+	}
+}
+
+func (s *MultiplayerServer) disconnect(c *multiplayerConnection) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	delete(s.clients, c)
+	// The writer closes the connection once it has sent what has
+	// already been queued.
+	close(c.send)
+
+	s.joinRequests = FilterSlice(s.joinRequests, func(jr *multiplayerJoinRequest) bool { return jr.c != c })
+
+	for callsign, cc := range s.commanded {
+		if cc == c {
+			delete(s.commanded, callsign)
+		}
+	}
+
+	if c.signedOn {
+		lg.Printf("Multiplayer server: %s (%s) signed off", c.conn.RemoteAddr(), c.role)
+	}
+	if c.position != "" {
+		// Handoffs to the controller can no longer be accepted, so
+		// return them to the tracking controller.
+		for _, ac := range sim.Aircraft {
+			if ac.InboundHandoffController == c.position {
+				ac.InboundHandoffController = ""
+				if ac.OutboundHandoffController == c.position {
+					ac.OutboundHandoffController = ""
+				}
+				eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+			}
+		}
+	}
+}
+
+// Staffed returns true if a remote controller has signed on to the given
+// position.
+func (s *MultiplayerServer) Staffed(position string) bool {
+	for c := range s.clients {
+		if c.signedOn && c.position != "" && c.position == position {
+			return true
+		}
+	}
+	return false
+}
+
+// MultiplayerParticipant describes a remote participant for the host.
+type MultiplayerParticipant struct {
+	Address  string `json:"address"`
+	Role     string `json:"role"`
+	Position string `json:"position,omitempty"`
+	// Set if the participant is waiting for the host's approval; Position
+	// is then the one they asked for.
+	Waiting bool `json:"waiting,omitempty"`
+}
+
+func (p MultiplayerParticipant) String() string {
+	if p.Position != "" {
+		return p.Position + " (" + p.Role + ")"
+	}
+	return p.Address + " (" + p.Role + ")"
+}
+
+// Participants returns the remote participants that are signed on or
+// waiting for approval, sorted by address.
+func (s *MultiplayerServer) Participants() []MultiplayerParticipant {
+	var p []MultiplayerParticipant
+	for c := range s.clients {
+		if c.signedOn {
+			p = append(p, MultiplayerParticipant{
+				Address:  c.conn.RemoteAddr().String(),
+				Role:     c.role,
+				Position: c.position,
+			})
+		}
+	}
+	for _, jr := range s.joinRequests {
+		p = append(p, MultiplayerParticipant{
+			Address:  jr.c.conn.RemoteAddr().String(),
+			Role:     jr.role,
+			Position: jr.position,
+			Waiting:  true,
+		})
+	}
+	sort.Slice(p, func(i, j int) bool { return p[i].Address < p[j].Address })
+	return p
+}
+
+// JoinRequest returns the pending join request from the given address,
+// if any.
+func (s *MultiplayerServer) JoinRequest(address string) *multiplayerJoinRequest {
+	if i := FindIf(s.joinRequests, func(jr *multiplayerJoinRequest) bool {
+		return jr.c.conn.RemoteAddr().String() == address
+	}); i != -1 {
+		return s.joinRequests[i]
+	}
+	return nil
+}
+
+// Kick disconnects the participant at the given address. It returns
+// false if there is no such participant.
+func (s *MultiplayerServer) Kick(address string) bool {
+	for c := range s.clients {
+		if c.conn.RemoteAddr().String() == address {
+			lg.Printf("Multiplayer server: disconnecting %s", address)
+			s.disconnect(c)
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignOn returns the callsign of the position that a participant
+// with the given role would be signed on to if they requested the given
+// position, or an error if they can't be.
+func (s *MultiplayerServer) checkSignOn(role string, position string) (string, error) {
+	if sim.Scenario == nil {
+		return "", ErrMultiplayerNoSimulation
+	}
+	switch role {
+	case MultiplayerRoleObserver:
+		return "", nil
+	case MultiplayerRoleInstructor:
+		if position == "" {
+			return "", nil
+		}
+	case MultiplayerRoleController:
+	default:
+		return "", ErrMultiplayerInvalidRole
+	}
+
+	ctrl := sim.GetController(position)
+	if ctrl == nil {
+		return "", ErrNoController
+	}
+	// When vice is running headless, no one is working the scenario's
+	// position locally.
+	if (ctrl.Callsign == sim.Scenario.Callsign && !*serve) || s.Staffed(ctrl.Callsign) {
+		return "", ErrMultiplayerPositionStaffed
+	}
+	return ctrl.Callsign, nil
+}
+
+// signOn signs the client on and fills in the reply to its sign-on
+// request.
+func (s *MultiplayerServer) signOn(c *multiplayerConnection, role string, position string, reply *MultiplayerMessage) {
+	c.signedOn, c.role, c.position = true, role, position
+	lg.Printf("Multiplayer server: %s signed on from %s as %s", position, c.conn.RemoteAddr(), role)
+
+	reply.ScenarioGroup = scenarioGroup.Name
+	reply.Scenario = sim.Scenario.Name()
+	reply.METAR = sim.METAR
+	reply.Wind = sim.Wind
+	reply.Precipitation = sim.Precipitation
+	reply.Position = position
+	// Send the aircraft right away rather than waiting for the next
+	// update.
+	s.lastUpdate = time.Time{}
+}
+
+// handleSignOn handles a sign-on request; it returns false if the reply
+// should wait for the host's approval.
+func (s *MultiplayerServer) handleSignOn(c *multiplayerConnection, req MultiplayerRequest, reply *MultiplayerMessage) (bool, error) {
+	if c.signedOn || FindIf(s.joinRequests, func(jr *multiplayerJoinRequest) bool { return jr.c == c }) != -1 {
+		return true, ErrMultiplayerInvalidRequest
+	}
+
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	now := time.Now()
+	s.failedJoins[host] = FilterSlice(s.failedJoins[host], func(t time.Time) bool {
+		return now.Sub(t) < multiplayerJoinAttemptWindow
+	})
+	if len(s.failedJoins[host]) >= multiplayerMaxJoinAttempts {
+		lg.Printf("Multiplayer server: %s: too many incorrect join codes", c.conn.RemoteAddr())
+		return true, ErrMultiplayerTooManyAttempts
+	}
+	code := strings.ToUpper(strings.TrimSpace(req.JoinCode))
+	if subtle.ConstantTimeCompare([]byte(code), []byte(globalConfig.MultiplayerJoinCode)) != 1 {
+		lg.Printf("Multiplayer server: %s: incorrect join code", c.conn.RemoteAddr())
+		s.failedJoins[host] = append(s.failedJoins[host], now)
+		return true, ErrMultiplayerJoinCode
+	}
+	if len(s.failedJoins[host]) == 0 {
+		delete(s.failedJoins, host)
+	}
+
+	role := strings.ToLower(req.Role)
+	if role == "" {
+		role = MultiplayerRoleController
+	}
+	position, err := s.checkSignOn(role, strings.ToUpper(req.Controller))
+	if err != nil {
+		return true, err
+	}
+
+	if globalConfig.MultiplayerRequireApproval {
+		lg.Printf("Multiplayer server: %s waiting for approval as %s", c.conn.RemoteAddr(), role)
+		s.joinRequests = append(s.joinRequests, &multiplayerJoinRequest{
+			c:        c,
+			id:       req.Id,
+			role:     role,
+			position: position,
+		})
+		globalConfig.Audio.PlaySound(AudioEventUserAlert)
+		s.ShowLobby()
+		return false, nil
+	}
+
+	s.signOn(c, role, position, reply)
+	return true, nil
+}
+
+// Approve signs on the participant who made the join request to the
+// given position.
+func (s *MultiplayerServer) Approve(jr *multiplayerJoinRequest, position string) error {
+	position, err := s.checkSignOn(jr.role, position)
+	if err != nil {
+		return err
+	}
+
+	s.joinRequests = FilterSlice(s.joinRequests, func(r *multiplayerJoinRequest) bool { return r != jr })
+	reply := MultiplayerMessage{Type: "reply", Id: jr.id, Time: sim.CurrentTime()}
+	s.signOn(jr.c, jr.role, position, &reply)
+	s.send(jr.c, reply)
+	return nil
+}
+
+// Deny declines the join request.
+func (s *MultiplayerServer) Deny(jr *multiplayerJoinRequest) {
+	lg.Printf("Multiplayer server: %s: join request denied", jr.c.conn.RemoteAddr())
+	s.joinRequests = FilterSlice(s.joinRequests, func(r *multiplayerJoinRequest) bool { return r != jr })
+	s.send(jr.c, MultiplayerMessage{Type: "reply", Id: jr.id, Time: sim.CurrentTime(), Error: ErrMultiplayerDenied.Error()})
+}
+
+// handle runs a client's request and sends the reply. It must be called
+// from the main thread.
+func (s *MultiplayerServer) handle(c *multiplayerConnection, req MultiplayerRequest) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+
+	reply := MultiplayerMessage{Type: "reply", Id: req.Id, Time: sim.CurrentTime()}
+	var err error
+	if req.Type == "signon" {
+		var now bool
+		if now, err = s.handleSignOn(c, req, &reply); !now {
+			return
+		}
+	} else if !c.signedOn || sim.Scenario == nil {
+		err = ErrMultiplayerNotSignedOn
+	} else if err = c.permitted(req); err == nil {
+		switch req.Type {
+		case "commands":
+			s.commanded[req.Callsign] = c
+			reply.Remaining, err = sim.runAircraftCommands(c.position, req.Callsign, req.Commands, c.mayCommand)
+		case "track":
+			err = sim.initiateTrack(c.position, req.Callsign)
+		case "drop":
+			err = sim.dropTrack(c.position, req.Callsign)
+		case "handoff":
+			err = sim.handoff(c.position, req.Callsign, req.Controller)
+		case "accept":
+			err = sim.acceptHandoff(c.position, req.Callsign)
+		case "cancel_handoff":
+			err = sim.cancelHandoff(c.position, req.Callsign)
+		case "reject_handoff":
+			err = sim.RejectHandoff(req.Callsign)
+		case "point_out":
+			err = sim.PointOut(req.Callsign, req.Controller)
+		case "push_strip":
+			err = sim.PushFlightStrip(req.Callsign, req.Controller)
+		case "scratchpad":
+			err = sim.setScratchpad(c.position, req.Callsign, req.Scratchpad)
+		case "temporary_altitude":
+			err = sim.SetTemporaryAltitude(req.Callsign, req.Altitude)
+		case "squawk":
+			err = sim.SetSquawk(req.Callsign, req.Squawk)
+		case "squawk_automatic":
+			err = sim.SetSquawkAutomatic(req.Callsign)
+		case "amend":
+			if req.FlightPlan == nil {
+				err = ErrMultiplayerInvalidRequest
+			} else {
+				err = sim.AmendFlightPlan(req.Callsign, *req.FlightPlan)
+			}
+		case "vectors":
+			s.commanded[req.Callsign] = c
+			err = sim.AssignVectors(req.Callsign, req.Route)
+		case "delete":
+			err = sim.DeleteAircraft(req.Callsign)
+		case "pilot_reply":
+			s.commanded[req.Callsign] = c
+			err = sim.RespondToPilotRequest(req.RequestId, req.Reply)
+		case "interest":
+			c.interest = req.Interest
+		case "ping":
+			reply.Paused, reply.SimRate = sim.IsPaused(), sim.SimRate
+		case "pause":
+			if sim.IsPaused() != req.Paused {
+				sim.TogglePause()
+			}
+			reply.Paused, reply.SimRate = sim.IsPaused(), sim.SimRate
+		case "sim_rate":
+			sim.SimRate = clamp(req.SimRate, 1, 10)
+			reply.Paused, reply.SimRate = sim.IsPaused(), sim.SimRate
+		default:
+			err = ErrMultiplayerInvalidRequest
+		}
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	s.send(c, reply)
+
+	if err == ErrMultiplayerJoinCode || err == ErrMultiplayerTooManyAttempts {
+		s.disconnect(c)
+	}
+}
+
+// Process runs any pending requests from clients and sends them updates.
+// It must be called from the main thread.
+func (s *MultiplayerServer) Process() {
+	// Clients signed on to a scenario that is no longer running.
+	if sim.Scenario != s.scenario {
+		for c := range s.clients {
+			s.disconnect(c)
+		}
+		s.scenario = sim.Scenario
+	}
+
+	for {
+		select {
+		case f := <-s.requests:
+			f()
+		default:
+			s.forwardTransmissions()
+			if time.Since(s.lastUpdate) >= multiplayerUpdateInterval {
+				s.lastUpdate = time.Now()
+				s.sendUpdates()
+			}
+			return
+		}
+	}
+}
+
+func (s *MultiplayerServer) forwardTransmissions() {
+	for _, event := range eventStream.Get(s.eventsId) {
+		rt, ok := event.(*RadioTransmissionEvent)
+		if !ok {
+			continue
+		}
+		if c, ok := s.commanded[rt.callsign]; ok {
+			s.send(c, MultiplayerMessage{
+				Type:     "transmission",
+				Time:     sim.CurrentTime(),
+				Callsign: rt.callsign,
+				Message:  rt.message,
+			})
+		}
+	}
+}
+
+func (s *MultiplayerServer) sendUpdates() {
+	if len(s.Participants()) == 0 || sim.Scenario == nil {
+		return
+	}
+
+	// Find the fields of each aircraft that have changed since the last
+	// update.
+	aircraft := sim.GetAllAircraft()
+	fields := make(map[string]AircraftFields)
+	changed := make(map[string][]string)
+	for _, ac := range aircraft {
+		f, err := MarshalAircraftFields(ac)
+		if err != nil {
+			lg.Errorf("Multiplayer server: %s: %v", ac.Callsign, err)
+			continue
+		}
+		fields[ac.Callsign] = f
+		changed[ac.Callsign] = f.Changed(s.fields[ac.Callsign])
+	}
+	s.fields = fields
+
+	for c := range s.clients {
+		if !c.signedOn {
+			continue
+		}
+
+		msg := MultiplayerMessage{
+			Type:          "update",
+			Time:          sim.CurrentTime(),
+			Paused:        sim.IsPaused(),
+			SimRate:       sim.SimRate,
+			Wind:          sim.Wind,
+			Precipitation: sim.Precipitation,
+			Aircraft:      make(map[string]AircraftFields),
+		}
+		for _, ac := range aircraft {
+			f, ok := fields[ac.Callsign]
+			if !ok {
+				continue
+			}
+			_, known := c.known[ac.Callsign]
+			if !c.interested(ac, s.commanded[ac.Callsign] == c) {
+				if known {
+					msg.Removed = append(msg.Removed, ac.Callsign)
+					delete(c.known, ac.Callsign)
+				}
+			} else if !known {
+				msg.Aircraft[ac.Callsign] = f
+				c.known[ac.Callsign] = nil
+			} else if ch := changed[ac.Callsign]; len(ch) > 0 {
+				msg.Aircraft[ac.Callsign] = f.Subset(ch)
+			}
+		}
+		for callsign := range c.known {
+			if _, ok := fields[callsign]; !ok {
+				msg.Removed = append(msg.Removed, callsign)
+				delete(c.known, callsign)
+			}
+		}
+		msg.PilotRequests = FilterSlice(sim.PilotRequests, func(r *PilotRequest) bool {
+			_, ok := c.known[r.Callsign]
+			return ok
+		})
+
+		s.send(c, msg)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// MultiplayerClient
+
+type MultiplayerClient struct {
+	conn          net.Conn
+	position      string
+	role          string
+	scenarioGroup *ScenarioGroup
+	scenario      *Scenario
+	metar         map[string]*METAR
+	wind          Wind
+	precipitation []PrecipitationCell
+
+	mu            sync.Mutex
+	nextId        int
+	pending       map[int]chan MultiplayerMessage
+	transmissions []MultiplayerMessage
+	updates       []*MultiplayerMessage
+	pings         []multiplayerPing
+	errors        []*MultiplayerErrorEvent
+	err           error
+
+	// Requests may be sent from both the main thread and from
+	// goroutines.
+	writeMu sync.Mutex
+
+	// The following are only accessed from the main thread.
+	// The most recent value of each aircraft's fields, updated as deltas
+	// from the server are applied.
+	aircraft map[string]AircraftFields
+	// Updates that have been received but aren't yet due to be applied;
+	// see multiplayerclock.go.
+	queued    []*MultiplayerMessage
+	clock     multiplayerClock
+	lastPing  time.Time
+	snapshots map[string]multiplayerSnapshot
+
+	interest     []MultiplayerInterest
+	lastInterest time.Time
+}
+
+// DialMultiplayerServer connects to the server at the given address and
+// signs on to the given position in the given role. If the host must
+// approve the sign-on, it doesn't return until they have, so it should
+// be called from a goroutine.
+func DialMultiplayerServer(address string, position string, role string, joinCode string) (*MultiplayerClient, error) {
+	conn, err := net.DialTimeout("tcp", address, multiplayerTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &MultiplayerClient{
+		conn:      conn,
+		role:      role,
+		pending:   make(map[int]chan MultiplayerMessage),
+		aircraft:  make(map[string]AircraftFields),
+		snapshots: make(map[string]multiplayerSnapshot),
+	}
+	go c.read()
+
+	req := MultiplayerRequest{Type: "signon", Controller: position, Role: role, JoinCode: joinCode}
+	reply, err := c.callTimeout(req, multiplayerApprovalTimeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.position = reply.Position
+
+	sg, ok := scenarioGroups[reply.ScenarioGroup]
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("%s: scenario group not found", reply.ScenarioGroup)
+	}
+	if c.scenario, ok = sg.Scenarios[reply.Scenario]; !ok {
+		conn.Close()
+		return nil, fmt.Errorf("%s: scenario not found in %s", reply.Scenario, reply.ScenarioGroup)
+	}
+	c.scenarioGroup = sg
+	c.metar = reply.METAR
+	c.wind = reply.Wind
+	c.precipitation = reply.Precipitation
+	if c.metar == nil {
+		c.metar = make(map[string]*METAR)
+	}
+
+	return c, nil
+}
+
+// NewRemoteSim returns a Sim that mirrors the one running on the
+// client's server.
+func NewRemoteSim(c *MultiplayerClient) *Sim {
+	scenarioGroup = c.scenarioGroup
+
+	s := &Sim{
+		Scenario: c.scenario,
+
+		Aircraft:             make(map[string]*Aircraft),
+		Handoffs:             make(map[string]time.Time),
+		HandoffAltitudeHolds: make(map[string]int),
+		METAR:                c.metar,
+		Wind:                 c.wind,
+		Precipitation:        c.precipitation,
+
+		currentTime:    time.Now(),
+		lastUpdateTime: time.Now(),
+		SimRate:        1,
+		WillGoAround:   make(map[string]GoAroundCause),
+
+		remote: c,
+	}
+
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		if stars, ok := p.(*STARSPane); ok {
+			stars.ResetScenarioGroup()
+			stars.ResetScenario(s.Scenario)
+		}
+	})
+
+	return s
+}
+
+func (c *MultiplayerClient) Close() {
+	c.conn.Close()
+}
+
+func (c *MultiplayerClient) read() {
+	defer reportGoroutinePanic()
+	sc := bufio.NewScanner(c.conn)
+	sc.Buffer(make([]byte, 64*1024), multiplayerMaxMessageSize)
+	for {
+		var msg MultiplayerMessage
+		var err error
+		if !sc.Scan() {
+			if err = sc.Err(); err == nil {
+				err = io.EOF
+			}
+		} else {
+			err = json.Unmarshal(sc.Bytes(), &msg)
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		c.mu.Lock()
+		switch msg.Type {
+		case "reply":
+			if ch, ok := c.pending[msg.Id]; ok {
+				ch <- msg
+				delete(c.pending, msg.Id)
+			}
+		case "update":
+			msg.received = time.Now()
+			c.updates = append(c.updates, &msg)
+		case "transmission":
+			c.transmissions = append(c.transmissions, msg)
+		default:
+			lg.Errorf("%s: unexpected multiplayer message type", msg.Type)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// call sends the request to the server and waits for its reply.
+func (c *MultiplayerClient) call(req MultiplayerRequest) (MultiplayerMessage, error) {
+	return c.callTimeout(req, multiplayerTimeout)
+}
+
+// callTimeout is like call but waits for the given amount of time for
+// the reply.
+func (c *MultiplayerClient) callTimeout(req MultiplayerRequest, timeout time.Duration) (MultiplayerMessage, error) {
+	ch, err := c.sendRequest(&req)
+	if err != nil {
+		return MultiplayerMessage{}, err
+	}
+	return c.wait(req.Id, ch, timeout)
+}
+
+// callAsync sends the request to the server without waiting for its
+// reply, so that the main thread isn't held up. If the reply has an
+// error, a MultiplayerErrorEvent is posted for it. Requests are sent in
+// the order that callAsync is called.
+func (c *MultiplayerClient) callAsync(req MultiplayerRequest) {
+	ch, err := c.sendRequest(&req)
+	if err != nil {
+		c.asyncError(req, MultiplayerMessage{}, err)
+		return
+	}
+	go func() {
+		defer reportGoroutinePanic()
+		if reply, err := c.wait(req.Id, ch, multiplayerTimeout); err != nil {
+			c.asyncError(req, reply, err)
+		}
+	}()
+}
+
+func (c *MultiplayerClient) asyncError(req MultiplayerRequest, reply MultiplayerMessage, err error) {
+	lg.Printf("Multiplayer client: %s %s: %v", req.Type, req.Callsign, err)
+	c.mu.Lock()
+	c.errors = append(c.errors, &MultiplayerErrorEvent{
+		callsign:  req.Callsign,
+		commands:  req.Commands,
+		remaining: reply.Remaining,
+		err:       err,
+	})
+	c.mu.Unlock()
+}
+
+// sendRequest assigns the request an id and sends it to the server. It
+// returns the channel that the reply will be sent to.
+func (c *MultiplayerClient) sendRequest(req *MultiplayerRequest) (chan MultiplayerMessage, error) {
+	ch := make(chan MultiplayerMessage, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, ErrMultiplayerDisconnected
+	}
+	c.nextId++
+	req.Id = c.nextId
+	c.pending[req.Id] = ch
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(multiplayerTimeout))
+	err := json.NewEncoder(c.conn).Encode(req)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, req.Id)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// wait waits for the reply to the request with the given id.
+func (c *MultiplayerClient) wait(id int, ch chan MultiplayerMessage, timeout time.Duration) (MultiplayerMessage, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return MultiplayerMessage{}, ErrMultiplayerDisconnected
+		}
+		if reply.Error != "" {
+			return reply, multiplayerError(reply.Error)
+		}
+		return reply, nil
+	case <-time.After(timeout):
+		return MultiplayerMessage{}, ErrMultiplayerTimeout
+	}
+}
+
+// Instructor returns true if the client signed on as an instructor and
+// so may control the simulation.
+func (c *MultiplayerClient) Instructor() bool {
+	return c.role == MultiplayerRoleInstructor
+}
+
+// The following send requests to the server without waiting for the
+// replies; see callAsync.
+
+func (c *MultiplayerClient) SetPaused(paused bool) {
+	c.callAsync(MultiplayerRequest{Type: "pause", Paused: paused})
+}
+
+func (c *MultiplayerClient) SetSimRate(rate float32) {
+	c.callAsync(MultiplayerRequest{Type: "sim_rate", SimRate: rate})
+}
+
+func (c *MultiplayerClient) RunAircraftCommands(callsign string, cmds string) {
+	c.callAsync(MultiplayerRequest{Type: "commands", Callsign: callsign, Commands: cmds})
+}
+
+func (c *MultiplayerClient) InitiateTrack(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "track", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) DropTrack(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "drop", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) Handoff(callsign string, controller string) {
+	c.callAsync(MultiplayerRequest{Type: "handoff", Callsign: callsign, Controller: controller})
+}
+
+func (c *MultiplayerClient) AcceptHandoff(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "accept", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) CancelHandoff(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "cancel_handoff", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) RejectHandoff(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "reject_handoff", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) PointOut(callsign string, controller string) {
+	c.callAsync(MultiplayerRequest{Type: "point_out", Callsign: callsign, Controller: controller})
+}
+
+func (c *MultiplayerClient) PushFlightStrip(callsign string, controller string) {
+	c.callAsync(MultiplayerRequest{Type: "push_strip", Callsign: callsign, Controller: controller})
+}
+
+func (c *MultiplayerClient) SetScratchpad(callsign string, scratchpad string) {
+	c.callAsync(MultiplayerRequest{Type: "scratchpad", Callsign: callsign, Scratchpad: scratchpad})
+}
+
+func (c *MultiplayerClient) SetTemporaryAltitude(callsign string, alt int) {
+	c.callAsync(MultiplayerRequest{Type: "temporary_altitude", Callsign: callsign, Altitude: alt})
+}
+
+func (c *MultiplayerClient) SetSquawk(callsign string, squawk Squawk) {
+	c.callAsync(MultiplayerRequest{Type: "squawk", Callsign: callsign, Squawk: squawk})
+}
+
+func (c *MultiplayerClient) SetSquawkAutomatic(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "squawk_automatic", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) AmendFlightPlan(callsign string, fp FlightPlan) {
+	c.callAsync(MultiplayerRequest{Type: "amend", Callsign: callsign, FlightPlan: &fp})
+}
+
+func (c *MultiplayerClient) AssignVectors(callsign string, route []Point2LL) {
+	c.callAsync(MultiplayerRequest{Type: "vectors", Callsign: callsign, Route: route})
+}
+
+func (c *MultiplayerClient) DeleteAircraft(callsign string) {
+	c.callAsync(MultiplayerRequest{Type: "delete", Callsign: callsign})
+}
+
+func (c *MultiplayerClient) RespondToPilotRequest(callsign string, id int, reply PilotReply) {
+	c.callAsync(MultiplayerRequest{Type: "pilot_reply", Callsign: callsign, RequestId: id, Reply: reply})
+}
+
+// mergeUpdate merges an update from the server into the client's copy
+// of the aircraft's fields and records the aircraft that it changed.
+func (c *MultiplayerClient) mergeUpdate(u *MultiplayerMessage, updated map[string]time.Time) {
+	for callsign, delta := range u.Aircraft {
+		if f, ok := c.aircraft[callsign]; ok {
+			f.Merge(delta)
+		} else {
+			c.aircraft[callsign] = delta
+		}
+		updated[callsign] = u.Time
+	}
+	for _, callsign := range u.Removed {
+		delete(c.aircraft, callsign)
+		updated[callsign] = u.Time
+	}
+}
+
+// GetUpdates applies the updates from the server that are due to the
+// given Sim and posts any pilot transmissions that have arrived since the
+// last call. It must be called from the main thread.
+func (c *MultiplayerClient) GetUpdates(s *Sim) {
+	c.mu.Lock()
+	transmissions, updates, pings, errs, err := c.transmissions, c.updates, c.pings, c.errors, c.err
+	c.transmissions, c.updates, c.pings, c.errors = nil, nil, nil, nil
+	c.mu.Unlock()
+
+	for _, p := range pings {
+		c.clock.AddPing(p.rtt)
+		c.clock.Sync(p.reply.Time, p.reply.Paused, p.reply.SimRate, p.received)
+	}
+	for _, u := range updates {
+		c.clock.Sync(u.Time, u.Paused, u.SimRate, u.received)
+	}
+	c.queued = append(c.queued, updates...)
+
+	if c.clock.valid {
+		now := time.Now()
+		display := c.clock.DisplayTime(now)
+
+		// Apply the updates that are due, or all but the last few if
+		// we've fallen behind.
+		updated := make(map[string]time.Time)
+		n := 0
+		for n < len(c.queued) &&
+			(!c.queued[n].Time.After(display) || len(c.queued)-n > multiplayerMaxQueuedUpdates) {
+			c.mergeUpdate(c.queued[n], updated)
+			s.PilotRequests = c.queued[n].PilotRequests
+			s.Wind = c.queued[n].Wind
+			s.Precipitation = c.queued[n].Precipitation
+			n++
+		}
+		c.queued = c.queued[n:]
+		c.applyUpdate(s, updated)
+
+		s.currentTime = display
+		s.lastUpdateTime = now
+		s.Paused = c.clock.paused
+		s.SimRate = c.clock.rate
+
+		for callsign, ac := range s.Aircraft {
+			if snap, ok := c.snapshots[callsign]; ok {
+				snap.extrapolate(ac, display)
+			}
+		}
+	}
+
+	if time.Since(c.lastPing) >= multiplayerPingInterval {
+		c.lastPing = time.Now()
+		go c.ping()
+	}
+	c.updateInterest()
+
+	for _, t := range transmissions {
+		lg.Printf("%s: %s", t.Callsign, t.Message)
+		eventStream.Post(&RadioTransmissionEvent{callsign: t.Callsign, message: t.Message})
+	}
+	for _, e := range errs {
+		eventStream.Post(e)
+	}
+
+	if err != nil {
+		lg.Errorf("Multiplayer client: %v", err)
+		ShowErrorDialog("Lost the connection to the multiplayer server: %v", err)
+		s.Disconnect()
+		sim = &Sim{}
+	}
+}
+
+// applyUpdate updates the Sim's aircraft given the ones that have been
+// updated and the time of the update.
+func (c *MultiplayerClient) applyUpdate(s *Sim, updated map[string]time.Time) {
+	for _, callsign := range SortedMapKeys(updated) {
+		prev, ok := s.Aircraft[callsign]
+		f, live := c.aircraft[callsign]
+		if !live {
+			if ok {
+				eventStream.Post(&RemovedAircraftEvent{ac: prev})
+				delete(s.Aircraft, callsign)
+			}
+			delete(c.snapshots, callsign)
+			continue
+		}
+
+		ac, err := f.Aircraft()
+		if err != nil {
+			lg.Errorf("Multiplayer client: %s: %v", callsign, err)
+			continue
+		}
+		c.snapshots[callsign] = multiplayerSnapshot{position: ac.Position, time: updated[callsign]}
+
+		if !ok {
+			s.Aircraft[callsign] = ac
+			eventStream.Post(&AddedAircraftEvent{ac: ac})
+			continue
+		}
+
+		if ac.InboundHandoffController == c.position && prev.InboundHandoffController != c.position {
+			globalConfig.Audio.PlaySound(AudioEventInboundHandoff)
+		}
+		accepted := prev.TrackingController == c.position && prev.OutboundHandoffController != "" &&
+			ac.TrackingController == prev.OutboundHandoffController
+
+		// Update the existing Aircraft so that pointers to it held
+		// elsewhere remain valid.
+		*prev = *ac
+		if accepted {
+			globalConfig.Audio.PlaySound(AudioEventHandoffAccepted)
+			eventStream.Post(&AcceptedHandoffEvent{controller: prev.TrackingController, ac: prev})
+		}
+		eventStream.Post(&ModifiedAircraftEvent{ac: prev})
+	}
+}
+
+// updateInterest tells the server which areas the user's scopes are
+// showing, if they have changed.
+func (c *MultiplayerClient) updateInterest() {
+	if time.Since(c.lastInterest) < multiplayerUpdateInterval {
+		return
+	}
+	c.lastInterest = time.Now()
+
+	var interest []MultiplayerInterest
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		if stars, ok := p.(*STARSPane); ok {
+			if ps := &stars.currentPreferenceSet; !ps.currentCenter.IsZero() {
+				interest = append(interest, MultiplayerInterest{Center: ps.currentCenter, Range: ps.Range})
+			}
+		}
+	})
+	if SliceEqual(interest, c.interest) {
+		return
+	}
+	c.interest = interest
+
+	// Don't hold up the main thread waiting for the reply.
+	go func() {
+		defer reportGoroutinePanic()
+		if _, err := c.call(MultiplayerRequest{Type: "interest", Interest: interest}); err != nil {
+			lg.Errorf("Multiplayer client: %v", err)
+		}
+	}()
+}
+
+///////////////////////////////////////////////////////////////////////////
+// UI
+
+var multiplayerServer *MultiplayerServer
+
+// multiplayerServerUpdate starts or stops the multiplayer server to
+// match the user's settings.
+func multiplayerServerUpdate() {
+	if globalConfig.MultiplayerEnabled && multiplayerServer == nil {
+		var err error
+		if multiplayerServer, err = StartMultiplayerServer(globalConfig.MultiplayerPort,
+			globalConfig.MultiplayerAllowRemote); err != nil {
+			lg.Errorf("Unable to start multiplayer server: %v", err)
+			globalConfig.MultiplayerEnabled = false
+			ShowErrorDialog("Unable to start multiplayer server: %v", err)
+		}
+	} else if !globalConfig.MultiplayerEnabled && multiplayerServer != nil {
+		multiplayerServer.Stop()
+		multiplayerServer = nil
+	}
+}
+
+func multiplayerServerDrawUI() {
+	if globalConfig.MultiplayerPort == 0 {
+		globalConfig.MultiplayerPort = 6503
+	}
+
+	uiStartDisable(globalConfig.MultiplayerEnabled)
+	port := int32(globalConfig.MultiplayerPort)
+	if imgui.InputIntV("Server port", &port, 1, 100, 0) {
+		globalConfig.MultiplayerPort = clamp(int(port), 1024, 65535)
+	}
+	imgui.Checkbox("Accept connections from other computers", &globalConfig.MultiplayerAllowRemote)
+	uiEndDisable(globalConfig.MultiplayerEnabled)
+
+	if imgui.Checkbox("Host multiplayer sessions", &globalConfig.MultiplayerEnabled) {
+		multiplayerServerUpdate()
+	}
+	imgui.Checkbox("Approve each remote participant", &globalConfig.MultiplayerRequireApproval)
+	if multiplayerServer != nil {
+		imgui.Text(fmt.Sprintf("Listening on port %d", globalConfig.MultiplayerPort))
+		imgui.Text("Join code: " + globalConfig.MultiplayerJoinCode)
+		imgui.SameLine()
+		if imgui.Button("New code") {
+			// Participants who have already signed on aren't affected.
+			globalConfig.MultiplayerJoinCode = newMultiplayerJoinCode()
+		}
+		var p []string
+		for _, mp := range multiplayerServer.Participants() {
+			if !mp.Waiting {
+				p = append(p, mp.String())
+			}
+		}
+		if len(p) > 0 {
+			imgui.Text("Remote participants: " + strings.Join(p, ", "))
+		}
+		if n := len(multiplayerServer.joinRequests); n > 0 {
+			imgui.Text(fmt.Sprintf("%d waiting to join", n))
+			imgui.SameLine()
+			if imgui.Button("Review...") {
+				multiplayerServer.ShowLobby()
+			}
+		}
+	}
+}
+
+// ShowLobby shows the dialog box for approving join requests, if it
+// isn't already being shown. When running headless, join requests are
+// handled through the API instead.
+func (s *MultiplayerServer) ShowLobby() {
+	if !s.lobbyShown && !*serve {
+		s.lobbyShown = true
+		uiShowModalDialog(NewModalDialogBox(&MultiplayerLobbyModalClient{server: s}), true)
+	}
+}
+
+// MultiplayerLobbyModalClient is the dialog box where the host approves
+// or denies requests to join the session and assigns positions to the
+// participants.
+type MultiplayerLobbyModalClient struct {
+	server *MultiplayerServer
+	// Position to assign to each requester.
+	positions map[*multiplayerJoinRequest]string
+	err       string
+}
+
+func (m *MultiplayerLobbyModalClient) Title() string { return "Multiplayer Join Requests" }
+
+func (m *MultiplayerLobbyModalClient) Opening() {
+	m.positions = make(map[*multiplayerJoinRequest]string)
+	m.err = ""
+}
+
+func (m *MultiplayerLobbyModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{{text: "Close", cancel: true, action: func() bool {
+		// Requests that haven't been decided stay pending.
+		m.server.lobbyShown = false
+		return true
+	}}}
+}
+
+func (m *MultiplayerLobbyModalClient) Draw() int {
+	if len(m.server.joinRequests) == 0 {
+		imgui.Text("No one is waiting to join.")
+	}
+
+	for _, jr := range m.server.joinRequests {
+		if _, ok := m.positions[jr]; !ok {
+			m.positions[jr] = jr.position
+		}
+
+		imgui.PushID(jr.c.conn.RemoteAddr().String())
+		imgui.Text(fmt.Sprintf("%s: %s", jr.c.conn.RemoteAddr(), jr.role))
+		if jr.role != MultiplayerRoleObserver {
+			imgui.SameLine()
+			pos := m.positions[jr]
+			label := pos
+			if label == "" {
+				label = "(none)"
+			}
+			if imgui.BeginComboV("Position", label, imgui.ComboFlagsHeightLarge) {
+				if jr.role == MultiplayerRoleInstructor && imgui.SelectableV("(none)", pos == "", 0, imgui.Vec2{}) {
+					m.positions[jr] = ""
+				}
+				for _, callsign := range SortedMapKeys(scenarioGroup.ControlPositions) {
+					if sim.Scenario == nil || callsign == sim.Scenario.Callsign || m.server.Staffed(callsign) {
+						continue
+					}
+					if imgui.SelectableV(callsign, callsign == pos, 0, imgui.Vec2{}) {
+						m.positions[jr] = callsign
+					}
+				}
+				imgui.EndCombo()
+			}
+		}
+
+		imgui.SameLine()
+		if imgui.Button("Approve") {
+			if err := m.server.Approve(jr, m.positions[jr]); err != nil {
+				m.err = err.Error()
+			} else {
+				m.err = ""
+			}
+		}
+		imgui.SameLine()
+		if imgui.Button("Deny") {
+			m.server.Deny(jr)
+		}
+		imgui.PopID()
+	}
+
+	if m.err != "" {
+		imgui.Text(m.err)
+	}
+	return -1
+}
+
+// MultiplayerConnectionConfiguration is used in the connection dialog
+// to join a simulation running on a multiplayer server.
+type MultiplayerConnectionConfiguration struct {
+	address  string
+	position string
+	role     string
+	joinCode string
+
+	// Non-nil while connecting; connecting may take a while if the host
+	// must approve the request.
+	dialing chan multiplayerDialResult
+}
+
+type multiplayerDialResult struct {
+	c   *MultiplayerClient
+	err error
+}
+
+func (mcc *MultiplayerConnectionConfiguration) Initialize() {
+	mcc.address = globalConfig.MultiplayerAddress
+	mcc.position = globalConfig.MultiplayerPosition
+	mcc.role = globalConfig.MultiplayerRole
+	if mcc.role == "" {
+		mcc.role = MultiplayerRoleController
+	}
+	mcc.Cancel()
+}
+
+func (mcc *MultiplayerConnectionConfiguration) DrawUI() bool {
+	uiStartDisable(mcc.dialing != nil)
+	flags := imgui.InputTextFlagsEnterReturnsTrue
+	enter := imgui.InputTextV("Server address", &mcc.address, flags, nil)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("host:port of the vice instance that is hosting the simulation")
+	}
+	enter = imgui.InputTextV("Join code", &mcc.joinCode, flags|imgui.InputTextFlagsCharsUppercase, nil) || enter
+
+	if imgui.BeginComboV("Role", mcc.role, 0) {
+		for _, role := range MultiplayerRoles {
+			if imgui.SelectableV(role, role == mcc.role, 0, imgui.Vec2{}) {
+				mcc.role = role
+			}
+		}
+		imgui.EndCombo()
+	}
+	if mcc.role != MultiplayerRoleObserver {
+		enter = imgui.InputTextV("Control position", &mcc.position, flags|imgui.InputTextFlagsCharsUppercase, nil) || enter
+		if mcc.role == MultiplayerRoleInstructor && imgui.IsItemHovered() {
+			imgui.SetTooltip("Optional for instructors")
+		}
+	}
+	uiEndDisable(mcc.dialing != nil)
+
+	// Once the connection attempt has finished, return true so that
+	// Connect is called to finish up.
+	done := mcc.dialing != nil && len(mcc.dialing) > 0
+	return (enter && mcc.Valid()) || done
+}
+
+func (mcc *MultiplayerConnectionConfiguration) Valid() bool {
+	return mcc.address != "" && mcc.joinCode != "" &&
+		(mcc.position != "" || mcc.role != MultiplayerRoleController)
+}
+
+// Connect starts connecting to the server; it returns
+// ErrMultiplayerConnecting until the connection attempt has finished.
+func (mcc *MultiplayerConnectionConfiguration) Connect() error {
+	if mcc.dialing == nil {
+		address := mcc.address
+		if !strings.Contains(address, ":") {
+			address += ":6503"
+		}
+		position := strings.ToUpper(mcc.position)
+		if mcc.role == MultiplayerRoleObserver {
+			position = ""
+		}
+		role, joinCode := mcc.role, mcc.joinCode
+
+		ch := make(chan multiplayerDialResult, 1)
+		go func() {
+			defer reportGoroutinePanic()
+			c, err := DialMultiplayerServer(address, position, role, joinCode)
+			ch <- multiplayerDialResult{c: c, err: err}
+		}()
+		mcc.dialing = ch
+		return ErrMultiplayerConnecting
+	}
+
+	var r multiplayerDialResult
+	select {
+	case r = <-mcc.dialing:
+		mcc.dialing = nil
+	default:
+		return ErrMultiplayerConnecting
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	globalConfig.MultiplayerAddress = mcc.address
+	globalConfig.MultiplayerRole = mcc.role
+	if mcc.role != MultiplayerRoleObserver {
+		globalConfig.MultiplayerPosition = strings.ToUpper(mcc.position)
+	}
+
+	for _, ac := range sim.GetAllAircraft() {
+		eventStream.Post(&RemovedAircraftEvent{ac: ac})
+	}
+	sim.Disconnect()
+	sim = NewRemoteSim(r.c)
+	return nil
+}
+
+// Cancel abandons a connection attempt that is in progress.
+func (mcc *MultiplayerConnectionConfiguration) Cancel() {
+	if ch := mcc.dialing; ch != nil {
+		mcc.dialing = nil
+		go func() {
+			defer reportGoroutinePanic()
+			if r := <-ch; r.c != nil {
+				r.c.Close()
+			}
+		}()
+	}
+}
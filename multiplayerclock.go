@@ -0,0 +1,163 @@
+// multiplayerclock.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// Multiplayer clients keep an estimate of the server's simulation time
+// so that their clocks advance smoothly between updates rather than
+// jumping once a second. It is synchronized with the times in updates
+// from the server and in replies to pings that are sent periodically;
+// the pings' round-trip times give an estimate of the network latency,
+// which is used to account for how long messages took to arrive. The
+// estimate follows the server's sim rate and pauses.
+//
+// Updates are buffered and applied once the client's clock reaches
+// their time plus a small delay, so that new radar tracks appear at
+// regular intervals regardless of variation in network latency; in
+// between updates, aircraft positions are extrapolated from their
+// groundspeed and heading.
+
+const (
+	multiplayerPingInterval = 5 * time.Second
+	// Updates are shown this long (in wallclock time) after the client's
+	// estimate of when they were sent.
+	multiplayerPlayoutDelay = 250 * time.Millisecond
+	// If the estimated time is off by more than this, the clock is reset
+	// rather than being adjusted gradually.
+	multiplayerClockResetThreshold = 2 * time.Second
+	// Aircraft positions are extrapolated for at most this long past the
+	// last update.
+	multiplayerMaxExtrapolation = 2 * time.Second
+	// If more than this many updates are waiting to be applied, the
+	// older ones are applied right away.
+	multiplayerMaxQueuedUpdates = 4
+)
+
+type multiplayerClock struct {
+	// The server's sim time was simBase at wallclock time base.
+	base    time.Time
+	simBase time.Time
+	rate    float32
+	paused  bool
+	valid   bool
+
+	// Estimated one-way network latency.
+	latency time.Duration
+	// The most recent time returned by Now(); time never goes backwards.
+	last time.Time
+}
+
+// Now returns the estimate of the server's sim time at the given
+// wallclock time.
+func (c *multiplayerClock) Now(wall time.Time) time.Time {
+	t := c.simBase
+	if !c.paused {
+		t = t.Add(time.Duration(c.rate * float32(wall.Sub(c.base))))
+	}
+	if t.Before(c.last) {
+		return c.last
+	}
+	c.last = t
+	return t
+}
+
+// DisplayTime returns the sim time at which the client should show the
+// state of the simulation; it lags the server's time by the playout
+// delay.
+func (c *multiplayerClock) DisplayTime(wall time.Time) time.Time {
+	if c.paused {
+		return c.Now(wall)
+	}
+	return c.Now(wall).Add(-time.Duration(c.rate * float32(multiplayerPlayoutDelay)))
+}
+
+// Sync updates the clock given a sim time from the server that was
+// received at the given wallclock time.
+func (c *multiplayerClock) Sync(simTime time.Time, paused bool, rate float32, received time.Time) {
+	if rate == 0 {
+		rate = 1
+	}
+	est := simTime
+	if !paused {
+		est = est.Add(time.Duration(rate * float32(c.latency)))
+	}
+
+	if !c.valid || paused != c.paused || rate != c.rate {
+		c.valid, c.paused, c.rate = true, paused, rate
+		c.base, c.simBase = received, est
+		c.last = time.Time{}
+		return
+	}
+
+	cur := c.Now(received)
+	if d := est.Sub(cur); d > multiplayerClockResetThreshold || d < -multiplayerClockResetThreshold {
+		lg.Printf("Multiplayer client: clock off by %s; resetting", d)
+		c.base, c.simBase = received, est
+		c.last = time.Time{}
+	} else {
+		// Move part of the way toward the new estimate so that jitter
+		// in message delivery doesn't make the clock jump around.
+		c.base, c.simBase = received, cur.Add(d/8)
+	}
+}
+
+// AddPing updates the latency estimate given the round-trip time of a
+// ping.
+func (c *multiplayerClock) AddPing(rtt time.Duration) {
+	if c.latency == 0 {
+		c.latency = rtt / 2
+	} else {
+		c.latency = (3*c.latency + rtt/2) / 4
+	}
+}
+
+// multiplayerPing is the result of a ping to the server.
+type multiplayerPing struct {
+	rtt      time.Duration
+	reply    MultiplayerMessage
+	received time.Time
+}
+
+// ping measures the round-trip time to the server; it is run in a
+// goroutine.
+func (c *MultiplayerClient) ping() {
+	defer reportGoroutinePanic()
+	sent := time.Now()
+	reply, err := c.call(MultiplayerRequest{Type: "ping"})
+	if err != nil {
+		lg.Errorf("Multiplayer client: ping: %v", err)
+		return
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	c.pings = append(c.pings, multiplayerPing{rtt: now.Sub(sent), reply: reply, received: now})
+	c.mu.Unlock()
+}
+
+// multiplayerSnapshot records an aircraft's position as of the last
+// update.
+type multiplayerSnapshot struct {
+	position Point2LL
+	time     time.Time
+}
+
+// extrapolate advances the aircraft's position from where it was at the
+// snapshot's time to where it would be at the display time.
+func (s multiplayerSnapshot) extrapolate(ac *Aircraft, display time.Time) {
+	dt := display.Sub(s.time)
+	if dt <= 0 || dt > multiplayerMaxExtrapolation || ac.GS == 0 {
+		ac.Position = s.position
+		return
+	}
+
+	hdg := ac.Heading - scenarioGroup.MagneticVariation
+	v := [2]float32{sin(radians(hdg)), cos(radians(hdg))}
+	v = scale2f(v, ac.GS*float32(dt.Hours()))
+	ac.Position = nm2ll(add2f(ll2nm(s.position), v))
+}
@@ -0,0 +1,181 @@
+// navaidmonitor.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// The navaid monitor lets the user tune a navaid, either by identifier or
+// by frequency, and then see its information from the database and hear
+// its Morse code identifier, as a pilot would when monitoring it.
+
+const (
+	// VORs and NDBs ident with a 1020Hz tone; idents are sent slowly,
+	// roughly every 10 seconds.
+	navaidIdentTone     = 1020
+	navaidIdentWPM      = 7
+	navaidIdentInterval = 10 * time.Second
+	navaidMonitorRange  = 75 // nm
+)
+
+var navaidMonitor struct {
+	show       bool
+	input      string
+	tuned      *Navaid
+	err        string
+	monitoring bool
+	lastIdent  time.Time
+	ident      *SoundEffect
+}
+
+func navaidMonitorTune(n *Navaid) {
+	navaidMonitor.tuned = n
+	navaidMonitor.err = ""
+	navaidMonitor.ident = NewSynthesizedSoundEffect(n.Id, SynthesizeMorse(n.Id, navaidIdentTone, navaidIdentWPM))
+	navaidMonitor.lastIdent = time.Time{}
+}
+
+// navaidMonitorLookup finds the navaid with the given identifier or, if
+// a frequency is given, the closest one to the scenario's center on that
+// frequency.
+func navaidMonitorLookup(s string) (*Navaid, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if n, ok := database.Navaids[s]; ok {
+		return &n, nil
+	}
+
+	var closest *Navaid
+	for _, n := range database.Navaids {
+		if n.Frequency != s && strings.TrimSuffix(n.Frequency, "0") != strings.TrimSuffix(s, "0") {
+			continue
+		}
+		if closest == nil || nmdistance2ll(n.Location, scenarioGroup.Center) <
+			nmdistance2ll(closest.Location, scenarioGroup.Center) {
+			n := n
+			closest = &n
+		}
+	}
+	if closest == nil {
+		return nil, fmt.Errorf("%s: no navaid with that identifier or frequency", s)
+	}
+	return closest, nil
+}
+
+// navaidMonitorNearby returns the navaids within navaidMonitorRange of the
+// scenario's center, sorted by distance.
+func navaidMonitorNearby() []Navaid {
+	var nearby []Navaid
+	for _, n := range database.Navaids {
+		if nmdistance2ll(n.Location, scenarioGroup.Center) < navaidMonitorRange {
+			nearby = append(nearby, n)
+		}
+	}
+	sort.Slice(nearby, func(i, j int) bool {
+		return nmdistance2ll(nearby[i].Location, scenarioGroup.Center) <
+			nmdistance2ll(nearby[j].Location, scenarioGroup.Center)
+	})
+	return nearby
+}
+
+func navaidMonitorDrawUI() {
+	nm := &navaidMonitor
+	if nm.monitoring && nm.ident != nil && globalConfig.Audio.AudioEnabled &&
+		time.Since(nm.lastIdent) > navaidIdentInterval {
+		nm.lastIdent = time.Now()
+		nm.ident.Play()
+	}
+
+	if !nm.show {
+		return
+	}
+
+	imgui.BeginV("Navaid Monitor", &nm.show, imgui.WindowFlagsAlwaysAutoResize)
+
+	flags := imgui.InputTextFlagsCharsUppercase | imgui.InputTextFlagsEnterReturnsTrue
+	if imgui.InputTextV("Identifier or frequency", &nm.input, flags, nil) {
+		if n, err := navaidMonitorLookup(nm.input); err != nil {
+			nm.err = err.Error()
+		} else {
+			navaidMonitorTune(n)
+			nm.monitoring = true
+		}
+	}
+	if nm.err != "" {
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text(nm.err)
+		imgui.PopStyleColor()
+	}
+
+	if n := nm.tuned; n != nil {
+		imgui.Separator()
+		imgui.Text(fmt.Sprintf("%s %s (%s)", n.Id, n.Name, n.Type))
+		if n.City != "" {
+			imgui.Text(n.City)
+		}
+		freq := n.Frequency
+		if n.Channel != "" {
+			freq += " / CH " + n.Channel
+		}
+		imgui.Text("Frequency: " + freq)
+		imgui.Text(fmt.Sprintf("Elevation: %.0f'", n.Elevation))
+		imgui.Text(fmt.Sprintf("%03d / %.1f nm from %s", int(headingp2ll(scenarioGroup.Center, n.Location,
+			scenarioGroup.MagneticVariation)+.5), nmdistance2ll(scenarioGroup.Center, n.Location), scenarioGroup.Name))
+
+		var morse []string
+		for _, ch := range n.Id {
+			morse = append(morse, morseCode[ch])
+		}
+		imgui.Text("Ident: " + strings.Join(morse, " "))
+
+		imgui.Checkbox("Monitor ident", &nm.monitoring)
+		imgui.SameLine()
+		if imgui.Button("Play ident") && nm.ident != nil {
+			nm.lastIdent = time.Now()
+			nm.ident.Play()
+		}
+		if !globalConfig.Audio.AudioEnabled {
+			imgui.PushStyleColor(imgui.StyleColorText, UICautionColor.imgui())
+			imgui.Text("Sound effects are disabled in the Preferences window.")
+			imgui.PopStyleColor()
+		}
+	}
+
+	imgui.Separator()
+	imgui.Text("Nearby navaids")
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg | imgui.TableFlagsScrollY
+	if imgui.BeginTableV("navaids", 4, tableFlags, imgui.Vec2{400, 200}, 0) {
+		imgui.TableSetupColumn("Id")
+		imgui.TableSetupColumn("Type")
+		imgui.TableSetupColumn("Freq")
+		imgui.TableSetupColumn("Dist")
+		imgui.TableHeadersRow()
+		for _, n := range navaidMonitorNearby() {
+			n := n
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			selected := nm.tuned != nil && nm.tuned.Id == n.Id
+			if imgui.SelectableV(n.Id, selected, imgui.SelectableFlagsSpanAllColumns, imgui.Vec2{}) {
+				nm.input = n.Id
+				navaidMonitorTune(&n)
+				nm.monitoring = true
+			}
+			imgui.TableNextColumn()
+			imgui.Text(n.Type)
+			imgui.TableNextColumn()
+			imgui.Text(n.Frequency)
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%.1f", nmdistance2ll(scenarioGroup.Center, n.Location)))
+		}
+		imgui.EndTable()
+	}
+
+	imgui.End()
+}
@@ -0,0 +1,230 @@
+// noticeboard.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The NoticeBoardPane collects the situational information that
+// controllers keep an eye on during a session in one place: the current
+// ATIS code at each airport, simulated NOTAMs for airspace blocked by
+// special operations and for closed runways, traffic management
+// restrictions and LOA requirements, and the runways in use along with
+// their conditions. It is regenerated from the Sim once a second.
+
+// NoticeBoard returns the sections of the notice board for the current
+// state of the Sim.
+func (sim *Sim) NoticeBoard() []ReliefBriefingSection {
+	if sim.Scenario == nil {
+		return nil
+	}
+	now := sim.CurrentTime()
+	var sections []ReliefBriefingSection
+
+	// ATIS
+	atis := ReliefBriefingSection{Title: "ATIS"}
+	airports := make(map[string]interface{})
+	for _, ap := range sim.Scenario.AllAirports() {
+		airports[ap] = nil
+	}
+	for _, ap := range SortedMapKeys(airports) {
+		a := sim.GetAirportATIS(ap)
+		if len(a) == 0 {
+			continue
+		}
+		s := fmt.Sprintf("%s INFO %s", ap, a[0].Code)
+		if metar := sim.GetMETAR(ap); metar != nil {
+			s += " " + metar.Wind + " " + metar.Altimeter
+		}
+		atis.Items = append(atis.Items, s)
+	}
+	sections = append(sections, atis)
+
+	// NOTAMs
+	notams := ReliefBriefingSection{Title: "NOTAMs"}
+	for _, op := range sim.SpecialOperations {
+		if op.RadiusNM > 0 && op.Active(now) {
+			notams.Items = append(notams.Items, op.Description)
+		}
+	}
+	for _, key := range SortedMapKeys(sim.RunwayStates) {
+		rs := sim.RunwayStates[key]
+		if !rs.Closed {
+			continue
+		}
+		s := fmt.Sprintf("%s RWY %s CLSD", rs.Airport, rs.Runway)
+		if !rs.TreatmentEnd.IsZero() {
+			s += " FOR TREATMENT UNTIL " + rs.TreatmentEnd.UTC().Format("1504") + "Z"
+		}
+		notams.Items = append(notams.Items, s)
+	}
+	sections = append(sections, notams)
+
+	// Restrictions
+	restr := ReliefBriefingSection{Title: "Restrictions"}
+	for _, op := range sim.SpecialOperations {
+		if op.Airport != "" && op.Active(now) {
+			restr.Items = append(restr.Items, fmt.Sprintf("%s ground stop until %sZ", op.Airport,
+				op.End.UTC().Format("1504")))
+		}
+	}
+	restr.Items = append(restr.Items, fmt.Sprintf("Departures via the same exit: %d minutes in trail",
+		int(departureInTrailInterval.Minutes())))
+	for _, p := range sim.Scenario.ControllerPolicies {
+		if s := p.Restriction(); s != "" {
+			restr.Items = append(restr.Items, s)
+		}
+	}
+	sections = append(sections, restr)
+
+	// Runways
+	rwys := ReliefBriefingSection{Title: "Runway configuration", Items: sim.RunwaysInUse()}
+	for _, key := range SortedMapKeys(sim.RunwayStates) {
+		if rs := sim.RunwayStates[key]; !rs.Closed {
+			rwys.Items = append(rwys.Items, rs.Airport+" "+rs.String())
+		}
+	}
+	sections = append(sections, rwys)
+
+	return sections
+}
+
+// Restriction returns a description of the LOA requirements given by the
+// policy, or an empty string if it doesn't impose any.
+func (p *ControllerPolicy) Restriction() string {
+	var which []string
+	if p.Airport != "" {
+		which = append(which, p.Airport)
+	}
+	if p.Fix != "" {
+		which = append(which, "via "+p.Fix)
+	}
+	qualifier := ""
+	if len(which) > 0 {
+		qualifier = " (" + strings.Join(which, " ") + ")"
+	}
+
+	var r []string
+	if p.HandoffAltitude != 0 || p.HandoffSpeed != 0 {
+		s := p.Controller + " hands off"
+		if p.HandoffAltitude != 0 {
+			s += fmt.Sprintf(" at %d", p.HandoffAltitude)
+		}
+		if p.HandoffSpeed != 0 {
+			s += fmt.Sprintf(" at %d kts", p.HandoffSpeed)
+		}
+		r = append(r, s+qualifier)
+	}
+	if p.AcceptAltitude != 0 {
+		r = append(r, fmt.Sprintf("%s takes handoffs at %d%s", p.Controller, p.AcceptAltitude, qualifier))
+	}
+	if p.TransferFix != "" || p.TransferAltitude != 0 {
+		s := p.Controller + " requires"
+		if p.TransferAltitude != 0 {
+			s += fmt.Sprintf(" %d", p.TransferAltitude)
+		}
+		if p.TransferFix != "" {
+			s += " over " + p.TransferFix
+		}
+		r = append(r, s+qualifier)
+	}
+	return strings.Join(r, "; ")
+}
+
+///////////////////////////////////////////////////////////////////////////
+// NoticeBoardPane
+
+type NoticeBoardPane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	sections   []ReliefBriefingSection
+	lastUpdate time.Time
+	scrollbar  *ScrollBar
+}
+
+func NewNoticeBoardPane() *NoticeBoardPane {
+	return &NoticeBoardPane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (nb *NoticeBoardPane) Activate() {
+	if nb.font = GetFont(nb.FontIdentifier); nb.font == nil {
+		nb.font = GetDefaultFont()
+		nb.FontIdentifier = nb.font.id
+	}
+	if nb.scrollbar == nil {
+		nb.scrollbar = NewScrollBar(4, false)
+	}
+}
+
+func (nb *NoticeBoardPane) Deactivate()                {}
+func (nb *NoticeBoardPane) CanTakeKeyboardFocus() bool { return false }
+
+func (nb *NoticeBoardPane) Name() string { return "Notice Board" }
+
+func (nb *NoticeBoardPane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&nb.FontIdentifier, "Font"); changed {
+		nb.font = newFont
+	}
+}
+
+func (nb *NoticeBoardPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	if time.Since(nb.lastUpdate) > time.Second {
+		nb.sections = sim.NoticeBoard()
+		nb.lastUpdate = time.Now()
+	}
+
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := nb.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(nb.font.size)
+	indent := float32(int32(fw / 2))
+	width, height := ctx.paneExtent.Width(), ctx.paneExtent.Height()
+
+	cols := max(int((width-2*indent-float32(nb.scrollbar.Width()))/fw), 10)
+	type line struct {
+		text    string
+		heading bool
+	}
+	var lines []line
+	for _, s := range nb.sections {
+		lines = append(lines, line{text: s.Title, heading: true})
+		if len(s.Items) == 0 {
+			lines = append(lines, line{text: "  None"})
+		}
+		for _, item := range s.Items {
+			wrapped, _ := wrapText(item, cols-2, 2, false)
+			for _, w := range strings.Split(wrapped, "\n") {
+				lines = append(lines, line{text: "  " + w})
+			}
+		}
+		lines = append(lines, line{})
+	}
+
+	y := height - indent
+	visibleLines := int(y / fh)
+	nb.scrollbar.Update(len(lines), visibleLines, ctx)
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	textStyle := TextStyle{Font: nb.font, Color: UITextColor}
+	headingStyle := TextStyle{Font: nb.font, Color: UITextHighlightColor}
+	for i := nb.scrollbar.Offset(); i < min(len(lines), nb.scrollbar.Offset()+visibleLines); i++ {
+		style := textStyle
+		if lines[i].heading {
+			style = headingStyle
+		}
+		td.AddText(lines[i].text, [2]float32{indent, y}, style)
+		y -= fh
+	}
+
+	nb.scrollbar.Draw(ctx, cb)
+	td.GenerateCommands(cb)
+}
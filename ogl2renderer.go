@@ -114,6 +114,27 @@ func (ogl2 *OpenGL2Renderer) DestroyTexture(texid uint32) {
 	delete(ogl2.createdTextures, texid)
 }
 
+func (ogl2 *OpenGL2Renderer) ReadPixels(x, y, w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(int32(x), int32(y), int32(w), int32(h), gl.RGBA, gl.UNSIGNED_BYTE, unsafe.Pointer(&img.Pix[0]))
+
+	// OpenGL returns the rows bottom to top; flip them so that the image
+	// is right side up. Also make sure that the image is fully opaque.
+	stride := img.Stride
+	row := make([]uint8, stride)
+	for y := 0; y < h/2; y++ {
+		r0, r1 := img.Pix[y*stride:(y+1)*stride], img.Pix[(h-1-y)*stride:(h-y)*stride]
+		copy(row, r0)
+		copy(r0, r1)
+		copy(r1, row)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
 func (ogl2 *OpenGL2Renderer) RenderCommandBuffer(cb *CommandBuffer) RendererStats {
 	var stats RendererStats
 	stats.nBuffers++
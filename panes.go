@@ -7,6 +7,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/mmp/imgui-go/v4"
@@ -126,10 +127,13 @@ const (
 type KeyboardState struct {
 	Input   string
 	Pressed map[Key]interface{}
+	// Keys that are currently held down; only the function keys are
+	// tracked.
+	Held map[Key]interface{}
 }
 
 func NewKeyboardState() *KeyboardState {
-	keyboard := &KeyboardState{Pressed: make(map[Key]interface{})}
+	keyboard := &KeyboardState{Pressed: make(map[Key]interface{}), Held: make(map[Key]interface{})}
 
 	keyboard.Input = platform.InputCharacters()
 
@@ -177,6 +181,9 @@ func NewKeyboardState() *KeyboardState {
 		if imgui.IsKeyPressed(ImguiF1 + i) {
 			keyboard.Pressed[Key(int(KeyF1)+i)] = nil
 		}
+		if imgui.IsKeyDown(ImguiF1 + i) {
+			keyboard.Held[Key(int(KeyF1)+i)] = nil
+		}
 	}
 	io := imgui.CurrentIO()
 	if io.KeyShiftPressed() {
@@ -197,6 +204,11 @@ func (k *KeyboardState) IsPressed(key Key) bool {
 	return ok
 }
 
+func (k *KeyboardState) IsHeld(key Key) bool {
+	_, ok := k.Held[key]
+	return ok
+}
+
 func (ctx *PaneContext) SetWindowCoordinateMatrices(cb *CommandBuffer) {
 	w := float32(int(ctx.paneExtent.Width() + 0.5))
 	h := float32(int(ctx.paneExtent.Height() + 0.5))
@@ -217,12 +229,36 @@ func unmarshalPane(paneType string, data []byte) (Pane, error) {
 		// nil pane
 		return nil, nil
 
+	case "*main.AircraftTablePane":
+		return unmarshalPaneHelper[*AircraftTablePane](data)
+
+	case "*main.DepartureReleasePane":
+		return unmarshalPaneHelper[*DepartureReleasePane](data)
+
 	case "*main.EmptyPane":
 		return unmarshalPaneHelper[*EmptyPane](data)
 
 	case "*main.FlightStripPane":
 		return unmarshalPaneHelper[*FlightStripPane](data)
 
+	case "*main.ReferencePane":
+		return unmarshalPaneHelper[*ReferencePane](data)
+
+	case "*main.NoticeBoardPane":
+		return unmarshalPaneHelper[*NoticeBoardPane](data)
+
+	case "*main.ScenarioEditorPane":
+		return unmarshalPaneHelper[*ScenarioEditorPane](data)
+
+	case "*main.InstructionsPane":
+		return unmarshalPaneHelper[*InstructionsPane](data)
+
+	case "*main.PilotMessagePane":
+		return unmarshalPaneHelper[*PilotMessagePane](data)
+
+	case "*main.PlaybackPane":
+		return unmarshalPaneHelper[*PlaybackPane](data)
+
 	case "*main.STARSPane":
 		return unmarshalPaneHelper[*STARSPane](data)
 
@@ -266,9 +302,18 @@ type FlightStripPane struct {
 	AutoRemoveHandoffs        bool
 	AddPushed                 bool
 	CollectDeparturesArrivals bool
+	// SequenceDepartures keeps the departure strips sorted by runway (or
+	// exit, if GroupDeparturesByExit is set) and then proposed departure
+	// time, with a separator between each group. Departure strips that
+	// the user has moved stay where they were put.
+	SequenceDepartures    bool
+	GroupDeparturesByExit bool
 
 	strips        []string // callsigns
 	addedAircraft map[string]interface{}
+	// Departures whose strips have been moved by the user and so aren't
+	// automatically sequenced.
+	manuallySequenced map[string]interface{}
 
 	mouseDragging       bool
 	lastMousePos        [2]float32
@@ -299,6 +344,9 @@ func (fsp *FlightStripPane) Activate() {
 	if fsp.addedAircraft == nil {
 		fsp.addedAircraft = make(map[string]interface{})
 	}
+	if fsp.manuallySequenced == nil {
+		fsp.manuallySequenced = make(map[string]interface{})
+	}
 	if fsp.scrollbar == nil {
 		fsp.scrollbar = NewScrollBar(4, true)
 	}
@@ -328,6 +376,59 @@ func (fsp *FlightStripPane) isArrival(ac *Aircraft) bool {
 
 func (fsp *FlightStripPane) CanTakeKeyboardFocus() bool { return false /*true*/ }
 
+// stripAircraft returns the aircraft for a flight strip; along with the
+// aircraft in the simulation, this includes departures that are still
+// taxiing out.
+func (fsp *FlightStripPane) stripAircraft(callsign string) *Aircraft {
+	if ac := sim.GetAircraft(callsign); ac != nil {
+		return ac
+	}
+	for _, qd := range sim.GetDepartureQueue() {
+		if qd.Aircraft.Callsign == callsign {
+			return qd.Aircraft
+		}
+	}
+	return nil
+}
+
+// departureGroup returns the runway or exit that the departure's strip
+// is grouped by when departures are sequenced.
+func (fsp *FlightStripPane) departureGroup(ac *Aircraft) string {
+	if fsp.GroupDeparturesByExit {
+		return ac.Scratchpad
+	}
+	return ac.DepartureRunway
+}
+
+// sequenceDepartures sorts the departure strips that haven't been moved
+// by the user by group and proposed departure time; the other strips
+// stay where they are.
+func (fsp *FlightStripPane) sequenceDepartures() {
+	var idx []int
+	var deps []*Aircraft
+	for i, callsign := range fsp.strips {
+		if _, ok := fsp.manuallySequenced[callsign]; ok {
+			continue
+		}
+		if ac := fsp.stripAircraft(callsign); ac != nil && fsp.isDeparture(ac) {
+			idx = append(idx, i)
+			deps = append(deps, ac)
+		}
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool {
+		gi, gj := fsp.departureGroup(deps[i]), fsp.departureGroup(deps[j])
+		if gi != gj {
+			// Ungrouped departures go last.
+			return gj == "" || (gi != "" && gi < gj)
+		}
+		return deps[i].ProposedDepartureTime.Before(deps[j].ProposedDepartureTime)
+	})
+	for i, ac := range deps {
+		fsp.strips[idx[i]] = ac.Callsign
+	}
+}
+
 func (fsp *FlightStripPane) processEvents(es *EventStream) {
 	possiblyAdd := func(ac *Aircraft) {
 		callsign := ac.Callsign
@@ -392,15 +493,29 @@ func (fsp *FlightStripPane) processEvents(es *EventStream) {
 		}
 	}
 
+	// Departures are added as soon as they start to taxi.
+	if fsp.AutoAddDepartures {
+		for _, qd := range sim.GetDepartureQueue() {
+			if qd.Aircraft.TrackingController == "" && fsp.isDeparture(qd.Aircraft) {
+				possiblyAdd(qd.Aircraft)
+			}
+		}
+	}
+
 	// TODO: is this needed? Shouldn't there be a RemovedAircraftEvent?
 	fsp.strips = FilterSlice(fsp.strips, func(callsign string) bool {
-		ac := sim.GetAircraft(callsign)
+		ac := fsp.stripAircraft(callsign)
 		return ac != nil
 	})
+	for callsign := range fsp.manuallySequenced {
+		if Find(fsp.strips, callsign) == -1 {
+			delete(fsp.manuallySequenced, callsign)
+		}
+	}
 
 	if fsp.CollectDeparturesArrivals {
 		isDeparture := func(callsign string) bool {
-			if ac := sim.GetAircraft(callsign); ac == nil {
+			if ac := fsp.stripAircraft(callsign); ac == nil {
 				return false
 			} else {
 				return fsp.isDeparture(ac)
@@ -413,10 +528,22 @@ func (fsp *FlightStripPane) processEvents(es *EventStream) {
 		fsp.strips = append(fsp.strips, dep...)
 		fsp.strips = append(fsp.strips, arr...)
 	}
+
+	if fsp.SequenceDepartures {
+		fsp.sequenceDepartures()
+	}
 }
 
 func (fsp *FlightStripPane) Name() string { return "Flight Strips" }
 
+func (fsp *FlightStripPane) KeyBindings() []KeyBinding {
+	return []KeyBinding{
+		KeyBinding{Keys: "Click", Description: "Select the aircraft"},
+		KeyBinding{Keys: "Shift-Click", Description: "Remove the flight strip"},
+		KeyBinding{Keys: "Drag", Description: "Move the flight strip"},
+	}
+}
+
 func (fsp *FlightStripPane) DrawUI() {
 	imgui.Checkbox("Automatically add departures", &fsp.AutoAddDepartures)
 	imgui.Checkbox("Automatically add arrivals", &fsp.AutoAddArrivals)
@@ -427,6 +554,13 @@ func (fsp *FlightStripPane) DrawUI() {
 	imgui.Checkbox("Automatically remove accepted handoffs", &fsp.AutoRemoveHandoffs)
 
 	imgui.Checkbox("Collect departures and arrivals together", &fsp.CollectDeparturesArrivals)
+	imgui.Checkbox("Sequence departures by runway and proposed time", &fsp.SequenceDepartures)
+	if fsp.SequenceDepartures {
+		imgui.Checkbox("Group departures by exit rather than runway", &fsp.GroupDeparturesByExit)
+		if len(fsp.manuallySequenced) > 0 && imgui.Button("Resequence moved departure strips") {
+			fsp.manuallySequenced = make(map[string]interface{})
+		}
+	}
 
 	if newFont, changed := DrawFontPicker(&fsp.FontIdentifier, "Font"); changed {
 		fsp.font = newFont
@@ -486,19 +620,31 @@ func (fsp *FlightStripPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 	defer ReturnLinesDrawBuilder(ld)
 	selectionLd := GetLinesDrawBuilder()
 	defer ReturnLinesDrawBuilder(selectionLd)
+	separatorLd := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(separatorLd)
 
 	// Draw from the bottom
 	scrollOffset := fsp.scrollbar.Offset()
 	y := stripHeight - 1 - vpad
 	for i := scrollOffset; i < min(len(fsp.strips), visibleStrips+scrollOffset+1); i++ {
 		callsign := fsp.strips[i]
-		strip := sim.GetFlightStrip(callsign)
-		ac := sim.GetAircraft(callsign)
+		ac := fsp.stripAircraft(callsign)
 		if ac == nil {
-			lg.Errorf("%s: no aircraft for callsign?!", strip.callsign)
+			lg.Errorf("%s: no aircraft for callsign?!", callsign)
 			continue
 		}
+		strip := &ac.Strip
 		fp := ac.FlightPlan
+		sequenced := fsp.SequenceDepartures && fsp.isDeparture(ac)
+
+		// Separate groups of sequenced departures.
+		if sequenced && i+1 < len(fsp.strips) {
+			if next := fsp.stripAircraft(fsp.strips[i+1]); next != nil && fsp.isDeparture(next) &&
+				fsp.departureGroup(next) != fsp.departureGroup(ac) {
+				yl := y + 1 + vpad
+				separatorLd.AddLine([2]float32{0, yl}, [2]float32{drawWidth, yl})
+			}
+		}
 
 		style := TextStyle{Font: fsp.font, Color: RGB{.1, .1, .1}}
 
@@ -556,6 +702,20 @@ func (fsp *FlightStripPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 			// Line-wrap the route to fit the box and break it into lines.
 			route, _ := wrapText(fp.Route, cols, 2 /* indent */, true)
 			text := strings.Split(route, "\n")
+			if sequenced && ac.DepartureRunway != "" {
+				seq := "RWY " + ac.DepartureRunway
+				if ac.Scratchpad != "" {
+					seq += " " + ac.Scratchpad
+				}
+				seq += " P" + ac.ProposedDepartureTime.UTC().Format("1504")
+				text = append([]string{seq}, text...)
+			} else if ac.ArrivalRunway != "" && fsp.isArrival(ac) {
+				rwy := "RWY " + ac.ArrivalRunway
+				if ac.Approach != nil {
+					rwy += " " + strings.ToUpper(ac.Approach.FullName)
+				}
+				text = append([]string{rwy}, text...)
+			}
 			// Add a blank line if the route only used one line.
 			if len(text) < 2 {
 				text = append(text, "")
@@ -653,7 +813,7 @@ func (fsp *FlightStripPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 				} else {
 					// select the aircraft
 					callsign := fsp.strips[stripIndex]
-					fsp.selectedAircraft = sim.GetAircraft(callsign)
+					fsp.selectedAircraft = fsp.stripAircraft(callsign)
 				}
 			}
 		}
@@ -707,6 +867,12 @@ func (fsp *FlightStripPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 				fsp.strips = append([]string{}, fsp.strips[:destinationIndex]...)
 				fsp.strips = append(fsp.strips, fs)
 				fsp.strips = append(fsp.strips, fin...)
+
+				// Don't undo the move the next time departures are
+				// sequenced.
+				if fsp.SequenceDepartures && fsp.isDeparture(fsp.selectedAircraft) {
+					fsp.manuallySequenced[fs] = nil
+				}
 			}
 		}
 	}
@@ -740,7 +906,166 @@ func (fsp *FlightStripPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 	ld.GenerateCommands(cb)
 	td.GenerateCommands(cb)
 
-	cb.SetRGB(UITextHighlightColor)
+	cb.SetRGB(UICautionColor)
 	cb.LineWidth(3)
+	separatorLd.GenerateCommands(cb)
+
+	cb.SetRGB(UITextHighlightColor)
 	selectionLd.GenerateCommands(cb)
 }
+
+///////////////////////////////////////////////////////////////////////////
+// ReferencePane
+
+// ReferencePane displays the letters of agreement, SOPs, and other
+// reference documents that are bundled with the scenario group and the
+// current scenario. The text can be searched by clicking in the search
+// field at the top and typing; only paragraphs that match are shown.
+type ReferencePane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	search       string
+	searchCursor int
+	scrollbar    *ScrollBar
+}
+
+func NewReferencePane() *ReferencePane {
+	return &ReferencePane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (rp *ReferencePane) Activate() {
+	if rp.font = GetFont(rp.FontIdentifier); rp.font == nil {
+		rp.font = GetDefaultFont()
+		rp.FontIdentifier = rp.font.id
+	}
+	if rp.scrollbar == nil {
+		rp.scrollbar = NewScrollBar(4, false)
+	}
+}
+
+func (rp *ReferencePane) Deactivate()                {}
+func (rp *ReferencePane) CanTakeKeyboardFocus() bool { return false }
+
+func (rp *ReferencePane) Name() string { return "Reference" }
+
+func (rp *ReferencePane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&rp.FontIdentifier, "Font"); changed {
+		rp.font = newFont
+	}
+}
+
+type referenceLine struct {
+	text    string
+	heading bool
+}
+
+// lines returns the lines of text to display, wrapped to the given number
+// of columns and filtered by the current search string.
+func (rp *ReferencePane) lines(cols int) []referenceLine {
+	var docs []ReferenceDocument
+	docs = append(docs, scenarioGroup.Reference...)
+	if sim.Scenario != nil {
+		docs = append(docs, sim.Scenario.Reference...)
+	}
+
+	search := strings.ToLower(strings.TrimSpace(rp.search))
+	var lines []referenceLine
+	for _, doc := range docs {
+		// Headings are only included if there is matching text that
+		// follows them, so hold on to the pending ones until then.
+		pending := []referenceLine{referenceLine{text: doc.Title, heading: true}}
+		matched := false
+
+		for _, para := range strings.Split(doc.Text, "\n\n") {
+			para = strings.TrimSpace(para)
+			if para == "" {
+				continue
+			}
+			if strings.HasPrefix(para, "#") {
+				if len(pending) > 1 {
+					pending = pending[:1]
+				}
+				pending = append(pending, referenceLine{text: strings.TrimSpace(strings.TrimLeft(para, "#")), heading: true})
+				continue
+			}
+			if search != "" && !strings.Contains(strings.ToLower(para), search) {
+				continue
+			}
+
+			lines = append(lines, pending...)
+			pending = nil
+			matched = true
+
+			// Keep explicit line breaks (e.g., for lists) but wrap each
+			// line as needed.
+			for _, line := range strings.Split(para, "\n") {
+				wrapped, _ := wrapText(line, cols, 2, false)
+				for _, w := range strings.Split(wrapped, "\n") {
+					lines = append(lines, referenceLine{text: w})
+				}
+			}
+			lines = append(lines, referenceLine{})
+		}
+		if !matched && search == "" {
+			lines = append(lines, pending[0], referenceLine{})
+		}
+	}
+	return lines
+}
+
+func (rp *ReferencePane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := rp.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(rp.font.size)
+	indent := float32(int32(fw / 2))
+	width, height := ctx.paneExtent.Width(), ctx.paneExtent.Height()
+
+	// Search field at the top; clicking on it takes the keyboard focus.
+	y := height - indent
+	searchStyle := TextStyle{Font: rp.font, Color: UITextColor}
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	p := td.AddText("Search: ", [2]float32{indent, y}, searchStyle)
+	if ctx.haveFocus {
+		cursorStyle := TextStyle{Font: rp.font, Color: RGB{}, DrawBackground: true, BackgroundColor: UITextColor}
+		uiDrawTextEdit(&rp.search, &rp.searchCursor, ctx.keyboard, p, searchStyle, cursorStyle, cb)
+	} else {
+		td.AddText(rp.search, p, searchStyle)
+	}
+	if ctx.mouse != nil && ctx.mouse.Clicked[MouseButtonPrimary] && ctx.mouse.Pos[1] > y-fh {
+		wmTakeKeyboardFocus(rp, true)
+	}
+
+	y -= 1.5 * fh
+	ld := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(ld)
+	ld.AddLine([2]float32{0, y + fh/4}, [2]float32{width, y + fh/4})
+
+	// And then the documents themselves.
+	cols := int((width - 2*indent - float32(rp.scrollbar.Width())) / fw)
+	lines := rp.lines(max(cols, 10))
+	visibleLines := int(y / fh)
+	rp.scrollbar.Update(len(lines), visibleLines, ctx)
+
+	textStyle := TextStyle{Font: rp.font, Color: UITextColor}
+	headingStyle := TextStyle{Font: rp.font, Color: UITextHighlightColor}
+	for i := rp.scrollbar.Offset(); i < min(len(lines), rp.scrollbar.Offset()+visibleLines); i++ {
+		style := textStyle
+		if lines[i].heading {
+			style = headingStyle
+		}
+		td.AddText(lines[i].text, [2]float32{indent, y}, style)
+		y -= fh
+	}
+
+	rp.scrollbar.Draw(ctx, cb)
+
+	cb.SetRGB(UIControlColor)
+	cb.LineWidth(1)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
@@ -0,0 +1,200 @@
+// pilotconsole.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// The pilot console is available in devmode; it allows commanding any of
+// the Sim's aircraft as its pilot, bypassing the controller commands,
+// so that instructors and scenario authors can make aircraft misbehave
+// without editing code. Each line is a callsign followed by one of:
+//   - ALT <feet>, HDG <degrees>, SPD <knots>: fly the given altitude,
+//     heading, or speed without a clearance to do so.
+//   - SQUAWK <code>: squawk the given code, assigned or not.
+//   - FAIL RADIO|ENGINE|PRESSURIZATION|MEDICAL|TRANSPONDER: declare the
+//     corresponding emergency (see emergencies.go) or turn off the
+//     transponder.
+//   - RESTORE: cancel any emergency, turn the transponder back on, and
+//     squawk the assigned code.
+//   - SAY <text>: make the given transmission.
+//   - DELETE: remove the aircraft.
+
+var (
+	ErrUnknownPilotCommand = errors.New("Unknown pilot command")
+	ErrUnknownFailure      = errors.New("Unknown failure: expected RADIO, ENGINE, PRESSURIZATION, MEDICAL, or TRANSPONDER")
+)
+
+// Maximum number of lines kept in the console's history.
+const pilotConsoleMaxLines = 200
+
+// RunPilotCommand runs a single pilot console command for the aircraft;
+// text is the remainder of the command line after the command, which is
+// used by SAY.
+func (sim *Sim) RunPilotCommand(callsign string, cmd string, args []string, text string) error {
+	if sim.remote != nil {
+		return ErrAPIRemoteSimulation
+	}
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	} else if ac.LiveADSB {
+		return ErrUncontrollableAircraft
+	}
+
+	intArg := func() (int, error) {
+		if len(args) != 1 {
+			return 0, ErrInvalidCommandSyntax
+		}
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return 0, ErrInvalidCommandParameter
+		}
+		return v, nil
+	}
+
+	switch cmd {
+	case "ALT":
+		alt, err := intArg()
+		if err != nil {
+			return err
+		}
+		ac.AssignedAltitude, ac.AssignedAltitudeAfterSpeed, ac.CrossingAltitude = alt, 0, 0
+		ac.CancelVia()
+
+	case "HDG":
+		hdg, err := intArg()
+		if err != nil {
+			return err
+		} else if hdg <= 0 || hdg > 360 {
+			return ErrInvalidCommandParameter
+		}
+		ac.AssignedHeading, ac.TurnDirection = hdg, 0
+		ac.ClearedApproach = false
+
+	case "SPD":
+		spd, err := intArg()
+		if err != nil {
+			return err
+		}
+		ac.AssignedSpeed, ac.AssignedSpeedAfterAltitude, ac.CrossingSpeed = spd, 0, 0
+
+	case "SQUAWK":
+		if len(args) != 1 {
+			return ErrInvalidCommandSyntax
+		}
+		sq, err := ParseSquawk(args[0])
+		if err != nil {
+			return ErrInvalidCommandParameter
+		}
+		ac.Squawk = sq
+
+	case "FAIL":
+		if len(args) != 1 {
+			return ErrInvalidCommandSyntax
+		}
+		if args[0] == "TRANSPONDER" {
+			ac.Mode = Standby
+			break
+		}
+		idx := Find([]string{"ENGINE", "MEDICAL", "PRESSURIZATION", "RADIO"}, args[0])
+		if idx == -1 {
+			return ErrUnknownFailure
+		} else if ac.Emergency != nil {
+			return ErrUnableCommand
+		}
+		sim.declareEmergency(ac, EmergencyType(idx), sim.CurrentTime())
+
+	case "RESTORE":
+		ac.Emergency = nil
+		ac.Mode = Charlie
+		ac.Squawk = ac.AssignedSquawk
+
+	case "SAY":
+		if text == "" {
+			return ErrInvalidCommandSyntax
+		}
+		pilotResponse(callsign, "%s", text)
+
+	case "DELETE":
+		eventStream.Post(&RemovedAircraftEvent{ac: ac})
+
+	default:
+		return ErrUnknownPilotCommand
+	}
+
+	lg.Printf("%s: pilot console: %s %s", callsign, cmd, strings.Join(args, " "))
+	eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Pilot console window
+
+var pilotConsole struct {
+	show  bool
+	input string
+	lines []string
+}
+
+// runPilotConsoleLine parses and runs a line entered in the console.
+func runPilotConsoleLine(line string) {
+	pilotConsole.lines = append(pilotConsole.lines, "> "+line)
+
+	f := strings.Fields(line)
+	if len(f) < 2 {
+		pilotConsole.lines = append(pilotConsole.lines, "expected: callsign command [arguments]")
+	} else {
+		callsign, cmd := strings.ToUpper(f[0]), strings.ToUpper(f[1])
+		// SAY keeps the rest of the line as typed.
+		text := ""
+		if s := strings.SplitN(strings.TrimSpace(line), " ", 3); len(s) == 3 {
+			text = strings.TrimSpace(s[2])
+		}
+		args := f[2:]
+		for i := range args {
+			args[i] = strings.ToUpper(args[i])
+		}
+		if err := sim.RunPilotCommand(callsign, cmd, args, text); err != nil {
+			pilotConsole.lines = append(pilotConsole.lines, err.Error())
+		}
+	}
+
+	if n := len(pilotConsole.lines); n > pilotConsoleMaxLines {
+		pilotConsole.lines = pilotConsole.lines[n-pilotConsoleMaxLines:]
+	}
+}
+
+func pilotConsoleDrawUI() {
+	if !pilotConsole.show || !*devmode {
+		return
+	}
+
+	imgui.BeginV("Pilot Console", &pilotConsole.show, imgui.WindowFlagsAlwaysAutoResize)
+
+	imgui.BeginChildV("lines", imgui.Vec2{500, 300}, true, 0)
+	for _, l := range pilotConsole.lines {
+		imgui.Text(l)
+	}
+	if imgui.ScrollY() >= imgui.ScrollMaxY() {
+		imgui.SetScrollHereY(1)
+	}
+	imgui.EndChild()
+
+	if imgui.InputTextV("##command", &pilotConsole.input, imgui.InputTextFlagsEnterReturnsTrue, nil) {
+		if strings.TrimSpace(pilotConsole.input) != "" {
+			runPilotConsoleLine(pilotConsole.input)
+		}
+		pilotConsole.input = ""
+		imgui.SetKeyboardFocusHereV(-1)
+	}
+
+	imgui.End()
+}
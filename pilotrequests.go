@@ -0,0 +1,279 @@
+// pilotrequests.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Requests from pilots (e.g., for a different altitude to get out of
+// turbulence) are made over the radio as usual but are also kept in a
+// list of pending requests until the controller responds to them. The
+// PilotMessagePane shows that list and allows replying to each request
+// with a single keystroke, for users who prefer working with text to
+// issuing the corresponding commands.
+
+type PilotRequestType int
+
+const (
+	PilotRequestAltitude PilotRequestType = iota
+	PilotRequestWeatherDeviation
+	PilotRequestFlightFollowing
+)
+
+type PilotRequest struct {
+	Id       int
+	Type     PilotRequestType
+	Callsign string
+	Time     time.Time
+	Text     string
+	// Requested altitude for PilotRequestAltitude
+	Altitude int
+	// Degrees to deviate for PilotRequestWeatherDeviation; negative is
+	// to the left.
+	Degrees int
+	// Standby is set once the controller has told the pilot to stand by.
+	Standby bool
+}
+
+type PilotReply int
+
+const (
+	PilotReplyApprove PilotReply = iota
+	PilotReplyDeny
+	PilotReplyStandby
+)
+
+func (sim *Sim) addPilotRequest(ac *Aircraft, t PilotRequestType, altitude int, text string) *PilotRequest {
+	sim.nextPilotRequestId++
+	req := &PilotRequest{
+		Id:       sim.nextPilotRequestId,
+		Type:     t,
+		Callsign: ac.Callsign,
+		Time:     sim.CurrentTime(),
+		Text:     text,
+		Altitude: altitude,
+	}
+	sim.PilotRequests = append(sim.PilotRequests, req)
+	return req
+}
+
+// RespondToPilotRequest issues the given reply to the request; approving
+// it issues the corresponding clearance.
+func (sim *Sim) RespondToPilotRequest(id int, reply PilotReply) error {
+	idx := FindIf(sim.PilotRequests, func(r *PilotRequest) bool { return r.Id == id })
+	if idx == -1 {
+		return ErrNoPilotRequest
+	}
+	req := sim.PilotRequests[idx]
+	if sim.remote != nil {
+		sim.remote.RespondToPilotRequest(req.Callsign, id, reply)
+		return nil
+	}
+	ac, ok := sim.Aircraft[req.Callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+
+	switch reply {
+	case PilotReplyStandby:
+		req.Standby = true
+		pilotReadback(req.Callsign, "request_standby", ReadbackData{})
+		return nil
+
+	case PilotReplyDeny:
+		pilotReadback(req.Callsign, "request_denied", ReadbackData{})
+
+	case PilotReplyApprove:
+		var err error
+		switch req.Type {
+		case PilotRequestAltitude:
+			err = sim.AssignAltitude(req.Callsign, req.Altitude)
+		case PilotRequestWeatherDeviation:
+			sim.deviateForWeather(ac, req.Degrees)
+		case PilotRequestFlightFollowing:
+			err = sim.IssueSquawk(ac.Callsign, 0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	sim.PilotRequests = DeleteSliceElement(sim.PilotRequests, idx)
+	return nil
+}
+
+// updatePilotRequests discards requests from aircraft that are no longer
+// on the user's frequency. VFR aircraft requesting flight following
+// aren't tracked until they have been radar identified.
+func (sim *Sim) updatePilotRequests() {
+	sim.PilotRequests = FilterSlice(sim.PilotRequests, func(r *PilotRequest) bool {
+		ac, ok := sim.Aircraft[r.Callsign]
+		if ok && r.Type == PilotRequestFlightFollowing {
+			return ac.TrackingController == ""
+		}
+		return ok && sim.humanController(ac.TrackingController)
+	})
+}
+
+///////////////////////////////////////////////////////////////////////////
+// PilotMessagePane
+
+// PilotMessagePane lists pending pilot requests, oldest first. Clicking
+// in it takes the keyboard focus; the arrow keys then select a request
+// and A, D, and S approve it, deny it, or tell the pilot to stand by.
+// After replying, the keyboard focus returns to the previous pane.
+type PilotMessagePane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	selected  int // request id
+	scrollbar *ScrollBar
+}
+
+func NewPilotMessagePane() *PilotMessagePane {
+	return &PilotMessagePane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (pm *PilotMessagePane) Activate() {
+	if pm.font = GetFont(pm.FontIdentifier); pm.font == nil {
+		pm.font = GetDefaultFont()
+		pm.FontIdentifier = pm.font.id
+	}
+	if pm.scrollbar == nil {
+		pm.scrollbar = NewScrollBar(4, false)
+	}
+}
+
+func (pm *PilotMessagePane) Deactivate()                {}
+func (pm *PilotMessagePane) CanTakeKeyboardFocus() bool { return true }
+
+func (pm *PilotMessagePane) Name() string { return "Pilot Messages" }
+
+func (pm *PilotMessagePane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&pm.FontIdentifier, "Font"); changed {
+		pm.font = newFont
+	}
+}
+
+func (pm *PilotMessagePane) KeyBindings() []KeyBinding {
+	return []KeyBinding{
+		KeyBinding{Keys: "Click", Description: "Select the request and take the keyboard focus"},
+		KeyBinding{Key: KeyUpArrow, Description: "Select the previous request"},
+		KeyBinding{Key: KeyDownArrow, Description: "Select the next request"},
+		KeyBinding{Keys: "A", Description: "Approve the request"},
+		KeyBinding{Keys: "D", Description: "Deny the request"},
+		KeyBinding{Keys: "S", Description: "Tell the pilot to stand by"},
+		KeyBinding{Key: KeyEscape, Description: "Return the keyboard focus"},
+	}
+}
+
+// selectedIndex returns the index of the selected request in
+// sim.PilotRequests, selecting the first one if the previously-selected
+// one is gone.
+func (pm *PilotMessagePane) selectedIndex() int {
+	if len(sim.PilotRequests) == 0 {
+		return -1
+	}
+	idx := FindIf(sim.PilotRequests, func(r *PilotRequest) bool { return r.Id == pm.selected })
+	if idx == -1 {
+		idx = 0
+		pm.selected = sim.PilotRequests[0].Id
+	}
+	return idx
+}
+
+func (pm *PilotMessagePane) processKeyboard(ctx *PaneContext) {
+	if !ctx.haveFocus || ctx.keyboard == nil {
+		return
+	}
+
+	idx := pm.selectedIndex()
+	if ctx.keyboard.IsPressed(KeyEscape) {
+		wmReleaseKeyboardFocus()
+		return
+	}
+	if idx == -1 {
+		return
+	}
+	if ctx.keyboard.IsPressed(KeyUpArrow) && idx > 0 {
+		pm.selected = sim.PilotRequests[idx-1].Id
+	}
+	if ctx.keyboard.IsPressed(KeyDownArrow) && idx+1 < len(sim.PilotRequests) {
+		pm.selected = sim.PilotRequests[idx+1].Id
+	}
+
+	replies := map[byte]PilotReply{'A': PilotReplyApprove, 'D': PilotReplyDeny, 'S': PilotReplyStandby}
+	for _, ch := range strings.ToUpper(ctx.keyboard.Input) {
+		if reply, ok := replies[byte(ch)]; ok {
+			if err := sim.RespondToPilotRequest(pm.selected, reply); err != nil {
+				lg.Errorf("%d: %v", pm.selected, err)
+				globalConfig.Audio.PlaySound(AudioEventCommandError)
+			}
+			wmReleaseKeyboardFocus()
+			return
+		}
+	}
+}
+
+func (pm *PilotMessagePane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	pm.processKeyboard(ctx)
+
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := pm.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(pm.font.size)
+	indent := float32(int32(fw / 2))
+	height := ctx.paneExtent.Height()
+
+	requests := sim.PilotRequests
+	visibleLines := int((height - indent) / fh)
+	pm.scrollbar.Update(len(requests), visibleLines, ctx)
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	y := height - indent
+	if len(requests) == 0 {
+		td.AddText("No pending pilot requests", [2]float32{indent, y}, TextStyle{Font: pm.font, Color: UITextColor})
+	}
+
+	selected := pm.selectedIndex()
+	for i := pm.scrollbar.Offset(); i < min(len(requests), pm.scrollbar.Offset()+visibleLines); i++ {
+		req := requests[i]
+
+		// Clicking on a request selects it and takes the keyboard focus
+		// so that it can be replied to.
+		if ctx.mouse != nil && ctx.mouse.Clicked[MouseButtonPrimary] &&
+			ctx.mouse.Pos[1] <= y && ctx.mouse.Pos[1] > y-fh {
+			pm.selected, selected = req.Id, i
+			wmTakeKeyboardFocus(pm, true)
+		}
+
+		style := TextStyle{Font: pm.font, Color: UITextColor}
+		if req.Standby {
+			style.Color = UITextColor.Scale(0.6)
+		}
+		if i == selected && ctx.haveFocus {
+			style.DrawBackground = true
+			style.BackgroundColor = UITextHighlightColor
+			style.Color = RGB{}
+		}
+
+		text := fmt.Sprintf("%s %-8s %s", req.Time.Format("1504"), req.Callsign, req.Text)
+		if req.Standby {
+			text += " (STANDBY)"
+		}
+		td.AddText(text, [2]float32{indent, y}, style)
+		y -= fh
+	}
+
+	pm.scrollbar.Draw(ctx, cb)
+	td.GenerateCommands(cb)
+}
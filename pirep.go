@@ -0,0 +1,225 @@
+// pirep.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scenarios may define layers of turbulence or icing; aircraft that fly
+// through them report it to the user, ask to get out of it, and a PIREP
+// is filed so that subsequent aircraft can be advised. The PIREP command
+// advises an aircraft of the nearby PIREPs; if any of them are of
+// moderate or severe conditions near its altitude, it asks for an
+// altitude that avoids them.
+
+type WeatherLayer struct {
+	Type      string `json:"type"`      // "turbulence" or "icing"
+	Intensity string `json:"intensity"` // "LGT", "MOD", or "SEV"
+	Floor     int    `json:"floor"`
+	Ceiling   int    `json:"ceiling"`
+
+	// Optional; if unspecified, the layer extends over the entire
+	// scenario area.
+	CenterString string   `json:"center,omitempty"`
+	Center       Point2LL `json:"-"`
+	Radius       float32  `json:"radius,omitempty"`
+}
+
+func (wl *WeatherLayer) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if wl.Type != "turbulence" && wl.Type != "icing" {
+		e.ErrorString("\"type\" must be \"turbulence\" or \"icing\"")
+	}
+	if wl.Intensity != "LGT" && wl.Intensity != "MOD" && wl.Intensity != "SEV" {
+		e.ErrorString("\"intensity\" must be \"LGT\", \"MOD\", or \"SEV\"")
+	}
+	if wl.Ceiling <= wl.Floor {
+		e.ErrorString("\"ceiling\" %d must be greater than \"floor\" %d", wl.Ceiling, wl.Floor)
+	}
+	if wl.CenterString != "" {
+		if p, ok := sg.Locate(wl.CenterString); !ok {
+			e.ErrorString("unknown location \"%s\" for \"center\"", wl.CenterString)
+		} else {
+			wl.Center = p
+		}
+		if wl.Radius <= 0 {
+			e.ErrorString("\"radius\" must be given with \"center\"")
+		}
+	}
+}
+
+// Inside returns true if the given aircraft is in the weather layer.
+func (wl *WeatherLayer) Inside(ac *Aircraft) bool {
+	alt := int(ac.Altitude)
+	if alt < wl.Floor || alt > wl.Ceiling {
+		return false
+	}
+	return wl.CenterString == "" || nmdistance2ll(ac.Position, wl.Center) <= wl.Radius
+}
+
+// Spoken returns a description of the conditions as a pilot would
+// report them.
+func (wl *WeatherLayer) Spoken() string {
+	intensity := map[string]string{"LGT": "light", "MOD": "moderate", "SEV": "severe"}[wl.Intensity]
+	if wl.Type == "icing" {
+		return intensity + " rime ice"
+	}
+	return intensity + " chop"
+}
+
+type PIREP struct {
+	Time         time.Time
+	Callsign     string
+	AircraftType string
+	Location     string
+	Position     Point2LL
+	Altitude     int
+	Type         string
+	Intensity    string
+}
+
+// String returns the PIREP in a form similar to the standard encoding:
+// e.g., "UA /OV JFK090020/TM 1512/FL110/TP B738/TB MOD".
+func (p PIREP) String() string {
+	ua := "UA"
+	if p.Intensity == "SEV" {
+		ua = "UUA"
+	}
+	typ := "TB"
+	if p.Type == "icing" {
+		typ = "IC"
+	}
+	return fmt.Sprintf("%s /OV %s/TM %s/FL%03d/TP %s/%s %s", ua, p.Location,
+		p.Time.UTC().Format("1504"), (p.Altitude+50)/100, p.AircraftType, typ, p.Intensity)
+}
+
+// How long PIREPs are kept and the per-second probability that an
+// aircraft in a weather layer reports it.
+const (
+	pirepLifetime   = time.Hour
+	pirepReportProb = 0.05
+)
+
+// Aircraft that are advised of PIREPs consider those within this many nm
+// and feet of them and stay this many feet clear of them.
+const (
+	pirepAdvisoryRadius   = 40
+	pirepAdvisoryAltitude = 2000
+	pirepAvoidAltitude    = 2000
+)
+
+// pirepLocation returns the given position as a bearing and distance from
+// the scenario group's primary airport, e.g., "JFK270015".
+func pirepLocation(p Point2LL) string {
+	ap := scenarioGroup.PrimaryAirport
+	loc, ok := scenarioGroup.Locate(ap)
+	if !ok {
+		return p.DMSString()
+	}
+	hdg := int(headingp2ll(loc, p, scenarioGroup.MagneticVariation)+0.5) % 360
+	if hdg == 0 {
+		hdg = 360
+	}
+	dist := int(nmdistance2ll(loc, p) + 0.5)
+	return fmt.Sprintf("%s%03d%03d", strings.TrimPrefix(ap, "K"), hdg, dist)
+}
+
+// updatePIREPs expires old PIREPs and has aircraft in weather layers
+// report it. Aircraft only report a given layer once.
+func (sim *Sim) updatePIREPs(now time.Time) {
+	sim.PIREPs = FilterSlice(sim.PIREPs, func(p PIREP) bool { return now.Sub(p.Time) < pirepLifetime })
+
+	if sim.pirepReported == nil {
+		sim.pirepReported = make(map[string]map[int]interface{})
+	}
+
+	for i := range sim.Scenario.WeatherLayers {
+		wl := &sim.Scenario.WeatherLayers[i]
+		for _, ac := range sim.Aircraft {
+			if _, ok := sim.pirepReported[ac.Callsign][i]; ok || !wl.Inside(ac) {
+				continue
+			}
+			if rand.Float32() > pirepReportProb {
+				continue
+			}
+
+			if sim.pirepReported[ac.Callsign] == nil {
+				sim.pirepReported[ac.Callsign] = make(map[int]interface{})
+			}
+			sim.pirepReported[ac.Callsign][i] = nil
+
+			pirep := PIREP{
+				Time:      now,
+				Callsign:  ac.Callsign,
+				Location:  pirepLocation(ac.Position),
+				Position:  ac.Position,
+				Altitude:  int(ac.Altitude),
+				Type:      wl.Type,
+				Intensity: wl.Intensity,
+			}
+			if fp := ac.FlightPlan; fp != nil {
+				pirep.AircraftType = fp.BaseType()
+			}
+			sim.PIREPs = append(sim.PIREPs, pirep)
+
+			// Only aircraft on the user's frequency tell the user
+			// about it; they ask to get out of it, above or below,
+			// whichever is closer.
+			if ac.TrackingController == sim.Callsign() {
+				request := "lower"
+				alt := max(1000, 1000*((wl.Floor-1000)/1000))
+				if wl.Ceiling-int(ac.Altitude) < int(ac.Altitude)-wl.Floor {
+					request = "higher"
+					alt = 1000 * ((wl.Ceiling + 1999) / 1000)
+				}
+				pilotResponse(ac.Callsign, "we're getting %s at %d, request %s", wl.Spoken(),
+					100*((int(ac.Altitude)+50)/100), request)
+				sim.addPilotRequest(ac, PilotRequestAltitude, alt,
+					fmt.Sprintf("%s at %d, request %d", wl.Spoken(), 100*((int(ac.Altitude)+50)/100), alt))
+			}
+		}
+	}
+}
+
+// AdvisePIREPs advises the aircraft of the PIREPs near it; it asks for an
+// altitude clear of the closest one, in altitude, of moderate or severe
+// conditions near its altitude.
+func (sim *Sim) AdvisePIREPs(callsign string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+
+	var closest *PIREP
+	for i, p := range sim.PIREPs {
+		if p.Intensity == "LGT" || nmdistance2ll(ac.Position, p.Position) > pirepAdvisoryRadius ||
+			abs(p.Altitude-int(ac.Altitude)) > pirepAdvisoryAltitude {
+			continue
+		}
+		if closest == nil || abs(p.Altitude-int(ac.Altitude)) < abs(closest.Altitude-int(ac.Altitude)) {
+			closest = &sim.PIREPs[i]
+		}
+	}
+
+	if closest == nil {
+		pilotResponse(callsign, "thanks for the PIREPs")
+		return nil
+	}
+
+	// Ask to stay on the side of it that the aircraft is already on.
+	request := "lower"
+	alt := max(1000, 1000*((closest.Altitude-pirepAvoidAltitude)/1000))
+	if int(ac.Altitude) > closest.Altitude {
+		request = "higher"
+		alt = 1000 * ((closest.Altitude + pirepAvoidAltitude + 999) / 1000)
+	}
+	wl := WeatherLayer{Type: closest.Type, Intensity: closest.Intensity}
+	pilotResponse(callsign, "thanks, we'd like to avoid the %s, request %s", wl.Spoken(), request)
+	sim.addPilotRequest(ac, PilotRequestAltitude, alt,
+		fmt.Sprintf("avoid %s at %d, request %d", wl.Spoken(), closest.Altitude, alt))
+	return nil
+}
@@ -38,6 +38,9 @@ type Platform interface {
 	// InputCharacters returns a string of all the characters (generally at most one!) that have
 	// been entered since the last call to ProcessEvents.
 	InputCharacters() string
+	// HadUserInput returns true if the user pressed a key, moved or
+	// clicked the mouse, or scrolled at the last call to ProcessEvents.
+	HadUserInput() bool
 	// EnableVSync specifies whether v-sync should be used when rendering;
 	// v-sync is on by default and should only be disabled for benchmarking.
 	EnableVSync(sync bool)
@@ -57,6 +60,19 @@ type Platform interface {
 	StartCaptureMouse(e Extent2D)
 	// Disable mouse capture.
 	EndCaptureMouse()
+	// IsFocused returns true if the window has the input focus.
+	IsFocused() bool
+	// GetGamepad returns the state of the first connected gamepad's
+	// analog controls; it returns false if there is no gamepad.
+	GetGamepad() (GamepadState, bool)
+}
+
+// GamepadState stores the positions of a gamepad's analog controls. Stick
+// axes range from -1 to 1, with positive y down, and triggers range from
+// 0 when released to 1.
+type GamepadState struct {
+	LeftStick, RightStick     [2]float32
+	LeftTrigger, RightTrigger float32
 }
 
 // Scaling factor to account for Retina-style displays
@@ -78,6 +94,7 @@ type GLFWPlatform struct {
 	currentCursor          *glfw.Cursor
 	inputCharacters        string
 	anyEvents              bool
+	hadUserInput           bool
 	lastMouseX, lastMouseY float64
 	multisample            bool
 	windowTitle            string
@@ -152,6 +169,38 @@ func (g *GLFWPlatform) InputCharacters() string {
 	return g.inputCharacters
 }
 
+func (g *GLFWPlatform) IsFocused() bool {
+	return g.window.GetAttrib(glfw.Focused) != 0
+}
+
+func (g *GLFWPlatform) GetGamepad() (GamepadState, bool) {
+	for joy := glfw.Joystick1; joy <= glfw.JoystickLast; joy++ {
+		if !glfw.JoystickPresent(joy) {
+			continue
+		}
+		axes := glfw.GetJoystickAxes(joy)
+		if len(axes) < 2 {
+			continue
+		}
+
+		// GLFW 3.2 doesn't provide standardized gamepad mappings, so
+		// assume the layout of XInput controllers, which are the most
+		// common: the left stick, the right stick, and then the two
+		// triggers, which are at -1 when released.
+		var gs GamepadState
+		gs.LeftStick = [2]float32{axes[0], axes[1]}
+		if len(axes) >= 4 {
+			gs.RightStick = [2]float32{axes[2], axes[3]}
+		}
+		if len(axes) >= 6 {
+			gs.LeftTrigger = (axes[4] + 1) / 2
+			gs.RightTrigger = (axes[5] + 1) / 2
+		}
+		return gs, true
+	}
+	return GamepadState{}, false
+}
+
 func (g *GLFWPlatform) ShouldStop() bool {
 	return g.window.ShouldClose()
 }
@@ -160,7 +209,16 @@ func (g *GLFWPlatform) CancelShouldStop() {
 	g.window.SetShouldClose(false)
 }
 
+func (g *GLFWPlatform) HadUserInput() bool {
+	return g.hadUserInput
+}
+
 func (g *GLFWPlatform) ProcessEvents() bool {
+	g.hadUserInput = g.processEvents()
+	return g.hadUserInput
+}
+
+func (g *GLFWPlatform) processEvents() bool {
 	g.inputCharacters = ""
 	g.anyEvents = false
 
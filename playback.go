@@ -0,0 +1,355 @@
+// playback.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+///////////////////////////////////////////////////////////////////////////
+// SessionRecording
+
+// SessionRecording records the radar tracks of all of the aircraft over
+// the course of a session along with notable events so that the session
+// can be reviewed afterward in the PlaybackPane. So that long sessions
+// don't use unbounded memory, only the most recent
+// sessionRecordingMaxDuration of the session is kept.
+type SessionRecording struct {
+	Start, End time.Time
+	Tracks     map[string][]RadarTrack
+	Events     []SessionEvent
+
+	// Pairs of aircraft that are currently in conflict, so that we only
+	// record a single event for each conflict.
+	conflicts map[[2]string]interface{}
+}
+
+const (
+	// Amount of the session that recordings keep.
+	sessionRecordingMaxDuration = 4 * time.Hour
+	// Older tracks and events are discarded once they are this far past
+	// the maximum duration, so that it isn't done after every update.
+	sessionRecordingTrimSlack = 10 * time.Minute
+)
+
+type SessionEventType int
+
+const (
+	SessionEventHandoff SessionEventType = iota
+	SessionEventConflict
+	SessionEventGoAround
+	SessionEventSimilarCallsign
+	SessionEventDeviation
+	SessionEventEmergency
+)
+
+type SessionEvent struct {
+	Type        SessionEventType
+	Time        time.Time
+	Callsign    string
+	Position    Point2LL
+	Description string
+}
+
+func NewSessionRecording(start time.Time) *SessionRecording {
+	return &SessionRecording{
+		Start:     start,
+		End:       start,
+		Tracks:    make(map[string][]RadarTrack),
+		conflicts: make(map[[2]string]interface{}),
+	}
+}
+
+func (r *SessionRecording) AddTrack(callsign string, track RadarTrack) {
+	r.Tracks[callsign] = append(r.Tracks[callsign], track)
+	if track.Time.After(r.End) {
+		r.End = track.Time
+	}
+	if r.End.Sub(r.Start) > sessionRecordingMaxDuration+sessionRecordingTrimSlack {
+		r.trim(r.End.Add(-sessionRecordingMaxDuration))
+	}
+}
+
+// trim discards the tracks and events from before the given time.
+func (r *SessionRecording) trim(start time.Time) {
+	for callsign, tracks := range r.Tracks {
+		idx := FindIf(tracks, func(t RadarTrack) bool { return !t.Time.Before(start) })
+		if idx == -1 {
+			delete(r.Tracks, callsign)
+		} else {
+			// Copy so that the discarded tracks can be freed.
+			r.Tracks[callsign] = DuplicateSlice(tracks[idx:])
+		}
+	}
+	r.Events = FilterSlice(r.Events, func(e SessionEvent) bool { return !e.Time.Before(start) })
+	r.Start = start
+}
+
+func (r *SessionRecording) AddEvent(t SessionEventType, ac *Aircraft, now time.Time, format string, args ...interface{}) {
+	r.Events = append(r.Events, SessionEvent{
+		Type:        t,
+		Time:        now,
+		Callsign:    ac.Callsign,
+		Position:    ac.Position,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// CheckConflicts records a conflict event for each pair of aircraft that
+// has newly lost standard separation (3nm laterally / 1000' vertically).
+// As with STARS conflict alerts, aircraft below 1000' and aircraft on
+// different approaches that don't share a final are excluded.
+func (r *SessionRecording) CheckConflicts(aircraft map[string]*Aircraft, now time.Time) {
+	callsigns := SortedMapKeys(aircraft)
+	for i, cs0 := range callsigns {
+		ac0 := aircraft[cs0]
+		for _, cs1 := range callsigns[i+1:] {
+			ac1 := aircraft[cs1]
+			key := [2]string{cs0, cs1}
+
+			conflict := ac0.Altitude >= 1000 && ac1.Altitude >= 1000 &&
+				(ac0.Approach == nil || ac1.Approach == nil || ac0.Approach == ac1.Approach ||
+					sim.onSharedFinal(ac0, ac1)) &&
+				nmdistance2ll(ac0.Position, ac1.Position) < 3 &&
+				abs(ac0.Altitude-ac1.Altitude) < 1000
+
+			if !conflict {
+				delete(r.conflicts, key)
+			} else if _, ok := r.conflicts[key]; !ok {
+				r.conflicts[key] = nil
+				r.AddEvent(SessionEventConflict, ac0, now, "%s/%s conflict: %.1fnm, %d'", cs0, cs1,
+					nmdistance2ll(ac0.Position, ac1.Position), int(abs(ac0.Altitude-ac1.Altitude)))
+			}
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// PlaybackPane
+
+// PlaybackPane draws the ground tracks of all of the aircraft in a
+// SessionRecording. A timeline at the bottom of the pane shows markers for
+// the recorded events; clicking or dragging in it sets the playback time.
+// The primary mouse button pans the map and the mouse wheel zooms.
+type PlaybackPane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	PlaybackRate float32
+
+	recording *SessionRecording
+	time      time.Time
+	playing   bool
+	lastDraw  time.Time
+
+	center  Point2LL
+	rangeNM float32
+}
+
+func NewPlaybackPane(r *SessionRecording) *PlaybackPane {
+	pp := &PlaybackPane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+		PlaybackRate:   30,
+		recording:      r,
+		time:           r.End,
+		rangeNM:        40,
+		center:         scenarioGroup.Center,
+	}
+
+	var pts [][2]float32
+	for _, tracks := range r.Tracks {
+		for _, t := range tracks {
+			pts = append(pts, t.Position)
+		}
+	}
+	if len(pts) > 0 {
+		e := Extent2DFromPoints(pts)
+		pp.center = e.Center()
+		pp.rangeNM = max(10, 0.6*max(e.Width()*scenarioGroup.NmPerLongitude, e.Height()*scenarioGroup.NmPerLatitude))
+	}
+
+	return pp
+}
+
+func (pp *PlaybackPane) Activate() {
+	if pp.font = GetFont(pp.FontIdentifier); pp.font == nil {
+		pp.font = GetDefaultFont()
+		pp.FontIdentifier = pp.font.id
+	}
+	if pp.rangeNM == 0 {
+		pp.rangeNM = 40
+		pp.center = scenarioGroup.Center
+	}
+	if pp.PlaybackRate == 0 {
+		pp.PlaybackRate = 30
+	}
+}
+
+func (pp *PlaybackPane) Deactivate()                {}
+func (pp *PlaybackPane) CanTakeKeyboardFocus() bool { return false }
+
+func (pp *PlaybackPane) Name() string { return "Session Playback" }
+
+func (pp *PlaybackPane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&pp.FontIdentifier, "Font"); changed {
+		pp.font = newFont
+	}
+	imgui.SliderFloatV("Playback rate", &pp.PlaybackRate, 1, 120, "%.0fx", 0)
+}
+
+func (e SessionEventType) Color() RGB {
+	switch e {
+	case SessionEventHandoff:
+		return RGB{.3, .6, 1}
+	case SessionEventConflict, SessionEventDeviation:
+		return UIErrorColor
+	case SessionEventGoAround, SessionEventSimilarCallsign, SessionEventEmergency:
+		return UICautionColor
+	default:
+		return UITextColor
+	}
+}
+
+func (pp *PlaybackPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	now := time.Now()
+	if pp.recording == nil {
+		// We were deserialized from a saved config; there's nothing to show.
+		ctx.SetWindowCoordinateMatrices(cb)
+		td := GetTextDrawBuilder()
+		defer ReturnTextDrawBuilder(td)
+		td.AddText("No session recording available.", [2]float32{10, ctx.paneExtent.Height() - 10},
+			TextStyle{Font: pp.font, Color: UITextColor})
+		td.GenerateCommands(cb)
+		return
+	}
+
+	r := pp.recording
+	if pp.playing {
+		elapsed := now.Sub(pp.lastDraw)
+		pp.time = pp.time.Add(time.Duration(float32(elapsed) * pp.PlaybackRate))
+		if !pp.time.Before(r.End) {
+			pp.time = r.End
+			pp.playing = false
+		}
+	}
+	pp.lastDraw = now
+
+	fh := float32(pp.font.size)
+	width := ctx.paneExtent.Width()
+	timelineHeight := 3 * fh
+	tx0, tx1 := 6*fh, width-fh // extent of the timeline itself
+	duration := r.End.Sub(r.Start)
+
+	timeToX := func(t time.Time) float32 {
+		if duration == 0 {
+			return tx0
+		}
+		return lerp(float32(t.Sub(r.Start))/float32(duration), tx0, tx1)
+	}
+
+	transforms := GetScopeTransformations(ctx, pp.center, pp.rangeNM, 0)
+
+	// Mouse: the timeline and play button at the bottom, panning and
+	// zooming for the rest of the pane.
+	if ctx.mouse != nil {
+		if ctx.mouse.Pos[1] < timelineHeight {
+			if ctx.mouse.Clicked[MouseButtonPrimary] && ctx.mouse.Pos[0] < tx0 {
+				if !pp.time.Before(r.End) {
+					pp.time = r.Start
+				}
+				pp.playing = !pp.playing
+			} else if ctx.mouse.Down[MouseButtonPrimary] && ctx.mouse.Pos[0] >= tx0 {
+				f := clamp((ctx.mouse.Pos[0]-tx0)/(tx1-tx0), 0, 1)
+				pp.time = r.Start.Add(time.Duration(f * float32(duration)))
+			}
+		} else {
+			UpdateScopePosition(ctx.mouse, MouseButtonPrimary, transforms, &pp.center, &pp.rangeNM)
+		}
+	}
+
+	ld := GetColoredLinesDrawBuilder()
+	defer ReturnColoredLinesDrawBuilder(ld)
+	trid := GetColoredTrianglesDrawBuilder()
+	defer ReturnColoredTrianglesDrawBuilder(trid)
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	// Ground tracks up through the current time; the most recent position
+	// of aircraft that are still around at the current time is labeled.
+	trackColor := RGB{.5, .5, .5}
+	for _, callsign := range SortedMapKeys(r.Tracks) {
+		tracks := r.Tracks[callsign]
+		var prev [2]float32
+		n := 0
+		for i, t := range tracks {
+			if t.Time.After(pp.time) {
+				break
+			}
+			pw := transforms.WindowFromLatLongP(t.Position)
+			if i > 0 {
+				ld.AddLine(prev, pw, trackColor)
+			}
+			prev = pw
+			n++
+		}
+		if n > 0 && pp.time.Sub(tracks[n-1].Time) < 10*time.Second {
+			trid.AddCircle(prev, 3, 8, UITextColor)
+			label := fmt.Sprintf("%s %03d", callsign, (tracks[n-1].Altitude+50)/100)
+			td.AddText(label, add2f(prev, [2]float32{5, 5}), TextStyle{Font: pp.font, Color: UITextColor})
+		}
+	}
+
+	// Event markers on the map
+	for _, e := range r.Events {
+		if e.Time.After(pp.time) {
+			continue
+		}
+		pw := transforms.WindowFromLatLongP(e.Position)
+		ld.AddCircle(pw, 6, 12, e.Type.Color())
+		if pp.time.Sub(e.Time) < 2*time.Minute {
+			td.AddText(e.Description, add2f(pw, [2]float32{8, -8}), TextStyle{Font: pp.font, Color: e.Type.Color()})
+		}
+	}
+
+	transforms.LoadWindowViewingMatrices(cb)
+	cb.LineWidth(1)
+	ld.GenerateCommands(cb)
+	trid.GenerateCommands(cb)
+
+	// The timeline: background, time axis, and cursor.
+	ctx.SetWindowCoordinateMatrices(cb)
+	tbg := GetTrianglesDrawBuilder()
+	defer ReturnTrianglesDrawBuilder(tbg)
+	tbg.AddQuad([2]float32{0, 0}, [2]float32{width, 0}, [2]float32{width, timelineHeight}, [2]float32{0, timelineHeight})
+	cb.SetRGB(RGB{})
+	tbg.GenerateCommands(cb)
+
+	tl := GetColoredLinesDrawBuilder()
+	defer ReturnColoredLinesDrawBuilder(tl)
+	tl.AddLine([2]float32{0, timelineHeight}, [2]float32{width, timelineHeight}, UIControlColor)
+	tl.AddLine([2]float32{tx0, fh * 1.25}, [2]float32{tx1, fh * 1.25}, UIControlColor)
+	cx := timeToX(pp.time)
+	tl.AddLine([2]float32{cx, 0}, [2]float32{cx, 2.5 * fh}, UITextHighlightColor)
+	for _, e := range r.Events {
+		x := timeToX(e.Time)
+		tl.AddLine([2]float32{x, fh / 2}, [2]float32{x, 2 * fh}, e.Type.Color())
+	}
+	tl.GenerateCommands(cb)
+
+	style := TextStyle{Font: pp.font, Color: UITextColor}
+	button := "PLAY"
+	if pp.playing {
+		button = "PAUSE"
+	}
+	td.AddText(button, [2]float32{fh / 2, 1.75 * fh}, style)
+	elapsed := pp.time.Sub(r.Start).Round(time.Second)
+	td.AddText(elapsed.String(), [2]float32{tx0, timelineHeight + 1.5*fh}, style)
+	td.AddText(fmt.Sprintf("%d aircraft, %d events", len(r.Tracks), len(r.Events)),
+		[2]float32{tx0 + 10*fh, timelineHeight + 1.5*fh}, style)
+	td.GenerateCommands(cb)
+}
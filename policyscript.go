@@ -0,0 +1,143 @@
+// policyscript.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// A controller policy may give a "script" that decides when the virtual
+// controller hands an aircraft it's tracking off to the user and what it
+// assigns the aircraft first, so that facilities can encode their LOA
+// rather than relying on the generic handoff_distance behavior. Scripts
+// use Go's text/template syntax, like readbacks (see readbacks.go); they
+// run once a second for each aircraft the policy's controller is
+// tracking, with the fields and methods of PolicyScriptContext. For
+// example:
+//
+//	{{if and (eq .ArrivalAirport "KJFK") (lt (.DistanceTo "CAMRN") 5.0)}}
+//	  {{.AssignAltitude 11000}}{{.AssignSpeed 250}}{{.Handoff}}
+//	{{end}}
+//
+// Anything the script outputs is ignored.
+
+// PolicyScriptContext is the data that controller policy scripts are run
+// with.
+type PolicyScriptContext struct {
+	Callsign         string
+	Controller       string // the tracking controller
+	AircraftType     string
+	DepartureAirport string
+	ArrivalAirport   string
+	Route            string
+	Altitude         int
+	AssignedAltitude int
+	IAS              int
+	Heading          int
+	// Nautical miles to the arrival airport, or 0 if it isn't known.
+	Distance float32
+	// Number of aircraft the controller is tracking.
+	Tracked int
+
+	handoff  bool
+	altitude int
+	speed    int
+}
+
+// Handoff has the controller hand the aircraft off to the user.
+func (c *PolicyScriptContext) Handoff() string {
+	c.handoff = true
+	return ""
+}
+
+// AssignAltitude has the controller assign the aircraft the given
+// altitude.
+func (c *PolicyScriptContext) AssignAltitude(alt int) string {
+	c.altitude = alt
+	return ""
+}
+
+// AssignSpeed has the controller assign the aircraft the given speed.
+func (c *PolicyScriptContext) AssignSpeed(kts int) string {
+	c.speed = kts
+	return ""
+}
+
+// DistanceTo returns the distance in nm from the aircraft to the given
+// fix, airport, or navaid.
+func (c *PolicyScriptContext) DistanceTo(fix string) (float32, error) {
+	if c.Callsign == "" {
+		// Checking the script when the scenario is loaded.
+		return 0, nil
+	}
+	ac, ok := sim.Aircraft[c.Callsign]
+	if !ok {
+		return 0, ErrNoAircraftForCallsign
+	}
+	p, ok := scenarioGroup.Locate(fix)
+	if !ok {
+		return 0, fmt.Errorf("%s: unknown fix", fix)
+	}
+	return nmdistance2ll(ac.Position, p), nil
+}
+
+// parsePolicyScript parses a controller policy's script and runs it
+// once to catch references to fields and methods that don't exist.
+func parsePolicyScript(script string, e *ErrorLogger) *template.Template {
+	t, err := template.New("script").Parse(script)
+	if err != nil {
+		e.Error(err)
+		return nil
+	}
+	if err := t.Execute(&strings.Builder{}, &PolicyScriptContext{}); err != nil {
+		e.Error(err)
+		return nil
+	}
+	return t
+}
+
+// runPolicyScript runs the policy's script for an aircraft tracked by one
+// of the virtual controllers and carries out its decisions.
+func (sim *Sim) runPolicyScript(policy *ControllerPolicy, ac *Aircraft) {
+	fp := ac.FlightPlan
+	ctx := &PolicyScriptContext{
+		Callsign:         ac.Callsign,
+		Controller:       ac.TrackingController,
+		AircraftType:     fp.BaseType(),
+		DepartureAirport: fp.DepartureAirport,
+		ArrivalAirport:   fp.ArrivalAirport,
+		Route:            fp.Route,
+		Altitude:         int(ac.Altitude),
+		AssignedAltitude: ac.AssignedAltitude,
+		IAS:              int(ac.IAS),
+		Heading:          int(ac.Heading),
+		Tracked: len(sim.GetFilteredAircraft(func(a *Aircraft) bool {
+			return a.TrackingController == ac.TrackingController
+		})),
+	}
+	if ap, ok := scenarioGroup.Locate(fp.ArrivalAirport); ok {
+		ctx.Distance = nmdistance2ll(ac.Position, ap)
+	}
+
+	if err := policy.script.Execute(&strings.Builder{}, ctx); err != nil {
+		// Don't keep reporting the same error every second.
+		lg.Errorf("%s: controller policy script: %v", ac.TrackingController, err)
+		policy.script = nil
+		return
+	}
+
+	if ctx.altitude != 0 && ctx.altitude != ac.AssignedAltitude {
+		ac.AssignedAltitude = ctx.altitude
+		eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+	}
+	if ctx.speed != 0 {
+		ac.AssignedSpeed = ctx.speed
+	}
+	if ctx.handoff {
+		sim.policyHandoff(ac)
+	}
+}
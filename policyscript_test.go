@@ -0,0 +1,49 @@
+// policyscript_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyScript(t *testing.T) {
+	for _, test := range []struct {
+		script          string
+		ctx             PolicyScriptContext
+		handoff         bool
+		altitude, speed int
+	}{
+		{`{{if lt .Distance 30.0}}{{.Handoff}}{{end}}`, PolicyScriptContext{Distance: 25}, true, 0, 0},
+		{`{{if lt .Distance 30.0}}{{.Handoff}}{{end}}`, PolicyScriptContext{Distance: 35}, false, 0, 0},
+		{`{{if eq .ArrivalAirport "KJFK"}}{{.AssignAltitude 11000}}{{.AssignSpeed 250}}{{end}}`,
+			PolicyScriptContext{ArrivalAirport: "KJFK"}, false, 11000, 250},
+		{`{{if gt .Altitude 10000}}{{.AssignAltitude 10000}}{{else}}{{.Handoff}}{{end}}`,
+			PolicyScriptContext{Altitude: 12000}, false, 10000, 0},
+		{`{{if gt .Altitude 10000}}{{.AssignAltitude 10000}}{{else}}{{.Handoff}}{{end}}`,
+			PolicyScriptContext{Altitude: 10000}, true, 0, 0},
+	} {
+		var e ErrorLogger
+		s := parsePolicyScript(test.script, &e)
+		if e.HaveErrors() {
+			t.Errorf("%q: unexpected errors: %s", test.script, e.String())
+			continue
+		}
+		ctx := test.ctx
+		if err := s.Execute(&strings.Builder{}, &ctx); err != nil {
+			t.Errorf("%q: %v", test.script, err)
+		} else if ctx.handoff != test.handoff || ctx.altitude != test.altitude || ctx.speed != test.speed {
+			t.Errorf("%q: got handoff %v altitude %d speed %d, expected %v %d %d", test.script,
+				ctx.handoff, ctx.altitude, ctx.speed, test.handoff, test.altitude, test.speed)
+		}
+	}
+
+	for _, script := range []string{`{{if}}`, `{{.Runway}}`, `{{.AssignAltitude "high"}}`} {
+		var e ErrorLogger
+		if parsePolicyScript(script, &e) != nil || !e.HaveErrors() {
+			t.Errorf("%q: expected an error", script)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// precipitation.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// The Sim can model precipitation as a set of cells, each with a peak
+// intensity on the six-level scale that the STARS weather display uses;
+// the intensity falls off toward the edge of the cell. The cells either
+// come from the scenario or are randomly generated around the scenario
+// group's center, and they drift with the wind over the course of the
+// session; random cells that drift away are replaced by new ones upwind.
+// When the Sim has precipitation, the STARS WX buttons show it rather
+// than real-world radar imagery. Aircraft whose route takes them through
+// heavy precipitation (level 4 and up) below the cell's tops
+// occasionally ask to deviate around it.
+
+type PrecipitationCellSpec struct {
+	Center string  `json:"center"`
+	Radius float32 `json:"radius"` // nm
+	Level  int     `json:"level"`  // peak level, 1-6
+	Tops   int     `json:"tops,omitempty"`
+
+	location Point2LL
+}
+
+func (p *PrecipitationCellSpec) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if loc, ok := sg.Locate(p.Center); !ok {
+		e.ErrorString("unknown location \"%s\" in \"center\"", p.Center)
+	} else {
+		p.location = loc
+	}
+	if p.Radius <= 0 {
+		e.ErrorString("\"radius\" must be positive")
+	}
+	if p.Level < 1 || p.Level > 6 {
+		e.ErrorString("\"level\" must be between 1 and 6")
+	}
+	if p.Tops < 0 {
+		e.ErrorString("\"tops\" must not be negative")
+	}
+}
+
+type PrecipitationCell struct {
+	Id     int
+	Center Point2LL
+	Radius float32
+	Level  int
+	Tops   int
+}
+
+const (
+	// Random cells are generated within this many nm of the scenario
+	// group's center and replaced once they drift farther than that.
+	precipitationRadius = 80
+	// Number of random cells.
+	precipitationRandomCells = 10
+	// Cells move faster than the surface wind, which is all that
+	// scenarios specify.
+	precipitationSteeringFactor = 1.5
+	// Aircraft look this far ahead along their route for heavy
+	// precipitation.
+	precipitationLookaheadNM = 30
+	// Lowest level that aircraft try to avoid.
+	precipitationDeviationLevel = 4
+	// Probability that an aircraft asks to deviate around a given cell
+	// that's on its route.
+	precipitationDeviationProbability = 0.5
+	// Default tops for cells that don't specify them.
+	precipitationDefaultTops = 35000
+)
+
+// LevelAt returns the precipitation level at p, from 0 (none) to 6. If
+// alt is positive, cells with tops below it are ignored.
+func (c *PrecipitationCell) LevelAt(p Point2LL, alt float32) int {
+	if alt > 0 && int(alt) > c.Tops {
+		return 0
+	}
+	d := nmdistance2ll(p, c.Center)
+	if d >= c.Radius {
+		return 0
+	}
+	return 1 + int(float32(c.Level-1)*(1-d/c.Radius)+.5)
+}
+
+// PrecipitationLevel returns the highest level of precipitation at p
+// (and at altitude alt, if it is positive).
+func (sim *Sim) PrecipitationLevel(p Point2LL, alt float32) int {
+	level := 0
+	for i := range sim.Precipitation {
+		level = max(level, sim.Precipitation[i].LevelAt(p, alt))
+	}
+	return level
+}
+
+// initializePrecipitation sets up the scenario's precipitation cells or,
+// if it doesn't have any and random is set, random ones.
+func (sim *Sim) initializePrecipitation(random bool) {
+	for _, spec := range sim.Scenario.Precipitation {
+		sim.nextPrecipitationId++
+		tops := spec.Tops
+		if tops == 0 {
+			tops = precipitationDefaultTops
+		}
+		sim.Precipitation = append(sim.Precipitation, PrecipitationCell{
+			Id:     sim.nextPrecipitationId,
+			Center: spec.location,
+			Radius: spec.Radius,
+			Level:  spec.Level,
+			Tops:   tops,
+		})
+	}
+
+	sim.RandomPrecipitation = random && len(sim.Precipitation) == 0
+	if sim.RandomPrecipitation {
+		for i := 0; i < precipitationRandomCells; i++ {
+			// Start anywhere within the area.
+			d := precipitationRadius * sqrt(rand.Float32())
+			sim.Precipitation = append(sim.Precipitation, sim.randomPrecipitationCell(360*rand.Float32(), d))
+		}
+	}
+}
+
+// randomPrecipitationCell returns a new random cell at the given distance
+// from the scenario group's center along the given true bearing.
+func (sim *Sim) randomPrecipitationCell(bearing float32, dist float32) PrecipitationCell {
+	sim.nextPrecipitationId++
+	v := scale2f([2]float32{sin(radians(bearing)), cos(radians(bearing))}, dist)
+	// Lighter precipitation is more common.
+	level := 1 + int(6*rand.Float32()*rand.Float32())
+	return PrecipitationCell{
+		Id:     sim.nextPrecipitationId,
+		Center: nm2ll(add2f(ll2nm(scenarioGroup.Center), v)),
+		Radius: lerp(rand.Float32(), 3, 12),
+		Level:  level,
+		Tops:   20000 + 3000*level + 1000*rand.Intn(5),
+	}
+}
+
+// updatePrecipitation moves the cells with the wind over the given
+// elapsed time and has aircraft ask to deviate around heavy precipitation
+// ahead; it should be called once a second.
+func (sim *Sim) updatePrecipitation(elapsed time.Duration) {
+	if len(sim.Precipitation) == 0 {
+		return
+	}
+
+	// The wind direction is where it's blowing from.
+	wind := sim.Wind
+	toward := float32(wind.Direction + 180)
+	d := precipitationSteeringFactor * float32(wind.Speed) * float32(elapsed.Hours())
+	v := scale2f([2]float32{sin(radians(toward)), cos(radians(toward))}, d)
+	for i := range sim.Precipitation {
+		c := &sim.Precipitation[i]
+		c.Center = nm2ll(add2f(ll2nm(c.Center), v))
+		if sim.RandomPrecipitation && nmdistance2ll(c.Center, scenarioGroup.Center) > precipitationRadius+c.Radius {
+			// Replace it with a new cell upwind, somewhere across the
+			// area from where it left.
+			bearing := float32(wind.Direction) + lerp(rand.Float32(), -60, 60)
+			*c = sim.randomPrecipitationCell(bearing, precipitationRadius)
+		}
+	}
+
+	if sim.precipitationDeviations == nil {
+		sim.precipitationDeviations = make(map[string]map[int]interface{})
+	}
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if !sim.humanController(ac.TrackingController) || ac.OnFinal || ac.ClearedApproach || ac.OnRunway() {
+			continue
+		}
+		cell := sim.precipitationAhead(ac)
+		if cell == nil {
+			continue
+		}
+		if _, ok := sim.precipitationDeviations[callsign][cell.Id]; ok {
+			continue
+		}
+		if sim.precipitationDeviations[callsign] == nil {
+			sim.precipitationDeviations[callsign] = make(map[int]interface{})
+		}
+		sim.precipitationDeviations[callsign][cell.Id] = nil
+
+		if rand.Float32() < precipitationDeviationProbability {
+			lg.Printf("%s: requesting deviation around level %d precipitation", callsign, cell.Level)
+			sim.requestWeatherDeviation(ac, deviationAwayFrom(ac, cell.Center), fmt.Sprintf("level %d weather", cell.Level))
+		}
+	}
+}
+
+// precipitationAhead returns the first cell with heavy precipitation at
+// the aircraft's altitude along the next precipitationLookaheadNM of its
+// route or, if it's flying a heading, straight ahead.
+func (sim *Sim) precipitationAhead(ac *Aircraft) *PrecipitationCell {
+	route := upcomingRoute(ac)
+	if ac.AssignedHeading != 0 || len(route) < 2 {
+		hdg := ac.Heading - scenarioGroup.MagneticVariation
+		ahead := scale2f([2]float32{sin(radians(hdg)), cos(radians(hdg))}, precipitationLookaheadNM)
+		route = []Point2LL{ac.Position, nm2ll(add2f(ll2nm(ac.Position), ahead))}
+	}
+	return sim.precipitationOnPath(ac.Altitude, route, precipitationLookaheadNM)
+}
+
+// precipitationOnPath returns the first cell with heavy precipitation at
+// the given altitude along the first maxDist nm of the path.
+func (sim *Sim) precipitationOnPath(alt float32, path []Point2LL, maxDist float32) *PrecipitationCell {
+	dist := float32(0)
+	for i := 0; i+1 < len(path) && dist < maxDist; i++ {
+		n := 1 + int(nmdistance2ll(path[i], path[i+1]))
+		for j := 0; j <= n; j++ {
+			p := lerp2ll(float32(j)/float32(n), path[i], path[i+1])
+			if dist+nmdistance2ll(path[i], p) > maxDist {
+				break
+			}
+			for k := range sim.Precipitation {
+				if c := &sim.Precipitation[k]; c.LevelAt(p, alt) >= precipitationDeviationLevel {
+					return c
+				}
+			}
+		}
+		dist += nmdistance2ll(path[i], path[i+1])
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// STARS weather display
+
+// Size in nm of the squares that precipitation is drawn with.
+const precipitationDrawCellSize = 1
+
+// precipitationColors gives the STARS display color for each
+// precipitation level: dim blue-gray for levels 1-3 and dim mustard for
+// levels 4-6, getting brighter with intensity.
+var precipitationColors = [6]RGB{
+	{.08, .12, .2}, {.12, .17, .28}, {.16, .22, .36},
+	{.3, .26, .08}, {.4, .34, .1}, {.5, .42, .12},
+}
+
+// drawPrecipitation draws the Sim's precipitation at or above the given
+// level.
+func (sp *STARSPane) drawPrecipitation(minLevel int, transforms ScopeTransformations, cb *CommandBuffer) {
+	levels := make(map[[2]int]int)
+	for _, c := range sim.Precipitation {
+		center := ll2nm(c.Center)
+		x0 := int(floor((center[0] - c.Radius) / precipitationDrawCellSize))
+		x1 := int(floor((center[0] + c.Radius) / precipitationDrawCellSize))
+		y0 := int(floor((center[1] - c.Radius) / precipitationDrawCellSize))
+		y1 := int(floor((center[1] + c.Radius) / precipitationDrawCellSize))
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				p := [2]float32{(float32(x) + .5) * precipitationDrawCellSize, (float32(y) + .5) * precipitationDrawCellSize}
+				if l := c.LevelAt(nm2ll(p), 0); l >= minLevel {
+					levels[[2]int{x, y}] = max(levels[[2]int{x, y}], l)
+				}
+			}
+		}
+	}
+
+	transforms.LoadLatLongViewingMatrices(cb)
+	trid := GetColoredTrianglesDrawBuilder()
+	defer ReturnColoredTrianglesDrawBuilder(trid)
+	for xy, l := range levels {
+		x0, y0 := float32(xy[0])*precipitationDrawCellSize, float32(xy[1])*precipitationDrawCellSize
+		x1, y1 := x0+precipitationDrawCellSize, y0+precipitationDrawCellSize
+		trid.AddQuad(nm2ll([2]float32{x0, y0}), nm2ll([2]float32{x1, y0}), nm2ll([2]float32{x1, y1}),
+			nm2ll([2]float32{x0, y1}), precipitationColors[l-1])
+	}
+	trid.GenerateCommands(cb)
+}
@@ -0,0 +1,319 @@
+// preferences.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// All of the user's settings are collected in the Preferences window,
+// which has a tab for each category of them. Each category also lists
+// the names of its settings so that the user can search for them; when
+// there is search text, all of the categories with a matching setting
+// are shown together.
+
+type PreferencesCategory struct {
+	Name     string
+	Settings []string
+	Draw     func()
+}
+
+// Matches returns true if the category's name or the name of one of its
+// settings includes the given search text, ignoring case.
+func (c PreferencesCategory) Matches(search string) bool {
+	search = strings.ToLower(strings.TrimSpace(search))
+	for _, s := range append([]string{c.Name}, c.Settings...) {
+		if strings.Contains(strings.ToLower(s), search) {
+			return true
+		}
+	}
+	return false
+}
+
+var preferencesWindow struct {
+	show   bool
+	search string
+}
+
+func preferencesCategories() []PreferencesCategory {
+	var fsp *FlightStripPane
+	var stars *STARSPane
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		switch pane := p.(type) {
+		case *FlightStripPane:
+			fsp = pane
+		case *STARSPane:
+			stars = pane
+		}
+	})
+
+	categories := []PreferencesCategory{
+		PreferencesCategory{
+			Name: "Simulation",
+			Settings: []string{"Simulation speed", "Pause when the window loses focus", "Pause after idle",
+				"UI font size", "STARS DCB font size"},
+			Draw: drawSimulationPreferences,
+		},
+	}
+	if stars != nil {
+		categories = append(categories, PreferencesCategory{
+			Name:     "STARS",
+			Settings: stars.SettingNames(),
+			Draw:     stars.DrawUI,
+		})
+	}
+
+	audio := []string{"Enable sound effects", "Custom sounds directory", "Pan pilot transmissions",
+		"Speak pilot transmissions", "Speech volume", "Repeat until acknowledged"}
+	for i := 0; i < AudioEventCount; i++ {
+		audio = append(audio, AudioEvent(i).String())
+	}
+	for _, v := range pilotVoiceNames {
+		audio = append(audio, v+" voice rate")
+	}
+	categories = append(categories, PreferencesCategory{
+		Name:     "Audio",
+		Settings: audio,
+		Draw:     globalConfig.Audio.DrawUI,
+	})
+
+	if fsp != nil {
+		categories = append(categories, PreferencesCategory{
+			Name: "Flight Strips",
+			Settings: []string{"Automatically add departures", "Automatically add arrivals",
+				"Add pushed flight strips", "Automatically add when track is initiated",
+				"Automatically add handoffs", "Automatically remove dropped tracks",
+				"Automatically remove accepted handoffs", "Collect departures and arrivals together",
+				"Sequence departures by runway and proposed time", "Group departures by exit",
+				"Resequence moved departure strips", "Font"},
+			Draw: fsp.DrawUI,
+		})
+	}
+
+	categories = append(categories,
+		PreferencesCategory{
+			Name: "Alerts",
+			Settings: []string{"User alerts", "Add alert", "Aircraft", "Only aircraft I am tracking", "Handed off",
+				"Altitude", "Fix", "Distance", "Flash datablock", "Play sound"},
+			Draw: drawUserAlertsUI,
+		},
+		PreferencesCategory{
+			Name:     "Remote API",
+			Settings: []string{"Port", "Enable localhost API", "Token"},
+			Draw:     apiServerDrawUI,
+		},
+		PreferencesCategory{
+			Name: "Multiplayer",
+			Settings: []string{"Server port", "Host multiplayer sessions", "Accept connections from other computers",
+				"Approve each remote participant", "Join code", "Remote participants"},
+			Draw: multiplayerServerDrawUI,
+		},
+		PreferencesCategory{
+			Name: "Accessibility",
+			Settings: []string{"Announce dialog boxes and changes to the simulation's state", "Screen reader",
+				"High-contrast radar scope", "Large text", "Gamepad", "Joystick"},
+			Draw: func() {
+				imgui.Checkbox("High-contrast radar scope with large datablocks", &globalConfig.HighContrastRadar)
+				imgui.Checkbox("Pan and zoom the radar scope with a gamepad", &globalConfig.GamepadControl)
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("The left stick pans and the right and left triggers zoom in and out")
+				}
+				imgui.Checkbox("Announce dialog boxes and changes to the simulation's state",
+					&globalConfig.Announcements)
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("Announcements are spoken using the system's speech services")
+				}
+			},
+		},
+		PreferencesCategory{
+			Name:     "Updates",
+			Settings: []string{"Update channel", "Beta releases"},
+			Draw:     drawUpdatePreferences,
+		},
+		PreferencesCategory{
+			Name: "Privacy",
+			Settings: []string{"Hide file paths and user name", "Real-world flight number formats",
+				"Send anonymous crash reports and performance statistics", "Telemetry"},
+			Draw: func() {
+				imgui.Checkbox("Hide file paths and user name", &globalConfig.PrivacyMode)
+				imgui.Checkbox("Don't use real-world flight number formats for new aircraft",
+					&globalConfig.PrivacyRandomizeCallsigns)
+				if telemetryEndpoint != "" {
+					imgui.Checkbox("Send anonymous crash reports and performance statistics",
+						&globalConfig.TelemetryEnabled)
+				}
+			},
+		},
+		PreferencesCategory{
+			Name:     "Developer",
+			Settings: []string{"Scenario file", "Video map file"},
+			Draw:     drawDeveloperPreferences,
+		})
+
+	return categories
+}
+
+func ActivatePreferencesWindow() {
+	preferencesWindow.show = true
+}
+
+func preferencesDrawUI() {
+	if !preferencesWindow.show {
+		return
+	}
+
+	imgui.BeginV("Preferences", &preferencesWindow.show, imgui.WindowFlagsAlwaysAutoResize)
+
+	imgui.InputTextV("Search", &preferencesWindow.search, 0, nil)
+	imgui.Separator()
+
+	categories := preferencesCategories()
+	if search := preferencesWindow.search; strings.TrimSpace(search) == "" {
+		if imgui.BeginTabBar("preferences") {
+			for _, c := range categories {
+				if imgui.BeginTabItem(c.Name) {
+					c.Draw()
+					imgui.EndTabItem()
+				}
+			}
+			imgui.EndTabBar()
+		}
+	} else {
+		matches := FilterSlice(categories, func(c PreferencesCategory) bool { return c.Matches(search) })
+		if len(matches) == 0 {
+			imgui.Text("No settings match \"" + search + "\"")
+		}
+		for i, c := range matches {
+			if i > 0 {
+				imgui.Separator()
+			}
+			imgui.Text(c.Name)
+			imgui.PushID(c.Name)
+			c.Draw()
+			imgui.PopID()
+		}
+	}
+
+	imgui.End()
+}
+
+func drawSimulationPreferences() {
+	if sim.remote != nil {
+		// Only instructors may change the multiplayer session's rate.
+		rate := sim.SimRate
+		uiStartDisable(!sim.remote.Instructor())
+		if imgui.SliderFloatV("Simulation speed", &rate, 1, 10, "%.1f", 0) {
+			sim.remote.SetSimRate(rate)
+		}
+		uiEndDisable(!sim.remote.Instructor())
+	} else if *devmode {
+		imgui.SliderFloatV("Simulation speed", &sim.SimRate, 1, 100, "%.1f", 0)
+	} else {
+		imgui.SliderFloatV("Simulation speed", &sim.SimRate, 1, 10, "%.1f", 0)
+	}
+	if sim.ScheduledTraffic {
+		imgui.Text("Scheduled traffic local time: " + sim.LocalTime().Format("1504"))
+	}
+	imgui.Checkbox("Pause when the window loses focus", &globalConfig.PauseOnFocusLoss)
+	imgui.SliderIntV("Pause after idle (minutes)", &globalConfig.AutoPauseMinutes, 0, 30, "%d", 0)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Zero disables pausing when idle")
+	}
+
+	if imgui.BeginComboV("UI Font Size", fmt.Sprintf("%d", globalConfig.UIFontSize), imgui.ComboFlagsHeightLarge) {
+		sizes := make(map[int]interface{})
+		for fontid := range fonts {
+			if fontid.Name == "Roboto Regular" {
+				sizes[fontid.Size] = nil
+			}
+		}
+		for _, size := range SortedMapKeys(sizes) {
+			if imgui.SelectableV(fmt.Sprintf("%d", size), size == globalConfig.UIFontSize, 0, imgui.Vec2{}) {
+				globalConfig.UIFontSize = size
+				ui.font = GetFont(FontIdentifier{Name: "Roboto Regular", Size: globalConfig.UIFontSize})
+			}
+		}
+		imgui.EndCombo()
+	}
+	if imgui.BeginComboV("STARS DCB Font Size", fmt.Sprintf("%d", globalConfig.DCBFontSize), imgui.ComboFlagsHeightLarge) {
+		sizes := make(map[int]interface{})
+		for fontid := range fonts {
+			if fontid.Name == "Inconsolata Condensed Regular" {
+				sizes[fontid.Size] = nil
+			}
+		}
+		for _, size := range SortedMapKeys(sizes) {
+			if imgui.SelectableV(fmt.Sprintf("%d", size), size == globalConfig.DCBFontSize, 0, imgui.Vec2{}) {
+				globalConfig.DCBFontSize = size
+			}
+		}
+		imgui.EndCombo()
+	}
+}
+
+func drawUpdatePreferences() {
+	if imgui.BeginComboV("Update channel", globalConfig.UpdateChannel, 0) {
+		for _, ch := range []string{"stable", "beta"} {
+			if imgui.SelectableV(ch, ch == globalConfig.UpdateChannel, 0, imgui.Vec2{}) {
+				globalConfig.UpdateChannel = ch
+			}
+		}
+		imgui.EndCombo()
+	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("The beta channel also notifies you about beta releases; it takes effect the next time vice is started")
+	}
+}
+
+func drawDeveloperPreferences() {
+	if imgui.BeginTableV("GlobalFiles", 4, 0, imgui.Vec2{}, 0) {
+		imgui.TableNextRow()
+		imgui.TableNextColumn()
+		imgui.Text("Scenario:")
+		imgui.TableNextColumn()
+		imgui.Text(privacyFilter(globalConfig.DevScenarioFile))
+		imgui.TableNextColumn()
+		if imgui.Button("New...##scenario") {
+			ui.jsonSelectDialog = NewFileSelectDialogBox("Select JSON File", []string{".json"},
+				globalConfig.DevScenarioFile, func(filename string) {
+					globalConfig.DevScenarioFile = filename
+					ui.jsonSelectDialog = nil
+				})
+			ui.jsonSelectDialog.Activate()
+		}
+		imgui.TableNextColumn()
+		if globalConfig.DevScenarioFile != "" && imgui.Button("Clear##scenario") {
+			globalConfig.DevScenarioFile = ""
+		}
+
+		imgui.TableNextRow()
+		imgui.TableNextColumn()
+		imgui.Text("Video maps:")
+		imgui.TableNextColumn()
+		imgui.Text(privacyFilter(globalConfig.DevVideoMapFile))
+		imgui.TableNextColumn()
+		if imgui.Button("New...##vid") {
+			ui.jsonSelectDialog = NewFileSelectDialogBox("Select JSON File", []string{".json"},
+				globalConfig.DevVideoMapFile, func(filename string) {
+					globalConfig.DevVideoMapFile = filename
+					ui.jsonSelectDialog = nil
+				})
+			ui.jsonSelectDialog.Activate()
+		}
+		imgui.TableNextColumn()
+		if globalConfig.DevVideoMapFile != "" && imgui.Button("Clear##vid") {
+			globalConfig.DevVideoMapFile = ""
+		}
+
+		imgui.EndTable()
+	}
+
+	if ui.jsonSelectDialog != nil {
+		ui.jsonSelectDialog.Draw()
+	}
+}
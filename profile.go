@@ -0,0 +1,229 @@
+// profile.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// The controller profile window summarizes the user's sessions from the
+// score history (see scoring.go): how much time they have spent in each
+// scenario, and how their scores, conflict rates, and command accuracy
+// have changed over time. The history can also be exported as a CSV
+// file, e.g. for an instructor to review.
+
+// ProfileScenarioStats accumulates the sessions in a single scenario.
+type ProfileScenarioStats struct {
+	ScenarioGroup string
+	Scenario      string
+	Sessions      int
+	Duration      time.Duration
+	TotalScore    int
+}
+
+func (s ProfileScenarioStats) AverageScore() float32 {
+	return float32(s.TotalScore) / float32(max(1, s.Sessions))
+}
+
+// ConflictsPerHour returns the number of separation losses in the
+// session per hour of controlling.
+func (s *SessionScore) ConflictsPerHour() float32 {
+	hours := float32(s.End.Sub(s.Start).Hours())
+	if hours == 0 {
+		return 0
+	}
+	return float32(s.Count(ScoreSeparationLoss)) / hours
+}
+
+// CommandAccuracy returns the fraction of the user's commands in the
+// session that succeeded.
+func (s *SessionScore) CommandAccuracy() float32 {
+	if s.Commands == 0 {
+		return 1
+	}
+	return 1 - float32(s.CommandErrors)/float32(s.Commands)
+}
+
+// profileScenarioStats returns statistics for each scenario in the
+// given sessions, sorted by scenario group and scenario.
+func profileScenarioStats(h []SessionScore) []ProfileScenarioStats {
+	m := make(map[[2]string]*ProfileScenarioStats)
+	for _, s := range h {
+		key := [2]string{s.ScenarioGroup, s.Scenario}
+		st, ok := m[key]
+		if !ok {
+			st = &ProfileScenarioStats{ScenarioGroup: s.ScenarioGroup, Scenario: s.Scenario}
+			m[key] = st
+		}
+		st.Sessions++
+		st.Duration += s.End.Sub(s.Start)
+		st.TotalScore += s.Score()
+	}
+
+	var stats []ProfileScenarioStats
+	for _, st := range m {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ScenarioGroup != stats[j].ScenarioGroup {
+			return stats[i].ScenarioGroup < stats[j].ScenarioGroup
+		}
+		return stats[i].Scenario < stats[j].Scenario
+	})
+	return stats
+}
+
+// ExportScoreHistory writes the sessions to a CSV file with one row per
+// session.
+func ExportScoreHistory(fn string, h []SessionScore) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"start", "scenario_group", "scenario", "minutes", "aircraft", "score",
+		"commands", "command_errors"}
+	for c := ScoreCategory(0); c < ScoreCategoryCount; c++ {
+		header = append(header, c.String())
+	}
+	w.Write(header)
+
+	for _, s := range h {
+		row := []string{s.Start.Format(time.RFC3339), s.ScenarioGroup, s.Scenario,
+			fmt.Sprintf("%.1f", s.End.Sub(s.Start).Minutes()), strconv.Itoa(s.Aircraft),
+			strconv.Itoa(s.Score()), strconv.Itoa(s.Commands), strconv.Itoa(s.CommandErrors)}
+		for c := ScoreCategory(0); c < ScoreCategoryCount; c++ {
+			row = append(row, strconv.Itoa(s.Count(c)))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Controller profile window
+
+var profileWindow struct {
+	show    bool
+	history []SessionScore
+	// Only sessions in this scenario group are graphed, if it's set.
+	group  string
+	status string
+}
+
+func ShowProfileWindow() {
+	profileWindow.show = true
+	profileWindow.history = LoadScoreHistory()
+	profileWindow.status = ""
+}
+
+func profileDrawUI() {
+	if !profileWindow.show {
+		return
+	}
+
+	imgui.BeginV("Controller Profile", &profileWindow.show, imgui.WindowFlagsAlwaysAutoResize)
+
+	h := profileWindow.history
+	if len(h) == 0 {
+		imgui.Text("No sessions have been recorded yet.")
+		imgui.End()
+		return
+	}
+
+	var total time.Duration
+	for _, s := range h {
+		total += s.End.Sub(s.Start)
+	}
+	imgui.Text(fmt.Sprintf("%d sessions, %.1f hours since %s", len(h), total.Hours(),
+		h[0].Start.Format("2006-01-02")))
+
+	imgui.Separator()
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg | imgui.TableFlagsScrollY
+	if imgui.BeginTableV("scenarios", 4, tableFlags, imgui.Vec2{600, 150}, 0) {
+		imgui.TableSetupColumn("Scenario")
+		imgui.TableSetupColumn("Sessions")
+		imgui.TableSetupColumn("Hours")
+		imgui.TableSetupColumn("Avg. score")
+		imgui.TableHeadersRow()
+		for _, st := range profileScenarioStats(h) {
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(st.ScenarioGroup + ": " + st.Scenario)
+			imgui.TableNextColumn()
+			imgui.Text(strconv.Itoa(st.Sessions))
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%.1f", st.Duration.Hours()))
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%.0f", st.AverageScore()))
+		}
+		imgui.EndTable()
+	}
+
+	imgui.Separator()
+	label := profileWindow.group
+	if label == "" {
+		label = "(all)"
+	}
+	if imgui.BeginComboV("Scenario group", label, imgui.ComboFlagsHeightLarge) {
+		if imgui.SelectableV("(all)", profileWindow.group == "", 0, imgui.Vec2{}) {
+			profileWindow.group = ""
+		}
+		groups := make(map[string]interface{})
+		for _, s := range h {
+			groups[s.ScenarioGroup] = nil
+		}
+		for _, g := range SortedMapKeys(groups) {
+			if imgui.SelectableV(g, g == profileWindow.group, 0, imgui.Vec2{}) {
+				profileWindow.group = g
+			}
+		}
+		imgui.EndCombo()
+	}
+
+	var scores, conflicts, accuracy []float32
+	for _, s := range h {
+		if profileWindow.group == "" || s.ScenarioGroup == profileWindow.group {
+			scores = append(scores, float32(s.Score()))
+			conflicts = append(conflicts, s.ConflictsPerHour())
+			accuracy = append(accuracy, 100*s.CommandAccuracy())
+		}
+	}
+	graphSize := imgui.Vec2{600, 80}
+	imgui.PlotLinesV("Score", scores, 0, "", 0, 100, graphSize)
+	maxConflicts := float32(1)
+	for _, c := range conflicts {
+		maxConflicts = max(maxConflicts, c)
+	}
+	imgui.PlotLinesV("Conflicts/hour", conflicts, 0, "", 0, maxConflicts, graphSize)
+	imgui.PlotLinesV("Command accuracy %", accuracy, 0, "", 0, 100, graphSize)
+
+	imgui.Separator()
+	if imgui.Button("Export CSV") {
+		fn := path.Join(path.Dir(scoreHistoryPath()), "sessions.csv")
+		if err := ExportScoreHistory(fn, h); err != nil {
+			profileWindow.status = err.Error()
+		} else {
+			profileWindow.status = "Saved " + fn
+		}
+	}
+	if profileWindow.status != "" {
+		imgui.SameLine()
+		imgui.Text(profileWindow.status)
+	}
+
+	imgui.End()
+}
@@ -99,6 +99,7 @@ func (w *WeatherRadar) UpdateCenter(center Point2LL) {
 // the results back on imageChan.  New images are also automatically
 // fetched periodically, with a wait time specified by the delay parameter.
 func fetchWeather(reqChan chan Point2LL, imageChan chan ImageAndBounds, delay time.Duration) {
+	defer reportGoroutinePanic()
 	// center stores the current center position of the radar image
 	var center Point2LL
 	for {
@@ -798,6 +799,48 @@ func UpdateScopePosition(mouse *MouseState, button int, transforms ScopeTransfor
 	return
 }
 
+// Gamepad sticks and triggers have to be moved at least this far before
+// they're considered to be in use, so that controllers that don't quite
+// return to center don't cause drift.
+const gamepadDeadZone = 0.15
+
+// UpdateScopePositionFromGamepad pans the scope with the gamepad's left
+// stick and changes its range with the triggers: the right one zooms in
+// and the left one zooms out. It returns true if the scope moved.
+func UpdateScopePositionFromGamepad(p Platform, transforms ScopeTransformations,
+	center *Point2LL, rangeNM *float32) (moved bool) {
+	if !globalConfig.GamepadControl {
+		return
+	}
+	gs, ok := p.GetGamepad()
+	if !ok {
+		return
+	}
+
+	// Speeds are per frame, in pixels for panning.
+	const panSpeed, zoomSpeed = 12, 1.03
+	deadZone := func(v float32) float32 {
+		if abs(v) < gamepadDeadZone {
+			return 0
+		}
+		return v
+	}
+
+	stick := [2]float32{deadZone(gs.LeftStick[0]), deadZone(gs.LeftStick[1])}
+	if stick[0] != 0 || stick[1] != 0 {
+		// The stick's y axis is down, while window coordinates are up.
+		delta := [2]float32{panSpeed * stick[0], -panSpeed * stick[1]}
+		*center = add2f(*center, transforms.LatLongFromWindowV(delta))
+		moved = true
+	}
+
+	if zoom := deadZone(gs.LeftTrigger) - deadZone(gs.RightTrigger); zoom != 0 {
+		*rangeNM = clamp(*rangeNM*pow(zoomSpeed, zoom), 1, 512)
+		moved = true
+	}
+	return
+}
+
 // If the user has run the "find" command to highlight a point in the
 // world, draw a red circle around that point for a few seconds.
 func DrawHighlighted(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
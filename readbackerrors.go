@@ -0,0 +1,108 @@
+// readbackerrors.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// With a nonzero pilot error rate, pilots occasionally mishear an
+// assigned altitude or heading: they read back the wrong value and then
+// fly it. It's up to the controller to catch the bad readback and
+// reissue the clearance; reissuing an altitude or heading corrects the
+// corresponding error, as does any other clearance that supersedes it: a
+// direct, hold, approach clearance, or weather deviation for headings and
+// a descend or climb via or crossing restriction for altitudes. Errors
+// that aren't corrected in time are scored (see scoring.go).
+
+type ReadbackErrorType int
+
+const (
+	ReadbackErrorAltitude ReadbackErrorType = iota
+	ReadbackErrorHeading
+)
+
+func (t ReadbackErrorType) String() string {
+	return [...]string{"altitude", "heading"}[t]
+}
+
+type ReadbackError struct {
+	Type     ReadbackErrorType
+	Assigned int
+	// The value that the pilot read back and is flying.
+	Readback int
+	Time     time.Time
+}
+
+// Readback errors that haven't been corrected after this long are
+// scored.
+const readbackCorrectionTime = 90 * time.Second
+
+// readbackError returns the value that the pilot will read back and fly
+// for the given assigned altitude or heading, which is usually the
+// assigned value. A readback error replaces any earlier one of the same
+// type, which the new clearance corrects.
+func (sim *Sim) readbackError(ac *Aircraft, t ReadbackErrorType, assigned int) int {
+	ac.clearReadbackError(t)
+	if sim.PilotErrorRate == 0 || rand.Float32() >= sim.PilotErrorRate {
+		return assigned
+	}
+
+	v := assigned
+	switch t {
+	case ReadbackErrorAltitude:
+		// E.g., "one one thousand" for "one zero thousand"
+		if v <= 2000 || rand.Intn(2) == 0 {
+			v += 1000
+		} else {
+			v -= 1000
+		}
+
+	case ReadbackErrorHeading:
+		v += Sample([]int{-20, -10, 10, 20})
+		if v <= 0 {
+			v += 360
+		} else if v > 360 {
+			v -= 360
+		}
+	}
+
+	lg.Printf("%s: readback error: %s %d instead of %d", ac.Callsign, t, v, assigned)
+	ac.ReadbackErrors = append(ac.ReadbackErrors, ReadbackError{
+		Type:     t,
+		Assigned: assigned,
+		Readback: v,
+		Time:     sim.CurrentTime(),
+	})
+	return v
+}
+
+// clearReadbackError discards the aircraft's readback error of the given
+// type, if it has one.
+func (ac *Aircraft) clearReadbackError(t ReadbackErrorType) {
+	ac.ReadbackErrors = FilterSlice(ac.ReadbackErrors, func(e ReadbackError) bool { return e.Type != t })
+}
+
+// updateReadbackErrors scores readback errors that the controller hasn't
+// corrected; it should be called once a second.
+func (sim *Sim) updateReadbackErrors(now time.Time) {
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if len(ac.ReadbackErrors) == 0 {
+			continue
+		}
+		ac.ReadbackErrors = FilterSlice(ac.ReadbackErrors, func(e ReadbackError) bool {
+			if now.Sub(e.Time) < readbackCorrectionTime {
+				return true
+			}
+			lg.Printf("%s: readback error not corrected", callsign)
+			if sim.scorer != nil && ac.TrackingController == sim.Scenario.Callsign {
+				sim.addScoredError(ScoreUncorrectedReadback, ac, "%s read back %s %d instead of %d",
+					callsign, e.Type, e.Readback, e.Assigned)
+			}
+			return false
+		})
+	}
+}
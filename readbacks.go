@@ -0,0 +1,116 @@
+// readbacks.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// The pilots' responses to commands are generated from templates, keyed
+// by the type of response, so that their wording can be changed without
+// modifying vice. The defaults are in resources/readbacks.json; scenario
+// groups may override any of them in a "readbacks" object, since
+// phraseology varies by region and some groups prefer stricter or
+// looser readbacks. Templates use Go's text/template syntax with the
+// fields of ReadbackData, e.g. "climb and maintain {{.Altitude}}".
+
+//go:embed resources/readbacks.json
+var defaultReadbacksJSON string
+
+// ReadbackData holds the values that may be used in readback templates;
+// each type of response only sets the ones that are relevant to it.
+type ReadbackData struct {
+	Altitude int
+	Heading  int
+	Degrees  int
+	Speed    int
+	Fix      string
+	Approach string
+	Runway   string
+	Headings []string
+	Hold     string
+	Time     string
+	Squawk   Squawk
+	// E.g., "CAMRN4 arrival", for descend via and climb via clearances.
+	Procedure string
+	// E.g., "at 11000, at 250 knots", for crossing restrictions.
+	Restriction string
+	// Why the aircraft is going around, if it's saying.
+	Reason string
+	// "left" or "right", for weather deviations.
+	Direction string
+}
+
+var readbackFuncs = template.FuncMap{"join": strings.Join}
+
+var defaultReadbacks map[string]*template.Template
+
+// parseReadbacks parses the given templates, reporting errors in them as
+// well as responses that aren't known if known is non-nil.
+func parseReadbacks(r map[string]string, known map[string]*template.Template,
+	e *ErrorLogger) map[string]*template.Template {
+	templates := make(map[string]*template.Template)
+	for _, key := range SortedMapKeys(r) {
+		e.Push("Readback " + key)
+		if _, ok := known[key]; known != nil && !ok {
+			e.ErrorString("unknown response type; valid types are: %s",
+				strings.Join(SortedMapKeys(known), ", "))
+		} else if t, err := template.New(key).Funcs(readbackFuncs).Parse(r[key]); err != nil {
+			e.Error(err)
+		} else if err := t.Execute(&strings.Builder{}, ReadbackData{}); err != nil {
+			// Catch references to fields that don't exist now rather
+			// than when the pilot is responding.
+			e.Error(err)
+		} else {
+			templates[key] = t
+		}
+		e.Pop()
+	}
+	return templates
+}
+
+func loadDefaultReadbacks() {
+	var r map[string]string
+	if err := json.Unmarshal([]byte(defaultReadbacksJSON), &r); err != nil {
+		lg.Errorf("readbacks.json: %v", err)
+		return
+	}
+
+	var e ErrorLogger
+	defaultReadbacks = parseReadbacks(r, nil, &e)
+	if e.HaveErrors() {
+		lg.Errorf("readbacks.json: %s", e.String())
+	}
+}
+
+// pilotReadback has the aircraft respond using the template for the given
+// type of response, preferring the scenario group's template if it has
+// one.
+func pilotReadback(callsign string, key string, data ReadbackData) {
+	if defaultReadbacks == nil {
+		loadDefaultReadbacks()
+	}
+
+	t, ok := defaultReadbacks[key]
+	if scenarioGroup != nil {
+		if st, sok := scenarioGroup.readbacks[key]; sok {
+			t, ok = st, true
+		}
+	}
+	if !ok {
+		lg.Errorf("%s: no readback template", key)
+		return
+	}
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		lg.Errorf("%s: %v", key, err)
+		return
+	}
+	pilotResponse(callsign, "%s", sb.String())
+}
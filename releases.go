@@ -0,0 +1,246 @@
+// releases.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// When departure releases are enabled, departures no longer start rolling
+// as soon as they reach the runway: the tower first calls the user to
+// request a release. The user releases an aircraft with the "REL" command
+// or has the tower hold it with "HREL"; aircraft that are held or haven't
+// been released yet wait at the runway, though others behind them may
+// depart once they are released. The DepartureReleasePane shows the
+// departures that are waiting; clicking on one there releases it and
+// right-clicking holds it.
+
+// If the user doesn't respond to a release request, the tower asks again
+// after this long.
+const releaseRequestInterval = 2 * time.Minute
+
+// towerCallsign returns the callsign used for transmissions from the
+// given airport's tower.
+func towerCallsign(airport string) string {
+	if len(airport) == 4 && airport[0] == 'K' {
+		airport = airport[1:]
+	}
+	return airport + "_TWR"
+}
+
+// updateDepartureReleases has the tower request releases for departures
+// that have reached the runway; it should be called once a second.
+func (sim *Sim) updateDepartureReleases(now time.Time) {
+	if !sim.DepartureReleases {
+		return
+	}
+
+	for _, qd := range sim.GetDepartureQueue() {
+		if now.Before(qd.ProposedTime) || qd.Released || qd.Held {
+			continue
+		}
+		if !qd.ReleaseRequested.IsZero() && now.Sub(qd.ReleaseRequested) < releaseRequestInterval {
+			continue
+		}
+
+		rwy := qd.Runway
+		if id := qd.Aircraft.IntersectionDeparture; id != "" {
+			rwy += " at " + id
+		}
+		if qd.ReleaseRequested.IsZero() {
+			landlineMessage(towerCallsign(qd.Airport), "request release for %s, runway %s",
+				qd.Aircraft.Callsign, rwy)
+		} else {
+			landlineMessage(towerCallsign(qd.Airport), "%s is still waiting for release, runway %s",
+				qd.Aircraft.Callsign, rwy)
+		}
+		qd.ReleaseRequested = now
+	}
+}
+
+// queuedDeparture returns the queued departure with the given callsign,
+// if there is one.
+func (sim *Sim) queuedDeparture(callsign string) *QueuedDeparture {
+	for _, qd := range sim.GetDepartureQueue() {
+		if qd.Aircraft.Callsign == callsign {
+			return qd
+		}
+	}
+	return nil
+}
+
+// ReleaseDeparture releases the given departure, which may be held or
+// still taxiing out.
+func (sim *Sim) ReleaseDeparture(callsign string) error {
+	qd := sim.queuedDeparture(callsign)
+	if qd == nil {
+		return ErrNoAircraftForCallsign
+	} else if !sim.DepartureReleases || qd.Released {
+		return ErrUnableCommand
+	}
+
+	qd.Released, qd.Held = true, false
+	lg.Printf("%s: released for departure", callsign)
+	landlineMessage(towerCallsign(qd.Airport), "%s released, runway %s", callsign, qd.Runway)
+	return nil
+}
+
+// HoldDeparture has the tower hold the given departure until it is
+// released.
+func (sim *Sim) HoldDeparture(callsign string) error {
+	qd := sim.queuedDeparture(callsign)
+	if qd == nil {
+		return ErrNoAircraftForCallsign
+	} else if !sim.DepartureReleases {
+		return ErrUnableCommand
+	}
+
+	qd.Released, qd.Held = false, true
+	lg.Printf("%s: held for release", callsign)
+	landlineMessage(towerCallsign(qd.Airport), "holding %s for release", callsign)
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// DepartureReleasePane
+
+// DepartureReleasePane lists the departures that are waiting for a
+// release at the runway, along with how long they have been waiting, and
+// then the ones that are still taxiing out. Clicking on a departure
+// releases it and right-clicking on it has the tower hold it.
+type DepartureReleasePane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	scrollbar *ScrollBar
+}
+
+func NewDepartureReleasePane() *DepartureReleasePane {
+	return &DepartureReleasePane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (dp *DepartureReleasePane) Activate() {
+	if dp.font = GetFont(dp.FontIdentifier); dp.font == nil {
+		dp.font = GetDefaultFont()
+		dp.FontIdentifier = dp.font.id
+	}
+	if dp.scrollbar == nil {
+		dp.scrollbar = NewScrollBar(4, false)
+	}
+}
+
+func (dp *DepartureReleasePane) Deactivate()                {}
+func (dp *DepartureReleasePane) CanTakeKeyboardFocus() bool { return false }
+
+func (dp *DepartureReleasePane) Name() string { return "Departure Releases" }
+
+func (dp *DepartureReleasePane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&dp.FontIdentifier, "Font"); changed {
+		dp.font = newFont
+	}
+}
+
+func (dp *DepartureReleasePane) KeyBindings() []KeyBinding {
+	return []KeyBinding{
+		KeyBinding{Keys: "Click", Description: "Release the departure"},
+		KeyBinding{Keys: "Right-click", Description: "Have the tower hold the departure"},
+	}
+}
+
+type departureReleaseLine struct {
+	text     string
+	color    RGB
+	callsign string // for departures
+}
+
+// lines returns the lines of text to display for the current departure
+// queue.
+func (dp *DepartureReleasePane) lines() []departureReleaseLine {
+	if !sim.DepartureReleases {
+		return []departureReleaseLine{{text: "Departure releases are not enabled", color: UITextColor}}
+	}
+
+	now := sim.CurrentTime()
+	var waiting, taxiing []departureReleaseLine
+	for _, qd := range sim.GetDepartureQueue() {
+		ac := qd.Aircraft
+		s := fmt.Sprintf("%-8s %-4s %-4s %-8s", ac.Callsign, qd.Airport, qd.Runway, ac.FlightPlan.TypeWithoutSuffix())
+		if now.Before(qd.ProposedTime) {
+			if qd.Released {
+				s += " RELEASED"
+			} else if qd.Held {
+				s += " HOLD"
+			}
+			s += " P" + qd.ProposedTime.UTC().Format("1504")
+			taxiing = append(taxiing, departureReleaseLine{text: s, color: UITextColor, callsign: ac.Callsign})
+			continue
+		}
+
+		wait := now.Sub(qd.ProposedTime).Round(time.Second)
+		line := departureReleaseLine{color: UITextHighlightColor, callsign: ac.Callsign}
+		if qd.Released {
+			line.text = s + " RELEASED"
+			line.color = UITextColor
+		} else if qd.Held {
+			line.text = s + " HOLD " + wait.String()
+		} else {
+			line.text = s + " REQ " + wait.String()
+			line.color = UIErrorColor
+		}
+		waiting = append(waiting, line)
+	}
+
+	heading := func(s string, n int) departureReleaseLine {
+		return departureReleaseLine{text: fmt.Sprintf("%s (%d)", s, n), color: UITextHighlightColor}
+	}
+	lines := []departureReleaseLine{heading("At the runway", len(waiting))}
+	lines = append(lines, waiting...)
+	lines = append(lines, departureReleaseLine{}, heading("Taxiing", len(taxiing)))
+	lines = append(lines, taxiing...)
+	return lines
+}
+
+func (dp *DepartureReleasePane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := dp.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(dp.font.size)
+	indent := float32(int32(fw / 2))
+	height := ctx.paneExtent.Height()
+
+	lines := dp.lines()
+	y := height - indent
+	visibleLines := int(y / fh)
+	dp.scrollbar.Update(len(lines), visibleLines, ctx)
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	for i := dp.scrollbar.Offset(); i < min(len(lines), dp.scrollbar.Offset()+visibleLines); i++ {
+		if callsign := lines[i].callsign; callsign != "" && ctx.mouse != nil &&
+			ctx.mouse.Pos[1] <= y && ctx.mouse.Pos[1] > y-fh {
+			var err error
+			if ctx.mouse.Clicked[MouseButtonPrimary] {
+				err = sim.ReleaseDeparture(callsign)
+			} else if ctx.mouse.Clicked[MouseButtonSecondary] {
+				err = sim.HoldDeparture(callsign)
+			}
+			if err != nil {
+				lg.Printf("%s: %v", callsign, err)
+				globalConfig.Audio.PlaySound(AudioEventCommandError)
+			}
+		}
+
+		style := TextStyle{Font: dp.font, Color: lines[i].color}
+		td.AddText(strings.TrimRight(lines[i].text, " "), [2]float32{indent, y}, style)
+		y -= fh
+	}
+
+	dp.scrollbar.Draw(ctx, cb)
+	td.GenerateCommands(cb)
+}
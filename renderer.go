@@ -43,6 +43,11 @@ type Renderer interface {
 	// rendered.
 	RenderCommandBuffer(*CommandBuffer) RendererStats
 
+	// ReadPixels returns the contents of the specified rectangle of the
+	// framebuffer, which is given in framebuffer coordinates with (0,0)
+	// at the lower left.
+	ReadPixels(x, y, w, h int) *image.RGBA
+
 	// Dispose releases resources allocated by the renderer.
 	Dispose()
 }
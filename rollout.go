@@ -0,0 +1,121 @@
+// rollout.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+// Rather than disappearing at the threshold, arrivals touch down, roll
+// out along the runway while decelerating, and then turn off onto a
+// taxiway before they are removed. Deceleration depends on the runway
+// condition, so aircraft occupy contaminated runways for longer, and
+// faster aircraft generally use exits farther down the runway.
+
+const (
+	// Deceleration on a dry runway, in knots per second.
+	rolloutDeceleration = 5
+	// Speed at which aircraft turn off the runway.
+	rolloutExitSpeed = 20
+	// Speed at which aircraft taxi after exiting the runway.
+	rolloutTaxiSpeed = 15
+	// Aircraft are removed after taxiing for this many seconds.
+	rolloutTaxiSeconds = 20
+)
+
+type Rollout struct {
+	Runway  string
+	Heading float32 // magnetic
+	// Distance from the threshold in nm of the taxiway the aircraft will
+	// exit at (or the first one after it once it has slowed down).
+	ExitDistance float32
+	ExitSide     int // -1: left, 1: right
+
+	Distance    float32 // traveled since the threshold
+	Exiting     bool
+	TaxiSeconds int
+	Removed     bool
+}
+
+// OnRunway returns true if the aircraft has landed and has not yet
+// exited the runway.
+func (ac *Aircraft) OnRunway() bool {
+	return ac.Rollout != nil && !ac.Rollout.Exiting
+}
+
+// beginRollout is called when an arrival reaches the runway threshold.
+func (ac *Aircraft) beginRollout() {
+	r := &Rollout{
+		Runway:  approachRunway(ac.Approach),
+		Heading: float32(ac.Approach.Heading()),
+	}
+	if ac.Performance.IsJet() {
+		r.ExitDistance = 0.6 + 0.5*rand.Float32()
+	} else {
+		r.ExitDistance = 0.3 + 0.3*rand.Float32()
+	}
+	r.ExitSide = 1
+	if rand.Intn(2) == 0 {
+		r.ExitSide = -1
+	}
+	lg.Printf("%s: touchdown runway %s, exit at %.2fnm", ac.Callsign, r.Runway, r.ExitDistance)
+
+	ac.Rollout = r
+	ac.Heading = r.Heading
+	ac.AssignedHeading, ac.AssignedAltitude, ac.AssignedSpeed = 0, 0, 0
+	if ap, ok := database.Airports[ac.FlightPlan.ArrivalAirport]; ok {
+		ac.Altitude = float32(ap.Elevation)
+	}
+}
+
+// updateRollout updates the aircraft's position on the runway or taxiway
+// for one second of time.
+func (ac *Aircraft) updateRollout() {
+	r := ac.Rollout
+	if r.Removed {
+		return
+	}
+
+	if !r.Exiting {
+		decel := float32(rolloutDeceleration)
+		if rs := sim.RunwayState(ac.FlightPlan.ArrivalAirport, r.Runway); rs != nil {
+			// Braking is less effective with lower runway condition
+			// codes.
+			decel *= max(float32(rs.MinCode())/6, 0.3)
+		}
+		ac.IAS = max(ac.IAS-decel, rolloutExitSpeed)
+		if ac.IAS <= rolloutExitSpeed && r.Distance >= r.ExitDistance {
+			r.Exiting = true
+			lg.Printf("%s: exiting runway %s after %.2fnm", ac.Callsign, r.Runway, r.Distance)
+			sim.reportBrakingAction(ac)
+		}
+	} else {
+		// Turn 45 degrees off the runway onto the taxiway, then continue
+		// at taxi speed until it's time to disappear.
+		target := r.Heading + float32(45*r.ExitSide)
+		if d := headingDifference(ac.Heading, target); d > 15 {
+			ac.Heading += float32(15 * r.ExitSide)
+		} else {
+			ac.Heading = target
+		}
+		for ac.Heading < 0 {
+			ac.Heading += 360
+		}
+		for ac.Heading >= 360 {
+			ac.Heading -= 360
+		}
+		ac.IAS = rolloutTaxiSpeed
+
+		r.TaxiSeconds++
+		if r.TaxiSeconds >= rolloutTaxiSeconds {
+			r.Removed = true
+			eventStream.Post(&RemovedAircraftEvent{ac: ac})
+			return
+		}
+	}
+
+	// No wind correction on the ground.
+	hdg := ac.Heading - scenarioGroup.MagneticVariation
+	v := [2]float32{sin(radians(hdg)), cos(radians(hdg))}
+	ac.Position = nm2ll(add2f(ll2nm(ac.Position), scale2f(v, ac.IAS/3600)))
+	ac.GS = ac.IAS
+	r.Distance += ac.IAS / 3600
+}
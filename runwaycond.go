@@ -0,0 +1,263 @@
+// runwaycond.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Winter operations scenarios may specify runway condition codes (RCCs)
+// for the touchdown, midpoint, and rollout thirds of each runway, using
+// the FAA's 0 (nil) to 6 (dry) scale. Conditions may deteriorate over
+// time; landing aircraft report braking action, poor conditions increase
+// runway occupancy time for departures, and runways close when braking
+// action goes to nil. The user may also close a runway for treatment,
+// which improves its condition.
+
+// RunwayCondition is the initial condition of a runway, as given in the
+// scenario.
+type RunwayCondition struct {
+	Airport     string `json:"airport"`
+	Runway      string `json:"runway"`
+	RCC         [3]int `json:"rcc"`                   // touchdown, midpoint, rollout
+	Contaminant string `json:"contaminant,omitempty"` // e.g., "1/8IN WET SN"
+	// RCC decrease per hour, e.g., due to continuing snowfall.
+	DeteriorationRate float32 `json:"deterioration_rate,omitempty"`
+}
+
+func (rc *RunwayCondition) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if _, ok := sg.Airports[rc.Airport]; !ok {
+		e.ErrorString("airport \"%s\" not found", rc.Airport)
+	}
+	for _, c := range rc.RCC {
+		if c < 0 || c > 6 {
+			e.ErrorString("RCC %d must be between 0 and 6", c)
+		}
+	}
+	if rc.DeteriorationRate < 0 {
+		e.ErrorString("\"deterioration_rate\" must not be negative")
+	}
+}
+
+// RunwayState is the current condition of a runway in the Sim.
+type RunwayState struct {
+	Airport, Runway   string
+	RCC               [3]float32
+	Contaminant       string
+	DeteriorationRate float32
+
+	// Most recent braking action reported by a landing aircraft.
+	BrakingAction     string
+	BrakingActionTime time.Time
+
+	Closed bool
+	// If the runway is closed for treatment, when it will be done.
+	TreatmentEnd time.Time
+}
+
+const runwayTreatmentTime = 20 * time.Minute
+
+func NewRunwayState(rc RunwayCondition) *RunwayState {
+	return &RunwayState{
+		Airport:           rc.Airport,
+		Runway:            rc.Runway,
+		RCC:               [3]float32{float32(rc.RCC[0]), float32(rc.RCC[1]), float32(rc.RCC[2])},
+		Contaminant:       rc.Contaminant,
+		DeteriorationRate: rc.DeteriorationRate,
+	}
+}
+
+// Codes returns the current RCCs for the runway thirds.
+func (rs *RunwayState) Codes() [3]int {
+	return [3]int{int(rs.RCC[0]), int(rs.RCC[1]), int(rs.RCC[2])}
+}
+
+// MinCode returns the worst of the runway's RCCs.
+func (rs *RunwayState) MinCode() int {
+	c := rs.Codes()
+	return min(c[0], min(c[1], c[2]))
+}
+
+func (rs *RunwayState) String() string {
+	if rs.Closed {
+		return "RWY " + rs.Runway + " CLSD"
+	}
+	c := rs.Codes()
+	s := fmt.Sprintf("RWY %s %d/%d/%d", rs.Runway, c[0], c[1], c[2])
+	if rs.Contaminant != "" {
+		s += " " + rs.Contaminant
+	}
+	if rs.BrakingAction != "" {
+		s += " BA " + rs.BrakingAction
+	}
+	return s
+}
+
+// BrakingAction returns the braking action that corresponds to the given
+// RCC.
+func BrakingAction(rcc int) string {
+	return [...]string{"NIL", "POOR", "MEDIUM TO POOR", "MEDIUM", "GOOD TO MEDIUM", "GOOD", "DRY"}[clamp(rcc, 0, 6)]
+}
+
+// OccupancyFactor returns the factor by which runway occupancy time is
+// increased due to the runway's condition.
+func (rs *RunwayState) OccupancyFactor() float32 {
+	return [...]float32{2.5, 2.2, 1.8, 1.5, 1.2, 1, 1}[clamp(rs.MinCode(), 0, 6)]
+}
+
+func runwayKey(airport, runway string) string {
+	return airport + "/" + runway
+}
+
+// RunwayState returns the state of the given runway, or nil if the
+// scenario doesn't specify its condition.
+func (sim *Sim) RunwayState(airport, runway string) *RunwayState {
+	return sim.RunwayStates[runwayKey(airport, runway)]
+}
+
+// RunwayClosed returns true if the given runway is currently closed.
+func (sim *Sim) RunwayClosed(airport, runway string) bool {
+	rs := sim.RunwayState(airport, runway)
+	return rs != nil && rs.Closed
+}
+
+// CloseRunwayForTreatment closes the given runway; when the treatment is
+// done, it reopens with improved conditions.
+func (sim *Sim) CloseRunwayForTreatment(rs *RunwayState) {
+	rs.Closed = true
+	rs.TreatmentEnd = sim.CurrentTime().Add(runwayTreatmentTime)
+}
+
+// updateRunwayConditions updates the conditions of runways according to
+// their deterioration rates and handles closures and reopenings.
+func (sim *Sim) updateRunwayConditions(now time.Time, elapsed time.Duration) {
+	for _, key := range SortedMapKeys(sim.RunwayStates) {
+		rs := sim.RunwayStates[key]
+
+		if rs.Closed && !rs.TreatmentEnd.IsZero() {
+			if now.After(rs.TreatmentEnd) {
+				for i := range rs.RCC {
+					rs.RCC[i] = max(rs.RCC[i], 5)
+				}
+				rs.Closed = false
+				rs.TreatmentEnd = time.Time{}
+				rs.BrakingAction = ""
+				landlineMessage("TOWER", "%s runway %s is open, RCC 5/5/5", rs.Airport, rs.Runway)
+			}
+			continue
+		}
+
+		d := rs.DeteriorationRate * float32(elapsed.Hours())
+		for i := range rs.RCC {
+			rs.RCC[i] = max(0, rs.RCC[i]-d)
+		}
+
+		if !rs.Closed && rs.MinCode() == 0 {
+			rs.Closed = true
+			globalConfig.Audio.PlaySound(AudioEventLandlineRing)
+			landlineMessage("TOWER", "%s runway %s is closed, braking action nil", rs.Airport, rs.Runway)
+		}
+	}
+
+	// Aircraft on final for a closed runway go around.
+	for _, ac := range sim.Aircraft {
+		if !ac.OnFinal || ac.Approach == nil || ac.FlightPlan == nil {
+			continue
+		}
+		if rwy := approachRunway(ac.Approach); rwy != "" && sim.RunwayClosed(ac.FlightPlan.ArrivalAirport, rwy) {
+			sim.WillGoAround[ac.Callsign] = GoAroundRunwayClosed
+		}
+	}
+}
+
+// approachRunway returns the runway that the given approach is to, based
+// on its name (e.g., "ILS Runway 22L").
+func approachRunway(ap *Approach) string {
+	f := strings.Fields(ap.FullName)
+	if len(f) == 0 {
+		return ""
+	}
+	return f[len(f)-1]
+}
+
+// reportBrakingAction is called when an arrival exits the runway after
+// its rollout; it may report the braking action, which may differ a bit
+// from what the RCC implies.
+func (sim *Sim) reportBrakingAction(ac *Aircraft) {
+	if ac.Approach == nil || ac.FlightPlan == nil {
+		return
+	}
+	rs := sim.RunwayState(ac.FlightPlan.ArrivalAirport, approachRunway(ac.Approach))
+	if rs == nil || rs.MinCode() == 6 || rand.Float32() < .5 {
+		return
+	}
+
+	rcc := rs.MinCode() + rand.Intn(3) - 1
+	rs.BrakingAction = BrakingAction(clamp(rcc, 0, 5))
+	rs.BrakingActionTime = sim.CurrentTime()
+	if rcc <= 1 {
+		landlineMessage("TOWER", "braking action %s runway %s reported by %s", strings.ToLower(rs.BrakingAction),
+			rs.Runway, ac.Callsign)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Runway conditions window
+
+var runwayConditionsWindow struct {
+	show bool
+}
+
+func runwayConditionsDrawUI() {
+	if !runwayConditionsWindow.show || sim.Scenario == nil {
+		return
+	}
+
+	imgui.BeginV("Runway Conditions", &runwayConditionsWindow.show, imgui.WindowFlagsAlwaysAutoResize)
+	if len(sim.RunwayStates) == 0 {
+		imgui.Text("The scenario does not specify runway conditions.")
+	}
+
+	flags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH | imgui.TableFlagsRowBg
+	if len(sim.RunwayStates) > 0 && imgui.BeginTableV("runways", 5, flags, imgui.Vec2{}, 0) {
+		imgui.TableSetupColumn("Runway")
+		imgui.TableSetupColumn("RCC")
+		imgui.TableSetupColumn("Contaminant")
+		imgui.TableSetupColumn("Braking Action")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+
+		for _, key := range SortedMapKeys(sim.RunwayStates) {
+			rs := sim.RunwayStates[key]
+			imgui.PushID(key)
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(key)
+			imgui.TableNextColumn()
+			c := rs.Codes()
+			imgui.Text(fmt.Sprintf("%d/%d/%d", c[0], c[1], c[2]))
+			imgui.TableNextColumn()
+			imgui.Text(rs.Contaminant)
+			imgui.TableNextColumn()
+			if rs.BrakingAction != "" {
+				imgui.Text(rs.BrakingAction + " (" + rs.BrakingActionTime.UTC().Format("1504") + ")")
+			}
+			imgui.TableNextColumn()
+			if !rs.TreatmentEnd.IsZero() {
+				imgui.Text("Treating until " + rs.TreatmentEnd.UTC().Format("1504"))
+			} else if imgui.Button("Close for treatment") {
+				sim.CloseRunwayForTreatment(rs)
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+	}
+
+	imgui.End()
+}
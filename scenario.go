@@ -6,11 +6,14 @@ package main
 
 import (
 	"embed"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/template"
+	"time"
 )
 
 type ScenarioGroup struct {
@@ -33,6 +36,33 @@ type ScenarioGroup struct {
 	RadarSites     map[string]*RadarSite `json:"radar_sites"`
 	STARSMaps      []STARSMap            `json:"stars_maps"`
 
+	Reference []ReferenceDocument `json:"reference"`
+
+	// Optional; overrides of the default pilot readback templates,
+	// keyed by response type (see resources/readbacks.json).
+	Readbacks map[string]string `json:"readbacks,omitempty"`
+	readbacks map[string]*template.Template
+
+	// Optional; the facility's time zone, e.g. "America/New_York", for
+	// the local time shown in the menu bar clock. If it's not given, the
+	// time zone is estimated from the longitude of the center.
+	TimeZone string `json:"time_zone,omitempty"`
+	timeZone *time.Location
+
+	// Optional; maximum altitude for tower en route control flights
+	// between airports, so that they stay beneath the arrival flows to
+	// the primary airport.
+	TECCeiling int `json:"tec_ceiling,omitempty"`
+
+	// Optional; published holding patterns, keyed by fix.
+	Holds map[string]PublishedHold `json:"holds,omitempty"`
+
+	// Optional; minimum vectoring altitude areas, used for MSAW alerts
+	// and altitude validation, and minimum enroute altitudes for
+	// airway segments, used for altitude validation.
+	MVAs []MVA `json:"mvas,omitempty"`
+	MEAs []MEA `json:"meas,omitempty"`
+
 	NmPerLatitude     float32 `json:"nm_per_latitude"`
 	NmPerLongitude    float32 `json:"nm_per_longitude"`
 	MagneticVariation float32 `json:"magnetic_variation"`
@@ -44,6 +74,9 @@ type Arrival struct {
 	CruiseAltitude  int                      `json:"cruise_altitude"`
 	Route           string                   `json:"route"`
 
+	// Optional; used instead of Waypoints for turboprops and pistons.
+	PropWaypoints WaypointArray `json:"prop_waypoints,omitempty"`
+
 	InitialController string `json:"initial_controller"`
 	InitialAltitude   int    `json:"initial_altitude"`
 	ClearedAltitude   int    `json:"cleared_altitude"`
@@ -73,6 +106,25 @@ type AirspaceVolume struct {
 	BoundaryNames []string     `json:"boundaries"`
 }
 
+// Sector describes the airspace owned by a controller (given by the key
+// in Scenario Sectors) and the standard points and altitudes at
+// which aircraft are handed off to adjacent sectors.
+type Sector struct {
+	AirspaceNames []string         `json:"airspace"`
+	Airspace      []AirspaceVolume `json:"-"`
+	HandoffPoints []HandoffPoint   `json:"handoff_points"`
+
+	// Triangulation of the sector's boundaries, for shading it.
+	triangles [][3]Point2LL
+}
+
+type HandoffPoint struct {
+	Fix        string   `json:"fix"`
+	Location   Point2LL `json:"-"`
+	Altitude   int      `json:"altitude"`
+	Controller string   `json:"controller"` // receiving controller
+}
+
 type Scenario struct {
 	Callsign    string   `json:"callsign"`
 	Wind        Wind     `json:"wind"`
@@ -90,6 +142,254 @@ type Scenario struct {
 	ArrivalRunways   []ScenarioGroupArrivalRunway   `json:"arrival_runways,omitempty"`
 
 	DefaultMap string `json:"default_map"`
+
+	// Sectors are optional; they're keyed by controller callsign.
+	Sectors map[string]*Sector `json:"sectors"`
+
+	// ControllerPolicies describe how the virtual controllers handle
+	// aircraft; they're evaluated in order and the first one that matches
+	// is used.
+	ControllerPolicies []ControllerPolicy `json:"controller_policies"`
+
+	Reference []ReferenceDocument `json:"reference"`
+
+	// Optional layers of turbulence and icing.
+	WeatherLayers []WeatherLayer `json:"weather_layers,omitempty"`
+
+	// Optional; for winter operations.
+	RunwayConditions []RunwayCondition `json:"runway_conditions,omitempty"`
+
+	// Optional SIGMETs and AIRMETs.
+	SIGMETs []SIGMET `json:"sigmets,omitempty"`
+
+	// Optional precipitation cells for the weather display; see
+	// precipitation.go.
+	Precipitation []PrecipitationCellSpec `json:"precipitation,omitempty"`
+
+	// Optional; approaches to parallel runways that are run dependently.
+	DependentApproaches []DependentApproaches `json:"dependent_approaches,omitempty"`
+
+	// Optional; approaches at different airports that share a final.
+	SharedFinals []SharedFinal `json:"shared_finals,omitempty"`
+
+	// Optional buttons for the facility's standard instructions.
+	Instructions []CannedInstruction `json:"instructions,omitempty"`
+
+	// Surveillance is "radar" (the default) or "adsb"; with ADS-B only
+	// surveillance, ADSBEquipage gives the fraction of aircraft that
+	// are equipped and thus visible (default 0.9).
+	Surveillance string  `json:"surveillance,omitempty"`
+	ADSBEquipage float32 `json:"adsb_equipage,omitempty"`
+
+	// Optional objectives for running the scenario as a challenge.
+	Challenge *Challenge `json:"challenge,omitempty"`
+}
+
+// ReferenceDocument holds a letter of agreement, SOP quick-reference card,
+// or the like that is shown in the ReferencePane. The text is in a
+// (very) limited subset of markdown: lines starting with '#' are headings
+// and blank lines separate paragraphs.
+type ReferenceDocument struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// ControllerPolicy encodes a facility's letter of agreement with an
+// adjacent controller: when that controller hands arrivals off to the
+// user, what it assigns them first, and how it handles aircraft the user
+// hands off to it. All of the matching fields are optional; the zero
+// value of each action field selects the default behavior. Inbound
+// handoffs may instead be decided by a script (see policyscript.go).
+type ControllerPolicy struct {
+	// Matching
+	Controller  string `json:"controller,omitempty"`
+	Airport     string `json:"airport,omitempty"` // departure or arrival airport
+	Fix         string `json:"fix,omitempty"`     // in the flight plan route
+	MinAltitude int    `json:"min_altitude,omitempty"`
+	MaxAltitude int    `json:"max_altitude,omitempty"`
+
+	// Inbound: the controller hands off arrivals it is tracking once they
+	// are within HandoffDistance nm of the arrival airport, first
+	// assigning HandoffAltitude and HandoffSpeed if they are given.
+	HandoffDistance float32 `json:"handoff_distance,omitempty"`
+	HandoffAltitude int     `json:"handoff_altitude,omitempty"`
+	HandoffSpeed    int     `json:"handoff_speed,omitempty"`
+	// Alternatively, Script decides when to hand off and what to assign.
+	Script string `json:"script,omitempty"`
+	script *template.Template
+
+	// Outbound: handoffs from the user are accepted after a random delay
+	// in the AcceptDelay range (in seconds), plus BusyDelay seconds for
+	// each aircraft the controller is already tracking; the defaults for
+	// both depend on the type of facility (see defaultAcceptDelays).
+	// Afterward the aircraft is assigned ClimbAltitude (default: its
+	// cruise altitude) and Speed, if given.
+	AcceptDelay   [2]int  `json:"accept_delay,omitempty"`
+	BusyDelay     float32 `json:"busy_delay,omitempty"`
+	ClimbAltitude int     `json:"climb_altitude,omitempty"`
+	Speed         int     `json:"speed,omitempty"`
+
+	// If AcceptAltitude is given, the controller may refuse to take
+	// handoffs (with probability RefuseProbability, default 0.3) until
+	// the aircraft is at or above it--or, for arrivals, at or below it--
+	// as required by the LOA.
+	AcceptAltitude    int     `json:"accept_altitude,omitempty"`
+	RefuseProbability float32 `json:"refuse_probability,omitempty"`
+
+	// If TransferFix and/or TransferAltitude are given, aircraft handed
+	// off to the controller must be routed via TransferFix and cleared
+	// to cross it at TransferAltitude; the controller points out
+	// handoffs that don't conform.
+	TransferFix      string `json:"transfer_fix,omitempty"`
+	TransferAltitude int    `json:"transfer_altitude,omitempty"`
+}
+
+var defaultControllerPolicy = ControllerPolicy{}
+
+// defaultAcceptDelays gives the handoff acceptance delay range and busy
+// delay for each type of facility, keyed by the suffix of the
+// controller's callsign. Towers are quick to take handoffs while centers
+// are slower, especially when they're already working a lot of traffic.
+var defaultAcceptDelays = map[string]struct {
+	Range [2]int
+	Busy  float32
+}{
+	"TWR": {[2]int{1, 5}, 0},
+	"DEP": {[2]int{2, 11}, 0.5},
+	"APP": {[2]int{2, 11}, 0.5},
+	"CTR": {[2]int{4, 15}, 1},
+}
+
+// HandoffAcceptDelay returns a random delay before the given controller accepts
+// a handoff, given that it's currently tracking the given number of
+// aircraft.
+func (p *ControllerPolicy) HandoffAcceptDelay(controller string, tracked int) time.Duration {
+	delay, busy := [2]int{2, 11}, float32(0.5)
+	if idx := strings.LastIndex(controller, "_"); idx != -1 {
+		if d, ok := defaultAcceptDelays[controller[idx+1:]]; ok {
+			delay, busy = d.Range, d.Busy
+		}
+	}
+	if p.AcceptDelay != [2]int{} {
+		delay = p.AcceptDelay
+	}
+	if p.BusyDelay != 0 {
+		busy = p.BusyDelay
+	}
+
+	seconds := float32(delay[0]+rand.Intn(delay[1]-delay[0]+1)) + busy*float32(tracked)
+	return time.Duration(seconds * float32(time.Second))
+}
+
+// MeetsAcceptAltitude returns true if the aircraft meets the policy's
+// altitude requirement for accepting handoffs, if there is one.
+func (p *ControllerPolicy) MeetsAcceptAltitude(ac *Aircraft) bool {
+	return p.AcceptAltitude == 0 || meetsLOAAltitude(ac, p.AcceptAltitude)
+}
+
+// meetsLOAAltitude returns true if a departing or overflying aircraft is at
+// or above the given altitude or an arriving one is at or below it.
+func meetsLOAAltitude(ac *Aircraft, alt int) bool {
+	if fp := ac.FlightPlan; fp != nil {
+		_, arrival := scenarioGroup.Airports[fp.ArrivalAirport]
+		_, departure := scenarioGroup.Airports[fp.DepartureAirport]
+		if arrival && !departure {
+			return int(ac.Altitude)-50 <= alt
+		}
+	}
+	return int(ac.Altitude)+50 >= alt
+}
+
+// RefusesHandoff randomly decides whether the controller will hold off
+// on accepting a handoff of an aircraft that doesn't yet meet the
+// policy's altitude requirement.
+func (p *ControllerPolicy) RefusesHandoff(ac *Aircraft) bool {
+	if p.MeetsAcceptAltitude(ac) {
+		return false
+	}
+	prob := p.RefuseProbability
+	if prob == 0 {
+		prob = 0.3
+	}
+	return rand.Float32() < prob
+}
+
+// TransferViolation returns the receiving controller's description of
+// how the aircraft fails to meet the policy's transfer point
+// requirements, e.g. "I need AAL123 at 11000 over LENDY", or an empty
+// string if it conforms.
+func (p *ControllerPolicy) TransferViolation(ac *Aircraft) string {
+	if p.TransferFix == "" && p.TransferAltitude == 0 {
+		return ""
+	}
+
+	var wp *Waypoint
+	over := ""
+	if p.TransferFix != "" {
+		over = " over " + p.TransferFix
+		idx := FindIf(ac.Waypoints, func(wp Waypoint) bool { return wp.Fix == p.TransferFix })
+		if idx == -1 || ac.AssignedHeading != 0 {
+			if p.TransferAltitude != 0 {
+				return fmt.Sprintf("I need %s via %s at %d", ac.Callsign, p.TransferFix, p.TransferAltitude)
+			}
+			return fmt.Sprintf("I need %s on the route via %s", ac.Callsign, p.TransferFix)
+		}
+		wp = &ac.Waypoints[idx]
+	}
+
+	if p.TransferAltitude != 0 {
+		need := fmt.Sprintf("I need %s at %d%s", ac.Callsign, p.TransferAltitude, over)
+		alt := ac.AssignedAltitude
+		if alt == 0 && wp != nil && wp.HasAltitudeRestriction() {
+			// Flying the procedure; it's fine if its restriction at the
+			// fix allows the required altitude.
+			if lo, hi := wp.AltitudeLimits(); (lo != 0 && lo > p.TransferAltitude) ||
+				(hi != 0 && hi < p.TransferAltitude) {
+				return need
+			}
+			return ""
+		} else if alt == 0 {
+			if alt = ac.SelectedAltitude(); alt == 0 {
+				alt = int(ac.Altitude)
+			}
+		}
+		if abs(alt-p.TransferAltitude) > 100 {
+			return need
+		}
+	}
+	return ""
+}
+
+func (p *ControllerPolicy) Matches(controller string, ac *Aircraft) bool {
+	if p.Controller != "" && p.Controller != controller {
+		return false
+	}
+	if fp := ac.FlightPlan; p.Airport != "" && (fp == nil ||
+		(fp.DepartureAirport != p.Airport && fp.ArrivalAirport != p.Airport)) {
+		return false
+	}
+	if p.Fix != "" && (ac.FlightPlan == nil || Find(strings.Fields(ac.FlightPlan.Route), p.Fix) == -1) {
+		return false
+	}
+	if p.MinAltitude != 0 && int(ac.Altitude) < p.MinAltitude {
+		return false
+	}
+	if p.MaxAltitude != 0 && int(ac.Altitude) > p.MaxAltitude {
+		return false
+	}
+	return true
+}
+
+// ControllerPolicy returns the first of the scenario's policies that
+// matches the given controller and aircraft, or the default policy if
+// none do.
+func (s *Scenario) ControllerPolicy(controller string, ac *Aircraft) *ControllerPolicy {
+	for i := range s.ControllerPolicies {
+		if s.ControllerPolicies[i].Matches(controller, ac) {
+			return &s.ControllerPolicies[i]
+		}
+	}
+	return &defaultControllerPolicy
 }
 
 type ScenarioGroupDepartureRunway struct {
@@ -97,6 +397,8 @@ type ScenarioGroupDepartureRunway struct {
 	Runway      string `json:"runway"`
 	Category    string `json:"category,omitempty"`
 	DefaultRate int32  `json:"rate"`
+	// Optional; see intersections.go.
+	Intersections []IntersectionDeparture `json:"intersections,omitempty"`
 
 	lastDeparture *Departure
 	exitRoutes    map[string]ExitRoute // copied from DepartureRunway
@@ -105,6 +407,11 @@ type ScenarioGroupDepartureRunway struct {
 type ScenarioGroupArrivalRunway struct {
 	Airport string `json:"airport"`
 	Runway  string `json:"runway"`
+	// Optionally, the runway is only assigned to arrivals whose route
+	// includes one of the fixes and/or are of the given category ("jet",
+	// "prop", or "heavy").
+	Fixes    []string `json:"fixes,omitempty"`
+	Category string   `json:"category,omitempty"`
 }
 
 type Wind struct {
@@ -145,6 +452,19 @@ func (s *Scenario) Name() string {
 }
 
 func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	switch s.Surveillance {
+	case "":
+		s.Surveillance = "radar"
+	case "radar", "adsb":
+	default:
+		e.ErrorString("\"surveillance\" must be \"radar\" or \"adsb\"")
+	}
+	if s.ADSBEquipage == 0 {
+		s.ADSBEquipage = defaultADSBEquipage
+	} else if s.ADSBEquipage < 0 || s.ADSBEquipage > 1 {
+		e.ErrorString("\"adsb_equipage\" must be between 0 and 1")
+	}
+
 	for _, as := range s.ApproachAirspaceNames {
 		if vol, ok := sg.Airspace.Volumes[as]; !ok {
 			e.ErrorString("unknown approach airspace \"%s\"", as)
@@ -160,6 +480,136 @@ func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
 		}
 	}
 
+	for i, ref := range s.Reference {
+		if ref.Title == "" {
+			e.ErrorString("\"title\" not specified for reference document %d", i)
+		}
+	}
+
+	for callsign, sector := range s.Sectors {
+		e.Push("Sector " + callsign)
+
+		if _, ok := sg.ControlPositions[callsign]; !ok {
+			e.ErrorString("controller \"%s\" not found in \"control_positions\"", callsign)
+		}
+		for _, as := range sector.AirspaceNames {
+			if vol, ok := sg.Airspace.Volumes[as]; !ok {
+				e.ErrorString("unknown airspace \"%s\"", as)
+			} else {
+				sector.Airspace = append(sector.Airspace, vol...)
+				for _, v := range vol {
+					for _, pts := range v.Boundaries {
+						sector.triangles = append(sector.triangles, TriangulatePolygon(pts)...)
+					}
+				}
+			}
+		}
+		for i, hp := range sector.HandoffPoints {
+			if pos, ok := sg.Locate(hp.Fix); !ok {
+				e.ErrorString("unknown handoff point fix \"%s\"", hp.Fix)
+			} else {
+				sector.HandoffPoints[i].Location = pos
+			}
+			if _, ok := sg.ControlPositions[hp.Controller]; !ok {
+				e.ErrorString("handoff point controller \"%s\" not found in \"control_positions\"", hp.Controller)
+			}
+		}
+
+		e.Pop()
+	}
+
+	for i := range s.RunwayConditions {
+		e.Push("Runway condition " + runwayKey(s.RunwayConditions[i].Airport, s.RunwayConditions[i].Runway))
+		s.RunwayConditions[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	for i := range s.DependentApproaches {
+		e.Push(fmt.Sprintf("Dependent approaches %d", i))
+		s.DependentApproaches[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	for i := range s.SharedFinals {
+		e.Push(fmt.Sprintf("Shared final %d", i))
+		s.SharedFinals[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	instructionKeys := make(map[string]interface{})
+	for i := range s.Instructions {
+		e.Push(fmt.Sprintf("Instruction %d", i))
+		s.Instructions[i].PostDeserialize(instructionKeys, e)
+		e.Pop()
+	}
+
+	for i := range s.WeatherLayers {
+		e.Push(fmt.Sprintf("Weather layer %d", i))
+		s.WeatherLayers[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	for i := range s.SIGMETs {
+		e.Push("SIGMET " + s.SIGMETs[i].Id)
+		s.SIGMETs[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	for i := range s.Precipitation {
+		e.Push(fmt.Sprintf("Precipitation cell %d", i))
+		s.Precipitation[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	if s.Challenge != nil {
+		e.Push("Challenge")
+		s.Challenge.PostDeserialize(e)
+		e.Pop()
+	}
+
+	for i := range s.ControllerPolicies {
+		p := &s.ControllerPolicies[i]
+		e.Push(fmt.Sprintf("Controller policy %d", i))
+		if p.Controller != "" {
+			if _, ok := sg.ControlPositions[p.Controller]; !ok {
+				e.ErrorString("controller \"%s\" not found in \"control_positions\"", p.Controller)
+			}
+		}
+		if p.Airport != "" {
+			if _, ok := sg.Airports[p.Airport]; !ok {
+				e.ErrorString("airport \"%s\" not found", p.Airport)
+			}
+		}
+		if p.Script != "" {
+			if p.HandoffDistance != 0 || p.HandoffAltitude != 0 || p.HandoffSpeed != 0 {
+				e.ErrorString("\"script\" can't be given along with \"handoff_distance\", " +
+					"\"handoff_altitude\", or \"handoff_speed\"")
+			}
+			p.script = parsePolicyScript(p.Script, e)
+		}
+		if p.MaxAltitude != 0 && p.MinAltitude > p.MaxAltitude {
+			e.ErrorString("\"min_altitude\" %d is greater than \"max_altitude\" %d", p.MinAltitude, p.MaxAltitude)
+		}
+		if p.HandoffDistance < 0 {
+			e.ErrorString("\"handoff_distance\" must be positive")
+		}
+		if p.AcceptDelay != [2]int{} && (p.AcceptDelay[0] < 0 || p.AcceptDelay[1] < p.AcceptDelay[0]) {
+			e.ErrorString("invalid \"accept_delay\" range %v", p.AcceptDelay)
+		}
+		if p.BusyDelay < 0 {
+			e.ErrorString("\"busy_delay\" must be positive")
+		}
+		if p.RefuseProbability < 0 || p.RefuseProbability > 1 {
+			e.ErrorString("\"refuse_probability\" must be between 0 and 1")
+		}
+		if p.TransferFix != "" {
+			if _, ok := sg.Locate(p.TransferFix); !ok {
+				e.ErrorString("\"transfer_fix\" %s not found", p.TransferFix)
+			}
+		}
+		e.Pop()
+	}
+
 	sort.Slice(s.DepartureRunways, func(i, j int) bool {
 		if s.DepartureRunways[i].Airport != s.DepartureRunways[j].Airport {
 			return s.DepartureRunways[i].Airport < s.DepartureRunways[j].Airport
@@ -194,6 +644,17 @@ func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
 				}
 			}
 		}
+
+		fraction := float32(0)
+		for j := range rwy.Intersections {
+			e.Push("Intersection " + rwy.Intersections[j].Taxiway)
+			s.DepartureRunways[i].Intersections[j].PostDeserialize(sg, e)
+			fraction += rwy.Intersections[j].Fraction
+			e.Pop()
+		}
+		if fraction > 1 {
+			e.ErrorString("intersection \"fraction\"s sum to more than 1")
+		}
 		e.Pop()
 	}
 
@@ -204,6 +665,23 @@ func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
 		return s.ArrivalRunways[i].Airport < s.ArrivalRunways[j].Airport
 	})
 
+	for _, rwy := range s.ArrivalRunways {
+		e.Push("Arrival runway " + rwy.Airport + " " + rwy.Runway)
+		if _, ok := sg.Airports[rwy.Airport]; !ok {
+			e.ErrorString("airport \"%s\" not found", rwy.Airport)
+		}
+		for _, fix := range rwy.Fixes {
+			if _, ok := sg.Locate(fix); !ok {
+				e.ErrorString("fix \"%s\" not found", fix)
+			}
+		}
+		if rwy.Category != "" && Find(arrivalRunwayCategories, rwy.Category) == -1 {
+			e.ErrorString("invalid \"category\" \"%s\"; must be one of %s", rwy.Category,
+				strings.Join(arrivalRunwayCategories, ", "))
+		}
+		e.Pop()
+	}
+
 	for _, name := range SortedMapKeys(s.ArrivalGroupDefaultRates) {
 		e.Push("Arrival group " + name)
 		// Make sure the arrival group has been defined
@@ -306,6 +784,36 @@ func (sg *ScenarioGroup) PostDeserialize(e *ErrorLogger) {
 		e.Pop()
 	}
 
+	if defaultReadbacks == nil {
+		loadDefaultReadbacks()
+	}
+	sg.readbacks = parseReadbacks(sg.Readbacks, defaultReadbacks, e)
+
+	for fix, ph := range sg.Holds {
+		e.Push("Hold " + fix)
+		ph.PostDeserialize(fix, sg, e)
+		e.Pop()
+	}
+
+	for i := range sg.MVAs {
+		e.Push(fmt.Sprintf("MVA %d", i))
+		sg.MVAs[i].PostDeserialize(e)
+		e.Pop()
+	}
+	for i := range sg.MEAs {
+		e.Push(fmt.Sprintf("MEA %s-%s", sg.MEAs[i].From, sg.MEAs[i].To))
+		sg.MEAs[i].PostDeserialize(sg, e)
+		e.Pop()
+	}
+
+	if sg.TimeZone != "" {
+		if loc, err := time.LoadLocation(sg.TimeZone); err != nil {
+			e.ErrorString("\"time_zone\" \"%s\": %v", sg.TimeZone, err)
+		} else {
+			sg.timeZone = loc
+		}
+	}
+
 	if sg.PrimaryAirport == "" {
 		e.ErrorString("\"primary_airport\" not specified")
 	} else if _, ok := sg.Locate(sg.PrimaryAirport); !ok {
@@ -364,6 +872,12 @@ func (sg *ScenarioGroup) PostDeserialize(e *ErrorLogger) {
 		sg.Center = pos
 	}
 
+	for i, ref := range sg.Reference {
+		if ref.Title == "" {
+			e.ErrorString("\"title\" not specified for reference document %d", i)
+		}
+	}
+
 	if len(sg.RadarSites) == 0 {
 		e.ErrorString("no \"radar_sites\" specified")
 	}
@@ -392,6 +906,11 @@ func (sg *ScenarioGroup) PostDeserialize(e *ErrorLogger) {
 			e.Push("Route " + ar.Route)
 
 			sg.InitializeWaypointLocations(ar.Waypoints, e)
+			if len(ar.PropWaypoints) > 0 {
+				e.Push("Prop waypoints")
+				sg.InitializeWaypointLocations(ar.PropWaypoints, e)
+				e.Pop()
+			}
 
 			for rwy, wp := range ar.RunwayWaypoints {
 				e.Push("Runway " + rwy)
@@ -430,7 +949,10 @@ func (sg *ScenarioGroup) InitializeWaypointLocations(waypoints []Waypoint, e *Er
 		if e != nil {
 			e.Push("Fix " + wp.Fix)
 		}
-		if pos, ok := sg.Locate(wp.Fix); !ok {
+		if !wp.Location.IsZero() {
+			// Already located, e.g. for procedures from the CIFP.
+			prev = wp.Location
+		} else if pos, ok := sg.Locate(wp.Fix); !ok {
 			if e != nil {
 				e.ErrorString("unable to locate waypoint")
 			}
@@ -576,9 +1098,9 @@ func (r RootFS) Open(filename string) (fs.File, error) {
 // scenarios/ directory in the source code distribution as well as,
 // optionally, a scenario file provided on the command line.  It doesn't
 // try to do any sort of meaningful error handling but it does try to
-// continue on in the presence of errors; all errors will be printed and
-// the program will exit if there are any.  We'd rather force any errors
-// due to invalid scenario definitions to be fixed...
+// continue on in the presence of errors; all errors are reported via the
+// provided ErrorLogger and scenario groups with errors aren't returned,
+// so that the user can still run the ones that loaded successfully.
 func LoadScenarioGroups(e *ErrorLogger) map[string]*ScenarioGroup {
 	// First load the embedded video maps.
 	videoMapCommandBuffers := make(map[string]map[string]CommandBuffer)
@@ -595,8 +1117,7 @@ func LoadScenarioGroups(e *ErrorLogger) map[string]*ScenarioGroup {
 		return nil
 	})
 	if err != nil {
-		lg.Errorf("%v", err)
-		os.Exit(1)
+		e.Error(err)
 	}
 
 	// Load the video map specified on the command line, if any.
@@ -635,8 +1156,7 @@ func LoadScenarioGroups(e *ErrorLogger) map[string]*ScenarioGroup {
 		return nil
 	})
 	if err != nil {
-		lg.Errorf("%v", err)
-		os.Exit(1)
+		e.Error(err)
 	}
 
 	// Load the scenario specified on command line, if any.
@@ -669,33 +1189,69 @@ func LoadScenarioGroups(e *ErrorLogger) map[string]*ScenarioGroup {
 	// Final tidying before we return the loaded scenarios.
 	for name, sgroup := range scenarioGroups {
 		e.Push("Scenario group " + name)
+		nErrors := len(e.errors)
+
+		initializeScenarioGroup(sgroup, videoMapCommandBuffers, e)
+
+		if len(e.errors) > nErrors {
+			delete(scenarioGroups, name)
+		}
+
+		e.Pop()
+	}
+
+	return scenarioGroups
+}
 
-		// Initialize the CommandBuffers in the scenario's STARSMaps.
-		if sgroup.VideoMapFile == "" {
-			e.ErrorString("no \"video_map_file\" specified")
+// selectInitialScenarioGroup sets scenarioGroup to the last one used, if
+// it's available, or otherwise to the first one alphabetically.
+func selectInitialScenarioGroup() {
+	scenarioGroup = nil
+	if s, ok := scenarioGroups[globalConfig.LastScenarioGroup]; ok {
+		scenarioGroup = s
+	} else if len(scenarioGroups) > 0 {
+		scenarioGroup = scenarioGroups[SortedMapKeys(scenarioGroups)[0]]
+	}
+}
+
+// initializeScenarioGroup sets up the video maps for a scenario group
+// that has just been deserialized and then checks it for errors.
+func initializeScenarioGroup(sgroup *ScenarioGroup, videoMapCommandBuffers map[string]map[string]CommandBuffer,
+	e *ErrorLogger) {
+	// Initialize the CommandBuffers in the scenario's STARSMaps.
+	if sgroup.VideoMapFile == "" {
+		e.ErrorString("no \"video_map_file\" specified")
+	} else {
+		if bufferMap, ok := videoMapCommandBuffers[sgroup.VideoMapFile]; !ok {
+			e.ErrorString("video map file \"%s\" unknown", sgroup.VideoMapFile)
 		} else {
-			if bufferMap, ok := videoMapCommandBuffers[sgroup.VideoMapFile]; !ok {
-				e.ErrorString("video map file \"%s\" unknown", sgroup.VideoMapFile)
-			} else {
-				for i, sm := range sgroup.STARSMaps {
-					if cb, ok := bufferMap[sm.Name]; !ok {
-						e.ErrorString("video map \"%s\" not found", sm.Name)
-					} else {
-						sgroup.STARSMaps[i].cb = cb
-					}
+			for i, sm := range sgroup.STARSMaps {
+				if cb, ok := bufferMap[sm.Name]; !ok {
+					e.ErrorString("video map \"%s\" not found", sm.Name)
+				} else {
+					sgroup.STARSMaps[i].cb = cb
 				}
 			}
 		}
+	}
 
-		// This is horribly hacky but PostDeserialize ends up calling
-		// functions that access the scenario global
-		// (e.g. nmdistance2ll)...
-		scenarioGroup = sgroup
-		sgroup.PostDeserialize(e)
-		scenarioGroup = nil
+	// This is horribly hacky but PostDeserialize ends up calling
+	// functions that access the scenario global
+	// (e.g. nmdistance2ll)...
+	prev := scenarioGroup
+	scenarioGroup = sgroup
+	sgroup.PostDeserialize(e)
+	scenarioGroup = prev
+}
 
-		e.Pop()
+// loadVideoMapFile loads the video maps from the given file, which may
+// either be one of the ones embedded in vice or a file on disk.
+func loadVideoMapFile(filename string, e *ErrorLogger) map[string]CommandBuffer {
+	if _, err := fs.Stat(embeddedVideoMaps, filename); err == nil {
+		return loadVideoMaps(embeddedVideoMaps, filename, e)
+	} else if filepath.IsAbs(filename) {
+		return loadVideoMaps(RootFS{}, filename, e)
+	} else {
+		return loadVideoMaps(os.DirFS("."), filename, e)
 	}
-
-	return scenarioGroups
 }
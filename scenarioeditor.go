@@ -0,0 +1,877 @@
+// scenarioeditor.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// The ScenarioEditorPane makes it possible to create and edit scenario
+// group files without leaving vice. The pane shows a summary of the
+// scenario group being edited along with any problems with it; the
+// editor itself is in the pane's settings window, which is also opened
+// by clicking in the pane. The scenario group is checked as it is
+// edited, in the same way that scenario groups are when vice starts.
+// Once it has been saved without errors, it can be activated: it is
+// then available for new simulations right away and, since it is also
+// made the developer scenario file, it is loaded in future sessions.
+//
+// The editor covers the parts of a scenario group that are most often
+// changed; everything else in a file that is opened is preserved when
+// it is saved.
+
+type ScenarioEditorPane struct {
+	FontIdentifier FontIdentifier
+	font           *Font
+
+	// The scenario group file being edited; it is loaded again when
+	// the pane is activated.
+	Filename string
+
+	sg        *ScenarioGroup
+	modified  bool
+	errors    []string
+	status    string
+	mustCheck bool
+	lastCheck time.Time
+
+	scenario        string // name of the scenario being edited
+	newAirport      string
+	newController   string
+	newRadarSite    string
+	newArrivalGroup string
+	newScenario     string
+
+	// Text of fields that didn't parse, keyed by label, so that the
+	// user can keep editing it.
+	pendingText map[string]string
+
+	videoMaps  map[string]map[string]CommandBuffer
+	fileDialog *FileSelectDialogBox
+	scrollbar  *ScrollBar
+}
+
+func NewScenarioEditorPane() *ScenarioEditorPane {
+	return &ScenarioEditorPane{
+		FontIdentifier: FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (se *ScenarioEditorPane) Activate() {
+	if se.font = GetFont(se.FontIdentifier); se.font == nil {
+		se.font = GetDefaultFont()
+		se.FontIdentifier = se.font.id
+	}
+	if se.scrollbar == nil {
+		se.scrollbar = NewScrollBar(4, false)
+	}
+	if se.pendingText == nil {
+		se.pendingText = make(map[string]string)
+	}
+	if se.videoMaps == nil {
+		se.videoMaps = make(map[string]map[string]CommandBuffer)
+	}
+	if se.sg == nil {
+		if se.Filename != "" {
+			se.load(se.Filename)
+		} else {
+			se.newScenarioGroup()
+		}
+	}
+}
+
+func (se *ScenarioEditorPane) Deactivate()                {}
+func (se *ScenarioEditorPane) CanTakeKeyboardFocus() bool { return false }
+
+func (se *ScenarioEditorPane) Name() string { return "Scenario Editor" }
+
+func (se *ScenarioEditorPane) newScenarioGroup() {
+	se.sg = &ScenarioGroup{
+		Name:             "New scenario group",
+		Airports:         make(map[string]*Airport),
+		FixesStrings:     make(map[string]string),
+		Scenarios:        make(map[string]*Scenario),
+		ControlPositions: make(map[string]*Controller),
+		ArrivalGroups:    make(map[string][]Arrival),
+		RadarSites:       make(map[string]*RadarSite),
+		NmPerLatitude:    60,
+	}
+	se.scenario = ""
+	se.modified = false
+	se.status = ""
+	se.pendingText = make(map[string]string)
+	se.mustCheck = true
+}
+
+func (se *ScenarioEditorPane) load(filename string) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		se.status = err.Error()
+		return
+	}
+	var sg ScenarioGroup
+	if err := UnmarshalJSON(contents, &sg); err != nil {
+		se.status = fmt.Sprintf("%s: %v", filename, err)
+		return
+	}
+
+	se.sg = &sg
+	se.Filename = filename
+	se.scenario = ""
+	if names := SortedMapKeys(sg.Scenarios); len(names) > 0 {
+		se.scenario = names[0]
+	}
+	se.modified = false
+	se.status = "Loaded " + filename
+	se.pendingText = make(map[string]string)
+	se.mustCheck = true
+}
+
+func (se *ScenarioEditorPane) save() {
+	b, err := json.MarshalIndent(se.sg, "", "  ")
+	if err == nil {
+		err = os.WriteFile(se.Filename, b, 0o644)
+	}
+	if err != nil {
+		se.status = err.Error()
+	} else {
+		se.modified = false
+		se.status = "Saved " + se.Filename
+	}
+}
+
+// copyScenarioGroup returns a copy of the scenario group being edited
+// that is ready to be initialized; the copy is made by way of JSON so
+// that it matches what will be loaded from the file.
+func (se *ScenarioEditorPane) copyScenarioGroup() (*ScenarioGroup, error) {
+	b, err := json.Marshal(se.sg)
+	if err != nil {
+		return nil, err
+	}
+	var sg ScenarioGroup
+	if err := json.Unmarshal(b, &sg); err != nil {
+		return nil, err
+	}
+	return &sg, nil
+}
+
+// initialize initializes a copy of the scenario group being edited,
+// checking it for errors in the process.
+func (se *ScenarioEditorPane) initialize(e *ErrorLogger) *ScenarioGroup {
+	sg, err := se.copyScenarioGroup()
+	if err != nil {
+		e.Error(err)
+		return nil
+	}
+	if sg.Name == "" {
+		e.ErrorString("scenario group is missing \"name\"")
+	}
+	if f := sg.VideoMapFile; f != "" {
+		if _, ok := se.videoMaps[f]; !ok {
+			var vme ErrorLogger
+			if vm := loadVideoMapFile(f, &vme); vm != nil {
+				se.videoMaps[f] = vm
+			}
+		}
+	}
+	initializeScenarioGroup(sg, se.videoMaps, e)
+	return sg
+}
+
+func (se *ScenarioEditorPane) check() {
+	var e ErrorLogger
+	se.initialize(&e)
+	se.errors = e.errors
+	se.mustCheck = false
+	se.lastCheck = time.Now()
+}
+
+// activate makes the saved scenario group available for new simulations
+// and opens the dialog to start one.
+func (se *ScenarioEditorPane) activate() {
+	var e ErrorLogger
+	sg := se.initialize(&e)
+	if e.HaveErrors() {
+		se.errors = e.errors
+		se.status = "Unable to activate scenario group with errors"
+		return
+	}
+
+	scenarioGroups[sg.Name] = sg
+	scenarioGroup = sg
+	globalConfig.LastScenarioGroup = sg.Name
+	globalConfig.DevScenarioFile = se.Filename
+	se.status = "Activated " + sg.Name
+	lg.Printf("%s: activated scenario group %s", se.Filename, sg.Name)
+
+	uiShowModalDialog(NewModalDialogBox(&ConnectModalClient{}), false)
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Pane drawing
+
+func (se *ScenarioEditorPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
+	if se.mustCheck && time.Since(se.lastCheck) > 250*time.Millisecond {
+		se.check()
+	}
+	if ctx.mouse != nil && ctx.mouse.Clicked[MouseButtonPrimary] {
+		wmShowPaneSettings(se)
+	}
+
+	ctx.SetWindowCoordinateMatrices(cb)
+
+	bx, _ := se.font.BoundText(" ", 0)
+	fw, fh := float32(bx), float32(se.font.size)
+	indent := float32(int32(fw / 2))
+	width, height := ctx.paneExtent.Width(), ctx.paneExtent.Height()
+	cols := max(int((width-2*indent-float32(se.scrollbar.Width()))/fw), 10)
+
+	type line struct {
+		text  string
+		color RGB
+	}
+	var lines []line
+	add := func(color RGB, s string, args ...interface{}) {
+		wrapped, _ := wrapText(fmt.Sprintf(s, args...), cols, 2, false)
+		for _, w := range strings.Split(wrapped, "\n") {
+			lines = append(lines, line{text: w, color: color})
+		}
+	}
+
+	sg := se.sg
+	title := sg.Name
+	if se.modified {
+		title += " (modified)"
+	}
+	add(UITextHighlightColor, "%s", title)
+	if se.Filename != "" {
+		add(UITextColor, "File: %s", privacyFilter(se.Filename))
+	}
+	add(UITextColor, "Airports: %s", strings.Join(SortedMapKeys(sg.Airports), " "))
+	add(UITextColor, "Control positions: %s", strings.Join(SortedMapKeys(sg.ControlPositions), " "))
+	var groups []string
+	for _, name := range SortedMapKeys(sg.ArrivalGroups) {
+		groups = append(groups, fmt.Sprintf("%s (%d)", name, len(sg.ArrivalGroups[name])))
+	}
+	add(UITextColor, "Arrival groups: %s", strings.Join(groups, " "))
+	for _, name := range SortedMapKeys(sg.Scenarios) {
+		sc := sg.Scenarios[name]
+		add(UITextColor, "Scenario %s: %s, %d departure runways, %d arrival runways", name, sc.Callsign,
+			len(sc.DepartureRunways), len(sc.ArrivalRunways))
+	}
+	lines = append(lines, line{})
+
+	if len(se.errors) == 0 {
+		add(UITextColor, "No problems found")
+	} else {
+		add(UIErrorColor, "%d problems:", len(se.errors))
+		for _, err := range se.errors {
+			add(UIErrorColor, "  %s", err)
+		}
+	}
+	if se.status != "" {
+		lines = append(lines, line{})
+		add(UITextColor, "%s", se.status)
+	}
+	lines = append(lines, line{})
+	add(UITextColor, "Click to open the editor.")
+
+	y := height - indent
+	visibleLines := int(y / fh)
+	se.scrollbar.Update(len(lines), visibleLines, ctx)
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	for i := se.scrollbar.Offset(); i < min(len(lines), se.scrollbar.Offset()+visibleLines); i++ {
+		td.AddText(lines[i].text, [2]float32{indent, y}, TextStyle{Font: se.font, Color: lines[i].color})
+		y -= fh
+	}
+
+	se.scrollbar.Draw(ctx, cb)
+	td.GenerateCommands(cb)
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Editor
+
+// edited should be called with the result of each ImGui widget that
+// modifies the scenario group.
+func (se *ScenarioEditorPane) edited(changed bool) {
+	if changed {
+		se.modified = true
+		se.mustCheck = true
+	}
+}
+
+func (se *ScenarioEditorPane) inputInt(label string, v *int) {
+	i := int32(*v)
+	if imgui.InputIntV(label, &i, 0, 0, 0) {
+		*v = int(i)
+		se.edited(true)
+	}
+}
+
+func (se *ScenarioEditorPane) inputText(label string, s *string) {
+	se.edited(imgui.InputTextV(label, s, imgui.InputTextFlagsCharsUppercase, nil))
+}
+
+// inputJSONString edits a value that is stored as a string in the
+// scenario group's JSON (locations, waypoints, ...). The value is only
+// updated when the text parses; until then, the text is kept so that
+// the user can fix it.
+func (se *ScenarioEditorPane) inputJSONString(label string, v interface {
+	json.Marshaler
+	json.Unmarshaler
+}) {
+	text, pending := se.pendingText[label]
+	if !pending {
+		if b, err := v.MarshalJSON(); err == nil {
+			text, _ = strconv.Unquote(string(b))
+		}
+	}
+	if imgui.InputTextV(label, &text, imgui.InputTextFlagsCharsUppercase, nil) {
+		if err := v.UnmarshalJSON([]byte(strconv.Quote(text))); err != nil {
+			se.pendingText[label] = text
+		} else {
+			delete(se.pendingText, label)
+			se.edited(true)
+		}
+	}
+	if _, ok := se.pendingText[label]; ok {
+		imgui.SameLine()
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text("invalid")
+		imgui.PopStyleColor()
+	}
+}
+
+func (se *ScenarioEditorPane) DrawUI() {
+	if newFont, changed := DrawFontPicker(&se.FontIdentifier, "Font"); changed {
+		se.font = newFont
+	}
+	imgui.Separator()
+
+	se.drawFileUI()
+	if imgui.CollapsingHeader("Scenario group") {
+		se.drawGeneralUI()
+	}
+	if imgui.CollapsingHeader("Airports") {
+		se.drawAirportsUI()
+	}
+	if imgui.CollapsingHeader("Control positions") {
+		se.drawControlPositionsUI()
+	}
+	if imgui.CollapsingHeader("Radar sites") {
+		se.drawRadarSitesUI()
+	}
+	if imgui.CollapsingHeader("Arrival groups") {
+		se.drawArrivalGroupsUI()
+	}
+	if imgui.CollapsingHeader("Scenarios") {
+		se.drawScenariosUI()
+	}
+}
+
+func (se *ScenarioEditorPane) drawFileUI() {
+	imgui.InputTextV("Filename", &se.Filename, 0, nil)
+	if imgui.Button("Open...") {
+		se.fileDialog = NewFileSelectDialogBox("Open Scenario Group", []string{".json"}, se.Filename,
+			func(filename string) {
+				se.load(filename)
+				se.fileDialog = nil
+			})
+		se.fileDialog.Activate()
+	}
+	imgui.SameLine()
+	if imgui.Button("New") {
+		se.newScenarioGroup()
+	}
+	imgui.SameLine()
+	uiStartDisable(se.Filename == "")
+	if imgui.Button("Save") {
+		se.save()
+	}
+	uiEndDisable(se.Filename == "")
+	imgui.SameLine()
+	cantActivate := se.modified || se.Filename == "" || len(se.errors) > 0
+	uiStartDisable(cantActivate)
+	if imgui.Button("Activate") {
+		se.activate()
+	}
+	uiEndDisable(cantActivate)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Make the saved scenario group available for new simulations")
+	}
+
+	if se.fileDialog != nil {
+		se.fileDialog.Draw()
+	}
+
+	if len(se.errors) > 0 {
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text(fmt.Sprintf("%d problems; see the Scenario Editor pane for details", len(se.errors)))
+		imgui.PopStyleColor()
+	}
+	if se.status != "" {
+		imgui.Text(se.status)
+	}
+}
+
+func (se *ScenarioEditorPane) drawGeneralUI() {
+	sg := se.sg
+	se.edited(imgui.InputTextV("Name", &sg.Name, 0, nil))
+	se.inputText("Primary airport", &sg.PrimaryAirport)
+	se.inputText("Center", &sg.CenterString)
+	se.edited(imgui.DragFloatV("Nm per latitude", &sg.NmPerLatitude, 0.01, 0, 0, "%.2f", 0))
+	se.edited(imgui.DragFloatV("Nm per longitude", &sg.NmPerLongitude, 0.01, 0, 0, "%.2f", 0))
+	imgui.SameLine()
+	if imgui.Button("From center") {
+		var p Point2LL
+		if err := p.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(sg.CenterString)))); err == nil {
+			sg.NmPerLongitude = 60 * cos(radians(p.Latitude()))
+			se.edited(true)
+		} else {
+			se.status = "Unable to locate center \"" + sg.CenterString + "\""
+		}
+	}
+	se.edited(imgui.DragFloatV("Magnetic variation", &sg.MagneticVariation, 0.01, 0, 0, "%.1f", 0))
+	se.edited(imgui.InputTextV("Video map file", &sg.VideoMapFile, 0, nil))
+
+	if imgui.BeginComboV("Default controller", sg.DefaultController, 0) {
+		for _, callsign := range SortedMapKeys(sg.ControlPositions) {
+			if imgui.SelectableV(callsign, callsign == sg.DefaultController, 0, imgui.Vec2{}) {
+				sg.DefaultController = callsign
+				se.edited(true)
+			}
+		}
+		imgui.EndCombo()
+	}
+	if imgui.BeginComboV("Default scenario", sg.DefaultScenarioGroup, 0) {
+		for _, name := range SortedMapKeys(sg.Scenarios) {
+			if imgui.SelectableV(name, name == sg.DefaultScenarioGroup, 0, imgui.Vec2{}) {
+				sg.DefaultScenarioGroup = name
+				se.edited(true)
+			}
+		}
+		imgui.EndCombo()
+	}
+}
+
+func (se *ScenarioEditorPane) drawAirportsUI() {
+	sg := se.sg
+	flags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	if imgui.BeginTableV("airports", 5, flags, imgui.Vec2{700, 0}, 0) {
+		imgui.TableSetupColumn("Airport")
+		imgui.TableSetupColumn("Elevation")
+		imgui.TableSetupColumn("Location")
+		imgui.TableSetupColumn("Departure controller")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+
+		for _, name := range SortedMapKeys(sg.Airports) {
+			ap := sg.Airports[name]
+			imgui.PushID(name)
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(name)
+			imgui.TableNextColumn()
+			se.inputInt("##elevation", &ap.Elevation)
+			imgui.TableNextColumn()
+			se.inputJSONString("##location-"+name, &ap.Location)
+			imgui.TableNextColumn()
+			se.inputText("##depcontroller", &ap.DepartureController)
+			imgui.TableNextColumn()
+			if imgui.Button("Remove") {
+				delete(sg.Airports, name)
+				se.edited(true)
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+	}
+
+	imgui.InputTextV("##newairport", &se.newAirport, imgui.InputTextFlagsCharsUppercase, nil)
+	imgui.SameLine()
+	if imgui.Button("Add airport") && se.newAirport != "" {
+		if _, ok := sg.Airports[se.newAirport]; ok {
+			se.status = se.newAirport + ": airport already defined"
+		} else {
+			ap := &Airport{}
+			// Start with the FAA's information, if available.
+			if faa, ok := database.Airports[se.newAirport]; ok {
+				ap.Elevation = faa.Elevation
+				ap.Location = faa.Location
+			}
+			sg.Airports[se.newAirport] = ap
+			se.newAirport = ""
+			se.edited(true)
+		}
+	}
+}
+
+func (se *ScenarioEditorPane) drawControlPositionsUI() {
+	sg := se.sg
+	flags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	if imgui.BeginTableV("controllers", 5, flags, imgui.Vec2{600, 0}, 0) {
+		imgui.TableSetupColumn("Callsign")
+		imgui.TableSetupColumn("Frequency")
+		imgui.TableSetupColumn("Sector")
+		imgui.TableSetupColumn("Scope")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+
+		for _, callsign := range SortedMapKeys(sg.ControlPositions) {
+			ctrl := sg.ControlPositions[callsign]
+			imgui.PushID(callsign)
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(callsign)
+			imgui.TableNextColumn()
+			f := float32(ctrl.Frequency) / 1000
+			if imgui.DragFloatV("##frequency", &f, 0.005, 0, 0, "%.3f", 0) {
+				ctrl.Frequency = NewFrequency(f)
+				se.edited(true)
+			}
+			imgui.TableNextColumn()
+			se.inputText("##sector", &ctrl.SectorId)
+			imgui.TableNextColumn()
+			se.inputText("##scope", &ctrl.Scope)
+			imgui.TableNextColumn()
+			if imgui.Button("Remove") {
+				delete(sg.ControlPositions, callsign)
+				se.edited(true)
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+	}
+
+	imgui.InputTextV("##newcontroller", &se.newController, imgui.InputTextFlagsCharsUppercase, nil)
+	imgui.SameLine()
+	if imgui.Button("Add control position") && se.newController != "" {
+		if _, ok := sg.ControlPositions[se.newController]; ok {
+			se.status = se.newController + ": control position already defined"
+		} else {
+			sg.ControlPositions[se.newController] = &Controller{Frequency: NewFrequency(118)}
+			se.newController = ""
+			se.edited(true)
+		}
+	}
+}
+
+func (se *ScenarioEditorPane) drawRadarSitesUI() {
+	sg := se.sg
+	flags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	if imgui.BeginTableV("radarsites", 6, flags, imgui.Vec2{700, 0}, 0) {
+		imgui.TableSetupColumn("Site")
+		imgui.TableSetupColumn("Char")
+		imgui.TableSetupColumn("Position")
+		imgui.TableSetupColumn("Primary range")
+		imgui.TableSetupColumn("Secondary range")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+
+		for _, name := range SortedMapKeys(sg.RadarSites) {
+			rs := sg.RadarSites[name]
+			imgui.PushID(name)
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(name)
+			imgui.TableNextColumn()
+			se.inputText("##char", &rs.Char)
+			imgui.TableNextColumn()
+			se.inputText("##position", &rs.Position)
+			imgui.TableNextColumn()
+			se.edited(imgui.InputIntV("##primary", &rs.PrimaryRange, 0, 0, 0))
+			imgui.TableNextColumn()
+			se.edited(imgui.InputIntV("##secondary", &rs.SecondaryRange, 0, 0, 0))
+			imgui.TableNextColumn()
+			if imgui.Button("Remove") {
+				delete(sg.RadarSites, name)
+				se.edited(true)
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+	}
+
+	imgui.InputTextV("##newradarsite", &se.newRadarSite, imgui.InputTextFlagsCharsUppercase, nil)
+	imgui.SameLine()
+	if imgui.Button("Add radar site") && se.newRadarSite != "" {
+		if _, ok := sg.RadarSites[se.newRadarSite]; ok {
+			se.status = se.newRadarSite + ": radar site already defined"
+		} else {
+			sg.RadarSites[se.newRadarSite] = &RadarSite{PrimaryRange: 60, SecondaryRange: 120}
+			se.newRadarSite = ""
+			se.edited(true)
+		}
+	}
+}
+
+func (se *ScenarioEditorPane) drawArrivalGroupsUI() {
+	sg := se.sg
+	for _, group := range SortedMapKeys(sg.ArrivalGroups) {
+		imgui.PushID(group)
+		imgui.Separator()
+		imgui.Text("Arrival group " + group)
+		imgui.SameLine()
+		if imgui.Button("Remove group") {
+			delete(sg.ArrivalGroups, group)
+			se.edited(true)
+			imgui.PopID()
+			continue
+		}
+
+		arrivals := sg.ArrivalGroups[group]
+		for i := 0; i < len(arrivals); i++ {
+			ar := &arrivals[i]
+			id := fmt.Sprintf("%s-%d", group, i)
+			imgui.PushID(id)
+			imgui.Text(fmt.Sprintf("Arrival %d", i+1))
+			imgui.SameLine()
+			if imgui.Button("Remove arrival") {
+				arrivals = append(arrivals[:i], arrivals[i+1:]...)
+				sg.ArrivalGroups[group] = arrivals
+				se.edited(true)
+				imgui.PopID()
+				break
+			}
+			se.inputText("Route", &ar.Route)
+			se.inputJSONString("Waypoints##"+id, &ar.Waypoints)
+			se.inputText("Initial controller", &ar.InitialController)
+			se.inputInt("Initial altitude", &ar.InitialAltitude)
+			se.inputInt("Cleared altitude", &ar.ClearedAltitude)
+			se.inputInt("Initial speed", &ar.InitialSpeed)
+			se.inputInt("Speed restriction", &ar.SpeedRestriction)
+			se.inputInt("Cruise altitude", &ar.CruiseAltitude)
+			se.inputText("Expect approach", &ar.ExpectApproach)
+			se.inputJSONString("Airlines##"+id, (*arrivalAirlines)(&ar.Airlines))
+			if imgui.IsItemHovered() {
+				imgui.SetTooltip("<arrival airport>:<airline>/<departure airport>[/<fleet>] ...")
+			}
+			imgui.PopID()
+		}
+		if imgui.Button("Add arrival") {
+			sg.ArrivalGroups[group] = append(sg.ArrivalGroups[group], Arrival{})
+			se.edited(true)
+		}
+		imgui.PopID()
+	}
+
+	imgui.Separator()
+	imgui.InputTextV("##newarrivalgroup", &se.newArrivalGroup, imgui.InputTextFlagsCharsUppercase, nil)
+	imgui.SameLine()
+	if imgui.Button("Add arrival group") && se.newArrivalGroup != "" {
+		if _, ok := sg.ArrivalGroups[se.newArrivalGroup]; ok {
+			se.status = se.newArrivalGroup + ": arrival group already defined"
+		} else {
+			sg.ArrivalGroups[se.newArrivalGroup] = []Arrival{Arrival{}}
+			se.newArrivalGroup = ""
+			se.edited(true)
+		}
+	}
+}
+
+func (se *ScenarioEditorPane) drawScenariosUI() {
+	sg := se.sg
+	if imgui.BeginComboV("Scenario", se.scenario, 0) {
+		for _, name := range SortedMapKeys(sg.Scenarios) {
+			if imgui.SelectableV(name, name == se.scenario, 0, imgui.Vec2{}) {
+				se.scenario = name
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.InputTextV("##newscenario", &se.newScenario, 0, nil)
+	imgui.SameLine()
+	if imgui.Button("Add scenario") && se.newScenario != "" {
+		if _, ok := sg.Scenarios[se.newScenario]; ok {
+			se.status = se.newScenario + ": scenario already defined"
+		} else {
+			sg.Scenarios[se.newScenario] = &Scenario{Callsign: sg.DefaultController}
+			se.scenario = se.newScenario
+			se.newScenario = ""
+			se.edited(true)
+		}
+	}
+
+	sc, ok := sg.Scenarios[se.scenario]
+	if !ok {
+		return
+	}
+	imgui.SameLine()
+	if imgui.Button("Remove scenario") {
+		delete(sg.Scenarios, se.scenario)
+		se.scenario = ""
+		se.edited(true)
+		return
+	}
+
+	if imgui.BeginComboV("Controller", sc.Callsign, 0) {
+		for _, callsign := range SortedMapKeys(sg.ControlPositions) {
+			if imgui.SelectableV(callsign, callsign == sc.Callsign, 0, imgui.Vec2{}) {
+				sc.Callsign = callsign
+				se.edited(true)
+			}
+		}
+		imgui.EndCombo()
+	}
+	controllers := strings.Join(sc.Controllers, " ")
+	if imgui.InputTextV("Other controllers", &controllers, imgui.InputTextFlagsCharsUppercase, nil) {
+		sc.Controllers = strings.Fields(controllers)
+		se.edited(true)
+	}
+	se.edited(imgui.InputTextV("Default map", &sc.DefaultMap, 0, nil))
+	se.edited(imgui.InputIntV("Wind direction", &sc.Wind.Direction, 0, 0, 0))
+	se.edited(imgui.InputIntV("Wind speed", &sc.Wind.Speed, 0, 0, 0))
+	se.edited(imgui.InputIntV("Wind gust", &sc.Wind.Gust, 0, 0, 0))
+
+	imgui.Text("Departure runways")
+	flags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	if imgui.BeginTableV("departurerunways", 5, flags, imgui.Vec2{600, 0}, 0) {
+		imgui.TableSetupColumn("Airport")
+		imgui.TableSetupColumn("Runway")
+		imgui.TableSetupColumn("Category")
+		imgui.TableSetupColumn("Rate")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+		for i := 0; i < len(sc.DepartureRunways); i++ {
+			rwy := &sc.DepartureRunways[i]
+			imgui.PushID(fmt.Sprintf("dep%d", i))
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			se.inputText("##airport", &rwy.Airport)
+			imgui.TableNextColumn()
+			se.inputText("##runway", &rwy.Runway)
+			imgui.TableNextColumn()
+			se.edited(imgui.InputTextV("##category", &rwy.Category, 0, nil))
+			imgui.TableNextColumn()
+			se.edited(imgui.InputIntV("##rate", &rwy.DefaultRate, 0, 0, 0))
+			imgui.TableNextColumn()
+			if imgui.Button("Remove") {
+				sc.DepartureRunways = DeleteSliceElement(sc.DepartureRunways, i)
+				se.edited(true)
+				imgui.PopID()
+				break
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+	}
+	if imgui.Button("Add departure runway") {
+		sc.DepartureRunways = append(sc.DepartureRunways, ScenarioGroupDepartureRunway{Airport: sg.PrimaryAirport})
+		se.edited(true)
+	}
+
+	imgui.Text("Arrival runways")
+	if imgui.BeginTableV("arrivalrunways", 3, flags, imgui.Vec2{400, 0}, 0) {
+		imgui.TableSetupColumn("Airport")
+		imgui.TableSetupColumn("Runway")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+		for i := 0; i < len(sc.ArrivalRunways); i++ {
+			rwy := &sc.ArrivalRunways[i]
+			imgui.PushID(fmt.Sprintf("arr%d", i))
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			se.inputText("##airport", &rwy.Airport)
+			imgui.TableNextColumn()
+			se.inputText("##runway", &rwy.Runway)
+			imgui.TableNextColumn()
+			if imgui.Button("Remove") {
+				sc.ArrivalRunways = DeleteSliceElement(sc.ArrivalRunways, i)
+				se.edited(true)
+				imgui.PopID()
+				break
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+	}
+	if imgui.Button("Add arrival runway") {
+		sc.ArrivalRunways = append(sc.ArrivalRunways, ScenarioGroupArrivalRunway{Airport: sg.PrimaryAirport})
+		se.edited(true)
+	}
+
+	// Arrival rates: one for each airport that each arrival group's
+	// airlines fly to.
+	imgui.Text("Arrival rates (per hour)")
+	for _, group := range SortedMapKeys(sg.ArrivalGroups) {
+		airports := make(map[string]interface{})
+		for _, ar := range sg.ArrivalGroups[group] {
+			for ap := range ar.Airlines {
+				airports[ap] = nil
+			}
+		}
+		for _, ap := range SortedMapKeys(airports) {
+			var rate int32
+			if r, ok := sc.ArrivalGroupDefaultRates[group][ap]; ok && r != nil {
+				rate = *r
+			}
+			if imgui.InputIntV(group+" to "+ap, &rate, 0, 0, 0) {
+				if sc.ArrivalGroupDefaultRates == nil {
+					sc.ArrivalGroupDefaultRates = make(map[string]map[string]*int32)
+				}
+				if sc.ArrivalGroupDefaultRates[group] == nil {
+					sc.ArrivalGroupDefaultRates[group] = make(map[string]*int32)
+				}
+				if rate == 0 {
+					delete(sc.ArrivalGroupDefaultRates[group], ap)
+				} else {
+					sc.ArrivalGroupDefaultRates[group][ap] = &rate
+				}
+				se.edited(true)
+			}
+		}
+	}
+}
+
+// arrivalAirlines is used to edit an Arrival's airlines as a string of
+// the form "<arrival airport>:<airline>/<departure airport>[/<fleet>]"
+// for each one.
+type arrivalAirlines map[string][]ArrivalAirline
+
+func (a *arrivalAirlines) MarshalJSON() ([]byte, error) {
+	var entries []string
+	for _, ap := range SortedMapKeys(*a) {
+		for _, al := range (*a)[ap] {
+			s := ap + ":" + al.ICAO + "/" + al.Airport
+			if al.Fleet != "" {
+				s += "/" + al.Fleet
+			}
+			entries = append(entries, s)
+		}
+	}
+	return []byte(strconv.Quote(strings.Join(entries, " "))), nil
+}
+
+func (a *arrivalAirlines) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	m := make(map[string][]ArrivalAirline)
+	for _, entry := range strings.Fields(s) {
+		ap, airline, ok := strings.Cut(entry, ":")
+		f := strings.Split(airline, "/")
+		if !ok || ap == "" || len(f) < 2 || len(f) > 3 || f[0] == "" || f[1] == "" {
+			return fmt.Errorf("%s: expected <arrival airport>:<airline>/<departure airport>[/<fleet>]", entry)
+		}
+		al := ArrivalAirline{ICAO: f[0], Airport: f[1]}
+		if len(f) == 3 {
+			al.Fleet = strings.ToLower(f[2])
+		}
+		m[ap] = append(m[ap], al)
+	}
+	*a = m
+	return nil
+}
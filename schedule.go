@@ -0,0 +1,203 @@
+// schedule.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// When traffic follows the schedule, arrival and departure rates vary
+// with the time of day on a simulated clock that starts at an hour chosen
+// by the user. The rates set in the connection dialog are the peak
+// rates; they are scaled by per-hour factors that scenario groups may
+// provide for each airport (e.g., derived from historical schedules), or
+// by a generic daily profile if they don't.
+
+// TrafficSchedule describes how traffic at an airport varies over the
+// course of the day.
+type TrafficSchedule struct {
+	// Factors that scale the arrival and departure rates for each hour
+	// of the day, local time.
+	Arrivals   []float32 `json:"arrivals"`
+	Departures []float32 `json:"departures"`
+
+	// Start times ("HHMM", local) of arrival banks at hub airports.
+	// Arrival rates are doubled for BankMinutes following each one and
+	// reduced outside of them.
+	ArrivalBanks []string `json:"arrival_banks,omitempty"`
+	BankMinutes  int      `json:"bank_minutes,omitempty"`
+
+	// Airlines (ICAO codes) that operate mostly at night. If not
+	// specified, common cargo carriers are used.
+	NightAirlines []string `json:"night_airlines,omitempty"`
+
+	banks []int // minutes after midnight
+}
+
+// Generic daily profile: quiet overnight, busy from the morning through
+// the evening.
+var defaultHourlyTraffic = []float32{
+	0.15, 0.1, 0.1, 0.1, 0.15, 0.3, 0.6, 0.9, 1, 1, 0.9, 0.85,
+	0.85, 0.85, 0.9, 0.95, 1, 1, 1, 0.95, 0.8, 0.6, 0.4, 0.25,
+}
+
+var defaultNightAirlines = []string{"FDX", "UPS", "GTI", "ABX", "ATN", "CKS", "CLX", "BOX", "PAC"}
+
+func (ts *TrafficSchedule) PostDeserialize(e *ErrorLogger) {
+	if ts.Arrivals == nil {
+		ts.Arrivals = defaultHourlyTraffic
+	} else if len(ts.Arrivals) != 24 {
+		e.ErrorString("must provide 24 hourly \"arrivals\" factors; %d given", len(ts.Arrivals))
+	}
+	if ts.Departures == nil {
+		ts.Departures = defaultHourlyTraffic
+	} else if len(ts.Departures) != 24 {
+		e.ErrorString("must provide 24 hourly \"departures\" factors; %d given", len(ts.Departures))
+	}
+
+	if ts.BankMinutes == 0 {
+		ts.BankMinutes = 45
+	}
+	for _, b := range ts.ArrivalBanks {
+		if m, err := parseHHMM(b); err != nil {
+			e.ErrorString("%s: %v", b, err)
+		} else {
+			ts.banks = append(ts.banks, m)
+		}
+	}
+
+	if ts.NightAirlines == nil {
+		ts.NightAirlines = defaultNightAirlines
+	}
+}
+
+func parseHHMM(s string) (int, error) {
+	if len(s) != 4 {
+		return 0, fmt.Errorf("expected time in HHMM format")
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if v/100 > 23 || v%100 > 59 {
+		return 0, fmt.Errorf("invalid time")
+	}
+	return 60*(v/100) + v%100, nil
+}
+
+// ArrivalFactor returns the factor that the peak arrival rate should be
+// scaled by at the given local time.
+func (ts *TrafficSchedule) ArrivalFactor(t time.Time) float32 {
+	f := ts.Arrivals[t.Hour()]
+	if len(ts.banks) > 0 {
+		m := 60*t.Hour() + t.Minute()
+		inBank := false
+		for _, b := range ts.banks {
+			// Handle banks that span midnight.
+			if d := (m - b + 24*60) % (24 * 60); d < ts.BankMinutes {
+				inBank = true
+				break
+			}
+		}
+		if inBank {
+			f *= 2
+		} else {
+			f *= 0.4
+		}
+	}
+	return f
+}
+
+// DepartureFactor returns the factor that the peak departure rate should
+// be scaled by at the given local time.
+func (ts *TrafficSchedule) DepartureFactor(t time.Time) float32 {
+	return ts.Departures[t.Hour()]
+}
+
+// MaxFactor returns the largest factor that ArrivalFactor or
+// DepartureFactor may return.
+func (ts *TrafficSchedule) MaxFactor() float32 {
+	f := float32(0)
+	for i := 0; i < 24; i++ {
+		a := ts.Arrivals[i]
+		if len(ts.banks) > 0 {
+			a *= 2
+		}
+		f = max(f, max(a, ts.Departures[i]))
+	}
+	return f
+}
+
+// IsNight indicates whether the given local time is in the overnight
+// hours, when cargo operators dominate.
+func IsNight(t time.Time) bool {
+	return t.Hour() >= 22 || t.Hour() < 6
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Sim integration
+
+var genericTrafficSchedule *TrafficSchedule
+
+func init() {
+	genericTrafficSchedule = &TrafficSchedule{}
+	genericTrafficSchedule.PostDeserialize(&ErrorLogger{})
+}
+
+// trafficSchedule returns the schedule to use for the given airport.
+func trafficSchedule(airport string) *TrafficSchedule {
+	if ap, ok := scenarioGroup.Airports[airport]; ok && ap.Schedule != nil {
+		return ap.Schedule
+	}
+	return genericTrafficSchedule
+}
+
+// LocalTime returns the time of day on the simulated clock used for
+// scheduled traffic.
+func (sim *Sim) LocalTime() time.Time {
+	start := time.Date(2000, 1, 1, sim.ScheduleStartHour, 0, 0, 0, time.UTC)
+	return start.Add(sim.CurrentTime().Sub(sim.scheduleStart))
+}
+
+// scheduleMaxFactor returns an upper bound on the rate factor for all of
+// the scenario's airports.
+func (sim *Sim) scheduleMaxFactor() float32 {
+	f := float32(1)
+	for _, ap := range sim.Scenario.AllAirports() {
+		f = max(f, trafficSchedule(ap).MaxFactor())
+	}
+	return f
+}
+
+// acceptScheduledSpawn is used to thin the spawns generated at the peak
+// rate scaled by scheduleMaxFactor so that the effective rate follows the
+// airport's schedule. It always returns true if traffic isn't scheduled.
+func (sim *Sim) acceptScheduledSpawn(airport string, arrival bool) bool {
+	if !sim.ScheduledTraffic {
+		return true
+	}
+	ts, t := trafficSchedule(airport), sim.LocalTime()
+	f := ts.DepartureFactor(t)
+	if arrival {
+		f = ts.ArrivalFactor(t)
+	}
+	return rand.Float32() < f/sim.scheduleMaxFactor()
+}
+
+// sampleScheduledAirline returns the index of an airline to use for a new
+// flight at the given airport, given the ICAO codes of the candidates.
+// At night, when traffic is scheduled, airlines that operate at night are
+// strongly favored.
+func (sim *Sim) sampleScheduledAirline(airport string, icao []string) int {
+	if sim.ScheduledTraffic && IsNight(sim.LocalTime()) && rand.Float32() < 0.8 {
+		night := trafficSchedule(airport).NightAirlines
+		if idx := SampleFiltered(icao, func(s string) bool { return Find(night, s) != -1 }); idx != -1 {
+			return idx
+		}
+	}
+	return rand.Intn(len(icao))
+}
@@ -0,0 +1,453 @@
+// scoring.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Over the course of a session, the Sim keeps track of measurable errors
+// that the user makes: losses of separation involving aircraft they are
+// tracking, aircraft that leave the scenario's airspace without having
+// been handed off or without being tracked at all, go-arounds caused by
+// poor spacing on final, wake turbulence separation violations behind
+// Heavy and Super aircraft, incorrect pilot readbacks that go uncorrected,
+// altitude assignments below the MVA or MEA, handoffs that don't meet the
+// LOA's transfer point requirements, and pilots who check in and then
+// don't hear anything from the controller. Each error costs a fixed number
+// of points from a starting score of 100. When the user disconnects, a
+// debrief dialog box shows the score and its breakdown; each session's
+// results are also saved to a history file in the user's config directory
+// so that progress can be followed over time.
+
+type ScoreCategory int
+
+const (
+	ScoreSeparationLoss ScoreCategory = iota
+	ScoreLateHandoff
+	ScoreUntrackedExit
+	ScoreSpacingGoAround
+	ScoreUnansweredCheckIn
+	ScoreWakeViolation
+	ScoreUncorrectedReadback
+	ScoreMinimumAltitude
+	ScoreLOAViolation
+	ScoreCategoryCount
+)
+
+func (c ScoreCategory) String() string {
+	return [...]string{"Separation losses", "Late handoffs", "Untracked airspace exits",
+		"Go-arounds due to spacing", "Unanswered check-ins", "Wake turbulence violations",
+		"Uncorrected readback errors", "Altitudes below MVA/MEA",
+		"LOA violations on handoffs"}[c]
+}
+
+// Points deducted for each error in each category.
+var scoreDeductions = [ScoreCategoryCount]int{10, 3, 5, 5, 2, 5, 3, 5, 3}
+
+const (
+	// Pilots check in when the user accepts a handoff; if the user
+	// doesn't issue any instructions for this long afterward, the
+	// check-in counts as unanswered.
+	checkInResponseTime = time.Minute
+	// A go-around is charged to the user if the preceding arrival to the
+	// same airport is closer than this many nm.
+	goAroundSpacing = 2.5
+	// Maximum number of sessions kept in the score history.
+	scoreHistoryMaxSessions = 500
+)
+
+type ScoredError struct {
+	Category    ScoreCategory
+	Time        time.Time
+	Callsign    string
+	Description string
+}
+
+type SessionScore struct {
+	ScenarioGroup string
+	Scenario      string
+	Start, End    time.Time
+	// Number of aircraft that the user tracked during the session.
+	Aircraft int
+	Errors   []ScoredError
+	// Number of commands that the user issued and how many of them
+	// failed (e.g., due to typos).
+	Commands      int
+	CommandErrors int
+	// Changes to the traffic level, if adaptive traffic was enabled; see
+	// adaptive.go.
+	Adaptation []TrafficAdaptation `json:",omitempty"`
+	// The challenge the session was run as, if any, and whether the user
+	// passed it; see challenge.go.
+	Challenge       string `json:",omitempty"`
+	ChallengePassed bool   `json:",omitempty"`
+}
+
+// Count returns the number of errors in the given category.
+func (s *SessionScore) Count(c ScoreCategory) int {
+	n := 0
+	for _, e := range s.Errors {
+		if e.Category == c {
+			n++
+		}
+	}
+	return n
+}
+
+// Score returns the session's score, from 0 to 100.
+func (s *SessionScore) Score() int {
+	score := 100
+	for _, e := range s.Errors {
+		score -= scoreDeductions[e.Category]
+	}
+	return max(0, score)
+}
+
+// sessionScorer holds the Sim's state for scoring the session.
+type sessionScorer struct {
+	score SessionScore
+
+	// Aircraft that the user has tracked at some point.
+	tracked map[string]interface{}
+	// callsign -> when the pilot checked in, for aircraft that the user
+	// hasn't issued instructions to since.
+	checkIns map[string]time.Time
+	// Aircraft that have been inside the scenario's airspace and ones
+	// that have since left it.
+	entered map[string]interface{}
+	exited  map[string]interface{}
+}
+
+func newSessionScorer(s *Scenario, start time.Time) *sessionScorer {
+	return &sessionScorer{
+		score: SessionScore{
+			ScenarioGroup: scenarioGroup.Name,
+			Scenario:      s.Name(),
+			Start:         start,
+		},
+		tracked:  make(map[string]interface{}),
+		checkIns: make(map[string]time.Time),
+		entered:  make(map[string]interface{}),
+		exited:   make(map[string]interface{}),
+	}
+}
+
+func (sim *Sim) addScoredError(c ScoreCategory, ac *Aircraft, format string, args ...interface{}) {
+	e := ScoredError{
+		Category:    c,
+		Time:        sim.CurrentTime(),
+		Callsign:    ac.Callsign,
+		Description: fmt.Sprintf(format, args...),
+	}
+	lg.Printf("%s: scored error: %s", ac.Callsign, e.Description)
+	sim.scorer.score.Errors = append(sim.scorer.score.Errors, e)
+}
+
+// scoreConflict records a loss of separation if the user is tracking
+// either of the aircraft.
+func (sim *Sim) scoreConflict(ac0, ac1 *Aircraft) {
+	if sim.scorer == nil || (ac0.TrackingController != sim.Scenario.Callsign &&
+		ac1.TrackingController != sim.Scenario.Callsign) {
+		return
+	}
+	sim.addScoredError(ScoreSeparationLoss, ac0, "%s/%s: %.1fnm, %d'", ac0.Callsign, ac1.Callsign,
+		nmdistance2ll(ac0.Position, ac1.Position), int(abs(ac0.Altitude-ac1.Altitude)))
+}
+
+// scoreGoAround records a go-around if the aircraft was too close to
+// the preceding arrival to the same airport.
+func (sim *Sim) scoreGoAround(ac *Aircraft) {
+	if sim.scorer == nil || ac.FlightPlan == nil || ac.Approach == nil || len(ac.Waypoints) == 0 {
+		return
+	}
+
+	threshold := ac.Waypoints[len(ac.Waypoints)-1].Location
+	dist := nmdistance2ll(ac.Position, threshold)
+	for _, other := range sim.Aircraft {
+		if other == ac || other.FlightPlan == nil ||
+			other.FlightPlan.ArrivalAirport != ac.FlightPlan.ArrivalAirport || other.Approach != ac.Approach {
+			continue
+		}
+		// The other aircraft is ahead if it's closer to the threshold or
+		// has landed and is still on the runway.
+		ahead := nmdistance2ll(other.Position, threshold) < dist || other.OnRunway()
+		if s := nmdistance2ll(ac.Position, other.Position); ahead && s < goAroundSpacing {
+			sim.addScoredError(ScoreSpacingGoAround, ac, "%s went around %.1fnm behind %s", ac.Callsign,
+				s, other.Callsign)
+			return
+		}
+	}
+}
+
+// scoreWakeViolation records a loss of wake turbulence separation behind
+// a Heavy or Super if the user has worked the trailing aircraft.
+func (sim *Sim) scoreWakeViolation(ac, lead *Aircraft, dist, required float32) {
+	if sim.scorer == nil || lead.Performance.WakeCategory() < WakeHeavy {
+		return
+	}
+	if _, ok := sim.scorer.tracked[ac.Callsign]; !ok {
+		return
+	}
+	sim.addScoredError(ScoreWakeViolation, ac, "%s: %.1fnm behind %s %s, %.0fnm required", ac.Callsign,
+		dist, lead.Performance.WakeCategory(), lead.Callsign, required)
+}
+
+// scoreCheckIn has the pilot check in after the user accepts a handoff
+// and starts waiting for the user to respond.
+func (sim *Sim) scoreCheckIn(ac *Aircraft) {
+	pilotReadback(ac.Callsign, "check_in", ReadbackData{Altitude: 100 * int((ac.Altitude+50)/100)})
+	if sim.scorer != nil {
+		sim.scorer.checkIns[ac.Callsign] = sim.CurrentTime()
+	}
+}
+
+// scoreInstructions records that the user has issued instructions to the
+// aircraft.
+func (sim *Sim) scoreInstructions(callsign string) {
+	if sim.scorer == nil {
+		return
+	}
+	if t, ok := sim.scorer.checkIns[callsign]; ok {
+		sim.adaptiveResponse(sim.CurrentTime().Sub(t))
+		delete(sim.scorer.checkIns, callsign)
+	}
+}
+
+// scoreCommands records the outcome of a set of commands issued by the
+// user.
+func (sim *Sim) scoreCommands(cmds string, remaining []string, err error) {
+	if sim.scorer == nil {
+		return
+	}
+	n := len(strings.Fields(strings.TrimPrefix(cmds, "!")))
+	sim.scorer.score.Commands += n - len(remaining)
+	if err != nil {
+		// The first of the remaining commands is the one that failed.
+		sim.scorer.score.Commands++
+		sim.scorer.score.CommandErrors++
+	}
+}
+
+// updateScore checks for unanswered check-ins and for aircraft that have
+// left the airspace; it should be called once a second.
+func (sim *Sim) updateScore() {
+	sc := sim.scorer
+	if sc == nil {
+		return
+	}
+	now := sim.CurrentTime()
+	user := sim.Scenario.Callsign
+
+	for _, callsign := range SortedMapKeys(sc.checkIns) {
+		ac, ok := sim.Aircraft[callsign]
+		if !ok || ac.TrackingController != user {
+			delete(sc.checkIns, callsign)
+		} else if now.Sub(sc.checkIns[callsign]) > checkInResponseTime {
+			sim.addScoredError(ScoreUnansweredCheckIn, ac, "%s checked in and didn't hear back", callsign)
+			delete(sc.checkIns, callsign)
+		}
+	}
+
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if ac.LiveADSB || ac.FlightPlan == nil {
+			continue
+		}
+		if ac.TrackingController == user {
+			sc.tracked[callsign] = nil
+		}
+
+		departure := Find(sim.Scenario.DepartureAirports(), ac.FlightPlan.DepartureAirport) != -1
+		volumes := sim.Scenario.ApproachAirspace
+		if departure {
+			volumes = sim.Scenario.DepartureAirspace
+		}
+		if len(volumes) == 0 {
+			continue
+		}
+
+		if in, _ := InAirspace(ac.Position, ac.Altitude, volumes); in {
+			sc.entered[callsign] = nil
+			continue
+		}
+		if _, ok := sc.entered[callsign]; !ok {
+			continue
+		}
+		if _, ok := sc.exited[callsign]; ok {
+			continue
+		}
+		sc.exited[callsign] = nil
+
+		// Arrivals leave the approach airspace as they land.
+		if ac.OnFinal || ac.ClearedApproach || ac.OnRunway() {
+			continue
+		}
+		// VFR aircraft may leave untracked once radar services have been
+		// terminated.
+		_, tracked := sc.tracked[callsign]
+		if ac.TrackingController == user && ac.OutboundHandoffController == "" {
+			sim.addScoredError(ScoreLateHandoff, ac, "%s left the airspace without a handoff", callsign)
+		} else if ac.TrackingController == "" && (tracked || departure) && ac.FlightPlan.Rules != VFR {
+			sim.addScoredError(ScoreUntrackedExit, ac, "%s left the airspace untracked", callsign)
+		}
+	}
+}
+
+// finishScore saves the session's score and shows the debrief, if the
+// user worked any traffic.
+func (sim *Sim) finishScore() {
+	sc := sim.scorer
+	sim.scorer = nil
+	if sc == nil || (len(sc.tracked) == 0 && len(sc.score.Errors) == 0) {
+		return
+	}
+
+	sc.score.End = sim.CurrentTime()
+	sc.score.Aircraft = len(sc.tracked)
+	h := LoadScoreHistory()
+	saveScoreHistory(append(h, sc.score))
+	if profileWindow.show {
+		profileWindow.history = LoadScoreHistory()
+	}
+	if sim.Exam != nil {
+		// The grading sheet takes the place of the debrief.
+		g := GradeExam(sc.score, sim.Exam.Actions)
+		saveExam(g)
+		uiShowModalDialog(NewModalDialogBox(&ExamModalClient{sheet: g}), false)
+	} else {
+		uiShowModalDialog(NewModalDialogBox(&DebriefModalClient{score: sc.score, history: h}), false)
+	}
+}
+
+func scoreHistoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		lg.Errorf("Unable to find user config dir: %v", err)
+		dir = "."
+	}
+	return path.Join(dir, "Vice", "scores.json")
+}
+
+// LoadScoreHistory returns the scores from prior sessions, oldest first.
+func LoadScoreHistory() []SessionScore {
+	var h []SessionScore
+	b, err := os.ReadFile(scoreHistoryPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lg.Errorf("%s: %v", scoreHistoryPath(), err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		lg.Errorf("%s: %v", scoreHistoryPath(), err)
+	}
+	return h
+}
+
+func saveScoreHistory(h []SessionScore) {
+	if n := len(h); n > scoreHistoryMaxSessions {
+		h = h[n-scoreHistoryMaxSessions:]
+	}
+
+	fn := scoreHistoryPath()
+	if err := os.MkdirAll(path.Dir(fn), 0o700); err != nil {
+		lg.Errorf("%s: %v", path.Dir(fn), err)
+		return
+	}
+	b, err := json.Marshal(h)
+	if err == nil {
+		err = os.WriteFile(fn, b, 0o600)
+	}
+	if err != nil {
+		lg.Errorf("%s: %v", fn, err)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// DebriefModalClient
+
+// DebriefModalClient shows the score for a session along with the errors
+// that were made and the scores from recent sessions in the same
+// scenario group.
+type DebriefModalClient struct {
+	score   SessionScore
+	history []SessionScore
+}
+
+func (d *DebriefModalClient) Title() string { return "Session Debrief" }
+
+func (d *DebriefModalClient) Opening() {}
+
+func (d *DebriefModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{{text: "Ok"}}
+}
+
+func (d *DebriefModalClient) Draw() int {
+	s := &d.score
+	imgui.Text(fmt.Sprintf("%s: %s", s.ScenarioGroup, s.Scenario))
+	imgui.Text(fmt.Sprintf("%s, %d aircraft worked", s.End.Sub(s.Start).Round(time.Minute), s.Aircraft))
+	imgui.Text(fmt.Sprintf("Score: %d", s.Score()))
+	imgui.Separator()
+
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsRowBg
+	if imgui.BeginTableV("categories", 3, tableFlags, imgui.Vec2{500, 0}, 0) {
+		imgui.TableSetupColumn("Category")
+		imgui.TableSetupColumn("Count")
+		imgui.TableSetupColumn("Points")
+		imgui.TableHeadersRow()
+		for c := ScoreCategory(0); c < ScoreCategoryCount; c++ {
+			n := s.Count(c)
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(c.String())
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%d", n))
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%d", -n*scoreDeductions[c]))
+		}
+		imgui.EndTable()
+	}
+
+	if len(s.Errors) > 0 {
+		imgui.Separator()
+		imgui.BeginChildV("errors", imgui.Vec2{500, 150}, true, 0)
+		for _, e := range s.Errors {
+			imgui.Text(e.Time.Format("15:04:05") + " " + e.Description)
+		}
+		imgui.EndChild()
+	}
+
+	if len(s.Adaptation) > 0 {
+		imgui.Separator()
+		var scales []float32
+		for _, a := range s.Adaptation {
+			scales = append(scales, a.Scale)
+		}
+		last := s.Adaptation[len(s.Adaptation)-1]
+		imgui.Text(fmt.Sprintf("Adaptive traffic: %.0f%% of the scenario's rates at the end", 100*last.Scale))
+		imgui.PlotLinesV("Traffic level", scales, 0, "", adaptiveMinScale, adaptiveMaxScale, imgui.Vec2{500, 60})
+	}
+
+	var recent []string
+	for i := len(d.history) - 1; i >= 0 && len(recent) < 5; i-- {
+		if h := d.history[i]; h.ScenarioGroup == s.ScenarioGroup {
+			recent = append(recent, fmt.Sprintf("%d", h.Score()))
+		}
+	}
+	if len(recent) > 0 {
+		imgui.Separator()
+		imgui.Text("Recent scores in " + s.ScenarioGroup + ": " + strings.Join(recent, ", "))
+	}
+
+	return -1
+}
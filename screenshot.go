@@ -0,0 +1,215 @@
+// screenshot.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path"
+	"time"
+)
+
+// Screenshots capture just the radar pane at full framebuffer resolution.
+// Before the capture, the user may enter annotation mode to draw arrows
+// and text over the pane; these are drawn as an overlay by the window
+// manager and so are included in the captured image. Optionally, a
+// timestamp and scale bar are burned in to the capture as well.
+
+var screenshot struct {
+	// Set when a capture has been requested; the pane is captured at the
+	// end of the next call to wmDrawPanes.
+	pending bool
+
+	burnIn      bool
+	annotating  bool
+	tool        ScreenshotTool
+	annotations []ScreenshotAnnotation
+	// Set if the most recent annotation is text that is being edited.
+	editing bool
+}
+
+type ScreenshotTool int
+
+const (
+	ScreenshotToolArrow ScreenshotTool = iota
+	ScreenshotToolText
+)
+
+// ScreenshotAnnotation is either an arrow from P0 to P1 or a text label at
+// P0; positions are in the pane's window coordinates.
+type ScreenshotAnnotation struct {
+	P0, P1 [2]float32
+	Text   string
+	arrow  bool
+}
+
+// ScaledPane is implemented by Panes that draw a map so that captures can
+// include a scale bar.
+type ScaledPane interface {
+	NMPerPixel(ctx *PaneContext) float32
+}
+
+var ScreenshotAnnotationColor = RGB{1, .8, 0}
+
+// screenshotPane returns the pane that screenshots capture: the first
+// STARS scope in the display hierarchy.
+func screenshotPane() Pane {
+	var pane Pane
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		if _, ok := p.(*STARSPane); ok && pane == nil {
+			pane = p
+		}
+	})
+	return pane
+}
+
+func screenshotToggleAnnotating() {
+	screenshot.annotating = !screenshot.annotating
+	screenshot.editing = false
+}
+
+// screenshotHandleInput processes mouse and keyboard input for annotation
+// mode; it consumes the events so that the pane itself doesn't see them.
+func screenshotHandleInput(ctx *PaneContext) {
+	if !screenshot.annotating {
+		return
+	}
+
+	if kb := ctx.keyboard; kb != nil {
+		if n := len(screenshot.annotations); screenshot.editing && n > 0 {
+			a := &screenshot.annotations[n-1]
+			a.Text += kb.Input
+			if kb.IsPressed(KeyBackspace) && len(a.Text) > 0 {
+				a.Text = a.Text[:len(a.Text)-1]
+			}
+			if kb.IsPressed(KeyEnter) || kb.IsPressed(KeyEscape) {
+				if a.Text == "" {
+					screenshot.annotations = screenshot.annotations[:n-1]
+				}
+				screenshot.editing = false
+			}
+		} else if kb.IsPressed(KeyEscape) {
+			screenshot.annotating = false
+		}
+		ctx.keyboard = nil
+	}
+
+	if m := ctx.mouse; m != nil {
+		n := len(screenshot.annotations)
+		if m.Clicked[MouseButtonPrimary] {
+			if screenshot.editing && screenshot.annotations[n-1].Text == "" {
+				screenshot.annotations = screenshot.annotations[:n-1]
+			}
+			a := ScreenshotAnnotation{P0: m.Pos, P1: m.Pos, arrow: screenshot.tool == ScreenshotToolArrow}
+			screenshot.annotations = append(screenshot.annotations, a)
+			screenshot.editing = !a.arrow
+		} else if m.Dragging[MouseButtonPrimary] && n > 0 && screenshot.annotations[n-1].arrow {
+			screenshot.annotations[n-1].P1 = m.Pos
+		} else if m.Released[MouseButtonPrimary] && n > 0 && screenshot.annotations[n-1].arrow {
+			// Discard arrows that were just a click.
+			if a := screenshot.annotations[n-1]; distance2f(a.P0, a.P1) < 5 {
+				screenshot.annotations = screenshot.annotations[:n-1]
+			}
+		} else if m.Clicked[MouseButtonSecondary] && n > 0 {
+			// Secondary click removes the most recent annotation.
+			screenshot.annotations = screenshot.annotations[:n-1]
+			screenshot.editing = false
+		}
+		ctx.mouse = nil
+	}
+}
+
+// screenshotDrawOverlay draws the annotations and, if a capture is about
+// to happen, the burn-in, over the given pane.
+func screenshotDrawOverlay(pane Pane, ctx *PaneContext, cb *CommandBuffer) {
+	if !screenshot.annotating && len(screenshot.annotations) == 0 && !(screenshot.pending && screenshot.burnIn) {
+		return
+	}
+
+	ctx.SetWindowCoordinateMatrices(cb)
+	font := GetDefaultFont()
+	ld := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(ld)
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	style := TextStyle{Font: font, Color: ScreenshotAnnotationColor}
+
+	for i, a := range screenshot.annotations {
+		if a.arrow {
+			ld.AddLine(a.P0, a.P1)
+			// Arrowhead at P1
+			v := normalize2f(sub2f(a.P0, a.P1))
+			perp := [2]float32{-v[1], v[0]}
+			ld.AddLine(a.P1, add2f(a.P1, add2f(scale2f(v, 12), scale2f(perp, 6))))
+			ld.AddLine(a.P1, add2f(a.P1, sub2f(scale2f(v, 12), scale2f(perp, 6))))
+		} else {
+			text := a.Text
+			if i == len(screenshot.annotations)-1 && screenshot.editing {
+				text += "_"
+			}
+			td.AddText(text, a.P0, style)
+		}
+	}
+
+	if screenshot.annotating && !screenshot.pending {
+		td.AddText("ANNOTATE", [2]float32{10, 10 + float32(font.size)}, style)
+	}
+
+	if screenshot.pending && screenshot.burnIn {
+		width := ctx.paneExtent.Width()
+		burnStyle := TextStyle{Font: font, Color: UITextColor, DrawBackground: true, BackgroundColor: RGB{}}
+		td.AddText(sim.CurrentTime().UTC().Format("2006-01-02 15:04:05Z"), [2]float32{10, 2*float32(font.size) + 10}, burnStyle)
+
+		if sp, ok := pane.(ScaledPane); ok {
+			if nmPerPixel := sp.NMPerPixel(ctx); nmPerPixel > 0 {
+				// Pick a round length that's about 1/5 of the pane width.
+				nm := float32(1)
+				for _, l := range []float32{1, 2, 5, 10, 20, 50, 100} {
+					if l/nmPerPixel < width/5 {
+						nm = l
+					}
+				}
+				px := nm / nmPerPixel
+				x1, y := width-10, float32(20)
+				ld.AddLine([2]float32{x1 - px, y}, [2]float32{x1, y})
+				ld.AddLine([2]float32{x1 - px, y - 5}, [2]float32{x1 - px, y + 5})
+				ld.AddLine([2]float32{x1, y - 5}, [2]float32{x1, y + 5})
+				td.AddText(fmt.Sprintf("%d NM", int(nm)), [2]float32{x1 - px, y + 5 + float32(font.size)}, burnStyle)
+			}
+		}
+	}
+
+	cb.SetRGB(ScreenshotAnnotationColor)
+	cb.LineWidth(2)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
+
+// screenshotSave writes the captured image to a PNG file in the export
+// directory.
+func screenshotSave(img image.Image) {
+	dir := globalConfig.ExportDirectory
+	if dir == "" {
+		dir = defaultDirectory("")
+	}
+	filename := path.Join(dir, "vice-"+time.Now().Format("20060102-150405")+".png")
+
+	f, err := os.Create(filename)
+	if err == nil {
+		err = png.Encode(f, img)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if err != nil {
+		lg.Errorf("%s: %v", filename, err)
+		uiShowModalDialog(NewModalDialogBox(&ErrorModalClient{message: err.Error()}), false)
+	} else {
+		lg.Printf("%s: saved screenshot", filename)
+	}
+}
@@ -0,0 +1,67 @@
+// sharedfinal.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+)
+
+// When several airports feed a common final controller, approaches at
+// different airports may share a final--e.g., to a satellite airport
+// whose runway lies beneath the primary airport's final. Scenarios list
+// the approaches that share each final; aircraft on them are then
+// sequenced together: wake turbulence separation applies between them,
+// conflict alerts aren't suppressed as they are for aircraft on different
+// approaches, and the STARS approach ghosts include them.
+
+type SharedFinal struct {
+	// Approaches are given as the airport followed by the name of the
+	// approach in its "approaches", e.g. "KJFK I4R".
+	Approaches []string `json:"approaches"`
+
+	// Airport and full name of each of the approaches.
+	approaches [][2]string
+}
+
+func (s *SharedFinal) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if len(s.Approaches) < 2 {
+		e.ErrorString("at least two \"approaches\" must be given")
+	}
+	for _, a := range s.Approaches {
+		f := strings.Fields(a)
+		if len(f) != 2 {
+			e.ErrorString("\"%s\": expected airport and approach", a)
+		} else if ap, ok := sg.Airports[f[0]]; !ok {
+			e.ErrorString("airport \"%s\" not found", f[0])
+		} else if appr, ok := ap.Approaches[f[1]]; !ok {
+			e.ErrorString("approach \"%s\" not found at %s", f[1], f[0])
+		} else {
+			s.approaches = append(s.approaches, [2]string{f[0], appr.FullName})
+		}
+	}
+}
+
+// Includes returns true if the aircraft is flying one of the shared
+// final's approaches.
+func (s *SharedFinal) Includes(ac *Aircraft) bool {
+	if ac.Approach == nil || ac.FlightPlan == nil {
+		return false
+	}
+	return Find(s.approaches, [2]string{ac.FlightPlan.ArrivalAirport, ac.Approach.FullName}) != -1
+}
+
+// onSharedFinal returns true if the two aircraft are flying approaches
+// that share a final.
+func (sim *Sim) onSharedFinal(ac0, ac1 *Aircraft) bool {
+	if sim == nil || sim.Scenario == nil {
+		return false
+	}
+	for i := range sim.Scenario.SharedFinals {
+		if sf := &sim.Scenario.SharedFinals[i]; sf.Includes(ac0) && sf.Includes(ac1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+// sigmet.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Scenarios may define SIGMETs and AIRMETs: areas of hazardous weather
+// that are drawn on the scope. Convective SIGMETs may move over the
+// course of the session; aircraft won't fly through them, so those worked
+// by the user whose route takes them through one ask to deviate around it
+// (see wxdeviation.go) and those given a direct or a heading that would
+// do so refuse it. Aircraft worked by virtual controllers are given the
+// deviation without asking and proceed direct once they're clear, so
+// they may show up off of their routes.
+
+type SIGMET struct {
+	Id   string `json:"id"`
+	Type string `json:"type"` // "convective", "turbulence", "icing", or "ifr"
+
+	VertexStrings []string   `json:"vertices"`
+	Vertices      []Point2LL `json:"-"` // closed: the first vertex is repeated at the end
+
+	Floor int `json:"floor,omitempty"`
+	Tops  int `json:"tops"`
+
+	// Minutes after the start of the session when the SIGMET is issued
+	// and when it expires; it lasts the entire session if End is zero.
+	Start int `json:"start,omitempty"`
+	End   int `json:"end,omitempty"`
+
+	// Optional movement of the area, true heading and knots.
+	MovementDirection float32 `json:"movement_direction,omitempty"`
+	MovementSpeed     float32 `json:"movement_speed,omitempty"`
+}
+
+func (s *SIGMET) PostDeserialize(sg *ScenarioGroup, e *ErrorLogger) {
+	if s.Id == "" {
+		e.ErrorString("must specify \"id\"")
+	}
+	switch s.Type {
+	case "convective", "turbulence", "icing", "ifr":
+	default:
+		e.ErrorString("\"type\" must be \"convective\", \"turbulence\", \"icing\", or \"ifr\"")
+	}
+
+	if len(s.VertexStrings) < 3 {
+		e.ErrorString("must provide at least three \"vertices\"")
+	}
+	for _, v := range s.VertexStrings {
+		if p, ok := sg.Locate(v); !ok {
+			e.ErrorString("unknown location \"%s\" in \"vertices\"", v)
+		} else {
+			s.Vertices = append(s.Vertices, p)
+		}
+	}
+	if len(s.Vertices) > 0 && s.Vertices[0] != s.Vertices[len(s.Vertices)-1] {
+		s.Vertices = append(s.Vertices, s.Vertices[0])
+	}
+
+	if s.Tops <= s.Floor {
+		e.ErrorString("\"tops\" %d must be greater than \"floor\" %d", s.Tops, s.Floor)
+	}
+	if s.End != 0 && s.End <= s.Start {
+		e.ErrorString("\"end\" must be after \"start\"")
+	}
+	if s.MovementSpeed < 0 {
+		e.ErrorString("\"movement_speed\" must not be negative")
+	}
+}
+
+// Label returns the name of the advisory and its id, e.g., "CONV SIGMET 12C".
+func (s *SIGMET) Label() string {
+	switch s.Type {
+	case "convective":
+		return "CONV SIGMET " + s.Id
+	case "turbulence":
+		return "AIRMET TANGO " + s.Id
+	case "icing":
+		return "AIRMET ZULU " + s.Id
+	default:
+		return "AIRMET SIERRA " + s.Id
+	}
+}
+
+// Active returns true if the SIGMET is in effect at the given time.
+func (s *SIGMET) Active(start, now time.Time) bool {
+	m := int(now.Sub(start).Minutes())
+	return m >= s.Start && (s.End == 0 || m < s.End)
+}
+
+// Area returns the SIGMET's polygon at the given time, accounting for its
+// movement since it was issued.
+func (s *SIGMET) Area(start, now time.Time) []Point2LL {
+	if s.MovementSpeed == 0 {
+		return s.Vertices
+	}
+
+	hours := float32(now.Sub(start).Hours()) - float32(s.Start)/60
+	d := s.MovementSpeed * max(0, hours)
+	theta := float64(radians(s.MovementDirection))
+	v := nm2ll([2]float32{d * float32(math.Sin(theta)), d * float32(math.Cos(theta))})
+	return MapSlice(s.Vertices, func(p Point2LL) Point2LL { return add2ll(p, v) })
+}
+
+// pathCrossesArea returns true if the straight line from p0 to p1 passes
+// through the given polygon; this is approximate, as the line is only
+// checked at sampled points.
+func pathCrossesArea(p0, p1 Point2LL, area []Point2LL) bool {
+	n := 1 + int(nmdistance2ll(p0, p1))
+	for i := 0; i <= n; i++ {
+		if PointInPolygon(lerp2ll(float32(i)/float32(n), p0, p1), area) {
+			return true
+		}
+	}
+	return false
+}
+
+// areaCenter returns the average of the vertices of the given closed
+// polygon.
+func areaCenter(area []Point2LL) Point2LL {
+	var c [2]float32
+	n := len(area) - 1 // the first vertex is repeated at the end
+	for _, p := range area[:n] {
+		c = add2f(c, ll2nm(p))
+	}
+	return nm2ll(scale2f(c, 1/float32(n)))
+}
+
+// ActiveSIGMETs returns the SIGMETs in effect at the current time.
+func (sim *Sim) ActiveSIGMETs() []*SIGMET {
+	if sim.Scenario == nil {
+		return nil
+	}
+	var s []*SIGMET
+	for i := range sim.Scenario.SIGMETs {
+		if sig := &sim.Scenario.SIGMETs[i]; sig.Active(sim.scheduleStart, sim.CurrentTime()) {
+			s = append(s, sig)
+		}
+	}
+	return s
+}
+
+// convectionOnPath returns the first active convective SIGMET that the
+// given path would take an aircraft at the given altitude through, or nil
+// if there is none.
+func (sim *Sim) convectionOnPath(alt float32, path []Point2LL) *SIGMET {
+	now := sim.CurrentTime()
+	for _, sig := range sim.ActiveSIGMETs() {
+		if sig.Type != "convective" || int(alt) < sig.Floor || int(alt) > sig.Tops {
+			continue
+		}
+		area := sig.Area(sim.scheduleStart, now)
+		for i := 0; i+1 < len(path); i++ {
+			if pathCrossesArea(path[i], path[i+1], area) {
+				return sig
+			}
+		}
+	}
+	return nil
+}
+
+// How far ahead along their route aircraft look for convective SIGMETs.
+const sigmetLookaheadNM = 60
+
+// upcomingRoute returns the aircraft's position and the locations of its
+// waypoints up to sigmetLookaheadNM along its route.
+func upcomingRoute(ac *Aircraft) []Point2LL {
+	route := []Point2LL{ac.Position}
+	dist := float32(0)
+	for _, wp := range ac.Waypoints {
+		if wp.Location.IsZero() {
+			continue
+		}
+		dist += nmdistance2ll(route[len(route)-1], wp.Location)
+		route = append(route, wp.Location)
+		if dist > sigmetLookaheadNM {
+			break
+		}
+	}
+	return route
+}
+
+// updateSIGMETs has aircraft worked by human controllers that are routed
+// through an active convective SIGMET ask to deviate around it; those
+// worked by virtual controllers just deviate. Each aircraft only deviates
+// once for each SIGMET.
+func (sim *Sim) updateSIGMETs(now time.Time) {
+	if len(sim.Scenario.SIGMETs) == 0 {
+		return
+	}
+	if sim.sigmetReroutes == nil {
+		sim.sigmetReroutes = make(map[string]map[string]interface{})
+	}
+
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if ac.LiveADSB || ac.OnFinal || ac.ClearedApproach || ac.OnRunway() || ac.DeviatingForWeather {
+			continue
+		}
+		route := upcomingRoute(ac)
+		if len(route) < 2 {
+			continue
+		}
+
+		sig := sim.convectionOnPath(ac.Altitude, route)
+		if sig == nil {
+			continue
+		}
+		if _, ok := sim.sigmetReroutes[callsign][sig.Id]; ok {
+			continue
+		}
+		if sim.sigmetReroutes[callsign] == nil {
+			sim.sigmetReroutes[callsign] = make(map[string]interface{})
+		}
+		sim.sigmetReroutes[callsign][sig.Id] = nil
+
+		// Deviate away from the middle of the area.
+		degrees := deviationAwayFrom(ac, areaCenter(sig.Area(sim.scheduleStart, now)))
+		if sim.humanController(ac.TrackingController) {
+			sim.requestWeatherDeviation(ac, degrees, "weather")
+		} else {
+			lg.Printf("%s: deviating %d degrees around %s", callsign, degrees, sig.Label())
+			ac.turnForWeather(degrees)
+		}
+	}
+}
+
+// refuseDirectThroughConvection returns true, after having the pilot say
+// so, if flying direct to p would take the aircraft through an active
+// convective SIGMET.
+func (sim *Sim) refuseDirectThroughConvection(ac *Aircraft, fix string, p Point2LL) bool {
+	if sim.convectionOnPath(ac.Altitude, []Point2LL{ac.Position, p}) != nil {
+		pilotReadback(ac.Callsign, "unable_direct_weather", ReadbackData{Fix: fix})
+		return true
+	}
+	return false
+}
+
+// refuseHeadingThroughConvection returns true, after having the pilot say
+// so, if flying the given heading would take the aircraft into an active
+// convective SIGMET within sigmetLookaheadNM. Headings aren't refused if
+// the aircraft is already in one, so that it can be vectored out.
+func (sim *Sim) refuseHeadingThroughConvection(ac *Aircraft, heading int) bool {
+	if sim.convectionOnPath(ac.Altitude, []Point2LL{ac.Position, ac.Position}) != nil {
+		return false
+	}
+	hdg := float32(heading) - scenarioGroup.MagneticVariation
+	ahead := scale2f([2]float32{sin(radians(hdg)), cos(radians(hdg))}, sigmetLookaheadNM)
+	p := nm2ll(add2f(ll2nm(ac.Position), ahead))
+	if sim.convectionOnPath(ac.Altitude, []Point2LL{ac.Position, p}) != nil {
+		pilotReadback(ac.Callsign, "unable_heading_weather", ReadbackData{Heading: heading})
+		return true
+	}
+	return false
+}
+
+// SIGMETDescriptions returns a summary of each active SIGMET, for the
+// relief briefing.
+func (sim *Sim) SIGMETDescriptions() []string {
+	var d []string
+	for _, sig := range sim.ActiveSIGMETs() {
+		s := fmt.Sprintf("%s %03d-%03d", sig.Label(), sig.Floor/100, sig.Tops/100)
+		if sig.MovementSpeed > 0 {
+			s += fmt.Sprintf(" MOV FROM %03d%02dKT", (int(sig.MovementDirection)+180)%360, int(sig.MovementSpeed))
+		}
+		d = append(d, strings.ToUpper(s))
+	}
+	return d
+}
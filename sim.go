@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,10 +29,64 @@ var (
 	ErrNoController                 = errors.New("No controller with that callsign")
 	ErrUnknownAircraftType          = errors.New("Unknown aircraft type")
 	ErrUnableCommand                = errors.New("Unable")
+	ErrInvalidVectorRoute           = errors.New("Invalid vector route")
+	ErrInvalidCommandSyntax         = errors.New("Invalid command syntax")
+	ErrInvalidCommandParameter      = errors.New("Invalid command parameter")
+	ErrUnknownFix                   = errors.New("Unknown fix")
+	ErrNoPilotRequest               = errors.New("No pilot request with that id")
+	ErrUnknownRunway                = errors.New("Unknown runway")
 )
 
+// SuggestionError is returned when a command refers to a fix or approach
+// that doesn't exist but is close to the name of one that does, so that
+// the user can be offered the correction.
+type SuggestionError struct {
+	Name       string
+	Suggestion string
+	Err        error
+}
+
+func (e *SuggestionError) Error() string {
+	return fmt.Sprintf("%s: %v; did you mean %s?", e.Name, e.Err, e.Suggestion)
+}
+
+func (e *SuggestionError) Unwrap() error { return e.Err }
+
+// MinimumAltitudeError is returned when an assigned altitude is below the
+// MVA or MEA at the aircraft's position; see msaw.go. Appending "!" to the
+// altitude command overrides it.
+type MinimumAltitudeError struct {
+	Kind     string // "MVA" or "MEA"
+	Altitude int
+	Minimum  int
+}
+
+func (e *MinimumAltitudeError) Error() string {
+	return fmt.Sprintf("%d is below the %s of %d", e.Altitude, e.Kind, e.Minimum)
+}
+
+// maxSuggestionDistance returns the number of edits that an existing
+// name may be from the given one for it to be suggested instead. Short
+// names have many others within a couple of edits, so fewer edits are
+// allowed for them.
+func maxSuggestionDistance(name string) int {
+	switch n := len(name); {
+	case n <= 2:
+		return 0
+	case n <= 4:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Fixes and navaids from the database are only suggested if they are
+// within this distance of the aircraft (in nm).
+const fixSuggestionRadius = 75
+
 type SimConnectionConfiguration struct {
 	departureChallenge float32
+	departureReleases  bool
 	goAroundRate       float32
 	scenario           *Scenario
 	controller         *Controller
@@ -41,11 +96,37 @@ type SimConnectionConfiguration struct {
 	departureRates map[string]map[string]map[string]*int32
 	// arrival group -> airport -> rate
 	arrivalGroupRates map[string]map[string]*int32
+
+	scheduledTraffic  bool
+	scheduleStartHour int32
+
+	adaptiveTraffic bool
+
+	// Run the scenario's challenge, if it has one.
+	challenge bool
+	// Run the session as an over-the-shoulder exam; see exam.go.
+	exam bool
+
+	specialOperationRate float32
+	emergencyRate        float32
+	vfrRate              int32
+	pilotErrorRate       float32
+
+	// Warn about altitude assignments below the MVA or MEA.
+	validateAltitudes bool
+
+	// Use the current real-world weather; see livemetar.go.
+	liveWeather bool
+	// Generate random precipitation if the scenario doesn't define any;
+	// see precipitation.go.
+	randomPrecipitation bool
 }
 
 func (ssc *SimConnectionConfiguration) Initialize() {
 	ssc.departureChallenge = 0.25
 	ssc.goAroundRate = 0.10
+	ssc.scheduleStartHour = 7
+	ssc.liveWeather = globalConfig.LiveWeather
 	ssc.ResetScenarioGroup()
 }
 
@@ -75,6 +156,7 @@ func (ssc *SimConnectionConfiguration) SetScenario(name string) {
 	}
 
 	ssc.arrivalGroupRates = DuplicateMap(ssc.scenario.ArrivalGroupDefaultRates)
+	ssc.challenge = ssc.scenario.Challenge != nil
 
 	ssc.departureRates = make(map[string]map[string]map[string]*int32)
 	for _, rwy := range ssc.scenario.DepartureRunways {
@@ -189,6 +271,69 @@ func (ssc *SimConnectionConfiguration) DrawUI() bool {
 		imgui.EndTable()
 	}
 
+	if c := scenario.Challenge; c != nil {
+		imgui.Separator()
+		imgui.Checkbox("Run as challenge: "+c.Name, &ssc.challenge)
+		if imgui.IsItemHovered() {
+			var obj []string
+			for _, o := range c.Objectives {
+				obj = append(obj, o.String())
+			}
+			imgui.SetTooltip(strings.Join(obj, "\n"))
+		}
+	}
+	if !*serve {
+		imgui.Checkbox("Over-the-shoulder exam", &ssc.exam)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Disable assists, log all actions, and grade the session at the end")
+		}
+	}
+
+	imgui.Separator()
+	imgui.Checkbox("Traffic follows time of day", &ssc.scheduledTraffic)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Scale the rates below, taken as peak rates, according to the airports' daily schedules")
+	}
+	if ssc.scheduledTraffic {
+		imgui.SliderIntV("Starting hour (local)", &ssc.scheduleStartHour, 0, 23, "%02d00", 0)
+	}
+	imgui.Checkbox("Adapt traffic to workload", &ssc.adaptiveTraffic)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Raise or lower the rates below according to how quickly you respond and the errors you make")
+	}
+	imgui.Checkbox("Use current real-world weather", &ssc.liveWeather)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Fetch METARs for the scenario's airports from aviationweather.gov and take the wind from them")
+	}
+	if len(ssc.scenario.Precipitation) == 0 {
+		imgui.Checkbox("Random precipitation", &ssc.randomPrecipitation)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Generate cells of precipitation that drift with the wind and are shown with the WX buttons")
+		}
+	}
+	imgui.SliderFloatV("Special operations per hour", &ssc.specialOperationRate, 0, 2, "%.1f", 0)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("VIP movements, MEDEVAC flights, banner tows, and parachute jumping")
+	}
+	imgui.SliderIntV("VFR aircraft per hour", &ssc.vfrRate, 0, 30, "%d", 0)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("VFR aircraft squawking 1200 that transit the area; some request flight following")
+	}
+	imgui.SliderFloatV("Pilot readback error rate", &ssc.pilotErrorRate, 0, 0.2, "%.2f", 0)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Fraction of altitude and heading assignments that the pilot reads back and flies incorrectly")
+	}
+	if len(scenarioGroup.MVAs) > 0 || len(scenarioGroup.MEAs) > 0 {
+		imgui.Checkbox("Warn about altitudes below the MVA/MEA", &ssc.validateAltitudes)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Altitude assignments below the minimum altitude must be overridden by adding \"!\" to the command")
+		}
+	}
+	imgui.SliderFloatV("Emergencies per hour", &ssc.emergencyRate, 0, 2, "%.1f", 0)
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Engine failures, medical emergencies, pressurization problems, and radio failures")
+	}
+
 	if len(scenario.DepartureRunways) > 0 {
 		imgui.Separator()
 		imgui.Text("Departures")
@@ -204,6 +349,10 @@ func (ssc *SimConnectionConfiguration) DrawUI() bool {
 		imgui.Text(fmt.Sprintf("Overall departure rate: %d / hour", sumRates))
 
 		imgui.SliderFloatV("Sequencing challenge", &ssc.departureChallenge, 0, 1, "%.02f", 0)
+		imgui.Checkbox("Tower requests departure releases", &ssc.departureReleases)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Departures wait at the runway until released with the REL command")
+		}
 		flags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
 
 		if imgui.BeginTableV("departureRunways", 4, flags, imgui.Vec2{500, 0}, 0.) {
@@ -262,6 +411,9 @@ func (ssc *SimConnectionConfiguration) DrawUI() bool {
 		imgui.Text("Arrivals")
 		imgui.Text(fmt.Sprintf("Overall arrival rate: %d / hour", sumRates))
 		imgui.SliderFloatV("Go around probability", &ssc.goAroundRate, 0, 1, "%.02f", 0)
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Probability of a go-around for no particular reason, or for a marginally unstable approach or wind shear")
+		}
 
 		flags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
 		if imgui.BeginTableV("arrivalgroups", 1+nAirports, flags, imgui.Vec2{500, 0}, 0.) {
@@ -302,7 +454,11 @@ func (ssc *SimConnectionConfiguration) Connect() error {
 	for _, ac := range sim.GetAllAircraft() {
 		eventStream.Post(&RemovedAircraftEvent{ac: ac})
 	}
+	globalConfig.LiveWeather = ssc.liveWeather
 	sim.Disconnect()
+	if r := sim.recording; r != nil && len(r.Tracks) > 0 {
+		uiOfferSessionPlayback(r)
+	}
 	sim = NewSim(*ssc)
 	sim.Prespawn()
 	return nil
@@ -316,25 +472,90 @@ type Sim struct {
 
 	Aircraft map[string]*Aircraft
 	Handoffs map[string]time.Time
-	METAR    map[string]*METAR
+	// Outbound handoffs that the receiving controller won't accept until
+	// the aircraft is at the given altitude.
+	HandoffAltitudeHolds map[string]int
+	METAR                map[string]*METAR
+	// Current ATIS information code for each airport, 0-25.
+	ATISCodes map[string]int
+	// Surface wind; it starts out as the scenario's wind but follows the
+	// real-world weather if LiveWeather is set.
+	Wind           Wind
+	LiveWeather    bool
+	liveMETARs     chan liveMETARResult
+	lastMETARFetch time.Time
 
 	SerializeTime time.Time // for updating times on deserialize
 
 	currentTime    time.Time // this is our fake time--accounting for pauses & simRate..
 	lastUpdateTime time.Time // this is w.r.t. true wallclock time
+	lastUserInput  time.Time // also wallclock time
+	wasFocused     bool
 	SimRate        float32
 	Paused         bool
 
 	eventsId EventSubscriberId
 
 	DepartureChallenge float32
-	GoAroundRate       float32
-	WillGoAround       map[string]interface{}
+	// When DepartureReleases is set, departures wait at the runway until
+	// the user releases them; see releases.go.
+	DepartureReleases bool
+	GoAroundRate      float32
+	// Go-arounds that will happen on short final; see goaround.go.
+	WillGoAround map[string]GoAroundCause
+	// Aircraft whose stability at the final approach fix has been
+	// checked.
+	stabilityChecked map[string]interface{}
+	// Probability that a pilot reads back an altitude or heading
+	// incorrectly; see readbackerrors.go.
+	PilotErrorRate float32
+	// Reject altitude assignments below the MVA or MEA unless they are
+	// overridden; see msaw.go.
+	ValidateAltitudes bool
+
+	// When ScheduledTraffic is set, traffic rates follow the time of day
+	// on a simulated clock that starts at ScheduleStartHour.
+	ScheduledTraffic  bool
+	ScheduleStartHour int
+	scheduleStart     time.Time
+
+	// When AdaptiveTraffic is set, spawn rates are scaled by
+	// TrafficScale, which follows the user's workload; see adaptive.go.
+	AdaptiveTraffic bool
+	TrafficScale    float32
+	adaptive        *adaptiveState
 
 	lastTrackUpdate time.Time
 	lastSimUpdate   time.Time
 
-	showSettings bool
+	// Pairs of aircraft that are currently in conflict alert; see
+	// conflictalert.go.
+	conflictAlerts map[[2]string]interface{}
+	// Aircraft that currently have MSAW alerts; see msaw.go.
+	msawAlerts map[string]interface{}
+	// Pairs of arrivals (leading, trailing) for which a wake encounter
+	// has already been handled; see wake.go.
+	wakeEncounters map[[2]string]interface{}
+
+	// Errors made by the user over the course of the session; see
+	// scoring.go.
+	scorer *sessionScorer
+
+	// Aircraft that virtual controllers have already handed off to the
+	// user according to their ControllerPolicy; we don't want to hand
+	// them off again after the user hands them to tower.
+	policyHandoffs map[string]interface{}
+
+	recording *SessionRecording
+	// Source of live ADS-B traffic, in devmode.
+	adsbFeed *ADSBFeed
+
+	// Whether the recording's tracks have been added to the track
+	// history; see trackheatmap.go.
+	tracksSaved bool
+
+	// Set when the Sim is a client of a multiplayer server.
+	remote *MultiplayerClient
 
 	// airport -> runway -> category -> rate
 	DepartureRates map[string]map[string]map[string]*int32
@@ -353,7 +574,110 @@ type Sim struct {
 
 	// Key is arrival group name
 	NextArrivalSpawn map[string]time.Time
-}
+
+	// Departures that have been spawned but are still taxiing out or
+	// holding short.
+	// airport -> runway -> queue
+	DepartureQueues map[string]map[string]*DepartureQueue
+
+	// Runways with conditions specified by the scenario.
+	// "airport/runway" -> state
+	RunwayStates map[string]*RunwayState
+
+	// Recent pilot reports of turbulence and icing.
+	PIREPs []PIREP
+	// callsign -> indices of weather layers it has reported
+	pirepReported map[string]map[int]interface{}
+	// callsign -> ids of SIGMETs it has requested a reroute around
+	sigmetReroutes map[string]map[string]interface{}
+
+	// Current precipitation; see precipitation.go.
+	Precipitation       []PrecipitationCell
+	RandomPrecipitation bool
+	nextPrecipitationId int
+	// callsign -> ids of cells it has considered deviating around
+	precipitationDeviations map[string]map[int]interface{}
+
+	// Pairs of similar callsigns on the user's frequency that have
+	// already been recorded.
+	similarCallsigns map[[2]string]interface{}
+	// callsign -> similar callsigns on the user's frequency; see
+	// SimilarCallsignsOnFrequency.
+	similarOnFrequency     map[string][]string
+	similarOnFrequencyTime time.Time // wallclock
+
+	// Pending requests from pilots on the user's frequency.
+	PilotRequests      []*PilotRequest
+	nextPilotRequestId int
+
+	// callsign -> current deviation from its clearance
+	deviations        map[string]*PilotDeviation
+	deviationMonitors map[string]*deviationMonitor
+
+	// callsign -> the user's alerts that it currently matches
+	userAlerts         map[string][]*UserAlert
+	lastUserAlertCheck time.Time
+
+	// Average number of special operations started per hour.
+	SpecialOperationRate float32
+	NextSpecialOperation time.Time
+	SpecialOperations    []*SpecialOperation
+	// When MEDEVAC flights last asked for priority handling.
+	medevacCalls map[string]time.Time
+
+	// Average number of emergencies declared per hour; see emergencies.go.
+	EmergencyRate float32
+	NextEmergency time.Time
+
+	// VFR aircraft spawned per hour and pending requests for flight
+	// following; see vfr.go.
+	VFRRate      int
+	NextVFRSpawn time.Time
+	vfrCallUps   map[string]time.Time
+	// Airports that VFR aircraft may come from and go to.
+	vfrAirports []FAAAirport
+
+	// Set if the scenario is being run as a challenge; see challenge.go.
+	Challenge *ChallengeProgress
+
+	// Set if the session is being run as an exam; see exam.go.
+	Exam *ExamSession
+}
+
+// QueuedDeparture is a departure that is taxiing out to its runway or
+// waiting there for its turn to depart.
+type QueuedDeparture struct {
+	Aircraft *Aircraft
+	Airport  string
+	Runway   string
+	// ProposedTime is when the aircraft reaches the runway and is ready
+	// to depart.
+	ProposedTime time.Time
+	// Release state when the tower must get a release from the user
+	// before the aircraft departs; see releases.go.
+	ReleaseRequested time.Time
+	Released         bool
+	Held             bool
+}
+
+// DepartureQueue holds the departures for a single runway, sorted by
+// their proposed times, as well as information about the most recent
+// departure so that the next one can be spaced behind it.
+type DepartureQueue struct {
+	Queue      []*QueuedDeparture
+	LastLaunch time.Time
+	LastExit   string
+}
+
+const (
+	minTaxiOut = 3 * time.Minute
+	maxTaxiOut = 9 * time.Minute
+	// Time the runway is occupied by a departure before the next one can
+	// roll.
+	departureRunwayOccupancy = time.Minute
+	// Minimum time between successive departures to the same exit.
+	departureInTrailInterval = 2 * time.Minute
+)
 
 func NewSim(ssc SimConnectionConfiguration) *Sim {
 	rand.Seed(time.Now().UnixNano())
@@ -361,9 +685,12 @@ func NewSim(ssc SimConnectionConfiguration) *Sim {
 	sim := &Sim{
 		Scenario: ssc.scenario,
 
-		Aircraft: make(map[string]*Aircraft),
-		Handoffs: make(map[string]time.Time),
-		METAR:    make(map[string]*METAR),
+		Aircraft:             make(map[string]*Aircraft),
+		Handoffs:             make(map[string]time.Time),
+		HandoffAltitudeHolds: make(map[string]int),
+		METAR:                make(map[string]*METAR),
+		Wind:                 ssc.scenario.Wind,
+		LiveWeather:          ssc.liveWeather,
 
 		DepartureRates:    DuplicateMap(ssc.departureRates),
 		ArrivalGroupRates: DuplicateMap(ssc.arrivalGroupRates),
@@ -373,9 +700,48 @@ func NewSim(ssc SimConnectionConfiguration) *Sim {
 		eventsId:           eventStream.Subscribe(),
 		SimRate:            1,
 		DepartureChallenge: ssc.departureChallenge,
+		DepartureReleases:  ssc.departureReleases,
 		GoAroundRate:       ssc.goAroundRate,
-		WillGoAround:       make(map[string]interface{}),
+		PilotErrorRate:     ssc.pilotErrorRate,
+		ValidateAltitudes:  ssc.validateAltitudes,
+		WillGoAround:       make(map[string]GoAroundCause),
+		ScheduledTraffic:   ssc.scheduledTraffic,
+		ScheduleStartHour:  int(ssc.scheduleStartHour),
+		AdaptiveTraffic:    ssc.adaptiveTraffic,
+		TrafficScale:       1,
+
+		SpecialOperationRate: ssc.specialOperationRate,
+		EmergencyRate:        ssc.emergencyRate,
+		VFRRate:              int(ssc.vfrRate),
+	}
+	if ssc.specialOperationRate > 0 {
+		hours := lerp(rand.Float32(), .25, 1) / ssc.specialOperationRate
+		sim.NextSpecialOperation = sim.currentTime.Add(time.Duration(hours * float32(time.Hour)))
+	}
+	if ssc.emergencyRate > 0 {
+		hours := lerp(rand.Float32(), .25, 1) / ssc.emergencyRate
+		sim.NextEmergency = sim.currentTime.Add(time.Duration(hours * float32(time.Hour)))
+	}
+	sim.scheduleStart = sim.currentTime
+	sim.recording = NewSessionRecording(sim.currentTime)
+	if !*serve {
+		sim.scorer = newSessionScorer(sim.Scenario, sim.currentTime)
+		if ssc.challenge && sim.Scenario.Challenge != nil {
+			sim.Challenge = NewChallengeProgress(sim.Scenario.Challenge, sim.currentTime)
+			challengeWindow.show = true
+		}
+		if ssc.exam {
+			sim.Exam = &ExamSession{}
+			// Altitude warnings are an assist as well.
+			sim.ValidateAltitudes = false
+		}
+	}
+
+	sim.RunwayStates = make(map[string]*RunwayState)
+	for _, rc := range sim.Scenario.RunwayConditions {
+		sim.RunwayStates[runwayKey(rc.Airport, rc.Runway)] = NewRunwayState(rc)
 	}
+	sim.initializePrecipitation(ssc.randomPrecipitation)
 
 	// Make some fake METARs; slightly different for all airports.
 	alt := 2980 + rand.Intn(40)
@@ -404,6 +770,12 @@ func NewSim(ssc SimConnectionConfiguration) *Sim {
 			Altimeter:   fmt.Sprintf("A%d", alt-2+rand.Intn(4)),
 		}
 	}
+	if sim.LiveWeather {
+		sim.fetchLiveMETARs()
+	}
+	if *devmode && *adsbURL != "" {
+		sim.adsbFeed = NewADSBFeed(*adsbURL)
+	}
 
 	sim.SetInitialSpawnTimes()
 
@@ -441,7 +813,10 @@ func (sim *Sim) SetInitialSpawnTimes() {
 				rateSum += int(*rate)
 			}
 			if rateSum > 0 {
-				spawn[runway] = randomSpawn(rateSum)
+				// Start the first departures taxiing out early enough
+				// that they're at the runway around when the session
+				// begins.
+				spawn[runway] = randomSpawn(rateSum).Add(-(minTaxiOut + maxTaxiOut) / 2)
 			}
 		}
 
@@ -466,17 +841,33 @@ func (sim *Sim) Prespawn() {
 }
 
 func (sim *Sim) SetSquawk(callsign string, squawk Squawk) error {
+	if sim.remote != nil {
+		sim.remote.SetSquawk(callsign, squawk)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
 func (sim *Sim) SetSquawkAutomatic(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.SetSquawkAutomatic(callsign)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
 func (sim *Sim) SetScratchpad(callsign string, scratchpad string) error {
+	if sim.remote != nil {
+		sim.remote.SetScratchpad(callsign, scratchpad)
+		return nil
+	}
+	return sim.setScratchpad(sim.Scenario.Callsign, callsign, scratchpad)
+}
+
+func (sim *Sim) setScratchpad(controller string, callsign string, scratchpad string) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
-	} else if ac.TrackingController != sim.Scenario.Callsign {
+	} else if ac.TrackingController != controller {
 		return ErrOtherControllerHasTrack
 	} else {
 		ac.Scratchpad = scratchpad
@@ -486,24 +877,48 @@ func (sim *Sim) SetScratchpad(callsign string, scratchpad string) error {
 }
 
 func (sim *Sim) SetTemporaryAltitude(callsign string, alt int) error {
+	if sim.remote != nil {
+		sim.remote.SetTemporaryAltitude(callsign, alt)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
 func (sim *Sim) AmendFlightPlan(callsign string, fp FlightPlan) error {
+	if sim.remote != nil {
+		sim.remote.AmendFlightPlan(callsign, fp)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
 func (sim *Sim) PushFlightStrip(callsign string, controller string) error {
+	if sim.remote != nil {
+		sim.remote.PushFlightStrip(callsign, controller)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
 func (sim *Sim) InitiateTrack(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.InitiateTrack(callsign)
+		return nil
+	}
+	err := sim.initiateTrack(sim.Scenario.Callsign, callsign)
+	sim.examAction(callsign, err, "initiate track")
+	return err
+}
+
+func (sim *Sim) initiateTrack(controller string, callsign string) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
+	} else if ac.LiveADSB {
+		return ErrUncontrollableAircraft
 	} else if ac.TrackingController != "" {
 		return ErrOtherControllerHasTrack
 	} else {
-		ac.TrackingController = sim.Scenario.Callsign
+		ac.TrackingController = controller
 		eventStream.Post(&ModifiedAircraftEvent{ac: ac})
 		eventStream.Post(&InitiatedTrackEvent{ac: ac})
 		return nil
@@ -511,9 +926,19 @@ func (sim *Sim) InitiateTrack(callsign string) error {
 }
 
 func (sim *Sim) DropTrack(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.DropTrack(callsign)
+		return nil
+	}
+	err := sim.dropTrack(sim.Scenario.Callsign, callsign)
+	sim.examAction(callsign, err, "drop track")
+	return err
+}
+
+func (sim *Sim) dropTrack(controller string, callsign string) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
-	} else if ac.TrackingController != sim.Scenario.Callsign {
+	} else if ac.TrackingController != controller {
 		return ErrOtherControllerHasTrack
 	} else {
 		ac.TrackingController = ""
@@ -523,47 +948,145 @@ func (sim *Sim) DropTrack(callsign string) error {
 	}
 }
 
+// humanController returns true if the given position is staffed by the
+// user or by a remote controller connected to the multiplayer server.
+func (sim *Sim) humanController(callsign string) bool {
+	return (callsign == sim.Scenario.Callsign && !*serve) ||
+		(multiplayerServer != nil && multiplayerServer.Staffed(callsign))
+}
+
 func (sim *Sim) Handoff(callsign string, controller string) error {
+	if sim.remote != nil {
+		sim.remote.Handoff(callsign, controller)
+		return nil
+	}
+	err := sim.handoff(sim.Scenario.Callsign, callsign, controller)
+	sim.examAction(callsign, err, "handoff to %s", controller)
+	return err
+}
+
+func (sim *Sim) handoff(from string, callsign string, controller string) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
-	} else if ac.TrackingController != sim.Scenario.Callsign {
+	} else if ac.TrackingController != from {
 		return ErrOtherControllerHasTrack
 	} else if ctrl := sim.GetController(controller); ctrl == nil {
 		return ErrNoController
+	} else if sim.humanController(ctrl.Callsign) {
+		// The other controller has to accept it.
+		ac.OutboundHandoffController = ctrl.Callsign
+		ac.InboundHandoffController = ctrl.Callsign
+		if ctrl.Callsign == sim.Scenario.Callsign {
+			globalConfig.Audio.PlaySound(AudioEventInboundHandoff)
+		}
+		eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+		return nil
 	} else {
 		ac.OutboundHandoffController = ctrl.Callsign
 		eventStream.Post(&ModifiedAircraftEvent{ac: ac})
-		acceptDelay := 2 + rand.Intn(10)
-		sim.Handoffs[callsign] = sim.CurrentTime().Add(time.Duration(acceptDelay) * time.Second)
+
+		policy := sim.Scenario.ControllerPolicy(ctrl.Callsign, ac)
+		tracked := len(sim.GetFilteredAircraft(func(a *Aircraft) bool {
+			return a.TrackingController == ctrl.Callsign
+		}))
+		sim.Handoffs[callsign] = sim.CurrentTime().Add(policy.HandoffAcceptDelay(ctrl.Callsign, tracked))
+
+		if policy.RefusesHandoff(ac) {
+			if sim.HandoffAltitudeHolds == nil {
+				sim.HandoffAltitudeHolds = make(map[string]int)
+			}
+			sim.HandoffAltitudeHolds[callsign] = policy.AcceptAltitude
+			landlineMessage(ctrl.Callsign, "unable handoff on %s until it's at %d per the LOA", callsign,
+				policy.AcceptAltitude)
+		} else if v := policy.TransferViolation(ac); v != "" {
+			landlineMessage(ctrl.Callsign, "%s per the LOA", v)
+			sim.recording.AddEvent(SessionEventHandoff, ac, sim.CurrentTime(), "%s: %s", ctrl.Callsign, v)
+			if sim.scorer != nil && from == sim.Scenario.Callsign {
+				sim.addScoredError(ScoreLOAViolation, ac, "%s: %s", ctrl.Callsign, v)
+			}
+		}
 		return nil
 	}
 }
 
 func (sim *Sim) AcceptHandoff(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.AcceptHandoff(callsign)
+		return nil
+	}
+	err := sim.acceptHandoff(sim.Scenario.Callsign, callsign)
+	sim.examAction(callsign, err, "accept handoff")
+	return err
+}
+
+func (sim *Sim) acceptHandoff(controller string, callsign string) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
-	} else if ac.InboundHandoffController != sim.Scenario.Callsign {
+	} else if ac.InboundHandoffController != controller {
 		return ErrNotBeingHandedOffToMe
 	} else {
+		sim.recording.AddEvent(SessionEventHandoff, ac, sim.CurrentTime(), "%s accepted from %s", callsign, ac.TrackingController)
+		from := ac.TrackingController
 		ac.InboundHandoffController = ""
-		ac.TrackingController = sim.Scenario.Callsign
-		eventStream.Post(&AcceptedHandoffEvent{controller: sim.Scenario.Callsign, ac: ac})
+		ac.OutboundHandoffController = ""
+		ac.TrackingController = controller
+		if controller == sim.Scenario.Callsign {
+			if !sim.haveInboundHandoffs() {
+				globalConfig.Audio.Acknowledge(AudioEventInboundHandoff)
+			}
+			globalConfig.Audio.Acknowledge(AudioEventLandlineRing)
+			sim.scoreCheckIn(ac)
+		} else if from == sim.Scenario.Callsign {
+			globalConfig.Audio.PlaySound(AudioEventHandoffAccepted)
+		}
+		eventStream.Post(&AcceptedHandoffEvent{controller: controller, ac: ac})
 		eventStream.Post(&ModifiedAircraftEvent{ac: ac}) // FIXME...
 		return nil
 	}
 }
 
+// haveInboundHandoffs returns true if any aircraft is being handed off
+// to the user.
+func (sim *Sim) haveInboundHandoffs() bool {
+	for _, ac := range sim.Aircraft {
+		if ac.InboundHandoffController == sim.Scenario.Callsign {
+			return true
+		}
+	}
+	return false
+}
+
 func (sim *Sim) RejectHandoff(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.RejectHandoff(callsign)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
 func (sim *Sim) CancelHandoff(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.CancelHandoff(callsign)
+		return nil
+	}
+	err := sim.cancelHandoff(sim.Scenario.Callsign, callsign)
+	sim.examAction(callsign, err, "cancel handoff")
+	return err
+}
+
+func (sim *Sim) cancelHandoff(controller string, callsign string) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
-	} else if ac.TrackingController != sim.Scenario.Callsign {
+	} else if ac.TrackingController != controller {
 		return ErrOtherControllerHasTrack
 	} else {
+		if ac.InboundHandoffController == ac.OutboundHandoffController {
+			// It was being handed off to another person.
+			ac.InboundHandoffController = ""
+		}
 		ac.OutboundHandoffController = ""
+		delete(sim.Handoffs, callsign)
+		delete(sim.HandoffAltitudeHolds, callsign)
 		// TODO: we are inconsistent in other control backends about events
 		// when user does things like this; sometimes no event, sometimes
 		// modified a/c event...
@@ -573,6 +1096,10 @@ func (sim *Sim) CancelHandoff(callsign string) error {
 }
 
 func (sim *Sim) PointOut(callsign string, controller string) error {
+	if sim.remote != nil {
+		sim.remote.PointOut(callsign, controller)
+		return nil
+	}
 	return nil // UNIMPLEMENTED
 }
 
@@ -585,9 +1112,22 @@ func (sim *Sim) SetRadarCenters(primary Point2LL, secondary [3]Point2LL, rangeNm
 }
 
 func (sim *Sim) Disconnect() {
+	if sim.remote != nil {
+		sim.remote.Close()
+		sim.remote = nil
+	}
 	for _, ac := range sim.Aircraft {
 		eventStream.Post(&RemovedAircraftEvent{ac: ac})
 	}
+	if sim.adsbFeed != nil {
+		sim.adsbFeed.Close()
+		sim.adsbFeed = nil
+	}
+	if sim.recording != nil && !sim.tracksSaved {
+		saveTrackHistory(scenarioGroup.Name, sim.recording)
+		sim.tracksSaved = true
+	}
+	sim.finishScore()
 	if sim.eventsId != InvalidEventSubscriberId {
 		eventStream.Unsubscribe(sim.eventsId)
 		sim.eventsId = InvalidEventSubscriberId
@@ -631,7 +1171,18 @@ func (sim *Sim) GetMETAR(location string) *METAR {
 }
 
 func (sim *Sim) GetAirportATIS(airport string) []ATIS {
-	// UNIMPLEMENTED
+	if sim.ATISCodes == nil {
+		sim.ATISCodes = make(map[string]int)
+	}
+	code, ok := sim.ATISCodes[airport]
+	if !ok {
+		code = rand.Intn(26)
+		sim.ATISCodes[airport] = code
+	}
+
+	if atis := sim.GenerateATIS(airport, code); atis != nil {
+		return []ATIS{*atis}
+	}
 	return nil
 }
 
@@ -670,6 +1221,12 @@ func (sim *Sim) SetPrimaryFrequency(f Frequency) {
 }
 
 func (sim *Sim) GetUpdates() {
+	if sim.remote != nil {
+		sim.remote.GetUpdates(sim)
+		sim.checkRemoteAlerts()
+		sim.checkUserAlerts()
+		return
+	}
 	if sim.Paused || sim.Scenario == nil {
 		return
 	}
@@ -679,6 +1236,9 @@ func (sim *Sim) GetUpdates() {
 		for _, ev := range eventStream.Get(sim.eventsId) {
 			if rem, ok := ev.(*RemovedAircraftEvent); ok {
 				delete(sim.Aircraft, rem.ac.Callsign)
+				delete(sim.policyHandoffs, rem.ac.Callsign)
+				delete(sim.pirepReported, rem.ac.Callsign)
+				delete(sim.medevacCalls, rem.ac.Callsign)
 			}
 		}
 	}
@@ -690,6 +1250,7 @@ func (sim *Sim) GetUpdates() {
 	sim.lastUpdateTime = time.Now()
 
 	sim.updateState()
+	sim.checkUserAlerts()
 }
 
 // FIXME: this is poorly named...
@@ -699,13 +1260,34 @@ func (sim *Sim) updateState() {
 	for callsign, t := range sim.Handoffs {
 		if now.After(t) {
 			if ac, ok := sim.Aircraft[callsign]; ok {
+				if alt, ok := sim.HandoffAltitudeHolds[callsign]; ok {
+					// Wait until the aircraft meets the LOA altitude.
+					if !meetsLOAAltitude(ac, alt) {
+						continue
+					}
+					delete(sim.HandoffAltitudeHolds, callsign)
+				}
+
+				from := ac.TrackingController
 				ac.TrackingController = ac.OutboundHandoffController
 				ac.OutboundHandoffController = ""
 				eventStream.Post(&AcceptedHandoffEvent{controller: ac.TrackingController, ac: ac})
-				globalConfig.Audio.PlaySound(AudioEventHandoffAccepted)
-
-				// Climb to cruise altitude...
-				ac.AssignedAltitude = ac.FlightPlan.Altitude
+				if from == sim.Scenario.Callsign {
+					globalConfig.Audio.PlaySound(AudioEventHandoffAccepted)
+				}
+				sim.recording.AddEvent(SessionEventHandoff, ac, now, "%s handed off to %s", callsign, ac.TrackingController)
+
+				// Climb to cruise altitude unless the controller's policy
+				// says otherwise.
+				policy := sim.Scenario.ControllerPolicy(ac.TrackingController, ac)
+				if policy.ClimbAltitude != 0 {
+					ac.AssignedAltitude = policy.ClimbAltitude
+				} else {
+					ac.AssignedAltitude = ac.FlightPlan.Altitude
+				}
+				if policy.Speed != 0 {
+					ac.AssignedSpeed = policy.Speed
+				}
 			}
 			delete(sim.Handoffs, callsign)
 		}
@@ -713,53 +1295,132 @@ func (sim *Sim) updateState() {
 
 	// Update the simulation state once a second.
 	if now.Sub(sim.lastSimUpdate) >= time.Second {
+		// Sim time elapsed since the last update, which may be more than
+		// a second at higher sim rates.
+		elapsed := time.Second
+		if !sim.lastSimUpdate.IsZero() {
+			elapsed = now.Sub(sim.lastSimUpdate)
+		}
 		sim.lastSimUpdate = now
+		sim.updateSpecialOperations(now)
+		sim.updateEmergencies(now)
+		sim.updateVFR(now)
+		sim.updatePIREPs(now)
+		sim.updateSIGMETs(now)
+		sim.updatePrecipitation(elapsed)
+		sim.updateWeatherDeviations()
+		sim.checkSimilarCallsigns(now)
+		sim.updateRunwayConditions(now, elapsed)
+		sim.updateLiveWeather()
+		sim.updateADSBFeed()
+		sim.pruneDeviations()
+		sim.updatePilotRequests()
+		sim.updateScore()
+		sim.updateAdaptiveTraffic(now)
+		sim.updateChallenge(now)
+		sim.checkWakeSeparation(now)
+		sim.updateReadbackErrors(now)
+		sim.updateDepartureReleases(now)
 		for _, ac := range sim.Aircraft {
-			ac.Update()
-
-			if _, ok := sim.WillGoAround[ac.Callsign]; !ok {
-				continue
-			}
-
-			if !ac.OnFinal || len(ac.Waypoints) != 1 {
+			if ac.LiveADSB {
 				continue
 			}
+			ac.Update()
+			sim.checkDeviations(ac, now)
+			sim.checkControllerPolicyHandoff(ac)
 
-			dist := nmdistance2ll(ac.Position, ac.Waypoints[0].Location)
-			if dist < 0.25 {
-				delete(sim.WillGoAround, ac.Callsign)
-				ac.GoAround(sim)
-				pilotResponse(ac.Callsign, "Going around")
-			}
+			sim.checkGoAround(ac, now)
 		}
 	}
 
-	// Add a new radar track every 5 seconds.
-	if now.Sub(sim.lastTrackUpdate) >= 5*time.Second {
+	// Add a new track with each radar sweep or ADS-B report.
+	if now.Sub(sim.lastTrackUpdate) >= sim.TrackInterval() {
 		sim.lastTrackUpdate = now
 
 		for _, ac := range sim.Aircraft {
-			ac.AddTrack(RadarTrack{
+			if !sim.Surveilled(ac) {
+				continue
+			}
+			track := RadarTrack{
 				Position:    ac.Position,
 				Altitude:    int(ac.Altitude),
 				Groundspeed: int(ac.GS),
 				Heading:     ac.Heading - scenarioGroup.MagneticVariation,
 				Time:        now,
-			})
+			}
+			if ac.ADSBEquipped {
+				track.SelectedAltitude = ac.SelectedAltitude()
+				track.IAS = int(ac.IAS)
+			}
+			ac.AddTrack(track)
+			sim.recording.AddTrack(ac.Callsign, track)
 
 			eventStream.Post(&ModifiedAircraftEvent{ac: ac})
 		}
+		sim.recording.CheckConflicts(sim.Aircraft, now)
+		sim.checkConflictAlerts()
+		sim.checkMSAW()
 	}
 
 	sim.SpawnAircraft()
 }
 
+// checkControllerPolicyHandoff hands off arrivals tracked by virtual
+// controllers to the user once they reach the handoff distance given by
+// the controller's policy or when its script says to.
+func (sim *Sim) checkControllerPolicyHandoff(ac *Aircraft) {
+	if ac.TrackingController == "" || sim.humanController(ac.TrackingController) ||
+		ac.InboundHandoffController != "" || ac.FlightPlan == nil {
+		return
+	}
+	if _, ok := sim.policyHandoffs[ac.Callsign]; ok {
+		return
+	}
+	policy := sim.Scenario.ControllerPolicy(ac.TrackingController, ac)
+	if policy.script != nil {
+		sim.runPolicyScript(policy, ac)
+		return
+	}
+	if policy.HandoffDistance == 0 {
+		return
+	}
+	if ap, ok := scenarioGroup.Locate(ac.FlightPlan.ArrivalAirport); !ok ||
+		nmdistance2ll(ac.Position, ap) > policy.HandoffDistance {
+		return
+	}
+
+	if policy.HandoffAltitude != 0 {
+		ac.AssignedAltitude = policy.HandoffAltitude
+	}
+	if policy.HandoffSpeed != 0 {
+		ac.AssignedSpeed = policy.HandoffSpeed
+	}
+	sim.policyHandoff(ac)
+}
+
+// policyHandoff has the virtual controller tracking the aircraft hand it
+// off to the user.
+func (sim *Sim) policyHandoff(ac *Aircraft) {
+	if sim.policyHandoffs == nil {
+		sim.policyHandoffs = make(map[string]interface{})
+	}
+	sim.policyHandoffs[ac.Callsign] = nil
+	ac.InboundHandoffController = sim.Scenario.Callsign
+	globalConfig.Audio.PlaySound(AudioEventInboundHandoff)
+	eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+}
+
 func (sim *Sim) Connected() bool {
 	return true
 }
 
 func (sim *Sim) Callsign() string {
-	if sim.Scenario != nil {
+	if sim.remote != nil {
+		if sim.remote.position == "" {
+			return "(observer)"
+		}
+		return sim.remote.position
+	} else if sim.Scenario != nil {
 		return sim.Scenario.Callsign
 	} else {
 		return "(disconnected)"
@@ -774,7 +1435,10 @@ func (sim *Sim) GetWindowTitle() string {
 	if sim.Scenario == nil {
 		return "(disconnected)"
 	}
-	return sim.Scenario.Callsign + ": " + sim.Scenario.Name()
+	if sim.Paused {
+		return sim.Callsign() + ": " + sim.Scenario.Name() + " (paused)"
+	}
+	return sim.Callsign() + ": " + sim.Scenario.Name()
 }
 
 func pilotResponse(callsign string, fm string, args ...interface{}) {
@@ -782,16 +1446,28 @@ func pilotResponse(callsign string, fm string, args ...interface{}) {
 	eventStream.Post(&RadioTransmissionEvent{callsign: callsign, message: fmt.Sprintf(fm, args...)})
 }
 
+// landlineMessage sends the user a message from another controller.
+func landlineMessage(from string, fm string, args ...interface{}) {
+	lg.Printf("%s (landline): %s", from, fmt.Sprintf(fm, args...))
+	eventStream.Post(&LandlineMessageEvent{from: from, message: fmt.Sprintf(fm, args...)})
+}
+
 func (sim *Sim) AssignAltitude(callsign string, altitude int) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
 	} else {
+		if em := ac.Emergency; em != nil && em.MaxAltitude != 0 && altitude > em.MaxAltitude {
+			pilotReadback(callsign, "unable_altitude_emergency", ReadbackData{Altitude: em.MaxAltitude})
+			return ErrUnableCommand
+		}
+
+		altitude = sim.readbackError(ac, ReadbackErrorAltitude, altitude)
 		if float32(altitude) > ac.Altitude {
-			pilotResponse(callsign, "climb and maintain %d", altitude)
+			pilotReadback(callsign, "climb", ReadbackData{Altitude: altitude})
 		} else if float32(altitude) == ac.Altitude {
-			pilotResponse(callsign, "maintain %d", altitude)
+			pilotReadback(callsign, "maintain_altitude", ReadbackData{Altitude: altitude})
 		} else {
-			pilotResponse(callsign, "descend and maintain %d", altitude)
+			pilotReadback(callsign, "descend", ReadbackData{Altitude: altitude})
 		}
 
 		if ac.AssignedSpeed != 0 {
@@ -800,6 +1476,7 @@ func (sim *Sim) AssignAltitude(callsign string, altitude int) error {
 			ac.AssignedAltitude = altitude
 		}
 		ac.CrossingAltitude = 0
+		ac.CancelVia()
 		return nil
 	}
 }
@@ -807,13 +1484,16 @@ func (sim *Sim) AssignAltitude(callsign string, altitude int) error {
 func (sim *Sim) AssignHeading(callsign string, heading int, turn int) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
+	} else if sim.refuseHeadingThroughConvection(ac, heading) {
+		return ErrUnableCommand
 	} else {
+		heading = sim.readbackError(ac, ReadbackErrorHeading, heading)
 		if turn > 0 {
-			pilotResponse(callsign, "turn right heading %d", heading)
+			pilotReadback(callsign, "turn_right_heading", ReadbackData{Heading: heading})
 		} else if turn == 0 {
-			pilotResponse(callsign, "fly heading %d", heading)
+			pilotReadback(callsign, "fly_heading", ReadbackData{Heading: heading})
 		} else {
-			pilotResponse(callsign, "turn left heading %d", heading)
+			pilotReadback(callsign, "turn_left_heading", ReadbackData{Heading: heading})
 		}
 
 		// A 0 heading shouldn't be specified, but at least cause the
@@ -823,6 +1503,8 @@ func (sim *Sim) AssignHeading(callsign string, heading int, turn int) error {
 			heading = 360
 		}
 
+		ac.CancelHold()
+		ac.CancelWeatherDeviation()
 		ac.AssignedHeading = heading
 		ac.TurnDirection = turn
 		ac.ClearedApproach = false // if cleared, giving a heading cancels clearance
@@ -830,21 +1512,33 @@ func (sim *Sim) AssignHeading(callsign string, heading int, turn int) error {
 	}
 }
 
+// turnedHeading returns the aircraft's heading after turning the given
+// number of degrees from its assigned heading or, if it doesn't have one,
+// its current heading; negative is to the left.
+func turnedHeading(ac *Aircraft, deg int) int {
+	hdg := ac.AssignedHeading
+	if hdg == 0 {
+		hdg = int(ac.Heading)
+	}
+	hdg += deg
+	if hdg <= 0 {
+		hdg += 360
+	} else if hdg > 360 {
+		hdg -= 360
+	}
+	return hdg
+}
+
 func (sim *Sim) TurnLeft(callsign string, deg int) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
+	} else if sim.refuseHeadingThroughConvection(ac, turnedHeading(ac, -deg)) {
+		return ErrUnableCommand
 	} else {
-		pilotResponse(callsign, "turn %d degrees left", deg)
-
-		if ac.AssignedHeading == 0 {
-			ac.AssignedHeading = int(ac.Heading) - deg
-		} else {
-			ac.AssignedHeading -= deg
-		}
-
-		if ac.AssignedHeading <= 0 {
-			ac.AssignedHeading += 360
-		}
+		pilotReadback(callsign, "turn_left_degrees", ReadbackData{Degrees: deg})
+		ac.CancelHold()
+		ac.clearReadbackError(ReadbackErrorHeading)
+		ac.AssignedHeading = turnedHeading(ac, -deg)
 		ac.TurnDirection = 0
 		ac.ClearedApproach = false // if cleared, giving a heading cancels clearance
 		return nil
@@ -854,18 +1548,13 @@ func (sim *Sim) TurnLeft(callsign string, deg int) error {
 func (sim *Sim) TurnRight(callsign string, deg int) error {
 	if ac, ok := sim.Aircraft[callsign]; !ok {
 		return ErrNoAircraftForCallsign
+	} else if sim.refuseHeadingThroughConvection(ac, turnedHeading(ac, deg)) {
+		return ErrUnableCommand
 	} else {
-		pilotResponse(callsign, "turn %d degrees right", deg)
-
-		if ac.AssignedHeading == 0 {
-			ac.AssignedHeading = int(ac.Heading) + deg
-		} else {
-			ac.AssignedHeading += deg
-		}
-
-		if ac.AssignedHeading > 360 {
-			ac.AssignedHeading -= 360
-		}
+		pilotReadback(callsign, "turn_right_degrees", ReadbackData{Degrees: deg})
+		ac.CancelHold()
+		ac.clearReadbackError(ReadbackErrorHeading)
+		ac.AssignedHeading = turnedHeading(ac, deg)
 		ac.TurnDirection = 0
 		ac.ClearedApproach = false // if cleared, giving a heading cancels clearance
 		return nil
@@ -877,19 +1566,19 @@ func (sim *Sim) AssignSpeed(callsign string, speed int) error {
 		return ErrNoAircraftForCallsign
 	} else {
 		if speed == 0 {
-			pilotResponse(callsign, "cancel speed restrictions")
+			pilotReadback(callsign, "cancel_speed", ReadbackData{})
 		} else if speed < ac.Performance.Speed.Landing {
-			pilotResponse(callsign, "unable--our minimum speed is %d knots", ac.Performance.Speed.Landing)
+			pilotReadback(callsign, "unable_speed_minimum", ReadbackData{Speed: ac.Performance.Speed.Landing})
 			return ErrUnableCommand
 		} else if speed > ac.Performance.Speed.Max {
-			pilotResponse(callsign, "unable--our maximum speed is %d knots", ac.Performance.Speed.Max)
+			pilotReadback(callsign, "unable_speed_maximum", ReadbackData{Speed: ac.Performance.Speed.Max})
 			return ErrUnableCommand
 		} else if ac.ClearedApproach {
-			pilotResponse(callsign, "%d knots until 5 mile final", speed)
+			pilotReadback(callsign, "speed_until_final", ReadbackData{Speed: speed})
 		} else if speed == ac.AssignedSpeed {
-			pilotResponse(callsign, "we'll maintain %d knots", speed)
+			pilotReadback(callsign, "speed_already_assigned", ReadbackData{Speed: speed})
 		} else {
-			pilotResponse(callsign, "maintain %d knots", speed)
+			pilotReadback(callsign, "maintain_speed", ReadbackData{Speed: speed})
 		}
 
 		if ac.AssignedAltitude != 0 {
@@ -911,11 +1600,17 @@ func (sim *Sim) DirectFix(callsign string, fix string) error {
 		// Look for the fix in the waypoints in the flight plan.
 		for i, wp := range ac.Waypoints {
 			if fix == wp.Fix {
+				if sim.refuseDirectThroughConvection(ac, fix, wp.Location) {
+					return ErrUnableCommand
+				}
+				ac.CancelHold()
+				ac.CancelWeatherDeviation()
+				ac.clearReadbackError(ReadbackErrorHeading)
 				ac.Waypoints = ac.Waypoints[i:]
 				if len(ac.Waypoints) > 0 {
 					ac.WaypointUpdate(wp)
 				}
-				pilotResponse(callsign, "direct %s", fix)
+				pilotReadback(callsign, "direct", ReadbackData{Fix: fix})
 				return nil
 			}
 		}
@@ -924,83 +1619,603 @@ func (sim *Sim) DirectFix(callsign string, fix string) error {
 			for _, route := range ac.Approach.Waypoints {
 				for _, wp := range route {
 					if wp.Fix == fix {
+						ac.CancelHold()
+						ac.CancelWeatherDeviation()
+						ac.clearReadbackError(ReadbackErrorHeading)
 						ac.Waypoints = []Waypoint{wp}
 						if len(ac.Waypoints) > 0 {
 							ac.WaypointUpdate(wp)
 						}
-						pilotResponse(callsign, "direct %s", fix)
+						pilotReadback(callsign, "direct", ReadbackData{Fix: fix})
 						return nil
 					}
 				}
 			}
 		}
 
+		if err := sim.suggestFix(callsign, fix, true); err != nil {
+			return err
+		}
 		return fmt.Errorf("%s: fix not found in route", fix)
 	}
 }
 
-func (sim *Sim) getApproach(callsign string, approach string) (*Approach, *Aircraft, error) {
+// CrossFixAt tells the aircraft to cross the given fix in its route at
+// the given altitude and/or speed; either may be zero if it's not part of
+// the restriction. The aircraft plans its own descent to meet it.
+func (sim *Sim) CrossFixAt(callsign string, fix string, altitude int, speed int) error {
+	return sim.crossFix(callsign, fix, altitude, speed, false)
+}
+
+// CrossFixAtOrAbove is like CrossFixAt, but the altitude restriction is
+// at or above the given altitude.
+func (sim *Sim) CrossFixAtOrAbove(callsign string, fix string, altitude int, speed int) error {
+	return sim.crossFix(callsign, fix, altitude, speed, true)
+}
+
+func (sim *Sim) crossFix(callsign string, fix string, altitude int, speed int, orAbove bool) error {
 	ac, ok := sim.Aircraft[callsign]
 	if !ok {
-		return nil, nil, ErrNoAircraftForCallsign
-	}
-	fp := ac.FlightPlan
-	if fp == nil {
-		return nil, nil, ErrNoFlightPlan
+		return ErrNoAircraftForCallsign
+	} else if altitude == 0 && speed == 0 {
+		return ErrInvalidCommandSyntax
 	}
 
-	ap, ok := scenarioGroup.Airports[fp.ArrivalAirport]
-	if !ok {
-		lg.Errorf("Can't find TRACON airport %s for %s approach for %s", fp.ArrivalAirport, approach, callsign)
-		return nil, nil, ErrArrivalAirportUnknown
+	fix = strings.ToUpper(fix)
+	idx := FindIf(ac.Waypoints, func(wp Waypoint) bool { return wp.Fix == fix })
+	if idx == -1 {
+		return fmt.Errorf("%s: fix not found in route", fix)
 	}
-
-	for name, appr := range ap.Approaches {
-		if name == approach {
-			return &appr, ac, nil
+	if em := ac.Emergency; em != nil && em.MaxAltitude != 0 && altitude > em.MaxAltitude {
+		pilotReadback(callsign, "unable_altitude_emergency", ReadbackData{Altitude: em.MaxAltitude})
+		return ErrUnableCommand
+	}
+
+	// The waypoints may be shared with other aircraft flying the same
+	// route, so make a copy before modifying them.
+	ac.Waypoints = DuplicateSlice(ac.Waypoints)
+	wp := &ac.Waypoints[idx]
+
+	var r []string
+	if altitude != 0 {
+		ac.CancelVia()
+		ac.clearReadbackError(ReadbackErrorAltitude)
+		wp.Altitude, wp.MinAltitude, wp.MaxAltitude = 0, 0, 0
+		if orAbove {
+			// Climb to it now if need be; otherwise the aircraft
+			// already meets the restriction.
+			wp.MinAltitude = altitude
+			if ac.AssignedAltitude != 0 && ac.AssignedAltitude < altitude {
+				ac.AssignedAltitude = altitude
+			} else if ac.AssignedAltitude == 0 && ac.Altitude < float32(altitude) {
+				ac.AssignedAltitude, ac.CrossingAltitude = altitude, 0
+			}
+			r = append(r, fmt.Sprintf("at or above %d", altitude))
+		} else {
+			// vnavDescent plans the descent; climbs start once the fix
+			// is next (see WaypointUpdate).
+			wp.Altitude = altitude
+			ac.AssignedAltitude, ac.AssignedAltitudeAfterSpeed, ac.CrossingAltitude = 0, 0, 0
+			if idx == 0 {
+				ac.CrossingAltitude = altitude
+			}
+			r = append(r, fmt.Sprintf("at %d", altitude))
 		}
 	}
-	return nil, nil, ErrUnknownApproach
+	if speed != 0 {
+		wp.Speed, wp.MinSpeed, wp.MaxSpeed = speed, 0, 0
+		ac.AssignedSpeed, ac.AssignedSpeedAfterAltitude, ac.CrossingSpeed = 0, 0, 0
+		if idx == 0 {
+			ac.CrossingSpeed = speed
+		}
+		r = append(r, fmt.Sprintf("at %d knots", speed))
+	}
+
+	lg.Printf("%s: cross %s %s", callsign, fix, strings.Join(r, ", "))
+	pilotReadback(callsign, "cross_fix", ReadbackData{Fix: fix, Restriction: strings.Join(r, ", ")})
+	return nil
 }
 
-func (sim *Sim) ExpectApproach(callsign string, approach string) error {
-	ap, ac, err := sim.getApproach(callsign, approach)
-	if err != nil {
-		return err
+// runCrossFixCommand handles crossing restriction commands, which are
+// of the form FIX/A110 for "cross FIX at 11,000", with "A110+" for at or
+// above, and FIX/S250 for 250 knots; both may be given, as in
+// FIX/A110/S250.
+func (sim *Sim) runCrossFixCommand(callsign string, command string) error {
+	f := strings.Split(command, "/")
+	altitude, speed, orAbove := 0, 0, false
+	for _, r := range f[1:] {
+		if len(r) < 2 {
+			return ErrInvalidCommandSyntax
+		}
+		switch r[0] {
+		case 'A':
+			orAbove = strings.HasSuffix(r, "+")
+			if alt, err := strconv.Atoi(strings.TrimSuffix(r[1:], "+")); err != nil || alt <= 0 {
+				return ErrInvalidCommandParameter
+			} else {
+				altitude = 100 * alt
+			}
+		case 'S':
+			if spd, err := strconv.Atoi(r[1:]); err != nil || spd <= 0 {
+				return ErrInvalidCommandParameter
+			} else {
+				speed = spd
+			}
+		default:
+			return ErrInvalidCommandSyntax
+		}
 	}
 
-	ac.Approach = ap
-	pilotResponse(callsign, "we'll expect the "+ap.FullName+" approach")
-
-	return nil
+	if orAbove {
+		return sim.CrossFixAtOrAbove(callsign, f[0], altitude, speed)
+	}
+	return sim.CrossFixAt(callsign, f[0], altitude, speed)
 }
 
-func (sim *Sim) ClearedApproach(callsign string, approach string) error {
-	ap, ac, err := sim.getApproach(callsign, approach)
-	if err != nil {
-		return err
+// suggestFix returns a SuggestionError if there's a fix with a name close
+// to the given one; the fixes in the aircraft's route and approach are
+// preferred, followed by the scenario's fixes and then nearby fixes and
+// navaids from the database, unless routeOnly is set.
+func (sim *Sim) suggestFix(callsign string, fix string, routeOnly bool) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return nil
 	}
+	fix = strings.ToUpper(fix)
 
-	response := ""
-	if ac.Approach == nil {
-		// allow it anyway...
-		response = "you never told us to expect an approach, but ok, cleared " + ap.FullName
-		ac.Approach = ap
+	var route []string
+	for _, wp := range ac.Waypoints {
+		route = append(route, wp.Fix)
 	}
-	if ac.Approach.FullName != ap.FullName {
-		pilotResponse(callsign, "but you cleared us for the "+ac.Approach.FullName+" approach...")
-		return ErrClearedForUnexpectedApproach
+	if ac.Approach != nil {
+		for _, wps := range ac.Approach.Waypoints {
+			for _, wp := range wps {
+				route = append(route, wp.Fix)
+			}
+		}
 	}
-	if ac.ClearedApproach {
-		pilotResponse(callsign, "you already cleared us for the "+ap.FullName+" approach...")
+	if s, ok := closestMatch(fix, route, maxSuggestionDistance(fix)); ok {
+		return &SuggestionError{Name: fix, Suggestion: s, Err: ErrUnknownFix}
+	}
+	if routeOnly {
 		return nil
 	}
 
-	directApproachFix := false
-	var remainingApproachWaypoints []Waypoint
-	if ac.AssignedHeading == 0 && len(ac.Waypoints) > 0 {
-		// Is the aircraft cleared direct to a waypoint on the approach?
-		for _, approach := range ap.Waypoints {
+	var nearby []string
+	for name, n := range database.Navaids {
+		if nmdistance2ll(n.Location, ac.Position) < fixSuggestionRadius {
+			nearby = append(nearby, name)
+		}
+	}
+	for name, f := range database.Fixes {
+		if nmdistance2ll(f.Location, ac.Position) < fixSuggestionRadius {
+			nearby = append(nearby, name)
+		}
+	}
+	sort.Strings(nearby)
+	others := append(SortedMapKeys(scenarioGroup.Fixes), nearby...)
+	if s, ok := closestMatch(fix, others, maxSuggestionDistance(fix)); ok {
+		return &SuggestionError{Name: fix, Suggestion: s, Err: ErrUnknownFix}
+	}
+	return nil
+}
+
+// AssignVectors takes a path drawn by the controller (e.g., a downwind,
+// base, and final) and has the aircraft fly it. Each vertex of the path
+// becomes a waypoint; after the last one, the aircraft is left flying
+// the heading of the final segment so that it can then be cleared for
+// the approach and intercept the localizer. As with a heading, the
+// vectors cancel any approach clearance it already has.
+func (sim *Sim) AssignVectors(callsign string, route []Point2LL) error {
+	if sim.remote != nil {
+		sim.remote.AssignVectors(callsign, route)
+		return nil
+	}
+	if ac, ok := sim.Aircraft[callsign]; !ok {
+		return ErrNoAircraftForCallsign
+	} else if len(route) == 0 {
+		return ErrInvalidVectorRoute
+	} else {
+		var headings []string
+		var waypoints []Waypoint
+		prev, hdg := ac.Position, 0
+		for i, p := range route {
+			hdg = int(headingp2ll(prev, p, scenarioGroup.MagneticVariation) + 0.5)
+			if hdg <= 0 {
+				hdg += 360
+			}
+			headings = append(headings, fmt.Sprintf("%03d", hdg))
+
+			waypoints = append(waypoints, Waypoint{
+				Fix:      fmt.Sprintf("_VECTOR%d", i+1),
+				Location: p,
+			})
+			prev = p
+		}
+		// Keep flying the heading of the last segment after reaching its
+		// end.
+		waypoints[len(waypoints)-1].Heading = hdg
+
+		// As with a heading, vectors cancel an approach clearance.
+		ac.ClearedApproach = false
+		ac.Waypoints = waypoints
+		ac.WaypointUpdate(ac.Waypoints[0])
+
+		pilotReadback(callsign, "vectors", ReadbackData{Headings: headings})
+		return nil
+	}
+}
+
+// RunAircraftCommands parses and executes the given whitespace-separated
+// control commands (e.g., "D50 H270 S210") for the specified aircraft.
+// Commands are run in order; if one fails, the error is returned along
+// with the commands that were not executed, starting with the one that
+// failed.
+func (sim *Sim) RunAircraftCommands(callsign string, cmds string) ([]string, error) {
+	if sim.remote != nil {
+		sim.remote.RunAircraftCommands(callsign, cmds)
+		return nil, nil
+	}
+	remaining, err := sim.runAircraftCommands(sim.Scenario.Callsign, callsign, cmds, nil)
+	sim.scoreCommands(cmds, remaining, err)
+	sim.examAction(callsign, err, "%s", cmds)
+	return remaining, err
+}
+
+// runAircraftCommands runs the commands issued by the given controller,
+// which is either the user or a remote controller. If permitted is
+// non-nil, it is called with the aircraft and the commands aren't run if
+// it returns an error.
+func (sim *Sim) runAircraftCommands(controller string, callsign string, cmds string, permitted func(*Aircraft) error) ([]string, error) {
+	commands := strings.Fields(cmds)
+	if ac, ok := sim.Aircraft[callsign]; ok && permitted != nil {
+		if err := permitted(ac); err != nil {
+			return commands, err
+		}
+	}
+	sim.scoreInstructions(callsign)
+	if ac, ok := sim.Aircraft[callsign]; ok && ac.LiveADSB {
+		return commands, ErrUncontrollableAircraft
+	} else if ok && ac.Emergency != nil && ac.Emergency.Type == EmergencyRadioFailure &&
+		!(len(commands) > 0 && strings.HasPrefix(commands[0], "EMERG")) {
+		return commands, ErrNoRadioContact
+	}
+	for i, command := range commands {
+		if err := sim.runOneAircraftCommand(controller, callsign, command); err != nil {
+			return commands[i:], err
+		}
+	}
+	return nil, nil
+}
+
+// Probability that an aircraft with a similar callsign takes a clearance
+// that wasn't meant for it.
+const similarCallsignConfusionProb = 0.1
+
+// SimilarCallsignsOnFrequency returns the callsigns of the other aircraft
+// tracked by the user that have callsigns similar to the given one. It's
+// called for each aircraft every frame, so the pairs are only found once
+// a second.
+func (sim *Sim) SimilarCallsignsOnFrequency(callsign string) []string {
+	if now := time.Now(); now.Sub(sim.similarOnFrequencyTime) >= time.Second {
+		sim.similarOnFrequencyTime = now
+		sim.similarOnFrequency = make(map[string][]string)
+
+		var tracked []string
+		for _, cs := range SortedMapKeys(sim.Aircraft) {
+			if sim.Aircraft[cs].TrackingController == sim.Callsign() {
+				tracked = append(tracked, cs)
+			}
+		}
+		for i, cs0 := range tracked {
+			for _, cs1 := range tracked[i+1:] {
+				if SimilarCallsigns(cs0, cs1) {
+					sim.similarOnFrequency[cs0] = append(sim.similarOnFrequency[cs0], cs1)
+					sim.similarOnFrequency[cs1] = append(sim.similarOnFrequency[cs1], cs0)
+				}
+			}
+		}
+	}
+	return sim.similarOnFrequency[callsign]
+}
+
+// ClearanceRecipient returns the callsign of the aircraft that acts on the
+// given commands issued by the user to the specified aircraft and the
+// commands to run. Usually it's that aircraft, but if there are aircraft
+// with similar callsigns on the frequency, one of them may occasionally
+// take the clearance instead. A leading "!" in the commands emphasizes
+// the callsign ("caution, similar callsign"), which prevents that; it is
+// removed from the returned commands.
+//
+// This is only for clearances that the user issues in the STARS pane,
+// by keyboard or by voice; commands from the API and from multiplayer
+// clients always go to the aircraft they're given for.
+func (sim *Sim) ClearanceRecipient(callsign string, cmds string) (string, string) {
+	if strings.HasPrefix(cmds, "!") {
+		return callsign, strings.TrimPrefix(cmds, "!")
+	}
+
+	for _, cmd := range strings.Fields(cmds) {
+		if cmd == "?" || cmd == "X" || cmd == "REL" || cmd == "HREL" || strings.HasPrefix(cmd, "EMERG") {
+			// Not actually transmitted on the frequency.
+			return callsign, cmds
+		}
+	}
+
+	similar := FilterSlice(sim.SimilarCallsignsOnFrequency(callsign), func(cs string) bool {
+		_, ok := sim.Aircraft[cs]
+		return ok
+	})
+	if len(similar) == 0 || rand.Float32() >= similarCallsignConfusionProb {
+		return callsign, cmds
+	}
+
+	other := Sample(similar)
+	if sim.recording != nil {
+		sim.recording.AddEvent(SessionEventSimilarCallsign, sim.Aircraft[other], sim.CurrentTime(),
+			"%s took the clearance for %s", other, callsign)
+	}
+	return other, cmds
+}
+
+// checkSimilarCallsigns records a session event for each pair of
+// aircraft with similar callsigns that are newly on the user's frequency.
+func (sim *Sim) checkSimilarCallsigns(now time.Time) {
+	if sim.similarCallsigns == nil {
+		sim.similarCallsigns = make(map[[2]string]interface{})
+	}
+
+	for _, cs0 := range SortedMapKeys(sim.Aircraft) {
+		for _, cs1 := range sim.SimilarCallsignsOnFrequency(cs0) {
+			if cs1 < cs0 {
+				continue
+			}
+			key := [2]string{cs0, cs1}
+			if _, ok := sim.similarCallsigns[key]; !ok {
+				sim.similarCallsigns[key] = nil
+				sim.recording.AddEvent(SessionEventSimilarCallsign, sim.Aircraft[cs0], now,
+					"%s/%s similar callsigns on frequency", cs0, cs1)
+			}
+		}
+	}
+}
+
+func (sim *Sim) runOneAircraftCommand(controller string, callsign string, command string) error {
+	if strings.HasPrefix(command, "RWY") {
+		return sim.AssignArrivalRunway(callsign, command[3:])
+	}
+	if strings.HasPrefix(command, "HOLD") || strings.HasPrefix(command, "EFC") {
+		return sim.runHoldCommand(callsign, command)
+	}
+	if strings.HasPrefix(command, "SQ") {
+		return sim.runSquawkCommand(callsign, command)
+	}
+	if command == "ID" {
+		return sim.radarIdentify(controller, callsign)
+	}
+	if command == "TS" {
+		return sim.terminateServices(controller, callsign)
+	}
+	if command == "REL" {
+		return sim.ReleaseDeparture(callsign)
+	}
+	if command == "HREL" {
+		return sim.HoldDeparture(callsign)
+	}
+	if command == "PRI" {
+		return sim.PriorityHandling(callsign)
+	}
+	if command[0] == 'C' && strings.Contains(command, "/") {
+		return sim.runCrossFixCommand(callsign, command[1:])
+	}
+	if command == "WXA" {
+		return sim.ApproveWeatherDeviation(callsign)
+	}
+	if command == "WXD" {
+		return sim.DenyWeatherDeviation(callsign)
+	}
+	if strings.HasPrefix(command, "WD") && len(command) > 2 {
+		return sim.DirectWhenAble(callsign, command[2:])
+	}
+	if command == "PIREP" {
+		return sim.AdvisePIREPs(callsign)
+	}
+	if command == "DVS" {
+		return sim.DescendViaSTAR(callsign)
+	}
+	if command == "CVS" {
+		return sim.ClimbViaSID(callsign)
+	}
+	if strings.HasPrefix(command, "EMERG") && *devmode {
+		return sim.TriggerEmergency(callsign, command[5:])
+	}
+
+	// Altitude assignments, given in hundreds of feet; a trailing "!"
+	// overrides the minimum altitude check.
+	assignAltitude := func(s string) error {
+		override := strings.HasSuffix(s, "!")
+		if alt, err := strconv.Atoi(strings.TrimSuffix(s, "!")); err != nil {
+			return ErrInvalidCommandParameter
+		} else if err := sim.checkAssignedAltitude(callsign, 100*alt, override); err != nil {
+			return err
+		} else {
+			return sim.AssignAltitude(callsign, 100*alt)
+		}
+	}
+
+	switch command[0] {
+	case 'D':
+		// Is it an altitude?
+		if len(command) > 1 && command[1] >= '0' && command[1] <= '9' {
+			if alt, err := strconv.Atoi(strings.TrimSuffix(command[1:], "!")); err != nil || alt > 390 {
+				return ErrInvalidCommandParameter
+			}
+			return assignAltitude(command[1:])
+		} else if _, ok := scenarioGroup.Locate(string(command[1:])); ok {
+			return sim.DirectFix(callsign, command[1:])
+		} else if err := sim.suggestFix(callsign, command[1:], false); err != nil {
+			return err
+		} else {
+			return ErrInvalidCommandParameter
+		}
+
+	case 'H':
+		if hdg, err := strconv.Atoi(command[1:]); err != nil || hdg > 360 {
+			return ErrInvalidCommandParameter
+		} else {
+			return sim.AssignHeading(callsign, hdg, 0)
+		}
+
+	case 'L', 'R':
+		if l := len(command); l > 2 && command[l-1] == 'D' {
+			// turn left/right x degrees
+			if deg, err := strconv.Atoi(command[1 : l-1]); err != nil {
+				return ErrInvalidCommandParameter
+			} else if command[0] == 'L' {
+				return sim.TurnLeft(callsign, deg)
+			} else {
+				return sim.TurnRight(callsign, deg)
+			}
+		} else {
+			// fly heading...
+			if hdg, err := strconv.Atoi(command[1:]); err != nil || hdg > 360 {
+				return ErrInvalidCommandParameter
+			} else if command[0] == 'L' {
+				return sim.AssignHeading(callsign, hdg, -1)
+			} else {
+				return sim.AssignHeading(callsign, hdg, 1)
+			}
+		}
+
+	case 'C', 'A':
+		isAllNumbers := func(s string) bool {
+			for _, ch := range s {
+				if ch < '0' || ch > '9' {
+					return false
+				}
+			}
+			return true
+		}
+		if command[0] == 'C' && len(command) > 2 && !isAllNumbers(strings.TrimSuffix(command[1:], "!")) {
+			// Cleared approach.
+			return sim.ClearedApproach(callsign, command[1:])
+		} else {
+			// Otherwise look for an altitude
+			return assignAltitude(command[1:])
+		}
+
+	case 'S':
+		if len(command) > 1 {
+			if kts, err := strconv.Atoi(command[1:]); err != nil {
+				return ErrInvalidCommandParameter
+			} else {
+				return sim.AssignSpeed(callsign, kts)
+			}
+		}
+		return nil
+
+	case 'E':
+		// Expect approach.
+		if len(command) > 1 {
+			return sim.ExpectApproach(callsign, command[1:])
+		}
+		return nil
+
+	case '?':
+		return sim.PrintInfo(callsign)
+
+	case 'X':
+		return sim.DeleteAircraft(callsign)
+
+	default:
+		return ErrInvalidCommandSyntax
+	}
+}
+
+func (sim *Sim) getApproach(callsign string, approach string) (*Approach, *Aircraft, error) {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return nil, nil, ErrNoAircraftForCallsign
+	}
+	fp := ac.FlightPlan
+	if fp == nil {
+		return nil, nil, ErrNoFlightPlan
+	}
+
+	ap, ok := scenarioGroup.Airports[fp.ArrivalAirport]
+	if !ok {
+		lg.Errorf("Can't find TRACON airport %s for %s approach for %s", fp.ArrivalAirport, approach, callsign)
+		return nil, nil, ErrArrivalAirportUnknown
+	}
+
+	for name, appr := range ap.Approaches {
+		if name == approach {
+			return &appr, ac, nil
+		}
+	}
+	if s, ok := closestMatch(approach, SortedMapKeys(ap.Approaches), maxSuggestionDistance(approach)); ok {
+		return nil, nil, &SuggestionError{Name: approach, Suggestion: s, Err: ErrUnknownApproach}
+	}
+	return nil, nil, ErrUnknownApproach
+}
+
+func (sim *Sim) ExpectApproach(callsign string, approach string) error {
+	ap, ac, err := sim.getApproach(callsign, approach)
+	if err != nil {
+		return err
+	}
+
+	ac.Approach = ap
+	pilotReadback(callsign, "expect_approach", ReadbackData{Approach: ap.FullName})
+
+	return nil
+}
+
+func (sim *Sim) ClearedApproach(callsign string, approach string) error {
+	ap, ac, err := sim.getApproach(callsign, approach)
+	if err != nil {
+		return err
+	}
+
+	response := "cleared_approach"
+	if ac.Approach == nil {
+		// allow it anyway...
+		response = "cleared_approach_not_expected"
+		ac.Approach = ap
+	}
+	if ac.Approach.FullName != ap.FullName {
+		pilotReadback(callsign, "cleared_wrong_approach", ReadbackData{Approach: ac.Approach.FullName})
+		return ErrClearedForUnexpectedApproach
+	}
+	if ac.ClearedApproach {
+		pilotReadback(callsign, "already_cleared_approach", ReadbackData{Approach: ap.FullName})
+		return nil
+	}
+
+	directApproachFix := false
+	var remainingApproachWaypoints []Waypoint
+	if ac.Hold != nil {
+		// Aircraft in a hold fly the approach from the holding fix, which
+		// must be on it; the headings they're flying in the hold aren't
+		// vectors to intercept the approach.
+		for _, approach := range ap.Waypoints {
+			if i := FindIf(approach, func(wp Waypoint) bool { return wp.Fix == ac.Hold.Fix }); i != -1 {
+				directApproachFix = true
+				remainingApproachWaypoints = approach[i+1:]
+				ac.Waypoints = []Waypoint{approach[i]}
+				ac.WaypointUpdate(approach[i])
+				break
+			}
+		}
+		if !directApproachFix {
+			pilotReadback(callsign, "need_approach_fix", ReadbackData{})
+			return nil
+		}
+		ac.CancelHold()
+		ac.clearReadbackError(ReadbackErrorHeading)
+	} else if ac.AssignedHeading == 0 && len(ac.Waypoints) > 0 {
+		// Is the aircraft cleared direct to a waypoint on the approach?
+		for _, approach := range ap.Waypoints {
 			for i, wp := range approach {
 				if wp.Fix == ac.Waypoints[0].Fix {
 					directApproachFix = true
@@ -1016,7 +2231,7 @@ func (sim *Sim) ClearedApproach(callsign string, approach string) error {
 	if ac.Approach.Type == ILSApproach {
 		if ac.AssignedHeading == 0 {
 			if !directApproachFix {
-				pilotResponse(callsign, "we need either direct or a heading to intercept")
+				pilotReadback(callsign, "need_intercept", ReadbackData{})
 				return nil
 			} else {
 				if remainingApproachWaypoints != nil {
@@ -1030,7 +2245,7 @@ func (sim *Sim) ClearedApproach(callsign string, approach string) error {
 	} else {
 		// RNAV
 		if !directApproachFix {
-			pilotResponse(callsign, "we need direct to a fix on the approach...")
+			pilotReadback(callsign, "need_approach_fix", ReadbackData{})
 			return nil
 		}
 
@@ -1045,8 +2260,9 @@ func (sim *Sim) ClearedApproach(callsign string, approach string) error {
 	ac.AssignedSpeed = 0
 	ac.CrossingSpeed = int(ac.IAS)
 	ac.ClearedApproach = true
+	ac.Hold = nil
 
-	pilotResponse(callsign, response+"cleared "+ap.FullName+" approach")
+	pilotReadback(callsign, response, ReadbackData{Approach: ap.FullName})
 
 	lg.Printf("%s", spew.Sdump(ac))
 
@@ -1080,154 +2296,228 @@ func (sim *Sim) PrintInfo(callsign string) error {
 	return nil
 }
 
-func (sim *Sim) DeleteAircraft(callsign string) error {
-	if ac, ok := sim.Aircraft[callsign]; !ok {
-		return ErrNoAircraftForCallsign
-	} else {
-		eventStream.Post(&RemovedAircraftEvent{ac: ac})
-		delete(sim.Aircraft, callsign)
-		return nil
+// RunwaysInUse returns a description of the departure and arrival
+// runways in use at each of the scenario's airports.
+func (sim *Sim) RunwaysInUse() []string {
+	var items []string
+	for _, ap := range sim.Scenario.DepartureAirports() {
+		var r []string
+		for _, rwy := range sim.Scenario.DepartureRunways {
+			if rwy.Airport == ap && Find(r, rwy.Runway) == -1 {
+				r = append(r, rwy.Runway)
+			}
+		}
+		items = append(items, fmt.Sprintf("%s departing %s", ap, strings.Join(r, ", ")))
 	}
+	for _, ap := range sim.Scenario.ArrivalAirports() {
+		var r []string
+		for _, rwy := range sim.Scenario.ArrivalRunways {
+			if rwy.Airport == ap {
+				r = append(r, rwy.Runway)
+			}
+		}
+		items = append(items, fmt.Sprintf("%s landing %s", ap, strings.Join(r, ", ")))
+	}
+	return items
 }
 
-func (sim *Sim) IsPaused() bool {
-	return sim.Paused
-}
-
-func (sim *Sim) TogglePause() {
-	sim.Paused = !sim.Paused
-	sim.lastUpdateTime = time.Now() // ignore time passage...
-}
-
-func (sim *Sim) ActivateSettingsWindow() {
-	sim.showSettings = true
+// ReliefBriefingSection is one of the items of a position relief
+// briefing; Items holds the individual lines to be briefed.
+type ReliefBriefingSection struct {
+	Title string
+	Items []string
 }
 
-func (sim *Sim) DrawSettingsWindow() {
-	if !sim.showSettings {
-		return
+// ReliefBriefing summarizes the current state of the position in the
+// order of the standard relief briefing checklist (FAA Order 7110.65
+// 2-1-24 and appendix): weather and airport conditions, runways in use,
+// restrictions, traffic, and coordination in progress.
+func (sim *Sim) ReliefBriefing() []ReliefBriefingSection {
+	if sim.Scenario == nil {
+		return nil
 	}
+	var sections []ReliefBriefingSection
 
-	imgui.BeginV("Simulation Settings", &sim.showSettings, imgui.WindowFlagsAlwaysAutoResize)
-
-	if *devmode {
-		imgui.SliderFloatV("Simulation speed", &sim.SimRate, 1, 100, "%.1f", 0)
-	} else {
-		imgui.SliderFloatV("Simulation speed", &sim.SimRate, 1, 10, "%.1f", 0)
+	// Weather
+	wx := ReliefBriefingSection{Title: "Weather"}
+	airports := make(map[string]interface{})
+	for _, ap := range sim.Scenario.AllAirports() {
+		airports[ap] = nil
 	}
-
-	if imgui.BeginComboV("UI Font Size", fmt.Sprintf("%d", globalConfig.UIFontSize), imgui.ComboFlagsHeightLarge) {
-		sizes := make(map[int]interface{})
-		for fontid := range fonts {
-			if fontid.Name == "Roboto Regular" {
-				sizes[fontid.Size] = nil
-			}
+	for _, ap := range SortedMapKeys(airports) {
+		if metar := sim.GetMETAR(ap); metar != nil {
+			wx.Items = append(wx.Items, metar.String())
 		}
-		for _, size := range SortedMapKeys(sizes) {
-			if imgui.SelectableV(fmt.Sprintf("%d", size), size == globalConfig.UIFontSize, 0, imgui.Vec2{}) {
-				globalConfig.UIFontSize = size
-				ui.font = GetFont(FontIdentifier{Name: "Roboto Regular", Size: globalConfig.UIFontSize})
-			}
-		}
-		imgui.EndCombo()
 	}
-	if imgui.BeginComboV("STARS DCB Font Size", fmt.Sprintf("%d", globalConfig.DCBFontSize), imgui.ComboFlagsHeightLarge) {
-		sizes := make(map[int]interface{})
-		for fontid := range fonts {
-			if fontid.Name == "Inconsolata Condensed Regular" {
-				sizes[fontid.Size] = nil
+	w := sim.Wind
+	if w.Gust > w.Speed {
+		wx.Items = append(wx.Items, fmt.Sprintf("Surface wind %03d at %d gusting %d", w.Direction, w.Speed, w.Gust))
+	} else {
+		wx.Items = append(wx.Items, fmt.Sprintf("Surface wind %03d at %d", w.Direction, w.Speed))
+	}
+	for _, p := range sim.PIREPs {
+		wx.Items = append(wx.Items, p.String())
+	}
+	wx.Items = append(wx.Items, sim.SIGMETDescriptions()...)
+	sections = append(sections, wx)
+
+	// Runways
+	rwys := ReliefBriefingSection{Title: "Runways in use", Items: sim.RunwaysInUse()}
+	sections = append(sections, rwys)
+
+	// Restrictions: these are the traffic management rates in effect
+	// plus the titles of any LOAs/SOPs the scenario provides.
+	restr := ReliefBriefingSection{Title: "Restrictions"}
+	for _, ap := range SortedMapKeys(sim.DepartureRates) {
+		for _, rwy := range SortedMapKeys(sim.DepartureRates[ap]) {
+			for _, cat := range SortedMapKeys(sim.DepartureRates[ap][rwy]) {
+				rate := *sim.DepartureRates[ap][rwy][cat]
+				if cat != "" {
+					restr.Items = append(restr.Items, fmt.Sprintf("%s %s (%s) departures: %d/hour", ap, rwy, cat, rate))
+				} else {
+					restr.Items = append(restr.Items, fmt.Sprintf("%s %s departures: %d/hour", ap, rwy, rate))
+				}
 			}
 		}
-		for _, size := range SortedMapKeys(sizes) {
-			if imgui.SelectableV(fmt.Sprintf("%d", size), size == globalConfig.DCBFontSize, 0, imgui.Vec2{}) {
-				globalConfig.DCBFontSize = size
-			}
+	}
+	for _, group := range SortedMapKeys(sim.ArrivalGroupRates) {
+		for _, ap := range SortedMapKeys(sim.ArrivalGroupRates[group]) {
+			rate := *sim.ArrivalGroupRates[group][ap]
+			restr.Items = append(restr.Items, fmt.Sprintf("%s arrivals via %s: %d/hour", ap, group, rate))
 		}
-		imgui.EndCombo()
 	}
+	for _, ref := range append(DuplicateSlice(scenarioGroup.Reference), sim.Scenario.Reference...) {
+		restr.Items = append(restr.Items, "See "+ref.Title)
+	}
+	sections = append(sections, restr)
 
-	var fsp *FlightStripPane
-	var stars *STARSPane
-	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
-		switch pane := p.(type) {
-		case *FlightStripPane:
-			fsp = pane
-		case *STARSPane:
-			stars = pane
+	// Traffic
+	traffic := ReliefBriefingSection{Title: "Traffic"}
+	var inbound, outbound []string
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if ac.InboundHandoffController == sim.Callsign() {
+			inbound = append(inbound, fmt.Sprintf("%s from %s", callsign, ac.TrackingController))
+		}
+		if ac.TrackingController != sim.Callsign() {
+			continue
+		}
+		if ac.OutboundHandoffController != "" {
+			outbound = append(outbound, fmt.Sprintf("%s to %s", callsign, ac.OutboundHandoffController))
 		}
-	})
 
-	stars.DrawUI()
+		s := fmt.Sprintf("%-8s %03d", callsign, int(ac.Altitude+50)/100)
+		if ac.FlightPlan != nil {
+			s += fmt.Sprintf(" %s %s-%s", ac.FlightPlan.AircraftType,
+				ac.FlightPlan.DepartureAirport, ac.FlightPlan.ArrivalAirport)
+		}
+		var assigned []string
+		if ac.AssignedAltitude != 0 {
+			assigned = append(assigned, fmt.Sprintf("alt %d", ac.AssignedAltitude))
+		}
+		if ac.AssignedHeading != 0 {
+			assigned = append(assigned, fmt.Sprintf("hdg %03d", ac.AssignedHeading))
+		}
+		if ac.AssignedSpeed != 0 {
+			assigned = append(assigned, fmt.Sprintf("spd %d", ac.AssignedSpeed))
+		}
+		if ac.Approach != nil {
+			if ac.ClearedApproach {
+				assigned = append(assigned, "cleared "+ac.Approach.FullName)
+			} else {
+				assigned = append(assigned, "expecting "+ac.Approach.FullName)
+			}
+		}
+		if len(assigned) > 0 {
+			s += ": " + strings.Join(assigned, ", ")
+		}
+		traffic.Items = append(traffic.Items, s)
+	}
+	sections = append(sections, traffic)
 
-	imgui.Separator()
+	// Coordination
+	coord := ReliefBriefingSection{Title: "Coordination in progress"}
+	for _, s := range inbound {
+		coord.Items = append(coord.Items, "Inbound handoff: "+s)
+	}
+	for _, s := range outbound {
+		coord.Items = append(coord.Items, "Outbound handoff: "+s)
+	}
+	sections = append(sections, coord)
 
-	if imgui.CollapsingHeader("Audio") {
-		globalConfig.Audio.DrawUI()
+	return sections
+}
+
+func (sim *Sim) DeleteAircraft(callsign string) error {
+	if sim.remote != nil {
+		sim.remote.DeleteAircraft(callsign)
+		return nil
 	}
-	if fsp != nil && imgui.CollapsingHeader("Flight Strips") {
-		fsp.DrawUI()
+	if ac, ok := sim.Aircraft[callsign]; !ok {
+		return ErrNoAircraftForCallsign
+	} else {
+		eventStream.Post(&RemovedAircraftEvent{ac: ac})
+		delete(sim.Aircraft, callsign)
+		return nil
 	}
-	if imgui.CollapsingHeader("Developer") {
-		if imgui.BeginTableV("GlobalFiles", 4, 0, imgui.Vec2{}, 0) {
-			imgui.TableNextRow()
-			imgui.TableNextColumn()
-			imgui.Text("Scenario:")
-			imgui.TableNextColumn()
-			imgui.Text(globalConfig.DevScenarioFile)
-			imgui.TableNextColumn()
-			if imgui.Button("New...##scenario") {
-				ui.jsonSelectDialog = NewFileSelectDialogBox("Select JSON File", []string{".json"},
-					globalConfig.DevScenarioFile, func(filename string) {
-						globalConfig.DevScenarioFile = filename
-						ui.jsonSelectDialog = nil
-					})
-				ui.jsonSelectDialog.Activate()
-			}
-			imgui.TableNextColumn()
-			if globalConfig.DevScenarioFile != "" && imgui.Button("Clear##scenario") {
-				globalConfig.DevScenarioFile = ""
-			}
+}
 
-			imgui.TableNextRow()
-			imgui.TableNextColumn()
-			imgui.Text("Video maps:")
-			imgui.TableNextColumn()
-			imgui.Text(globalConfig.DevVideoMapFile)
-			imgui.TableNextColumn()
-			if imgui.Button("New...##vid") {
-				ui.jsonSelectDialog = NewFileSelectDialogBox("Select JSON File", []string{".json"},
-					globalConfig.DevVideoMapFile, func(filename string) {
-						globalConfig.DevVideoMapFile = filename
-						ui.jsonSelectDialog = nil
-					})
-				ui.jsonSelectDialog.Activate()
-			}
-			imgui.TableNextColumn()
-			if globalConfig.DevVideoMapFile != "" && imgui.Button("Clear##vid") {
-				globalConfig.DevVideoMapFile = ""
-			}
+func (sim *Sim) IsPaused() bool {
+	return sim.Paused
+}
 
-			imgui.EndTable()
-		}
+func (sim *Sim) TogglePause() {
+	if sim.remote != nil {
+		// The clock picks up the change from the server.
+		sim.remote.SetPaused(!sim.Paused)
+		return
+	}
 
-		if ui.jsonSelectDialog != nil {
-			ui.jsonSelectDialog.Draw()
-		}
+	sim.Paused = !sim.Paused
+	sim.lastUpdateTime = time.Now() // ignore time passage...
+	// Don't immediately auto-pause again after resuming.
+	sim.lastUserInput = time.Now()
+	if sim.Paused {
+		announce("Simulation paused")
+	} else {
+		announce("Simulation resumed")
+	}
+}
+
+// CheckAutoPause pauses the sim if the window has lost focus or if the
+// user has been idle for too long, according to the user's settings.
+func (sim *Sim) CheckAutoPause(p Platform) {
+	if p.HadUserInput() || sim.lastUserInput.IsZero() {
+		sim.lastUserInput = time.Now()
 	}
 
-	imgui.End()
+	focused := p.IsFocused()
+	lostFocus := sim.wasFocused && !focused
+	sim.wasFocused = focused
+
+	// Multiplayer clients don't pause the session for everyone.
+	if sim.Scenario == nil || sim.Paused || sim.remote != nil {
+		return
+	}
+	if globalConfig.PauseOnFocusLoss && lostFocus {
+		sim.TogglePause()
+		lg.Printf("Paused: window lost focus")
+	} else if m := globalConfig.AutoPauseMinutes; m > 0 && time.Since(sim.lastUserInput) > time.Duration(m)*time.Minute {
+		sim.TogglePause()
+		lg.Printf("Paused: no input for %d minutes", m)
+	}
 }
 
 func (sim *Sim) GetWindVector(p Point2LL, alt float32) Point2LL {
 	// TODO: have a better gust model?
-	windKts := sim.Scenario.Wind.Speed
-	if sim.Scenario.Wind.Gust > 0 {
-		windKts += rand.Int31n(sim.Scenario.Wind.Gust)
+	windKts := sim.Wind.Speed
+	if sim.Wind.Gust > sim.Wind.Speed {
+		windKts += rand.Int31n(sim.Wind.Gust - sim.Wind.Speed)
 	}
 
 	// wind.dir is where it's coming from, so +180 to get the vector that
 	// affects the aircraft's course.
-	d := float32(sim.Scenario.Wind.Direction + 180)
+	d := float32(sim.Wind.Direction + 180)
 	vWind := [2]float32{sin(radians(d)), cos(radians(d))}
 	vWind = scale2f(vWind, float32(windKts)/3600)
 	return nm2ll(vWind)
@@ -1250,37 +2540,50 @@ func sampleRateMap(rates map[string]*int32) (string, int) {
 	return result, rateSum
 }
 
-func (sim *Sim) SpawnAircraft() {
-	now := sim.CurrentTime()
+// addAircraft adds a newly-spawned aircraft to the sim, placing it at its
+// first waypoint. It returns false if the aircraft couldn't be added.
+func (sim *Sim) addAircraft(ac *Aircraft) bool {
+	if _, ok := sim.Aircraft[ac.Callsign]; ok {
+		lg.Errorf("%s: already have an aircraft with that callsign!", ac.Callsign)
+		return false
+	}
+	sim.Aircraft[ac.Callsign] = ac
+	ac.ADSBEquipped = rand.Float32() < sim.Scenario.ADSBEquipage
 
-	addAircraft := func(ac *Aircraft) {
-		if _, ok := sim.Aircraft[ac.Callsign]; ok {
-			lg.Errorf("%s: already have an aircraft with that callsign!", ac.Callsign)
-			return
-		}
-		sim.Aircraft[ac.Callsign] = ac
+	ac.RunWaypointCommands(ac.Waypoints[0].Commands)
 
-		ac.RunWaypointCommands(ac.Waypoints[0].Commands)
+	ac.Position = ac.Waypoints[0].Location
+	if ac.Position.IsZero() {
+		lg.Errorf("%s: uninitialized initial waypoint position!", ac.Callsign)
+		return false
+	}
+	ac.Heading = float32(ac.Waypoints[0].Heading)
+	if ac.Heading == 0 { // unassigned, so get the heading from the next fix
+		ac.Heading = headingp2ll(ac.Position, ac.Waypoints[1].Location, scenarioGroup.MagneticVariation)
+	}
+	ac.Waypoints = ac.Waypoints[1:]
 
-		ac.Position = ac.Waypoints[0].Location
-		if ac.Position.IsZero() {
-			lg.Errorf("%s: uninitialized initial waypoint position!", ac.Callsign)
-			return
-		}
-		ac.Heading = float32(ac.Waypoints[0].Heading)
-		if ac.Heading == 0 { // unassigned, so get the heading from the next fix
-			ac.Heading = headingp2ll(ac.Position, ac.Waypoints[1].Location, scenarioGroup.MagneticVariation)
-		}
-		ac.Waypoints = ac.Waypoints[1:]
+	eventStream.Post(&AddedAircraftEvent{ac: ac})
+	return true
+}
 
-		eventStream.Post(&AddedAircraftEvent{ac: ac})
+func (sim *Sim) SpawnAircraft() {
+	now := sim.CurrentTime()
+
+	// With scheduled traffic, candidate spawns are generated at the
+	// highest rate the schedule allows and then thinned out by
+	// acceptScheduledSpawn().
+	rateScale := float32(1)
+	if sim.ScheduledTraffic {
+		rateScale = sim.scheduleMaxFactor()
 	}
+	rateScale *= sim.trafficScale()
 
 	randomWait := func(rate int) time.Duration {
 		if rate == 0 {
 			return 365 * 24 * time.Hour
 		}
-		avgSeconds := 3600 / float32(rate)
+		avgSeconds := 3600 / (rateScale * float32(rate))
 		seconds := lerp(rand.Float32(), .85*avgSeconds, 1.15*avgSeconds)
 		return time.Duration(seconds * float32(time.Second))
 	}
@@ -1289,9 +2592,11 @@ func (sim *Sim) SpawnAircraft() {
 		if now.After(sim.NextArrivalSpawn[group]) {
 			arrivalAirport, rateSum := sampleRateMap(airportRates)
 
-			if ac := sim.SpawnArrival(arrivalAirport, group); ac != nil {
+			if !sim.acceptScheduledSpawn(arrivalAirport, true) || sim.groundStopped(arrivalAirport) {
+				sim.NextArrivalSpawn[group] = now.Add(randomWait(rateSum))
+			} else if ac := sim.SpawnArrival(arrivalAirport, group); ac != nil {
 				ac.FlightPlan.ArrivalAirport = arrivalAirport
-				addAircraft(ac)
+				sim.addAircraft(ac)
 				sim.NextArrivalSpawn[group] = now.Add(randomWait(rateSum))
 			}
 		}
@@ -1310,6 +2615,11 @@ func (sim *Sim) SpawnAircraft() {
 				continue
 			}
 
+			if !sim.acceptScheduledSpawn(airport, false) {
+				sim.NextDepartureSpawn[airport][runway] = now.Add(randomWait(rateSum))
+				continue
+			}
+
 			ap := scenarioGroup.Airports[airport]
 			idx := FindIf(sim.Scenario.DepartureRunways,
 				func(r ScenarioGroupDepartureRunway) bool {
@@ -1322,11 +2632,124 @@ func (sim *Sim) SpawnAircraft() {
 
 			if ac := sim.SpawnDeparture(ap, &sim.Scenario.DepartureRunways[idx]); ac != nil {
 				ac.FlightPlan.DepartureAirport = airport
-				addAircraft(ac)
+				sim.queueDeparture(ac, airport, runway, spawnTime)
 				sim.NextDepartureSpawn[airport][runway] = now.Add(randomWait(rateSum))
 			}
 		}
 	}
+
+	for airport, queues := range sim.DepartureQueues {
+		if sim.groundStopped(airport) {
+			continue
+		}
+		for runway, q := range queues {
+			factor := float32(1)
+			if rs := sim.RunwayState(airport, runway); rs != nil {
+				if rs.Closed {
+					continue
+				}
+				factor = rs.OccupancyFactor()
+			}
+			if ac := q.nextLaunch(now, factor, sim.DepartureReleases); ac != nil {
+				sim.addAircraft(ac)
+			}
+		}
+	}
+}
+
+// queueDeparture adds the given departure to the queue for its runway; it
+// starts taxiing at the given time.
+func (sim *Sim) queueDeparture(ac *Aircraft, airport, runway string, taxiStart time.Time) {
+	if sim.GetAircraft(ac.Callsign) != nil || sim.isQueuedDeparture(ac.Callsign) {
+		lg.Errorf("%s: already have an aircraft with that callsign!", ac.Callsign)
+		return
+	}
+
+	if sim.DepartureQueues == nil {
+		sim.DepartureQueues = make(map[string]map[string]*DepartureQueue)
+	}
+	if sim.DepartureQueues[airport] == nil {
+		sim.DepartureQueues[airport] = make(map[string]*DepartureQueue)
+	}
+	q, ok := sim.DepartureQueues[airport][runway]
+	if !ok {
+		q = &DepartureQueue{}
+		sim.DepartureQueues[airport][runway] = q
+	}
+
+	taxi := minTaxiOut + time.Duration(rand.Float32()*float32(maxTaxiOut-minTaxiOut))
+	ac.DepartureRunway = runway
+	ac.ProposedDepartureTime = taxiStart.Add(taxi)
+	q.Queue = append(q.Queue, &QueuedDeparture{
+		Aircraft:     ac,
+		Airport:      airport,
+		Runway:       runway,
+		ProposedTime: ac.ProposedDepartureTime,
+	})
+	sort.SliceStable(q.Queue, func(i, j int) bool {
+		return q.Queue[i].ProposedTime.Before(q.Queue[j].ProposedTime)
+	})
+}
+
+func (sim *Sim) isQueuedDeparture(callsign string) bool {
+	for _, qd := range sim.GetDepartureQueue() {
+		if qd.Aircraft.Callsign == callsign {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLaunch returns the first aircraft in the queue that is at the
+// runway if enough time has passed since the previous departure, removing
+// it from the queue. Otherwise it returns nil. The runway occupancy time
+// is scaled by the given factor to account for the runway's condition.
+// If needRelease is set, aircraft that haven't been released are skipped
+// so that the ones behind them can go.
+func (q *DepartureQueue) nextLaunch(now time.Time, occupancyFactor float32, needRelease bool) *Aircraft {
+	idx := -1
+	for i, qd := range q.Queue {
+		if now.Before(qd.ProposedTime) {
+			break
+		}
+		if !needRelease || qd.Released {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return nil
+	}
+
+	ac := q.Queue[idx].Aircraft
+	exit := ac.Scratchpad
+	interval := time.Duration(occupancyFactor * float32(departureRunwayOccupancy))
+	if exit != "" && exit == q.LastExit && interval < departureInTrailInterval {
+		interval = departureInTrailInterval
+	}
+	if now.Sub(q.LastLaunch) < interval {
+		return nil
+	}
+
+	q.Queue = append(q.Queue[:idx], q.Queue[idx+1:]...)
+	q.LastLaunch = now
+	q.LastExit = exit
+	return ac
+}
+
+// GetDepartureQueue returns all of the departures that are taxiing out or
+// waiting to depart, sorted by proposed time.
+func (sim *Sim) GetDepartureQueue() []*QueuedDeparture {
+	var queued []*QueuedDeparture
+	for _, queues := range sim.DepartureQueues {
+		for _, q := range queues {
+			queued = append(queued, q.Queue...)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].ProposedTime.Before(queued[j].ProposedTime)
+	})
+	return queued
 }
 
 var badCallsigns map[string]interface{} = map[string]interface{}{
@@ -1410,7 +2833,7 @@ func sampleAircraft(icao, fleet string) *Aircraft {
 	callsign := strings.ToUpper(icao)
 	for {
 		format := "####"
-		if len(al.Callsign.CallsignFormats) > 0 {
+		if len(al.Callsign.CallsignFormats) > 0 && !globalConfig.PrivacyRandomizeCallsigns {
 			format = Sample(al.Callsign.CallsignFormats)
 		}
 		for {
@@ -1472,7 +2895,9 @@ func (sim *Sim) SpawnArrival(airportName string, arrivalGroup string) *Aircraft
 	}
 	arr := arrivals[idx]
 
-	airline := Sample(arr.Airlines[airportName])
+	airlines := arr.Airlines[airportName]
+	airline := airlines[sim.sampleScheduledAirline(airportName,
+		MapSlice(airlines, func(a ArrivalAirline) string { return a.ICAO }))]
 	ac := sampleAircraft(airline.ICAO, airline.Fleet)
 	if ac == nil {
 		return nil
@@ -1504,32 +2929,61 @@ func (sim *Sim) SpawnArrival(airportName string, arrivalGroup string) *Aircraft
 			ac.FlightPlan.Altitude = 39000
 		}
 	}
+	if !ac.Performance.IsJet() {
+		// Turboprops and pistons stay below the jets.
+		dist, east := float32(150), true
+		pDep, depOk := scenarioGroup.Locate(ac.FlightPlan.DepartureAirport)
+		pArr, arrOk := scenarioGroup.Locate(ac.FlightPlan.ArrivalAirport)
+		if depOk && arrOk {
+			dist = nmdistance2ll(pDep, pArr)
+			east = headingp2ll(pDep, pArr, scenarioGroup.MagneticVariation) <= 180
+		}
+		ac.FlightPlan.Altitude = min(ac.FlightPlan.Altitude, ac.Performance.NonJetCruiseAltitude(dist, east))
+	}
 	ac.FlightPlan.Route = arr.Route
 	// Start with the default waypoints for the arrival
 	ac.Waypoints = arr.Waypoints
-	// But if there is a custom route for any of the active runways, switch
-	// to that. Results are undefined if there are multiple matches.
-	for _, aprwy := range sim.Scenario.ArrivalRunways {
-		if wp, ok := arr.RunwayWaypoints[aprwy.Runway]; ok {
-			ac.Waypoints = wp
-			break
-		}
+	// But if there is a custom route for the assigned runway, switch to
+	// that.
+	ac.ArrivalRunway = sim.assignArrivalRunway(ac)
+	if wp, ok := arr.RunwayWaypoints[ac.ArrivalRunway]; ok {
+		ac.Waypoints = wp
+	}
+	// Turboprops and pistons fly their own route, if there is one.
+	if !ac.Performance.IsJet() && len(arr.PropWaypoints) > 0 {
+		ac.Waypoints = arr.PropWaypoints
 	}
 	ac.Altitude = float32(arr.InitialAltitude)
 	ac.IAS = float32(arr.InitialSpeed)
+	if !ac.Performance.IsJet() {
+		ac.Altitude = min(ac.Altitude, float32(ac.FlightPlan.Altitude))
+		ac.IAS = min(ac.IAS, float32(ac.Performance.Speed.Cruise))
+	}
 	ac.CrossingAltitude = arr.ClearedAltitude
 	ac.CrossingSpeed = arr.SpeedRestriction
 	ac.Scratchpad = arr.Scratchpad
+	ap := scenarioGroup.Airports[ac.FlightPlan.ArrivalAirport]
 	if arr.ExpectApproach != "" {
-		if appr, ok := scenarioGroup.Airports[ac.FlightPlan.ArrivalAirport].Approaches[arr.ExpectApproach]; ok {
+		if appr, ok := ap.Approaches[arr.ExpectApproach]; ok {
 			ac.Approach = &appr
 		} else {
 			lg.Errorf("%s: unable to find expected %s approach", ac.Callsign, arr.ExpectApproach)
 		}
 	}
+	// Expect an approach to the assigned runway if the arrival's approach
+	// is to a different one.
+	if ac.ArrivalRunway != "" && (ac.Approach == nil || approachRunway(ac.Approach) != ac.ArrivalRunway) {
+		prefer := ApproachType(ILSApproach)
+		if ac.Approach != nil {
+			prefer = ac.Approach.Type
+		}
+		if appr := approachForRunway(ap, ac.ArrivalRunway, prefer); appr != nil {
+			ac.Approach = appr
+		}
+	}
 
 	if rand.Float32() < sim.GoAroundRate {
-		sim.WillGoAround[ac.Callsign] = nil
+		sim.WillGoAround[ac.Callsign] = GoAroundUnstated
 	}
 
 	return ac
@@ -1572,12 +3026,28 @@ func (sim *Sim) SpawnDeparture(ap *Airport, rwy *ScenarioGroupDepartureRunway) *
 
 	rwy.lastDeparture = dep
 
-	airline := Sample(dep.Airlines)
+	airline := dep.Airlines[sim.sampleScheduledAirline(rwy.Airport,
+		MapSlice(dep.Airlines, func(a DepartureAirline) string { return a.ICAO }))]
 	ac := sampleAircraft(airline.ICAO, airline.Fleet)
 
 	exitRoute := rwy.exitRoutes[dep.Exit]
+	if r, ok := ap.PropDepartureRoutes[rwy.Runway][dep.Exit]; ok && !ac.Performance.IsJet() {
+		exitRoute = r
+	}
 	ac.Waypoints = DuplicateSlice(exitRoute.Waypoints)
-	ac.Waypoints = append(ac.Waypoints, dep.routeWaypoints...)
+	if dep.IsTEC() {
+		// TEC flights aren't deleted at the end of the exit route but
+		// continue to their destination and fly its approach.
+		for i := range ac.Waypoints {
+			ac.Waypoints[i].Commands = FilterSlice(ac.Waypoints[i].Commands,
+				func(c WaypointCommand) bool { return c != WaypointCommandDelete })
+		}
+		ac.Waypoints = append(ac.Waypoints, dep.TECWaypoints...)
+		appr := scenarioGroup.Airports[dep.Destination].Approaches[dep.ExpectApproach]
+		ac.Approach = &appr
+	} else {
+		ac.Waypoints = append(ac.Waypoints, dep.routeWaypoints...)
+	}
 
 	ac.FlightPlan.Route = exitRoute.InitialRoute + " " + dep.Route
 	ac.FlightPlan.ArrivalAirport = dep.Destination
@@ -1589,10 +3059,19 @@ func (sim *Sim) SpawnDeparture(ap *Airport, rwy *ScenarioGroupDepartureRunway) *
 	} else {
 		ac.FlightPlan.Altitude = dep.Altitude
 	}
+	if !ac.Performance.IsJet() {
+		dist, east := float32(150), true
+		if pDest, ok := scenarioGroup.Locate(dep.Destination); ok {
+			dist = nmdistance2ll(ap.Location, pDest)
+			east = headingp2ll(ap.Location, pDest, scenarioGroup.MagneticVariation) <= 180
+		}
+		ac.FlightPlan.Altitude = min(ac.FlightPlan.Altitude, ac.Performance.NonJetCruiseAltitude(dist, east))
+	}
+	ac.AssignedAltitude = min(exitRoute.ClearedAltitude, ac.FlightPlan.Altitude)
 
 	ac.TrackingController = ap.DepartureController
 	ac.Altitude = float32(ap.Elevation)
-	ac.AssignedAltitude = exitRoute.ClearedAltitude
+	sim.assignIntersectionDeparture(ac, ap, rwy)
 
 	return ac
 }
@@ -0,0 +1,302 @@
+// specialops.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Special operations are low-probability irregular events that the sim
+// may start: VIP movements with a TFR and ground stop at an airport,
+// MEDEVAC flights that ask the user for priority handling (given with the
+// "PRI" command), and banner tow and parachute jump operations that block
+// a volume of airspace for a period of time, in which the banner tow or
+// jump aircraft circles until the operation ends. The supervisor calls on
+// the landline when one starts and aircraft tracked by the user that
+// enter blocked airspace are flagged.
+
+type SpecialOperationType int
+
+const (
+	SpecialOpPresidentialTFR SpecialOperationType = iota
+	SpecialOpMedevac
+	SpecialOpBannerTow
+	SpecialOpParachuteJump
+	SpecialOpCount
+)
+
+func (t SpecialOperationType) String() string {
+	return [...]string{
+		"VIP TFR",
+		"MEDEVAC",
+		"Banner tow",
+		"Parachute jumping",
+	}[t]
+}
+
+type SpecialOperation struct {
+	Type        SpecialOperationType
+	Description string
+	Start, End  time.Time
+
+	// Airspace that is blocked while the operation is active; RadiusNM
+	// is zero if none is.
+	Center         Point2LL
+	RadiusNM       float32
+	Floor, Ceiling int
+
+	// For VIP movements, the airport where departures and arrivals are
+	// stopped.
+	Airport string
+
+	// Aircraft that have already been flagged for entering the blocked
+	// airspace.
+	penetrated map[string]interface{}
+}
+
+// Active returns true if the operation is in effect at the given time.
+func (op *SpecialOperation) Active(now time.Time) bool {
+	return !now.Before(op.Start) && now.Before(op.End)
+}
+
+// Inside returns true if the given aircraft is inside the operation's
+// blocked airspace.
+func (op *SpecialOperation) Inside(ac *Aircraft) bool {
+	if op.RadiusNM == 0 {
+		return false
+	}
+	alt := int(ac.Altitude)
+	return alt >= op.Floor && alt <= op.Ceiling && nmdistance2ll(ac.Position, op.Center) <= op.RadiusNM
+}
+
+// randomPointNear returns a point at a random bearing from p that is
+// between the given minimum and maximum distance (in nm) from it.
+func randomPointNear(p Point2LL, minnm, maxnm float32) Point2LL {
+	d := lerp(rand.Float32(), minnm, maxnm)
+	theta := 2 * math.Pi * float64(rand.Float32())
+	v := [2]float32{d * float32(math.Sin(theta)), d * float32(math.Cos(theta))}
+	return add2ll(p, nm2ll(v))
+}
+
+// startSpecialOperation starts a randomly-selected special operation. It
+// returns nil if the selected one isn't possible in the current scenario.
+func (sim *Sim) startSpecialOperation(now time.Time) *SpecialOperation {
+	airports := sim.Scenario.AllAirports()
+	if len(airports) == 0 {
+		return nil
+	}
+	airport := Sample(airports)
+	ap, ok := scenarioGroup.Airports[airport]
+	if !ok {
+		return nil
+	}
+	minutes := func(lo, hi int) time.Duration {
+		return time.Duration(lo+rand.Intn(hi-lo+1)) * time.Minute
+	}
+
+	op := &SpecialOperation{
+		Type:  SpecialOperationType(rand.Intn(int(SpecialOpCount))),
+		Start: now,
+	}
+	switch op.Type {
+	case SpecialOpPresidentialTFR:
+		op.End = now.Add(minutes(20, 30))
+		op.Airport = airport
+		op.Center = ap.Location
+		op.RadiusNM = 10
+		op.Ceiling = 18000
+		op.Description = fmt.Sprintf("VIP movement at %s: TFR 10nm SFC-180, ground stop until %s",
+			airport, op.End.UTC().Format("1504"))
+
+	case SpecialOpMedevac:
+		ac := sim.spawnMedevac()
+		if ac == nil {
+			return nil
+		}
+		op.End = now
+		op.Description = fmt.Sprintf("%s is a MEDEVAC flight to %s requesting priority handling",
+			ac.Callsign, ac.FlightPlan.ArrivalAirport)
+
+	case SpecialOpBannerTow:
+		op.End = now.Add(minutes(60, 90))
+		op.Center = randomPointNear(ap.Location, 12, 25)
+		op.RadiusNM = 3
+		op.Ceiling = 1500
+		op.Description = fmt.Sprintf("Banner tow operations %s 3nm SFC-015 until %s",
+			op.Center.DMSString(), op.End.UTC().Format("1504"))
+		sim.spawnSpecialOpAircraft(op, airport, "C182", 1000)
+
+	case SpecialOpParachuteJump:
+		op.End = now.Add(minutes(30, 45))
+		op.Center = randomPointNear(ap.Location, 10, 25)
+		op.RadiusNM = 2
+		op.Ceiling = 13000
+		op.Description = fmt.Sprintf("Parachute jumping %s 2nm SFC-130 until %s",
+			op.Center.DMSString(), op.End.UTC().Format("1504"))
+		sim.spawnSpecialOpAircraft(op, airport, "C208", 12500)
+	}
+	return op
+}
+
+// spawnMedevac spawns an arrival to one of the scenario's airports that
+// is flagged as a MEDEVAC flight.
+func (sim *Sim) spawnMedevac() *Aircraft {
+	var groups []string
+	for group, rates := range sim.ArrivalGroupRates {
+		if _, rateSum := sampleRateMap(rates); rateSum > 0 {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	group := Sample(groups)
+	airport, _ := sampleRateMap(sim.ArrivalGroupRates[group])
+	ac := sim.SpawnArrival(airport, group)
+	if ac == nil {
+		return nil
+	}
+	ac.FlightPlan.ArrivalAirport = airport
+	ac.FlightPlan.Remarks = "MEDEVAC"
+	ac.Scratchpad = "MED"
+	ac.Medevac = true
+	if !sim.addAircraft(ac) {
+		return nil
+	}
+	return ac
+}
+
+// Banner tow and jump aircraft circle this fraction of the way from the
+// center to the edge of the blocked airspace, with this many waypoints
+// for each orbit.
+const (
+	specialOpOrbitFraction  = 0.5
+	specialOpOrbitWaypoints = 8
+)
+
+// spawnSpecialOpAircraft spawns a VFR aircraft of the given type (or, if
+// it's not in the performance database, a C182) based at the given
+// airport that circles in the operation's airspace at the given altitude
+// until it ends and then goes away.
+func (sim *Sim) spawnSpecialOpAircraft(op *SpecialOperation, airport string, acType string, alt int) *Aircraft {
+	perf, ok := database.AircraftPerformance[acType]
+	if !ok {
+		acType = "C182"
+		if perf, ok = database.AircraftPerformance[acType]; !ok {
+			return nil
+		}
+	}
+
+	r := specialOpOrbitFraction * op.RadiusNM
+	orbitHours := 2 * math.Pi * float64(r) / float64(max(1, perf.Speed.Cruise))
+	orbits := 1 + int(op.End.Sub(op.Start).Hours()/orbitHours)
+	var waypoints []Waypoint
+	for i := 0; i < orbits*specialOpOrbitWaypoints; i++ {
+		theta := 2 * math.Pi * float64(i) / specialOpOrbitWaypoints
+		v := [2]float32{r * float32(math.Sin(theta)), r * float32(math.Cos(theta))}
+		waypoints = append(waypoints, Waypoint{
+			Fix:      fmt.Sprintf("_SPECIALOP%d", i),
+			Location: add2ll(op.Center, nm2ll(v)),
+		})
+	}
+	waypoints[len(waypoints)-1].Commands = []WaypointCommand{WaypointCommandDelete}
+
+	ac := &Aircraft{
+		Callsign: sim.vfrCallsign(),
+		Squawk:   vfrSquawk,
+		Mode:     Charlie,
+		FlightPlan: &FlightPlan{
+			Rules:            VFR,
+			AircraftType:     acType,
+			DepartureAirport: airport,
+			ArrivalAirport:   airport,
+			Altitude:         alt,
+		},
+		Performance: perf,
+		Waypoints:   waypoints,
+		Altitude:    float32(alt),
+		IAS:         float32(perf.Speed.Cruise),
+	}
+	if !sim.addAircraft(ac) {
+		return nil
+	}
+	return ac
+}
+
+// updateSpecialOperations starts and ends special operations, has MEDEVAC
+// flights tracked by the user ask for priority handling, and checks for
+// aircraft tracked by the user entering blocked airspace.
+func (sim *Sim) updateSpecialOperations(now time.Time) {
+	var active []*SpecialOperation
+	for _, op := range sim.SpecialOperations {
+		if op.Active(now) {
+			active = append(active, op)
+		} else if op.RadiusNM > 0 {
+			landlineMessage("SUPERVISOR", "%s ended", op.Type)
+		}
+	}
+	sim.SpecialOperations = active
+
+	if sim.SpecialOperationRate > 0 && now.After(sim.NextSpecialOperation) {
+		if op := sim.startSpecialOperation(now); op != nil {
+			if op.Active(now) {
+				sim.SpecialOperations = append(sim.SpecialOperations, op)
+			}
+			globalConfig.Audio.PlaySound(AudioEventLandlineRing)
+			landlineMessage("SUPERVISOR", "%s", op.Description)
+		}
+		hours := lerp(rand.Float32(), .5, 1.5) / sim.SpecialOperationRate
+		sim.NextSpecialOperation = now.Add(time.Duration(hours * float32(time.Hour)))
+	}
+
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if !ac.Medevac || ac.MedevacPriority || ac.TrackingController != sim.Callsign() {
+			continue
+		}
+		if last, ok := sim.medevacCalls[callsign]; ok && now.Sub(last) < emergencyRepeatInterval {
+			continue
+		}
+		if sim.medevacCalls == nil {
+			sim.medevacCalls = make(map[string]time.Time)
+		}
+		sim.medevacCalls[callsign] = now
+		pilotResponse(callsign, "MEDEVAC %s, request priority handling to %s", callsign, ac.FlightPlan.ArrivalAirport)
+	}
+
+	for _, op := range sim.SpecialOperations {
+		for _, ac := range sim.Aircraft {
+			if ac.TrackingController != sim.Callsign() || !op.Inside(ac) {
+				continue
+			}
+			if fp := ac.FlightPlan; fp != nil && op.Airport != "" &&
+				(fp.DepartureAirport == op.Airport || fp.ArrivalAirport == op.Airport) {
+				continue
+			}
+			if op.penetrated == nil {
+				op.penetrated = make(map[string]interface{})
+			}
+			if _, ok := op.penetrated[ac.Callsign]; !ok {
+				op.penetrated[ac.Callsign] = nil
+				globalConfig.Audio.PlaySound(AudioEventConflictAlert)
+				sim.recording.AddEvent(SessionEventConflict, ac, now, "%s entered %s airspace", ac.Callsign, op.Type)
+			}
+		}
+	}
+}
+
+// groundStopped returns true if departures and arrivals at the given
+// airport are currently stopped due to a special operation.
+func (sim *Sim) groundStopped(airport string) bool {
+	for _, op := range sim.SpecialOperations {
+		if op.Airport == airport && op.Active(sim.CurrentTime()) {
+			return true
+		}
+	}
+	return false
+}
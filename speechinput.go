@@ -0,0 +1,518 @@
+// speechinput.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Controllers can also issue instructions by voice: holding Ctrl-F12
+// records from the microphone and releasing F12 stops recording and
+// sends the audio to an external speech recognizer (e.g., whisper.cpp),
+// which is run as a separate program that prints the transcript. The
+// transcript is then parsed with a small grammar that covers callsigns,
+// altitudes, headings, speeds, direct-to fixes, and approach clearances,
+// giving the same commands that would be typed. If the parse is
+// uncertain, the commands are offered as a suggestion that must be
+// confirmed with Tab rather than being sent.
+
+var (
+	ErrNoSpeechRecognizer = errors.New("No speech recognizer command has been set")
+	ErrNoSpeechCallsign   = errors.New("Unable to find a callsign")
+	ErrNoSpeechCommands   = errors.New("Unable to find any instructions")
+)
+
+// Audio is recorded as 16 kHz mono, which is what most recognizers
+// expect.
+const speechSampleRate = 16000
+
+type speechResult struct {
+	text string
+	err  error
+}
+
+type speechInput struct {
+	device    sdl.AudioDeviceID
+	recording bool
+	results   chan speechResult
+}
+
+// start starts recording if it isn't already in progress.
+func (si *speechInput) start(recognizer string) error {
+	if si.recording {
+		return nil
+	}
+	if recognizer == "" {
+		return ErrNoSpeechRecognizer
+	}
+	spec := sdl.AudioSpec{Freq: speechSampleRate, Format: sdl.AUDIO_S16LSB, Channels: 1, Samples: 4096}
+	var obtained sdl.AudioSpec
+	sdlMutex.Lock()
+	defer sdlMutex.Unlock()
+	dev, err := sdl.OpenAudioDevice("", true /* record */, &spec, &obtained, 0)
+	if err != nil {
+		return err
+	}
+	sdl.PauseAudioDevice(dev, false)
+	si.device, si.recording = dev, true
+	return nil
+}
+
+// stop stops recording and starts recognition with the given command.
+func (si *speechInput) stop(recognizer string) error {
+	sdlMutex.Lock()
+	sdl.PauseAudioDevice(si.device, true)
+	pcm := make([]byte, sdl.GetQueuedAudioSize(si.device))
+	err := sdl.DequeueAudio(si.device, pcm)
+	sdl.CloseAudioDevice(si.device)
+	sdlMutex.Unlock()
+	si.recording = false
+	if err != nil {
+		return err
+	}
+
+	if si.results == nil {
+		si.results = make(chan speechResult, 4)
+	}
+	go func() {
+		defer reportGoroutinePanic()
+		text, err := recognizeSpeech(recognizer, pcm)
+		si.results <- speechResult{text: text, err: err}
+	}()
+	return nil
+}
+
+// result returns the transcript from the most recent recognition, if it
+// has finished.
+func (si *speechInput) result() (speechResult, bool) {
+	select {
+	case r := <-si.results:
+		return r, true
+	default:
+		return speechResult{}, false
+	}
+}
+
+// recognizeSpeech writes the audio to a WAV file and runs the recognizer
+// on it; "{wav}" in the recognizer command is replaced with the file's
+// path.
+func recognizeSpeech(recognizer string, pcm []byte) (string, error) {
+	tmp, err := os.CreateTemp("", "vice-*.wav")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	var hdr bytes.Buffer
+	w := func(v interface{}) { binary.Write(&hdr, binary.LittleEndian, v) }
+	hdr.WriteString("RIFF")
+	w(uint32(36 + len(pcm)))
+	hdr.WriteString("WAVEfmt ")
+	w(uint32(16))                   // fmt chunk size
+	w(uint16(1))                    // PCM
+	w(uint16(1))                    // channels
+	w(uint32(speechSampleRate))     // sample rate
+	w(uint32(2 * speechSampleRate)) // byte rate
+	w(uint16(2))                    // block align
+	w(uint16(16))                   // bits per sample
+	hdr.WriteString("data")
+	w(uint32(len(pcm)))
+	if _, err := tmp.Write(append(hdr.Bytes(), pcm...)); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	tmp.Close()
+
+	args := strings.Fields(strings.ReplaceAll(recognizer, "{wav}", tmp.Name()))
+	if len(args) == 0 {
+		return "", ErrNoSpeechRecognizer
+	}
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", args[0], err)
+	}
+	// Discard timestamps like "[00:00:00.000 --> 00:00:02.000]".
+	text := regexp.MustCompile(`\[[^\]]*\]`).ReplaceAllString(string(out), " ")
+	return strings.TrimSpace(text), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Grammar
+
+var speechDigitWords = map[string]string{
+	"zero": "0", "oh": "0", "one": "1", "two": "2", "three": "3", "tree": "3", "four": "4",
+	"five": "5", "fife": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9", "niner": "9",
+}
+
+var speechTeenWords = map[string]string{
+	"ten": "10", "eleven": "11", "twelve": "12", "thirteen": "13", "fourteen": "14",
+	"fifteen": "15", "sixteen": "16", "seventeen": "17", "eighteen": "18", "nineteen": "19",
+}
+
+var speechTensWords = map[string]string{
+	"twenty": "2", "thirty": "3", "forty": "4", "fifty": "5", "sixty": "6", "seventy": "7",
+	"eighty": "8", "ninety": "9",
+}
+
+// Words that may appear in instructions but don't affect them.
+var speechFillerWords = map[string]interface{}{
+	"and": nil, "to": nil, "the": nil, "please": nil, "heavy": nil, "super": nil, "then": nil,
+	"approach": nil, "runway": nil, "of": nil, "now": nil, "for": nil, "at": nil,
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// parseSpokenNumber parses the number at the start of words, which may
+// be given as digits or as words ("one one thousand", "two seventy",
+// "three thousand five hundred"). It returns the number as a string,
+// which preserves leading zeros, and the number of words used.
+func parseSpokenNumber(words []string) (string, int) {
+	cur, total, n := "", 0, 0
+	for n < len(words) {
+		w := words[n]
+		if isNumber(w) {
+			cur += w
+		} else if d, ok := speechDigitWords[w]; ok {
+			cur += d
+		} else if t, ok := speechTeenWords[w]; ok {
+			cur += t
+		} else if t, ok := speechTensWords[w]; ok {
+			if n+1 < len(words) && speechDigitWords[words[n+1]] != "" && speechDigitWords[words[n+1]] != "0" {
+				cur += t + speechDigitWords[words[n+1]]
+				n++
+			} else {
+				cur += t + "0"
+			}
+		} else if w == "thousand" || w == "hundred" {
+			v, err := strconv.Atoi(cur)
+			if err != nil {
+				v = 1
+			}
+			if w == "thousand" {
+				total += 1000 * v
+			} else {
+				total += 100 * v
+			}
+			cur = ""
+		} else {
+			break
+		}
+		n++
+	}
+
+	if total == 0 {
+		return cur, n
+	}
+	v, _ := strconv.Atoi(cur)
+	return strconv.Itoa(total + v), n
+}
+
+// tokenizeSpeech splits the transcript into lower-case words, with each
+// spoken number replaced by its digits.
+func tokenizeSpeech(text string) []string {
+	text = strings.ToLower(strings.ReplaceAll(text, ",", ""))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9')
+	})
+
+	var tokens []string
+	for i := 0; i < len(words); {
+		if num, n := parseSpokenNumber(words[i:]); n > 0 {
+			tokens = append(tokens, num)
+			i += n
+		} else {
+			tokens = append(tokens, words[i])
+			i++
+		}
+	}
+	return tokens
+}
+
+// matchSpokenCallsign finds the aircraft whose spoken callsign best
+// matches the start of the tokens. It returns the callsign, how closely
+// it matched (from 0 to 1), and the number of tokens used.
+func matchSpokenCallsign(tokens []string, aircraft []*Aircraft) (string, float32, int) {
+	best, bestScore, bestN := "", float32(0), 0
+	for _, ac := range aircraft {
+		idx := strings.IndexAny(ac.Callsign, "0123456789")
+		if idx == -1 {
+			continue
+		}
+		icao, flight := ac.Callsign[:idx], ac.Callsign[idx:]
+
+		var spoken [][]string
+		spoken = append(spoken, []string{strings.ToLower(icao), flight})
+		if cs, ok := database.Callsigns[icao]; ok && cs.Telephony != "" {
+			spoken = append(spoken, append(strings.Fields(strings.ToLower(cs.Telephony)), flight))
+		}
+
+		for _, s := range spoken {
+			// The recognizer may or may not split multi-word telephony
+			// (e.g., "jet blue") so try a range of word counts.
+			for n := 1; n <= min(len(tokens), len(s)+1); n++ {
+				want, got := strings.Join(s, ""), strings.Join(tokens[:n], "")
+				d := editDistance(want, got)
+				score := 1 - float32(d)/float32(max(len(want), len(got)))
+				if score > bestScore {
+					best, bestScore, bestN = ac.Callsign, score, n
+				}
+			}
+		}
+	}
+	return best, bestScore, bestN
+}
+
+// spokenAltitude parses an altitude; numbers below 1000 are taken to be
+// in hundreds of feet (e.g., "flight level two four zero").
+func spokenAltitude(tokens []string) (int, int) {
+	n := 0
+	if len(tokens) >= 2 && tokens[0] == "flight" && tokens[1] == "level" {
+		n = 2
+	}
+	if n < len(tokens) {
+		if alt, err := strconv.Atoi(tokens[n]); err == nil {
+			if alt >= 1000 {
+				alt /= 100
+			}
+			return alt, n + 1
+		}
+	}
+	return 0, 0
+}
+
+// spokenApproach parses an approach like "ILS runway two two left" and
+// returns the id of the matching approach at the aircraft's arrival
+// airport.
+func spokenApproach(tokens []string, ac *Aircraft) (string, int) {
+	n := 0
+	ty := ApproachType(ILSApproach)
+	for n < len(tokens) && !isNumber(tokens[n]) {
+		switch tokens[n] {
+		case "ils", "localizer":
+			ty = ILSApproach
+		case "rnav", "gps", "arnav":
+			ty = RNAVApproach
+		case "runway", "approach", "y", "z":
+		default:
+			return "", 0
+		}
+		n++
+	}
+	if n == len(tokens) {
+		return "", 0
+	}
+	rwy := strings.TrimLeft(tokens[n], "0")
+	n++
+	if n < len(tokens) {
+		if s, ok := map[string]string{"left": "L", "right": "R", "center": "C"}[tokens[n]]; ok {
+			rwy += s
+			n++
+		}
+	}
+
+	if ac == nil || ac.FlightPlan == nil {
+		return "", 0
+	}
+	ap, ok := scenarioGroup.Airports[ac.FlightPlan.ArrivalAirport]
+	if !ok {
+		return "", 0
+	}
+	for _, id := range SortedMapKeys(ap.Approaches) {
+		appr := ap.Approaches[id]
+		if appr.Type == ty && strings.TrimLeft(approachRunway(&appr), "0") == rwy {
+			return id, n
+		}
+	}
+	return "", 0
+}
+
+// parseSpokenCommands converts the transcript of a spoken instruction
+// into the callsign and the commands to send to it. The confidence, from
+// 0 to 1, accounts for how well the callsign matched and how many of the
+// words were understood.
+func parseSpokenCommands(text string, aircraft []*Aircraft) (callsign string, commands []string,
+	confidence float32, err error) {
+	tokens := tokenizeSpeech(text)
+	callsign, confidence, n := matchSpokenCallsign(tokens, aircraft)
+	if callsign == "" {
+		err = ErrNoSpeechCallsign
+		return
+	}
+	ac := aircraft[FindIf(aircraft, func(ac *Aircraft) bool { return ac.Callsign == callsign })]
+	tokens = tokens[n:]
+
+	matched, unmatched := 0, 0
+	for i := 0; i < len(tokens); {
+		t := tokens[i]
+		next := func(k int) string {
+			if i+k < len(tokens) {
+				return tokens[i+k]
+			}
+			return ""
+		}
+
+		// skip returns the index of the first token after i that isn't
+		// one of the given words.
+		skip := func(words ...string) int {
+			j := i + 1
+			for j < len(tokens) && Find(words, tokens[j]) != -1 {
+				j++
+			}
+			return j
+		}
+
+		var cmd string
+		used := 0
+		switch {
+		case t == "descend" || t == "climb":
+			j := skip("and", "maintain", "to")
+			if alt, k := spokenAltitude(tokens[j:]); k > 0 {
+				cmd, used = fmt.Sprintf("%c%d", strings.ToUpper(t)[0], alt), j-i+k
+			}
+
+		case t == "maintain":
+			if isNumber(next(1)) && next(2) == "knots" {
+				cmd, used = "S"+next(1), 3
+			} else if alt, k := spokenAltitude(tokens[i+1:]); k > 0 {
+				cmd, used = fmt.Sprintf("A%d", alt), k+1
+			}
+
+		case t == "turn" && (next(1) == "left" || next(1) == "right"):
+			dir := strings.ToUpper(next(1))[:1]
+			if next(2) == "heading" && isNumber(next(3)) {
+				cmd, used = dir+next(3), 4
+			} else if isNumber(next(2)) && next(3) == "degrees" {
+				cmd, used = dir+next(2)+"D", 4
+			}
+
+		case t == "fly" && next(1) == "heading" && isNumber(next(2)):
+			cmd, used = "H"+next(2), 3
+
+		case t == "heading" && isNumber(next(1)):
+			cmd, used = "H"+next(1), 2
+
+		case t == "speed" || t == "reduce" || t == "increase" || t == "slow":
+			j := skip("speed", "to", "and", "maintain")
+			if j < len(tokens) && isNumber(tokens[j]) {
+				cmd, used = "S"+tokens[j], j-i+1
+				if j+1 < len(tokens) && tokens[j+1] == "knots" {
+					used++
+				}
+			}
+
+		case isNumber(t) && next(1) == "knots":
+			cmd, used = "S"+t, 2
+
+		case t == "direct" || (t == "proceed" && next(1) == "direct"):
+			j := skip("direct")
+			if j < len(tokens) {
+				cmd, used = "D"+strings.ToUpper(tokens[j]), j-i+1
+			}
+
+		case t == "cleared" || t == "expect":
+			j := skip("for", "the")
+			if appr, k := spokenApproach(tokens[j:], ac); k > 0 {
+				cmd, used = strings.ToUpper(t)[:1]+appr, j-i+k
+			}
+		}
+
+		if cmd != "" {
+			commands = append(commands, cmd)
+			matched += used
+			i += used
+		} else {
+			if _, ok := speechFillerWords[t]; !ok {
+				unmatched++
+			}
+			i++
+		}
+	}
+
+	if len(commands) == 0 {
+		err = ErrNoSpeechCommands
+		return
+	}
+	confidence *= float32(matched) / float32(matched+unmatched)
+	return
+}
+
+///////////////////////////////////////////////////////////////////////////
+// STARS
+
+// startSpeechInput starts recording a spoken instruction; recording
+// continues until F12 is released.
+func (sp *STARSPane) startSpeechInput() {
+	if sp.speech.recording {
+		// Key repeat while it's held.
+		return
+	}
+	if err := sp.speech.start(sp.SpeechInput.Recognizer); err != nil {
+		sp.previewAreaOutput = "SPEECH: " + strings.ToUpper(err.Error())
+		globalConfig.Audio.PlaySound(AudioEventCommandError)
+	} else {
+		sp.previewAreaOutput = "LISTENING"
+	}
+}
+
+// processSpeechInput stops recording once F12 has been released (or the
+// scope has lost the keyboard focus). Then it sends the commands from a
+// recognized instruction if it was understood with sufficient
+// confidence; otherwise they are offered as a suggestion that may be
+// sent with Tab.
+func (sp *STARSPane) processSpeechInput(ctx *PaneContext) {
+	if sp.speech.recording && (ctx.keyboard == nil || !ctx.keyboard.IsHeld(KeyF12)) {
+		if err := sp.speech.stop(sp.SpeechInput.Recognizer); err != nil {
+			sp.previewAreaOutput = "SPEECH: " + strings.ToUpper(err.Error())
+			globalConfig.Audio.PlaySound(AudioEventCommandError)
+		} else {
+			sp.previewAreaOutput = "RECOGNIZING"
+		}
+	}
+
+	r, ok := sp.speech.result()
+	if !ok {
+		return
+	}
+	if r.err != nil {
+		sp.previewAreaOutput = "SPEECH: " + strings.ToUpper(r.err.Error())
+		globalConfig.Audio.PlaySound(AudioEventCommandError)
+		return
+	}
+
+	lg.Printf("Speech: \"%s\"", r.text)
+	callsign, commands, confidence, err := parseSpokenCommands(r.text, sim.GetAllAircraft())
+	if err != nil {
+		sp.previewAreaOutput = "SAY AGAIN: " + strings.ToUpper(err.Error())
+		globalConfig.Audio.PlaySound(AudioEventCommandError)
+		return
+	}
+
+	cmd := strings.Join(commands, " ")
+	lg.Printf("Speech: %s %s (confidence %.2f)", callsign, cmd, confidence)
+	if confidence >= sp.SpeechInput.Confidence {
+		status := sp.runAircraftCommands(callsign, cmd)
+		if status.err != nil {
+			sp.previewAreaOutput = status.err.Error()
+		} else {
+			sp.previewAreaOutput = callsign + " " + cmd
+		}
+	} else {
+		sp.commandSuggestion = &STARSCommandSuggestion{callsign: callsign, commands: cmd}
+		sp.previewAreaOutput = fmt.Sprintf("%s %s? TAB TO SEND", callsign, cmd)
+	}
+}
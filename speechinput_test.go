@@ -0,0 +1,76 @@
+// speechinput_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSpokenNumber(t *testing.T) {
+	for _, test := range []struct {
+		words string
+		num   string
+		n     int
+	}{
+		{"one one thousand", "11000", 3},
+		{"two seventy", "270", 2},
+		{"two seven zero", "270", 3},
+		{"three thousand five hundred", "3500", 4},
+		{"zero four five", "045", 3},
+		{"one eighty five", "185", 3},
+		{"twelve thousand", "12000", 2},
+		{"250 knots", "250", 1},
+		{"heading two seven zero", "", 0},
+	} {
+		num, n := parseSpokenNumber(strings.Fields(test.words))
+		if num != test.num || n != test.n {
+			t.Errorf("%q: got (%q, %d), expected (%q, %d)", test.words, num, n, test.num, test.n)
+		}
+	}
+}
+
+func TestTokenizeSpeech(t *testing.T) {
+	tokens := tokenizeSpeech("American 123, descend and maintain one one thousand.")
+	expected := []string{"american", "123", "descend", "and", "maintain", "11000"}
+	if strings.Join(tokens, " ") != strings.Join(expected, " ") {
+		t.Errorf("got %v, expected %v", tokens, expected)
+	}
+}
+
+func TestParseSpokenCommands(t *testing.T) {
+	database = &StaticDatabase{Callsigns: map[string]Callsign{
+		"AAL": Callsign{Telephony: "AMERICAN"},
+		"JBU": Callsign{Telephony: "JET BLUE"},
+	}}
+	aircraft := []*Aircraft{&Aircraft{Callsign: "AAL123"}, &Aircraft{Callsign: "JBU1532"}}
+
+	for _, test := range []struct {
+		text     string
+		callsign string
+		commands []string
+	}{
+		{"American one twenty three descend and maintain one one thousand", "AAL123", []string{"D110"}},
+		{"jetblue fifteen thirty two turn left heading two seven zero", "JBU1532", []string{"L270"}},
+		{"jet blue one five three two fly heading zero four five reduce speed to two one zero knots",
+			"JBU1532", []string{"H045", "S210"}},
+		{"American 123 climb and maintain flight level two four zero", "AAL123", []string{"C240"}},
+		{"American 123 proceed direct camrn", "AAL123", []string{"DCAMRN"}},
+		{"American 123 turn right twenty degrees", "AAL123", []string{"R20D"}},
+	} {
+		callsign, commands, _, err := parseSpokenCommands(test.text, aircraft)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.text, err)
+		} else if callsign != test.callsign {
+			t.Errorf("%q: got callsign %q, expected %q", test.text, callsign, test.callsign)
+		} else if strings.Join(commands, " ") != strings.Join(test.commands, " ") {
+			t.Errorf("%q: got commands %v, expected %v", test.text, commands, test.commands)
+		}
+	}
+
+	if _, _, _, err := parseSpokenCommands("American 123 say again", aircraft); err != ErrNoSpeechCommands {
+		t.Errorf("expected ErrNoSpeechCommands, got %v", err)
+	}
+}
@@ -35,6 +35,8 @@ var (
 	STARSUntrackedAircraftColor  = RGB{.1, .9, .1}
 	STARSPointedOutAircraftColor = RGB{.9, .9, .1}
 	STARSSelectedAircraftColor   = RGB{.1, .9, .9}
+	STARSGhostColor              = RGB{.7, .7, .7}
+	STARSOwnSectorColor          = RGBA{.1, .5, .1, .15}
 
 	ErrSTARSIllegalParam  = errors.New("ILL PARAM")
 	ErrSTARSIllegalTrack  = errors.New("ILL TRK")
@@ -51,6 +53,74 @@ type STARSPane struct {
 
 	Facility STARSFacility
 
+	// The final approach spacing assistant suggests speeds for arrivals
+	// so that they end up with the given spacing (in nm) on final.
+	SpacingAssistant struct {
+		Enabled bool
+		Spacing float32
+	}
+	speedAdvisories map[*Aircraft]string
+
+	// Handoff reminders flag tracked aircraft that will leave the user's
+	// sector within the given number of seconds and haven't been handed
+	// off yet; the value in handoffReminders is the sector id of the
+	// controller for the nearest handoff point, if known.
+	HandoffReminders struct {
+		Enabled bool
+		Seconds int32
+	}
+	handoffReminders map[*Aircraft]string
+
+	// Dead reckoning shows dim predicted positions at one-minute
+	// intervals while the Sim is paused and for tracks that are coasting,
+	// so that the controller can plan ahead without unpausing.
+	DeadReckoning struct {
+		Enabled bool
+		Minutes int32
+	}
+
+	// Show the diagonal separation between aircraft on dependent
+	// approaches and alert if it's predicted to be lost.
+	DependentSpacing struct {
+		Enabled bool
+	}
+	dependentPairs  []DependentPair
+	dependentAlerts map[[2]*Aircraft]interface{}
+
+	// The track heatmap shows where aircraft have flown in this session
+	// and, optionally, prior ones, either as a heatmap or as the tracks
+	// themselves.
+	TrackHeatmap struct {
+		Enabled       bool
+		Spaghetti     bool
+		PriorSessions bool
+	}
+	trackHeatmap      *TrackHeatmap
+	trackHeatmapBuilt time.Time
+	trackHistory      *TrackHistory
+
+	// Show the selected altitude and indicated airspeed downlinked by
+	// Mode-S equipped aircraft in full datablocks.
+	ShowDownlinkedData bool
+
+	// Show the altitude, heading, speed, and approach last assigned to
+	// the aircraft that we are tracking in their full datablocks.
+	ShowAssignments bool
+
+	// Recorded command macros, indexed by scenario name; macroRecording
+	// is non-nil while one is being recorded.
+	Macros         map[string]STARSMacros
+	macroRecording []string
+
+	// Spoken instructions are transcribed by running Recognizer; those
+	// that are understood with at least the given confidence are sent
+	// without confirmation.
+	SpeechInput struct {
+		Recognizer string
+		Confidence float32
+	}
+	speech speechInput
+
 	weatherRadar WeatherRadar
 
 	systemFont [6]*Font
@@ -74,6 +144,13 @@ type STARSPane struct {
 	rangeBearingLines []STARSRangeBearingLine
 	minSepAircraft    [2]*Aircraft
 
+	// Route currently being drawn with the vector tool, if any.
+	vectorRoute *STARSVectorRoute
+
+	// Corrected aircraft commands that are sent if the user presses tab
+	// after a command referred to an unknown fix or approach.
+	commandSuggestion *STARSCommandSuggestion
+
 	// Various UI state
 	scopeClickHandler func(pw [2]float32, transforms ScopeTransformations) STARSCommandStatus
 	activeDCBMenu     int
@@ -87,8 +164,15 @@ type STARSPane struct {
 
 	lastCASoundTime time.Time
 
+	// Unassociated targets close to each tracked IFR aircraft and vice
+	// versa, ignoring whether MCI alerts are inhibited; see updateMCI.
+	mciIntruders  map[*Aircraft][]*Aircraft
+	mciIntrudedOn map[*Aircraft][]*Aircraft
+	lastMCIUpdate time.Time // wallclock
+
 	drawApproachAirspace  bool
 	drawDepartureAirspace bool
+	drawSectors           bool
 }
 
 type STARSRangeBearingLine struct {
@@ -99,6 +183,19 @@ type STARSRangeBearingLine struct {
 	}
 }
 
+type STARSCommandSuggestion struct {
+	callsign string
+	commands string
+}
+
+// STARSVectorRoute records the points of a path that the controller is
+// drawing for an aircraft to fly; it is sent to the Sim when the user
+// presses enter.
+type STARSVectorRoute struct {
+	ac     *Aircraft
+	points []Point2LL
+}
+
 type CommandMode int
 
 const (
@@ -158,6 +255,7 @@ type STARSAircraftState struct {
 	displayReportedBeacon bool // note: only for unassociated
 	displayPTL            bool
 	disableCAWarnings     bool
+	disableMCIWarnings    bool
 	disableMSAW           bool
 	inhibitMSAWAlert      bool // only applies if in an alert. clear when alert is over?
 
@@ -171,10 +269,11 @@ type STARSAircraftState struct {
 // STARSFacility and related
 
 type STARSFacility struct {
-	CA struct {
+	// Mode C intruder alerts between tracked IFR aircraft and
+	// unassociated targets.
+	MCI struct {
 		LateralMinimum  float32
 		VerticalMinimum int32
-		Floor           int32
 	}
 	CRDAConfig CRDAConfig
 
@@ -193,9 +292,8 @@ type STARSMap struct {
 func MakeDefaultFacility() STARSFacility {
 	var f STARSFacility
 
-	f.CA.LateralMinimum = 3
-	f.CA.VerticalMinimum = 1000
-	f.CA.Floor = 500
+	f.MCI.LateralMinimum = 1.5
+	f.MCI.VerticalMinimum = 500
 	f.CRDAConfig = NewCRDAConfig()
 
 	return f
@@ -254,8 +352,9 @@ type STARSPreferenceSet struct {
 
 	DisplayUncorrelatedTargets bool
 
-	DisableCAWarnings bool
-	DisableMSAW       bool
+	DisableCAWarnings  bool
+	DisableMCIWarnings bool
+	DisableMSAW        bool
 
 	OverflightFullDatablocks bool
 	AutomaticFDBOffset       bool
@@ -304,7 +403,10 @@ type STARSPreferenceSet struct {
 	SSAList struct {
 		Position [2]float32
 		Visible  bool
-		Filter   struct {
+		// Airports whose altimeters are shown after the time; the
+		// primary airport's is shown if none are given.
+		AltimeterAirports map[string]interface{}
+		Filter            struct {
 			All                 bool
 			Time                bool
 			Altimeter           bool
@@ -319,6 +421,7 @@ type STARSPreferenceSet struct {
 			QuickLookPositions  bool
 			DisabledTerminal    bool
 			ActiveCRDAPairs     bool
+			RunwayConfiguration bool
 
 			Text struct {
 				Main bool
@@ -358,6 +461,11 @@ type STARSPreferenceSet struct {
 		Position [2]float32
 		Visible  bool
 	}
+	PIREPList struct {
+		Position [2]float32
+		Visible  bool
+		Lines    int
+	}
 	TowerLists [3]struct {
 		Position [2]float32
 		Visible  bool
@@ -447,6 +555,10 @@ func MakePreferenceSet(name string, facility STARSFacility) STARSPreferenceSet {
 
 	ps.CRDAStatusList.Position = [2]float32{.05, .7}
 
+	ps.PIREPList.Position = [2]float32{.85, .5}
+	ps.PIREPList.Lines = 5
+	ps.PIREPList.Visible = false
+
 	ps.TowerLists[0].Position = [2]float32{.05, .5}
 	ps.TowerLists[0].Lines = 5
 	ps.TowerLists[0].Visible = true
@@ -536,15 +648,50 @@ func (b STARSBrightness) ScaleRGB(r RGB) RGB {
 	return r.Scale(float32(b) / 100)
 }
 
+// In high-contrast mode, which is set in the global config rather than
+// the STARS preference sets so that it's independent of the DCB
+// settings, datablocks are drawn at full brightness with a larger font and
+// tracks and leader lines are drawn with thicker lines.
+const (
+	highContrastFontIncrease = 2
+	highContrastLineWidth    = 3
+	highContrastSymbolScale  = 1.5
+)
+
+// datablockFont returns the font to use for datablocks, accounting for
+// high-contrast mode.
+func (sp *STARSPane) datablockFont() *Font {
+	size := sp.currentPreferenceSet.CharSize.Datablocks
+	if globalConfig.HighContrastRadar {
+		size = min(size+highContrastFontIncrease, len(sp.systemFont)-1)
+	}
+	return sp.systemFont[size]
+}
+
+// radarLineWidth returns the width of the lines used for tracks and leader
+// lines.
+func radarLineWidth() float32 {
+	if globalConfig.HighContrastRadar {
+		return highContrastLineWidth
+	}
+	return 1
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // STARSPane proper
 
 // Takes aircraft position in window coordinates
 func NewSTARSPane() *STARSPane {
-	return &STARSPane{
+	sp := &STARSPane{
 		Facility:              MakeDefaultFacility(),
 		SelectedPreferenceSet: -1,
 	}
+	sp.SpacingAssistant.Spacing = 4
+	sp.HandoffReminders.Seconds = 60
+	sp.DeadReckoning.Minutes = 3
+	sp.DependentSpacing.Enabled = true
+	sp.SpeechInput.Confidence = 0.8
+	return sp
 }
 
 func (sp *STARSPane) Name() string { return "STARS" }
@@ -575,6 +722,24 @@ func (sp *STARSPane) Activate() {
 	if sp.AutoTrackDepartures == nil {
 		sp.AutoTrackDepartures = make(map[string]interface{})
 	}
+	if sp.SpacingAssistant.Spacing == 0 {
+		// Saved configs from before the spacing assistant was added.
+		sp.SpacingAssistant.Spacing = 4
+	}
+	if sp.HandoffReminders.Seconds == 0 {
+		sp.HandoffReminders.Seconds = 60
+	}
+	if sp.DeadReckoning.Minutes == 0 {
+		sp.DeadReckoning.Minutes = 3
+	}
+	if sp.SpeechInput.Confidence == 0 {
+		sp.SpeechInput.Confidence = 0.8
+	}
+	if sp.Facility.MCI.LateralMinimum == 0 {
+		// Saved configs from before MCI alerts were added.
+		sp.Facility.MCI.LateralMinimum = 1.5
+		sp.Facility.MCI.VerticalMinimum = 500
+	}
 
 	sp.eventsId = eventStream.Subscribe()
 
@@ -618,6 +783,137 @@ func (sp *STARSPane) ResetScenario(s *Scenario) {
 	ps.VideoMapVisible[s.DefaultMap] = nil
 }
 
+// starsSettingsSection is one of the collapsible sections of the STARS
+// pane's settings. The Preferences window's search looks at the names of
+// the sections and of the settings in them, so settings should be listed
+// with the section that draws them.
+type starsSettingsSection struct {
+	name     string
+	settings []string
+	draw     func()
+}
+
+func (sp *STARSPane) settingsSections() []starsSettingsSection {
+	return []starsSettingsSection{
+		starsSettingsSection{
+			name:     "Collision alerts",
+			settings: []string{"Lateral minimum", "Vertical minimum", "Altitude floor", "Mode C intruder alerts"},
+			draw: func() {
+				ca := &globalConfig.ConflictAlert
+				imgui.SliderFloatV("Lateral minimum (nm)", &ca.LateralMinimum, 0.5, 10, "%.1f", 0)
+				imgui.InputIntV("Vertical minimum (feet)", &ca.VerticalMinimum, 100, 100, 0)
+				imgui.InputIntV("Altitude floor (feet)", &ca.Floor, 100, 100, 0)
+				imgui.Separator()
+				imgui.Text("Mode C intruder alerts")
+				imgui.SliderFloatV("MCI lateral minimum (nm)", &sp.Facility.MCI.LateralMinimum, 0, 5, "%.1f", 0)
+				imgui.InputIntV("MCI vertical minimum (feet)", &sp.Facility.MCI.VerticalMinimum, 100, 100, 0)
+			},
+		},
+		starsSettingsSection{
+			name:     "Final approach spacing assistant",
+			settings: []string{"Show speed advisories for arrivals", "Target spacing"},
+			draw: func() {
+				imgui.Checkbox("Show speed advisories for arrivals", &sp.SpacingAssistant.Enabled)
+				imgui.SliderFloatV("Target spacing (nm)", &sp.SpacingAssistant.Spacing, 2.5, 10, "%.1f", 0)
+			},
+		},
+		starsSettingsSection{
+			name:     "Dependent approaches",
+			settings: []string{"Show diagonal separation on dependent approaches"},
+			draw: func() {
+				imgui.Checkbox("Show diagonal separation on dependent approaches", &sp.DependentSpacing.Enabled)
+			},
+		},
+		starsSettingsSection{
+			name: "Handoff reminders",
+			settings: []string{"Flag aircraft that are about to leave the sector without a handoff",
+				"Time to sector boundary"},
+			draw: func() {
+				imgui.Checkbox("Flag aircraft that are about to leave the sector without a handoff",
+					&sp.HandoffReminders.Enabled)
+				imgui.SliderIntV("Time to sector boundary (seconds)", &sp.HandoffReminders.Seconds, 15, 180, "%d", 0)
+			},
+		},
+		starsSettingsSection{
+			name:     "Dead reckoning",
+			settings: []string{"Show predicted positions when paused and for coasting tracks", "Prediction time"},
+			draw: func() {
+				imgui.Checkbox("Show predicted positions when paused and for coasting tracks", &sp.DeadReckoning.Enabled)
+				imgui.SliderIntV("Prediction time (minutes)", &sp.DeadReckoning.Minutes, 1, 5, "%d", 0)
+			},
+		},
+		starsSettingsSection{
+			name: "Track heatmap",
+			settings: []string{"Show where aircraft have flown", "Draw tracks instead of a heatmap",
+				"Include prior sessions", "Clear prior sessions"},
+			draw: func() {
+				changed := imgui.Checkbox("Show where aircraft have flown", &sp.TrackHeatmap.Enabled)
+				changed = imgui.Checkbox("Draw tracks instead of a heatmap", &sp.TrackHeatmap.Spaghetti) || changed
+				changed = imgui.Checkbox("Include prior sessions", &sp.TrackHeatmap.PriorSessions) || changed
+				if changed {
+					sp.trackHeatmap = nil
+				}
+				if imgui.Button("Clear prior sessions") {
+					ClearTrackHistory(scenarioGroup.Name)
+					sp.trackHistory, sp.trackHeatmap = nil, nil
+				}
+			},
+		},
+		starsSettingsSection{
+			name:     "System status area",
+			settings: []string{"Altimeter airports", "Move to"},
+			draw: func() {
+				ps := &sp.currentPreferenceSet
+				ps.SSAList.AltimeterAirports, _ = drawAirportSelector(ps.SSAList.AltimeterAirports, "Altimeter airports")
+
+				imgui.Text("Move to:")
+				for i, corner := range []string{"Upper left", "Upper right", "Lower left", "Lower right"} {
+					imgui.SameLine()
+					if imgui.Button(corner) {
+						ps.SSAList.Position = [4][2]float32{{.05, .95}, {.7, .95}, {.05, .25}, {.7, .25}}[i]
+					}
+				}
+			},
+		},
+		starsSettingsSection{
+			name:     "Speech input",
+			settings: []string{"Recognizer command", "Confidence to send without confirmation"},
+			draw: func() {
+				imgui.InputTextV("Recognizer command", &sp.SpeechInput.Recognizer, 0, nil)
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("Program that prints the transcript of a WAV file; {wav} is replaced with its path\n" +
+						"(e.g., whisper-cli -nt -m ggml-base.en.bin -f {wav})")
+				}
+				imgui.SliderFloatV("Confidence to send without confirmation", &sp.SpeechInput.Confidence, 0, 1, "%.2f", 0)
+			},
+		},
+		starsSettingsSection{
+			name: "Command macros",
+			draw: sp.drawMacrosUI,
+		},
+		starsSettingsSection{
+			name: "Datablocks",
+			settings: []string{"Show Mode-S selected altitude and IAS",
+				"Show assigned altitude, heading, speed, and approach for tracked aircraft"},
+			draw: func() {
+				imgui.Checkbox("Show Mode-S selected altitude and IAS", &sp.ShowDownlinkedData)
+				imgui.Checkbox("Show assigned altitude, heading, speed, and approach for tracked aircraft", &sp.ShowAssignments)
+			},
+		},
+	}
+}
+
+// SettingNames returns the names of the STARS pane's settings for the
+// Preferences window's search.
+func (sp *STARSPane) SettingNames() []string {
+	names := []string{"Auto track departure airports"}
+	for _, section := range sp.settingsSections() {
+		names = append(names, section.name)
+		names = append(names, section.settings...)
+	}
+	return names
+}
+
 func (sp *STARSPane) DrawUI() {
 	sp.AutoTrackDepartures, _ = drawAirportSelector(sp.AutoTrackDepartures, "Auto track departure airports")
 
@@ -627,10 +923,10 @@ func (sp *STARSPane) DrawUI() {
 		}
 	*/
 
-	if imgui.CollapsingHeader("Collision alerts") {
-		imgui.SliderFloatV("Lateral minimum (nm)", &sp.Facility.CA.LateralMinimum, 0, 10, "%.1f", 0)
-		imgui.InputIntV("Vertical minimum (feet)", &sp.Facility.CA.VerticalMinimum, 100, 100, 0)
-		imgui.InputIntV("Altitude floor (feet)", &sp.Facility.CA.Floor, 100, 100, 0)
+	for _, section := range sp.settingsSections() {
+		if imgui.CollapsingHeader(section.name) {
+			section.draw()
+		}
 	}
 
 	/*
@@ -642,6 +938,20 @@ func (sp *STARSPane) DrawUI() {
 
 func (sp *STARSPane) CanTakeKeyboardFocus() bool { return true }
 
+// CenterOnAircraft pans the scope so that the aircraft is at its center;
+// as with panning with the mouse, OFF CNTR then returns to the
+// preference set's center.
+func (sp *STARSPane) CenterOnAircraft(ac *Aircraft) {
+	ps := &sp.currentPreferenceSet
+	ps.currentCenter = ac.TrackPosition()
+}
+
+func (sp *STARSPane) NMPerPixel(ctx *PaneContext) float32 {
+	transforms := GetScopeTransformations(ctx, sp.currentPreferenceSet.currentCenter,
+		float32(sp.currentPreferenceSet.Range), 0)
+	return transforms.PixelDistanceNM()
+}
+
 func (sp *STARSPane) processEvents(es *EventStream) {
 	ps := sp.currentPreferenceSet
 
@@ -656,7 +966,7 @@ func (sp *STARSPane) processEvents(es *EventStream) {
 
 			if fp := v.ac.FlightPlan; fp != nil {
 				if v.ac.TrackingController == "" {
-					if _, ok := sp.AutoTrackDepartures[fp.DepartureAirport]; ok {
+					if _, ok := sp.AutoTrackDepartures[fp.DepartureAirport]; ok && sim.AssistsEnabled() {
 						sim.InitiateTrack(v.ac.Callsign) // ignore error...
 						sp.aircraft[v.ac].datablockType = FullDatablock
 					}
@@ -680,6 +990,20 @@ func (sp *STARSPane) processEvents(es *EventStream) {
 				}
 			}
 
+		case *MultiplayerErrorEvent:
+			// The reply to a request that was sent to the multiplayer
+			// server; don't replace anything the user has typed since.
+			input := sp.previewAreaInput
+			if v.commands != "" {
+				sp.previewAreaOutput = sp.commandError(v.callsign, v.remaining, v.err).err.Error()
+			} else {
+				globalConfig.Audio.PlaySound(AudioEventCommandError)
+				sp.previewAreaOutput = v.err.Error()
+			}
+			if input != "" {
+				sp.previewAreaInput = input
+			}
+
 		case *RemovedAircraftEvent:
 			if ghost, ok := sp.ghostAircraft[v.ac]; ok {
 				delete(sp.aircraft, ghost)
@@ -717,6 +1041,7 @@ func (sp *STARSPane) processEvents(es *EventStream) {
 
 		case *PointOutEvent:
 			sp.pointedOutAircraft.Add(v.ac, v.controller, 10*time.Second)
+			globalConfig.Audio.PlaySound(AudioEventPointOut)
 
 		case *AcceptedHandoffEvent:
 			// Note that we only want to do that if we were the handing-off
@@ -727,6 +1052,22 @@ func (sp *STARSPane) processEvents(es *EventStream) {
 				state.outboundHandoffAccepted = true
 				state.outboundHandoffFlashEnd = time.Now().Add(10 * time.Second)
 			}
+
+		case *ConflictAlertEvent:
+			// Sound the alarm right away; it's repeated while the
+			// conflict continues when the CA rings are drawn.
+			if sp.IsCAActive(v.aircraft[0]) && sp.IsCAActive(v.aircraft[1]) {
+				globalConfig.Audio.PlaySound(AudioEventConflictAlert)
+				sp.lastCASoundTime = time.Now()
+			}
+
+		case *MSAWEvent:
+			if state, ok := sp.aircraft[v.ac]; ok && sp.IsMSAWActive(v.ac) {
+				// A new alert; the previous acknowledgement no longer
+				// applies.
+				state.inhibitMSAWAlert = false
+				globalConfig.Audio.PlaySound(AudioEventMSAW)
+			}
 		}
 	}
 }
@@ -740,6 +1081,7 @@ func (sp *STARSPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 		wmTakeKeyboardFocus(sp, false)
 	}
 	sp.processKeyboardInput(ctx)
+	sp.processSpeechInput(ctx)
 
 	transforms := GetScopeTransformations(ctx, sp.currentPreferenceSet.currentCenter,
 		float32(sp.currentPreferenceSet.Range), 0)
@@ -763,15 +1105,25 @@ func (sp *STARSPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 	}
 
 	weatherIntensity := float32(0)
+	weatherLevel := -1
 	for i, set := range ps.WeatherIntensity {
 		if set {
 			weatherIntensity = float32(i) / float32(len(ps.WeatherIntensity)-1)
+			weatherLevel = i
 		}
 	}
-	if weatherIntensity != 0 {
+	if len(sim.Precipitation) > 0 {
+		// Show the Sim's precipitation instead of real-world radar; the
+		// selected WX button gives the lowest level that is shown.
+		if weatherLevel != -1 {
+			sp.drawPrecipitation(max(1, weatherLevel), transforms, cb)
+		}
+	} else if weatherIntensity != 0 {
 		sp.weatherRadar.Draw(weatherIntensity, transforms, cb)
 	}
 
+	sp.drawTrackHeatmap(transforms, cb)
+
 	color := ps.Brightness.RangeRings.RGB()
 	cb.LineWidth(1)
 	DrawRangeRings(ps.RangeRingsCenter, float32(ps.RangeRingRadius), color, transforms, cb)
@@ -821,18 +1173,31 @@ func (sp *STARSPane) Draw(ctx *PaneContext, cb *CommandBuffer) {
 
 	// Tools before datablocks
 	sp.drawPTLs(aircraft, ctx, transforms, cb)
+	sp.drawDeadReckoning(aircraft, ctx, transforms, cb)
 	sp.drawRingsAndCones(aircraft, ctx, transforms, cb)
 	sp.drawRBLs(ctx, transforms, cb)
+	sp.drawVectorRoute(ctx, transforms, cb)
+	sp.drawApproachProjection(aircraft, ctx, transforms, cb)
+	sp.updateDependentSpacing(aircraft)
+	sp.drawDependentSpacing(ctx, transforms, cb)
 	sp.drawMinSep(ctx, transforms, cb)
 	sp.drawCARings(ctx, transforms, cb)
 	sp.drawAirspace(ctx, transforms, cb)
+	sp.drawSpecialOperations(ctx, transforms, cb)
+	sp.drawSIGMETs(ctx, transforms, cb)
 
 	DrawHighlighted(ctx, transforms, cb)
 
 	sp.drawTracks(aircraft, ctx, transforms, cb)
+	sp.updateSpeedAdvisories(aircraft)
+	sp.updateHandoffReminders(aircraft)
 	sp.updateDatablockTextAndPosition(aircraft)
 	sp.drawDatablocks(aircraft, ctx, transforms, cb)
 	sp.consumeMouseEvents(ctx, transforms)
+	if ctx.haveFocus {
+		ps := &sp.currentPreferenceSet
+		UpdateScopePositionFromGamepad(ctx.platform, transforms, &ps.currentCenter, &ps.Range)
+	}
 }
 
 func (sp *STARSPane) processKeyboardInput(ctx *PaneContext) {
@@ -869,130 +1234,190 @@ func (sp *STARSPane) processKeyboardInput(ctx *PaneContext) {
 		}
 	}
 
-	for key := range ctx.keyboard.Pressed {
-		switch key {
-		case KeyBackspace:
-			if len(sp.previewAreaInput) > 0 {
-				sp.previewAreaInput = sp.previewAreaInput[:len(sp.previewAreaInput)-1]
-			} else {
-				sp.multiFuncPrefix = ""
-			}
+	// Alt-digit saves or loads a macro; the digit shouldn't be taken as
+	// command input.
+	if ctx.keyboard.IsPressed(KeyAlt) && !ctx.keyboard.IsPressed(KeyControl) &&
+		len(input) == 1 && unicode.IsDigit(rune(input[0])) {
+		sp.previewAreaInput = strings.TrimSuffix(sp.previewAreaInput, input)
+		sp.macroKey(int(input[0] - '0'))
+	}
 
-		case KeyEnd:
-			sp.resetInputState()
-			sp.commandMode = CommandModeMin
-
-		case KeyEnter:
-			status := sp.executeSTARSCommand(sp.previewAreaInput)
-			if status.err != nil {
-				// TODO: rewrite errors returned by the ATCServer to e.g.,
-				// ILL TRK, etc.
-				sp.previewAreaOutput = status.err.Error()
-			} else {
-				if status.clear {
-					sp.resetInputState()
-				}
-				sp.previewAreaOutput = status.output
-			}
+	DispatchKeyBindings(sp.KeyBindings(), ctx.keyboard)
+}
 
-		case KeyEscape:
+// KeyBindings returns the STARS keyboard commands; the Ctrl-modified
+// function keys select DCB menus and the plain ones select command modes.
+func (sp *STARSPane) KeyBindings() []KeyBinding {
+	ps := &sp.currentPreferenceSet
+	dcb := func() bool { return ps.DisplayDCB }
+	commandMode := func(mode CommandMode) func() {
+		return func() {
 			sp.resetInputState()
-			sp.activeDCBMenu = DCBMenuMain
-			// Also disable any mouse capture from spinners, just in case
-			// the user is mashing escape to get out of one.
+			sp.commandMode = mode
+		}
+	}
+	dcbMenu := func(menu int) func() {
+		return func() {
 			sp.disableMenuSpinner()
+			sp.activeDCBMenu = menu
+		}
+	}
+	spinner := func(ptr unsafe.Pointer) func() {
+		return func() {
+			sp.disableMenuSpinner()
+			sp.activateMenuSpinner(ptr)
+		}
+	}
 
-		case KeyF1:
-			if ctx.keyboard.IsPressed(KeyControl) {
-				// Recenter
-				ps.Center = scenarioGroup.Center
-				ps.currentCenter = ps.Center
-			}
-
-		case KeyF2:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
-				sp.disableMenuSpinner()
-				sp.activeDCBMenu = DCBMenuMaps
-			} else {
+	return []KeyBinding{
+		KeyBinding{Key: KeyEnter, Description: "Enter the command in the preview area",
+			Action: func() {
+				var status STARSCommandStatus
+				if sp.vectorRoute != nil {
+					// Enter finishes a route drawn with the vector tool.
+					status = sp.assignVectorRoute()
+				} else {
+					status = sp.executeSTARSCommand(sp.previewAreaInput)
+				}
+				if status.err != nil {
+					// TODO: rewrite errors returned by the ATCServer to e.g.,
+					// ILL TRK, etc.
+					sp.previewAreaOutput = status.err.Error()
+				} else {
+					if status.clear {
+						sp.resetInputState()
+					}
+					sp.previewAreaOutput = status.output
+				}
+			}},
+		KeyBinding{Key: KeyTab, Description: "Send the suggested correction to a command",
+			Enabled: func() bool { return sp.commandSuggestion != nil },
+			Action: func() {
+				s := sp.commandSuggestion
+				status := sp.runAircraftCommands(s.callsign, s.commands)
+				if status.err != nil {
+					sp.previewAreaOutput = status.err.Error()
+				} else {
+					sp.resetInputState()
+				}
+			}},
+		KeyBinding{Key: KeyBackspace, Description: "Delete the last character entered",
+			Action: func() {
+				if len(sp.previewAreaInput) > 0 {
+					sp.previewAreaInput = sp.previewAreaInput[:len(sp.previewAreaInput)-1]
+				} else {
+					sp.multiFuncPrefix = ""
+				}
+			}},
+		KeyBinding{Key: KeyEnd, Description: "Minimum command mode", Action: commandMode(CommandModeMin)},
+		KeyBinding{Key: KeyEscape, Description: "Clear input and return to the main DCB menu",
+			Action: func() {
 				sp.resetInputState()
-				sp.commandMode = CommandModeMaps
-			}
-
-		case KeyF3:
-			sp.resetInputState()
-			sp.commandMode = CommandModeInitiateControl
-
-		case KeyF4:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
+				sp.activeDCBMenu = DCBMenuMain
+				// Also disable any mouse capture from spinners, just in case
+				// the user is mashing escape to get out of one.
 				sp.disableMenuSpinner()
-				sp.activeDCBMenu = DCBMenuBrite
-			} else {
-				sp.resetInputState()
-				sp.commandMode = CommandModeTerminateControl
-			}
-
-		case KeyF5:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
+			}},
+		KeyBinding{Keys: "Ctrl-0 ... Ctrl-9", Description: "Recall a saved range and center"},
+		KeyBinding{Keys: "Ctrl-Alt-0 ... Ctrl-Alt-9", Description: "Save the current range and center"},
+		KeyBinding{Key: KeyF1, Control: true, Description: "Recenter the scope",
+			Action: func() {
+				ps.Center = scenarioGroup.Center
+				ps.currentCenter = ps.Center
+			}},
+		KeyBinding{Key: KeyF2, Control: true, Enabled: dcb, Description: "MAPS menu", Action: dcbMenu(DCBMenuMaps)},
+		KeyBinding{Key: KeyF2, Description: "Maps", Action: commandMode(CommandModeMaps)},
+		KeyBinding{Key: KeyF3, Description: "Initiate control", Action: commandMode(CommandModeInitiateControl)},
+		KeyBinding{Key: KeyF4, Control: true, Enabled: dcb, Description: "BRITE menu", Action: dcbMenu(DCBMenuBrite)},
+		KeyBinding{Key: KeyF4, Description: "Terminate control", Action: commandMode(CommandModeTerminateControl)},
+		KeyBinding{Key: KeyF5, Control: true, Enabled: dcb, Description: "Leader line length",
+			Action: func() {
 				sp.activeDCBMenu = DCBMenuMain
 				sp.activateMenuSpinner(unsafe.Pointer(&ps.LeaderLineLength))
-			} else {
-				sp.resetInputState()
-				sp.commandMode = CommandModeHandOff
-			}
-
-		case KeyF6:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
-				sp.disableMenuSpinner()
-				sp.activeDCBMenu = DCBMenuCharSize
-			} else {
-				sp.resetInputState()
-				sp.commandMode = CommandModeVP
-			}
-
-		case KeyF7:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
+			}},
+		KeyBinding{Key: KeyF5, Description: "Handoff", Action: commandMode(CommandModeHandOff)},
+		KeyBinding{Key: KeyF6, Control: true, Enabled: dcb, Description: "CHAR SIZE menu", Action: dcbMenu(DCBMenuCharSize)},
+		KeyBinding{Key: KeyF6, Description: "VFR plan", Action: commandMode(CommandModeVP)},
+		KeyBinding{Key: KeyF7, Control: true, Enabled: dcb, Description: "Toggle the auxiliary DCB menu",
+			Action: func() {
 				sp.disableMenuSpinner()
 				if sp.activeDCBMenu == DCBMenuMain {
 					sp.activeDCBMenu = DCBMenuAux
 				} else {
 					sp.activeDCBMenu = DCBMenuMain
 				}
-			} else {
-				sp.resetInputState()
-				sp.commandMode = CommandModeMultiFunc
-			}
-
-		case KeyF8:
-			if ctx.keyboard.IsPressed(KeyControl) {
+			}},
+		KeyBinding{Key: KeyF7, Description: "Multi-function", Action: commandMode(CommandModeMultiFunc)},
+		KeyBinding{Key: KeyF8, Control: true, Description: "Show or hide the DCB",
+			Action: func() {
 				sp.disableMenuSpinner()
 				ps.DisplayDCB = !ps.DisplayDCB
-			}
+			}},
+		KeyBinding{Key: KeyF9, Control: true, Enabled: dcb, Description: "Range ring spacing",
+			Action: spinner(unsafe.Pointer(&ps.RangeRingRadius))},
+		KeyBinding{Key: KeyF9, Description: "Flight data", Action: commandMode(CommandModeFlightData)},
+		KeyBinding{Key: KeyF10, Control: true, Enabled: dcb, Description: "Range", Action: spinner(unsafe.Pointer(&ps.Range))},
+		KeyBinding{Key: KeyF11, Control: true, Enabled: dcb, Description: "SITE menu", Action: dcbMenu(DCBMenuSite)},
+		KeyBinding{Key: KeyF11, Description: "Collision alert", Action: commandMode(CommandModeCollisionAlert)},
+		KeyBinding{Key: KeyF12, Control: true, Description: "Hold to record a spoken instruction",
+			Action: sp.startSpeechInput},
+		KeyBinding{Key: KeyF12, Description: "Start recording a macro, or cancel recording",
+			Action: sp.toggleMacroRecording},
+		KeyBinding{Keys: "Alt-<digit>", Description: "Save the recorded macro to the slot or load the macro in it"},
+	}
+}
 
-		case KeyF9:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
-				sp.disableMenuSpinner()
-				sp.activateMenuSpinner(unsafe.Pointer(&ps.RangeRingRadius))
-			} else {
-				sp.resetInputState()
-				sp.commandMode = CommandModeFlightData
-			}
+// runAircraftCommands sends the commands to the aircraft. If a command
+// refers to an unknown fix or approach that's close to one that exists,
+// the corrected commands are saved so that the user can send them by
+// pressing tab.
+//
+// An aircraft with a similar callsign (flagged "SC" in its datablock)
+// may take the clearance instead; starting the commands with "!"
+// emphasizes the callsign so that only the intended aircraft acts on
+// them.
+func (sp *STARSPane) runAircraftCommands(callsign string, cmd string) (status STARSCommandStatus) {
+	sp.commandSuggestion = nil
+
+	recipient, cmd := sim.ClearanceRecipient(callsign, cmd)
+	remaining, err := sim.RunAircraftCommands(recipient, cmd)
+	if err == nil {
+		sp.recordMacroCommands(cmd)
+		status.clear = true
+		return
+	}
+	return sp.commandError(callsign, remaining, err)
+}
 
-		case KeyF10:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
-				sp.disableMenuSpinner()
-				sp.activateMenuSpinner(unsafe.Pointer(&ps.Range))
-			}
+// commandError returns the status for commands for the aircraft that
+// failed with the given error, leaving the remaining commands in the
+// preview area.
+func (sp *STARSPane) commandError(callsign string, remaining []string, err error) (status STARSCommandStatus) {
+	switch err {
+	case ErrInvalidCommandSyntax:
+		status.err = ErrSTARSCommandFormat
+	case ErrNoAircraftForCallsign, ErrUnableCommand:
+		status.err = ErrSTARSIllegalTrack
+	default:
+		status.err = ErrSTARSIllegalParam
+	}
 
-		case KeyF11:
-			if ctx.keyboard.IsPressed(KeyControl) && ps.DisplayDCB {
-				sp.disableMenuSpinner()
-				sp.activeDCBMenu = DCBMenuSite
-			} else {
-				sp.resetInputState()
-				sp.commandMode = CommandModeCollisionAlert
-			}
-		}
+	// Leave the unexecuted commands for editing, etc.
+	globalConfig.Audio.PlaySound(AudioEventCommandError)
+	sp.previewAreaInput = strings.Join(remaining, " ")
+
+	var se *SuggestionError
+	var mae *MinimumAltitudeError
+	if errors.As(err, &se) && len(remaining) > 0 && sim.AssistsEnabled() {
+		remaining[0] = strings.TrimSuffix(remaining[0], se.Name) + se.Suggestion
+		sp.commandSuggestion = &STARSCommandSuggestion{callsign: callsign, commands: strings.Join(remaining, " ")}
+		status.err = errors.New("DID YOU MEAN " + se.Suggestion + "? TAB TO ACCEPT")
+	} else if errors.As(err, &mae) && len(remaining) > 0 {
+		remaining[0] += "!"
+		sp.commandSuggestion = &STARSCommandSuggestion{callsign: callsign, commands: strings.Join(remaining, " ")}
+		status.err = fmt.Errorf("BELOW %s %d. TAB TO OVERRIDE", mae.Kind, mae.Minimum)
 	}
+	return
 }
 
 func (sp *STARSPane) disableMenuSpinner() {
@@ -1089,6 +1514,11 @@ func (sp *STARSPane) executeSTARSCommand(cmd string) (status STARSCommandStatus)
 			sp.drawDepartureAirspace = !sp.drawDepartureAirspace
 			status.clear = true
 			return
+
+		case "DS":
+			sp.drawSectors = !sp.drawSectors
+			status.clear = true
+			return
 		}
 
 		if len(cmd) >= 3 && cmd[:2] == "*T" {
@@ -1566,6 +1996,9 @@ func (sp *STARSPane) executeSTARSCommand(cmd string) (status STARSCommandStatus)
 				case 'N':
 					updateList(cmd[1:], &ps.CRDAStatusList.Visible, nil)
 					return
+				case 'P':
+					updateList(cmd[1:], &ps.PIREPList.Visible, &ps.PIREPList.Lines)
+					return
 				}
 			}
 
@@ -1666,6 +2099,23 @@ func (sp *STARSPane) executeSTARSCommand(cmd string) (status STARSCommandStatus)
 			ps.DisableCAWarnings = false
 			status.clear = true
 			return
+		} else if len(cmd) > 3 && cmd[:2] == "M " {
+			callsign := lookupCallsign(cmd[2:])
+			if state, ok := sp.aircraft[sim.GetAircraft(callsign)]; ok {
+				state.disableMCIWarnings = !state.disableMCIWarnings
+			} else {
+				status.err = ErrSTARSIllegalParam
+			}
+			status.clear = true
+			return
+		} else if cmd == "MI" {
+			ps.DisableMCIWarnings = true
+			status.clear = true
+			return
+		} else if cmd == "ME" {
+			ps.DisableMCIWarnings = false
+			status.clear = true
+			return
 		}
 
 	case CommandModeMin:
@@ -1817,6 +2267,7 @@ func (sp *STARSPane) executeSTARSClickedCommand(cmd string, mousePosition [2]flo
 				} else if _, ok := sp.pointedOutAircraft.Get(ac); ok {
 					// ack point out
 					sp.pointedOutAircraft.Delete(ac)
+					globalConfig.Audio.Acknowledge(AudioEventPointOut)
 					status.clear = true
 					return
 				} else if state.outboundHandoffAccepted {
@@ -1856,6 +2307,16 @@ func (sp *STARSPane) executeSTARSClickedCommand(cmd string, mousePosition [2]flo
 						return
 					}
 					return
+				} else if cmd == "V" {
+					// Draw a route for the aircraft to fly: each click
+					// adds a point and enter sends it off.
+					route := &STARSVectorRoute{ac: ac}
+					sp.vectorRoute = route
+					sp.scopeClickHandler = func(pw [2]float32, transforms ScopeTransformations) (status STARSCommandStatus) {
+						route.points = append(route.points, transforms.LatLongFromWindowP(pw))
+						return
+					}
+					return
 				} else if dir, ok := numpadToDirection(cmd[0]); ok {
 					state.leaderLineDirection = dir
 					status.clear = true
@@ -1971,140 +2432,7 @@ func (sp *STARSPane) executeSTARSClickedCommand(cmd string, mousePosition [2]flo
 			}
 
 			if len(cmd) > 0 {
-				commands := strings.Fields(cmd)
-				for i, command := range commands {
-					switch command[0] {
-					case 'D':
-						// Is it an altitude?
-						if len(command) > 1 && command[1] >= '0' && command[1] <= '9' {
-							if alt, err := strconv.Atoi(command[1:]); err != nil || alt > 390 {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.AssignAltitude(ac.Callsign, 100*alt) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						} else if _, ok := scenarioGroup.Locate(string(command[1:])); ok {
-							if err := sim.DirectFix(ac.Callsign, command[1:]); err != nil {
-								if err == ErrNoAircraftForCallsign {
-									status.err = ErrSTARSIllegalTrack
-								} else {
-									status.err = ErrSTARSIllegalParam
-								}
-							}
-						} else {
-							status.err = ErrSTARSIllegalParam
-						}
-
-					case 'H':
-						if hdg, err := strconv.Atoi(command[1:]); err != nil {
-							status.err = ErrSTARSIllegalParam
-						} else if hdg > 360 {
-							status.err = ErrSTARSIllegalParam
-						} else if sim.AssignHeading(ac.Callsign, hdg, 0) != nil {
-							status.err = ErrSTARSIllegalTrack
-						}
-
-					case 'L':
-						if l := len(command); l > 2 && command[l-1] == 'D' {
-							// turn left x degrees
-							if deg, err := strconv.Atoi(command[1 : l-1]); err != nil {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.TurnLeft(ac.Callsign, deg) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						} else {
-							// fly heading...
-							if hdg, err := strconv.Atoi(command[1:]); err != nil {
-								status.err = ErrSTARSIllegalParam
-							} else if hdg > 360 {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.AssignHeading(ac.Callsign, hdg, -1) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						}
-
-					case 'R':
-						if l := len(command); l > 2 && command[l-1] == 'D' {
-							// turn right x degrees
-							if deg, err := strconv.Atoi(command[1 : l-1]); err != nil {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.TurnRight(ac.Callsign, deg) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						} else {
-							// fly heading...
-							if hdg, err := strconv.Atoi(command[1:]); err != nil {
-								status.err = ErrSTARSIllegalParam
-							} else if hdg > 360 {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.AssignHeading(ac.Callsign, hdg, 1) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						}
-
-					case 'C', 'A':
-						var isAllNumbers func(s string) bool
-						isAllNumbers = func(s string) bool {
-							if s == "" {
-								return true
-							} else if s[0] < '0' || s[0] > '9' {
-								return false
-							}
-							return isAllNumbers(s[1:])
-						}
-						if command[0] == 'C' && len(command) > 2 && !isAllNumbers(command[1:]) {
-							// Cleared approach.
-							if sim.ClearedApproach(ac.Callsign, command[1:]) != nil {
-								status.err = ErrSTARSIllegalParam
-							}
-						} else {
-							// Otherwise look for an altitude
-							if alt, err := strconv.Atoi(command[1:]); err != nil {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.AssignAltitude(ac.Callsign, 100*alt) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						}
-
-					case 'S':
-						if len(command) > 1 {
-							if kts, err := strconv.Atoi(command[1:]); err != nil {
-								status.err = ErrSTARSIllegalParam
-							} else if sim.AssignSpeed(ac.Callsign, kts) != nil {
-								status.err = ErrSTARSIllegalTrack
-							}
-						}
-
-					case 'E':
-						// Expect approach.
-						if len(command) > 1 {
-							if sim.ExpectApproach(ac.Callsign, command[1:]) != nil {
-								status.err = ErrSTARSIllegalParam
-							}
-						}
-
-					case '?':
-						if sim.PrintInfo(ac.Callsign) != nil {
-							status.err = ErrSTARSIllegalTrack
-						}
-
-					case 'X':
-						if sim.DeleteAircraft(ac.Callsign) != nil {
-							status.err = ErrSTARSIllegalTrack
-						}
-
-					default:
-						status.err = ErrSTARSCommandFormat
-					}
-
-					if status.err != nil {
-						// Leave the unexecuted commands for editing, etc.
-						globalConfig.Audio.PlaySound(AudioEventCommandError)
-						sp.previewAreaInput = strings.Join(commands[i:], " ")
-						return
-					}
-				}
-
-				status.clear = true
+				status = sp.runAircraftCommands(ac.Callsign, cmd)
 				return
 			}
 
@@ -2202,6 +2530,7 @@ func (sp *STARSPane) executeSTARSClickedCommand(cmd string, mousePosition [2]flo
 				if cmd == "" {
 					status.clear = true
 					state.inhibitMSAWAlert = true
+					globalConfig.Audio.Acknowledge(AudioEventMSAW)
 				} else {
 					status.err = ErrSTARSCommandFormat
 				}
@@ -2268,6 +2597,14 @@ func (sp *STARSPane) executeSTARSClickedCommand(cmd string, mousePosition [2]flo
 				// TODO: check should we set sp.commandMode = CommandMode
 				// (applies here and also to others similar...)
 				return
+			} else if cmd == "M" {
+				if state, ok := sp.aircraft[ac]; ok {
+					state.disableMCIWarnings = !state.disableMCIWarnings
+				} else {
+					status.err = ErrSTARSIllegalTrack
+				}
+				status.clear = true
+				return
 			}
 
 		case CommandModeMin:
@@ -2350,6 +2687,10 @@ func (sp *STARSPane) executeSTARSClickedCommand(cmd string, mousePosition [2]flo
 			ps.CRDAStatusList.Position = transforms.NormalizedFromWindowP(mousePosition)
 			status.clear = true
 			return
+		} else if cmd == "TP" {
+			ps.PIREPList.Position = transforms.NormalizedFromWindowP(mousePosition)
+			status.clear = true
+			return
 		} else if len(cmd) == 2 && cmd[0] == 'P' {
 			if idx, err := strconv.Atoi(cmd[1:]); err == nil && idx > 0 && idx <= 3 {
 				ps.TowerLists[idx-1].Position = transforms.NormalizedFromWindowP(mousePosition)
@@ -2740,7 +3081,7 @@ func (sp *STARSPane) DrawDCB(ctx *PaneContext, transforms ScopeTransformations)
 		STARSDisabledButton("CON/CPL", STARSButtonHalfVertical) // ?? TODO
 		STARSDisabledButton("OFF IND", STARSButtonHalfVertical) // ?? TODO
 		STARSToggleButton("CRDA", &ps.SSAList.Filter.ActiveCRDAPairs, STARSButtonHalfVertical)
-		STARSDisabledButton("", STARSButtonHalfVertical)
+		STARSToggleButton("RWY CFG", &ps.SSAList.Filter.RunwayConfiguration, STARSButtonHalfVertical)
 		if STARSSelectButton("DONE", STARSButtonFull) {
 			sp.activeDCBMenu = DCBMenuMain
 		}
@@ -2885,14 +3226,29 @@ func (sp *STARSPane) drawSystemLists(aircraft []*Aircraft, ctx *PaneContext,
 				text += sim.CurrentTime().UTC().Format("1504/05 ")
 			}
 			if filter.All || filter.Altimeter {
-				if metar := sim.GetMETAR(scenarioGroup.PrimaryAirport); metar != nil {
-					text += formatMETAR(scenarioGroup.PrimaryAirport, metar)
+				airports := SortedMapKeys(ps.SSAList.AltimeterAirports)
+				if len(airports) == 0 {
+					airports = []string{scenarioGroup.PrimaryAirport}
+				}
+				var alts []string
+				for _, ap := range airports {
+					if metar := sim.GetMETAR(ap); metar != nil {
+						alts = append(alts, formatMETAR(ap, metar))
+					}
 				}
+				text += strings.Join(alts, "\n")
 			}
-			td.AddText(text, pw, style)
+			pw = td.AddText(text, pw, style)
 			newline()
 		}
 
+		if filter.All || filter.RunwayConfiguration {
+			if text := sp.runwayConfiguration(); text != "" {
+				pw = td.AddText(text, pw, style)
+				newline()
+			}
+		}
+
 		// ATIS and GI text always, apparently
 		if ps.currentATIS != "" {
 			pw = td.AddText(ps.currentATIS+" "+ps.giText[0], pw, style)
@@ -3008,6 +3364,11 @@ func (sp *STARSPane) drawSystemLists(aircraft []*Aircraft, ctx *PaneContext,
 				if metar := sim.GetMETAR(icao); metar != nil {
 					lines = append(lines, formatMETAR(icao, metar))
 				}
+				for _, key := range SortedMapKeys(sim.RunwayStates) {
+					if rs := sim.RunwayStates[key]; rs.Airport == icao {
+						lines = append(lines, "  "+rs.String())
+					}
+				}
 			}
 			if len(lines) > 0 {
 				pw = td.AddText(strings.Join(lines, "\n"), pw, style)
@@ -3025,6 +3386,9 @@ func (sp *STARSPane) drawSystemLists(aircraft []*Aircraft, ctx *PaneContext,
 			if ps.DisableCAWarnings {
 				disabled = append(disabled, "CA")
 			}
+			if ps.DisableMCIWarnings {
+				disabled = append(disabled, "MCI")
+			}
 			if ps.DisableCRDA {
 				disabled = append(disabled, "CRDA")
 			}
@@ -3084,26 +3448,54 @@ func (sp *STARSPane) drawSystemLists(aircraft []*Aircraft, ctx *PaneContext,
 			}
 		}
 
+		// Followed by departures that are still in the queue on the
+		// ground, with their proposed departure times.
+		queued := sim.GetDepartureQueue()
+
 		text := "FLIGHT PLAN\n"
-		if len(dep) > ps.TABList.Lines {
-			text += fmt.Sprintf("MORE: %d/%d\n", ps.TABList.Lines, len(dep))
+		if n := len(dep) + len(queued); n > ps.TABList.Lines {
+			text += fmt.Sprintf("MORE: %d/%d\n", ps.TABList.Lines, n)
 		}
-		for i, acIdx := range SortedMapKeys(dep) {
+		lines := 0
+		for _, acIdx := range SortedMapKeys(dep) {
 			ac := dep[acIdx]
 			text += fmt.Sprintf("%2d %-7s %s\n", acIdx, ac.Callsign, ac.Squawk.String())
+			lines++
 
 			// Limit to the user limit
-			if i == ps.TABList.Lines {
+			if lines == ps.TABList.Lines {
+				break
+			}
+		}
+		for _, qd := range queued {
+			if lines >= ps.TABList.Lines {
 				break
 			}
+			ac := qd.Aircraft
+			text += fmt.Sprintf("%2d %-7s %s P%s\n", sp.getAircraftIndex(ac), ac.Callsign, ac.Squawk.String(),
+				qd.ProposedTime.UTC().Format("1504"))
+			lines++
 		}
 
 		drawList(text, ps.TABList.Position)
 	}
 
 	if ps.AlertList.Visible {
-		text := "LA/CA/MCI"
-		// TODO
+		text := "LA/CA/MCI\n"
+		for _, ac := range aircraft {
+			if ac.TrackingController != sim.Callsign() {
+				continue
+			}
+			if sp.IsMSAWActive(ac) {
+				text += fmt.Sprintf("%-7s LA\n", ac.Callsign)
+			}
+			if sp.IsCAActive(ac) {
+				text += fmt.Sprintf("%-7s CA\n", ac.Callsign)
+			}
+			for _, intruder := range sp.MCIIntruders(ac) {
+				text += fmt.Sprintf("%-7s MCI %s\n", ac.Callsign, intruder.Squawk.String())
+			}
+		}
 		drawList(text, ps.AlertList.Position)
 	}
 
@@ -3125,6 +3517,19 @@ func (sp *STARSPane) drawSystemLists(aircraft []*Aircraft, ctx *PaneContext,
 		drawList(text, ps.CRDAStatusList.Position)
 	}
 
+	if ps.PIREPList.Visible {
+		// Most recent first
+		pireps := sim.PIREPs
+		text := "PIREP\n"
+		if len(pireps) > ps.PIREPList.Lines {
+			text += fmt.Sprintf("MORE: %d/%d\n", ps.PIREPList.Lines, len(pireps))
+		}
+		for i := len(pireps) - 1; i >= 0 && i >= len(pireps)-ps.PIREPList.Lines; i-- {
+			text += pireps[i].String() + "\n"
+		}
+		drawList(text, ps.PIREPList.Position)
+	}
+
 	for i, tl := range ps.TowerLists {
 		if !tl.Visible {
 			continue
@@ -3218,6 +3623,10 @@ func (sp *STARSPane) drawTracks(aircraft []*Aircraft, ctx *PaneContext, transfor
 
 	ps := sp.currentPreferenceSet
 	font := sp.systemFont[ps.CharSize.PositionSymbols]
+	symbolScale := float32(1)
+	if globalConfig.HighContrastRadar {
+		symbolScale = highContrastSymbolScale
+	}
 
 	now := sim.CurrentTime()
 	for _, ac := range aircraft {
@@ -3246,12 +3655,20 @@ func (sp *STARSPane) drawTracks(aircraft []*Aircraft, ctx *PaneContext, transfor
 		// TODO: size based on distance to radar, if not MULTI
 		box := [4][2]float32{[2]float32{-9, -3}, [2]float32{9, -3}, [2]float32{9, 3}, [2]float32{-9, 3}}
 		for i := range box {
-			box[i] = add2f(rot(box[i]), pw)
+			box[i] = add2f(rot(scale2f(box[i], symbolScale)), pw)
 			box[i] = transforms.LatLongFromWindowP(box[i])
 		}
 		color := brightness.ScaleRGB(STARSTrackBlockColor)
 		primary, secondary, _ := sp.radarVisibility(ac.TrackPosition(), ac.TrackAltitude())
-		if primary {
+		if adsbOnly() {
+			// There are no radar returns; as with fused tracks, just
+			// draw a small filled box that isn't oriented to the radar.
+			sq := [4][2]float32{[2]float32{-4, -4}, [2]float32{4, -4}, [2]float32{4, 4}, [2]float32{-4, 4}}
+			for i := range sq {
+				sq[i] = transforms.LatLongFromWindowP(add2f(scale2f(sq[i], symbolScale), pw))
+			}
+			trid.AddQuad(sq[0], sq[1], sq[2], sq[3], color)
+		} else if primary {
 			// Draw a filled box
 			trid.AddQuad(box[0], box[1], box[2], box[3], color)
 		} else if secondary {
@@ -3260,12 +3677,12 @@ func (sp *STARSPane) drawTracks(aircraft []*Aircraft, ctx *PaneContext, transfor
 			ld.AddPolyline([2]float32{}, color, box[:])
 		}
 
-		if !sp.multiRadarMode() {
+		if !sp.multiRadarMode() && !adsbOnly() {
 			// green line
 			// TODO: size based on distance to radar
 			line := [2][2]float32{[2]float32{-16, -3}, [2]float32{16, -3}}
 			for i := range line {
-				line[i] = add2f(rot(line[i]), pw)
+				line[i] = add2f(rot(scale2f(line[i], symbolScale)), pw)
 				line[i] = transforms.LatLongFromWindowP(line[i])
 			}
 			ld.AddLine(line[0], line[1], brightness.ScaleRGB(RGB{R: .1, G: .8, B: .1}))
@@ -3295,7 +3712,7 @@ func (sp *STARSPane) drawTracks(aircraft []*Aircraft, ctx *PaneContext, transfor
 				return add2ll(p, add2ll(scale2f(dx, x), scale2f(dy, y)))
 			}
 
-			px := float32(3)
+			px := 3 * symbolScale
 			// diagonals
 			diagPx := px * 0.707107                                     /* 1/sqrt(2) */
 			trackColor := brightness.ScaleRGB(RGB{R: .1, G: .7, B: .1}) // TODO make a STARS... constant
@@ -3326,17 +3743,19 @@ func (sp *STARSPane) drawTracks(aircraft []*Aircraft, ctx *PaneContext, transfor
 	}
 
 	transforms.LoadLatLongViewingMatrices(cb)
-	cb.PointSize(5)
+	cb.PointSize(5 * symbolScale)
 	pd.GenerateCommands(cb)
 	trid.GenerateCommands(cb)
+	cb.LineWidth(radarLineWidth())
 	ld.GenerateCommands(cb)
+	cb.LineWidth(1)
 	transforms.LoadWindowViewingMatrices(cb)
 	td.GenerateCommands(cb)
 }
 
 func (sp *STARSPane) updateDatablockTextAndPosition(aircraft []*Aircraft) {
 	now := sim.CurrentTime()
-	font := sp.systemFont[sp.currentPreferenceSet.CharSize.Datablocks]
+	font := sp.datablockFont()
 
 	for _, ac := range aircraft {
 		if ac.LostTrack(now) || !sp.datablockVisible(ac) {
@@ -3434,33 +3853,104 @@ func (sp *STARSPane) OutsideAirspace(ac *Aircraft) (alts [][2]int, outside bool)
 	return
 }
 
+// IsCAActive returns true if the Sim has raised a conflict alert for the
+// aircraft and alerts haven't been inhibited for it.
 func (sp *STARSPane) IsCAActive(ac *Aircraft) bool {
-	if ac.TrackAltitude() < int(sp.Facility.CA.Floor) {
+	if sp.currentPreferenceSet.DisableCAWarnings {
+		return false
+	}
+	if state, ok := sp.aircraft[ac]; ok && state.disableCAWarnings {
 		return false
 	}
+	return len(sim.ConflictAlerts(ac.Callsign)) > 0
+}
 
-	for other := range sp.aircraft {
-		if other == ac || other.TrackAltitude() < int(sp.Facility.CA.Floor) {
-			continue
-		}
+// IsMSAWActive returns true if the Sim has raised an MSAW alert for the
+// aircraft and MSAW hasn't been inhibited for it.
+func (sp *STARSPane) IsMSAWActive(ac *Aircraft) bool {
+	if sp.currentPreferenceSet.DisableMSAW {
+		return false
+	}
+	if state, ok := sp.aircraft[ac]; ok && state.disableMSAW {
+		return false
+	}
+	return sim.MSAWAlert(ac.Callsign)
+}
 
-		// No conflict alerts with aircraft established on different approaches
-		if ac.Approach != nil && other.Approach != nil && ac.Approach != other.Approach {
-			continue
-		}
+// isMCIIntruder returns true if the aircraft is an unassociated target
+// with Mode C altitude that may trigger MCI alerts.
+func (sp *STARSPane) isMCIIntruder(ac *Aircraft) bool {
+	if ac.Mode == Standby || ac.TrackingController != "" {
+		return false
+	}
+	return ac.FlightPlan == nil || ac.FlightPlan.Rules != IFR
+}
 
-		// No conflict alerts with another aircraft on an approach if we're
-		// departing (assume <1000' and no assigned approach implies this)
-		if ac.Approach == nil && ac.Altitude < 1000 && other.Approach != nil {
-			continue
+// mciInhibited returns true if MCI alerts have been inhibited for the
+// aircraft.
+func (sp *STARSPane) mciInhibited(ac *Aircraft) bool {
+	state, ok := sp.aircraft[ac]
+	return sp.currentPreferenceSet.DisableMCIWarnings || (ok && state.disableMCIWarnings)
+}
+
+// updateMCI finds the unassociated targets that are in conflict with each
+// tracked IFR aircraft. It's called for every aircraft each frame but the
+// tracks change much less often than that, so the pairs are only found
+// once a second.
+func (sp *STARSPane) updateMCI() {
+	now := time.Now()
+	if now.Sub(sp.lastMCIUpdate) < time.Second {
+		return
+	}
+	sp.lastMCIUpdate = now
+
+	sp.mciIntruders = make(map[*Aircraft][]*Aircraft)
+	sp.mciIntrudedOn = make(map[*Aircraft][]*Aircraft)
+
+	var tracked, intruders []*Aircraft
+	for ac := range sp.aircraft {
+		if sp.isMCIIntruder(ac) {
+			intruders = append(intruders, ac)
+		} else if ac.TrackingController == sim.Callsign() && ac.FlightPlan != nil && ac.FlightPlan.Rules == IFR &&
+			ac.TrackAltitude() >= int(globalConfig.ConflictAlert.Floor) {
+			tracked = append(tracked, ac)
 		}
-		// Converse of the above
-		if ac.Approach != nil && other.Altitude < 1000 && other.Approach == nil {
-			continue
+	}
+	sort.Slice(intruders, func(i, j int) bool { return intruders[i].Callsign < intruders[j].Callsign })
+
+	for _, ac := range tracked {
+		for _, other := range intruders {
+			if nmdistance2ll(ac.TrackPosition(), other.TrackPosition()) <= sp.Facility.MCI.LateralMinimum &&
+				abs(ac.TrackAltitude()-other.TrackAltitude()) <= int(sp.Facility.MCI.VerticalMinimum) {
+				sp.mciIntruders[ac] = append(sp.mciIntruders[ac], other)
+				sp.mciIntrudedOn[other] = append(sp.mciIntrudedOn[other], ac)
+			}
 		}
+	}
+}
+
+// MCIIntruders returns the unassociated targets that are in conflict
+// with the given aircraft, which must be an IFR aircraft that we are
+// tracking.
+func (sp *STARSPane) MCIIntruders(ac *Aircraft) []*Aircraft {
+	sp.updateMCI()
+	if sp.mciInhibited(ac) {
+		return nil
+	}
+	return FilterSlice(sp.mciIntruders[ac], func(other *Aircraft) bool { return !sp.mciInhibited(other) })
+}
 
-		if nmdistance2ll(ac.TrackPosition(), other.TrackPosition()) <= sp.Facility.CA.LateralMinimum &&
-			abs(ac.TrackAltitude()-other.TrackAltitude()) <= int(sp.Facility.CA.VerticalMinimum-50 /*small slop for fp error*/) {
+// IsMCIActive returns true if the aircraft is either a tracked IFR
+// aircraft with a Mode C intruder or is itself an intruder.
+func (sp *STARSPane) IsMCIActive(ac *Aircraft) bool {
+	if len(sp.MCIIntruders(ac)) > 0 {
+		return true
+	}
+	if sp.mciInhibited(ac) {
+		return false
+	}
+	for _, other := range sp.mciIntrudedOn[ac] {
+		if !sp.mciInhibited(other) {
 			return true
 		}
 	}
@@ -3482,9 +3972,15 @@ func (sp *STARSPane) formatDatablock(ac *Aircraft) (errblock string, mainblock [
 	} else if ac.Squawk == Squawk(0o1236) {
 		errs = append(errs, "SA")
 	}
+	if sp.IsMSAWActive(ac) {
+		errs = append(errs, "LA")
+	}
 	if sp.IsCAActive(ac) {
 		errs = append(errs, "CA")
 	}
+	if sp.IsMCIActive(ac) {
+		errs = append(errs, "MCI")
+	}
 	if alts, outside := sp.OutsideAirspace(ac); outside {
 		altStrs := ""
 		for _, a := range alts {
@@ -3492,7 +3988,6 @@ func (sp *STARSPane) formatDatablock(ac *Aircraft) (errblock string, mainblock [
 		}
 		errs = append(errs, "AS"+altStrs)
 	}
-	// TODO: LA
 	errblock = strings.Join(errs, "/") // want e.g., EM/LA if multiple things going on
 
 	if ac.Mode == Standby {
@@ -3543,6 +4038,9 @@ func (sp *STARSPane) formatDatablock(ac *Aircraft) (errblock string, mainblock [
 		if _, ok := sp.pointedOutAircraft.Get(ac); ok {
 			cs += " PO"
 		}
+		if len(sim.SimilarCallsignsOnFrequency(ac.Callsign)) > 0 {
+			cs += " SC"
+		}
 		mainblock[0] = append(mainblock[0], cs)
 		mainblock[1] = append(mainblock[1], cs)
 
@@ -3571,6 +4069,8 @@ func (sp *STARSPane) formatDatablock(ac *Aircraft) (errblock string, mainblock [
 		arrscr := ac.FlightPlan.ArrivalAirport
 		if ac.Scratchpad != "" {
 			arrscr = ac.Scratchpad
+		} else if ac.ArrivalRunway != "" {
+			arrscr = ac.ArrivalRunway
 		}
 
 		actype := ac.FlightPlan.TypeWithoutSuffix()
@@ -3594,6 +4094,29 @@ func (sp *STARSPane) formatDatablock(ac *Aircraft) (errblock string, mainblock [
 		}
 
 		mainblock[1] = append(mainblock[1], arrscr+ho+actype+suffix)
+
+		// Downlinked selected altitude and IAS, if available; the
+		// selected altitude is flagged if it doesn't match the altitude
+		// the controller has entered.
+		if t := ac.Tracks[0]; sp.ShowDownlinkedData && t.IAS != 0 {
+			sel := "S---"
+			if t.SelectedAltitude != 0 {
+				sel = fmt.Sprintf("S%03d", (t.SelectedAltitude+50)/100)
+				if ac.TempAltitude != 0 && ac.TempAltitude != t.SelectedAltitude {
+					sel += "*"
+				}
+			}
+			ds := fmt.Sprintf("%s I%03d", sel, t.IAS)
+			mainblock[0] = append(mainblock[0], ds)
+			mainblock[1] = append(mainblock[1], ds)
+		}
+
+		if sp.ShowAssignments && sim.AssistsEnabled() && ac.TrackingController == sim.Callsign() {
+			if as := formatAssignments(ac); as != "" {
+				mainblock[0] = append(mainblock[0], as)
+				mainblock[1] = append(mainblock[1], as)
+			}
+		}
 	}
 
 	if ac.TempAltitude != 0 {
@@ -3603,6 +4126,260 @@ func (sp *STARSPane) formatDatablock(ac *Aircraft) (errblock string, mainblock [
 		mainblock[1] = append(mainblock[1], tastr)
 	}
 
+	if d, ok := sim.ActiveDeviation(ac.Callsign); ok && ty == FullDatablock {
+		dev := "DEV " + d.Type.Abbreviation()
+		mainblock[0] = append(mainblock[0], dev)
+		mainblock[1] = append(mainblock[1], dev)
+	}
+
+	if ty == FullDatablock {
+		for _, alert := range sim.ActiveUserAlerts(ac.Callsign) {
+			mainblock[0] = append(mainblock[0], alert.Name)
+			mainblock[1] = append(mainblock[1], alert.Name)
+		}
+	}
+
+	if ty == FullDatablock &&
+		FindIf(sp.dependentPairs, func(p DependentPair) bool { return p.Trail == ac && p.PredictedViolation() }) != -1 {
+		mainblock[0] = append(mainblock[0], "DIAG")
+		mainblock[1] = append(mainblock[1], "DIAG")
+	}
+
+	if id, ok := sp.handoffReminders[ac]; ok && ty == FullDatablock {
+		ho := strings.TrimSpace("HO " + id)
+		mainblock[0] = append(mainblock[0], ho)
+		mainblock[1] = append(mainblock[1], ho)
+	}
+
+	if adv, ok := sp.speedAdvisories[ac]; ok && ty == FullDatablock {
+		mainblock[0] = append(mainblock[0], adv)
+		mainblock[1] = append(mainblock[1], adv)
+	}
+
+	return
+}
+
+// formatAssignments returns a summary of the aircraft's current
+// clearance: e.g., "A040 H270 S180 CI22L" for an aircraft assigned 4,000',
+// heading 270, and 180 knots that has been cleared for the ILS 22L
+// approach. (The "C" prefix is omitted if it has only been told to
+// expect the approach.) Aircraft cleared to descend via a STAR or climb
+// via a SID show the procedure's bottom or top altitude with a "DV" or
+// "CV" prefix, e.g. "DV060".
+func formatAssignments(ac *Aircraft) string {
+	var s []string
+	if ac.AssignedAltitude != 0 {
+		s = append(s, fmt.Sprintf("A%03d", ac.AssignedAltitude/100))
+	} else if ac.DescendVia {
+		s = append(s, fmt.Sprintf("DV%03d", ac.ViaAltitude/100))
+	} else if ac.ClimbVia {
+		s = append(s, fmt.Sprintf("CV%03d", ac.ViaAltitude/100))
+	}
+	if ac.AssignedHeading != 0 {
+		s = append(s, fmt.Sprintf("H%03d", ac.AssignedHeading))
+	}
+	if ac.AssignedSpeed != 0 {
+		s = append(s, fmt.Sprintf("S%03d", ac.AssignedSpeed))
+	}
+	if ap := ac.Approach; ap != nil {
+		appr := "I"
+		if ap.Type == RNAVApproach {
+			appr = "R"
+		}
+		appr += approachRunway(ap)
+		if ac.ClearedApproach {
+			appr = "C" + appr
+		}
+		s = append(s, appr)
+	}
+	return strings.Join(s, " ")
+}
+
+// updateSpeedAdvisories runs the final approach spacing assistant: for
+// each pair of successive arrivals to the same runway, it finds the speed
+// the trailing aircraft would need to fly so that it is at the target
+// spacing when the leading aircraft reaches the threshold. Advisories are
+// only given for aircraft that we are tracking and where the required
+// speed differs meaningfully from the current one.
+func (sp *STARSPane) updateSpeedAdvisories(aircraft []*Aircraft) {
+	sp.speedAdvisories = make(map[*Aircraft]string)
+	if !sp.SpacingAssistant.Enabled || !sim.AssistsEnabled() {
+		return
+	}
+
+	type arrival struct {
+		ac       *Aircraft
+		distance float32 // to the threshold, along the projected path
+	}
+	// Arrivals are grouped by runway threshold so that aircraft on
+	// different approaches to the same runway are sequenced together.
+	runways := make(map[Point2LL][]arrival)
+	for _, ac := range aircraft {
+		if ac.Approach == nil || ac.Rollout != nil {
+			continue
+		}
+		if path, ok := ac.ProjectedApproachPath(ac.Approach); ok {
+			thresh := path[len(path)-1]
+			runways[thresh] = append(runways[thresh], arrival{ac: ac, distance: nmpathlength2ll(path)})
+		}
+	}
+
+	for _, arrivals := range runways {
+		sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].distance < arrivals[j].distance })
+
+		for i := 1; i < len(arrivals); i++ {
+			lead, ac := arrivals[i-1], arrivals[i].ac
+			if ac.TrackingController != sim.Callsign() || lead.ac.GS < 1 {
+				continue
+			}
+
+			// Time (in hours) until the leader lands and the groundspeed
+			// we'd need to be at the target spacing then.
+			t := lead.distance / lead.ac.GS
+			gs := (arrivals[i].distance - sp.SpacingAssistant.Spacing) / t
+			// Account for wind and altitude by assuming that the
+			// difference between groundspeed and IAS stays the same.
+			ias := int(gs-(ac.GS-ac.IAS)+5) / 10 * 10
+
+			if ias < ac.Performance.Speed.Landing {
+				sp.speedAdvisories[ac] = "EXTEND"
+			} else if ias = min(ias, ac.Performance.Speed.Max); abs(float32(ias)-ac.IAS) >= 10 {
+				sp.speedAdvisories[ac] = fmt.Sprintf("S%d", ias)
+			}
+		}
+	}
+}
+
+// updateDependentSpacing finds the pairs of aircraft on dependent
+// approaches; the conflict alert sound is played when a pair is first
+// predicted to lose diagonal separation.
+func (sp *STARSPane) updateDependentSpacing(aircraft []*Aircraft) {
+	sp.dependentPairs = nil
+	if !sp.DependentSpacing.Enabled || sim.Scenario == nil || !sim.AssistsEnabled() {
+		return
+	}
+
+	alerts := make(map[[2]*Aircraft]interface{})
+	for i := range sim.Scenario.DependentApproaches {
+		for _, p := range sim.Scenario.DependentApproaches[i].Pairs(aircraft) {
+			sp.dependentPairs = append(sp.dependentPairs, p)
+			if p.PredictedViolation() {
+				key := [2]*Aircraft{p.Lead, p.Trail}
+				if _, ok := sp.dependentAlerts[key]; !ok && p.Trail.TrackingController == sim.Callsign() {
+					globalConfig.Audio.PlaySound(AudioEventConflictAlert)
+				}
+				alerts[key] = nil
+			}
+		}
+	}
+	sp.dependentAlerts = alerts
+}
+
+// drawDependentSpacing draws a line between each pair of aircraft on
+// dependent approaches, labeled with the current diagonal distance and
+// the minimum; pairs that are predicted to lose separation are drawn in
+// the alert color.
+func (sp *STARSPane) drawDependentSpacing(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
+	if len(sp.dependentPairs) == 0 {
+		return
+	}
+
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+	ld := GetColoredLinesDrawBuilder()
+	defer ReturnColoredLinesDrawBuilder(ld)
+
+	ps := sp.currentPreferenceSet
+	for _, p := range sp.dependentPairs {
+		color := ps.Brightness.Lines.RGB()
+		if p.PredictedViolation() {
+			color = STARSTextAlertColor
+		}
+		style := TextStyle{
+			Font:           sp.systemFont[ps.CharSize.Tools],
+			Color:          color,
+			DrawBackground: true,
+		}
+
+		p0, p1 := p.Lead.TrackPosition(), p.Trail.TrackPosition()
+		text := fmt.Sprintf("%.1f/%.1f", p.Distance, p.Required)
+		td.AddTextCentered(text, transforms.WindowFromLatLongP(mid2ll(p0, p1)), style)
+		ld.AddLine(p0, p1, color)
+	}
+
+	transforms.LoadLatLongViewingMatrices(cb)
+	ld.GenerateCommands(cb)
+	transforms.LoadWindowViewingMatrices(cb)
+	td.GenerateCommands(cb)
+}
+
+// updateHandoffReminders finds the aircraft we're tracking that are in
+// our sector, haven't been handed off, and will leave the sector within
+// the reminder time along their predicted paths.
+func (sp *STARSPane) updateHandoffReminders(aircraft []*Aircraft) {
+	sp.handoffReminders = make(map[*Aircraft]string)
+	if !sp.HandoffReminders.Enabled || sim.Scenario == nil || !sim.AssistsEnabled() {
+		return
+	}
+	sector, ok := sim.Scenario.Sectors[sim.Callsign()]
+	if !ok || len(sector.Airspace) == 0 {
+		return
+	}
+
+	for _, ac := range aircraft {
+		if ac.TrackingController != sim.Callsign() || ac.OutboundHandoffController != "" ||
+			!ac.HaveHeading() || ac.TrackGroundspeed() < 40 {
+			continue
+		}
+		if in, _ := InAirspace(ac.TrackPosition(), float32(ac.TrackAltitude()), sector.Airspace); !in {
+			continue
+		}
+
+		const step = 10 // seconds
+		path, alts := ac.PredictedPath(float32(sp.HandoffReminders.Seconds), step)
+		for i, p := range path {
+			if in, _ := InAirspace(p, alts[i], sector.Airspace); in {
+				continue
+			}
+
+			// It's leaving; suggest the controller for the closest
+			// handoff point.
+			id, dist := "", float32(0)
+			for _, hp := range sector.HandoffPoints {
+				if d := nmdistance2ll(p, hp.Location); id == "" || d < dist {
+					id, dist = hp.Controller, d
+					if ctrl := sim.GetController(hp.Controller); ctrl != nil {
+						id = ctrl.SectorId
+					}
+				}
+			}
+			sp.handoffReminders[ac] = id
+			break
+		}
+	}
+}
+
+// TransmissionPosition returns the stereo pan and volume for a pilot
+// transmission from the given aircraft. Transmissions are panned only
+// partway to the side the aircraft is on so that they remain easy to
+// hear, and those from aircraft outside the displayed range fade out
+// until they are at a quarter of full volume at three times the range.
+func (sp *STARSPane) TransmissionPosition(ac *Aircraft) (pan float32, volume float32) {
+	const maxPan = 0.6
+
+	ps := sp.currentPreferenceSet
+	if ps.Range == 0 {
+		return 0, 1
+	}
+
+	// Offset in nm from the center of the scope, accounting for the
+	// scope's rotation for magnetic variation.
+	rot := rotator2f(scenarioGroup.MagneticVariation)
+	v := rot(sub2f(ll2nm(ac.TrackPosition()), ll2nm(ps.currentCenter)))
+
+	pan = maxPan * clamp(v[0]/ps.Range, -1, 1)
+	d := length2f(v) / ps.Range
+	volume = clamp(1-.375*(d-1), .25, 1)
 	return
 }
 
@@ -3610,13 +4387,34 @@ func (sp *STARSPane) datablockColor(ac *Aircraft) RGB {
 	// TODO: when do we use Brightness.LimitedDatablocks?
 	ps := sp.currentPreferenceSet
 	br := ps.Brightness.FullDatablocks
+	if globalConfig.HighContrastRadar {
+		br = 100
+	}
 	state := sp.aircraft[ac]
 
+	// Datablocks of aircraft in conflict alert or MSAW alert or that match
+	// one of the user's alerts flash; this is handled below for the ones
+	// that already flash for other reasons.
+	alerted := sp.IsCAActive(ac) || sp.IsMSAWActive(ac) ||
+		FindIf(sim.ActiveUserAlerts(ac.Callsign), func(a *UserAlert) bool { return a.Flash }) != -1
+	if alerted && ac.TrackingController != sim.Callsign() && ac.InboundHandoffController != sim.Callsign() &&
+		time.Now().Second()&1 == 0 {
+		br /= 3
+	}
+
 	if _, ok := sp.pointedOutAircraft.Get(ac); ok {
 		// yellow for pointed out
 		return br.ScaleRGB(STARSPointedOutAircraftColor)
 	} else if ac.TrackingController == sim.Callsign() {
-		// white if we are tracking, unless it's selected
+		// white if we are tracking, unless it's selected; flashing if it
+		// needs to be handed off soon or the pilot has deviated
+		// from its clearance.
+		_, remind := sp.handoffReminders[ac]
+		_, deviated := sim.ActiveDeviation(ac.Callsign)
+		mci := len(sp.MCIIntruders(ac)) > 0
+		if (remind || deviated || mci || alerted) && time.Now().Second()&1 == 0 {
+			br /= 3
+		}
 		if state.isSelected {
 			return br.ScaleRGB(STARSSelectedAircraftColor)
 		} else {
@@ -3652,7 +4450,7 @@ func (sp *STARSPane) drawDatablocks(aircraft []*Aircraft, ctx *PaneContext,
 	now := sim.CurrentTime()
 	realNow := time.Now() // for flashing rate...
 	ps := sp.currentPreferenceSet
-	font := sp.systemFont[ps.CharSize.Datablocks]
+	font := sp.datablockFont()
 
 	for _, ac := range aircraft {
 		if ac.LostTrack(now) || !sp.datablockVisible(ac) {
@@ -3692,7 +4490,9 @@ func (sp *STARSPane) drawDatablocks(aircraft []*Aircraft, ctx *PaneContext,
 
 	transforms.LoadWindowViewingMatrices(cb)
 	td.GenerateCommands(cb)
+	cb.LineWidth(radarLineWidth())
 	ld.GenerateCommands(cb)
+	cb.LineWidth(1)
 }
 
 func (sp *STARSPane) drawPTLs(aircraft []*Aircraft, ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
@@ -3713,19 +4513,68 @@ func (sp *STARSPane) drawPTLs(aircraft []*Aircraft, ctx *PaneContext, transforms
 			continue
 		}
 
-		// convert PTL length (minutes) to estimated distance a/c will travel
-		dist := float32(ac.TrackGroundspeed()) / 60 * ps.PTLLength
+		// Follow the aircraft's predicted path for the PTL length
+		// (minutes) so that turns and route changes that are underway
+		// are reflected in the line.
+		path, _ := ac.PredictedPath(60*ps.PTLLength, 5)
+		prev := ac.TrackPosition()
+		for _, p := range path {
+			ld.AddLine(prev, p, color)
+			prev = p
+		}
+	}
 
-		// h is a vector in nm coordinates with length l=dist
-		hdg := ac.TrackHeading() - scenarioGroup.MagneticVariation
-		h := [2]float32{sin(radians(hdg)), cos(radians(hdg))}
-		h = scale2f(h, dist)
-		end := add2ll(ac.TrackPosition(), nm2ll(h))
+	transforms.LoadLatLongViewingMatrices(cb)
+	ld.GenerateCommands(cb)
+}
 
-		ld.AddLine(ac.TrackPosition(), end, color)
+// drawDeadReckoning draws each aircraft's predicted path along with its
+// predicted positions at one-minute intervals when the Sim is paused or
+// the aircraft's track is coasting. A coasting track's current position is
+// also estimated and marked.
+func (sp *STARSPane) drawDeadReckoning(aircraft []*Aircraft, ctx *PaneContext, transforms ScopeTransformations,
+	cb *CommandBuffer) {
+	if !sp.DeadReckoning.Enabled || !sim.AssistsEnabled() {
+		return
 	}
 
-	transforms.LoadLatLongViewingMatrices(cb)
+	ld := GetColoredLinesDrawBuilder()
+	defer ReturnColoredLinesDrawBuilder(ld)
+
+	ps := sp.currentPreferenceSet
+	color := ps.Brightness.Positions.ScaleRGB(STARSTrackBlockColor).Scale(.4)
+
+	const step = 5 // seconds
+	now := sim.CurrentTime()
+	for _, ac := range aircraft {
+		if ac.LostTrack(now) || !ac.HaveHeading() {
+			continue
+		}
+		// Time since the last track update, if the track is coasting.
+		var elapsed float32
+		if dt := now.Sub(ac.Tracks[0].Time); dt > 2*sim.TrackInterval() {
+			elapsed = float32(dt.Seconds())
+		} else if !sim.Paused {
+			continue
+		}
+
+		path, _ := ac.PredictedPath(elapsed+60*float32(sp.DeadReckoning.Minutes), step)
+		prev := transforms.WindowFromLatLongP(ac.TrackPosition())
+		for i, p := range path {
+			pw := transforms.WindowFromLatLongP(p)
+			ld.AddLine(prev, pw, color)
+			prev = pw
+
+			// Mark the estimated current position of a coasting track and
+			// then each minute after it.
+			t := float32(step * (i + 1))
+			if t >= elapsed && int(t-elapsed)%60 < step && (elapsed > 0 || t >= 60) {
+				ld.AddCircle(pw, 3, 8, color)
+			}
+		}
+	}
+
+	transforms.LoadWindowViewingMatrices(cb)
 	ld.GenerateCommands(cb)
 }
 
@@ -3868,6 +4717,162 @@ func (sp *STARSPane) drawRBLs(ctx *PaneContext, transforms ScopeTransformations,
 	td.GenerateCommands(cb)
 }
 
+func (sp *STARSPane) assignVectorRoute() (status STARSCommandStatus) {
+	route := sp.vectorRoute
+	if len(route.points) == 0 {
+		status.err = ErrSTARSIllegalParam
+		return
+	}
+
+	if err := sim.AssignVectors(route.ac.Callsign, route.points); err != nil {
+		if err == ErrNoAircraftForCallsign {
+			status.err = ErrSTARSIllegalTrack
+		} else {
+			status.err = ErrSTARSIllegalParam
+		}
+		globalConfig.Audio.PlaySound(AudioEventCommandError)
+		return
+	}
+
+	status.clear = true
+	return
+}
+
+// Draw the route that is being specified with the vector tool; the
+// segment from the last point to the mouse cursor is drawn as well so
+// that the user can see where the next leg will go.
+func (sp *STARSPane) drawVectorRoute(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
+	route := sp.vectorRoute
+	if route == nil {
+		return
+	}
+	if _, ok := sp.aircraft[route.ac]; !ok {
+		// The aircraft has been deleted.
+		sp.resetInputState()
+		return
+	}
+
+	ld := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(ld)
+
+	prev := route.ac.TrackPosition()
+	for _, p := range route.points {
+		ld.AddLine(prev, p)
+		prev = p
+	}
+	if ctx.mouse != nil {
+		ld.AddLine(prev, transforms.LatLongFromWindowP(ctx.mouse.Pos))
+	}
+
+	ps := sp.currentPreferenceSet
+	cb.LineWidth(1)
+	cb.SetRGB(ps.Brightness.Lines.RGB())
+	transforms.LoadLatLongViewingMatrices(cb)
+	ld.GenerateCommands(cb)
+}
+
+// pendingApproachClearance returns the name of the approach if the
+// controller has started to enter a cleared approach command in the
+// preview area.
+func (sp *STARSPane) pendingApproachClearance() (string, bool) {
+	if sp.commandMode != CommandModeNone {
+		return "", false
+	}
+	for _, command := range strings.Fields(sp.previewAreaInput) {
+		if len(command) > 2 && command[0] == 'C' {
+			if _, err := strconv.Atoi(command[1:]); err != nil {
+				return command[1:], true
+			}
+		}
+	}
+	return "", false
+}
+
+// drawApproachProjection draws a "what-if" projection of the path that the
+// aircraft under the mouse would fly if it were cleared for the approach
+// that is being entered in the preview area. The point where it would join
+// the approach is labeled with the spacing to the preceding aircraft on the
+// same approach at that time and a ghost of the preceding aircraft is
+// drawn at its projected position.
+func (sp *STARSPane) drawApproachProjection(aircraft []*Aircraft, ctx *PaneContext, transforms ScopeTransformations,
+	cb *CommandBuffer) {
+	if ctx.mouse == nil {
+		return
+	}
+	approach, ok := sp.pendingApproachClearance()
+	if !ok {
+		return
+	}
+	ac := sp.tryGetClickedAircraft(ctx.mouse.Pos, transforms)
+	if ac == nil {
+		return
+	}
+	ap, _, err := sim.getApproach(ac.Callsign, approach)
+	if err != nil {
+		return
+	}
+	path, ok := ac.ProjectedApproachPath(ap)
+	if !ok {
+		return
+	}
+
+	ld := GetColoredLinesDrawBuilder()
+	defer ReturnColoredLinesDrawBuilder(ld)
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	ps := sp.currentPreferenceSet
+	color := ps.Brightness.Lines.ScaleRGB(STARSGhostColor)
+	for i := 0; i+1 < len(path); i++ {
+		ld.AddLine(transforms.WindowFromLatLongP(path[i]), transforms.WindowFromLatLongP(path[i+1]), color)
+	}
+	pjoin := transforms.WindowFromLatLongP(path[1])
+	ld.AddCircle(pjoin, 5, 16, color)
+
+	// Find how long until the aircraft joins the approach and how far it
+	// will then be from the threshold.
+	hours := nmdistance2ll(path[0], path[1]) / max(ac.GS, 1)
+	joinDistance := nmpathlength2ll(path[1:])
+
+	// The preceding aircraft is the one that will be closest to the
+	// threshold without being past it.
+	var leadPath []Point2LL
+	leadDistance := float32(0)
+	for _, other := range aircraft {
+		if other == ac || other.Approach == nil ||
+			(other.Approach.FullName != ap.FullName && !sim.onSharedFinal(ac, other)) {
+			continue
+		}
+		if otherPath, ok := other.ProjectedApproachPath(ap); ok {
+			d := nmpathlength2ll(otherPath) - other.GS*hours
+			if d > 0 && d < joinDistance && d > leadDistance {
+				leadPath, leadDistance = otherPath, d
+			}
+		}
+	}
+
+	if leadPath != nil {
+		pghost := transforms.WindowFromLatLongP(nmpathpoint2ll(leadPath, leadDistance))
+		ld.AddCircle(pghost, 5, 16, color)
+
+		spacing := joinDistance - leadDistance
+		style := TextStyle{
+			Font:           sp.systemFont[ps.CharSize.Tools],
+			Color:          color,
+			DrawBackground: true,
+		}
+		if spacing < globalConfig.ConflictAlert.LateralMinimum {
+			style.Color = ps.Brightness.Lines.ScaleRGB(STARSTextAlertColor)
+		}
+		td.AddText(fmt.Sprintf("%.1f", spacing), add2f(pjoin, [2]float32{8, 8}), style)
+	}
+
+	transforms.LoadWindowViewingMatrices(cb)
+	cb.LineWidth(1)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
+
 // Draw the minimum separation line between two aircraft, if selected.
 func (sp *STARSPane) drawMinSep(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
 	ac0, ac1 := sp.minSepAircraft[0], sp.minSepAircraft[1]
@@ -3888,12 +4893,17 @@ func (sp *STARSPane) drawCARings(ctx *PaneContext, transforms ScopeTransformatio
 	defer ReturnLinesDrawBuilder(ld)
 
 	for ac := range sp.aircraft {
+		if len(sp.MCIIntruders(ac)) > 0 && time.Since(sp.lastCASoundTime) > 2*time.Second {
+			globalConfig.Audio.PlaySound(AudioEventConflictAlert)
+			sp.lastCASoundTime = time.Now()
+		}
+
 		if !sp.IsCAActive(ac) {
 			continue
 		}
 
 		pc := transforms.WindowFromLatLongP(ac.TrackPosition())
-		radius := sp.Facility.CA.LateralMinimum / transforms.PixelDistanceNM()
+		radius := globalConfig.ConflictAlert.LateralMinimum / transforms.PixelDistanceNM()
 		ld.AddCircle(pc, radius, 360 /* nsegs */)
 
 		if time.Since(sp.lastCASoundTime) > 2*time.Second {
@@ -3953,6 +4963,201 @@ func (sp *STARSPane) drawAirspace(ctx *PaneContext, transforms ScopeTransformati
 	ld.GenerateCommands(cb)
 	transforms.LoadWindowViewingMatrices(cb)
 	td.GenerateCommands(cb)
+
+	if sp.drawSectors {
+		sp.drawSectorBoundaries(ctx, transforms, cb)
+	}
+}
+
+// drawSpecialOperations draws the airspace blocked by active special
+// operations (TFRs, parachute jumping, etc.), labeled with the altitudes
+// and the type of operation.
+func (sp *STARSPane) drawSpecialOperations(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
+	ld := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(ld)
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	ps := sp.currentPreferenceSet
+	style := TextStyle{
+		Font:           sp.systemFont[ps.CharSize.Tools],
+		Color:          ps.Brightness.Lists.ScaleRGB(STARSTextAlertColor),
+		DrawBackground: true,
+	}
+
+	now := sim.CurrentTime()
+	for _, op := range sim.SpecialOperations {
+		if op.RadiusNM == 0 || !op.Active(now) {
+			continue
+		}
+		pc := transforms.WindowFromLatLongP(op.Center)
+		ld.AddCircle(pc, op.RadiusNM/transforms.PixelDistanceNM(), 360 /* nsegs */)
+
+		label := fmt.Sprintf("%s\n%03d-%03d", strings.ToUpper(op.Type.String()), op.Floor/100, op.Ceiling/100)
+		td.AddTextCentered(label, pc, style)
+	}
+
+	transforms.LoadWindowViewingMatrices(cb)
+	cb.SetRGB(ps.Brightness.Lines.ScaleRGB(STARSTextAlertColor))
+	cb.LineWidth(1)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
+
+// runwayConfiguration returns a summary of the active arrival and
+// departure runways at each airport, e.g., "JFK A22L/22R D31L".
+func (sp *STARSPane) runwayConfiguration() string {
+	if sim.Scenario == nil {
+		return ""
+	}
+	arr, dep := make(map[string][]string), make(map[string][]string)
+	for _, rwy := range sim.Scenario.ArrivalRunways {
+		if Find(arr[rwy.Airport], rwy.Runway) == -1 {
+			arr[rwy.Airport] = append(arr[rwy.Airport], rwy.Runway)
+		}
+	}
+	for _, rwy := range sim.Scenario.DepartureRunways {
+		if Find(dep[rwy.Airport], rwy.Runway) == -1 {
+			dep[rwy.Airport] = append(dep[rwy.Airport], rwy.Runway)
+		}
+	}
+
+	airports := make(map[string]interface{})
+	for ap := range arr {
+		airports[ap] = nil
+	}
+	for ap := range dep {
+		airports[ap] = nil
+	}
+
+	var lines []string
+	for _, ap := range SortedMapKeys(airports) {
+		s := strings.TrimPrefix(ap, "K")
+		if r := arr[ap]; len(r) > 0 {
+			s += " A" + strings.Join(r, "/")
+		}
+		if r := dep[ap]; len(r) > 0 {
+			s += " D" + strings.Join(r, "/")
+		}
+		lines = append(lines, s)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// drawSIGMETs draws the areas covered by active SIGMETs and AIRMETs,
+// labeled with their ids and altitudes. Convective SIGMETs are drawn in
+// the alert color.
+func (sp *STARSPane) drawSIGMETs(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
+	ld := GetColoredLinesDrawBuilder()
+	defer ReturnColoredLinesDrawBuilder(ld)
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	ps := sp.currentPreferenceSet
+	now := sim.CurrentTime()
+	for _, sig := range sim.ActiveSIGMETs() {
+		color := STARSJRingConeColor
+		if sig.Type == "convective" {
+			color = STARSTextAlertColor
+		}
+
+		area := sig.Area(sim.scheduleStart, now)
+		e := EmptyExtent2D()
+		for i := range area {
+			e = Union(e, area[i])
+			if i < len(area)-1 {
+				ld.AddLine(area[i], area[i+1], ps.Brightness.Lines.ScaleRGB(color))
+			}
+		}
+
+		style := TextStyle{
+			Font:           sp.systemFont[ps.CharSize.Tools],
+			Color:          ps.Brightness.Lists.ScaleRGB(color),
+			DrawBackground: true,
+		}
+		label := fmt.Sprintf("%s\n%03d-%03d", sig.Label(), sig.Floor/100, sig.Tops/100)
+		td.AddTextCentered(label, transforms.WindowFromLatLongP(e.Center()), style)
+	}
+
+	transforms.LoadLatLongViewingMatrices(cb)
+	cb.LineWidth(1)
+	ld.GenerateCommands(cb)
+	transforms.LoadWindowViewingMatrices(cb)
+	td.GenerateCommands(cb)
+}
+
+// drawSectorBoundaries draws the boundaries of all of the sectors defined
+// for the scenario group, shading the user's sector and labeling the
+// others with their sector ids. Standard handoff points from the user's
+// sector are also drawn, along with the handoff altitude and the sector
+// that the aircraft should be handed off to.
+func (sp *STARSPane) drawSectorBoundaries(ctx *PaneContext, transforms ScopeTransformations, cb *CommandBuffer) {
+	ld := GetLinesDrawBuilder()
+	defer ReturnLinesDrawBuilder(ld)
+	hpld := GetLinesDrawBuilder() // handoff points, in window coordinates
+	defer ReturnLinesDrawBuilder(hpld)
+	trid := GetTrianglesDrawBuilder()
+	defer ReturnTrianglesDrawBuilder(trid)
+	td := GetTextDrawBuilder()
+	defer ReturnTextDrawBuilder(td)
+
+	ps := sp.currentPreferenceSet
+	style := TextStyle{
+		Font:           sp.systemFont[ps.CharSize.Tools],
+		Color:          ps.Brightness.Lists.ScaleRGB(STARSListColor),
+		DrawBackground: true,
+	}
+
+	for _, callsign := range SortedMapKeys(sim.Scenario.Sectors) {
+		sector := sim.Scenario.Sectors[callsign]
+
+		e := EmptyExtent2D()
+		for _, v := range sector.Airspace {
+			for _, pts := range v.Boundaries {
+				for i := range pts {
+					e = Union(e, pts[i])
+					if i < len(pts)-1 {
+						ld.AddLine(pts[i], pts[i+1])
+					}
+				}
+			}
+		}
+
+		if callsign == sim.Callsign() {
+			for _, tri := range sector.triangles {
+				trid.AddTriangle(tri[0], tri[1], tri[2])
+			}
+
+			for _, hp := range sector.HandoffPoints {
+				pw := transforms.WindowFromLatLongP(hp.Location)
+				hpld.AddCircle(pw, 5, 4) // diamond
+
+				id := hp.Controller
+				if ctrl := sim.GetController(hp.Controller); ctrl != nil {
+					id = ctrl.SectorId
+				}
+				pt := add2f(pw, [2]float32{7, -7})
+				td.AddText(fmt.Sprintf("%s %s %03d", hp.Fix, id, hp.Altitude/100), pt, style)
+			}
+		} else if len(sector.Airspace) > 0 {
+			id := callsign
+			if ctrl := sim.GetController(callsign); ctrl != nil {
+				id = ctrl.SectorId
+			}
+			td.AddTextCentered(id, transforms.WindowFromLatLongP(e.Center()), style)
+		}
+	}
+
+	transforms.LoadLatLongViewingMatrices(cb)
+	cb.Blend()
+	cb.SetRGBA(STARSOwnSectorColor)
+	trid.GenerateCommands(cb)
+	cb.DisableBlend()
+	cb.SetRGB(ps.Brightness.Lines.ScaleRGB(STARSListColor))
+	ld.GenerateCommands(cb)
+	transforms.LoadWindowViewingMatrices(cb)
+	hpld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
 }
 
 func (sp *STARSPane) consumeMouseEvents(ctx *PaneContext, transforms ScopeTransformations) {
@@ -4277,6 +5482,8 @@ func (sp *STARSPane) resetInputState() {
 	sp.multiFuncPrefix = ""
 
 	sp.scopeClickHandler = nil
+	sp.vectorRoute = nil
+	sp.commandSuggestion = nil
 }
 
 func (sp *STARSPane) multiRadarMode() bool {
@@ -4322,6 +5529,15 @@ func (sp *STARSPane) visibleAircraft() []*Aircraft {
 			}
 		}
 
+		if adsbOnly() {
+			// Radar coverage doesn't matter, just whether we're
+			// getting reports from the aircraft.
+			if ac.HaveTrack() {
+				aircraft = append(aircraft, ac)
+			}
+			continue
+		}
+
 		for id, site := range scenarioGroup.RadarSites {
 			if !multi && ps.RadarSiteSelected != id {
 				continue
@@ -0,0 +1,56 @@
+// surveillance.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// Scenarios may specify ADS-B only surveillance rather than radar. In
+// that case, tracks are updated once a second rather than with each
+// radar sweep, there is no coasting--a track is dropped as soon as
+// reports stop--and only aircraft that are ADS-B equipped are visible at
+// all, regardless of radar coverage.
+
+const (
+	radarTrackInterval  = 5 * time.Second
+	adsbTrackInterval   = time.Second
+	adsbLostTrackTime   = 3 * adsbTrackInterval
+	radarLostTrackTime  = 30 * time.Second
+	defaultADSBEquipage = 0.9
+)
+
+// ADSBOnly returns true if the scenario uses ADS-B only surveillance.
+func (s *Scenario) ADSBOnly() bool {
+	return s.Surveillance == "adsb"
+}
+
+// adsbOnly returns true if the current sim uses ADS-B only surveillance.
+func adsbOnly() bool {
+	return sim != nil && sim.Scenario != nil && sim.Scenario.ADSBOnly()
+}
+
+// TrackInterval returns the time between track updates.
+func (sim *Sim) TrackInterval() time.Duration {
+	if sim.Scenario.ADSBOnly() {
+		return adsbTrackInterval
+	}
+	return radarTrackInterval
+}
+
+// lostTrackTime returns how long a track is kept after the last report
+// for the aircraft.
+func lostTrackTime() time.Duration {
+	if adsbOnly() {
+		return adsbLostTrackTime
+	}
+	return radarLostTrackTime
+}
+
+// Surveilled returns true if a track should be generated for the given
+// aircraft.
+func (sim *Sim) Surveilled(ac *Aircraft) bool {
+	return !sim.Scenario.ADSBOnly() || ac.ADSBEquipped
+}
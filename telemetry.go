@@ -0,0 +1,159 @@
+// telemetry.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// If the user opts in, vice sends a report when it crashes--on the main
+// thread or in any of its goroutines--and a summary of performance
+// statistics at the end of each session, to help figure out which bugs
+// are most important to fix. The reports don't include anything that
+// identifies the user: file paths have the user's home directory and user
+// name removed and no identifier is included that would allow reports
+// from the same user to be associated.
+
+// telemetryEndpoint is the URL that reports are posted to. It's set for
+// release builds with -ldflags "-X main.telemetryEndpoint=..."; builds
+// without it never ask to send reports.
+var telemetryEndpoint string
+
+type TelemetryReport struct {
+	Kind      string // "panic" or "session"
+	Version   string
+	OS        string
+	Arch      string
+	GoVersion string
+
+	ScenarioGroup string `json:",omitempty"`
+	Scenario      string `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+	Stack string `json:",omitempty"`
+
+	SessionMinutes   float32
+	RedrawsPerSecond float32
+	DrawPanesMs      float32
+	DrawImguiMs      float32
+	HeapMB           uint64
+}
+
+func NewTelemetryReport(kind string) TelemetryReport {
+	r := TelemetryReport{
+		Kind:      kind,
+		Version:   buildVersion,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+	}
+	if scenarioGroup != nil {
+		r.ScenarioGroup = scenarioGroup.Name
+	}
+	if sim != nil && sim.Scenario != nil {
+		r.Scenario = sim.Scenario.Name()
+	}
+
+	if !stats.startTime.IsZero() {
+		elapsed := time.Since(stats.startTime)
+		r.SessionMinutes = float32(elapsed.Minutes())
+		r.RedrawsPerSecond = float32(float64(stats.redraws) / elapsed.Seconds())
+	}
+	r.DrawPanesMs = float32(stats.drawPanes.Seconds() * 1000)
+	r.DrawImguiMs = float32(stats.drawImgui.Seconds() * 1000)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	r.HeapMB = mem.HeapAlloc / (1024 * 1024)
+
+	return r
+}
+
+// sendTelemetry uploads the report if the user has opted in. It's called
+// as vice is exiting, so it doesn't wait long for the server.
+func sendTelemetry(r TelemetryReport) {
+	if telemetryEndpoint == "" || globalConfig == nil || !globalConfig.TelemetryEnabled {
+		return
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		lg.Errorf("telemetry: %v", err)
+		return
+	}
+
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(telemetryEndpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		lg.Errorf("telemetry: %v", err)
+		return
+	}
+	resp.Body.Close()
+	lg.Printf("telemetry: sent %s report: %s", r.Kind, resp.Status)
+}
+
+func reportPanic(err interface{}, stack []byte) {
+	r := NewTelemetryReport("panic")
+	r.Error = anonymize(fmt.Sprintf("%v", err))
+	r.Stack = anonymize(string(stack))
+	sendTelemetry(r)
+}
+
+// reportGoroutinePanic should be deferred at the start of each goroutine;
+// the recover in main only catches panics on the main thread. If the
+// goroutine panics, a report is sent and the panic continues.
+func reportGoroutinePanic() {
+	if err := recover(); err != nil {
+		stack := debug.Stack()
+		lg.Errorf("Panic stack: %s", string(stack))
+		reportPanic(err, stack)
+		lg.SaveLogs()
+		panic(err)
+	}
+}
+
+func reportSession() {
+	sendTelemetry(NewTelemetryReport("session"))
+}
+
+// TelemetryConsentModalClient asks the user whether reports may be sent;
+// it's shown once and the choice can be changed later in the Privacy
+// preferences.
+type TelemetryConsentModalClient struct{}
+
+func (t *TelemetryConsentModalClient) Title() string { return "Help improve vice" }
+func (t *TelemetryConsentModalClient) Opening()      {}
+
+func (t *TelemetryConsentModalClient) Buttons() []ModalDialogButton {
+	answer := func(enabled bool) func() bool {
+		return func() bool {
+			globalConfig.TelemetryAsked = true
+			globalConfig.TelemetryEnabled = enabled
+			return true
+		}
+	}
+	return []ModalDialogButton{
+		ModalDialogButton{text: "Don't send", cancel: true, action: answer(false)},
+		ModalDialogButton{text: "Send reports", action: answer(true)},
+	}
+}
+
+func (t *TelemetryConsentModalClient) Draw() int {
+	imgui.Text("May vice send anonymous reports when it crashes and at the end of each session?\n\n" +
+		"Reports include the vice version, your operating system, the scenario you were\n" +
+		"running, performance statistics, and, for crashes, the error and where it happened\n" +
+		"in the code. They do not include your name, file paths, or anything that could be\n" +
+		"used to identify you.\n\n" +
+		"You can change this at any time in the Privacy section of the Preferences window.")
+	return -1
+}
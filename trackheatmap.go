@@ -0,0 +1,252 @@
+// trackheatmap.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The STARS scope can show an overlay of all of the tracks flown in the
+// current session, and optionally in prior sessions in the same scenario
+// group, either as a heatmap of how many aircraft have flown through
+// each part of the airspace or as a "spaghetti plot" of the tracks
+// themselves. This makes it easy for trainees to see how consistent
+// their downwinds and turn-ons are over time.
+//
+// So that prior sessions are available, the tracks from each session are
+// saved when the Sim is disconnected; they are stored in the user's
+// config directory, one file per scenario group.
+
+const (
+	// Size of the heatmap's cells, in nm.
+	trackHeatmapCellSize = 0.5
+	// Maximum number of prior sessions that are saved for each scenario
+	// group.
+	trackHistoryMaxSessions = 25
+	// Tracks are saved with one point for each interval, which is plenty
+	// for the overlay.
+	trackHistoryInterval = 15 * time.Second
+)
+
+type TrackHistory struct {
+	ScenarioGroup string
+	Sessions      []TrackHistorySession
+}
+
+type TrackHistorySession struct {
+	Start  time.Time
+	Tracks [][][2]float32 // latitude-longitude
+}
+
+func trackHistoryPath(group string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		lg.Errorf("Unable to find user config dir: %v", err)
+		dir = "."
+	}
+	// Scenario group names may have characters that aren't allowed in
+	// filenames.
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, group)
+	return path.Join(dir, "Vice", "tracks", name+".json")
+}
+
+// LoadTrackHistory returns the tracks saved from prior sessions in the
+// given scenario group.
+func LoadTrackHistory(group string) *TrackHistory {
+	h := &TrackHistory{ScenarioGroup: group}
+	b, err := os.ReadFile(trackHistoryPath(group))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lg.Errorf("%s: %v", trackHistoryPath(group), err)
+		}
+		return h
+	}
+	if err := json.Unmarshal(b, h); err != nil {
+		lg.Errorf("%s: %v", trackHistoryPath(group), err)
+	}
+	return h
+}
+
+// saveTrackHistory adds the tracks from the given recording to the
+// history for the given scenario group.
+func saveTrackHistory(group string, r *SessionRecording) {
+	if r == nil || len(r.Tracks) == 0 {
+		return
+	}
+
+	s := TrackHistorySession{Start: r.Start}
+	for _, callsign := range SortedMapKeys(r.Tracks) {
+		var pts [][2]float32
+		var last time.Time
+		for _, t := range r.Tracks[callsign] {
+			if t.Time.Sub(last) >= trackHistoryInterval {
+				pts = append(pts, t.Position)
+				last = t.Time
+			}
+		}
+		if len(pts) > 1 {
+			s.Tracks = append(s.Tracks, pts)
+		}
+	}
+	if len(s.Tracks) == 0 {
+		return
+	}
+
+	h := LoadTrackHistory(group)
+	h.Sessions = append(h.Sessions, s)
+	if n := len(h.Sessions); n > trackHistoryMaxSessions {
+		h.Sessions = h.Sessions[n-trackHistoryMaxSessions:]
+	}
+
+	fn := trackHistoryPath(group)
+	if err := os.MkdirAll(path.Dir(fn), 0o700); err != nil {
+		lg.Errorf("%s: %v", path.Dir(fn), err)
+		return
+	}
+	b, err := json.Marshal(h)
+	if err == nil {
+		err = os.WriteFile(fn, b, 0o600)
+	}
+	if err != nil {
+		lg.Errorf("%s: %v", fn, err)
+	} else {
+		lg.Printf("%s: saved %d tracks", fn, len(s.Tracks))
+	}
+}
+
+// ClearTrackHistory discards the saved tracks for the given scenario
+// group.
+func ClearTrackHistory(group string) {
+	if err := os.Remove(trackHistoryPath(group)); err != nil && !os.IsNotExist(err) {
+		lg.Errorf("%s: %v", trackHistoryPath(group), err)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// TrackHeatmap
+
+// TrackHeatmap records how many tracks pass through each cell of a grid
+// that covers the airspace.
+type TrackHeatmap struct {
+	Paths    [][][2]float32 // latitude-longitude
+	Counts   map[[2]int]int
+	MaxCount int
+}
+
+// MakeTrackHeatmap returns a heatmap for the given tracks.
+func MakeTrackHeatmap(paths [][][2]float32) *TrackHeatmap {
+	hm := &TrackHeatmap{Paths: paths, Counts: make(map[[2]int]int)}
+
+	for _, p := range paths {
+		// Each track is only counted once in each cell so that slow
+		// aircraft don't count for more than fast ones.
+		cells := make(map[[2]int]interface{})
+		for i := 1; i < len(p); i++ {
+			p0, p1 := ll2nm(p[i-1]), ll2nm(p[i])
+			n := max(1, int(distance2f(p0, p1)/(trackHeatmapCellSize/2)))
+			for j := 0; j <= n; j++ {
+				pt := lerp2f(float32(j)/float32(n), p0, p1)
+				cells[[2]int{int(floor(pt[0] / trackHeatmapCellSize)), int(floor(pt[1] / trackHeatmapCellSize))}] = nil
+			}
+		}
+		for c := range cells {
+			hm.Counts[c]++
+			hm.MaxCount = max(hm.MaxCount, hm.Counts[c])
+		}
+	}
+
+	return hm
+}
+
+// Color returns the color for a cell with the given count; it ranges from
+// dark blue for cells that few tracks have passed through to red for the
+// most-used cells.
+func (hm *TrackHeatmap) Color(count int) RGB {
+	f := sqrt(float32(count) / float32(hm.MaxCount))
+	if f < .5 {
+		return lerpRGB(2*f, RGB{0, .05, .25}, RGB{0, .45, .35})
+	}
+	return lerpRGB(2*f-1, RGB{.45, .4, 0}, RGB{.7, .1, 0})
+}
+
+// Draw draws the heatmap or, if spaghetti is true, the tracks themselves.
+func (hm *TrackHeatmap) Draw(spaghetti bool, brightness STARSBrightness, transforms ScopeTransformations,
+	cb *CommandBuffer) {
+	transforms.LoadLatLongViewingMatrices(cb)
+
+	if spaghetti {
+		ld := GetLinesDrawBuilder()
+		defer ReturnLinesDrawBuilder(ld)
+		for _, p := range hm.Paths {
+			for i := 1; i < len(p); i++ {
+				ld.AddLine(p[i-1], p[i])
+			}
+		}
+
+		// Blend the tracks so that the ones that are flown often are
+		// brighter.
+		c := brightness.ScaleRGB(RGB{.4, .7, 1})
+		cb.Blend()
+		cb.SetRGBA(RGBA{R: c.R, G: c.G, B: c.B, A: .2})
+		cb.LineWidth(1)
+		ld.GenerateCommands(cb)
+		cb.DisableBlend()
+		return
+	}
+
+	trid := GetColoredTrianglesDrawBuilder()
+	defer ReturnColoredTrianglesDrawBuilder(trid)
+	for c, count := range hm.Counts {
+		x0, y0 := float32(c[0])*trackHeatmapCellSize, float32(c[1])*trackHeatmapCellSize
+		x1, y1 := x0+trackHeatmapCellSize, y0+trackHeatmapCellSize
+		color := brightness.ScaleRGB(hm.Color(count))
+		trid.AddQuad(nm2ll([2]float32{x0, y0}), nm2ll([2]float32{x1, y0}), nm2ll([2]float32{x1, y1}),
+			nm2ll([2]float32{x0, y1}), color)
+	}
+	trid.GenerateCommands(cb)
+}
+
+// drawTrackHeatmap draws the track heatmap overlay, if it's enabled. It
+// is rebuilt periodically so that it includes new tracks.
+func (sp *STARSPane) drawTrackHeatmap(transforms ScopeTransformations, cb *CommandBuffer) {
+	if !sp.TrackHeatmap.Enabled {
+		return
+	}
+
+	if sp.trackHeatmap == nil || time.Since(sp.trackHeatmapBuilt) > 10*time.Second {
+		var paths [][][2]float32
+		if sp.TrackHeatmap.PriorSessions {
+			if sp.trackHistory == nil || sp.trackHistory.ScenarioGroup != scenarioGroup.Name {
+				sp.trackHistory = LoadTrackHistory(scenarioGroup.Name)
+			}
+			for _, s := range sp.trackHistory.Sessions {
+				paths = append(paths, s.Tracks...)
+			}
+		}
+		if r := sim.recording; r != nil {
+			for _, tracks := range r.Tracks {
+				var p [][2]float32
+				for _, t := range tracks {
+					p = append(p, t.Position)
+				}
+				paths = append(paths, p)
+			}
+		}
+
+		sp.trackHeatmap = MakeTrackHeatmap(paths)
+		sp.trackHeatmapBuilt = time.Now()
+	}
+
+	sp.trackHeatmap.Draw(sp.TrackHeatmap.Spaghetti, sp.currentPreferenceSet.Brightness.History, transforms, cb)
+}
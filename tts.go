@@ -0,0 +1,217 @@
+// tts.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// If enabled, pilot transmissions are also spoken using the system's
+// text-to-speech program. Each aircraft is randomly assigned one of a
+// small number of voices, which differ in pitch and in the rate at which
+// they speak, so that readbacks from different aircraft are easy to tell
+// apart. Speech is synthesized in a separate goroutine and transmissions
+// are spoken one at a time, in the order that they were made.
+//
+// All of vice's speech--pilot transmissions, the ATIS monitor, and UI
+// announcements (see accessibility.go)--goes through speechCommand, which
+// runs "say" on macOS, SAPI via PowerShell on Windows, and espeak or
+// speech-dispatcher on Linux.
+
+var ErrNoSpeechSynthesizer = errors.New("Unable to find a text-to-speech program (\"say\", \"espeak-ng\", or \"espeak\")")
+
+const numPilotVoices = 4
+
+var pilotVoiceNames = [numPilotVoices]string{"Low", "Medium low", "Medium high", "High"}
+
+// Voice pitch, from 0 (lowest) to 1 (highest).
+var pilotVoicePitches = [numPilotVoices]float32{0.15, 0.4, 0.6, 0.85}
+
+// defaultSpeechRate is the default rate in words per minute for each of
+// the pilot voices.
+const defaultSpeechRate = 180
+
+type pilotTransmission struct {
+	text   string
+	voice  int
+	rate   int
+	pan    float32
+	volume float32
+}
+
+var pilotSpeech struct {
+	mu     sync.Mutex
+	voices map[string]int // callsign -> voice index
+	queue  chan pilotTransmission
+}
+
+// speakPilotTransmission queues the given text to be spoken in the voice
+// that is assigned to the aircraft. It returns immediately.
+func speakPilotTransmission(callsign string, text string, pan float32, volume float32) {
+	a := &globalConfig.Audio
+	if !a.AudioEnabled || !a.SpeakTransmissions || !time.Now().After(a.muteUntil) {
+		return
+	}
+
+	pilotSpeech.mu.Lock()
+	defer pilotSpeech.mu.Unlock()
+	if pilotSpeech.queue == nil {
+		pilotSpeech.voices = make(map[string]int)
+		// Transmissions are dropped rather than blocking the UI if
+		// speech synthesis falls far behind.
+		pilotSpeech.queue = make(chan pilotTransmission, 16)
+		go speakPilotTransmissions(pilotSpeech.queue)
+	}
+
+	voice, ok := pilotSpeech.voices[callsign]
+	if !ok {
+		voice = rand.Intn(numPilotVoices)
+		pilotSpeech.voices[callsign] = voice
+	}
+
+	t := pilotTransmission{
+		text:   text,
+		voice:  voice,
+		rate:   int(a.SpeechRates[voice]),
+		pan:    pan,
+		volume: volume * a.SpeechVolume,
+	}
+	select {
+	case pilotSpeech.queue <- t:
+	default:
+		lg.Printf("%s: dropping transmission \"%s\"; speech queue full", callsign, text)
+	}
+}
+
+func speakPilotTransmissions(queue chan pilotTransmission) {
+	defer reportGoroutinePanic()
+	for t := range queue {
+		se, err := synthesizeSpeech("Pilot", t.text, &speechVoice{pitch: pilotVoicePitches[t.voice], rate: t.rate})
+		if err != nil {
+			lg.Errorf("%s: %v", t.text, err)
+			continue
+		}
+		// Wait for it to finish so that transmissions don't overlap.
+		se.WithPan(t.pan).WithVolume(t.volume).PlayAndWait()
+	}
+}
+
+// speechVoice gives the pitch, from 0 (lowest) to 1 (highest), and the
+// rate in words per minute of synthesized speech.
+type speechVoice struct {
+	pitch float32
+	rate  int
+}
+
+// speechCommand returns the command that runs the system's text-to-speech
+// program to speak the given text in the given voice, or in the default
+// voice if it is nil. If wav is non-empty, the audio is written to that
+// file rather than played. The text is passed to the program via its
+// standard input or environment, so that nothing in it (e.g., an ATIS
+// or a callsign) can be taken as an option or as part of a script. nil
+// is returned if there is no text-to-speech program.
+func speechCommand(text string, voice *speechVoice, wav string) *exec.Cmd {
+	rate, pitch := 0, float32(0)
+	if voice != nil {
+		rate, pitch = voice.rate, voice.pitch
+		if rate <= 0 {
+			rate = defaultSpeechRate
+		}
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		var args []string
+		if wav != "" {
+			args = append(args, "-o", wav, "--data-format=LEI16@22050")
+		}
+		if voice != nil {
+			// "say" takes the pitch as an embedded command.
+			args = append(args, "-r", fmt.Sprintf("%d", rate))
+			text = fmt.Sprintf("[[pbas %d]] ", 30+int(40*pitch)) + text
+		}
+		cmd := exec.Command("say", append(args, "-f", "-")...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd
+
+	case "windows":
+		script := "Add-Type -AssemblyName System.Speech; $s = New-Object System.Speech.Synthesis.SpeechSynthesizer; "
+		if wav != "" {
+			script += "$s.SetOutputToWaveFile($env:VICE_SPEECH_FILE); "
+		}
+		if voice != nil {
+			// SAPI rates go from -10 to 10, where 0 is roughly 180 wpm.
+			script += fmt.Sprintf("$s.Rate = %d; $s.SpeakSsml($env:VICE_SPEECH_TEXT); ",
+				clamp((rate-defaultSpeechRate)/20, -10, 10))
+			text = fmt.Sprintf("<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xml:lang='en-US'>"+
+				"<prosody pitch='%+d%%'>%s</prosody></speak>", int(100*(pitch-0.5)), xmlEscape(text))
+		} else {
+			script += "$s.Speak($env:VICE_SPEECH_TEXT); "
+		}
+		script += "$s.Dispose()"
+		cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+		cmd.Env = append(os.Environ(), "VICE_SPEECH_TEXT="+text, "VICE_SPEECH_FILE="+wav)
+		return cmd
+
+	default:
+		if wav == "" && voice == nil {
+			// Use speech-dispatcher, which is shared with screen readers.
+			if p, err := exec.LookPath("spd-say"); err == nil {
+				return exec.Command(p, "--", text)
+			}
+		}
+		for _, prog := range []string{"espeak-ng", "espeak"} {
+			if p, err := exec.LookPath(prog); err == nil {
+				args := []string{"--stdin"}
+				if wav != "" {
+					args = append(args, "-w", wav)
+				}
+				if voice != nil {
+					args = append(args, "-s", fmt.Sprintf("%d", rate), "-p", fmt.Sprintf("%d", int(99*pitch)))
+				}
+				cmd := exec.Command(p, args...)
+				cmd.Stdin = strings.NewReader(text)
+				return cmd
+			}
+		}
+		return nil
+	}
+}
+
+// synthesizeSpeech uses the system's text-to-speech program to speak the
+// given text in the given voice (or the default one, if it is nil),
+// returning the result as a SoundEffect with the given name.
+func synthesizeSpeech(name string, text string, voice *speechVoice) (*SoundEffect, error) {
+	tmp, err := os.CreateTemp("", "vice-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	cmd := speechCommand(text, voice, tmp.Name())
+	if cmd == nil {
+		return nil, ErrNoSpeechSynthesizer
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, ErrNoSpeechSynthesizer
+		}
+		return nil, fmt.Errorf("%s: %v: %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+
+	wav, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return LoadSoundEffect(name, wav)
+}
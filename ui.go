@@ -10,12 +10,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"image/png"
+	"io"
 	"net/http"
 	"os"
+	"os/user"
 	"path"
 	"runtime/debug"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -40,6 +43,10 @@ var (
 		activeModalDialogs []*ModalDialogBox
 
 		newReleaseDialogChan chan *NewReleaseModalClient
+
+		releaseNotes     []*ReleaseNotes
+		releaseNotesChan chan []*ReleaseNotes
+		showingWhatsNew  bool
 	}
 
 	//go:embed icons/tower-256x256.png
@@ -87,6 +94,9 @@ func imguiInit() *imgui.Context {
 	style.SetScrollbarSize(6.)
 	style.ScaleAllSizes(1.25)
 
+	// Allow dialogs to be navigated using the keyboard.
+	imgui.CurrentIO().SetConfigFlags(imgui.ConfigFlagsNavEnableKeyboard)
+
 	return context
 }
 
@@ -109,12 +119,31 @@ func uiInit(renderer Renderer) {
 	// Do this asynchronously since it involves network traffic and may
 	// take some time (or may even time out, etc.)
 	ui.newReleaseDialogChan = make(chan *NewReleaseModalClient)
-	go checkForNewRelease(ui.newReleaseDialogChan)
+	ui.releaseNotesChan = make(chan []*ReleaseNotes, 1)
+	go checkForNewRelease(ui.newReleaseDialogChan, ui.releaseNotesChan)
 
 	if globalConfig.WhatsNewIndex < len(whatsNew) {
+		ui.showingWhatsNew = true
 		uiShowModalDialog(NewModalDialogBox(&WhatsNewModalClient{}), false)
 	}
 
+	if !globalConfig.TelemetryAsked && telemetryEndpoint != "" {
+		uiShowModalDialog(NewModalDialogBox(&TelemetryConsentModalClient{}), false)
+	}
+
+	if scenarioGroup != nil {
+		uiShowConnectDialog()
+	}
+}
+
+// uiShowConnectDialog shows the dialog for starting or connecting to a
+// session unless one is already pending.
+func uiShowConnectDialog() {
+	for _, d := range ui.activeModalDialogs {
+		if _, ok := d.client.(*ConnectModalClient); ok && !d.closed {
+			return
+		}
+	}
 	uiShowModalDialog(NewModalDialogBox(&ConnectModalClient{}), false)
 }
 
@@ -144,6 +173,46 @@ func uiEndDisable(b bool) {
 	}
 }
 
+// privacyFilter returns the given string with the user's home directory
+// and user name removed if privacy mode is enabled; it should be applied
+// to any text shown in the UI that may include them (file paths, error
+// messages, etc.)
+func privacyFilter(s string) string {
+	if !globalConfig.PrivacyMode {
+		return s
+	}
+	return anonymize(s)
+}
+
+// The user's home directory and user name, looked up once by anonymize.
+var (
+	anonymizeOnce     sync.Once
+	anonymizeHome     string
+	anonymizeUsername string
+)
+
+// anonymize removes the user's home directory and user name from the
+// given string. They are only replaced where they aren't part of a
+// longer name, so that a short user name doesn't mangle the rest of the
+// text.
+func anonymize(s string) string {
+	anonymizeOnce.Do(func() {
+		anonymizeHome, _ = os.UserHomeDir()
+		if u, err := user.Current(); err == nil {
+			// On Windows, the user name is of the form DOMAIN\user.
+			anonymizeUsername = u.Username[strings.LastIndex(u.Username, "\\")+1:]
+		}
+	})
+
+	if anonymizeHome != "" {
+		s = replaceWholeName(s, anonymizeHome, "~")
+	}
+	if len(anonymizeUsername) > 1 {
+		s = replaceWholeName(s, anonymizeUsername, "user")
+	}
+	return s
+}
+
 func (c RGB) imgui() imgui.Vec4 {
 	return imgui.Vec4{c.R, c.G, c.B, 1}
 }
@@ -162,6 +231,7 @@ func drawUI(platform Platform) {
 			// don't block on the chan if there's nothing there and it's still open...
 		}
 	}
+	receiveReleaseNotes()
 
 	imgui.PushFont(ui.font.ifont)
 	if imgui.BeginMainMenuBar() {
@@ -175,23 +245,99 @@ func drawUI(platform Platform) {
 					sim.TogglePause()
 				}
 			}
-			if imgui.MenuItem("Restart...") {
+			if imgui.MenuItemV("Restart...", "", false, scenarioGroup != nil) {
 				uiShowModalDialog(NewModalDialogBox(&ConnectModalClient{}), false)
 			}
+			if imgui.MenuItem("Relief briefing...") {
+				uiShowModalDialog(NewModalDialogBox(&ReliefBriefingModalClient{}), false)
+			}
+			if imgui.MenuItemV("Session playback", "", false, sim.recording != nil) {
+				wmAddPane(NewPlaybackPane(sim.recording), 0.5)
+			}
+			if imgui.MenuItem("Controller profile...") {
+				ShowProfileWindow()
+			}
+			if imgui.MenuItemV("Export session...", "", false, sim.recording != nil) {
+				uiShowModalDialog(NewModalDialogBox(&ExportSessionModalClient{recording: sim.recording}), false)
+			}
+			if imgui.MenuItem("Navaid monitor...") {
+				navaidMonitor.show = true
+			}
+			if imgui.MenuItem("ATIS...") {
+				atisMonitor.show = true
+			}
+			if imgui.MenuItem("Runway conditions...") {
+				runwayConditionsWindow.show = true
+			}
+			if *devmode && imgui.MenuItemV("Pilot console...", "", false, sim.remote == nil) {
+				pilotConsole.show = true
+			}
+			if imgui.MenuItemV("Acknowledge audio alerts", "", false, globalConfig.Audio.HaveUnacknowledged()) {
+				globalConfig.Audio.AcknowledgeAll()
+			}
+			imgui.Separator()
+			if imgui.MenuItem("Preferences...") {
+				ActivatePreferencesWindow()
+			}
+			imgui.EndMenu()
+		}
+
+		if imgui.BeginMenu("Capture") {
+			if imgui.MenuItemV("Screenshot", "Shift-F11", false, screenshotPane() != nil) {
+				screenshot.pending = true
+			}
+			if imgui.MenuItemV("Burn in time and scale", "", screenshot.burnIn, true) {
+				screenshot.burnIn = !screenshot.burnIn
+			}
 			imgui.Separator()
-			if imgui.MenuItem("Settings...") {
-				sim.ActivateSettingsWindow()
+			if imgui.MenuItemV("Annotate", "", screenshot.annotating, screenshotPane() != nil) {
+				screenshotToggleAnnotating()
 			}
+			if imgui.MenuItemV("Arrow tool", "", screenshot.tool == ScreenshotToolArrow, true) {
+				screenshot.tool = ScreenshotToolArrow
+			}
+			if imgui.MenuItemV("Text tool", "", screenshot.tool == ScreenshotToolText, true) {
+				screenshot.tool = ScreenshotToolText
+			}
+			if imgui.MenuItemV("Clear annotations", "", false, len(screenshot.annotations) > 0) {
+				screenshot.annotations = nil
+				screenshot.editing = false
+			}
+			imgui.Separator()
+			if videoCaptureRecording() {
+				if imgui.MenuItem("Stop recording video") {
+					videoCaptureStop()
+				}
+			} else if imgui.MenuItemV("Record video", "", false, videoCapture.wholeWindow || screenshotPane() != nil) {
+				videoCaptureStart()
+			}
+			uiStartDisable(videoCaptureRecording())
+			if imgui.MenuItemV("Record whole window", "", videoCapture.wholeWindow, true) {
+				videoCapture.wholeWindow = !videoCapture.wholeWindow
+			}
+			if imgui.MenuItemV("Record WebM (instead of MP4)", "", videoCapture.webm, true) {
+				videoCapture.webm = !videoCapture.webm
+			}
+			uiEndDisable(videoCaptureRecording())
 			imgui.EndMenu()
 		}
 
 		if imgui.BeginMenu("Help") {
+			if imgui.MenuItemV("Reference", "Shift-F12", uiReferencePane() != nil, true) {
+				uiToggleReferencePane()
+			}
 			if imgui.MenuItem("Documentation...") {
 				browser.OpenURL("https://pharr.org/vice/index.html")
 			}
 			if imgui.MenuItem("Report a bug...") {
 				browser.OpenURL("https://pharr.org/vice/index.html#bugs")
 			}
+			if imgui.MenuItemV("Keyboard shortcuts", "F1", helpOverlay.show, true) {
+				helpOverlayToggle()
+			}
+			if imgui.MenuItem("Release history...") {
+				releaseHistoryWindow.show = true
+			}
 			imgui.Separator()
 			if imgui.MenuItem("About vice...") {
 				ui.showAboutDialog = true
@@ -201,6 +347,7 @@ func drawUI(platform Platform) {
 
 		t := FontAwesomeIconDiscord
 		width, _ := ui.font.BoundText(t, 0)
+		drawClock(platform.DisplaySize()[0] - float32(width+10))
 		imgui.SetCursorPos(imgui.Vec2{platform.DisplaySize()[0] - float32(width+10), 0})
 		imgui.PushStyleColor(imgui.StyleColorButton, imgui.CurrentStyle().Color(imgui.StyleColorMenuBarBg))
 		if imgui.Button(t) {
@@ -212,7 +359,29 @@ func drawUI(platform Platform) {
 	}
 	ui.menuBarHeight = imgui.CursorPos().Y - 1
 
-	sim.DrawSettingsWindow()
+	const ImguiF1, ImguiF11, ImguiF12 = 290, 300, 301
+	if imgui.IsKeyPressed(ImguiF1) && !imgui.CurrentIO().KeyCtrlPressed() {
+		helpOverlayToggle()
+	}
+	// Global shortcuts use Shift so that they don't conflict with the
+	// panes' function key bindings.
+	if imgui.IsKeyPressed(ImguiF11) && imgui.CurrentIO().KeyShiftPressed() && screenshotPane() != nil {
+		screenshot.pending = true
+	}
+	if imgui.IsKeyPressed(ImguiF12) && imgui.CurrentIO().KeyShiftPressed() {
+		uiToggleReferencePane()
+	}
+	cannedInstructionsProcessKeys()
+
+	preferencesDrawUI()
+	navaidMonitorDrawUI()
+	atisMonitorDrawUI()
+	runwayConditionsDrawUI()
+	releaseHistoryDrawUI()
+	profileDrawUI()
+	challengeDrawUI()
+	pilotConsoleDrawUI()
+	globalConfig.Audio.Update()
 
 	drawActiveDialogBoxes()
 
@@ -226,6 +395,41 @@ func drawUI(platform Platform) {
 	defer ReturnCommandBuffer(cb)
 	GenerateImguiCommandBuffer(cb)
 	stats.renderUI = renderer.RenderCommandBuffer(cb)
+
+	fbSize := platform.FramebufferSize()
+	videoCaptureFrame(true, 0, 0, int(fbSize[0]), int(fbSize[1]))
+}
+
+// uiReferencePane returns the ReferencePane if one is currently being
+// displayed.
+func uiReferencePane() *ReferencePane {
+	var rp *ReferencePane
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		if r, ok := p.(*ReferencePane); ok {
+			rp = r
+		}
+	})
+	return rp
+}
+
+func uiToggleReferencePane() {
+	if rp := uiReferencePane(); rp != nil {
+		wmRemovePane(rp)
+	} else {
+		wmAddPane(NewReferencePane(), 0.7)
+	}
+}
+
+// uiOfferSessionPlayback asks the user whether they would like to review
+// the given session recording and, if so, adds a PlaybackPane for it.
+func uiOfferSessionPlayback(r *SessionRecording) {
+	uiShowModalDialog(NewModalDialogBox(&YesOrNoModalClient{
+		title: "Session Playback",
+		query: fmt.Sprintf("Review the ground tracks of the %d aircraft from the last session?", len(r.Tracks)),
+		ok: func() {
+			wmAddPane(NewPlaybackPane(r), 0.5)
+		},
+	}), false)
 }
 
 func drawActiveDialogBoxes() {
@@ -428,7 +632,9 @@ type ModalDialogBox struct {
 type ModalDialogButton struct {
 	text     string
 	disabled bool
-	action   func() bool
+	// The cancel button, if any, is activated when escape is pressed.
+	cancel bool
+	action func() bool
 }
 
 type ModalDialogClient interface {
@@ -454,16 +660,21 @@ func (m *ModalDialogBox) Draw() {
 
 	flags := imgui.WindowFlagsNoResize | imgui.WindowFlagsAlwaysAutoResize | imgui.WindowFlagsNoSavedSettings
 	if imgui.BeginPopupModalV(title, nil, flags) {
-		if !m.isOpen {
+		justOpened := !m.isOpen
+		if justOpened {
 			imgui.SetKeyboardFocusHere()
 			m.client.Opening()
 			m.isOpen = true
+			announceDialog(m.client.Title(), m.client.Buttons())
 		}
 
 		selIndex := m.client.Draw()
 		imgui.Text("\n") // spacing
 
 		buttons := m.client.Buttons()
+		if (selIndex < 0 || selIndex >= len(buttons)) && !justOpened {
+			selIndex = modalDialogKeyboardSelection(buttons)
+		}
 
 		// First, figure out where to start drawing so the buttons end up right-justified.
 		// https://github.com/ocornut/imgui/discussions/3862
@@ -492,22 +703,54 @@ func (m *ModalDialogBox) Draw() {
 	}
 }
 
+// modalDialogKeyboardSelection returns the index of the button that was
+// activated using the keyboard, if any: enter activates the default
+// button, which is the last one that is enabled, and escape activates the
+// cancel button, or the only button if there's just one.
+func modalDialogKeyboardSelection(buttons []ModalDialogButton) int {
+	if !imgui.IsWindowFocused() {
+		// E.g., a file selection dialog is open on top of this one.
+		return -1
+	}
+
+	if imgui.IsKeyPressed(imgui.GetKeyIndex(imgui.KeyEnter)) {
+		for i := len(buttons) - 1; i >= 0; i-- {
+			if !buttons[i].disabled {
+				return i
+			}
+		}
+	}
+	if imgui.IsKeyPressed(imgui.GetKeyIndex(imgui.KeyEscape)) {
+		if len(buttons) == 1 {
+			return 0
+		}
+		for i, b := range buttons {
+			if b.cancel && !b.disabled {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 type ConnectModalClient struct {
 	connectionType ConnectionType
 	err            string
 
-	sim SimConnectionConfiguration
+	sim         SimConnectionConfiguration
+	multiplayer MultiplayerConnectionConfiguration
 }
 
 type ConnectionType int
 
 const (
 	ConnectionTypeSimServer = iota
+	ConnectionTypeMultiplayer
 	ConnectionTypeCount
 )
 
 func (c ConnectionType) String() string {
-	return [...]string{"Sim Server"}[c]
+	return [...]string{"Sim Server", "Multiplayer Server"}[c]
 }
 
 func (c *ConnectModalClient) Title() string { return "New Simulation" }
@@ -516,17 +759,23 @@ func (c *ConnectModalClient) Opening() {
 	c.connectionType = ConnectionTypeSimServer
 	c.err = ""
 	c.sim.Initialize()
+	c.multiplayer.Initialize()
 }
 
 func (c *ConnectModalClient) Buttons() []ModalDialogButton {
 	var b []ModalDialogButton
-	b = append(b, ModalDialogButton{text: "Cancel"})
+	b = append(b, ModalDialogButton{text: "Cancel", cancel: true, action: func() bool {
+		c.multiplayer.Cancel()
+		return true
+	}})
 
 	ok := ModalDialogButton{text: "Ok", action: func() bool {
 		var err error
 		switch c.connectionType {
 		case ConnectionTypeSimServer:
 			err = c.sim.Connect()
+		case ConnectionTypeMultiplayer:
+			err = c.multiplayer.Connect()
 
 		default:
 			lg.Errorf("Unhandled connection type")
@@ -544,6 +793,8 @@ func (c *ConnectModalClient) Buttons() []ModalDialogButton {
 	switch c.connectionType {
 	case ConnectionTypeSimServer:
 		ok.disabled = !c.sim.Valid()
+	case ConnectionTypeMultiplayer:
+		ok.disabled = !c.multiplayer.Valid()
 
 	default:
 		lg.Errorf("Unhandled connection type")
@@ -554,21 +805,23 @@ func (c *ConnectModalClient) Buttons() []ModalDialogButton {
 }
 
 func (c *ConnectModalClient) Draw() int {
-	/*
-		if imgui.BeginComboV("Type", c.connectionType.String(), imgui.ComboFlagsHeightLarge) {
-			for i := 0; i < ConnectionTypeCount; i++ {
-				ct := ConnectionType(i)
-				if imgui.SelectableV(ct.String(), ct == c.connectionType, 0, imgui.Vec2{}) {
-					c.connectionType = ct
-				}
+	if imgui.BeginComboV("Type", c.connectionType.String(), imgui.ComboFlagsHeightLarge) {
+		for i := 0; i < ConnectionTypeCount; i++ {
+			ct := ConnectionType(i)
+			if imgui.SelectableV(ct.String(), ct == c.connectionType, 0, imgui.Vec2{}) {
+				c.connectionType = ct
+				c.err = ""
 			}
-			imgui.EndCombo()
 		}
-	*/
+		imgui.EndCombo()
+	}
+
 	var enter bool
 	switch c.connectionType {
 	case ConnectionTypeSimServer:
 		enter = c.sim.DrawUI()
+	case ConnectionTypeMultiplayer:
+		enter = c.multiplayer.DrawUI()
 	}
 
 	if c.err != "" {
@@ -591,7 +844,7 @@ func (d *DisconnectModalClient) Opening() {
 
 func (c *DisconnectModalClient) Buttons() []ModalDialogButton {
 	var b []ModalDialogButton
-	b = append(b, ModalDialogButton{text: "Cancel"})
+	b = append(b, ModalDialogButton{text: "Cancel", cancel: true})
 
 	ok := ModalDialogButton{text: "Ok", action: func() bool {
 		sim.Disconnect()
@@ -618,7 +871,7 @@ func (yn *YesOrNoModalClient) Opening() {}
 
 func (yn *YesOrNoModalClient) Buttons() []ModalDialogButton {
 	var b []ModalDialogButton
-	b = append(b, ModalDialogButton{text: "No", action: func() bool {
+	b = append(b, ModalDialogButton{text: "No", cancel: true, action: func() bool {
 		if yn.notok != nil {
 			yn.notok()
 		}
@@ -638,36 +891,210 @@ func (yn *YesOrNoModalClient) Draw() int {
 	return -1
 }
 
-func checkForNewRelease(newReleaseDialogChan chan *NewReleaseModalClient) {
-	defer close(newReleaseDialogChan)
+type ReliefBriefingModalClient struct {
+	sections []ReliefBriefingSection
+}
 
-	url := "https://api.github.com/repos/mmp/vice/releases"
+func (rb *ReliefBriefingModalClient) Title() string { return "Position Relief Briefing" }
 
-	resp, err := http.Get(url)
-	if err != nil {
-		lg.Errorf("%s: get err: %v", url, err)
-		return
+func (rb *ReliefBriefingModalClient) Opening() {
+	rb.sections = sim.ReliefBriefing()
+}
+
+func (rb *ReliefBriefingModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{
+		ModalDialogButton{text: "Copy to clipboard", action: func() bool {
+			platform.GetClipboard().SetText(rb.String())
+			return false
+		}},
+		ModalDialogButton{text: "Refresh", action: func() bool {
+			rb.sections = sim.ReliefBriefing()
+			return false
+		}},
+		ModalDialogButton{text: "Close", cancel: true}}
+}
+
+func (rb *ReliefBriefingModalClient) Draw() int {
+	for i, section := range rb.sections {
+		imgui.Text(fmt.Sprintf("%d. %s", i+1, section.Title))
+		if len(section.Items) == 0 {
+			imgui.Text("    (none)")
+		}
+		for _, item := range section.Items {
+			imgui.Text("    " + item)
+		}
+	}
+	return -1
+}
+
+func (rb *ReliefBriefingModalClient) String() string {
+	var b strings.Builder
+	for i, section := range rb.sections {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, section.Title)
+		if len(section.Items) == 0 {
+			b.WriteString("    (none)\n")
+		}
+		for _, item := range section.Items {
+			b.WriteString("    " + item + "\n")
+		}
+	}
+	return b.String()
+}
+
+type ExportSessionModalClient struct {
+	recording *SessionRecording
+	format    int
+	dirDialog *FileSelectDialogBox
+	err       string
+}
+
+var sessionExportFormats = [...]string{"KML (Google Earth)", "GeoJSON", "CSV"}
+
+func (es *ExportSessionModalClient) Title() string { return "Export Session" }
+
+func (es *ExportSessionModalClient) Opening() {
+	es.err = ""
+	if globalConfig.ExportDirectory == "" {
+		globalConfig.ExportDirectory = defaultDirectory("")
+	}
+}
+
+func (es *ExportSessionModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{
+		ModalDialogButton{text: "Cancel", cancel: true},
+		ModalDialogButton{text: "Export", action: func() bool {
+			if err := es.export(); err != nil {
+				es.err = err.Error()
+				return false
+			}
+			return true
+		}}}
+}
+
+func (es *ExportSessionModalClient) export() error {
+	base := path.Join(globalConfig.ExportDirectory, "vice-"+es.recording.Start.Format("20060102-150405"))
+
+	write := func(filename string, w func(io.Writer) error) error {
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		if err := w(f); err != nil {
+			f.Close()
+			return err
+		}
+		lg.Printf("%s: exported session", filename)
+		return f.Close()
+	}
+
+	switch es.format {
+	case 0:
+		return write(base+".kml", es.recording.WriteKML)
+	case 1:
+		return write(base+".geojson", es.recording.WriteGeoJSON)
+	default:
+		if err := write(base+"-tracks.csv", es.recording.WriteTracksCSV); err != nil {
+			return err
+		}
+		return write(base+"-events.csv", es.recording.WriteEventsCSV)
+	}
+}
+
+func (es *ExportSessionModalClient) Draw() int {
+	imgui.Text(fmt.Sprintf("%d aircraft, %d events", len(es.recording.Tracks), len(es.recording.Events)))
+
+	if imgui.BeginComboV("Format", sessionExportFormats[es.format], 0) {
+		for i, f := range sessionExportFormats {
+			if imgui.SelectableV(f, i == es.format, 0, imgui.Vec2{}) {
+				es.format = i
+			}
+		}
+		imgui.EndCombo()
+	}
+
+	imgui.Text("Directory: " + privacyFilter(globalConfig.ExportDirectory))
+	imgui.SameLine()
+	if imgui.Button("Choose...") {
+		es.dirDialog = NewDirectorySelectDialogBox("Select Export Directory", globalConfig.ExportDirectory,
+			func(dir string) {
+				globalConfig.ExportDirectory = dir
+				es.dirDialog = nil
+			})
+		es.dirDialog.Activate()
+	}
+	if es.dirDialog != nil {
+		es.dirDialog.Draw()
 	}
-	defer resp.Body.Close()
+
+	if es.err != "" {
+		imgui.PushStyleColor(imgui.StyleColorText, UIErrorColor.imgui())
+		imgui.Text(es.err)
+		imgui.PopStyleColor()
+	}
+	return -1
+}
+
+func checkForNewRelease(newReleaseDialogChan chan *NewReleaseModalClient, releaseNotesChan chan []*ReleaseNotes) {
+	defer reportGoroutinePanic()
+	defer close(newReleaseDialogChan)
+	defer close(releaseNotesChan)
 
 	type Release struct {
-		TagName string    `json:"tag_name"`
-		Created time.Time `json:"created_at"`
+		TagName string         `json:"tag_name"`
+		Created time.Time      `json:"created_at"`
+		Body    string         `json:"body"`
+		URL     string         `json:"html_url"`
+		Assets  []ReleaseAsset `json:"assets"`
 	}
 
-	decoder := json.NewDecoder(resp.Body)
+	client := http.Client{Timeout: releaseFetchTimeout}
 	var releases []Release
-	if err := decoder.Decode(&releases); err != nil {
-		lg.Errorf("JSON decode error: %v", err)
-		return
+	for page := 1; page <= releaseMaxPages; page++ {
+		url := fmt.Sprintf("https://api.github.com/repos/mmp/vice/releases?per_page=%d&page=%d",
+			releasesPerPage, page)
+		resp, err := client.Get(url)
+		if err != nil {
+			lg.Errorf("%s: get err: %v", url, err)
+			return
+		}
+
+		var pageReleases []Release
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("%s", resp.Status)
+		} else {
+			err = json.NewDecoder(io.LimitReader(resp.Body, releaseMaxResponseSize)).Decode(&pageReleases)
+		}
+		resp.Body.Close()
+		if err != nil {
+			lg.Errorf("%s: %v", url, err)
+			return
+		}
+
+		releases = append(releases, pageReleases...)
+		if len(pageReleases) < releasesPerPage {
+			break
+		}
 	}
 	if len(releases) == 0 {
 		return
 	}
 
+	// Send the release notes, most recent first, back to the main thread.
+	var notes []*ReleaseNotes
+	for _, r := range releases {
+		notes = append(notes, &ReleaseNotes{
+			Version: r.TagName,
+			Date:    r.Created,
+			URL:     r.URL,
+			Blocks:  ParseReleaseNotes(r.Body),
+		})
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Date.After(notes[j].Date) })
+	releaseNotesChan <- notes
+
 	var newestRelease *Release
 	for i := range releases {
-		if strings.HasSuffix(releases[i].TagName, "-beta") {
+		if strings.HasSuffix(releases[i].TagName, "-beta") && globalConfig.UpdateChannel != "beta" {
 			continue
 		}
 		if newestRelease == nil || releases[i].Created.After(newestRelease.Created) {
@@ -706,7 +1133,8 @@ func checkForNewRelease(newReleaseDialogChan chan *NewReleaseModalClient) {
 			bt.UTC().String(), newestRelease.Created.UTC().String())
 		newReleaseDialogChan <- &NewReleaseModalClient{
 			version: newestRelease.TagName,
-			date:    newestRelease.Created}
+			date:    newestRelease.Created,
+			assets:  newestRelease.Assets}
 	} else {
 		lg.Printf("build time %s newest release %s -> build is newer",
 			bt.UTC().String(), newestRelease.Created.UTC().String())
@@ -716,6 +1144,7 @@ func checkForNewRelease(newReleaseDialogChan chan *NewReleaseModalClient) {
 type NewReleaseModalClient struct {
 	version string
 	date    time.Time
+	assets  []ReleaseAsset
 }
 
 func (nr *NewReleaseModalClient) Title() string {
@@ -724,7 +1153,17 @@ func (nr *NewReleaseModalClient) Title() string {
 func (nr *NewReleaseModalClient) Opening() {}
 
 func (nr *NewReleaseModalClient) Buttons() []ModalDialogButton {
-	return []ModalDialogButton{
+	var b []ModalDialogButton
+	if canDownloadUpdate(nr.assets) {
+		b = append(b, ModalDialogButton{
+			text: "Download and install",
+			action: func() bool {
+				uiShowModalDialog(NewModalDialogBox(NewUpdateModalClient(nr.version, nr.assets)), true)
+				return true
+			},
+		})
+	}
+	return append(b,
 		ModalDialogButton{
 			text: "Quit and update",
 			action: func() bool {
@@ -733,38 +1172,15 @@ func (nr *NewReleaseModalClient) Buttons() []ModalDialogButton {
 				return true
 			},
 		},
-		ModalDialogButton{text: "Update later"}}
+		ModalDialogButton{text: "Update later", cancel: true})
 }
 
 func (nr *NewReleaseModalClient) Draw() int {
 	imgui.Text(fmt.Sprintf("vice version %s is the latest version", nr.version))
-	imgui.Text("Would you like to quit and open the vice downloads page?")
-	return -1
-}
-
-type WhatsNewModalClient struct{}
-
-func (nr *WhatsNewModalClient) Title() string {
-	return "What's new in this version of vice"
-}
-
-func (nr *WhatsNewModalClient) Opening() {}
-
-func (nr *WhatsNewModalClient) Buttons() []ModalDialogButton {
-	return []ModalDialogButton{
-		ModalDialogButton{
-			text: "Ok",
-			action: func() bool {
-				globalConfig.WhatsNewIndex = len(whatsNew)
-				return true
-			},
-		},
-	}
-}
-
-func (nr *WhatsNewModalClient) Draw() int {
-	for i := globalConfig.WhatsNewIndex; i < len(whatsNew); i++ {
-		imgui.Text(FontAwesomeIconSquare + " " + whatsNew[i])
+	if canDownloadUpdate(nr.assets) {
+		imgui.Text("Would you like to download and install it, or quit and open the vice downloads page?")
+	} else {
+		imgui.Text("Would you like to quit and open the vice downloads page?")
 	}
 	return -1
 }
@@ -901,7 +1317,7 @@ func (fs *FileSelectDialogBox) Draw() {
 		}
 
 		imgui.SameLine()
-		imgui.Text(fs.directory)
+		imgui.Text(privacyFilter(fs.directory))
 
 		// Only rescan the directory contents once a second.
 		if time.Since(fs.dirEntriesLastUpdated) > 1*time.Second {
@@ -1028,13 +1444,108 @@ func (e *ErrorModalClient) Draw() int {
 		imgui.Image(imgui.TextureID(ui.sadTowerTextureID), imgui.Vec2{128, 128})
 
 		imgui.TableNextColumn()
-		imgui.Text("\n\n" + e.message)
+		imgui.Text("\n\n" + privacyFilter(e.message))
 
 		imgui.EndTable()
 	}
 	return -1
 }
 
+// ResourceErrorModalClient reports errors from loading the scenarios and
+// video maps at startup. Rather than exiting, the user is given the
+// option to reinstall vice, to choose other scenario and video map files
+// or to stop using custom ones, and then to continue with the scenarios
+// that did load.
+type ResourceErrorModalClient struct {
+	errors     string
+	fileDialog *FileSelectDialogBox
+}
+
+func (r *ResourceErrorModalClient) Title() string { return "Unable to Load Scenarios" }
+func (r *ResourceErrorModalClient) Opening()      {}
+
+// reload loads the scenarios and video maps again after the user has
+// changed which files to use.
+func (r *ResourceErrorModalClient) reload() {
+	var e ErrorLogger
+	scenarioGroups = LoadScenarioGroups(&e)
+	selectInitialScenarioGroup()
+	r.errors = e.String()
+	if e.HaveErrors() {
+		lg.Errorf("Errors loading scenarios and video maps:\n%s", r.errors)
+	}
+}
+
+// chooseFile lets the user select a JSON file; the given string is set
+// to its name and the scenarios are reloaded.
+func (r *ResourceErrorModalClient) chooseFile(title string, filename *string) {
+	r.fileDialog = NewFileSelectDialogBox(title, []string{".json"}, *filename,
+		func(f string) {
+			*filename = f
+			r.fileDialog = nil
+			r.reload()
+		})
+	r.fileDialog.Activate()
+}
+
+func (r *ResourceErrorModalClient) Buttons() []ModalDialogButton {
+	var b []ModalDialogButton
+	b = append(b, ModalDialogButton{text: "Download vice...", action: func() bool {
+		browser.OpenURL("https://pharr.org/vice/index.html#section-installation")
+		return false
+	}})
+	b = append(b, ModalDialogButton{text: "Choose scenario file...", action: func() bool {
+		r.chooseFile("Select Scenario File", &globalConfig.DevScenarioFile)
+		return false
+	}})
+	b = append(b, ModalDialogButton{text: "Choose video map file...", action: func() bool {
+		r.chooseFile("Select Video Map File", &globalConfig.DevVideoMapFile)
+		return false
+	}})
+	if globalConfig.DevScenarioFile != "" || globalConfig.DevVideoMapFile != "" {
+		b = append(b, ModalDialogButton{text: "Stop using custom files", action: func() bool {
+			globalConfig.DevScenarioFile = ""
+			globalConfig.DevVideoMapFile = ""
+			r.reload()
+			return false
+		}})
+	}
+	b = append(b, ModalDialogButton{text: "Continue", disabled: scenarioGroup == nil, action: func() bool {
+		uiShowConnectDialog()
+		return true
+	}})
+	return b
+}
+
+func (r *ResourceErrorModalClient) Draw() int {
+	if r.errors == "" {
+		imgui.Text("The scenarios and video maps loaded successfully.")
+	} else if scenarioGroup != nil {
+		imgui.Text("Errors were found in the following scenarios or video maps; they have been skipped\n" +
+			"but the remaining scenarios may be used.")
+	} else {
+		imgui.Text("No scenarios could be loaded. Reinstalling vice may fix this. If you have specified\n" +
+			"custom scenario or video map files, they may be the cause.")
+	}
+	if globalConfig.DevScenarioFile != "" {
+		imgui.Text("Scenario file: " + globalConfig.DevScenarioFile)
+	}
+	if globalConfig.DevVideoMapFile != "" {
+		imgui.Text("Video map file: " + globalConfig.DevVideoMapFile)
+	}
+	imgui.Separator()
+
+	imgui.BeginChildV("errors", imgui.Vec2{800, 300}, true, imgui.WindowFlagsHorizontalScrollbar)
+	imgui.Text(r.errors)
+	imgui.EndChild()
+
+	if r.fileDialog != nil {
+		r.fileDialog.Draw()
+	}
+
+	return -1
+}
+
 func ShowErrorDialog(s string, args ...interface{}) {
 	d := NewModalDialogBox(&ErrorModalClient{message: fmt.Sprintf(s, args...)})
 	uiShowModalDialog(d, true)
@@ -0,0 +1,434 @@
+// updater.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/mmp/imgui-go/v4"
+	"github.com/pkg/browser"
+)
+
+// When a new release is available, the user may have vice download it
+// rather than going to the downloads page. The release asset for the
+// current platform is downloaded and its SHA-256 checksum is verified
+// against the one published with the release. The checksum file must be
+// accompanied by a ".sig" asset holding its Ed25519 signature from the
+// release signing key that vice was built with, so that a compromised
+// download can't vouch for itself. Plain executables are downloaded next
+// to the running one and swapped in for it right away; installers and
+// disk images are staged in the update directory and opened the next
+// time vice is launched.
+
+// updateSigningKey is the hex-encoded Ed25519 public key for release
+// checksum signatures. It's set for release builds with
+// -ldflags "-X main.updateSigningKey=..."; builds without it can't
+// download updates.
+var updateSigningKey string
+
+// Checksum files and signatures larger than this are rejected.
+const updateMaxChecksumFileSize = 64 * 1024
+
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// StagedUpdate records a downloaded update that is waiting to be
+// installed; it's stored as JSON in the update directory.
+type StagedUpdate struct {
+	Version string
+	File    string // name of the file in the update directory
+	SHA256  string
+}
+
+var (
+	ErrNoUpdateAsset       = errors.New("No download is available for this platform")
+	ErrNoUpdateChecksum    = errors.New("No signed checksum was published for the download")
+	ErrChecksumMismatch    = errors.New("Downloaded file's checksum doesn't match the published one")
+	ErrNoUpdateSigningKey  = errors.New("This build of vice can't verify downloaded updates")
+	ErrBadUpdateSignature  = errors.New("The release's checksums don't have a valid signature")
+	ErrInvalidStagedUpdate = errors.New("Staged update is not a file in the update directory")
+	ErrUpdateFileTooLarge  = errors.New("Checksum file is too large")
+)
+
+// installerExtensions are the file extensions of the updates that may be
+// staged; the installers are run and the rest are opened.
+var installerExtensions = []string{".msi", ".exe", ".dmg", ".pkg", ".zip", ".gz", ".tgz"}
+
+func updateDirectory() string {
+	return path.Join(path.Dir(configFilePath()), "update")
+}
+
+func stagedUpdatePath() string {
+	return path.Join(updateDirectory(), "staged.json")
+}
+
+// canDownloadUpdate returns true if vice can download and install one of
+// the given release assets itself.
+func canDownloadUpdate(assets []ReleaseAsset) bool {
+	return updateSigningKey != "" && platformAsset(assets) != nil
+}
+
+// platformAsset returns the release asset for the platform vice is
+// running on, or nil if there isn't one.
+func platformAsset(assets []ReleaseAsset) *ReleaseAsset {
+	keywords := map[string][]string{
+		"windows": []string{"windows", "win64", ".msi"},
+		"darwin":  []string{"mac", "darwin", "osx", ".dmg"},
+		"linux":   []string{"linux"},
+	}[runtime.GOOS]
+
+	for i, a := range assets {
+		name := strings.ToLower(a.Name)
+		if isChecksumAsset(name) || strings.HasSuffix(name, ".sig") {
+			continue
+		}
+		for _, kw := range keywords {
+			if strings.Contains(name, kw) {
+				return &assets[i]
+			}
+		}
+	}
+	return nil
+}
+
+func isChecksumAsset(name string) bool {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, ".sig") {
+		return false
+	}
+	return strings.HasSuffix(name, ".sha256") || strings.Contains(name, "checksums") ||
+		strings.HasPrefix(name, "sha256sums")
+}
+
+// updateGet requests the given URL, returning an error if the server
+// doesn't return it.
+func updateGet(url string) (*http.Response, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// fetchSmallAsset returns the contents of a checksum file or signature.
+func fetchSmallAsset(a ReleaseAsset) ([]byte, error) {
+	resp, err := updateGet(a.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, updateMaxChecksumFileSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(b) > updateMaxChecksumFileSize {
+		return nil, ErrUpdateFileTooLarge
+	}
+	return b, nil
+}
+
+// publishedChecksum finds the SHA-256 checksum for the given asset in the
+// release's signed checksum files, which are expected to be in the
+// format written by sha256sum. Each one's signature is in an asset with
+// the same name and ".sig" appended, holding the raw 64-byte signature.
+func publishedChecksum(asset *ReleaseAsset, assets []ReleaseAsset) (string, error) {
+	key, err := hex.DecodeString(updateSigningKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return "", ErrNoUpdateSigningKey
+	}
+
+	for _, a := range assets {
+		if !isChecksumAsset(a.Name) {
+			continue
+		}
+		sigIdx := FindIf(assets, func(s ReleaseAsset) bool { return s.Name == a.Name+".sig" })
+		if sigIdx == -1 {
+			lg.Printf("Update: %s is not signed", a.Name)
+			continue
+		}
+
+		sums, err := fetchSmallAsset(a)
+		if err != nil {
+			return "", err
+		}
+		sig, err := fetchSmallAsset(assets[sigIdx])
+		if err != nil {
+			return "", err
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+			return "", ErrBadUpdateSignature
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(sums))
+		for scanner.Scan() {
+			f := strings.Fields(scanner.Text())
+			if len(f) == 1 && a.Name == asset.Name+".sha256" {
+				return strings.ToLower(f[0]), nil
+			} else if len(f) == 2 && strings.TrimPrefix(f[1], "*") == asset.Name {
+				return strings.ToLower(f[0]), nil
+			}
+		}
+	}
+	return "", ErrNoUpdateChecksum
+}
+
+func fileChecksum(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// downloadUpdate downloads and verifies the platform's asset from the
+// given release, sending progress messages to status as it goes. If the
+// update can be installed immediately, it is; otherwise it's staged for
+// the next launch. The final message sent describes the outcome.
+func downloadUpdate(version string, assets []ReleaseAsset, status chan string) {
+	defer reportGoroutinePanic()
+	defer close(status)
+
+	err := func() error {
+		asset := platformAsset(assets)
+		if asset == nil {
+			return ErrNoUpdateAsset
+		}
+
+		status <- "Fetching checksum..."
+		checksum, err := publishedChecksum(asset, assets)
+		if err != nil {
+			return err
+		}
+
+		// A bare executable can replace the running one; it's downloaded
+		// to the same directory so that it can be renamed over it.
+		// Everything else goes in the update directory.
+		var f *os.File
+		exe := ""
+		if filepath.Ext(asset.Name) == "" && runtime.GOOS != "windows" {
+			if exe, err = currentExecutable(); err != nil {
+				return err
+			}
+			f, err = os.CreateTemp(filepath.Dir(exe), ".vice-update-*")
+		} else {
+			if !installerExtension(asset.Name) || filepath.Base(asset.Name) != asset.Name {
+				return ErrNoUpdateAsset
+			}
+			if err := os.MkdirAll(updateDirectory(), 0o700); err != nil {
+				return err
+			}
+			f, err = os.Create(path.Join(updateDirectory(), asset.Name))
+		}
+		if err != nil {
+			return err
+		}
+		filename := f.Name()
+
+		status <- fmt.Sprintf("Downloading %s (%d MB)...", asset.Name, asset.Size/(1024*1024))
+		err = func() error {
+			defer f.Close()
+			resp, err := updateGet(asset.URL)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if _, err := io.Copy(f, resp.Body); err != nil {
+				return err
+			}
+			return f.Close()
+		}()
+		if err != nil {
+			os.Remove(filename)
+			return err
+		}
+
+		status <- "Verifying download..."
+		if sum, err := fileChecksum(filename); err != nil {
+			os.Remove(filename)
+			return err
+		} else if sum != checksum {
+			os.Remove(filename)
+			return ErrChecksumMismatch
+		}
+
+		if exe != "" {
+			if err := replaceExecutable(filename, exe); err != nil {
+				os.Remove(filename)
+				return err
+			}
+			status <- fmt.Sprintf("vice %s has been installed; it will be used the next time vice is started.", version)
+			return nil
+		}
+
+		staged, err := json.Marshal(StagedUpdate{Version: version, File: asset.Name, SHA256: checksum})
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(stagedUpdatePath(), staged, 0o600); err != nil {
+			return err
+		}
+		status <- fmt.Sprintf("vice %s has been downloaded; it will be installed the next time vice is started.", version)
+		return nil
+	}()
+
+	if err != nil {
+		lg.Errorf("Update: %v", err)
+		status <- "Unable to update: " + err.Error()
+	}
+}
+
+// currentExecutable returns the path to the running executable, with
+// symbolic links resolved.
+func currentExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func replaceExecutable(filename string, exe string) error {
+	if err := os.Chmod(filename, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(filename, exe)
+}
+
+func installerExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return Find(installerExtensions, ext) != -1
+}
+
+// installStagedUpdate is called at startup; if an update has been
+// downloaded, it re-verifies it and then starts its installer or opens it.
+// It returns true if vice should exit so that the installer can run.
+func installStagedUpdate() bool {
+	b, err := os.ReadFile(stagedUpdatePath())
+	if err != nil {
+		// Nothing has been staged.
+		return false
+	}
+	os.Remove(stagedUpdatePath())
+
+	var su StagedUpdate
+	if err := json.Unmarshal(b, &su); err != nil {
+		lg.Errorf("%s: %v", stagedUpdatePath(), err)
+		return false
+	}
+	// Only files that downloadUpdate could have staged are considered,
+	// so that a modified staged.json can't be used to run something
+	// else.
+	if su.File == "" || filepath.Base(su.File) != su.File || !installerExtension(su.File) {
+		lg.Errorf("%s: %v", su.File, ErrInvalidStagedUpdate)
+		return false
+	}
+	file := path.Join(updateDirectory(), su.File)
+
+	if sum, err := fileChecksum(file); err != nil {
+		lg.Errorf("%s: %v", file, err)
+		return false
+	} else if sum != su.SHA256 {
+		lg.Errorf("%s: %v", file, ErrChecksumMismatch)
+		os.Remove(file)
+		return false
+	}
+
+	lg.Printf("Installing vice %s from %s", su.Version, file)
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".msi":
+		if err := exec.Command("msiexec", "/i", file).Start(); err != nil {
+			lg.Errorf("%s: %v", file, err)
+			return false
+		}
+		return true
+	case ".exe":
+		if err := exec.Command(file).Start(); err != nil {
+			lg.Errorf("%s: %v", file, err)
+			return false
+		}
+		return true
+	default:
+		// Disk images and archives are opened for the user to finish
+		// installing.
+		if err := browser.OpenFile(file); err != nil {
+			lg.Errorf("%s: %v", file, err)
+		}
+		return false
+	}
+}
+
+// UpdateModalClient shows the progress of downloading an update.
+type UpdateModalClient struct {
+	version string
+	status  chan string
+	message string
+	done    bool
+}
+
+func NewUpdateModalClient(version string, assets []ReleaseAsset) *UpdateModalClient {
+	u := &UpdateModalClient{
+		version: version,
+		status:  make(chan string, 4),
+		message: "Starting download...",
+	}
+	go downloadUpdate(version, assets, u.status)
+	return u
+}
+
+func (u *UpdateModalClient) Title() string { return "Updating vice" }
+func (u *UpdateModalClient) Opening()      {}
+
+func (u *UpdateModalClient) Buttons() []ModalDialogButton {
+	return []ModalDialogButton{ModalDialogButton{text: "Ok", disabled: !u.done}}
+}
+
+func (u *UpdateModalClient) Draw() int {
+	// Get the latest status from the downloading goroutine without
+	// blocking.
+	for !u.done {
+		select {
+		case msg, ok := <-u.status:
+			if ok {
+				u.message = msg
+				continue
+			}
+			u.done = true
+		default:
+		}
+		break
+	}
+
+	imgui.Text(u.message)
+	return -1
+}
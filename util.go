@@ -117,6 +117,73 @@ func stopShouting(orig string) string {
 	return s.String()
 }
 
+// replaceWholeName returns s with each occurrence of old that isn't part
+// of a longer name--i.e., that isn't preceded or followed by a letter,
+// digit, underscore, hyphen, or period--replaced with new. It's meant for
+// replacing file path components and user names.
+func replaceWholeName(s, old, new string) string {
+	if old == "" {
+		return s
+	}
+	isNameChar := func(b byte) bool {
+		return b >= 0x80 || b == '_' || b == '-' || b == '.' ||
+			(b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+	}
+
+	var r strings.Builder
+	for {
+		i := strings.Index(s, old)
+		if i == -1 {
+			break
+		}
+		end := i + len(old)
+		if (i == 0 || !isNameChar(s[i-1])) && (end == len(s) || !isNameChar(s[end])) {
+			r.WriteString(s[:i])
+			r.WriteString(new)
+		} else {
+			r.WriteString(s[:end])
+		}
+		s = s[end:]
+	}
+	r.WriteString(s)
+	return r.String()
+}
+
+// editDistance returns the Levenshtein distance between the two strings:
+// the number of single-character insertions, deletions, and substitutions
+// needed to turn one into the other.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// closestMatch returns the candidate that is the fewest edits from s, as
+// long as it's within maxDistance edits. Ties go to the earlier candidate.
+func closestMatch(s string, candidates []string, maxDistance int) (string, bool) {
+	best, bestDistance := "", maxDistance+1
+	for _, c := range candidates {
+		if d := editDistance(s, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best, bestDistance <= maxDistance
+}
+
 // atof is a utility for parsing floating point values that sends errors to
 // the logging system.
 func atof(s string) float64 {
@@ -530,6 +597,19 @@ func PointLineDistance(p, p0, p1 [2]float32) float32 {
 	return abs(SignedPointLineDistance(p, p0, p1))
 }
 
+// PointSegmentDistance returns the minimum distance from the point p to
+// the line segment (p0, p1).
+func PointSegmentDistance(p, p0, p1 [2]float32) float32 {
+	v := sub2f(p1, p0)
+	sq := v[0]*v[0] + v[1]*v[1]
+	if sq == 0 {
+		return distance2f(p, p0)
+	}
+	w := sub2f(p, p0)
+	t := clamp((w[0]*v[0]+w[1]*v[1])/sq, 0, 1)
+	return distance2f(p, add2f(p0, scale2f(v, t)))
+}
+
 // Returns the vertex coordinates of an equilateral triangle centered at
 // the origin with specified height.
 func EquilateralTriangleVertices(height float32) [3][2]float32 {
@@ -555,6 +635,71 @@ func PointInPolygon(p Point2LL, pts []Point2LL) bool {
 	return inside
 }
 
+// TriangulatePolygon returns a triangulation of the simple polygon with
+// the given vertices, found using ear clipping. The polygon may be given
+// either open or closed (i.e., with the first vertex repeated at the end).
+func TriangulatePolygon(pts []Point2LL) [][3]Point2LL {
+	if n := len(pts); n > 1 && pts[0] == pts[n-1] {
+		pts = pts[:n-1]
+	}
+	if len(pts) < 3 {
+		return nil
+	}
+
+	// Work with the vertices in counter-clockwise order.
+	idx := make([]int, len(pts))
+	var area float32
+	for i := range pts {
+		idx[i] = i
+		j := (i + 1) % len(pts)
+		area += pts[i][0]*pts[j][1] - pts[j][0]*pts[i][1]
+	}
+	if area < 0 {
+		for i, j := 0, len(idx)-1; i < j; i, j = i+1, j-1 {
+			idx[i], idx[j] = idx[j], idx[i]
+		}
+	}
+
+	cross := func(a, b, c Point2LL) float32 {
+		return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+	}
+
+	var tris [][3]Point2LL
+	for len(idx) > 3 {
+		clipped := false
+		for i := range idx {
+			a, b, c := pts[idx[(i+len(idx)-1)%len(idx)]], pts[idx[i]], pts[idx[(i+1)%len(idx)]]
+			if cross(a, b, c) <= 0 {
+				// reflex vertex
+				continue
+			}
+
+			// It's an ear if none of the other vertices are inside the
+			// triangle.
+			ear := true
+			for _, j := range idx {
+				if p := pts[j]; p != a && p != b && p != c &&
+					cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0 {
+					ear = false
+					break
+				}
+			}
+			if ear {
+				tris = append(tris, [3]Point2LL{a, b, c})
+				idx = DeleteSliceElement(idx, i)
+				clipped = true
+				break
+			}
+		}
+		if !clipped {
+			// Degenerate or self-intersecting polygon; return what we
+			// have so far.
+			return tris
+		}
+	}
+	return append(tris, [3]Point2LL{pts[idx[0]], pts[idx[1]], pts[idx[2]]})
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // RGB
 
@@ -590,6 +735,7 @@ func RGBFromHex(c int) RGB {
 
 const NauticalMilesToFeet = 6076.12
 const FeetToNauticalMiles = 1 / NauticalMilesToFeet
+const KilometersToFeet = 3280.84
 
 // Point2LL represents a 2D point on the Earth in latitude-longitude.
 // Important: 0 (x) is longitude, 1 (y) is latitude
@@ -859,6 +1005,29 @@ func nmdistance2ll(a Point2LL, b Point2LL) float32 {
 	return sqrt(sqr(dlat) + sqr(dlong))
 }
 
+// nmpathlength2ll returns the length in nautical miles of the polyline
+// given by the provided points.
+func nmpathlength2ll(path []Point2LL) float32 {
+	var d float32
+	for i := 0; i+1 < len(path); i++ {
+		d += nmdistance2ll(path[i], path[i+1])
+	}
+	return d
+}
+
+// nmpathpoint2ll returns the point that is the given distance in nautical
+// miles from the end of the provided polyline, clamping to its start.
+func nmpathpoint2ll(path []Point2LL, fromEnd float32) Point2LL {
+	for i := len(path) - 1; i > 0; i-- {
+		d := nmdistance2ll(path[i-1], path[i])
+		if fromEnd <= d {
+			return Point2LL(lerp2f(fromEnd/d, path[i], path[i-1]))
+		}
+		fromEnd -= d
+	}
+	return path[0]
+}
+
 // nmlength2ll returns the length of a vector expressed in lat-long
 // coordinates.
 func nmlength2ll(a Point2LL) float32 {
@@ -1551,3 +1720,7 @@ func (e *ErrorLogger) PrintErrors() {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
+
+func (e *ErrorLogger) String() string {
+	return strings.Join(e.errors, "\n")
+}
@@ -30,6 +30,52 @@ func TestStopShouting(t *testing.T) {
 	}
 }
 
+func TestReplaceWholeName(t *testing.T) {
+	for _, test := range []struct {
+		s, old, new, expected string
+	}{
+		{"/home/al/vice/config.json", "/home/al", "~", "~/vice/config.json"},
+		{"/home/alice/vice/config.json", "/home/al", "~", "/home/alice/vice/config.json"},
+		{"open /home/al: no such file", "/home/al", "~", "open ~: no such file"},
+		{`C:\Users\al\vice.exe`, "al", "user", `C:\Users\user\vice.exe`},
+		{"main.globalConfig.Save al", "al", "user", "main.globalConfig.Save user"},
+		{"al", "al", "user", "user"},
+		{"signal", "al", "user", "signal"},
+	} {
+		if r := replaceWholeName(test.s, test.old, test.new); r != test.expected {
+			t.Errorf("replaceWholeName(%q, %q, %q) = %q, expected %q", test.s, test.old, test.new, r, test.expected)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0}, {"CAMRN", "CAMRN", 0}, {"CAMRN", "CAMREN", 1}, {"CAMRN", "CMARN", 2},
+		{"", "ROBER", 5}, {"I22L", "I4L", 2}, {"KENNY", "KEENE", 2},
+	} {
+		if d := editDistance(test.a, test.b); d != test.d {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.a, test.b, d, test.d)
+		}
+	}
+
+	if m, ok := closestMatch("CAMREN", []string{"LENDY", "CAMRN", "CAMRE"}, 2); !ok || m != "CAMRN" {
+		t.Errorf("closestMatch returned %q, %v; expected CAMRN", m, ok)
+	}
+	if m, ok := closestMatch("ZZZZZ", []string{"LENDY", "CAMRN"}, 2); ok {
+		t.Errorf("closestMatch unexpectedly matched %q", m)
+	}
+	// Short names only match names that are closer to them.
+	if m, ok := closestMatch("ROB", []string{"RBV", "LENDY"}, maxSuggestionDistance("ROB")); ok {
+		t.Errorf("closestMatch unexpectedly matched %q", m)
+	}
+	if m, ok := closestMatch("22R", []string{"4L", "22L"}, maxSuggestionDistance("22R")); !ok || m != "22L" {
+		t.Errorf("closestMatch returned %q, %v; expected 22L", m, ok)
+	}
+}
+
 func TestArgmin(t *testing.T) {
 	if argmin(1) != 0 {
 		t.Errorf("argmin single failed: %d", argmin(1))
@@ -439,3 +485,58 @@ func TestPointInPolygon(t *testing.T) {
 		})
 	}
 }
+
+func TestTriangulatePolygon(t *testing.T) {
+	area := func(tris [][3]Point2LL) float32 {
+		var a float32
+		for _, tri := range tris {
+			a += abs((tri[1][0]-tri[0][0])*(tri[2][1]-tri[0][1])-(tri[1][1]-tri[0][1])*(tri[2][0]-tri[0][0])) / 2
+		}
+		return a
+	}
+
+	type testCase struct {
+		name    string
+		polygon []Point2LL
+		ntris   int
+		area    float32
+	}
+	testCases := []testCase{
+		{
+			name:    "Square",
+			polygon: []Point2LL{{0, 0}, {0, 2}, {2, 2}, {2, 0}, {0, 0}},
+			ntris:   2,
+			area:    4,
+		},
+		{
+			name:    "OpenCounterClockwiseSquare",
+			polygon: []Point2LL{{0, 0}, {2, 0}, {2, 2}, {0, 2}},
+			ntris:   2,
+			area:    4,
+		},
+		{
+			name:    "LShape",
+			polygon: []Point2LL{{0, 0}, {2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}, {0, 0}},
+			ntris:   4,
+			area:    3,
+		},
+		{
+			name:    "Degenerate",
+			polygon: []Point2LL{{0, 0}, {1, 1}},
+			ntris:   0,
+			area:    0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tris := TriangulatePolygon(tc.polygon)
+			if len(tris) != tc.ntris {
+				t.Errorf("Expected %d triangles, got %d: %v", tc.ntris, len(tris), tris)
+			}
+			if a := area(tris); abs(a-tc.area) > 1e-5 {
+				t.Errorf("Expected area %f, got %f", tc.area, a)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// vfr.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// VFR traffic: the Sim spawns general aviation aircraft at a configurable
+// rate that squawk 1200 and transit the area at VFR cruising altitudes.
+// Some of them call up requesting flight following a few minutes after
+// they appear. The user then issues a beacon code ("SQ", optionally
+// followed by a code), radar identifies the aircraft once it's squawking
+// it ("ID"), which starts a track, and eventually terminates radar
+// services ("TS"), after which the aircraft squawks VFR again.
+
+var ErrNotSquawkingAssignedCode = errors.New("Aircraft isn't squawking an assigned beacon code")
+var ErrNotReceivingServices = errors.New("Aircraft isn't receiving radar services")
+
+const (
+	vfrSquawk = Squawk(0o1200)
+	// VFR aircraft appear and leave this many nm from the scenario
+	// group's center.
+	vfrTransitRadius = 40
+	// Probability that a VFR aircraft requests flight following.
+	vfrFlightFollowingProbability = 0.4
+)
+
+// Aircraft types that VFR traffic is drawn from.
+var vfrAircraftTypes = []string{"C150", "C172", "C182", "P28A", "BE36", "DA42", "C337"}
+
+// spawnVFR spawns a VFR aircraft that transits the area along a random
+// track.
+func (sim *Sim) spawnVFR() *Aircraft {
+	acType := Sample(vfrAircraftTypes)
+	perf, ok := database.AircraftPerformance[acType]
+	if !ok {
+		lg.Errorf("%s: VFR aircraft type not found in performance database", acType)
+		return nil
+	}
+
+	callsign := sim.vfrCallsign()
+
+	// Enter at a random bearing from the center and leave on the far
+	// side, though not necessarily directly opposite.
+	pointAt := func(theta float64, nm float32) Point2LL {
+		v := [2]float32{nm * float32(math.Sin(theta)), nm * float32(math.Cos(theta))}
+		return add2ll(scenarioGroup.Center, nm2ll(v))
+	}
+	theta := 2 * math.Pi * float64(rand.Float32())
+	exitTheta := theta + math.Pi + float64(lerp(rand.Float32(), -1, 1))
+	entry, exit := pointAt(theta, vfrTransitRadius), pointAt(exitTheta, vfrTransitRadius)
+
+	// VFR cruising altitudes: odd thousands plus 500' eastbound, even
+	// thousands plus 500' westbound.
+	hdg := headingp2ll(entry, exit, scenarioGroup.MagneticVariation)
+	ceiling := min(9500, perf.Ceiling-1000)
+	alt := 2500 + 1000*rand.Intn(max(1, (ceiling-2500)/1000+1))
+	if east := hdg < 180; east != ((alt/1000)%2 == 1) {
+		alt += 1000
+		if alt > ceiling {
+			alt -= 2000
+		}
+	}
+
+	ac := &Aircraft{
+		Callsign: callsign,
+		Squawk:   vfrSquawk,
+		Mode:     Charlie,
+		FlightPlan: &FlightPlan{
+			Rules:            VFR,
+			AircraftType:     acType,
+			DepartureAirport: sim.nearestVFRAirport(pointAt(theta, 2*vfrTransitRadius)),
+			ArrivalAirport:   sim.nearestVFRAirport(pointAt(exitTheta, 2*vfrTransitRadius)),
+			Altitude:         alt,
+		},
+		Performance: perf,
+		Waypoints: []Waypoint{
+			Waypoint{Fix: "_VFR_ENTRY", Location: entry},
+			Waypoint{Fix: "_VFR_EXIT", Location: exit, Commands: []WaypointCommand{WaypointCommandDelete}},
+		},
+		Altitude: float32(alt),
+		IAS:      float32(perf.Speed.Cruise),
+	}
+	if !sim.addAircraft(ac) {
+		return nil
+	}
+
+	if rand.Float32() < vfrFlightFollowingProbability {
+		if sim.vfrCallUps == nil {
+			sim.vfrCallUps = make(map[string]time.Time)
+		}
+		sim.vfrCallUps[callsign] = sim.CurrentTime().Add(time.Duration(1+rand.Intn(6)) * time.Minute)
+	}
+	return ac
+}
+
+// vfrCallsign returns a random N-number that isn't in use.
+func (sim *Sim) vfrCallsign() string {
+	callsign := ""
+	for callsign == "" || sim.Aircraft[callsign] != nil {
+		callsign = fmt.Sprintf("N%d%c%c", 1+rand.Intn(999), 'A'+rand.Intn(26), 'A'+rand.Intn(26))
+	}
+	return callsign
+}
+
+// nearestVFRAirport returns the identifier of the airport closest to the
+// given point, which must be 2*vfrTransitRadius from the scenario
+// group's center. Rather than checking all of the airports for each VFR
+// aircraft, the ones that may be the closest are found the first time
+// it's called.
+func (sim *Sim) nearestVFRAirport(p Point2LL) string {
+	if sim.vfrAirports == nil {
+		// If the airport closest to the center is d nm away, all of the
+		// points are within 2*vfrTransitRadius+d of it, so the closest
+		// airport to each one is within 4*vfrTransitRadius+d of the
+		// center.
+		c := scenarioGroup.Center
+		d := float32(math.MaxFloat32)
+		for _, ap := range database.Airports {
+			d = min(d, nmdistance2ll(c, ap.Location))
+		}
+		for _, id := range SortedMapKeys(database.Airports) {
+			if ap := database.Airports[id]; nmdistance2ll(c, ap.Location) <= 4*vfrTransitRadius+d {
+				sim.vfrAirports = append(sim.vfrAirports, ap)
+			}
+		}
+	}
+
+	id, dist := "", float32(0)
+	for _, ap := range sim.vfrAirports {
+		if d := nmdistance2ll(p, ap.Location); id == "" || d < dist {
+			id, dist = ap.Id, d
+		}
+	}
+	return id
+}
+
+// updateVFR spawns VFR aircraft and has aircraft call up for flight
+// following; it should be called once a second.
+func (sim *Sim) updateVFR(now time.Time) {
+	if rate := float32(sim.VFRRate) * sim.trafficScale(); rate > 0 && now.After(sim.NextVFRSpawn) {
+		sim.spawnVFR()
+		seconds := lerp(rand.Float32(), .85, 1.15) * 3600 / rate
+		sim.NextVFRSpawn = now.Add(time.Duration(seconds * float32(time.Second)))
+	}
+
+	for _, callsign := range SortedMapKeys(sim.vfrCallUps) {
+		ac, ok := sim.Aircraft[callsign]
+		if !ok || ac.TrackingController != "" {
+			delete(sim.vfrCallUps, callsign)
+		} else if now.After(sim.vfrCallUps[callsign]) {
+			delete(sim.vfrCallUps, callsign)
+			text := fmt.Sprintf("%s, %s, %d, request VFR flight following to %s", callsign,
+				ac.FlightPlan.AircraftType, 100*int((ac.Altitude+50)/100), ac.FlightPlan.ArrivalAirport)
+			pilotResponse(callsign, "%s", text)
+			sim.addPilotRequest(ac, PilotRequestFlightFollowing, 0, text)
+		}
+	}
+}
+
+// allocateSquawk returns a discrete beacon code that isn't in use by
+// any other aircraft.
+func (sim *Sim) allocateSquawk() Squawk {
+	used := make(map[Squawk]interface{})
+	for _, ac := range sim.Aircraft {
+		used[ac.Squawk] = nil
+		used[ac.AssignedSquawk] = nil
+	}
+	for {
+		sq := Squawk(0o0100 + rand.Intn(0o6700))
+		if _, ok := used[sq]; !ok && sq != vfrSquawk {
+			return sq
+		}
+	}
+}
+
+// IssueSquawk tells the aircraft to squawk the given beacon code; if it
+// is zero, the aircraft's assigned code is used, allocating one if it
+// doesn't have one.
+func (sim *Sim) IssueSquawk(callsign string, squawk Squawk) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if squawk == 0 {
+		squawk = ac.AssignedSquawk
+		if squawk == 0 || squawk == vfrSquawk {
+			squawk = sim.allocateSquawk()
+		}
+	}
+
+	ac.AssignedSquawk = squawk
+	ac.Squawk = squawk
+	eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+	pilotReadback(callsign, "squawk", ReadbackData{Squawk: squawk})
+	return nil
+}
+
+// radarIdentify identifies an aircraft squawking its assigned code and
+// starts a track on it for the given controller, if it isn't already
+// tracked.
+func (sim *Sim) radarIdentify(controller string, callsign string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if ac.AssignedSquawk == 0 || ac.Squawk != ac.AssignedSquawk {
+		return ErrNotSquawkingAssignedCode
+	}
+	if ac.TrackingController == "" {
+		ac.TrackingController = controller
+		eventStream.Post(&InitiatedTrackEvent{ac: ac})
+	} else if ac.TrackingController != controller {
+		return ErrOtherControllerHasTrack
+	}
+
+	ac.FlightFollowing = ac.FlightPlan != nil && ac.FlightPlan.Rules != IFR
+	delete(sim.vfrCallUps, callsign)
+	sim.PilotRequests = FilterSlice(sim.PilotRequests, func(r *PilotRequest) bool {
+		return r.Callsign != callsign || r.Type != PilotRequestFlightFollowing
+	})
+	eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+	pilotReadback(callsign, "radar_contact", ReadbackData{})
+	return nil
+}
+
+// terminateServices terminates the given controller's radar services for
+// a VFR aircraft, which then squawks VFR and leaves the frequency.
+func (sim *Sim) terminateServices(controller string, callsign string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+	if !ac.FlightFollowing || ac.TrackingController != controller {
+		return ErrNotReceivingServices
+	}
+
+	ac.FlightFollowing = false
+	ac.TrackingController = ""
+	ac.AssignedSquawk = 0
+	ac.Squawk = vfrSquawk
+	eventStream.Post(&ModifiedAircraftEvent{ac: ac})
+	pilotReadback(callsign, "terminate_services", ReadbackData{})
+	return nil
+}
+
+// runSquawkCommand handles "SQ", optionally followed by a beacon code.
+func (sim *Sim) runSquawkCommand(callsign string, command string) error {
+	code := strings.TrimPrefix(command, "SQ")
+	if code == "" {
+		return sim.IssueSquawk(callsign, 0)
+	}
+	sq, err := ParseSquawk(code)
+	if err != nil {
+		return ErrInvalidCommandParameter
+	}
+	return sim.IssueSquawk(callsign, sq)
+}
@@ -0,0 +1,146 @@
+// via.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// "Descend via" and "climb via" clearances let an aircraft fly the
+// vertical profile of its STAR or SID rather than a single assigned
+// altitude: arrivals descend to meet the at-or-below and at restrictions
+// along their route (see Aircraft.vnavDescent) and departures climb as
+// fast as they can without busting at-or-below restrictions ahead. In both
+// cases the aircraft levels off at the procedure's bottom or top altitude,
+// which is taken to be the lowest or highest altitude restriction ahead on
+// its route; that is what the pilot sets in the altitude selector and what
+// the STARS datablock shows. The commands are DVS and CVS; assigning an
+// altitude cancels them.
+
+// routeProcedure returns the name of the SID (if sid is true) or STAR
+// in the given route or the empty string if there isn't one. A SID must
+// come before the route's first airway or enroute fix and a STAR after
+// its last one; in fields joined with ".", a SID is followed by its
+// transition, as in "DEEZZ5.CANDR", and a STAR is preceded by its
+// transition, as in "KORRY.CAMRN4".
+func routeProcedure(route string, sid bool) string {
+	isProcedure := func(s string) bool {
+		if len(s) < 4 || len(s) > 7 || !unicode.IsDigit(rune(s[len(s)-1])) {
+			return false
+		}
+		for _, r := range s[:len(s)-1] {
+			if !unicode.IsLetter(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	fields := strings.Fields(route)
+	for i := range fields {
+		f := fields[i]
+		if !sid {
+			f = fields[len(fields)-1-i]
+		}
+
+		segs := strings.Split(f, ".")
+		if len(segs) == 1 {
+			if isProcedure(f) {
+				return f
+			}
+			// An airway or enroute fix.
+			return ""
+		}
+		for j, s := range segs {
+			if isProcedure(s) && (j < len(segs)-1) == sid {
+				return s
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// viaAltitude returns the bottom altitude (if descending) or top altitude
+// of the procedure the aircraft is flying, based on the altitude
+// restrictions at its remaining waypoints; it returns false if there are
+// none that would have the aircraft descend or climb.
+func (ac *Aircraft) viaAltitude(descend bool) (int, bool) {
+	alt := 0
+	for _, wp := range ac.Waypoints {
+		lo, hi := wp.AltitudeLimits()
+		if descend && hi != 0 && (alt == 0 || hi < alt) {
+			alt = hi
+		} else if !descend {
+			alt = max(alt, max(lo, hi))
+		}
+	}
+	if alt == 0 || (descend && float32(alt) >= ac.Altitude) || (!descend && float32(alt) <= ac.Altitude) {
+		return 0, false
+	}
+	return alt, true
+}
+
+// CancelVia cancels a descend via or climb via clearance.
+func (ac *Aircraft) CancelVia() {
+	ac.DescendVia, ac.ClimbVia, ac.ViaAltitude = false, false, 0
+}
+
+// DescendViaSTAR clears the aircraft to descend via its STAR.
+func (sim *Sim) DescendViaSTAR(callsign string) error {
+	return sim.clearVia(callsign, true)
+}
+
+// ClimbViaSID clears the aircraft to climb via its SID.
+func (sim *Sim) ClimbViaSID(callsign string) error {
+	return sim.clearVia(callsign, false)
+}
+
+func (sim *Sim) clearVia(callsign string, descend bool) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+
+	proc := "SID"
+	if descend {
+		proc = "arrival"
+	}
+	if ac.FlightPlan != nil {
+		if name := routeProcedure(ac.FlightPlan.Route, !descend); name != "" {
+			if descend {
+				proc = name + " arrival"
+			} else {
+				proc = name + " departure"
+			}
+		}
+	}
+
+	alt, ok := ac.viaAltitude(descend)
+	if !ok {
+		pilotReadback(callsign, "unable_via", ReadbackData{Procedure: proc})
+		return ErrUnableCommand
+	}
+	if em := ac.Emergency; !descend && em != nil && em.MaxAltitude != 0 && alt > em.MaxAltitude {
+		pilotReadback(callsign, "unable_altitude_emergency", ReadbackData{Altitude: em.MaxAltitude})
+		return ErrUnableCommand
+	}
+
+	if descend {
+		pilotReadback(callsign, "descend_via", ReadbackData{Procedure: proc, Altitude: alt})
+	} else {
+		pilotReadback(callsign, "climb_via", ReadbackData{Procedure: proc, Altitude: alt})
+	}
+	lg.Printf("%s: via the %s to %d", callsign, proc, alt)
+
+	ac.AssignedAltitude, ac.AssignedAltitudeAfterSpeed, ac.CrossingAltitude = 0, 0, 0
+	ac.DescendVia, ac.ClimbVia, ac.ViaAltitude = descend, !descend, alt
+	ac.clearReadbackError(ReadbackErrorAltitude)
+	if wp := ac.Waypoints[0]; wp.Altitude != 0 {
+		ac.CrossingAltitude = wp.Altitude
+	}
+	return nil
+}
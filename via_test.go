@@ -0,0 +1,32 @@
+// via_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRouteProcedure(t *testing.T) {
+	for _, test := range []struct {
+		route     string
+		sid, star string
+	}{
+		{"KORRY.CAMRN4", "", "CAMRN4"},
+		{"DEEZZ5.CANDR J60 PSB", "DEEZZ5", ""},
+		{"PSB J60 CANDR CAMRN4", "", "CAMRN4"},
+		{"DEEZZ5 CANDR J60 PSB", "DEEZZ5", ""},
+		{"KJFK.DEEZZ5.CANDR J60 LVZ.LENDY6", "DEEZZ5", "LENDY6"},
+		{"J60 Q812 CANDR", "", ""},
+		{"", "", ""},
+		{"ABC1 ABCDEFGH1 AB1", "ABC1", ""},
+	} {
+		if p := routeProcedure(test.route, true); p != test.sid {
+			t.Errorf("%q: got SID %q, expected %q", test.route, p, test.sid)
+		}
+		if p := routeProcedure(test.route, false); p != test.star {
+			t.Errorf("%q: got STAR %q, expected %q", test.route, p, test.star)
+		}
+	}
+}
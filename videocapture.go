@@ -0,0 +1,249 @@
+// videocapture.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os/exec"
+	"path"
+	"time"
+)
+
+// Video capture records either the radar pane or the whole window to an
+// MP4 or WebM file. Frames are read back from the framebuffer at the rate
+// that vice is currently drawing them, up to videoCaptureFPS, and handed
+// off to an encoder goroutine that pipes raw RGBA frames to ffmpeg, which
+// must be installed and in the user's PATH. Frames are repeated as needed
+// to fill in for ones that weren't drawn or were dropped so that the
+// video plays back at the right speed.
+
+var ErrFFmpegNotFound = errors.New("Unable to find \"ffmpeg\"; it must be installed to record video")
+
+// Maximum frame rate of recorded videos.
+const videoCaptureFPS = 30
+
+var videoCapture struct {
+	recorder *VideoRecorder
+	// Time the last frame was drawn and the smoothed time between frames,
+	// in seconds, for measuring the frame rate.
+	lastDraw      time.Time
+	frameInterval float64
+	// The recorder itself is created when the first frame arrives, since
+	// that's when we know its size; until then, the filename to use is
+	// stored here.
+	pendingFilename string
+
+	wholeWindow bool
+	webm        bool
+}
+
+type VideoRecorder struct {
+	filename      string
+	width, height int
+	fps           int
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	frames chan videoFrame
+	done   chan error
+
+	start time.Time
+	// Number of frames of video that have been queued, counting repeats.
+	queued  int
+	dropped int
+}
+
+type videoFrame struct {
+	img    *image.RGBA
+	repeat int
+}
+
+// NewVideoRecorder launches ffmpeg to encode frames of the given size to
+// the given file at the given frame rate; the container and codec are
+// determined by the filename's extension.
+func NewVideoRecorder(filename string, width, height int, fps int) (*VideoRecorder, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, ErrFFmpegNotFound
+	}
+
+	// Most codecs require even dimensions.
+	width, height = width&^1, height&^1
+
+	args := []string{"-loglevel", "error", "-y",
+		"-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", width, height),
+		"-r", fmt.Sprintf("%d", fps), "-i", "-"}
+	if path.Ext(filename) == ".webm" {
+		args = append(args, "-c:v", "libvpx-vp9", "-b:v", "2M")
+	} else {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p")
+	}
+	args = append(args, filename)
+
+	vr := &VideoRecorder{
+		filename: filename,
+		width:    width,
+		height:   height,
+		fps:      fps,
+		cmd:      exec.Command(ffmpeg, args...),
+		frames:   make(chan videoFrame, 2*fps),
+		done:     make(chan error),
+		start:    time.Now(),
+	}
+	if vr.stdin, err = vr.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := vr.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go vr.encode()
+
+	lg.Printf("%s: started video recording, %dx%d at %d fps", filename, width, height, fps)
+	return vr, nil
+}
+
+// encode runs in its own goroutine, sending frames to ffmpeg until the
+// frames channel is closed.
+func (vr *VideoRecorder) encode() {
+	defer reportGoroutinePanic()
+	var err error
+	for f := range vr.frames {
+		for i := 0; i < f.repeat && err == nil; i++ {
+			_, err = vr.stdin.Write(f.img.Pix)
+		}
+	}
+	if cerr := vr.stdin.Close(); err == nil {
+		err = cerr
+	}
+	if werr := vr.cmd.Wait(); err == nil {
+		err = werr
+	}
+	vr.done <- err
+}
+
+// frameSlots returns the number of frames of video that should have been
+// queued by now.
+func (vr *VideoRecorder) frameSlots() int {
+	return 1 + int(time.Since(vr.start).Seconds()*float64(vr.fps))
+}
+
+// FrameDue returns true if it's time for another frame.
+func (vr *VideoRecorder) FrameDue() bool {
+	return vr.frameSlots() > vr.queued
+}
+
+// AddFrame queues the given image for encoding, repeated as needed to
+// fill the time since the previous one; it never blocks, so if the
+// encoder can't keep up, frames are dropped and later ones are repeated
+// in their place. Images that aren't the recording's size are cropped or
+// padded.
+func (vr *VideoRecorder) AddFrame(img *image.RGBA) {
+	slots := vr.frameSlots()
+	if slots <= vr.queued {
+		return
+	}
+
+	if img.Rect.Dx() != vr.width || img.Rect.Dy() != vr.height {
+		resized := image.NewRGBA(image.Rect(0, 0, vr.width, vr.height))
+		draw.Draw(resized, resized.Rect, img, image.Point{}, draw.Src)
+		img = resized
+	}
+
+	select {
+	case vr.frames <- videoFrame{img: img, repeat: slots - vr.queued}:
+		vr.queued = slots
+	default:
+		vr.dropped++
+	}
+}
+
+// Close finishes encoding and waits for ffmpeg to exit.
+func (vr *VideoRecorder) Close() error {
+	close(vr.frames)
+	err := <-vr.done
+	if vr.dropped > 0 {
+		lg.Printf("%s: dropped %d frames", vr.filename, vr.dropped)
+	}
+	lg.Printf("%s: finished video recording, err %v", vr.filename, err)
+	return err
+}
+
+func videoCaptureRecording() bool {
+	return videoCapture.recorder != nil || videoCapture.pendingFilename != ""
+}
+
+func videoCaptureStart() {
+	dir := globalConfig.ExportDirectory
+	if dir == "" {
+		dir = defaultDirectory("")
+	}
+	ext := ".mp4"
+	if videoCapture.webm {
+		ext = ".webm"
+	}
+	videoCapture.pendingFilename = path.Join(dir, "vice-"+time.Now().Format("20060102-150405")+ext)
+}
+
+func videoCaptureStop() {
+	videoCapture.pendingFilename = ""
+	if vr := videoCapture.recorder; vr != nil {
+		videoCapture.recorder = nil
+		go func() {
+			defer reportGoroutinePanic()
+			if err := vr.Close(); err != nil {
+				lg.Errorf("%s: %v", vr.filename, err)
+			}
+		}()
+	}
+}
+
+// videoCaptureFrame is called after the radar pane (wholeWindow == false)
+// and after the entire window (wholeWindow == true) have been rendered;
+// it measures the frame rate and reads back the given framebuffer
+// rectangle if it's time for a new frame of the current recording.
+func videoCaptureFrame(wholeWindow bool, x, y, w, h int) {
+	if wholeWindow != videoCapture.wholeWindow {
+		return
+	}
+
+	now := time.Now()
+	if !videoCapture.lastDraw.IsZero() {
+		dt := now.Sub(videoCapture.lastDraw).Seconds()
+		if videoCapture.frameInterval == 0 {
+			videoCapture.frameInterval = dt
+		} else {
+			videoCapture.frameInterval = 0.9*videoCapture.frameInterval + 0.1*dt
+		}
+	}
+	videoCapture.lastDraw = now
+
+	if w <= 0 || h <= 0 || !videoCaptureRecording() {
+		return
+	}
+
+	if videoCapture.recorder == nil {
+		fps := videoCaptureFPS
+		if videoCapture.frameInterval > 0 {
+			fps = clamp(int(1/videoCapture.frameInterval+0.5), 1, videoCaptureFPS)
+		}
+		vr, err := NewVideoRecorder(videoCapture.pendingFilename, w, h, fps)
+		videoCapture.pendingFilename = ""
+		if err != nil {
+			lg.Errorf("%v", err)
+			uiShowModalDialog(NewModalDialogBox(&ErrorModalClient{message: err.Error()}), false)
+			return
+		}
+		videoCapture.recorder = vr
+	} else if !videoCapture.recorder.FrameDue() {
+		return
+	}
+
+	videoCapture.recorder.AddFrame(renderer.ReadPixels(x, y, w, h))
+}
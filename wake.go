@@ -0,0 +1,143 @@
+// wake.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+)
+
+// Wake turbulence separation on final: the Sim checks each arrival that
+// is established on final against the aircraft ahead of it on the same
+// approach using the minima from 7110.65 5-5-4 for the two aircraft's
+// weight classes. An aircraft that gets inside the minimum reports a wake
+// encounter; one that gets well inside it goes around. Violations behind
+// Heavy and Super aircraft worked by the user are scored.
+
+// WakeCategory is a simplified wake turbulence category derived from an
+// aircraft's weight class.
+type WakeCategory int
+
+const (
+	WakeSmall WakeCategory = iota
+	WakeLarge
+	WakeHeavy
+	WakeSuper
+)
+
+func (c WakeCategory) String() string {
+	return [...]string{"small", "large", "heavy", "super"}[c]
+}
+
+// Aircraft that are closer than this fraction of the wake minimum go
+// around rather than continuing the approach.
+const wakeGoAroundFraction = 0.75
+
+func (perf AircraftPerformance) WakeCategory() WakeCategory {
+	switch perf.WeightClass {
+	case "J":
+		return WakeSuper
+	case "H":
+		return WakeHeavy
+	case "S", "S+":
+		return WakeSmall
+	default:
+		return WakeLarge
+	}
+}
+
+// wakeSeparation returns the minimum distance in nm that an aircraft of
+// the trailing category must be behind one of the leading category on
+// final; it returns 0 if wake separation doesn't apply.
+func wakeSeparation(lead, trail WakeCategory) float32 {
+	switch lead {
+	case WakeSuper:
+		return [...]float32{8, 7, 6, 0}[trail]
+	case WakeHeavy:
+		return [...]float32{6, 5, 4, 4}[trail]
+	case WakeLarge:
+		if trail == WakeSmall {
+			return 4
+		}
+	}
+	return 0
+}
+
+// precedingArrival returns the closest aircraft ahead of the given one on
+// final for the same runway or on a shared final, if there is one.
+func (sim *Sim) precedingArrival(ac *Aircraft) *Aircraft {
+	if ac.Approach == nil || ac.FlightPlan == nil || len(ac.Waypoints) == 0 {
+		return nil
+	}
+	threshold := ac.Waypoints[len(ac.Waypoints)-1].Location
+	dist := nmdistance2ll(ac.Position, threshold)
+	rwy := approachRunway(ac.Approach)
+
+	var lead *Aircraft
+	leadDist := float32(0)
+	for _, other := range sim.Aircraft {
+		if other == ac || !other.OnFinal || other.Rollout != nil || other.Approach == nil ||
+			other.FlightPlan == nil || nmdistance2ll(other.Position, threshold) >= dist {
+			continue
+		}
+		if (other.FlightPlan.ArrivalAirport != ac.FlightPlan.ArrivalAirport || approachRunway(other.Approach) != rwy) &&
+			!sim.onSharedFinal(ac, other) {
+			continue
+		}
+		if d := nmdistance2ll(ac.Position, other.Position); lead == nil || d < leadDist {
+			lead, leadDist = other, d
+		}
+	}
+	return lead
+}
+
+// checkWakeSeparation checks the arrivals on final for wake separation;
+// it should be called once a second.
+func (sim *Sim) checkWakeSeparation(now time.Time) {
+	if sim.wakeEncounters == nil {
+		sim.wakeEncounters = make(map[[2]string]interface{})
+	}
+
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if !ac.OnFinal || ac.Rollout != nil || ac.LiveADSB {
+			continue
+		}
+		lead := sim.precedingArrival(ac)
+		if lead == nil {
+			continue
+		}
+		leadCat, trailCat := lead.Performance.WakeCategory(), ac.Performance.WakeCategory()
+		required := wakeSeparation(leadCat, trailCat)
+		dist := nmdistance2ll(ac.Position, lead.Position)
+		if required == 0 || dist >= required {
+			continue
+		}
+
+		key := [2]string{lead.Callsign, callsign}
+		if _, ok := sim.wakeEncounters[key]; ok {
+			continue
+		}
+		sim.wakeEncounters[key] = nil
+		lg.Printf("%s: %.1fnm behind %s %s, %.0fnm required", callsign, dist, leadCat, lead.Callsign, required)
+		sim.scoreWakeViolation(ac, lead, dist, required)
+
+		if dist < wakeGoAroundFraction*required {
+			pilotResponse(callsign, "going around, wake turbulence behind the %s", leadCat)
+			ac.GoAround(sim)
+			delete(sim.WillGoAround, callsign)
+			sim.recording.AddEvent(SessionEventGoAround, ac, now, "%s went around due to wake turbulence",
+				callsign)
+		} else {
+			pilotResponse(callsign, "we just had a wake encounter behind the %s", leadCat)
+		}
+	}
+
+	// Forget about pairs that are no longer on final together.
+	for key := range sim.wakeEncounters {
+		if ac, ok := sim.Aircraft[key[1]]; !ok || !ac.OnFinal {
+			delete(sim.wakeEncounters, key)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// wake_test.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"testing"
+)
+
+func TestWakeSeparation(t *testing.T) {
+	// Indexed by leading then trailing category: small, large, heavy, super.
+	expected := [4][4]float32{
+		{0, 0, 0, 0},
+		{4, 0, 0, 0},
+		{6, 5, 4, 4},
+		{8, 7, 6, 0},
+	}
+	for lead := WakeSmall; lead <= WakeSuper; lead++ {
+		for trail := WakeSmall; trail <= WakeSuper; trail++ {
+			if s := wakeSeparation(lead, trail); s != expected[lead][trail] {
+				t.Errorf("wakeSeparation(%s, %s) = %f, expected %f", lead, trail, s, expected[lead][trail])
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// whatsnew.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"image"
+	_ "image/jpeg"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mmp/imgui-go/v4"
+	"github.com/pkg/browser"
+)
+
+// The release notes for each version of vice are fetched from GitHub
+// along with the check for a new release. The notes for the running
+// version are shown in the "what's new" dialog the first time it is run
+// and the notes for all of the versions can be browsed in the release
+// history window. The notes are written in Markdown; the subset of it
+// that is rendered here is headings, bulleted lists, links, and images.
+
+type ReleaseNotes struct {
+	Version string
+	Date    time.Time
+	URL     string
+	Blocks  []*ReleaseNotesBlock
+}
+
+type ReleaseNotesBlockType int
+
+const (
+	ReleaseNotesText ReleaseNotesBlockType = iota
+	ReleaseNotesHeading
+	ReleaseNotesBullet
+	ReleaseNotesImage
+)
+
+type ReleaseNotesBlock struct {
+	Type ReleaseNotesBlockType
+	Text string
+	// For text, the target of the first link in it, if any; for images,
+	// the image's URL.
+	URL string
+
+	// Images are fetched the first time they are drawn; the decoded image
+	// is sent back to the main thread via imageChan so that the texture
+	// can be created there.
+	imageChan chan image.Image
+	fetching  bool
+	texId     uint32
+	size      imgui.Vec2
+}
+
+const (
+	// Timeout for requests for release information and images.
+	releaseFetchTimeout = 30 * time.Second
+	// At most this much of each response is read.
+	releaseMaxResponseSize = 16 << 20
+	// Releases are fetched this many at a time, for up to
+	// releaseMaxPages pages of them.
+	releasesPerPage = 100
+	releaseMaxPages = 10
+)
+
+var (
+	markdownImageRE = regexp.MustCompile(`^!\[([^\]]*)\]\(([^)\s]+)\)$`)
+	markdownLinkRE  = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]+)\)`)
+)
+
+// ParseReleaseNotes converts the Markdown body of a GitHub release into
+// blocks for drawing.
+func ParseReleaseNotes(body string) []*ReleaseNotesBlock {
+	var blocks []*ReleaseNotesBlock
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if m := markdownImageRE.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, &ReleaseNotesBlock{Type: ReleaseNotesImage, Text: m[1], URL: m[2]})
+			continue
+		}
+
+		b := &ReleaseNotesBlock{Type: ReleaseNotesText}
+		if strings.HasPrefix(line, "#") {
+			b.Type = ReleaseNotesHeading
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		} else if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") {
+			b.Type = ReleaseNotesBullet
+			line = strings.TrimSpace(line[2:])
+		}
+
+		// Links are drawn as their text; clicking on the line opens the
+		// first one.
+		if m := markdownLinkRE.FindStringSubmatch(line); m != nil {
+			b.URL = m[2]
+		}
+		b.Text = markdownLinkRE.ReplaceAllString(line, "$1")
+		b.Text = strings.NewReplacer("**", "", "__", "", "`", "").Replace(b.Text)
+
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func fetchReleaseNotesImage(url string, ch chan image.Image) {
+	defer reportGoroutinePanic()
+	defer close(ch)
+
+	client := http.Client{Timeout: releaseFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		lg.Errorf("%s: %v", url, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		lg.Errorf("%s: %s", url, resp.Status)
+		return
+	}
+
+	img, _, err := image.Decode(io.LimitReader(resp.Body, releaseMaxResponseSize))
+	if err != nil {
+		lg.Errorf("%s: %v", url, err)
+		return
+	}
+	ch <- img
+}
+
+// Images in release notes are scaled down to be at most this wide.
+const releaseNotesImageWidth = 600
+
+func (b *ReleaseNotesBlock) drawImage() {
+	if !b.fetching {
+		b.fetching = true
+		b.imageChan = make(chan image.Image, 1)
+		go fetchReleaseNotesImage(b.URL, b.imageChan)
+	}
+
+	select {
+	case img, ok := <-b.imageChan:
+		if ok {
+			if b.texId != 0 {
+				renderer.DestroyTexture(b.texId)
+			}
+			b.texId = renderer.CreateTextureFromImage(img)
+			sz := img.Bounds().Size()
+			scale := min(float32(1), releaseNotesImageWidth/float32(sz.X))
+			b.size = imgui.Vec2{scale * float32(sz.X), scale * float32(sz.Y)}
+		}
+	default:
+	}
+
+	if b.texId != 0 {
+		imgui.Image(imgui.TextureID(b.texId), b.size)
+	} else if b.Text != "" {
+		imgui.Text("[" + b.Text + "]")
+	}
+}
+
+// freeReleaseNotesTextures frees the textures for the images in the given
+// release notes.
+func freeReleaseNotesTextures(notes []*ReleaseNotes) {
+	for _, n := range notes {
+		for _, b := range n.Blocks {
+			if b.texId != 0 {
+				renderer.DestroyTexture(b.texId)
+				b.texId = 0
+			}
+		}
+	}
+}
+
+func drawReleaseNotes(notes *ReleaseNotes) {
+	for _, b := range notes.Blocks {
+		if b.Type == ReleaseNotesImage {
+			b.drawImage()
+			continue
+		}
+
+		if b.URL != "" {
+			imgui.PushStyleColor(imgui.StyleColorText, UITextHighlightColor.imgui())
+		}
+		switch b.Type {
+		case ReleaseNotesHeading:
+			imgui.PushFont(ui.aboutFont.ifont)
+			imgui.Text(b.Text)
+			imgui.PopFont()
+		case ReleaseNotesBullet:
+			text, _ := wrapText(b.Text, 100, 4, false)
+			imgui.Text(FontAwesomeIconSquare + " " + text)
+		default:
+			text, _ := wrapText(b.Text, 100, 0, false)
+			imgui.Text(text)
+		}
+		if b.URL != "" {
+			imgui.PopStyleColor()
+			if imgui.IsItemHovered() {
+				imgui.SetTooltip(b.URL)
+				if imgui.IsMouseClicked(0) {
+					browser.OpenURL(b.URL)
+				}
+			}
+		}
+	}
+}
+
+// currentReleaseNotes returns the notes for the running version of vice,
+// or nil if they aren't available.
+func currentReleaseNotes() *ReleaseNotes {
+	if buildVersion == "" {
+		return nil
+	}
+	for _, notes := range ui.releaseNotes {
+		if notes.Version == buildVersion {
+			return notes
+		}
+	}
+	return nil
+}
+
+// receiveReleaseNotes checks whether the release notes have arrived from
+// checkForNewRelease; if so, the "what's new" dialog is shown if the user
+// hasn't yet seen the notes for this version.
+func receiveReleaseNotes() {
+	if ui.releaseNotesChan == nil {
+		return
+	}
+
+	select {
+	case notes, ok := <-ui.releaseNotesChan:
+		if ok {
+			freeReleaseNotesTextures(ui.releaseNotes)
+			ui.releaseNotes = notes
+			if !ui.showingWhatsNew && currentReleaseNotes() != nil &&
+				globalConfig.WhatsNewVersion != buildVersion {
+				ui.showingWhatsNew = true
+				uiShowModalDialog(NewModalDialogBox(&WhatsNewModalClient{}), false)
+			}
+		} else {
+			ui.releaseNotesChan = nil
+		}
+	default:
+	}
+}
+
+type WhatsNewModalClient struct{}
+
+func (nr *WhatsNewModalClient) Title() string {
+	return "What's new in this version of vice"
+}
+
+func (nr *WhatsNewModalClient) Opening() {}
+
+func (nr *WhatsNewModalClient) Buttons() []ModalDialogButton {
+	seen := func() {
+		globalConfig.WhatsNewIndex = len(whatsNew)
+		globalConfig.WhatsNewVersion = buildVersion
+		ui.showingWhatsNew = false
+	}
+	return []ModalDialogButton{
+		ModalDialogButton{
+			text: "Release history...",
+			action: func() bool {
+				seen()
+				releaseHistoryWindow.show = true
+				return true
+			},
+		},
+		ModalDialogButton{
+			text:   "Ok",
+			cancel: true,
+			action: func() bool {
+				seen()
+				return true
+			},
+		},
+	}
+}
+
+func (nr *WhatsNewModalClient) Draw() int {
+	if notes := currentReleaseNotes(); notes != nil {
+		drawReleaseNotes(notes)
+	} else {
+		for i := globalConfig.WhatsNewIndex; i < len(whatsNew); i++ {
+			imgui.Text(FontAwesomeIconSquare + " " + whatsNew[i])
+		}
+	}
+	return -1
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Release history window
+
+var releaseHistoryWindow struct {
+	show bool
+}
+
+func releaseHistoryDrawUI() {
+	if !releaseHistoryWindow.show {
+		return
+	}
+
+	imgui.BeginV("Release History", &releaseHistoryWindow.show, imgui.WindowFlagsAlwaysAutoResize)
+
+	if len(ui.releaseNotes) == 0 {
+		if ui.releaseNotesChan != nil {
+			imgui.Text("Fetching release notes...")
+		} else {
+			imgui.Text("Unable to fetch the release notes.")
+		}
+		for _, s := range whatsNew {
+			imgui.Text(FontAwesomeIconSquare + " " + s)
+		}
+	}
+
+	for _, notes := range ui.releaseNotes {
+		label := notes.Version + " (" + notes.Date.Format("2006-01-02") + ")"
+		if notes.Version == buildVersion {
+			label += " - current version"
+		}
+		if imgui.CollapsingHeader(label) {
+			imgui.PushID(notes.Version)
+			drawReleaseNotes(notes)
+			if notes.URL != "" && imgui.Button("View on GitHub...") {
+				browser.OpenURL(notes.URL)
+			}
+			imgui.PopID()
+		}
+	}
+
+	imgui.End()
+}
@@ -41,6 +41,15 @@ var (
 		// back to the previous one (e.g., the CLIPane.)
 		keyboardFocusStack []Pane
 
+		// The Pane and mouse position when the secondary mouse button was
+		// last pressed; if it's released without the mouse having moved,
+		// the pane context menu is opened for contextMenuPane. (Dragging
+		// with the secondary button is used to pan the radar scope, so
+		// only clicks should open the menu.)
+		contextClickPane Pane
+		contextClickPos  [2]float32
+		contextMenuPane  Pane
+
 		lastAircraftResponse string
 		eventsId             EventSubscriberId
 	}
@@ -214,6 +223,10 @@ func (d *DisplayNode) UnmarshalJSON(s []byte) error {
 // VisitPanes visits all of the Panes in a DisplayNode hierarchy, calling
 // the provided callback function for each one.
 func (d *DisplayNode) VisitPanes(visit func(Pane)) {
+	if d == nil {
+		// There are no panes when running headless.
+		return
+	}
 	switch d.SplitLine.Axis {
 	case SplitAxisNone:
 		visit(d.Pane)
@@ -263,7 +276,7 @@ func (d *DisplayNode) SplitY(y float32, newChild *DisplayNode) *DisplayNode {
 	if d.SplitLine.Axis != SplitAxisNone {
 		lg.Errorf("splitting a non-leaf node: %v", d)
 	}
-	return &DisplayNode{SplitLine: SplitLine{Axis: SplitAxisX, Pos: y},
+	return &DisplayNode{SplitLine: SplitLine{Axis: SplitAxisY, Pos: y},
 		Children: [2]*DisplayNode{d, newChild}}
 }
 
@@ -381,6 +394,144 @@ func wmDrawUI(p Platform) {
 			}
 		}
 	})
+
+	wmDrawContextMenu()
+}
+
+// wmPaneTypes lists the Panes that can be created from the pane context
+// menu.
+var wmPaneTypes = []struct {
+	name string
+	make func() Pane
+}{
+	{"STARS", func() Pane { return NewSTARSPane() }},
+	{"Flight Strips", func() Pane { return NewFlightStripPane() }},
+	{"Reference", func() Pane { return NewReferencePane() }},
+	{"Pilot Messages", func() Pane { return NewPilotMessagePane() }},
+	{"Aircraft Table", func() Pane { return NewAircraftTablePane() }},
+	{"Instructions", func() Pane { return NewInstructionsPane() }},
+	{"Notice Board", func() Pane { return NewNoticeBoardPane() }},
+	{"Departure Releases", func() Pane { return NewDepartureReleasePane() }},
+	{"Scenario Editor", func() Pane { return NewScenarioEditorPane() }},
+	{"Empty", func() Pane { return NewEmptyPane() }},
+}
+
+// wmNewPane activates a newly-created Pane and sets it up for the current
+// scenario.
+func wmNewPane(pane Pane) Pane {
+	pane.Activate()
+	if stars, ok := pane.(*STARSPane); ok {
+		if scenarioGroup != nil {
+			stars.ResetScenarioGroup()
+		}
+		if sim != nil && sim.Scenario != nil {
+			stars.ResetScenario(sim.Scenario)
+		}
+	}
+	return pane
+}
+
+// wmPaneTypeMenu draws a menu of the Pane types that can be created,
+// returning a new activated Pane if one was selected.
+func wmPaneTypeMenu(label string) Pane {
+	var pane Pane
+	if imgui.BeginMenu(label) {
+		for _, pt := range wmPaneTypes {
+			if imgui.MenuItem(pt.name) {
+				pane = wmNewPane(pt.make())
+			}
+		}
+		imgui.EndMenu()
+	}
+	return pane
+}
+
+// wmDrawContextMenu draws the context menu that is opened by
+// right-clicking in a Pane; it allows the Pane to be split, replaced,
+// swapped with another Pane, or closed. Since the display hierarchy is
+// stored in the GlobalConfig, the resulting layout is saved along with the
+// rest of the configuration.
+func wmDrawContextMenu() {
+	if !imgui.BeginPopup("PaneContextMenu") {
+		wm.contextMenuPane = nil
+		return
+	}
+
+	pane := wm.contextMenuPane
+	node := globalConfig.DisplayRoot.NodeForPane(pane)
+	if pane == nil || node == nil {
+		// It was removed some other way while the menu was open.
+		imgui.CloseCurrentPopup()
+		imgui.EndPopup()
+		return
+	}
+
+	imgui.Text(pane.Name())
+	imgui.Separator()
+
+	if newPane := wmPaneTypeMenu("Split left and right"); newPane != nil {
+		leaf := &DisplayNode{Pane: pane}
+		*node = *leaf.SplitX(0.5, &DisplayNode{Pane: newPane})
+	}
+	if newPane := wmPaneTypeMenu("Split top and bottom"); newPane != nil {
+		// Children[0] is the lower half, so this keeps the existing Pane
+		// on top.
+		leaf := &DisplayNode{Pane: pane}
+		*node = *(&DisplayNode{Pane: newPane}).SplitY(0.5, leaf)
+	}
+	if newPane := wmPaneTypeMenu("Replace with"); newPane != nil {
+		node.Pane = newPane
+		wmClosePane(pane)
+	}
+
+	var others []Pane
+	globalConfig.DisplayRoot.VisitPanes(func(p Pane) {
+		if _, ok := p.(*SplitLine); !ok && p != pane {
+			others = append(others, p)
+		}
+	})
+	if imgui.BeginMenuV("Swap with", len(others) > 0) {
+		for _, other := range others {
+			if imgui.MenuItem(fmt.Sprintf("%s##%p", other.Name(), other)) {
+				otherNode := globalConfig.DisplayRoot.NodeForPane(other)
+				node.Pane, otherNode.Pane = otherNode.Pane, node.Pane
+			}
+		}
+		imgui.EndMenu()
+	}
+
+	if _, ok := pane.(PaneUIDrawer); ok && imgui.MenuItem("Settings...") {
+		wmShowPaneSettings(pane)
+	}
+
+	imgui.Separator()
+	if imgui.MenuItemV("Close", "", false, node != globalConfig.DisplayRoot) {
+		wmRemovePane(pane)
+	}
+
+	imgui.EndPopup()
+}
+
+// wmShowPaneSettings opens the settings window for the given Pane.
+func wmShowPaneSettings(pane Pane) {
+	show := true
+	wm.showPaneSettings[pane] = &show
+	wm.showPaneName[pane] = pane.Name()
+}
+
+// wmClosePane deactivates a Pane that has been removed from the display
+// hierarchy and cleans up the window manager's state for it.
+func wmClosePane(pane Pane) {
+	pane.Deactivate()
+
+	if _, ok := wm.showPaneSettings[pane]; ok {
+		delete(wm.showPaneSettings, pane)
+		delete(wm.showPaneName, pane)
+	}
+	if wm.keyboardFocusPane == pane {
+		wm.keyboardFocusPane = nil
+	}
+	wm.keyboardFocusStack = FilterSlice(wm.keyboardFocusStack, func(p Pane) bool { return p != pane })
 }
 
 // wmTakeKeyboardFocus allows a Pane to take the keyboard
@@ -423,6 +574,28 @@ func wmPaneIsPresent(pane Pane) bool {
 	return found
 }
 
+// wmAddPane adds the given pane to the right side of the window, giving
+// it the fraction 1-x of the window's width.
+func wmAddPane(pane Pane, x float32) {
+	pane.Activate()
+	globalConfig.DisplayRoot = &DisplayNode{
+		SplitLine: SplitLine{Pos: x, Axis: SplitAxisX},
+		Children:  [2]*DisplayNode{globalConfig.DisplayRoot, &DisplayNode{Pane: pane}},
+	}
+}
+
+// wmRemovePane removes the given pane from the display hierarchy; its
+// sibling takes over the space it was using.
+func wmRemovePane(pane Pane) {
+	parent, idx := globalConfig.DisplayRoot.ParentNodeForPane(pane)
+	if parent == nil {
+		// It's either the root or isn't in the hierarchy at all.
+		return
+	}
+	*parent = *parent.Children[1-idx]
+	wmClosePane(pane)
+}
+
 // wmDrawPanes is called each time through the main rendering loop; it
 // handles all of the details of drawing the Panes in the display
 // hierarchy, making sure they don't inadvertently draw over other panes,
@@ -463,6 +636,22 @@ func wmDrawPanes(platform Platform, renderer Renderer) {
 
 	io := imgui.CurrentIO()
 
+	// Open the pane context menu if the secondary mouse button was
+	// clicked without dragging.
+	if !io.WantCaptureMouse() {
+		if imgui.IsMouseClicked(MouseButtonSecondary) {
+			wm.contextClickPane = mousePane
+			wm.contextClickPos = mousePos
+		} else if imgui.IsMouseReleased(MouseButtonSecondary) && wm.contextClickPane != nil {
+			_, isSplit := mousePane.(*SplitLine)
+			if mousePane == wm.contextClickPane && !isSplit && distance2f(mousePos, wm.contextClickPos) < 3 {
+				wm.contextMenuPane = mousePane
+				imgui.OpenPopup("PaneContextMenu")
+			}
+			wm.contextClickPane = nil
+		}
+	}
+
 	// If the user has clicked or is dragging in a Pane, record it in
 	// mouseConsumerOverride so that we can continue to dispatch mouse
 	// events to that Pane until the mouse button is released, even if the
@@ -500,6 +689,18 @@ func wmDrawPanes(platform Platform, renderer Renderer) {
 		setCursorForPane(mousePane)
 	}
 
+	// The help overlay is shown for the Pane that the mouse is over, or
+	// the one with the keyboard focus if it's over a split line.
+	helpPane := mousePane
+	if _, ok := helpPane.(*SplitLine); ok || helpPane == nil {
+		helpPane = wm.keyboardFocusPane
+	}
+
+	// If a screenshot has been requested, this is the framebuffer
+	// rectangle of the pane to capture.
+	capturePane := screenshotPane()
+	var captureRect [4]int
+
 	// All of the Panes' draw commands will be added to commandBuffer.
 	commandBuffer := GetCommandBuffer()
 	defer ReturnCommandBuffer(commandBuffer)
@@ -563,8 +764,22 @@ func wmDrawPanes(platform Platform, renderer Renderer) {
 				commandBuffer.Scissor(x0, y0, w, h)
 				commandBuffer.Viewport(x0, y0, w, h)
 
-				// Let the Pane do its thing
+				// Let the Pane do its thing; annotation mode takes the
+				// input events for the pane that screenshots capture.
+				if pane == capturePane {
+					screenshotHandleInput(&ctx)
+				}
 				pane.Draw(&ctx, commandBuffer)
+				commandBuffer.ResetState()
+
+				if pane == helpPane {
+					helpOverlayDraw(pane, &ctx, commandBuffer)
+					commandBuffer.ResetState()
+				}
+				if pane == capturePane {
+					screenshotDrawOverlay(pane, &ctx, commandBuffer)
+					captureRect = [4]int{x0, y0, w, h}
+				}
 
 				// And reset the graphics state to the standard baseline,
 				// so no state changes leak and affect subsequent drawing.
@@ -581,13 +796,22 @@ func wmDrawPanes(platform Platform, renderer Renderer) {
 		// Finally, render the entire command buffer for all of the Panes
 		// all at once.
 		stats.render = renderer.RenderCommandBuffer(commandBuffer)
+
+		videoCaptureFrame(false, captureRect[0], captureRect[1], captureRect[2], captureRect[3])
+
+		if screenshot.pending {
+			screenshot.pending = false
+			if captureRect[2] > 0 && captureRect[3] > 0 {
+				screenshotSave(renderer.ReadPixels(captureRect[0], captureRect[1], captureRect[2], captureRect[3]))
+			}
+		}
 	}
 }
 
 // wmDrawStatus bar draws the status bar underneath the main menu bar
 func wmDrawStatusBar(fbSize [2]float32, displaySize [2]float32, cb *CommandBuffer) {
-	var texts []string
-	textCallsign := ""
+	var texts, landline []string
+	textCallsign, callsign := "", ""
 	for _, event := range eventStream.Get(wm.eventsId) {
 		switch v := event.(type) {
 		case *RadioTransmissionEvent:
@@ -617,10 +841,24 @@ func wmDrawStatusBar(fbSize [2]float32, displaySize [2]float32, cb *CommandBuffe
 			}
 
 			texts = append(texts, v.message)
+			callsign = v.callsign
+			playPilotTransmission(v.callsign)
+
+		case *LandlineMessageEvent:
+			landline = append(landline, v.from+" (landline): "+v.message)
 		}
 	}
 	if texts != nil {
 		wm.lastAircraftResponse = strings.Join(texts, ", ") + ", " + textCallsign
+		pan, volume := transmissionPosition(callsign)
+		speakPilotTransmission(callsign, wm.lastAircraftResponse, pan, volume)
+	}
+	if landline != nil {
+		// Radio transmissions received at the same time are still shown.
+		if texts != nil {
+			landline = append([]string{wm.lastAircraftResponse}, landline...)
+		}
+		wm.lastAircraftResponse = strings.Join(landline, "; ")
 	}
 
 	if wm.lastAircraftResponse == "" {
@@ -0,0 +1,188 @@
+// wxdeviation.go
+// Copyright(c) 2022 Matt Pharr, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Aircraft ask to deviate around weather ahead of them--convective
+// SIGMETs (see sigmet.go) and heavy precipitation (see precipitation.go)
+// --by turning some number of degrees left or right. The user approves or
+// denies the request with the WXA and WXD commands or from the
+// PilotMessagePane. A deviating aircraft keeps flying its new heading; it
+// reports when its route is clear of the weather, and the user can clear
+// it direct to a fix on its route "when able" with WD<fix>, in which case
+// it proceeds direct once it can do so without going through the weather.
+
+// Aircraft that ask to deviate for weather ask for this many degrees.
+const weatherDeviationDegrees = 20
+
+// weatherDirection returns "left" or "right" for deviations of the given
+// number of degrees; negative is to the left.
+func weatherDirection(degrees int) string {
+	if degrees < 0 {
+		return "left"
+	}
+	return "right"
+}
+
+// deviationAwayFrom returns the number of degrees for the aircraft to ask
+// to deviate in order to turn away from the given point: to the left
+// (negative) if it is to the right of the aircraft's heading and to the
+// right otherwise.
+func deviationAwayFrom(ac *Aircraft, p Point2LL) int {
+	hdg := ac.Heading - scenarioGroup.MagneticVariation
+	dir := [2]float32{sin(radians(hdg)), cos(radians(hdg))}
+	v := sub2f(ll2nm(p), ll2nm(ac.Position))
+	if dir[0]*v[1]-dir[1]*v[0] < 0 {
+		return -weatherDeviationDegrees
+	}
+	return weatherDeviationDegrees
+}
+
+// requestWeatherDeviation has the pilot ask to deviate by the given
+// number of degrees, where negative is to the left.
+func (sim *Sim) requestWeatherDeviation(ac *Aircraft, degrees int, what string) {
+	dir := weatherDirection(degrees)
+	pilotReadback(ac.Callsign, "weather_deviation_request", ReadbackData{Degrees: abs(degrees), Direction: dir})
+	req := sim.addPilotRequest(ac, PilotRequestWeatherDeviation, 0,
+		fmt.Sprintf("request %d degrees %s for %s", abs(degrees), dir, what))
+	req.Degrees = degrees
+}
+
+// weatherRequest returns the aircraft's pending request to deviate for
+// weather.
+func (sim *Sim) weatherRequest(callsign string) (*PilotRequest, error) {
+	if _, ok := sim.Aircraft[callsign]; !ok {
+		return nil, ErrNoAircraftForCallsign
+	}
+	idx := FindIf(sim.PilotRequests, func(r *PilotRequest) bool {
+		return r.Callsign == callsign && r.Type == PilotRequestWeatherDeviation
+	})
+	if idx == -1 {
+		return nil, ErrNoPilotRequest
+	}
+	return sim.PilotRequests[idx], nil
+}
+
+// ApproveWeatherDeviation approves the aircraft's pending request to
+// deviate for weather.
+func (sim *Sim) ApproveWeatherDeviation(callsign string) error {
+	req, err := sim.weatherRequest(callsign)
+	if err != nil {
+		return err
+	}
+	return sim.RespondToPilotRequest(req.Id, PilotReplyApprove)
+}
+
+// DenyWeatherDeviation denies the aircraft's pending request to deviate
+// for weather.
+func (sim *Sim) DenyWeatherDeviation(callsign string) error {
+	req, err := sim.weatherRequest(callsign)
+	if err != nil {
+		return err
+	}
+	return sim.RespondToPilotRequest(req.Id, PilotReplyDeny)
+}
+
+// deviateForWeather turns the aircraft the given number of degrees from
+// its current heading; negative is to the left.
+func (sim *Sim) deviateForWeather(ac *Aircraft, degrees int) {
+	pilotReadback(ac.Callsign, "weather_deviation_approved",
+		ReadbackData{Degrees: abs(degrees), Direction: weatherDirection(degrees)})
+	ac.turnForWeather(degrees)
+}
+
+// turnForWeather turns the aircraft the given number of degrees from its
+// current heading to deviate around weather; negative is to the left.
+func (ac *Aircraft) turnForWeather(degrees int) {
+	ac.CancelHold()
+	ac.clearReadbackError(ReadbackErrorHeading)
+	ac.AssignedHeading = int(ac.Heading) + degrees
+	if ac.AssignedHeading <= 0 {
+		ac.AssignedHeading += 360
+	} else if ac.AssignedHeading > 360 {
+		ac.AssignedHeading -= 360
+	}
+	ac.TurnDirection = 0
+	ac.ClearedApproach = false
+	ac.DeviatingForWeather = true
+	ac.WhenAbleDirect = ""
+}
+
+// CancelWeatherDeviation is called when the aircraft is given a heading
+// or a direct, which supersedes its deviation.
+func (ac *Aircraft) CancelWeatherDeviation() {
+	ac.DeviatingForWeather, ac.WhenAbleDirect = false, ""
+}
+
+// DirectWhenAble clears the aircraft direct to the given fix in its
+// route once it's clear of the weather.
+func (sim *Sim) DirectWhenAble(callsign string, fix string) error {
+	ac, ok := sim.Aircraft[callsign]
+	if !ok {
+		return ErrNoAircraftForCallsign
+	}
+
+	fix = strings.ToUpper(fix)
+	if FindIf(ac.Waypoints, func(wp Waypoint) bool { return wp.Fix == fix }) == -1 {
+		if err := sim.suggestFix(callsign, fix, true); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s: fix not found in route", fix)
+	}
+
+	pilotReadback(callsign, "when_able_direct", ReadbackData{Fix: fix})
+	ac.WhenAbleDirect = fix
+	return nil
+}
+
+// weatherOnPath returns true if flying directly from the aircraft's
+// position to p would take it through a convective SIGMET or heavy
+// precipitation.
+func (sim *Sim) weatherOnPath(ac *Aircraft, p Point2LL) bool {
+	path := []Point2LL{ac.Position, p}
+	return sim.convectionOnPath(ac.Altitude, path) != nil ||
+		sim.precipitationOnPath(ac.Altitude, path, nmdistance2ll(ac.Position, p)) != nil
+}
+
+// updateWeatherDeviations has deviating aircraft that are clear of the
+// weather say so or, if they've been cleared direct when able or are
+// worked by a virtual controller, proceed direct; it should be called
+// once a second.
+func (sim *Sim) updateWeatherDeviations() {
+	for _, callsign := range SortedMapKeys(sim.Aircraft) {
+		ac := sim.Aircraft[callsign]
+		if !ac.DeviatingForWeather && ac.WhenAbleDirect == "" {
+			continue
+		}
+
+		if ac.WhenAbleDirect != "" {
+			idx := FindIf(ac.Waypoints, func(wp Waypoint) bool { return wp.Fix == ac.WhenAbleDirect })
+			if idx == -1 {
+				// It's no longer in the route.
+				ac.CancelWeatherDeviation()
+				continue
+			}
+			if wp := ac.Waypoints[idx]; !sim.weatherOnPath(ac, wp.Location) {
+				pilotResponse(callsign, "clear of the weather, proceeding direct %s", wp.Fix)
+				ac.Waypoints = ac.Waypoints[idx:]
+				ac.WaypointUpdate(wp)
+				ac.AssignedHeading, ac.TurnDirection = 0, 0
+				ac.clearReadbackError(ReadbackErrorHeading)
+				ac.CancelWeatherDeviation()
+			}
+		} else if len(ac.Waypoints) > 0 && !sim.weatherOnPath(ac, ac.Waypoints[0].Location) {
+			if sim.humanController(ac.TrackingController) {
+				pilotResponse(callsign, "we're clear of the weather, request direct %s", ac.Waypoints[0].Fix)
+			} else {
+				ac.AssignedHeading, ac.TurnDirection = 0, 0
+			}
+			ac.DeviatingForWeather = false
+		}
+	}
+}